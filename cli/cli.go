@@ -0,0 +1,196 @@
+// Package cli implements a minimal framework for command line programs built of subcommands,
+// including argument parsing, usage output and shell completion.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ErrUsage is wrapped by errors caused by an invalid command line.
+var ErrUsage = errors.New("usage error")
+
+// Names of the built-in commands.
+const (
+	helpCommand       = "help"
+	completionCommand = "completion"
+	completeCommand   = "__complete"
+)
+
+// Args represents parsed positional arguments of a command.
+type Args struct {
+	// Positional holds arguments interleaved with flags.
+	Positional []string
+	// Command holds arguments provided after the "--" separator.
+	Command []string
+	// Out is the output of the application, which commands print their results to.
+	Out io.Writer
+}
+
+// Command represents a subcommand of a program.
+type Command struct {
+	Name     string
+	Synopsis string
+	Summary  string
+	// Flags registers flags of the command.
+	Flags func(flags *flag.FlagSet)
+	// Complete returns completion candidates for positional arguments.
+	// It is called after the flags preceding the completed word are parsed.
+	Complete func() []string
+	// CompleteFlag returns completion candidates for values of the named flags.
+	CompleteFlag map[string]func() []string
+	Run          func(args Args) error
+}
+
+// App represents a program built of subcommands.
+type App struct {
+	Name   string
+	Footer string
+	// Flags registers global flags, which are accepted both before and after the command name.
+	Flags    func(flags *flag.FlagSet)
+	Commands []*Command
+	Out      io.Writer
+}
+
+// usageError annotates an error as an invalid command line without altering the message.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() []error {
+	return []error{ErrUsage, e.err}
+}
+
+// Usagef formats an error caused by an invalid command line.
+func Usagef(format string, a ...any) error {
+	return &usageError{fmt.Errorf(format, a...)}
+}
+
+// Run parses the command line arguments (without the program name) and runs the selected command.
+func (a *App) Run(args []string) error {
+	if len(args) != 0 && args[0] == completeCommand {
+		for _, candidate := range a.complete(args[1:]) {
+			fmt.Fprintln(a.Out, candidate)
+		}
+		return nil
+	}
+	global := a.newFlagSet(nil)
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			a.printUsage()
+			return nil
+		}
+		return &usageError{err}
+	}
+	args = global.Args()
+	if len(args) == 0 || args[0] == helpCommand {
+		a.printUsage()
+		return nil
+	}
+	if args[0] == completionCommand {
+		return a.printCompletion(args[1:])
+	}
+	cmd := a.lookup(args[0])
+	if cmd == nil {
+		return Usagef("unknown command %q", args[0])
+	}
+	flags := a.newFlagSet(cmd)
+	parsed, err := parse(flags, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		a.printCommandUsage(cmd, flags)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	parsed.Out = a.Out
+	return cmd.Run(parsed)
+}
+
+func (a *App) lookup(name string) *Command {
+	for _, cmd := range a.Commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// newFlagSet returns global flags combined with flags of the command, if any.
+func (a *App) newFlagSet(cmd *Command) *flag.FlagSet {
+	name := a.Name
+	if cmd != nil {
+		name = cmd.Name
+	}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	if a.Flags != nil {
+		a.Flags(flags)
+	}
+	if cmd != nil && cmd.Flags != nil {
+		cmd.Flags(flags)
+	}
+	return flags
+}
+
+// parse parses flags interleaved with positional arguments, which the standard
+// flag package does not support, and splits off the arguments after "--".
+func parse(flags *flag.FlagSet, args []string) (Args, error) {
+	var parsed Args
+	if i := slices.Index(args, "--"); i != -1 {
+		args, parsed.Command = args[:i], args[i+1:]
+	}
+	for {
+		if err := flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return parsed, err
+			}
+			return parsed, &usageError{err}
+		}
+		if flags.NArg() == 0 {
+			return parsed, nil
+		}
+		parsed.Positional = append(parsed.Positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+func (a *App) printUsage() {
+	fmt.Fprintln(a.Out, "Usage:")
+	for _, cmd := range a.Commands {
+		fmt.Fprintln(a.Out, "  "+strings.TrimSpace(a.Name+" "+cmd.Name+" "+cmd.Synopsis))
+	}
+	fmt.Fprintf(a.Out, "  %s %s bash|zsh|fish\n", a.Name, completionCommand)
+	global := a.newFlagSet(nil)
+	if hasFlags(global) {
+		fmt.Fprintln(a.Out, "\nGlobal flags:")
+		global.SetOutput(a.Out)
+		global.PrintDefaults()
+	}
+	if a.Footer != "" {
+		fmt.Fprintf(a.Out, "\n%s\n", a.Footer)
+	}
+}
+
+func (a *App) printCommandUsage(cmd *Command, flags *flag.FlagSet) {
+	fmt.Fprintf(a.Out, "Usage:\n  %s\n\n%s\n", strings.TrimSpace(a.Name+" "+cmd.Name+" "+cmd.Synopsis), cmd.Summary)
+	if hasFlags(flags) {
+		fmt.Fprintln(a.Out, "\nFlags:")
+		flags.SetOutput(a.Out)
+		flags.PrintDefaults()
+	}
+}
+
+func hasFlags(flags *flag.FlagSet) bool {
+	found := false
+	flags.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
@@ -0,0 +1,283 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/cli"
+	"github.com/google/go-cmp/cmp"
+)
+
+// newTestApp returns an application with a single command recording its parsed arguments.
+func newTestApp(out *bytes.Buffer, got *cli.Args, all *bool, kind *string) *cli.App {
+	return &cli.App{
+		Name: "golab",
+		Commands: []*cli.Command{
+			{
+				Name:     "exec",
+				Synopsis: "(NODE | --all | --kind KIND) -- COMMAND",
+				Summary:  "Run a command.",
+				Flags: func(flags *flag.FlagSet) {
+					flags.BoolVar(all, "all", false, "all nodes")
+					flags.StringVar(kind, "kind", "", "node kind")
+				},
+				Complete: func() []string {
+					if *kind != "" {
+						return []string{"R3"}
+					}
+					return []string{"R1", "R2", "S1"}
+				},
+				CompleteFlag: map[string]func() []string{
+					"kind": func() []string { return []string{"frr", "crpd"} },
+				},
+				Run: func(args cli.Args) error {
+					*got = args
+					return nil
+				},
+			},
+		},
+		Out: out,
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	var (
+		out  bytes.Buffer
+		got  cli.Args
+		all  bool
+		kind string
+	)
+	app := newTestApp(&out, &got, &all, &kind)
+	err := app.Run([]string{"exec", "R1", "--kind", "frr", "R2", "--", "ping", "--all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cli.Args{Positional: []string{"R1", "R2"}, Command: []string{"ping", "--all"}, Out: &out}
+	sameWriter := cmp.Comparer(func(a, b io.Writer) bool { return a == b })
+	if diff := cmp.Diff(want, got, sameWriter); diff != "" {
+		t.Errorf("args mismatch (-want +got):\n%s", diff)
+	}
+	if all || kind != "frr" {
+		t.Errorf("flags: want all=false kind=frr, got all=%t kind=%s", all, kind)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		args    []string
+		wantMsg string
+	}{
+		{
+			name:    "UnknownCommand",
+			args:    []string{"build"},
+			wantMsg: `unknown command "build"`,
+		},
+		{
+			name:    "UnknownFlag",
+			args:    []string{"exec", "--any"},
+			wantMsg: "flag provided but not defined: -any",
+		},
+		{
+			name:    "UnsupportedShell",
+			args:    []string{"completion", "tcsh"},
+			wantMsg: `unsupported shell "tcsh", supported: bash, zsh, fish`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				out  bytes.Buffer
+				got  cli.Args
+				all  bool
+				kind string
+			)
+			err := newTestApp(&out, &got, &all, &kind).Run(tc.args)
+			if err == nil || err.Error() != tc.wantMsg {
+				t.Errorf("error: want %q, got %v", tc.wantMsg, err)
+			}
+			if !errors.Is(err, cli.ErrUsage) {
+				t.Errorf("error: want %v, got %v", cli.ErrUsage, err)
+			}
+		})
+	}
+}
+
+func TestHelp(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "Program",
+			args: nil,
+			want: []string{"  golab exec (NODE | --all | --kind KIND) -- COMMAND", "  golab completion bash|zsh|fish"},
+		},
+		{
+			name: "Command",
+			args: []string{"exec", "-h"},
+			want: []string{"Run a command.", "-kind string"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				out  bytes.Buffer
+				got  cli.Args
+				all  bool
+				kind string
+			)
+			if err := newTestApp(&out, &got, &all, &kind).Run(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("usage: want %q in\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		words []string
+		want  string
+	}{
+		{
+			name:  "Commands",
+			words: []string{"e"},
+			want:  "exec\n",
+		},
+		{
+			name:  "Shells",
+			words: []string{"completion", ""},
+			want:  "bash\nzsh\nfish\n",
+		},
+		{
+			name:  "Flags",
+			words: []string{"exec", "--"},
+			want:  "--all\n--kind\n",
+		},
+		{
+			name:  "FlagValues",
+			words: []string{"exec", "--kind", "c"},
+			want:  "crpd\n",
+		},
+		{
+			name:  "Positional",
+			words: []string{"exec", "--all", "R"},
+			want:  "R1\nR2\n",
+		},
+		{
+			name:  "PositionalAfterFlags",
+			words: []string{"exec", "--kind", "frr", ""},
+			want:  "R3\n",
+		},
+		{
+			name:  "CommandArguments",
+			words: []string{"exec", "R1", "--", ""},
+			want:  "",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				out  bytes.Buffer
+				got  cli.Args
+				all  bool
+				kind string
+			)
+			app := newTestApp(&out, &got, &all, &kind)
+			if err := app.Run(append([]string{"__complete"}, tc.words...)); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tc.want {
+				t.Errorf("candidates: want %q, got %q", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	t.Parallel()
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		t.Run(shell, func(t *testing.T) {
+			t.Parallel()
+			var (
+				out  bytes.Buffer
+				got  cli.Args
+				all  bool
+				kind string
+			)
+			if err := newTestApp(&out, &got, &all, &kind).Run([]string{"completion", shell}); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), "golab __complete") {
+				t.Errorf("script: want a call of golab __complete in\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestGlobalFlags(t *testing.T) {
+	t.Parallel()
+	var (
+		out     bytes.Buffer
+		got     cli.Args
+		all     bool
+		kind    string
+		verbose int
+	)
+	app := newTestApp(&out, &got, &all, &kind)
+	app.Flags = func(flags *flag.FlagSet) {
+		flags.BoolFunc("verbose", "verbose output", func(string) error {
+			verbose++
+			return nil
+		})
+	}
+	for _, args := range [][]string{
+		{"--verbose", "exec", "R1", "--", "true"},
+		{"exec", "R1", "--verbose", "--", "true"},
+	} {
+		if err := app.Run(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if verbose != 2 {
+		t.Errorf("global flag: want 2 occurrences, got %d", verbose)
+	}
+	for words, want := range map[string]string{
+		"--v":                   "--verbose\n",
+		"--verbose e":           "exec\n",
+		"--verbose exec --verb": "--verbose\n",
+	} {
+		out.Reset()
+		if err := app.Run(append([]string{"__complete"}, strings.Fields(words)...)); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("candidates for %q: want %q, got %q", words, want, out.String())
+		}
+	}
+	out.Reset()
+	if err := app.Run([]string{"--help"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Global flags:") {
+		t.Errorf("usage: want global flags in\n%s", out.String())
+	}
+}
@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Completion scripts delegate to the hidden __complete command, which prints
+// candidates for the last word of the provided command line, one per line.
+const (
+	bashCompletion = `_%[1]s() {
+  local IFS=$'\n'
+  COMPREPLY=($(%[1]s __complete "${COMP_WORDS[@]:1:COMP_CWORD}"))
+}
+complete -o default -F _%[1]s %[1]s
+`
+	zshCompletion = `#compdef %[1]s
+_%[1]s() {
+  local -a candidates
+  candidates=(${(f)"$(%[1]s __complete "${(@)words[2,CURRENT]}")"})
+  if (( ${#candidates} )); then
+    compadd -- $candidates
+  else
+    _files
+  fi
+}
+compdef _%[1]s %[1]s
+`
+	fishCompletion = `function __%[1]s_complete
+    %[1]s __complete (commandline -opc)[2..-1] (commandline -ct)
+end
+complete -c %[1]s -f -a '(__%[1]s_complete)'
+`
+)
+
+// printCompletion prints the completion script for the provided shell.
+func (a *App) printCompletion(args []string) error {
+	if len(args) != 1 {
+		return Usagef("exactly one shell has to be specified: bash, zsh or fish")
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return Usagef("unsupported shell %q, supported: bash, zsh, fish", args[0])
+	}
+	fmt.Fprintf(a.Out, script, a.Name)
+	return nil
+}
+
+// complete returns candidates for the last of the provided words, which may be empty.
+func (a *App) complete(words []string) []string {
+	if len(words) == 0 {
+		return nil
+	}
+	current := words[len(words)-1]
+	// skip global flags preceding the command name
+	global := a.newFlagSet(nil)
+	for len(words) > 1 && strings.HasPrefix(words[0], "-") {
+		name, ok := flagName(words[0])
+		if ok && !isBoolFlag(global, name) {
+			if len(words) == 2 {
+				// the current word is a global flag value
+				return nil
+			}
+			words = words[1:]
+		}
+		words = words[1:]
+	}
+	if len(words) == 1 && strings.HasPrefix(current, "-") {
+		return filterPrefix(flagNames(global), current)
+	}
+	if len(words) == 1 {
+		names := []string{completionCommand, helpCommand}
+		for _, cmd := range a.Commands {
+			names = append(names, cmd.Name)
+		}
+		return filterPrefix(names, current)
+	}
+	if words[0] == completionCommand {
+		return filterPrefix([]string{"bash", "zsh", "fish"}, current)
+	}
+	cmd := a.lookup(words[0])
+	if cmd == nil {
+		return nil
+	}
+	preceding := words[1 : len(words)-1]
+	if slices.Contains(preceding, "--") {
+		// arguments of the command run by the subcommand
+		return nil
+	}
+	flags := a.newFlagSet(cmd)
+	if len(preceding) != 0 {
+		if name, ok := flagName(preceding[len(preceding)-1]); ok && !isBoolFlag(flags, name) {
+			// the current word is a flag value
+			if complete, ok := cmd.CompleteFlag[name]; ok {
+				return filterPrefix(complete(), current)
+			}
+			return nil
+		}
+	}
+	if strings.HasPrefix(current, "-") {
+		return filterPrefix(flagNames(flags), current)
+	}
+	if cmd.Complete == nil {
+		return nil
+	}
+	// parse preceding flags, so that candidates may depend on them
+	parse(flags, preceding)
+	return filterPrefix(cmd.Complete(), current)
+}
+
+// flagName extracts the name of a flag awaiting a separate value argument.
+func flagName(word string) (string, bool) {
+	if word == "-" || word == "--" || !strings.HasPrefix(word, "-") || strings.Contains(word, "=") {
+		return "", false
+	}
+	return strings.TrimLeft(word, "-"), true
+}
+
+// flagNames lists the flags in the form they are completed: -x for shorthands and --name otherwise.
+func flagNames(flags *flag.FlagSet) []string {
+	var names []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) == 1 {
+			names = append(names, "-"+f.Name)
+			return
+		}
+		names = append(names, "--"+f.Name)
+	})
+	return names
+}
+
+func isBoolFlag(flags *flag.FlagSet, name string) bool {
+	f := flags.Lookup(name)
+	if f == nil {
+		return true
+	}
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var filtered []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
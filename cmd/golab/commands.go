@@ -0,0 +1,842 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/elupevg/golab/cli"
+	"github.com/elupevg/golab/configen"
+	"github.com/elupevg/golab/docker"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/scaffold"
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/version"
+	"golang.org/x/term"
+)
+
+// initCommand scaffolds a topology YAML file and its README from an example template in the current directory.
+func initCommand(log *logger.Logger) *cli.Command {
+	var tmpl, name string
+	return &cli.Command{
+		Name:     "init",
+		Synopsis: "[TEMPLATE] [--name NAME]",
+		Summary:  "Create a ready-to-run topology file with a README from an example template in the current directory.",
+		Flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&tmpl, "template", "triangle", "example topology: "+strings.Join(scaffold.Templates(), ", "))
+			flags.StringVar(&name, "name", filepath.Base(os.Getenv("PWD")), "topology name")
+		},
+		Complete:     scaffold.Templates,
+		CompleteFlag: map[string]func() []string{"template": scaffold.Templates},
+		Run: func(args cli.Args) error {
+			if len(args.Command) != 0 {
+				return cli.Usagef("unexpected arguments %v", args.Command)
+			}
+			switch len(args.Positional) {
+			case 0:
+			case 1:
+				tmpl = args.Positional[0]
+			default:
+				return cli.Usagef("unexpected arguments %v", args.Positional[1:])
+			}
+			yamlFiles, err := findTopologyFiles()
+			if err != nil {
+				return err
+			}
+			if len(yamlFiles) != 0 {
+				return fmt.Errorf("topology file %s already exists", yamlFiles[0])
+			}
+			files, err := scaffold.Render(tmpl, name)
+			if err != nil {
+				return cli.Usagef("%w", err)
+			}
+			for _, file := range files {
+				if _, err := os.Stat(file.Name); err == nil {
+					return fmt.Errorf("file %s already exists", file.Name)
+				}
+			}
+			for _, file := range files {
+				if err := os.WriteFile(file.Name, file.Data, 0o644); err != nil {
+					return err
+				}
+				log.With(file.Name).Success(fmt.Sprintf("created %s from template %s", file.Name, tmpl))
+			}
+			return nil
+		},
+	}
+}
+
+// buildCommand creates the topology and, optionally, waits for its nodes, runs a command against it and wrecks it.
+// This makes a single invocation sufficient to gate changes in CI pipelines.
+func buildCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo        topologyFlags
+		wait        bool
+		timeout     time.Duration
+		teardown    bool
+		summaryFile string
+		autoApprove bool
+		snapshot    string
+	)
+	return &cli.Command{
+		Name:     "build",
+		Synopsis: "[TOPOLOGY...] [--auto-approve] [--snapshot TAG] [--wait] [--timeout DURATION] [--teardown-on-exit] [--summary FILE] [-- COMMAND [ARG...]]",
+		Summary:  "Create the topology, optionally running a command against it before wrecking it.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.BoolVar(&wait, "wait", false, "wait until all nodes are ready")
+			flags.DurationVar(&timeout, "timeout", 0, "fail if the topology is not ready within the provided duration")
+			flags.BoolVar(&teardown, "teardown-on-exit", false, "wreck the topology after the command completes or on interrupt")
+			flags.StringVar(&summaryFile, "summary", "", "write a JSON summary of the outcome to the provided file")
+			flags.BoolVar(&autoApprove, "auto-approve", false, "apply the plan without asking for confirmation")
+			flags.StringVar(&snapshot, "snapshot", "", "restore the nodes from the snapshot with the provided tag")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) (err error) {
+			if len(args.Command) != 0 && !teardown {
+				return cli.Usagef("a command can only be run with --teardown-on-exit")
+			}
+			paths, err := topo.withPositional(args.Positional)
+			if err != nil {
+				return err
+			}
+			start := time.Now()
+			data, err := readTopologyFiles(log, paths, topo.vars)
+			if err != nil {
+				return err
+			}
+			// documents of a topology are merged, so the snapshot is set by an extra one
+			if snapshot != "" {
+				data = fmt.Appendf(data, "\n---\nsnapshot: %q\n", snapshot)
+			}
+			if summaryFile != "" {
+				defer func() {
+					summary := orchestrator.NewSummary("build", data, err, time.Since(start))
+					if writeErr := writeSummary(summaryFile, summary); writeErr != nil {
+						err = errors.Join(err, writeErr)
+					}
+				}()
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return orchestrator.Classify(orchestrator.ErrProvider, err)
+			}
+			defer closeClient()
+
+			configProvider := newConfProvider(log, provider)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if teardown {
+				defer func() {
+					wreckErr := orchestrator.Wreck(context.Background(), data, provider, configProvider)
+					err = errors.Join(err, orchestrator.Classify(orchestrator.ErrTeardown, wreckErr))
+				}()
+			}
+			buildCtx, cancel := ctx, context.CancelFunc(func() {})
+			if timeout != 0 {
+				buildCtx, cancel = context.WithTimeout(ctx, timeout)
+			}
+			defer cancel()
+			plan, err := orchestrator.NewPlan(buildCtx, data, provider)
+			if err != nil {
+				return err
+			}
+			// confirmation is requested interactively, while pipelines cannot answer and have to approve
+			// plans recreating or removing deployed objects up front, so that they are not blocked
+			if !autoApprove && !dryRun && !plan.Empty() {
+				switch {
+				case term.IsTerminal(int(os.Stdin.Fd())):
+					plan.Print(args.Out)
+					if !confirm(os.Stdin, args.Out, "Apply these changes?") {
+						log.Skipped("build cancelled, no changes applied")
+						return nil
+					}
+				case plan.Destructive():
+					plan.Print(args.Out)
+					return cli.Usagef("the plan recreates or removes deployed objects, which requires --auto-approve when not run in a terminal")
+				}
+			}
+			if err := orchestrator.Apply(buildCtx, data, plan, provider, configProvider); err != nil {
+				return err
+			}
+			if wait {
+				if err := orchestrator.Wait(buildCtx, data, provider); err != nil {
+					return err
+				}
+				log.Success("all nodes are ready")
+			}
+			if !teardown {
+				return nil
+			}
+			if len(args.Command) == 0 {
+				log.Success("topology is up, interrupt to wreck it")
+				<-ctx.Done()
+				return nil
+			}
+			cmd := exec.CommandContext(ctx, args.Command[0], args.Command[1:]...)
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+			return orchestrator.Classify(orchestrator.ErrCommand, cmd.Run())
+		},
+	}
+}
+
+// confirm asks a yes/no question and reports whether it was answered affirmatively.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// writeSummary stores the outcome of a command in JSON format.
+func writeSummary(path string, summary orchestrator.Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// wreckCommand deletes the topology or, with --orphans, all leftover objects of golab labs.
+func wreckCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo    topologyFlags
+		orphans bool
+		lab     string
+	)
+	return &cli.Command{
+		Name:     "wreck",
+		Synopsis: "[TOPOLOGY...] | --orphans [--lab NAME]",
+		Summary:  "Delete the topology or leftover Docker objects of labs regardless of their topology files.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.BoolVar(&orphans, "orphans", false, "remove all containers and networks labeled by golab")
+			flags.StringVar(&lab, "lab", "", "with --orphans, remove objects of the named lab only")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			if lab != "" && !orphans {
+				return cli.Usagef("--lab can only be used with --orphans")
+			}
+			if orphans {
+				if len(topo.paths) != 0 || len(args.Positional) != 0 || len(args.Command) != 0 {
+					return cli.Usagef("--orphans does not accept topology files")
+				}
+				provider, closeClient, err := newProvider(log, nil)
+				if err != nil {
+					return err
+				}
+				defer closeClient()
+
+				return orchestrator.Classify(orchestrator.ErrProvider, provider.RemoveOrphans(context.Background(), lab))
+			}
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			return orchestrator.Wreck(context.Background(), data, provider, newConfProvider(log, provider))
+		},
+	}
+}
+
+// planCommand prints the changes build would make to bring the deployed lab in line with the topology.
+func planCommand(log *logger.Logger) *cli.Command {
+	var topo topologyFlags
+	return &cli.Command{
+		Name:         "plan",
+		Synopsis:     "[TOPOLOGY...]",
+		Summary:      "Show links and nodes build would create, update or delete.",
+		Flags:        topo.register,
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			plan, err := orchestrator.NewPlan(context.Background(), data, provider)
+			if err != nil {
+				return err
+			}
+			plan.Print(args.Out)
+			return nil
+		},
+	}
+}
+
+// pauseCommand freezes all containers of the topology.
+func pauseCommand(log *logger.Logger) *cli.Command {
+	return topologyCommand(log, "pause", "Freeze all nodes to free CPU without losing their state.", orchestrator.Pause)
+}
+
+// resumeCommand unfreezes all containers of the topology.
+func resumeCommand(log *logger.Logger) *cli.Command {
+	return topologyCommand(log, "resume", "Resume all nodes frozen with pause.", orchestrator.Resume)
+}
+
+// stopCommand powers off topology nodes without removing their containers.
+func stopCommand(log *logger.Logger) *cli.Command {
+	return nodesCommand(log, "stop", "Stop the provided nodes, or all nodes, keeping their containers.", orchestrator.Stop)
+}
+
+// startCommand powers topology nodes stopped earlier back on.
+func startCommand(log *logger.Logger) *cli.Command {
+	return nodesCommand(log, "start", "Start the provided nodes, or all nodes, stopped with stop.", orchestrator.Start)
+}
+
+// nodesCommand runs an operation applied to the provided nodes, or to all nodes if none are provided,
+// with the selected provider.
+func nodesCommand(log *logger.Logger, name, summary string, run func(context.Context, []byte, orchestrator.VirtProvider, []string) error) *cli.Command {
+	var topo topologyFlags
+	return &cli.Command{
+		Name:         name,
+		Synopsis:     "[-f TOPOLOGY] [NODE...]",
+		Summary:      summary,
+		Flags:        topo.register,
+		Complete:     topo.completeNodes,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			if len(args.Command) != 0 {
+				return cli.Usagef("unexpected arguments %v", args.Command)
+			}
+			data, err := readTopologyFiles(log, topo.paths, topo.vars)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			return run(context.Background(), data, provider, args.Positional)
+		},
+	}
+}
+
+// topologyCommand runs an operation applied to the whole topology with the selected provider.
+func topologyCommand(log *logger.Logger, name, summary string, run func(context.Context, []byte, orchestrator.VirtProvider) error) *cli.Command {
+	var topo topologyFlags
+	return &cli.Command{
+		Name:         name,
+		Synopsis:     "[TOPOLOGY...]",
+		Summary:      summary,
+		Flags:        topo.register,
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			return run(context.Background(), data, provider)
+		},
+	}
+}
+
+// inspectCommand prints the expanded topology in JSON format.
+func inspectCommand() *cli.Command {
+	var topo topologyFlags
+	return &cli.Command{
+		Name:         "inspect",
+		Synopsis:     "[TOPOLOGY...]",
+		Summary:      "Print the topology with all computed fields in JSON format.",
+		Flags:        topo.register,
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			data, err := readTopologyArgs(logger.New(io.Discard, os.Stderr), &topo, args)
+			if err != nil {
+				return err
+			}
+			return orchestrator.Inspect(data, args.Out)
+		},
+	}
+}
+
+// exportCommand writes a Compose file deploying the topology instead of deploying it.
+func exportCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo   topologyFlags
+		output string
+	)
+	return &cli.Command{
+		Name:     "export",
+		Synopsis: "[TOPOLOGY...]",
+		Summary:  "Write a docker-compose.yml deploying the topology instead of deploying it.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.StringVar(&output, "o", "", "write the compose file to the path instead of stdout")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) (err error) {
+			log := log
+			// the compose file written to stdout is not mixed with logs
+			if output == "" {
+				log = logger.New(io.Discard, os.Stderr)
+			}
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			out := args.Out
+			if output != "" {
+				file, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					err = errors.Join(err, file.Close())
+				}()
+				out = file
+			}
+			return orchestrator.Export(data, configen.New(log), docker.Compose, out)
+		},
+	}
+}
+
+// execCommand executes a command on a single node or a group of topology nodes.
+func execCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo   topologyFlags
+		all    bool
+		kind   string
+		labels varMap
+	)
+	return &cli.Command{
+		Name:     "exec",
+		Synopsis: "[-f TOPOLOGY] (NODE | --all | [--kind KIND] [--label KEY=VALUE...]) -- COMMAND [ARG...]",
+		Summary:  "Run a command on a node, on all nodes or on nodes of the provided kind and labels.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.BoolVar(&all, "all", false, "run the command on all nodes")
+			flags.StringVar(&kind, "kind", "", "run the command on nodes of the provided kind only")
+			flags.Var(&labels, "label", "run the command on nodes carrying the label KEY=VALUE only, can be repeated")
+		},
+		Complete:     topo.completeNodes,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			nodes := args.Positional
+			if len(nodes) > 1 {
+				return cli.Usagef("unexpected arguments %v", nodes[1:])
+			}
+			targets := len(nodes)
+			if all {
+				targets++
+			}
+			if kind != "" || len(labels) != 0 {
+				targets++
+			}
+			if targets != 1 {
+				return cli.Usagef("exactly one of NODE, --all and --kind or --label has to be specified")
+			}
+			if len(args.Command) == 0 {
+				return cli.Usagef("no command to execute")
+			}
+			data, err := readTopologyFiles(log, topo.paths, topo.vars)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			if len(nodes) == 1 {
+				return orchestrator.ExecNode(context.Background(), data, provider, nodes[0], args.Command, args.Out, os.Stderr)
+			}
+			return orchestrator.Exec(context.Background(), data, provider, kind, labels, args.Command, args.Out)
+		},
+	}
+}
+
+// logsCommand prints logs of a topology node, streaming new output until interrupted if requested.
+func logsCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo   topologyFlags
+		follow bool
+		tail   int
+	)
+	return &cli.Command{
+		Name:     "logs",
+		Synopsis: "[-f TOPOLOGY] NODE [--follow] [--tail N]",
+		Summary:  "Print logs of a node.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.BoolVar(&follow, "follow", false, "stream new log output")
+			flags.IntVar(&tail, "tail", -1, "number of lines to show from the end of the logs (all by default)")
+		},
+		Complete:     topo.completeNodes,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			if len(args.Positional) != 1 || len(args.Command) != 0 {
+				return cli.Usagef("exactly one node has to be specified")
+			}
+			data, err := readTopologyFiles(log, topo.paths, topo.vars)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			return orchestrator.Logs(ctx, data, provider, args.Positional[0], follow, tail, args.Out, os.Stderr)
+		},
+	}
+}
+
+// shellCommand opens an interactive session on a topology node.
+func shellCommand(log *logger.Logger) *cli.Command {
+	var topo topologyFlags
+	return &cli.Command{
+		Name:         "shell",
+		Synopsis:     "[-f TOPOLOGY] NODE",
+		Summary:      "Open an interactive session on a node using its vendor-specific shell.",
+		Flags:        topo.register,
+		Complete:     topo.completeNodes,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			if len(args.Positional) != 1 || len(args.Command) != 0 {
+				return cli.Usagef("exactly one node has to be specified")
+			}
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return cli.Usagef("shell requires an interactive terminal")
+			}
+			data, err := readTopologyFiles(log, topo.paths, topo.vars)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			tty, restore, err := rawTerminal()
+			if err != nil {
+				return err
+			}
+			defer restore()
+			return orchestrator.Shell(context.Background(), data, provider, args.Positional[0], tty)
+		},
+	}
+}
+
+// tuiCommand renders an interactive dashboard of the running topology in the terminal.
+func tuiCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo     topologyFlags
+		interval time.Duration
+	)
+	return &cli.Command{
+		Name:     "tui",
+		Synopsis: "[TOPOLOGY...] [--interval DURATION]",
+		Summary:  "Show a live dashboard of all nodes with key bindings to stop, start and open shells on them.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.DurationVar(&interval, "interval", 2*time.Second, "refresh interval")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return cli.Usagef("tui requires an interactive terminal")
+			}
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			// the dashboard overwrites the screen, so provider messages are only worth showing on errors
+			log.SetLevel(logger.LevelError)
+			tty, restore, err := rawTerminal()
+			if err != nil {
+				return err
+			}
+			defer restore()
+			return orchestrator.Dashboard(context.Background(), data, provider, tty, interval)
+		},
+	}
+}
+
+// rawTerminal switches the terminal attached to stdin into raw mode and returns it
+// along with a function restoring the previous mode.
+func rawTerminal() (topology.TTY, func(), error) {
+	fd := int(os.Stdin.Fd())
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return topology.TTY{}, nil, err
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return topology.TTY{}, nil, err
+	}
+	tty := topology.TTY{In: os.Stdin, Out: os.Stdout, Height: uint(height), Width: uint(width)}
+	return tty, func() { term.Restore(fd, state) }, nil
+}
+
+// saveCommand copies running configuration of topology nodes into the per-node config directories.
+func saveCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo topologyFlags
+		dir  string
+	)
+	return &cli.Command{
+		Name:     "save",
+		Synopsis: "[TOPOLOGY...] [--dir DIR]",
+		Summary:  "Save running configuration of all nodes into per-node directories.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.StringVar(&dir, "dir", os.Getenv("PWD"), "directory to save the per-node configuration into")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			saved, err := orchestrator.Save(context.Background(), data, provider, dir)
+			for _, name := range saved {
+				log.With(name).Success("saved configuration of node " + name)
+			}
+			return err
+		},
+	}
+}
+
+// snapshotCommand commits all topology nodes to images the topology can be built from later on.
+func snapshotCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo topologyFlags
+		tag  string
+	)
+	return &cli.Command{
+		Name:     "snapshot",
+		Synopsis: "[TOPOLOGY...] [--tag TAG]",
+		Summary:  "Commit all nodes to images to restore the topology from with build --snapshot.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.StringVar(&tag, "tag", time.Now().UTC().Format("20060102-150405"), "tag of the snapshot images")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			if _, err := orchestrator.Snapshot(context.Background(), data, provider, tag); err != nil {
+				return err
+			}
+			log.Success(fmt.Sprintf("took snapshot %s, restore it with golab build --snapshot %s", tag, tag))
+			return nil
+		},
+	}
+}
+
+// topCommand prints resource usage of topology nodes once or periodically until interrupted.
+func topCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo       topologyFlags
+		interval   time.Duration
+		interfaces bool
+	)
+	return &cli.Command{
+		Name:     "top",
+		Synopsis: "[TOPOLOGY...] [--interval DURATION] [--interfaces]",
+		Summary:  "Print resource usage of all nodes.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.DurationVar(&interval, "interval", 0, "refresh the view with the provided interval")
+			flags.BoolVar(&interfaces, "interfaces", false, "print traffic counters of every node interface instead")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			top := orchestrator.Top
+			if interfaces {
+				top = orchestrator.TopInterfaces
+			}
+			if interval == 0 {
+				return top(ctx, data, provider, args.Out)
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				var buf bytes.Buffer
+				if err := top(ctx, data, provider, &buf); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				// clear the screen before redrawing the view
+				fmt.Fprint(args.Out, "\x1b[H\x1b[2J", buf.String())
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+}
+
+// telemetryCommand collects telemetry from topology nodes into the telemetry directory until interrupted.
+func telemetryCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo     topologyFlags
+		interval time.Duration
+	)
+	return &cli.Command{
+		Name:     "telemetry",
+		Synopsis: "[TOPOLOGY...] [--interval DURATION]",
+		Summary:  "Collect telemetry from all nodes into the telemetry directory until interrupted.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.DurationVar(&interval, "interval", 10*time.Second, "polling interval")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			data, err := readTopologyArgs(log, &topo, args)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			dir := filepath.Join(os.Getenv("PWD"), "telemetry")
+			log.With(dir).Success("collecting telemetry into " + dir)
+			return orchestrator.Telemetry(ctx, data, provider, dir, interval, log)
+		},
+	}
+}
+
+// versionCommand prints build metadata of golab along with the negotiated Docker API version.
+func versionCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "version",
+		Summary: "Print the golab version, commit and the negotiated Docker API version.",
+		Run: func(args cli.Args) error {
+			if len(args.Positional) != 0 || len(args.Command) != 0 {
+				return cli.Usagef("unexpected arguments %v", append(args.Positional, args.Command...))
+			}
+			fmt.Fprint(args.Out, version.Get())
+			fmt.Fprintln(args.Out, "docker API:", dockerAPIVersion())
+			return nil
+		},
+	}
+}
+
+// dockerAPIVersion negotiates the API version with the Docker daemon, reporting it as unavailable on failure.
+func dockerAPIVersion() string {
+	opts, err := engine.ClientOpts()
+	if err != nil {
+		return fmt.Sprintf("unavailable (%v)", err)
+	}
+	dockerClient, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return fmt.Sprintf("unavailable (%v)", err)
+	}
+	defer dockerClient.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server, err := dockerClient.ServerVersion(ctx)
+	if err != nil {
+		return fmt.Sprintf("unavailable (%v)", err)
+	}
+	dockerClient.NegotiateAPIVersionPing(types.Ping{APIVersion: server.APIVersion})
+	return fmt.Sprintf("%s (server %s)", dockerClient.ClientVersion(), server.Version)
+}
+
+// readTopologyArgs reads topology files of subcommands accepting them as positional arguments.
+func readTopologyArgs(log *logger.Logger, topo *topologyFlags, args cli.Args) ([]byte, error) {
+	if len(args.Command) != 0 {
+		return nil, cli.Usagef("unexpected arguments %v", args.Command)
+	}
+	paths, err := topo.withPositional(args.Positional)
+	if err != nil {
+		return nil, err
+	}
+	return readTopologyFiles(log, paths, topo.vars)
+}
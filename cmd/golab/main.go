@@ -2,62 +2,361 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/docker/docker/client"
+	"github.com/elupevg/golab/cli"
 	"github.com/elupevg/golab/configen"
+	"github.com/elupevg/golab/containerd"
 	"github.com/elupevg/golab/docker"
+	"github.com/elupevg/golab/dryrun"
+	"github.com/elupevg/golab/kubernetes"
+	"github.com/elupevg/golab/libvirt"
 	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/lxd"
+	"github.com/elupevg/golab/multihost"
 	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/plugin"
+	"github.com/elupevg/golab/podman"
+	"github.com/elupevg/golab/topology"
 )
 
-const usage = "Usage:\n  golab build\n  golab wreck"
+const footer = `Topology files are provided as arguments or with repeated -f/--topology flags
+and deep-merged in the provided order. Otherwise, the only *.yml or *.yaml file
+in the current directory is used. Run "golab COMMAND -h" for command details.`
+
+// engine is the Docker engine selected with global flags.
+var engine docker.Engine
+
+// providerName selects the provider labs are deployed to with global flags: docker, podman, containerd, kubernetes,
+// lxd or a plugin.
+var providerName = "docker"
+
+// providerNamePattern matches names of providers, which plugin binaries are named after.
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// dryRun replaces the selected provider with one logging the changes it would make, selected with global flags.
+var dryRun bool
+
+// drift is the policy for existing Docker objects not matching the topology, selected with global flags.
+var drift = docker.DriftWarn
 
 func main() {
 	log := logger.New(os.Stdout, os.Stderr)
-	if len(os.Args) != 2 {
-		fmt.Println(usage)
-		return
-	}
-	var cmd orchestrator.Command
-	switch os.Args[1] {
-	case "build":
-		cmd = orchestrator.Build
-	case "wreck":
-		cmd = orchestrator.Wreck
+	app := &cli.App{
+		Name:   "golab",
+		Footer: footer,
+		Flags: func(flags *flag.FlagSet) {
+			flags.BoolFunc("json", "log events as JSON lines for machine consumption", func(string) error {
+				log.SetJSON(true)
+				return nil
+			})
+			flags.BoolFunc("verbose", "log debug messages, e.g. options submitted to the Docker API", func(string) error {
+				log.SetLevel(logger.LevelDebug)
+				return nil
+			})
+			flags.BoolFunc("quiet", "log warnings and errors only", func(string) error {
+				log.SetLevel(logger.LevelWarn)
+				return nil
+			})
+			flags.StringVar(&engine.Host, "host", "", "address of the Docker engine, e.g. ssh://user@server (default $DOCKER_HOST)")
+			flags.StringVar(&engine.Context, "context", "", "name of the Docker CLI context to use (default $DOCKER_CONTEXT)")
+			flags.Func("provider", "container engine to deploy labs to: docker, podman, containerd, kubernetes, lxd or a golab-provider-NAME plugin in PATH (default docker)", func(value string) error {
+				if !providerNamePattern.MatchString(value) {
+					return fmt.Errorf("invalid provider %q, supported: docker/podman/containerd/kubernetes/lxd or the name of a plugin", value)
+				}
+				providerName = value
+				return nil
+			})
+			flags.BoolVar(&dryRun, "dry-run", false, "log the changes commands would make to labs without making them")
+			flags.Func("on-drift", "handle existing Docker objects not matching the topology: warn, error or recreate (default warn)", func(value string) (err error) {
+				drift, err = docker.ParseDriftPolicy(value)
+				return err
+			})
+		},
+		Commands: []*cli.Command{
+			initCommand(log),
+			planCommand(log),
+			buildCommand(log),
+			wreckCommand(log),
+			watchCommand(log),
+			pauseCommand(log),
+			resumeCommand(log),
+			stopCommand(log),
+			startCommand(log),
+			inspectCommand(),
+			exportCommand(log),
+			execCommand(log),
+			logsCommand(log),
+			shellCommand(log),
+			tuiCommand(log),
+			saveCommand(log),
+			snapshotCommand(log),
+			topCommand(log),
+			telemetryCommand(log),
+			versionCommand(),
+		},
+		Out: os.Stdout,
+	}
+	if err := app.Run(os.Args[1:]); err != nil {
+		if errors.Is(err, cli.ErrUsage) {
+			err = orchestrator.Classify(orchestrator.ErrUsage, err)
+		}
+		log.Errored(err)
+		os.Exit(orchestrator.ExitCode(err))
+	}
+}
+
+// labProvider is a provider supporting all commands, which every provider selectable with global flags is.
+type labProvider interface {
+	orchestrator.PlanProvider
+	orchestrator.DashboardProvider
+	orchestrator.SnapshotProvider
+	RemoveOrphans(ctx context.Context, lab string) error
+}
+
+// newProvider connects to the daemon of the selected provider and returns the provider with a function
+// closing the connection. Podman is driven by the Docker provider through its Docker-compatible API,
+// rejecting links relying on options of Docker networks which Podman does not implement, while
+// containerd is driven with ctr and CNI plugins run on this host, Kubernetes clusters with kubectl and LXD
+// through its REST API. Nodes with qcow2 images are booted as libvirt VMs on the bridges of the links of
+// the docker, podman and containerd providers. Other providers are served by plugin binaries started for
+// the command. Labs whose topology declares hosts are spread over a Docker provider per host, connected
+// to the engine of the host or to the selected one.
+func newProvider(log *logger.Logger, data []byte) (labProvider, func() error, error) {
+	if dryRun {
+		return dryrun.New(log), func() error { return nil }, nil
+	}
+	var hosts map[string]*topology.Host
+	if data != nil {
+		var err error
+		if hosts, err = topology.Hosts(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	if providerName != "docker" && providerName != "podman" && len(hosts) != 0 {
+		return nil, nil, errors.New("labs spread over several hosts are supported by the docker provider only")
+	}
+	switch providerName {
+	case "docker", "podman":
+	case "containerd":
+		containerdProvider := containerd.New(containerd.HostRunner{}, containerd.DefaultStateDir, containerd.CNIPath(), log)
+		return withVMs(containerdProvider, log), func() error { return nil }, nil
+	case "kubernetes":
+		return kubernetes.New(kubernetes.HostRunner{}, kubernetes.DefaultNamespace, log), func() error { return nil }, nil
+	case "lxd":
+		lxdProvider := lxd.New(lxd.Socket(), log)
+		return lxdProvider, lxdProvider.Close, nil
 	default:
-		log.Errored(fmt.Errorf("unknown command %q", os.Args[1]))
-		os.Exit(1)
+		path, err := plugin.Lookup(providerName)
+		if err != nil {
+			return nil, nil, err
+		}
+		pluginProvider, err := plugin.Open(context.Background(), path, os.Stderr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pluginProvider, pluginProvider.Close, nil
+	}
+	if providerName == "podman" && engine.Host == "" && engine.Context == "" {
+		engine.Host = podman.Host()
+	}
+	if len(hosts) == 0 {
+		dockerProvider, closeClient, err := newDockerProvider(log, engine)
+		if err != nil {
+			return nil, nil, err
+		}
+		if providerName == "podman" {
+			return withVMs(podman.New(dockerProvider), log), closeClient, nil
+		}
+		return withVMs(dockerProvider, log), closeClient, nil
+	}
+	providers := make(map[string]multihost.HostProvider, len(hosts))
+	var closers []func() error
+	closeAll := func() error {
+		var errs []error
+		for _, closeClient := range closers {
+			errs = append(errs, closeClient())
+		}
+		return errors.Join(errs...)
 	}
-	yamlFiles, err := filepath.Glob("*.yml")
+	for name, host := range hosts {
+		hostEngine := engine
+		if host != nil && host.Engine != "" {
+			hostEngine = docker.Engine{Host: host.Engine}
+		}
+		provider, closeClient, err := newDockerProvider(log, hostEngine)
+		if err != nil {
+			return nil, nil, errors.Join(fmt.Errorf("host %s: %w", name, err), closeAll())
+		}
+		providers[name] = provider
+		closers = append(closers, closeClient)
+	}
+	return multihost.New(hosts, providers), closeAll, nil
+}
+
+// newDockerProvider connects to the Docker engine and returns the provider with a function closing the connection.
+func newDockerProvider(log *logger.Logger, engine docker.Engine) (*docker.DockerProvider, func() error, error) {
+	opts, err := engine.ClientOpts()
 	if err != nil {
-		log.Errored(err)
-		os.Exit(1)
+		return nil, nil, err
 	}
-	if len(yamlFiles) != 1 {
-		log.Errored(fmt.Errorf("expected 1 topology YAML file but found %d", len(yamlFiles)))
-		os.Exit(1)
+	dockerClient, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	dockerProvider := docker.New(dockerClient, log)
+	dockerProvider.SetDriftPolicy(drift)
+	return dockerProvider, dockerClient.Close, nil
+}
+
+// newConfProvider returns the provider generating node configuration, which the dry-run provider
+// stands in for, so that dry runs leave configuration files alone.
+func newConfProvider(log *logger.Logger, provider labProvider) orchestrator.ConfProvider {
+	if dryRunProvider, ok := provider.(*dryrun.DryRunProvider); ok {
+		return dryRunProvider
 	}
-	log.Success(fmt.Sprintf("found topology file %s", yamlFiles[0]))
-	data, err := os.ReadFile(yamlFiles[0])
+	return configen.New(log)
+}
+
+// withVMs adds libvirt VMs to the container provider.
+func withVMs(containers libvirt.ContainerProvider, log *logger.Logger) labProvider {
+	return libvirt.New(containers, libvirt.HostRunner{}, libvirt.DefaultStateDir, log)
+}
+
+// pathList is a flag collecting values of its repeated occurrences.
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// varMap is a flag collecting KEY=VALUE pairs of its repeated occurrences.
+type varMap map[string]string
+
+func (v *varMap) String() string {
+	pairs := make([]string, 0, len(*v))
+	for key, value := range *v {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v *varMap) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", value)
+	}
+	if *v == nil {
+		*v = make(varMap)
+	}
+	(*v)[key] = val
+	return nil
+}
+
+// topologyFlags selects topology files with the -f/--topology flags and overrides their template
+// variables with the --var flags.
+type topologyFlags struct {
+	paths pathList
+	vars  varMap
+}
+
+func (t *topologyFlags) register(flags *flag.FlagSet) {
+	flags.Var(&t.paths, "f", "path to a topology YAML, JSON or TOML file, can be repeated (shorthand)")
+	flags.Var(&t.paths, "topology", "path to a topology YAML, JSON or TOML file, can be repeated")
+	flags.Var(&t.vars, "var", "override a template variable of the topology as KEY=VALUE, can be repeated")
+}
+
+// withPositional combines the flags with topology files provided as positional arguments.
+func (t *topologyFlags) withPositional(positional []string) ([]string, error) {
+	if len(t.paths) != 0 && len(positional) != 0 {
+		return nil, cli.Usagef("topology files are provided both as arguments and flags")
+	}
+	return append(t.paths, positional...), nil
+}
+
+// completeFlags completes values of the topology file flags.
+func (t *topologyFlags) completeFlags() map[string]func() []string {
+	return map[string]func() []string{"f": completeTopologyFiles, "topology": completeTopologyFiles}
+}
+
+// completeNodes completes names of nodes in the selected topology.
+func (t *topologyFlags) completeNodes() []string {
+	data, err := readTopologyFiles(logger.New(io.Discard, io.Discard), t.paths, t.vars)
 	if err != nil {
-		log.Errored(err)
-		os.Exit(1)
+		return nil
 	}
-	dockerClient, err := client.NewClientWithOpts(client.WithAPIVersionNegotiation())
+	names, _ := topology.NodeNames(data)
+	return names
+}
+
+func completeTopologyFiles() []string {
+	yamlFiles, _ := findTopologyFiles()
+	return yamlFiles
+}
+
+// findTopologyFiles lists topology YAML files in the current directory.
+func findTopologyFiles() ([]string, error) {
+	var yamlFiles []string
+	for _, pattern := range []string{"*.yml", "*.yaml"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		yamlFiles = append(yamlFiles, matches...)
+	}
+	return yamlFiles, nil
+}
+
+// readTopologyFiles reads the topology YAML files at the provided paths, along with the files
+// they include, and joins them into a single stream of YAML documents, which are merged in order.
+// Every file is rendered as a template with the vars overriding the ones of the file.
+// Without paths, the only YAML file in the current directory is read.
+func readTopologyFiles(log *logger.Logger, paths []string, vars map[string]string) ([]byte, error) {
+	paths, err := resolveTopologyFiles(paths)
 	if err != nil {
-		log.Errored(err)
-		os.Exit(1)
+		return nil, err
 	}
-	defer dockerClient.Close()
+	docs := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		data, err := topology.ReadFile(path, vars)
+		if errors.Is(err, topology.ErrRender) {
+			return nil, orchestrator.Classify(orchestrator.ErrInvalidTopology, err)
+		}
+		if err != nil {
+			return nil, cli.Usagef("%w", err)
+		}
+		docs = append(docs, data)
+		log.With(path).Success(fmt.Sprintf("found topology file %s", path))
+	}
+	return bytes.Join(docs, []byte("\n---\n")), nil
+}
 
-	dockerProvider := docker.New(dockerClient, log)
-	configProvider := configen.New(log)
-	if err := cmd(context.Background(), data, dockerProvider, configProvider); err != nil {
-		log.Errored(err)
-		os.Exit(1)
+// resolveTopologyFiles defaults to the only YAML file in the current directory if no paths are provided.
+func resolveTopologyFiles(paths []string) ([]string, error) {
+	if len(paths) != 0 {
+		return paths, nil
+	}
+	yamlFiles, err := findTopologyFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(yamlFiles) != 1 {
+		return nil, cli.Usagef("expected 1 topology YAML file but found %d", len(yamlFiles))
 	}
+	return yamlFiles, nil
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/elupevg/golab/cli"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchCommand builds the topology and reconciles it with every change of the topology files until interrupted.
+func watchCommand(log *logger.Logger) *cli.Command {
+	var (
+		topo     topologyFlags
+		debounce time.Duration
+	)
+	return &cli.Command{
+		Name:     "watch",
+		Synopsis: "[TOPOLOGY...] [--debounce DURATION]",
+		Summary:  "Build the topology and update it whenever the topology files change, until interrupted.",
+		Flags: func(flags *flag.FlagSet) {
+			topo.register(flags)
+			flags.DurationVar(&debounce, "debounce", 300*time.Millisecond, "wait for changes to settle before reconciling")
+		},
+		Complete:     completeTopologyFiles,
+		CompleteFlag: topo.completeFlags(),
+		Run: func(args cli.Args) error {
+			if len(args.Command) != 0 {
+				return cli.Usagef("unexpected arguments %v", args.Command)
+			}
+			paths, err := topo.withPositional(args.Positional)
+			if err != nil {
+				return err
+			}
+			paths, err = resolveTopologyFiles(paths)
+			if err != nil {
+				return err
+			}
+			// the hosts of a lab are connected to once, so changes to them require a restart
+			data, err := readTopologyFiles(log, paths, topo.vars)
+			if err != nil {
+				return err
+			}
+			provider, closeClient, err := newProvider(log, data)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			return watch(ctx, log, paths, topo.vars, debounce, func(oldData, newData []byte) error {
+				return orchestrator.Reconcile(ctx, oldData, newData, provider, newConfProvider(log, provider))
+			})
+		},
+	}
+}
+
+// watch calls reconcile with the previously applied and the current contents of the topology files
+// on start and whenever they change. Failures are logged, so that they can be fixed by further edits.
+func watch(ctx context.Context, log *logger.Logger, paths []string, vars map[string]string, debounce time.Duration, reconcile func(oldData, newData []byte) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// editors often replace files instead of writing them, so parent directories are watched
+	watched := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		watched[absPath] = true
+		if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+			return err
+		}
+	}
+	var applied []byte
+	apply := func() {
+		data, err := readTopologyFiles(log, paths, vars)
+		if err != nil {
+			log.Errored(err)
+			return
+		}
+		if applied != nil && bytes.Equal(data, applied) {
+			return
+		}
+		if err := reconcile(applied, data); err != nil {
+			log.Errored(err)
+			return
+		}
+		applied = data
+		log.Success("topology is up to date, watching for changes")
+	}
+	apply()
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if watched[filepath.Clean(event.Name)] && !event.Has(fsnotify.Chmod) {
+				timer.Reset(debounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-timer.C:
+			apply()
+		}
+	}
+}
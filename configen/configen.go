@@ -2,13 +2,23 @@
 package configen
 
 import (
+	"bytes"
+	"context"
 	"embed"
 	"errors"
-	"html/template"
+	"fmt"
+	"maps"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/netconf"
 	"github.com/elupevg/golab/topology"
 	"github.com/elupevg/golab/vendors"
 )
@@ -16,6 +26,15 @@ import (
 //go:embed templates
 var configTemplates embed.FS
 
+// defaultTemplateDir holds templates overriding the embedded ones unless the topology names another directory.
+const defaultTemplateDir = "templates"
+
+// Nodes may take a while to boot before they start accepting configuration.
+const (
+	pushTimeout       = 2 * time.Minute
+	pushRetryInterval = 2 * time.Second
+)
+
 // ConfigenProvider stores cached logger.
 type ConfigenProvider struct {
 	log *logger.Logger
@@ -34,37 +53,131 @@ func (cp *ConfigenProvider) GenerateAndDump(topo *topology.Topology, rootDir str
 		err := os.Mkdir(nodeDir, 0o750)
 		if err != nil {
 			if errors.Is(err, os.ErrExist) {
-				cp.log.Skipped("already created configuration for node " + node.Name)
+				cp.log.With(node.Name).Skipped("already created configuration for node " + node.Name)
 				continue
 			}
 			return err
 		}
 		for _, path := range vendors.GetConfig(node.Vendor).ConfigFiles {
 			_, fileName := filepath.Split(path)
-			// prepare a template
-			tmplData, err := configTemplates.ReadFile(filepath.Join("templates", string(node.Vendor), fileName+".tmpl"))
+			config, err := render(topo, node, fileName)
 			if err != nil {
 				return err
 			}
-			tmpl, err := template.New(fileName).Parse(string(tmplData))
-			if err != nil {
-				return err
-			}
-			// render config and dump it into a file
-			f, err := os.Create(filepath.Join(nodeDir, fileName))
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-			if err := tmpl.Execute(f, node); err != nil {
+			// dump rendered config into a file
+			if err := os.WriteFile(filepath.Join(nodeDir, fileName), config, 0o644); err != nil {
 				return err
 			}
 		}
-		cp.log.Success("generated configuration for node " + node.Name)
+		cp.log.With(node.Name).Success("generated configuration for node " + node.Name)
+	}
+	return nil
+}
+
+// render renders the vendor-specific template of the provided config file for a node.
+func render(topo *topology.Topology, node *topology.Node, fileName string) ([]byte, error) {
+	tmplData, err := readTemplate(topo.TemplateDir, node.Vendor, fileName)
+	if err != nil {
+		return nil, err
+	}
+	funcs := template.FuncMap{"secret": topo.Secret, "hostAddr": hostAddr, "fields": fields, "shellQuote": shellQuote}
+	tmpl, err := template.New(fileName).Funcs(funcs).Parse(string(tmplData))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readTemplate reads the template of the vendor config file from the template directory, e.g. templates/frr/frr.conf.tmpl,
+// falling back to the embedded one. The default directory is optional, while one named by the topology has to exist.
+func readTemplate(dir string, vendor vendors.Vendor, fileName string) ([]byte, error) {
+	path := filepath.Join(string(vendor), fileName+".tmpl")
+	if dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("template directory: %w", err)
+		}
+	} else {
+		dir = defaultTemplateDir
+	}
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if !errors.Is(err, os.ErrNotExist) {
+		return data, err
+	}
+	return configTemplates.ReadFile(filepath.Join("templates", path))
+}
+
+// hostAddr strips the prefix length from an address in CIDR notation.
+func hostAddr(cidr string) string {
+	addr, _, _ := strings.Cut(cidr, "/")
+	return addr
+}
+
+// fields normalizes whitespace between the values of a multi-value sysctl, e.g. ip_local_port_range,
+// to single spaces, so that it compares equal to the tab-separated values sysctl prints.
+func fields(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// shellQuote quotes the string as a single word of a shell script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Push renders configs for all nodes in the topology and delivers them to the booted nodes.
+func (cp *ConfigenProvider) Push(ctx context.Context, topo *topology.Topology) error {
+	password, err := topo.Secret(topo.Push.PasswordSecret)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		node := topo.Nodes[name]
+		pushTemplate := vendors.GetConfig(node.Vendor).PushTemplate
+		if pushTemplate == "" {
+			return fmt.Errorf("vendor of node %s does not support configuration push", node.Name)
+		}
+		config, err := render(topo, node, pushTemplate)
+		if err != nil {
+			return err
+		}
+		host, _, _ := strings.Cut(node.Mgmt.IPv4Addr, "/")
+		addr := net.JoinHostPort(host, strconv.Itoa(topo.Push.Port))
+		client, err := dialWithRetry(ctx, addr, topo.Push.Username, password)
+		if err != nil {
+			return fmt.Errorf("failed to connect to node %s: %w", node.Name, err)
+		}
+		err = client.EditConfig(config)
+		if closeErr := client.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to push configuration to node %s: %w", node.Name, err)
+		}
+		cp.log.With(node.Name).Success("pushed configuration to node " + node.Name)
 	}
 	return nil
 }
 
+// dialWithRetry connects to a NETCONF server, waiting for the node to finish booting.
+func dialWithRetry(ctx context.Context, addr, username, password string) (*netconf.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	for {
+		client, err := netconf.Dial(ctx, addr, username, password)
+		if err == nil {
+			return client, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(pushRetryInterval):
+		}
+	}
+}
+
 // Cleanup removes auto-generated configs for all nodes in the topology.
 func (cp *ConfigenProvider) Cleanup(topo *topology.Topology, rootDir string) error {
 	for _, node := range topo.Nodes {
@@ -72,7 +185,7 @@ func (cp *ConfigenProvider) Cleanup(topo *topology.Topology, rootDir string) err
 		_, err := os.Stat(nodeDir)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
-				cp.log.Skipped("already removed configuration for node " + node.Name)
+				cp.log.With(node.Name).Skipped("already removed configuration for node " + node.Name)
 				continue
 			}
 			return err
@@ -80,7 +193,7 @@ func (cp *ConfigenProvider) Cleanup(topo *topology.Topology, rootDir string) err
 		if err := os.RemoveAll(nodeDir); err != nil {
 			return err
 		}
-		cp.log.Success("removed configuration for node " + node.Name)
+		cp.log.With(node.Name).Success("removed configuration for node " + node.Name)
 	}
 	return nil
 }
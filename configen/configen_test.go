@@ -1,11 +1,13 @@
 package configen_test
 
 import (
+	"context"
 	"embed"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/elupevg/golab/configen"
@@ -21,6 +23,7 @@ nodes:
   R1:
     image: "quay.io/frrouting/frr:master"
     protocols: {ospf: true, ospf6: true, bgp: true}
+    asn: 64511
   R2:
     image: "quay.io/frrouting/frr:master"
   R3:
@@ -30,6 +33,7 @@ nodes:
 links:
   - endpoints: [R1, R2]
   - endpoints: [R1, R3]
+    bgp_password: s3cr3t
   - endpoints: [R2, R3]
 `
 
@@ -79,3 +83,590 @@ func TestGenerateAndDump(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateSyslog(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(testYAML + "syslog: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tempDir, "R1", "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "hostname R1\nlog syslog informational\n"
+	if !strings.Contains(string(got), want) {
+		t.Errorf("frr.conf: want %q in\n%s", want, got)
+	}
+	daemons, err := os.ReadFile(filepath.Join(tempDir, "R1", "daemons"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(daemons), "syslogd") {
+		t.Errorf("daemons: want no syslogd in\n%s", daemons)
+	}
+}
+
+func TestPushUnsupportedVendor(t *testing.T) {
+	t.Parallel()
+	data := testYAML + "config_mode: push\npush: {username: admin, password_secret: netconf}\nsecrets: {netconf: admin}\n"
+	topo, err := topology.FromYAML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	wantMsg := "vendor of node R1 does not support configuration push"
+	err = cp.Push(context.Background(), topo)
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestGenerateISISAndLDP(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: core
+ip_mode: ipv4
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {isis: true, ldp: true}
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {isis: true, ldp: true}
+links:
+  - endpoints: [R1, R2]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tempDir, "R1", "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"interface eth0\n ip address 10.1.2.1/24\n ip router isis golab\n isis network point-to-point\nexit\n",
+		"router isis golab\n net 49.0001.1921.6800.0001.00\n is-type level-2-only\n metric-style wide\n log-adjacency-changes\nexit\n",
+		"mpls ldp\n router-id 192.168.0.1\n address-family ipv4\n  discovery transport-address 192.168.0.1\n  interface eth0\n exit-address-family\nexit\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("frr.conf: want %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerateISISLevels(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: levels
+ip_mode: ipv4
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {isis: true}
+    isis: {area: "49.0002", level: level-1-2, interfaces: {eth1: {metric: 100}}}
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {isis: true}
+    isis: {net: "49.0003.0000.0000.0002.00", level: level-1}
+  R3:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {isis: true}
+links:
+  - endpoints: [R1, R2]
+    isis: {metric: 20}
+  - endpoints: [R1, R3]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	for node, wants := range map[string][]string{
+		"R1": {
+			"interface eth0\n ip address 10.1.2.1/24\n ip router isis golab\n isis network point-to-point\n isis metric 20\nexit\n",
+			"interface eth1\n ip address 10.1.3.1/24\n ip router isis golab\n isis network point-to-point\n isis metric 100\nexit\n",
+			"router isis golab\n net 49.0002.1921.6800.0001.00\n is-type level-1-2\n",
+		},
+		"R2": {
+			"router isis golab\n net 49.0003.0000.0000.0002.00\n is-type level-1\n",
+		},
+		"R3": {
+			"interface eth0\n ip address 10.1.3.3/24\n ip router isis golab\n isis network point-to-point\nexit\n",
+			"router isis golab\n net 49.0001.1921.6800.0003.00\n is-type level-2-only\n",
+		},
+	} {
+		got, err := os.ReadFile(filepath.Join(tempDir, node, "frr.conf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(got), want) {
+				t.Errorf("%s frr.conf: want %q in\n%s", node, want, got)
+			}
+		}
+	}
+}
+
+func TestGenerateIPv6Only(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: v6
+ip_mode: ipv6
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf6: true, isis: true, bgp: true}
+    asn: 64511
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf6: true, isis: true, bgp: true}
+    asn: 64512
+links:
+  - endpoints: [R1, R2]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tempDir, "R1", "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"service integrated-vtysh-config\nrouter-id 192.168.0.1\n!\n",
+		"interface lo\n ipv6 address 2001:db8::1/128\n ipv6 ospf6 area 0\n ipv6 ospf6 passive\n ipv6 router isis golab\n isis passive\nexit\n",
+		"interface eth0\n ipv6 address 2001:db8:1:2::1/64\n ipv6 ospf6 area 0\n ipv6 ospf6 network point-to-point\n ipv6 router isis golab\n isis network point-to-point\nexit\n",
+		"router isis golab\n net 49.0001.1921.6800.0001.00\n",
+		"router bgp 64511\n bgp router-id 192.168.0.1\n no bgp ebgp-requires-policy\n no bgp default ipv4-unicast\n neighbor 2001:db8:1:2::2 remote-as 64512\n !\n address-family ipv6 unicast\n  network 2001:db8::1/128\n  neighbor 2001:db8:1:2::2 activate\n exit-address-family\nexit\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("frr.conf: want %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerateLinkLocal(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: unnumbered
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf6: true, bgp: true}
+    asn: 64511
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf6: true, bgp: true}
+    asn: 64512
+links:
+  - endpoints: [R1, R2]
+    ip: link-local
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tempDir, "R1", "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"interface eth0\n ipv6 ospf6 area 0\n ipv6 ospf6 network point-to-point\nexit\n",
+		"router bgp 64511\n bgp router-id 192.168.0.1\n no bgp ebgp-requires-policy\n no bgp default ipv4-unicast\n neighbor eth0 interface remote-as 64512\n",
+		" address-family ipv6 unicast\n  network 2001:db8::1/128\n  neighbor eth0 activate\n exit-address-family\nexit\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("frr.conf: want %q in\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerateLinux(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: edge
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "debian:12"
+    kind: linux
+    gateway: R1
+    sysctls: {net.ipv6.conf.all.forwarding: "0", net.ipv4.ip_local_port_range: "1024   65000"}
+links:
+  - endpoints: [R1, R2]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tempDir, "R2", "setup.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `#!/bin/sh
+# generated by golab for node R2
+[ "$(sysctl -n net.ipv4.ip_forward | tr -s '\t' ' ')" = '1' ] || sysctl -w 'net.ipv4.ip_forward=1'
+[ "$(sysctl -n net.ipv4.ip_local_port_range | tr -s '\t' ' ')" = '1024 65000' ] || sysctl -w 'net.ipv4.ip_local_port_range=1024 65000'
+[ "$(sysctl -n net.ipv6.conf.all.forwarding | tr -s '\t' ' ')" = '0' ] || sysctl -w 'net.ipv6.conf.all.forwarding=0'
+ip -4 addr replace 192.168.0.2/32 dev lo
+ip -6 addr replace 2001:db8::2/128 dev lo
+ip -4 addr replace 10.1.2.2/24 dev eth0
+ip -6 addr replace 2001:db8:1:2::2/64 dev eth0
+ip link set eth0 up
+ip -4 route replace default via 10.1.2.1
+ip -6 route replace default via 2001:db8:1:2::1
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("setup.sh mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateRouteServer(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: ixp
+ip_mode: ipv4
+nodes:
+  R1:
+    image: "pierky/bird:2.15"
+    protocols: {bgp: true}
+    asn: 64500
+    route_server: true
+    rpki: {server: 192.0.2.10}
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {bgp: true}
+    asn: 64511
+  R3:
+    image: "jauderho/gobgp:latest"
+    protocols: {bgp: true}
+    asn: 64512
+    rpki: {server: 192.0.2.10, port: 8282}
+links:
+  - endpoints: [R1, R2, R3]
+    bgp_password: s3cr3t
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		path string
+		want string
+	}{
+		{
+			path: filepath.Join("R1", "bird.conf"),
+			want: `# generated by golab for node R1
+log stderr all;
+router id 192.168.0.1;
+
+protocol device {
+}
+
+protocol kernel {
+  ipv4 { export where source = RTS_BGP; };
+}
+
+protocol kernel {
+  ipv6 { export where source = RTS_BGP; };
+}
+
+roa4 table rpki4;
+roa6 table rpki6;
+
+protocol rpki {
+  roa4 { table rpki4; };
+  roa6 { table rpki6; };
+  remote "192.0.2.10" port 3323;
+}
+
+protocol bgp peer0 {
+  local as 64500;
+  neighbor 10.0.3.2 as 64511;
+  direct;
+  password "s3cr3t";
+  rs client;
+  ipv4 {
+    import where roa_check(rpki4, net, bgp_path.last) != ROA_INVALID;
+    export where source = RTS_BGP;
+  };
+}
+
+protocol bgp peer1 {
+  local as 64500;
+  neighbor 10.0.3.3 as 64512;
+  direct;
+  password "s3cr3t";
+  rs client;
+  ipv4 {
+    import where roa_check(rpki4, net, bgp_path.last) != ROA_INVALID;
+    export where source = RTS_BGP;
+  };
+}
+`,
+		},
+		{
+			path: filepath.Join("R3", "gobgpd.toml"),
+			want: `# generated by golab for node R3
+[global.config]
+  as = 64512
+  router-id = "192.168.0.3"
+[global.apply-policy.config]
+  import-policy-list = ["rpki"]
+  default-import-policy = "accept-route"
+
+[[neighbors]]
+  [neighbors.config]
+    neighbor-address = "10.0.3.1"
+    peer-as = 64500
+    auth-password = "s3cr3t"
+  [[neighbors.afi-safis]]
+    [neighbors.afi-safis.config]
+      afi-safi-name = "ipv4-unicast"
+
+[[neighbors]]
+  [neighbors.config]
+    neighbor-address = "10.0.3.2"
+    peer-as = 64511
+    auth-password = "s3cr3t"
+  [[neighbors.afi-safis]]
+    [neighbors.afi-safis.config]
+      afi-safi-name = "ipv4-unicast"
+
+[[rpki-servers]]
+  [rpki-servers.config]
+    address = "192.0.2.10"
+    port = 8282
+
+[[policy-definitions]]
+  name = "rpki"
+  [[policy-definitions.statements]]
+    name = "reject-invalid"
+    [policy-definitions.statements.conditions.bgp-conditions]
+      rpki-validation-result = "invalid"
+    [policy-definitions.statements.actions]
+      route-disposition = "reject-route"
+`,
+		},
+	}
+	for _, tc := range testCases {
+		got, err := os.ReadFile(filepath.Join(tempDir, tc.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+			t.Errorf("%s mismatch (-want +got):\n%s", tc.path, diff)
+		}
+	}
+}
+
+func TestGenerateTemplateDir(t *testing.T) {
+	t.Parallel()
+	templateDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(templateDir, "frr"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	custom := "hostname {{.Name}}\nlog file /tmp/frr.log\n"
+	if err := os.WriteFile(filepath.Join(templateDir, "frr", "frr.conf.tmpl"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	topo, err := topology.FromYAML([]byte("name: custom\ntemplate_dir: " + templateDir + "\nnodes:\n  R1: {image: \"quay.io/frrouting/frr:master\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempDir := t.TempDir()
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tempDir, "R1", "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("hostname R1\nlog file /tmp/frr.log\n", string(got)); diff != "" {
+		t.Errorf("frr.conf mismatch (-want +got):\n%s", diff)
+	}
+	// templates missing from the directory are embedded ones
+	got, err = os.ReadFile(filepath.Join(tempDir, "R1", "vtysh.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := golden.ReadFile("testdata/R1/vtysh.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("vtysh.conf mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateMissingTemplateDir(t *testing.T) {
+	t.Parallel()
+	templateDir := filepath.Join(t.TempDir(), "missing")
+	topo, err := topology.FromYAML([]byte("name: custom\ntemplate_dir: " + templateDir + "\nnodes:\n  R1: {image: \"quay.io/frrouting/frr:master\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	errMsg := "template directory: stat " + templateDir + ": no such file or directory"
+	if err := cp.GenerateAndDump(topo, t.TempDir()); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestGenerateRouteReflector(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: core
+ip_mode: ipv4
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true, bgp: true}
+    asn: 65000
+    route_reflector: true
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true, bgp: true}
+    asn: 65000
+  R3:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {bgp: true}
+    asn: 65001
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R2, R3]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		node string
+		want string
+	}{
+		{
+			node: "R1",
+			want: `router bgp 65000
+ bgp router-id 192.168.0.1
+ no bgp ebgp-requires-policy
+ no bgp default ipv4-unicast
+ neighbor 192.168.0.2 remote-as 65000
+ neighbor 192.168.0.2 update-source 192.168.0.1
+ !
+ address-family ipv4 unicast
+  network 192.168.0.1/32
+  neighbor 192.168.0.2 activate
+  neighbor 192.168.0.2 route-reflector-client
+ exit-address-family
+exit
+`,
+		},
+		{
+			node: "R2",
+			want: `router bgp 65000
+ bgp router-id 192.168.0.2
+ no bgp ebgp-requires-policy
+ no bgp default ipv4-unicast
+ neighbor 10.2.3.3 remote-as 65001
+ neighbor 192.168.0.1 remote-as 65000
+ neighbor 192.168.0.1 update-source 192.168.0.2
+ !
+ address-family ipv4 unicast
+  network 192.168.0.2/32
+  neighbor 10.2.3.3 activate
+  neighbor 192.168.0.1 activate
+ exit-address-family
+exit
+`,
+		},
+	}
+	for _, tc := range testCases {
+		got, err := os.ReadFile(filepath.Join(tempDir, tc.node, "frr.conf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(got), tc.want) {
+			t.Errorf("%s frr.conf: want %q in\n%s", tc.node, tc.want, got)
+		}
+	}
+}
+
+func TestGenerateOSPFAreas(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	topo, err := topology.FromYAML([]byte(`
+name: areas
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true, ospf6: true}
+    ospf: {area: 0.0.0.1, interfaces: {eth1: {passive: true}}}
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true, ospf6: true}
+  R3:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true, ospf6: true}
+links:
+  - endpoints: [R1, R2]
+    ospf: {area: 0, cost: 10}
+  - endpoints: [R1, R3]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := configen.New(logger.New(io.Discard, io.Discard))
+	if err := cp.GenerateAndDump(topo, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(tempDir, "R1", "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"interface lo\n ip address 192.168.0.1/32\n ip ospf area 0.0.0.1\n ip ospf passive\n ipv6 address 2001:db8::1/128\n ipv6 ospf6 area 0.0.0.1\n ipv6 ospf6 passive\nexit\n",
+		"interface eth0\n ip address 10.1.2.1/24\n ip ospf area 0\n ip ospf cost 10\n ip ospf network point-to-point\n ipv6 address 2001:db8:1:2::1/64\n ipv6 ospf6 area 0\n ipv6 ospf6 cost 10\n ipv6 ospf6 network point-to-point\nexit\n",
+		" ip ospf area 0.0.0.1\n ip ospf network point-to-point\n ip ospf passive\n",
+		" ipv6 ospf6 area 0.0.0.1\n ipv6 ospf6 network point-to-point\n ipv6 ospf6 passive\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("frr.conf: want %q in\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package configen
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+)
+
+func TestRenderNETCONF(t *testing.T) {
+	t.Parallel()
+	asn := uint32(65001)
+	node := &topology.Node{
+		Name:          "R1",
+		Vendor:        vendors.CRPD,
+		IPv4Loopbacks: []string{"192.168.0.1/32"},
+		IPv6Loopbacks: []string{"2001:db8::1/128"},
+		Protocols:     map[string]bool{"bgp": true, "ospf": true},
+		ASN:           &asn,
+		Interfaces:    []*topology.Interface{{Name: "eth0"}},
+		BGPNeighbors:  []*topology.BGPNeighbor{{Addr: "10.1.2.2", ASN: 65002, Password: "s3<r3t"}},
+	}
+	config, err := render(new(topology.Topology), node, "netconf.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		HostName string `xml:"system>host-name"`
+		Neighbor struct {
+			Name   string `xml:"name"`
+			PeerAS string `xml:"peer-as"`
+			Key    string `xml:"authentication-key"`
+		} `xml:"protocols>bgp>group>neighbor"`
+		OSPFInterfaces []string `xml:"protocols>ospf>area>interface>name"`
+	}
+	if err := xml.Unmarshal(config, &parsed); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, config)
+	}
+	if parsed.HostName != "R1" {
+		t.Errorf("host-name: want R1, got %q", parsed.HostName)
+	}
+	if parsed.Neighbor.Name != "10.1.2.2" || parsed.Neighbor.PeerAS != "65002" || parsed.Neighbor.Key != "s3<r3t" {
+		t.Errorf("unexpected neighbor %+v", parsed.Neighbor)
+	}
+	if got := strings.Join(parsed.OSPFInterfaces, ","); got != "lo0.0,eth0" {
+		t.Errorf("ospf interfaces: want lo0.0,eth0, got %s", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Package configsave preserves running configuration of network nodes on disk.
+package configsave
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+)
+
+// Executor represents a provider capable of running commands inside nodes.
+type Executor interface {
+	NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error)
+}
+
+// Save persists running configuration inside all nodes with the vendor-specific command and
+// copies the vendor config files into per-node directories under rootDir, as laid out by configen.
+// Nodes of vendors without save support are skipped. Names of the saved nodes are returned.
+func Save(ctx context.Context, topo *topology.Topology, ex Executor, rootDir string) ([]string, error) {
+	var saved []string
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		node := topo.Nodes[name]
+		vendorConfig := vendors.GetConfig(node.Vendor)
+		if len(vendorConfig.SaveCommand) == 0 {
+			continue
+		}
+		if _, err := run(ctx, ex, node, vendorConfig.SaveCommand); err != nil {
+			return saved, fmt.Errorf("node %s failed to save configuration: %w", name, err)
+		}
+		nodeDir := filepath.Join(rootDir, name)
+		if err := os.MkdirAll(nodeDir, 0o750); err != nil {
+			return saved, err
+		}
+		for _, path := range vendorConfig.ConfigFiles {
+			config, err := run(ctx, ex, node, []string{"cat", path})
+			if err != nil {
+				return saved, fmt.Errorf("node %s failed to copy %s: %w", name, path, err)
+			}
+			if err := os.WriteFile(filepath.Join(nodeDir, filepath.Base(path)), config, 0o644); err != nil {
+				return saved, err
+			}
+		}
+		saved = append(saved, name)
+	}
+	return saved, nil
+}
+
+// run executes a command on the node and returns its output, failing on a non-zero exit code.
+func run(ctx context.Context, ex Executor, node *topology.Node, cmd []string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := ex.NodeExec(ctx, *node, cmd, &stdout, &stderr)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("exit code %d: %s", exitCode, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
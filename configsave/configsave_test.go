@@ -0,0 +1,104 @@
+package configsave_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/configsave"
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+	"github.com/google/go-cmp/cmp"
+)
+
+type stubExecutor struct {
+	failCmd  string
+	commands []string
+}
+
+func (s *stubExecutor) NodeExec(_ context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	line := strings.Join(cmd, " ")
+	s.commands = append(s.commands, node.Name+": "+line)
+	if line == s.failCmd {
+		fmt.Fprint(stderr, "permission denied")
+		return 1, nil
+	}
+	fmt.Fprintf(stdout, "! %s of %s\n", cmd[len(cmd)-1], node.Name)
+	return 0, nil
+}
+
+func testTopology() *topology.Topology {
+	return &topology.Topology{
+		Nodes: map[string]*topology.Node{
+			"R1": {Name: "R1", Vendor: vendors.FRR},
+			"R2": {Name: "R2", Vendor: vendors.UNKNOWN},
+		},
+	}
+}
+
+func TestSave(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ex := new(stubExecutor)
+	saved, err := configsave.Save(context.Background(), testTopology(), ex, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(saved, []string{"R1"}) {
+		t.Errorf("saved nodes: want [R1], got %v", saved)
+	}
+	wantCommands := []string{
+		"R1: vtysh -c write memory",
+		"R1: cat /etc/frr/daemons",
+		"R1: cat /etc/frr/vtysh.conf",
+		"R1: cat /etc/frr/frr.conf",
+	}
+	if diff := cmp.Diff(wantCommands, ex.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "R1", "frr.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "! /etc/frr/frr.conf of R1\n"; string(got) != want {
+		t.Errorf("frr.conf: want %q, got %q", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "R2")); !os.IsNotExist(err) {
+		t.Errorf("R2 directory: want it absent, got %v", err)
+	}
+}
+
+func TestSaveErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		failCmd string
+		errMsg  string
+	}{
+		{
+			name:    "SaveCommand",
+			failCmd: "vtysh -c write memory",
+			errMsg:  "node R1 failed to save configuration: exit code 1: permission denied",
+		},
+		{
+			name:    "CopyConfig",
+			failCmd: "cat /etc/frr/daemons",
+			errMsg:  "node R1 failed to copy /etc/frr/daemons: exit code 1: permission denied",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ex := &stubExecutor{failCmd: tc.failCmd}
+			_, err := configsave.Save(context.Background(), testTopology(), ex, t.TempDir())
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
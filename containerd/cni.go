@@ -0,0 +1,388 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// cniVersion is the version of the CNI specification the network configurations follow.
+const cniVersion = "1.0.0"
+
+// Options of Docker networks and endpoints which the containerd provider translates, while the others are rejected.
+const (
+	mtuOption        = "com.docker.network.driver.mtu"
+	masqueradeOption = "com.docker.network.bridge.enable_ip_masquerade"
+	ifnameOption     = "com.docker.network.endpoint.ifname"
+	sysctlsOption    = "com.docker.network.endpoint.sysctls"
+)
+
+// netConf is the CNI configuration of the network of a link, which is handed to its plugin.
+type netConf struct {
+	CNIVersion       string    `json:"cniVersion"`
+	Name             string    `json:"name"`
+	Type             string    `json:"type"`
+	Bridge           string    `json:"bridge,omitempty"`
+	IsGateway        bool      `json:"isGateway,omitempty"`
+	IsDefaultGateway bool      `json:"isDefaultGateway,omitempty"`
+	IPMasq           bool      `json:"ipMasq,omitempty"`
+	Master           string    `json:"master,omitempty"`
+	Mode             string    `json:"mode,omitempty"`
+	MTU              int       `json:"mtu,omitempty"`
+	IPAM             *ipamConf `json:"ipam,omitempty"`
+}
+
+// ipamConf configures the static IPAM plugin, which assigns the addresses computed by golab.
+type ipamConf struct {
+	Type      string        `json:"type"`
+	Addresses []ipamAddress `json:"addresses,omitempty"`
+}
+
+// ipamAddress is an address of an interface in CIDR notation along with the gateway of its subnet.
+type ipamAddress struct {
+	Address string `json:"address"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// cniError is the error a CNI plugin reports on its standard output.
+type cniError struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Details string `json:"details"`
+}
+
+// network is the record of the network of a link kept in the state directory, since CNI networks
+// only exist as configuration handed to plugins whenever an interface is attached.
+type network struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	IPv4Subnet  string            `json:"ipv4_subnet,omitempty"`
+	IPv6Subnet  string            `json:"ipv6_subnet,omitempty"`
+	IPv4Gateway string            `json:"ipv4_gateway,omitempty"`
+	IPv6Gateway string            `json:"ipv6_gateway,omitempty"`
+	MTU         int               `json:"mtu,omitempty"`
+	Config      netConf           `json:"config"`
+}
+
+// newNetwork translates the link into a CNI network. Links are Linux bridges holding their gateways, if any,
+// which masquerade the traffic of external links, while links bridged to a host interface are macvlan or ipvlan
+// networks on top of it.
+func newNetwork(link topology.Link) (*network, error) {
+	name := cniName(link.Name, link.Labels)
+	net := &network{
+		Name:       link.Name,
+		Labels:     managed(link.Labels),
+		IPv4Subnet: link.IPv4Subnet,
+		IPv6Subnet: link.IPv6Subnet,
+		MTU:        link.MTU,
+		Config:     netConf{CNIVersion: cniVersion, Name: name, MTU: link.MTU, IPAM: &ipamConf{Type: "static"}},
+	}
+	switch {
+	case link.HostInterface != "" && link.Driver == topology.DriverIPvlan:
+		net.Config.Type, net.Config.Master, net.Config.Mode = "ipvlan", link.HostInterface, "l2"
+	case link.HostInterface != "":
+		net.Config.Type, net.Config.Master, net.Config.Mode = "macvlan", link.HostInterface, "bridge"
+	case link.Driver == topology.DriverMacvlan || link.Driver == topology.DriverIPvlan:
+		return nil, fmt.Errorf("link %s: %s links require a host interface with the containerd provider", link.Name, link.Driver)
+	default:
+		net.Config.Type, net.Config.Bridge = "bridge", bridgeName(link)
+		// bridges of links without gateways stay out of their subnets, like the wires they stand for
+		net.Config.IsGateway = !link.NoGateway && (link.IPv4Gateway != "" || link.IPv6Gateway != "")
+		net.Config.IPMasq = link.External && net.Config.IsGateway
+		// nodes reach beyond the lab through external links, as with Docker
+		net.Config.IsDefaultGateway = net.Config.IPMasq
+		net.IPv4Gateway, net.IPv6Gateway = link.IPv4Gateway, link.IPv6Gateway
+	}
+	for _, key := range slices.Sorted(maps.Keys(link.DriverOpts)) {
+		value := link.DriverOpts[key]
+		switch {
+		case key == mtuOption:
+			mtu, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("link %s: driver option %s has invalid value %q", link.Name, key, value)
+			}
+			net.MTU, net.Config.MTU = mtu, mtu
+		case key == masqueradeOption && net.Config.Type == "bridge":
+			net.Config.IPMasq = value == "true"
+		default:
+			return nil, fmt.Errorf("link %s: driver option %s is not supported by the containerd provider", link.Name, key)
+		}
+	}
+	return net, nil
+}
+
+// interfaceConf returns the configuration of the network handing the addresses of the interface to the static
+// IPAM plugin. Plugins of a CNI DEL get the same configuration as the ADD.
+func (net *network) interfaceConf(iface *topology.Interface) netConf {
+	conf := net.Config
+	conf.IPAM = &ipamConf{Type: "static"}
+	for _, addr := range []struct{ cidr, gateway string }{{iface.IPv4Addr, net.IPv4Gateway}, {iface.IPv6Addr, net.IPv6Gateway}} {
+		if addr.cidr == "" {
+			continue
+		}
+		if !conf.IsGateway {
+			addr.gateway = ""
+		}
+		conf.IPAM.Addresses = append(conf.IPAM.Addresses, ipamAddress{Address: addr.cidr, Gateway: addr.gateway})
+	}
+	return conf
+}
+
+// networkPath returns the path of the record of the network with the name in the state directory.
+func (cp *ContainerdProvider) networkPath(name string) string {
+	return filepath.Join(cp.stateDir, "networks", name+".json")
+}
+
+// readNetwork reads the record of the network of the link, which is nil if there is none.
+func (cp *ContainerdProvider) readNetwork(name string) (*network, error) {
+	data, err := os.ReadFile(cp.networkPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var net network
+	if err := json.Unmarshal(data, &net); err != nil {
+		return nil, fmt.Errorf("network record %s is malformed: %w", cp.networkPath(name), err)
+	}
+	return &net, nil
+}
+
+// writeNetwork keeps the record of the network in the state directory.
+func (cp *ContainerdProvider) writeNetwork(net *network) error {
+	return writeRecord(cp.networkPath(net.Config.Name), net)
+}
+
+// networks reads the records of all networks in the state directory.
+func (cp *ContainerdProvider) networks() ([]*network, error) {
+	paths, err := filepath.Glob(filepath.Join(cp.stateDir, "networks", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	nets := make([]*network, 0, len(paths))
+	for _, path := range paths {
+		net, err := cp.readNetwork(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, net)
+	}
+	return nets, nil
+}
+
+// writeRecord writes the record as JSON, creating its directory if missing.
+func writeRecord(path string, record any) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o640)
+}
+
+// cni runs the plugin of the network with the command, ADD or DEL, for the interface of the container with
+// the name inside the network namespace.
+func (cp *ContainerdProvider) cni(ctx context.Context, command string, net *network, name, netns string, iface *topology.Interface) error {
+	conf, err := json.Marshal(net.interfaceConf(iface))
+	if err != nil {
+		return err
+	}
+	var stdout, stderr bytes.Buffer
+	exitCode, err := cp.runner.Run(ctx, Command{
+		Name: filepath.Join(cp.cniPath, net.Config.Type),
+		Env: []string{
+			"CNI_COMMAND=" + command,
+			"CNI_CONTAINERID=" + name,
+			"CNI_NETNS=" + filepath.Join(netnsDir, netns),
+			"CNI_IFNAME=" + iface.Name,
+			"CNI_PATH=" + cp.cniPath,
+		},
+		Stdin:  bytes.NewReader(conf),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to run cni plugin %s: %w", net.Config.Type, err)
+	}
+	if exitCode == 0 {
+		return nil
+	}
+	var cniErr cniError
+	if err := json.Unmarshal(stdout.Bytes(), &cniErr); err != nil || cniErr.Msg == "" {
+		cniErr.Msg = strings.TrimSpace(stderr.String())
+	}
+	if cniErr.Details != "" {
+		cniErr.Msg += ": " + cniErr.Details
+	}
+	verb := "attach"
+	if command == "DEL" {
+		verb = "detach"
+	}
+	return fmt.Errorf("cni plugin %s failed to %s interface %s of containerd container %s: %s", net.Config.Type, verb, iface.Name, name, cniErr.Msg)
+}
+
+// interfaceSysctls returns the sysctls among the options of the Docker endpoint of the interface, with
+// IFNAME replaced by the name of the interface. Interfaces are named by CNI, and other options are rejected.
+func interfaceSysctls(node topology.Node, iface *topology.Interface) ([]string, error) {
+	var sysctls []string
+	for _, key := range slices.Sorted(maps.Keys(iface.DriverOpts)) {
+		value := iface.DriverOpts[key]
+		switch key {
+		case ifnameOption:
+		case sysctlsOption:
+			for sysctl := range strings.SplitSeq(value, ",") {
+				// sysctls are written as paths, since the interface name may itself contain dots
+				key, value, _ := strings.Cut(sysctl, "=")
+				key = strings.Replace(strings.ReplaceAll(key, ".", "/"), "IFNAME", iface.Name, 1)
+				sysctls = append(sysctls, key+"="+value)
+			}
+		default:
+			return nil, fmt.Errorf("node %s: endpoint option %s on link %s is not supported by the containerd provider", node.Name, key, iface.Link)
+		}
+	}
+	return sysctls, nil
+}
+
+// attach attaches the interface of the node to the network of its link and applies its sysctls.
+func (cp *ContainerdProvider) attach(ctx context.Context, node topology.Node, iface *topology.Interface) error {
+	name := cniName(iface.Link, node.Labels)
+	net, err := cp.readNetwork(name)
+	if err != nil {
+		return err
+	}
+	if net == nil {
+		return fmt.Errorf("cni network %s of node %s does not exist", name, node.Name)
+	}
+	sysctls, err := interfaceSysctls(node, iface)
+	if err != nil {
+		return err
+	}
+	if err := cp.cni(ctx, "ADD", net, containerName(node), netnsName(node), iface); err != nil {
+		return err
+	}
+	return cp.sysctl(ctx, node, sysctls)
+}
+
+// detach detaches the recorded interface of a container from the network of its link, which also removes the
+// rules masquerading its traffic. Interfaces of networks removed meanwhile are gone along with the namespace.
+func (cp *ContainerdProvider) detach(ctx context.Context, rec *container, iface *topology.Interface) error {
+	net, err := cp.readNetwork(cniName(iface.Link, rec.Labels))
+	if err != nil || net == nil {
+		return err
+	}
+	return cp.cni(ctx, "DEL", net, rec.Name, rec.NetNS, iface)
+}
+
+// sysctl sets the sysctls given as KEY=VALUE inside the network namespace of the node.
+func (cp *ContainerdProvider) sysctl(ctx context.Context, node topology.Node, sysctls []string) error {
+	for _, sysctl := range sysctls {
+		if _, err := cp.ip(ctx, "netns", "exec", netnsName(node), "sysctl", "-w", sysctl); err != nil {
+			return fmt.Errorf("failed to set sysctl %s of node %s: %w", sysctl, node.Name, err)
+		}
+	}
+	return nil
+}
+
+// connectVeth wires the network namespaces of the nodes of a veth link with a veth pair. The namespaces
+// outlive the tasks of the nodes, so the pair survives restarts of either node.
+func (cp *ContainerdProvider) connectVeth(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	if len(nodes) != 2 {
+		return fmt.Errorf("veth link %s requires exactly two nodes, got %d", link.Name, len(nodes))
+	}
+	var ends [2]*topology.Interface
+	for i, node := range nodes {
+		var ifaces []*topology.Interface
+		for _, iface := range node.Interfaces {
+			if iface.Link == link.Name {
+				ifaces = append(ifaces, iface)
+			}
+		}
+		// a node looped back to itself holds both ends of the pair
+		k := 0
+		if i == 1 && nodes[0].Name == node.Name {
+			k = 1
+		}
+		if k >= len(ifaces) {
+			return fmt.Errorf("node %s is not attached to link %s", node.Name, link.Name)
+		}
+		ends[i] = ifaces[k]
+	}
+	pair := fmt.Sprintf("%s:%s-%s:%s", nodes[0].Name, ends[0].Name, nodes[1].Name, ends[1].Name)
+	// removing either end removes the pair, so one end tells whether it exists
+	exists, err := cp.succeeds(ctx, "-n", netnsName(nodes[0]), "link", "show", "dev", ends[0].Name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		cp.log.With(link.Name).Skipped("already created veth pair " + pair)
+		return nil
+	}
+	args := []string{"link", "add", ends[0].Name, "netns", netnsName(nodes[0])}
+	if link.MTU != 0 {
+		args = append(args, "mtu", strconv.Itoa(link.MTU))
+	}
+	args = append(args, "type", "veth", "peer", "name", ends[1].Name, "netns", netnsName(nodes[1]))
+	if _, err := cp.ip(ctx, args...); err != nil {
+		return fmt.Errorf("failed to create veth pair %s: %w", pair, err)
+	}
+	for i, end := range ends {
+		sysctls, err := interfaceSysctls(nodes[i], end)
+		if err != nil {
+			return err
+		}
+		if err := cp.sysctl(ctx, nodes[i], sysctls); err != nil {
+			return err
+		}
+		ns := netnsName(nodes[i])
+		for _, cidr := range []string{end.IPv4Addr, end.IPv6Addr} {
+			if cidr == "" {
+				continue
+			}
+			if _, err := cp.ip(ctx, "-n", ns, "addr", "replace", cidr, "dev", end.Name); err != nil {
+				return fmt.Errorf("failed to configure veth pair %s: %w", pair, err)
+			}
+		}
+		if _, err := cp.ip(ctx, "-n", ns, "link", "set", "dev", end.Name, "up"); err != nil {
+			return fmt.Errorf("failed to configure veth pair %s: %w", pair, err)
+		}
+	}
+	cp.log.With(link.Name).Success("created veth pair " + pair)
+	return nil
+}
+
+// disconnectVeth removes the veth pair of the link by deleting its end in the namespace of a node,
+// which deletes the peer along with it.
+func (cp *ContainerdProvider) disconnectVeth(ctx context.Context, link topology.Link, node topology.Node) error {
+	iface, err := attachment(link, node)
+	if err != nil {
+		return err
+	}
+	pair := fmt.Sprintf("%s:%s", node.Name, iface.Name)
+	exists, err := cp.succeeds(ctx, "-n", netnsName(node), "link", "show", "dev", iface.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		cp.log.With(link.Name).Skipped("already removed veth pair " + pair)
+		return nil
+	}
+	if _, err := cp.ip(ctx, "-n", netnsName(node), "link", "delete", "dev", iface.Name); err != nil {
+		return fmt.Errorf("failed to remove veth pair %s: %w", pair, err)
+	}
+	cp.log.With(link.Name).Success("removed veth pair " + pair)
+	return nil
+}
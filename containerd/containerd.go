@@ -0,0 +1,1392 @@
+// Package containerd translates GoLab network topology entities into containerd objects, so that labs run on
+// hosts without the Docker engine, e.g. Kubernetes worker nodes. containerd is driven with ctr, while links are
+// wired by running CNI plugins directly. Examples:
+//
+//	topology.Link is equivalent to a CNI network
+//	topology.Node is equivalent to a containerd container in a network namespace of its own
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/go-units"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+)
+
+// namespace is the containerd namespace holding the containers of all labs.
+const namespace = "golab"
+
+// Defaults of the state directory of the provider and of the directory holding the CNI plugins.
+const (
+	DefaultStateDir = "/var/lib/golab/containerd"
+	DefaultCNIPath  = "/opt/cni/bin"
+)
+
+// netnsDir holds the network namespaces created with ip netns, which outlive the tasks of the containers.
+const netnsDir = "/var/run/netns"
+
+// bridgePrefix starts the names of Linux bridges of lab networks, which are limited to maxIfaceName characters.
+const (
+	bridgePrefix = "gl-"
+	maxIfaceName = 15
+)
+
+// defaultReadyTimeout bounds waiting for a started container to become ready unless its node sets a timeout.
+const defaultReadyTimeout = 2 * time.Minute
+
+// defaultStopTimeout bounds graceful shutdown of a stopped container unless its node sets a timeout.
+const defaultStopTimeout = 10 * time.Second
+
+// readyInterval separates readiness checks of a started container and polls of followed logs.
+const readyInterval = time.Second
+
+// statsInterval separates the two samples of CPU usage NodeStats calculates the usage from.
+const statsInterval = 500 * time.Millisecond
+
+// crashLogLines is the number of last log lines reported for a container which exits while starting.
+const crashLogLines = 20
+
+// managedLabel marks containerd objects created by golab, which are the only ones it removes.
+const managedLabel = "golab.managed"
+
+// Labels of the restart monitor of containerd, which restarts tasks of containers whose desired status is running.
+const (
+	restartPolicyLabel = "containerd.io/restart.policy"
+	restartStatusLabel = "containerd.io/restart.status"
+	restartLogLabel    = "containerd.io/restart.loguri"
+)
+
+// Statuses of containerd tasks as reported by ctr.
+const (
+	taskRunning = "RUNNING"
+	taskPaused  = "PAUSED"
+	taskStopped = "STOPPED"
+)
+
+// ContainerdProvider stores the runner of ctr, ip and CNI plugins along with the directories the provider uses.
+type ContainerdProvider struct {
+	runner   Runner
+	stateDir string
+	cniPath  string
+	log      *logger.Logger
+	execs    atomic.Uint64
+}
+
+// New returns an instance of a ContainerdProvider, which keeps records of networks and containers in the state
+// directory and runs the CNI plugins found in cniPath.
+func New(runner Runner, stateDir, cniPath string, log *logger.Logger) *ContainerdProvider {
+	return &ContainerdProvider{runner: runner, stateDir: stateDir, cniPath: cniPath, log: log}
+}
+
+// CNIPath returns the directory holding the CNI plugins: CNI_PATH if set, otherwise DefaultCNIPath.
+func CNIPath() string {
+	if path := os.Getenv("CNI_PATH"); path != "" {
+		return path
+	}
+	return DefaultCNIPath
+}
+
+// container is the record of the container of a node kept in the state directory, listing the interfaces
+// attached to CNI networks, which have to be detached before the network namespace is deleted.
+type container struct {
+	Name       string                `json:"name"`
+	Labels     map[string]string     `json:"labels,omitempty"`
+	Image      string                `json:"image"`
+	NetNS      string                `json:"netns,omitempty"`
+	Interfaces []*topology.Interface `json:"interfaces,omitempty"`
+}
+
+// containerInfo is the part of the containerd container reported by ctr containers info which golab uses.
+type containerInfo struct {
+	ID     string            `json:"ID"`
+	Labels map[string]string `json:"Labels"`
+	Image  string            `json:"Image"`
+}
+
+// task is a containerd task as listed by ctr tasks ls, with an empty status if the container has no task.
+type task struct {
+	PID    int
+	Status string
+}
+
+// LinkCreate translates a topology.Link entity into a CNI network and keeps its record. Linux bridges are
+// created by the bridge plugin once the first node is attached.
+func (cp *ContainerdProvider) LinkCreate(ctx context.Context, link topology.Link) error {
+	net, err := newNetwork(link)
+	if err != nil {
+		return err
+	}
+	name := net.Config.Name
+	existing, err := cp.readNetwork(name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if !owned(existing.Labels, link.Labels) {
+			return fmt.Errorf("refusing to replace cni network %s, which golab did not create for this lab", name)
+		}
+		// interfaces attached to the network would keep the configuration they were attached with
+		if !equalNetworks(existing, net) {
+			cp.log.With(link.Name).Warn(fmt.Sprintf("cni network %s does not match the topology, wreck the lab to recreate it", name))
+			return nil
+		}
+		cp.log.With(link.Name).Skipped("already created cni network " + name)
+		return nil
+	}
+	if err := cp.writeNetwork(net); err != nil {
+		return err
+	}
+	if link.IPv4Subnet == "" && link.IPv6Subnet == "" {
+		cp.log.With(link.Name).Success(fmt.Sprintf("created cni network %s without IP addressing, type=%s", name, net.Config.Type))
+		return nil
+	}
+	cp.log.With(link.Name).Success(fmt.Sprintf("created cni network %s with subnets=[%v, %v], type=%s", name, link.IPv4Subnet, link.IPv6Subnet, net.Config.Type))
+	return nil
+}
+
+// equalNetworks tells whether the records describe the same network.
+func equalNetworks(a, b *network) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+// LinkRemove removes the Linux bridge of the CNI network of the link, if any, along with its record.
+func (cp *ContainerdProvider) LinkRemove(ctx context.Context, link topology.Link) error {
+	name := cniName(link.Name, link.Labels)
+	net, err := cp.readNetwork(name)
+	if err != nil {
+		return err
+	}
+	if net == nil {
+		cp.log.With(link.Name).Skipped("already removed cni network " + name)
+		return nil
+	}
+	if !owned(net.Labels, link.Labels) {
+		return fmt.Errorf("refusing to remove cni network %s, which golab did not create for this lab", name)
+	}
+	if err := cp.removeNetwork(ctx, net); err != nil {
+		return err
+	}
+	cp.log.With(link.Name).Success("removed cni network " + name)
+	return nil
+}
+
+// removeNetwork deletes the bridge of the network, which the bridge plugin leaves behind, and its record.
+func (cp *ContainerdProvider) removeNetwork(ctx context.Context, net *network) error {
+	if net.Config.Bridge != "" {
+		exists, err := cp.succeeds(ctx, "link", "show", "dev", net.Config.Bridge)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if _, err := cp.ip(ctx, "link", "delete", "dev", net.Config.Bridge); err != nil {
+				return fmt.Errorf("failed to remove bridge %s of cni network %s: %w", net.Config.Bridge, net.Config.Name, err)
+			}
+		}
+	}
+	return os.Remove(cp.networkPath(net.Config.Name))
+}
+
+// LinkConnect attaches the provided nodes to the link while they keep running. Nodes are attached to the CNI
+// network of the link with their addresses on it, while the network namespaces of the two nodes of a veth
+// link are wired with a veth pair.
+func (cp *ContainerdProvider) LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	if link.Veth() {
+		return cp.connectVeth(ctx, link, nodes)
+	}
+	netName := cniName(link.Name, link.Labels)
+	for _, node := range nodes {
+		name := containerName(node)
+		iface, err := attachment(link, node)
+		if err != nil {
+			return err
+		}
+		rec, err := cp.readContainer(name)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return fmt.Errorf("containerd container %s does not exist", name)
+		}
+		if slices.ContainsFunc(rec.Interfaces, func(i *topology.Interface) bool { return i.Link == link.Name }) {
+			cp.log.With(node.Name).Skipped(fmt.Sprintf("already connected containerd container %s to cni network %s", name, netName))
+			continue
+		}
+		if err := cp.attach(ctx, node, iface); err != nil {
+			return err
+		}
+		rec.Interfaces = append(rec.Interfaces, iface)
+		if err := cp.writeContainer(rec); err != nil {
+			return err
+		}
+		cp.log.With(node.Name).Success(fmt.Sprintf("connected containerd container %s to cni network %s", name, netName))
+	}
+	return nil
+}
+
+// LinkDisconnect detaches the provided nodes from the link while they keep running.
+func (cp *ContainerdProvider) LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	netName := cniName(link.Name, link.Labels)
+	for _, node := range nodes {
+		if link.Veth() {
+			if err := cp.disconnectVeth(ctx, link, node); err != nil {
+				return err
+			}
+			continue
+		}
+		name := containerName(node)
+		rec, err := cp.readContainer(name)
+		if err != nil {
+			return err
+		}
+		j := -1
+		if rec != nil {
+			j = slices.IndexFunc(rec.Interfaces, func(i *topology.Interface) bool { return i.Link == link.Name })
+		}
+		if j < 0 {
+			cp.log.With(node.Name).Skipped(fmt.Sprintf("already disconnected containerd container %s from cni network %s", name, netName))
+			continue
+		}
+		if err := cp.detach(ctx, rec, rec.Interfaces[j]); err != nil {
+			return err
+		}
+		rec.Interfaces = slices.Delete(rec.Interfaces, j, j+1)
+		if err := cp.writeContainer(rec); err != nil {
+			return err
+		}
+		cp.log.With(node.Name).Success(fmt.Sprintf("disconnected containerd container %s from cni network %s", name, netName))
+	}
+	return nil
+}
+
+// attachment returns the interface of the node on the link.
+func attachment(link topology.Link, node topology.Node) (*topology.Interface, error) {
+	j := slices.IndexFunc(node.Interfaces, func(iface *topology.Interface) bool { return iface.Link == link.Name })
+	if j < 0 {
+		return nil, fmt.Errorf("node %s is not attached to link %s", node.Name, link.Name)
+	}
+	return node.Interfaces[j], nil
+}
+
+// managed adds the label marking containerd objects created by golab to the labels of a topology entity.
+func managed(labels map[string]string) map[string]string {
+	labels = maps.Clone(labels)
+	if labels == nil {
+		labels = make(map[string]string, 1)
+	}
+	labels[managedLabel] = "true"
+	return labels
+}
+
+// unmanaged reverts managed for containerd objects, so that their labels compare equal to the ones of topology entities.
+func unmanaged(labels map[string]string) map[string]string {
+	labels = maps.Clone(labels)
+	delete(labels, managedLabel)
+	for key := range labels {
+		if strings.HasPrefix(key, "containerd.io/") {
+			delete(labels, key)
+		}
+	}
+	return labels
+}
+
+// owned tells whether a containerd object was created by golab for the lab of the topology entity, rather than
+// merely sharing its name.
+func owned(labels, want map[string]string) bool {
+	return labels[managedLabel] == "true" && labels[topology.LabLabel] == want[topology.LabLabel]
+}
+
+// labName prefixes the name of a topology entity with the lab it is labeled with, so that labs
+// with the same node names can run side by side. Entities without a lab keep their names.
+func labName(name string, labels map[string]string) string {
+	if lab := labels[topology.LabLabel]; lab != "" {
+		return lab + "-" + name
+	}
+	return name
+}
+
+// topologyName reverts labName for containerd objects labeled with the lab owning them.
+func topologyName(name string, labels map[string]string) string {
+	if lab := labels[topology.LabLabel]; lab != "" {
+		return strings.TrimPrefix(name, lab+"-")
+	}
+	return name
+}
+
+// containerName resolves the name of the containerd container representing the node.
+func containerName(node topology.Node) string {
+	return labName(node.Name, node.Labels)
+}
+
+// cniName resolves the name of the CNI network representing the link with the name, which belongs to
+// the lab the labels refer to.
+func cniName(link string, labels map[string]string) string {
+	return labName(link, labels)
+}
+
+// netnsName resolves the name of the network namespace of the node, which is the one of the node it shares
+// its network namespace with, if any.
+func netnsName(node topology.Node) string {
+	name := containerName(node)
+	if target, ok := strings.CutPrefix(node.NetworkMode, "container:"); ok {
+		name = labName(target, node.Labels)
+	}
+	return "golab-" + name
+}
+
+// netnsPath returns the path of the network namespace of the node.
+func netnsPath(node topology.Node) string {
+	return filepath.Join(netnsDir, netnsName(node))
+}
+
+// bridgeName names the Linux bridge of the network after the link and its lab like the docker provider does,
+// so that host tools such as tcpdump or tc target the same bridges with either provider.
+func bridgeName(link topology.Link) string {
+	name := bridgePrefix + strings.TrimPrefix(link.Name, "golab-")
+	if lab := link.Labels[topology.LabLabel]; lab != "" {
+		name = bridgePrefix + lab + "-" + strings.TrimPrefix(link.Name, "golab-")
+	}
+	if len(name) <= maxIfaceName {
+		return name
+	}
+	sum := sha256.Sum256([]byte(cniName(link.Name, link.Labels)))
+	return name[:maxIfaceName-7] + "-" + hex.EncodeToString(sum[:])[:6]
+}
+
+// containerPath returns the path of the record of the container with the name in the state directory.
+func (cp *ContainerdProvider) containerPath(name string) string {
+	return filepath.Join(cp.stateDir, "containers", name+".json")
+}
+
+// logPath returns the path of the file the task of the container with the name logs to.
+func (cp *ContainerdProvider) logPath(name string) string {
+	return filepath.Join(cp.stateDir, "logs", name+".log")
+}
+
+// readContainer reads the record of the container with the name, which is nil if there is none.
+func (cp *ContainerdProvider) readContainer(name string) (*container, error) {
+	data, err := os.ReadFile(cp.containerPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec container
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("container record %s is malformed: %w", cp.containerPath(name), err)
+	}
+	return &rec, nil
+}
+
+// writeContainer keeps the record of the container in the state directory.
+func (cp *ContainerdProvider) writeContainer(rec *container) error {
+	return writeRecord(cp.containerPath(rec.Name), rec)
+}
+
+// findContainer returns the containerd container with the name, or nil if there is none.
+func (cp *ContainerdProvider) findContainer(ctx context.Context, name string) (*containerInfo, error) {
+	ids, err := cp.ctr(ctx, "containers", "ls", "--quiet", "id=="+name)
+	if err != nil || len(bytes.TrimSpace(ids)) == 0 {
+		return nil, err
+	}
+	out, err := cp.ctr(ctx, "containers", "info", name)
+	if err != nil {
+		return nil, err
+	}
+	var info containerInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode containerd container %s: %w", name, err)
+	}
+	return &info, nil
+}
+
+// task returns the task of the container with the name as listed by ctr tasks ls.
+func (cp *ContainerdProvider) task(ctx context.Context, name string) (task, error) {
+	out, err := cp.ctr(ctx, "tasks", "ls")
+	if err != nil {
+		return task{}, err
+	}
+	// the first line is the header of the TASK, PID and STATUS columns
+	for line := range strings.Lines(string(out)) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != name {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[1])
+		return task{PID: pid, Status: fields[2]}, nil
+	}
+	return task{}, nil
+}
+
+// NodeExists checks whether a containerd container representing the provided topology.Node already exists.
+func (cp *ContainerdProvider) NodeExists(ctx context.Context, node topology.Node) (bool, error) {
+	info, err := cp.findContainer(ctx, containerName(node))
+	return info != nil, err
+}
+
+// NodeRunning checks whether the task of the containerd container representing the provided topology.Node
+// is running, including paused tasks.
+func (cp *ContainerdProvider) NodeRunning(ctx context.Context, node topology.Node) (bool, error) {
+	t, err := cp.task(ctx, containerName(node))
+	return t.Status == taskRunning || t.Status == taskPaused, err
+}
+
+// unsupported returns an error for the first setting of the node which has no containerd counterpart.
+func unsupported(node topology.Node) error {
+	var setting string
+	switch {
+	case len(node.Ports) != 0:
+		setting = "ports"
+	case len(node.Volumes) != 0:
+		setting = "volumes"
+	case node.DNSDomain != "":
+		setting = "dns"
+	}
+	for _, key := range slices.Sorted(maps.Keys(node.Sysctls)) {
+		if setting == "" && !strings.HasPrefix(key, "net.") {
+			setting = "sysctl " + key
+		}
+	}
+	if setting == "" {
+		return nil
+	}
+	return fmt.Errorf("node %s sets %s, which is not supported by the containerd provider", node.Name, setting)
+}
+
+// generateArgs converts the node into the arguments of ctr containers create. Unlike with Docker, the command of
+// a node replaces the whole command line of the image, including its entrypoint, as ctr does not merge them.
+func generateArgs(node topology.Node, image, logURI string, pid int) []string {
+	args := []string{"containers", "create"}
+	labels := managed(node.Labels)
+	// containers are kept when they exit, so that stopped nodes can be started again
+	if node.Restart != "" && node.Restart != "no" {
+		labels[restartPolicyLabel] = node.Restart
+		labels[restartStatusLabel] = taskRunning
+		labels[restartLogLabel] = logURI
+	}
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		args = append(args, "--label", key+"="+labels[key])
+	}
+	for _, env := range generateEnv(node) {
+		args = append(args, "--env", env)
+	}
+	// A container joining the namespaces of another one inherits its hostname and networks.
+	if node.NetworkMode == "" {
+		args = append(args, "--hostname", node.Name)
+	}
+	args = append(args, "--with-ns", "network:"+netnsPath(node))
+	if pid != 0 {
+		args = append(args, "--with-ns", fmt.Sprintf("pid:/proc/%d/ns/pid", pid))
+	}
+	if node.Privileged {
+		args = append(args, "--privileged")
+	}
+	for _, capability := range node.Capabilities {
+		args = append(args, "--cap-add", "CAP_"+capability)
+	}
+	for _, capability := range node.CapDrop {
+		args = append(args, "--cap-drop", "CAP_"+capability)
+	}
+	if node.CPUs != 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(node.CPUs, 'f', -1, 64))
+	}
+	if node.Memory != "" {
+		// the memory limit is validated along with the topology
+		memory, _ := units.RAMInBytes(node.Memory)
+		args = append(args, "--memory-limit", strconv.FormatInt(memory, 10))
+	}
+	for _, bind := range node.Binds {
+		parts := strings.Split(bind, ":")
+		args = append(args, "--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,options=rbind:rw", parts[0], parts[1]))
+	}
+	for _, target := range node.Tmpfs {
+		args = append(args, "--mount", "type=tmpfs,src=tmpfs,dst="+target)
+	}
+	args = append(args, image, containerName(node))
+	return append(args, slices.Concat(node.Entrypoint, node.Cmd)...)
+}
+
+// generateEnv converts node environment variables into a sorted KEY=value list.
+func generateEnv(node topology.Node) []string {
+	env := make([]string, 0, len(node.Env))
+	for key, value := range node.Env {
+		env = append(env, key+"="+value)
+	}
+	slices.Sort(env)
+	return env
+}
+
+// NodeCreate translates a topology.Node entity into a containerd container and creates/starts it. The network
+// namespace of the node is created first and its interfaces are attached to their CNI networks, so that
+// they are present when the network OS boots.
+func (cp *ContainerdProvider) NodeCreate(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	if err := unsupported(node); err != nil {
+		return err
+	}
+	info, err := cp.findContainer(ctx, name)
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		t, err := cp.task(ctx, name)
+		if err != nil {
+			return err
+		}
+		// a container which has been stopped or has exited is started again
+		if t.Status != taskRunning && t.Status != taskPaused {
+			return cp.NodeStart(ctx, node)
+		}
+		cp.log.With(node.Name).Skipped("already created containerd container " + name)
+		return nil
+	}
+	image, err := normalizeImage(node.Image)
+	if err != nil {
+		return err
+	}
+	rec := &container{Name: name, Labels: managed(node.Labels), Image: image}
+	if node.NetworkMode == "" {
+		rec.NetNS = netnsName(node)
+		if err := cp.createNetNS(ctx, node); err != nil {
+			return err
+		}
+	}
+	// the record is kept before anything is attached, so that a failing build leaves nothing untracked behind
+	if err := cp.writeContainer(rec); err != nil {
+		return err
+	}
+	if node.NetworkMode == "" {
+		if err := cp.attachAll(ctx, node, rec); err != nil {
+			return err
+		}
+	}
+	var pid int
+	if target, ok := strings.CutPrefix(node.PIDMode, "container:"); ok {
+		t, err := cp.task(ctx, labName(target, node.Labels))
+		if err != nil {
+			return err
+		}
+		if t.PID == 0 {
+			return fmt.Errorf("node %s shares the pid namespace of %s, which is not running", node.Name, target)
+		}
+		pid = t.PID
+	}
+	if err := cp.pullImage(ctx, node, image); err != nil {
+		return err
+	}
+	args := generateArgs(node, image, "file://"+cp.logPath(name), pid)
+	cp.log.With(name).Debug(fmt.Sprintf("running ctr %s", strings.Join(redactEnv(args), " ")))
+	if _, err := cp.ctr(ctx, args...); err != nil {
+		return err
+	}
+	if err := cp.startTask(ctx, node); err != nil {
+		return err
+	}
+	cp.log.With(node.Name).Success("started containerd container " + name)
+	return cp.waitReady(ctx, node)
+}
+
+// normalizeImage turns the image of a node into the fully qualified reference containerd stores images by,
+// e.g. docker.io/library/alpine:latest for alpine.
+func normalizeImage(image string) (string, error) {
+	ref, err := reference.ParseDockerRef(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %w", image, err)
+	}
+	return ref.String(), nil
+}
+
+// redactEnv hides values of environment variables among the arguments of ctr, which may hold resolved secrets.
+func redactEnv(args []string) []string {
+	args = slices.Clone(args)
+	for i := 1; i < len(args); i++ {
+		if args[i-1] == "--env" {
+			key, _, _ := strings.Cut(args[i], "=")
+			args[i] = key + "=<redacted>"
+		}
+	}
+	return args
+}
+
+// createNetNS creates the network namespace of the node with its loopback interface up, along with the
+// net sysctls of the node, which Docker would apply to the namespace of the container.
+func (cp *ContainerdProvider) createNetNS(ctx context.Context, node topology.Node) error {
+	ns := netnsName(node)
+	exists, err := cp.succeeds(ctx, "-n", ns, "link", "show", "dev", "lo")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := cp.ip(ctx, "netns", "add", ns); err != nil {
+			return fmt.Errorf("failed to create network namespace %s: %w", ns, err)
+		}
+	}
+	if _, err := cp.ip(ctx, "-n", ns, "link", "set", "dev", "lo", "up"); err != nil {
+		return fmt.Errorf("failed to configure network namespace %s: %w", ns, err)
+	}
+	sysctls := make([]string, 0, len(node.Sysctls))
+	for _, key := range slices.Sorted(maps.Keys(node.Sysctls)) {
+		sysctls = append(sysctls, strings.ReplaceAll(key, ".", "/")+"="+node.Sysctls[key])
+	}
+	return cp.sysctl(ctx, node, sysctls)
+}
+
+// attachAll attaches the interfaces of the node and its management interface to their CNI networks, recording
+// every attached interface. Subinterfaces are created inside the node on top of their parent interfaces,
+// while veth interfaces are wired once the node is started.
+func (cp *ContainerdProvider) attachAll(ctx context.Context, node topology.Node, rec *container) error {
+	ifaces := node.Interfaces
+	if node.Mgmt != nil {
+		ifaces = append(slices.Clip(ifaces), node.Mgmt)
+	}
+	for _, iface := range ifaces {
+		if iface.VLAN != 0 || iface.Veth {
+			continue
+		}
+		if slices.ContainsFunc(rec.Interfaces, func(i *topology.Interface) bool { return i.Link == iface.Link }) {
+			continue
+		}
+		if err := cp.attach(ctx, node, iface); err != nil {
+			return err
+		}
+		rec.Interfaces = append(rec.Interfaces, iface)
+		if err := cp.writeContainer(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullImage pulls the image of the node unless containerd holds it already.
+func (cp *ContainerdProvider) pullImage(ctx context.Context, node topology.Node, image string) error {
+	out, err := cp.ctr(ctx, "images", "ls", "--quiet", "name=="+image)
+	if err != nil || len(bytes.TrimSpace(out)) != 0 {
+		return err
+	}
+	log := cp.log.With(node.Name)
+	log.Progress("pulling image " + image)
+	if _, err := cp.ctr(ctx, "images", "pull", image); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	log.Success("pulled image " + image)
+	return nil
+}
+
+// startTask starts the task of the container of the node, replacing its exited task, and checks that it keeps
+// running for the minimum uptime of the node, so that images crashing on boot are reported along with their
+// last log lines.
+func (cp *ContainerdProvider) startTask(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	t, err := cp.task(ctx, name)
+	if err != nil {
+		return err
+	}
+	if t.Status != "" {
+		if _, err := cp.ctr(ctx, "tasks", "delete", "--force", name); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.logPath(name)), 0o750); err != nil {
+		return err
+	}
+	if _, err := cp.ctr(ctx, "tasks", "start", "--detach", "--log-uri", "file://"+cp.logPath(name), name); err != nil {
+		return err
+	}
+	var minUptime time.Duration
+	if node.MinUptime != "" {
+		// the uptime is validated along with the topology
+		minUptime, _ = time.ParseDuration(node.MinUptime)
+	}
+	if minUptime != 0 {
+		cp.log.With(node.Name).Progress(fmt.Sprintf("checking that containerd container %s keeps running for %s", name, minUptime))
+	}
+	deadline := time.Now().Add(minUptime)
+	for {
+		t, err := cp.task(ctx, name)
+		if err != nil {
+			return err
+		}
+		if t.Status != taskRunning {
+			return cp.crashed(ctx, node)
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(wait, readyInterval)):
+		}
+	}
+}
+
+// crashed logs the last lines the container of the node wrote before exiting and returns an error with its
+// exit code, which ctr exits with when deleting the exited task.
+func (cp *ContainerdProvider) crashed(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	var logs bytes.Buffer
+	if err := cp.NodeLogs(ctx, node, false, crashLogLines, &logs, &logs); err != nil {
+		return err
+	}
+	for line := range strings.Lines(logs.String()) {
+		cp.log.With(node.Name).Warn(strings.TrimRight(line, "\n"))
+	}
+	exitCode, err := cp.runner.Run(ctx, Command{Name: "ctr", Args: []string{"tasks", "delete", name}, Env: []string{"CONTAINERD_NAMESPACE=" + namespace}, Stdout: io.Discard, Stderr: io.Discard})
+	if err != nil {
+		return fmt.Errorf("failed to run ctr: %w", err)
+	}
+	return fmt.Errorf("containerd container %s exited with code %d while starting", name, exitCode)
+}
+
+// waitReady waits until the ready command of the node succeeds, so that configuration does not race the boot
+// of the network OS. containerd has no health checks, so containers without a ready command are ready once started.
+func (cp *ContainerdProvider) waitReady(ctx context.Context, node topology.Node) error {
+	timeout := defaultReadyTimeout
+	if node.ReadyTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.ReadyTimeout)
+	}
+	if timeout == 0 || len(node.ReadyCommand) == 0 {
+		return nil
+	}
+	name := containerName(node)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for waited := false; ; waited = true {
+		ready, err := cp.isReady(waitCtx, node)
+		if err != nil {
+			return err
+		}
+		if ready {
+			if waited {
+				cp.log.With(node.Name).Success("containerd container " + name + " is ready")
+			}
+			return nil
+		}
+		if !waited {
+			cp.log.With(node.Name).Progress("waiting for containerd container " + name + " to become ready")
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("containerd container %s is not ready after %s", name, timeout)
+		case <-time.After(readyInterval):
+		}
+	}
+}
+
+// isReady runs the ready command of the node. Failures to run the command are not errors, as the container may
+// still be booting, unless its task has exited.
+func (cp *ContainerdProvider) isReady(ctx context.Context, node topology.Node) (bool, error) {
+	t, err := cp.task(ctx, containerName(node))
+	if err != nil {
+		return false, err
+	}
+	if t.Status != taskRunning && t.Status != taskPaused {
+		return false, cp.crashed(ctx, node)
+	}
+	exitCode, err := cp.NodeExec(ctx, node, node.ReadyCommand, io.Discard, io.Discard)
+	return err == nil && exitCode == 0, nil
+}
+
+// NodeRemove translates a topology.Node entity into a containerd container and removes it along with its
+// network namespace, detaching its interfaces from their CNI networks first.
+func (cp *ContainerdProvider) NodeRemove(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	info, err := cp.findContainer(ctx, name)
+	if err != nil {
+		return err
+	}
+	rec, err := cp.readContainer(name)
+	if err != nil {
+		return err
+	}
+	if info == nil && rec == nil {
+		cp.log.With(node.Name).Skipped("already removed containerd container " + name)
+		return nil
+	}
+	if info != nil && !owned(info.Labels, node.Labels) || rec != nil && !owned(rec.Labels, node.Labels) {
+		return fmt.Errorf("refusing to remove containerd container %s, which golab did not create for this lab", name)
+	}
+	// running containers shut down gracefully first, so that network OSes can save their state and release locks
+	if err := cp.stopTask(ctx, name, stopTimeout(node)); err != nil {
+		cp.log.With(node.Name).Warn(fmt.Sprintf("failed to stop containerd container %s gracefully, removing it by force: %v", name, err))
+	}
+	if err := cp.remove(ctx, name, info != nil, rec); err != nil {
+		return err
+	}
+	cp.log.With(node.Name).Success("removed containerd container " + name)
+	return nil
+}
+
+// remove deletes the task and the container with the name, if it exists, and releases what its record holds.
+func (cp *ContainerdProvider) remove(ctx context.Context, name string, exists bool, rec *container) error {
+	if exists {
+		t, err := cp.task(ctx, name)
+		if err != nil {
+			return err
+		}
+		if t.Status != "" {
+			if _, err := cp.ctr(ctx, "tasks", "delete", "--force", name); err != nil {
+				return err
+			}
+		}
+		if _, err := cp.ctr(ctx, "containers", "delete", name); err != nil {
+			return err
+		}
+	}
+	if rec == nil {
+		return nil
+	}
+	// plugins remove the addresses and masquerading rules of the interfaces from the host
+	for _, iface := range slices.Backward(rec.Interfaces) {
+		if err := cp.detach(ctx, rec, iface); err != nil {
+			return err
+		}
+	}
+	// veth pairs are deleted along with the namespace
+	if rec.NetNS != "" {
+		exists, err := cp.succeeds(ctx, "-n", rec.NetNS, "link", "show", "dev", "lo")
+		if err != nil {
+			return err
+		}
+		if exists {
+			if _, err := cp.ip(ctx, "netns", "delete", rec.NetNS); err != nil {
+				return fmt.Errorf("failed to remove network namespace %s: %w", rec.NetNS, err)
+			}
+		}
+	}
+	if err := os.Remove(cp.logPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Remove(cp.containerPath(name))
+}
+
+// NodePause freezes all processes of the containerd container representing the provided topology.Node.
+func (cp *ContainerdProvider) NodePause(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	t, err := cp.task(ctx, name)
+	if err != nil {
+		return err
+	}
+	if t.Status == taskPaused {
+		cp.log.With(node.Name).Skipped("already paused containerd container " + name)
+		return nil
+	}
+	if _, err := cp.ctr(ctx, "tasks", "pause", name); err != nil {
+		return err
+	}
+	cp.log.With(node.Name).Success("paused containerd container " + name)
+	return nil
+}
+
+// NodeUnpause resumes all processes of the containerd container representing the provided topology.Node.
+func (cp *ContainerdProvider) NodeUnpause(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	t, err := cp.task(ctx, name)
+	if err != nil {
+		return err
+	}
+	if t.Status != taskPaused {
+		cp.log.With(node.Name).Skipped("already resumed containerd container " + name)
+		return nil
+	}
+	if _, err := cp.ctr(ctx, "tasks", "resume", name); err != nil {
+		return err
+	}
+	cp.log.With(node.Name).Success("resumed containerd container " + name)
+	return nil
+}
+
+// NodeStop stops the containerd container representing the provided topology.Node without removing it. Its network
+// namespace outlives the task, so the interfaces of the node are taken down as if it was powered off.
+func (cp *ContainerdProvider) NodeStop(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	t, err := cp.task(ctx, name)
+	if err != nil {
+		return err
+	}
+	if t.Status != taskRunning && t.Status != taskPaused {
+		cp.log.With(node.Name).Skipped("already stopped containerd container " + name)
+		return nil
+	}
+	if err := cp.setRestartStatus(ctx, node, taskStopped); err != nil {
+		return err
+	}
+	if err := cp.stopTask(ctx, name, stopTimeout(node)); err != nil {
+		return err
+	}
+	if err := cp.setLinks(ctx, node, "down"); err != nil {
+		return err
+	}
+	cp.log.With(node.Name).Success("stopped containerd container " + name)
+	return nil
+}
+
+// NodeStart starts the stopped containerd container representing the provided topology.Node
+// and waits for it to become ready.
+func (cp *ContainerdProvider) NodeStart(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	t, err := cp.task(ctx, name)
+	if err != nil {
+		return err
+	}
+	if t.Status == taskRunning || t.Status == taskPaused {
+		cp.log.With(node.Name).Skipped("already started containerd container " + name)
+		return nil
+	}
+	if err := cp.setLinks(ctx, node, "up"); err != nil {
+		return err
+	}
+	if err := cp.startTask(ctx, node); err != nil {
+		return err
+	}
+	if err := cp.setRestartStatus(ctx, node, taskRunning); err != nil {
+		return err
+	}
+	cp.log.With(node.Name).Success("started containerd container " + name)
+	return cp.waitReady(ctx, node)
+}
+
+// setRestartStatus sets the status the restart monitor keeps the task of the node in, if it has a restart policy,
+// so that stopped nodes are not restarted.
+func (cp *ContainerdProvider) setRestartStatus(ctx context.Context, node topology.Node, status string) error {
+	if node.Restart == "" || node.Restart == "no" {
+		return nil
+	}
+	_, err := cp.ctr(ctx, "containers", "label", containerName(node), restartStatusLabel+"="+status)
+	return err
+}
+
+// setLinks sets the state of all interfaces in the network namespace of the node, except for its loopback.
+// Nodes sharing the namespace of another one leave it alone.
+func (cp *ContainerdProvider) setLinks(ctx context.Context, node topology.Node, state string) error {
+	if node.NetworkMode != "" {
+		return nil
+	}
+	links, err := cp.links(ctx, node)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		if link.Name == "lo" {
+			continue
+		}
+		if _, err := cp.ip(ctx, "-n", netnsName(node), "link", "set", "dev", link.Name, state); err != nil {
+			return fmt.Errorf("failed to set interface %s of node %s %s: %w", link.Name, node.Name, state, err)
+		}
+	}
+	return nil
+}
+
+// ipLink is an interface as listed by ip -s -json link show.
+type ipLink struct {
+	Name    string `json:"ifname"`
+	Stats64 struct {
+		RX ipCounters `json:"rx"`
+		TX ipCounters `json:"tx"`
+	} `json:"stats64"`
+}
+
+// ipCounters are the traffic counters of an interface in one direction.
+type ipCounters struct {
+	Bytes   uint64 `json:"bytes"`
+	Packets uint64 `json:"packets"`
+	Errors  uint64 `json:"errors"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// links lists the interfaces in the network namespace of the node along with their counters.
+func (cp *ContainerdProvider) links(ctx context.Context, node topology.Node) ([]ipLink, error) {
+	out, err := cp.ip(ctx, "-n", netnsName(node), "-s", "-json", "link", "show")
+	if err != nil {
+		return nil, err
+	}
+	var links []ipLink
+	if err := json.Unmarshal(out, &links); err != nil {
+		return nil, fmt.Errorf("failed to decode interfaces of node %s: %w", node.Name, err)
+	}
+	return links, nil
+}
+
+// stopTask sends SIGTERM to the task of the container with the name and kills it once the timeout passes,
+// deleting the task afterwards. Containers without a running task are left alone.
+func (cp *ContainerdProvider) stopTask(ctx context.Context, name string, timeout time.Duration) error {
+	t, err := cp.task(ctx, name)
+	if err != nil || t.Status == "" {
+		return err
+	}
+	if t.Status == taskRunning {
+		if _, err := cp.ctr(ctx, "tasks", "kill", "--signal", "SIGTERM", name); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(timeout)
+		for t.Status != taskStopped && time.Now().Before(deadline) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(min(time.Until(deadline), readyInterval)):
+			}
+			if t, err = cp.task(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	// paused tasks and tasks ignoring SIGTERM are killed along with their deletion
+	_, err = cp.ctr(ctx, "tasks", "delete", "--force", name)
+	return err
+}
+
+// stopTimeout returns how long the container of the node is given to shut down when stopped, after which it is killed.
+func stopTimeout(node topology.Node) time.Duration {
+	timeout := defaultStopTimeout
+	if node.StopTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.StopTimeout)
+	}
+	return timeout
+}
+
+// NodeCommit is not supported, as containerd has no counterpart of docker commit.
+func (cp *ContainerdProvider) NodeCommit(ctx context.Context, node topology.Node, ref string) error {
+	return fmt.Errorf("node %s: snapshots are not supported by the containerd provider", node.Name)
+}
+
+// execID returns a unique ID of a process executed in a task.
+func (cp *ContainerdProvider) execID() string {
+	return fmt.Sprintf("golab-%d-%d", os.Getpid(), cp.execs.Add(1))
+}
+
+// NodeExec runs a command inside the containerd container representing the provided topology.Node
+// and returns the exit code of the command, which ctr exits with.
+func (cp *ContainerdProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	args := append([]string{"tasks", "exec", "--exec-id", cp.execID(), containerName(node)}, cmd...)
+	exitCode, err := cp.runner.Run(ctx, Command{Name: "ctr", Args: args, Env: []string{"CONTAINERD_NAMESPACE=" + namespace}, Stdout: stdout, Stderr: stderr})
+	if err != nil {
+		return 0, fmt.Errorf("failed to run ctr: %w", err)
+	}
+	return exitCode, nil
+}
+
+// NodeShell runs an interactive command inside the containerd container representing the provided topology.Node
+// with a pseudo-terminal attached to the provided TTY and returns the exit code of the command. ctr sizes the
+// pseudo-terminal after the terminal it is attached to.
+func (cp *ContainerdProvider) NodeShell(ctx context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error) {
+	args := append([]string{"tasks", "exec", "--tty", "--exec-id", cp.execID(), containerName(node)}, cmd...)
+	exitCode, err := cp.runner.Run(ctx, Command{Name: "ctr", Args: args, Env: []string{"CONTAINERD_NAMESPACE=" + namespace}, Stdin: tty.In, Stdout: tty.Out, Stderr: tty.Out})
+	if err != nil {
+		return 0, fmt.Errorf("failed to run ctr: %w", err)
+	}
+	return exitCode, nil
+}
+
+// NodeLogs writes logs of the containerd container representing the provided topology.Node, which are kept in a
+// file mixing its standard output and error, so everything is written to stdout. Only the last tail lines are
+// written unless tail is negative, and new output is streamed until the context is canceled if follow is set.
+func (cp *ContainerdProvider) NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, stderr io.Writer) error {
+	f, err := os.Open(cp.logPath(containerName(node)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if tail >= 0 {
+		lines := slices.Collect(strings.Lines(string(data)))
+		data = []byte(strings.Join(lines[max(len(lines)-tail, 0):], ""))
+	}
+	if _, err := stdout.Write(data); err != nil {
+		return err
+	}
+	for follow {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(readyInterval):
+		}
+		if _, err := io.Copy(stdout, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taskMetrics is the part of the metrics of a task reported by ctr tasks metrics which golab uses, for cgroup
+// v2 hosts along with their cgroup v1 counterparts.
+type taskMetrics struct {
+	CPU struct {
+		UsageUsec uint64 `json:"usage_usec"`
+		Usage     struct {
+			Total uint64 `json:"total"`
+		} `json:"usage"`
+	} `json:"cpu"`
+	Memory struct {
+		Usage        json.RawMessage `json:"usage"`
+		UsageLimit   uint64          `json:"usage_limit"`
+		InactiveFile uint64          `json:"inactive_file"`
+		// cgroup v1 reports the usage and limit as an object
+		TotalInactiveFile uint64 `json:"total_inactive_file"`
+	} `json:"memory"`
+}
+
+// cpuTime returns the CPU time the task used so far.
+func (m taskMetrics) cpuTime() time.Duration {
+	if m.CPU.UsageUsec != 0 {
+		return time.Duration(m.CPU.UsageUsec) * time.Microsecond
+	}
+	return time.Duration(m.CPU.Usage.Total)
+}
+
+// memory returns the memory usage of the task excluding the page cache like docker stats does, along with its
+// limit. The cache is sampled separately from the usage, so it may exceed the usage, which is reported as no
+// usage at all.
+func (m taskMetrics) memory() (uint64, uint64) {
+	var usage, limit, cache uint64
+	var v1 struct {
+		Usage uint64 `json:"usage"`
+		Limit uint64 `json:"limit"`
+	}
+	if err := json.Unmarshal(m.Memory.Usage, &v1); err == nil {
+		usage, limit, cache = v1.Usage, v1.Limit, m.Memory.TotalInactiveFile
+	} else {
+		json.Unmarshal(m.Memory.Usage, &usage)
+		limit, cache = m.Memory.UsageLimit, m.Memory.InactiveFile
+	}
+	if cache > usage {
+		return 0, limit
+	}
+	return usage - cache, limit
+}
+
+// metrics samples the metrics of the task of the container with the name.
+func (cp *ContainerdProvider) metrics(ctx context.Context, name string) (taskMetrics, error) {
+	var m taskMetrics
+	out, err := cp.ctr(ctx, "tasks", "metrics", "--format", "json", name)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(out, &m); err != nil {
+		return m, fmt.Errorf("failed to decode metrics of containerd container %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// NodeStats collects resource usage of the containerd container representing the provided topology.Node. CPU
+// usage is calculated from two samples like docker stats does, while traffic counters are read from the
+// interfaces in the network namespace of the node.
+func (cp *ContainerdProvider) NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error) {
+	name := containerName(node)
+	first, err := cp.metrics(ctx, name)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return topology.NodeStats{}, ctx.Err()
+	case <-time.After(statsInterval):
+	}
+	second, err := cp.metrics(ctx, name)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	var nodeStats topology.NodeStats
+	if cpuDelta := second.cpuTime() - first.cpuTime(); cpuDelta > 0 {
+		nodeStats.CPUPercent = float64(cpuDelta) / float64(time.Since(start)) * 100
+	}
+	nodeStats.MemUsage, nodeStats.MemLimit = second.memory()
+	links, err := cp.links(ctx, node)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	slices.SortFunc(links, func(a, b ipLink) int { return strings.Compare(a.Name, b.Name) })
+	for _, link := range links {
+		if link.Name == "lo" {
+			continue
+		}
+		rx, tx := link.Stats64.RX, link.Stats64.TX
+		nodeStats.RxBytes += rx.Bytes
+		nodeStats.TxBytes += tx.Bytes
+		nodeStats.RxPackets += rx.Packets
+		nodeStats.TxPackets += tx.Packets
+		nodeStats.Interfaces = append(nodeStats.Interfaces, topology.InterfaceStats{
+			Name:      link.Name,
+			RxBytes:   rx.Bytes,
+			TxBytes:   tx.Bytes,
+			RxPackets: rx.Packets,
+			TxPackets: tx.Packets,
+			RxErrors:  rx.Errors,
+			TxErrors:  tx.Errors,
+			RxDropped: rx.Dropped,
+			TxDropped: tx.Dropped,
+		})
+	}
+	return nodeStats, nil
+}
+
+// labFilter matches containerd objects owned by the provided lab or by any lab if it is empty.
+func labFilter(lab string) string {
+	if lab == "" {
+		return fmt.Sprintf("labels.%q", topology.LabLabel)
+	}
+	return fmt.Sprintf("labels.%q==%s", topology.LabLabel, lab)
+}
+
+// inLab tells whether the labels mark an object owned by the provided lab or by any lab if it is empty.
+func inLab(labels map[string]string, lab string) bool {
+	owner, ok := labels[topology.LabLabel]
+	return ok && (lab == "" || owner == lab)
+}
+
+// labContainers lists the names of the containers owned by the provided lab, or by any lab if it is empty,
+// along with the records of containers whose creation did not get as far as containerd.
+func (cp *ContainerdProvider) labContainers(ctx context.Context, lab string) (map[string]*containerInfo, map[string]*container, error) {
+	out, err := cp.ctr(ctx, "containers", "ls", "--quiet", labFilter(lab))
+	if err != nil {
+		return nil, nil, err
+	}
+	infos := make(map[string]*containerInfo)
+	for _, name := range strings.Fields(string(out)) {
+		info, err := cp.findContainer(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if info != nil {
+			infos[name] = info
+		}
+	}
+	paths, err := filepath.Glob(filepath.Join(cp.stateDir, "containers", "*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	recs := make(map[string]*container)
+	for _, path := range paths {
+		rec, err := cp.readContainer(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, nil, err
+		}
+		if inLab(rec.Labels, lab) {
+			recs[rec.Name] = rec
+		}
+	}
+	return infos, recs, nil
+}
+
+// RemoveOrphans removes all containers and networks labeled as owned by the provided lab, or by any lab
+// if it is empty. Unlike Wreck, it does not depend on the topology file, which may have changed since.
+func (cp *ContainerdProvider) RemoveOrphans(ctx context.Context, lab string) error {
+	infos, recs, err := cp.labContainers(ctx, lab)
+	if err != nil {
+		return err
+	}
+	names := slices.Sorted(maps.Keys(infos))
+	for _, name := range slices.Sorted(maps.Keys(recs)) {
+		if infos[name] == nil {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if err := cp.remove(ctx, name, infos[name] != nil, recs[name]); err != nil {
+			return err
+		}
+		labels := recs[name].labels()
+		if info := infos[name]; info != nil {
+			labels = info.Labels
+		}
+		cp.log.With(name).Success(fmt.Sprintf("removed containerd container %s of lab %s", name, labels[topology.LabLabel]))
+	}
+	nets, err := cp.networks()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, net := range nets {
+		if !inLab(net.Labels, lab) {
+			continue
+		}
+		if err := cp.removeNetwork(ctx, net); err != nil {
+			return err
+		}
+		removed++
+		cp.log.With(net.Config.Name).Success(fmt.Sprintf("removed cni network %s of lab %s", net.Config.Name, net.Labels[topology.LabLabel]))
+	}
+	if len(names) == 0 && removed == 0 {
+		cp.log.Skipped("found no leftover containerd objects")
+	}
+	return nil
+}
+
+// labels returns the labels of the record, which may be missing.
+func (rec *container) labels() map[string]string {
+	if rec == nil {
+		return nil
+	}
+	return rec.Labels
+}
+
+// Deployed reports containers and networks labeled as owned by the provided lab, translated
+// back into topology entities with the attributes recorded when they were created.
+func (cp *ContainerdProvider) Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	infos, recs, err := cp.labContainers(ctx, lab)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes := make([]topology.Node, 0, len(infos))
+	for _, name := range slices.Sorted(maps.Keys(infos)) {
+		info := infos[name]
+		node := topology.Node{
+			Name:   topologyName(name, info.Labels),
+			Image:  info.Image,
+			Labels: unmanaged(info.Labels),
+		}
+		if rec := recs[name]; rec != nil {
+			for _, iface := range rec.Interfaces {
+				node.Interfaces = append(node.Interfaces, &topology.Interface{Link: iface.Link, IPv4Addr: strings.Split(iface.IPv4Addr, "/")[0]})
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	nets, err := cp.networks()
+	if err != nil {
+		return nil, nil, err
+	}
+	links := make([]topology.Link, 0, len(nets))
+	for _, net := range nets {
+		if !inLab(net.Labels, lab) {
+			continue
+		}
+		links = append(links, topology.Link{
+			Name:       net.Name,
+			Labels:     unmanaged(net.Labels),
+			MTU:        net.MTU,
+			IPv4Subnet: net.IPv4Subnet,
+			IPv6Subnet: net.IPv6Subnet,
+		})
+	}
+	return nodes, links, nil
+}
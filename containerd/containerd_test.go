@@ -0,0 +1,569 @@
+package containerd_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elupevg/golab/containerd"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+const cniPath = "/opt/cni/bin"
+
+type fakeResult struct {
+	stdout   string
+	exitCode int
+}
+
+// fakeRunner records the commands it is given and answers them with the queued results, the last of which
+// keeps answering. Commands without results succeed without output.
+type fakeRunner struct {
+	mu       sync.Mutex
+	results  map[string][]fakeResult
+	commands []string
+	stdins   []string
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{results: make(map[string][]fakeResult)}
+}
+
+func (r *fakeRunner) on(command string, results ...fakeResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[command] = results
+}
+
+func (r *fakeRunner) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands, r.stdins = nil, nil
+}
+
+func (r *fakeRunner) Run(ctx context.Context, cmd containerd.Command) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	line := strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")
+	switch {
+	case cmd.Name == "ctr" && !slices.Contains(cmd.Env, "CONTAINERD_NAMESPACE=golab"):
+		return 0, errors.New("ctr run outside of the golab namespace")
+	// CNI plugins are told what to do by their environment
+	case strings.HasPrefix(cmd.Name, cniPath+"/"):
+		env := make(map[string]string)
+		for _, variable := range cmd.Env {
+			key, value, _ := strings.Cut(variable, "=")
+			env[key] = value
+		}
+		if env["CNI_PATH"] != cniPath {
+			return 0, fmt.Errorf("cni plugin run with CNI_PATH=%s", env["CNI_PATH"])
+		}
+		line = strings.Join([]string{filepath.Base(cmd.Name), env["CNI_COMMAND"], env["CNI_CONTAINERID"], env["CNI_NETNS"], env["CNI_IFNAME"]}, " ")
+		stdin, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return 0, err
+		}
+		r.stdins = append(r.stdins, string(stdin))
+	}
+	r.commands = append(r.commands, line)
+	results := r.results[line]
+	if len(results) == 0 {
+		return 0, nil
+	}
+	result := results[0]
+	if len(results) > 1 {
+		r.results[line] = results[1:]
+	}
+	if cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, result.stdout)
+	}
+	if result.exitCode != 0 && cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, "ctr: "+result.stdout)
+	}
+	return result.exitCode, nil
+}
+
+func newProvider(t *testing.T) (*containerd.ContainerdProvider, *fakeRunner, string) {
+	t.Helper()
+	runner, dir := newFakeRunner(), t.TempDir()
+	return containerd.New(runner, dir, cniPath, logger.New(io.Discard, io.Discard)), runner, dir
+}
+
+var (
+	labLabels = map[string]string{topology.LabLabel: "lab1"}
+	testLink  = topology.Link{
+		Name:        "link-01",
+		Endpoints:   []string{"R1", "R2"},
+		IPv4Subnet:  "10.0.0.0/24",
+		IPv4Gateway: "10.0.0.254",
+		Labels:      labLabels,
+	}
+)
+
+func testNode() topology.Node {
+	return topology.Node{
+		Name:         "R1",
+		Image:        "frrouting/frr:v8",
+		Labels:       labLabels,
+		Env:          map[string]string{"A": "1"},
+		Capabilities: []string{"NET_ADMIN"},
+		CPUs:         1.5,
+		Memory:       "512m",
+		Binds:        []string{"/tmp/r1:/etc/frr"},
+		Sysctls:      map[string]string{"net.ipv4.ip_forward": "1"},
+		StopTimeout:  "0s",
+		Interfaces: []*topology.Interface{{
+			Name:       "eth1",
+			Link:       "link-01",
+			IPv4Addr:   "10.0.0.1/24",
+			DriverOpts: map[string]string{"com.docker.network.endpoint.sysctls": "net.ipv4.conf.IFNAME.rp_filter=0"},
+		}},
+	}
+}
+
+const (
+	noTasks = "TASK    PID    STATUS\n"
+	running = noTasks + "lab1-R1    4242    RUNNING\n"
+	stopped = noTasks + "lab1-R1    4242    STOPPED\n"
+)
+
+// createNode creates the link and the node of the tests, leaving the runner with no recorded commands.
+func createNode(t *testing.T, provider *containerd.ContainerdProvider, runner *fakeRunner) {
+	t.Helper()
+	runner.on("ip -n golab-lab1-R1 link show dev lo", fakeResult{exitCode: 1})
+	runner.on("ctr tasks ls", fakeResult{stdout: noTasks}, fakeResult{stdout: running})
+	if err := provider.LinkCreate(context.Background(), testLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.NodeCreate(context.Background(), testNode()); err != nil {
+		t.Fatal(err)
+	}
+	runner.reset()
+	runner.on("ip -n golab-lab1-R1 link show dev lo")
+	runner.on("ctr containers ls --quiet id==lab1-R1", fakeResult{stdout: "lab1-R1\n"})
+	runner.on("ctr containers info lab1-R1", fakeResult{stdout: `{"ID": "lab1-R1", "Labels": {"golab.lab": "lab1", "golab.managed": "true"}, "Image": "docker.io/frrouting/frr:v8"}`})
+}
+
+func TestNodeCreate(t *testing.T) {
+	t.Parallel()
+	provider, runner, dir := newProvider(t)
+	runner.on("ip -n golab-lab1-R1 link show dev lo", fakeResult{exitCode: 1})
+	runner.on("ctr tasks ls", fakeResult{stdout: noTasks}, fakeResult{stdout: running})
+	if err := provider.LinkCreate(context.Background(), testLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.NodeCreate(context.Background(), testNode()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ctr containers ls --quiet id==lab1-R1",
+		"ip -n golab-lab1-R1 link show dev lo",
+		"ip netns add golab-lab1-R1",
+		"ip -n golab-lab1-R1 link set dev lo up",
+		"ip netns exec golab-lab1-R1 sysctl -w net/ipv4/ip_forward=1",
+		"bridge ADD lab1-R1 /var/run/netns/golab-lab1-R1 eth1",
+		"ip netns exec golab-lab1-R1 sysctl -w net/ipv4/conf/eth1/rp_filter=0",
+		"ctr images ls --quiet name==docker.io/frrouting/frr:v8",
+		"ctr images pull docker.io/frrouting/frr:v8",
+		"ctr containers create --label golab.lab=lab1 --label golab.managed=true --env A=1 --hostname R1 " +
+			"--with-ns network:/var/run/netns/golab-lab1-R1 --cap-add CAP_NET_ADMIN --cpus 1.5 --memory-limit 536870912 " +
+			"--mount type=bind,src=/tmp/r1,dst=/etc/frr,options=rbind:rw docker.io/frrouting/frr:v8 lab1-R1",
+		"ctr tasks ls",
+		"ctr tasks start --detach --log-uri file://" + filepath.Join(dir, "logs", "lab1-R1.log") + " lab1-R1",
+		"ctr tasks ls",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(runner.stdins[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	wantConf := map[string]any{
+		"cniVersion": "1.0.0",
+		"name":       "lab1-link-01",
+		"type":       "bridge",
+		"bridge":     "gl-lab1-link-01",
+		"isGateway":  true,
+		"ipam": map[string]any{
+			"type":      "static",
+			"addresses": []any{map[string]any{"address": "10.0.0.1/24", "gateway": "10.0.0.254"}},
+		},
+	}
+	if diff := cmp.Diff(wantConf, got); diff != "" {
+		t.Errorf("cni configuration mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeCreateSharedNamespaces(t *testing.T) {
+	t.Parallel()
+	provider, runner, dir := newProvider(t)
+	runner.on("ctr tasks ls", fakeResult{stdout: running + "lab1-R1-ssh    4343    RUNNING\n"})
+	runner.on("ctr images ls --quiet name==docker.io/library/ssh:latest", fakeResult{stdout: "docker.io/library/ssh:latest\n"})
+	sidecar := topology.Node{
+		Name:        "R1-ssh",
+		Image:       "ssh",
+		Labels:      labLabels,
+		NetworkMode: "container:R1",
+		PIDMode:     "container:R1",
+	}
+	if err := provider.NodeCreate(context.Background(), sidecar); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ctr containers ls --quiet id==lab1-R1-ssh",
+		"ctr tasks ls",
+		"ctr images ls --quiet name==docker.io/library/ssh:latest",
+		"ctr containers create --label golab.lab=lab1 --label golab.managed=true " +
+			"--with-ns network:/var/run/netns/golab-lab1-R1 --with-ns pid:/proc/4242/ns/pid docker.io/library/ssh:latest lab1-R1-ssh",
+		"ctr tasks ls",
+		"ctr tasks delete --force lab1-R1-ssh",
+		"ctr tasks start --detach --log-uri file://" + filepath.Join(dir, "logs", "lab1-R1-ssh.log") + " lab1-R1-ssh",
+		"ctr tasks ls",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeCreateUnsupported(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		node   topology.Node
+		errMsg string
+	}{
+		{
+			name:   "Ports",
+			node:   topology.Node{Name: "R1", Ports: []string{"8080:80"}},
+			errMsg: "node R1 sets ports, which is not supported by the containerd provider",
+		},
+		{
+			name:   "Volumes",
+			node:   topology.Node{Name: "R1", Volumes: []string{"data:/data"}},
+			errMsg: "node R1 sets volumes, which is not supported by the containerd provider",
+		},
+		{
+			name:   "Sysctls",
+			node:   topology.Node{Name: "R1", Sysctls: map[string]string{"net.ipv4.ip_forward": "1", "kernel.pid_max": "4096"}},
+			errMsg: "node R1 sets sysctl kernel.pid_max, which is not supported by the containerd provider",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			provider, runner, _ := newProvider(t)
+			if err := provider.NodeCreate(context.Background(), tc.node); err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+			if len(runner.commands) != 0 {
+				t.Errorf("want no commands, got %q", runner.commands)
+			}
+		})
+	}
+}
+
+func TestNodeCreateCrashed(t *testing.T) {
+	t.Parallel()
+	provider, runner, dir := newProvider(t)
+	runner.on("ip -n golab-lab1-R1 link show dev lo", fakeResult{exitCode: 1})
+	runner.on("ctr tasks ls", fakeResult{stdout: noTasks}, fakeResult{stdout: stopped})
+	runner.on("ctr tasks delete lab1-R1", fakeResult{exitCode: 137})
+	if err := provider.LinkCreate(context.Background(), testLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "logs", "lab1-R1.log"), []byte("booting\npanic\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	errMsg := "containerd container lab1-R1 exited with code 137 while starting"
+	if err := provider.NodeCreate(context.Background(), testNode()); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestNodeRemove(t *testing.T) {
+	t.Parallel()
+	provider, runner, dir := newProvider(t)
+	createNode(t, provider, runner)
+	runner.on("ctr tasks ls", fakeResult{stdout: running}, fakeResult{stdout: noTasks})
+	if err := provider.NodeRemove(context.Background(), testNode()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ctr containers ls --quiet id==lab1-R1",
+		"ctr containers info lab1-R1",
+		"ctr tasks ls",
+		"ctr tasks kill --signal SIGTERM lab1-R1",
+		"ctr tasks delete --force lab1-R1",
+		"ctr tasks ls",
+		"ctr containers delete lab1-R1",
+		"bridge DEL lab1-R1 /var/run/netns/golab-lab1-R1 eth1",
+		"ip -n golab-lab1-R1 link show dev lo",
+		"ip netns delete golab-lab1-R1",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "containers", "lab1-R1.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("container record: want removed, got %v", err)
+	}
+}
+
+func TestNodeRemoveNotOwned(t *testing.T) {
+	t.Parallel()
+	provider, runner, _ := newProvider(t)
+	runner.on("ctr containers ls --quiet id==lab1-R1", fakeResult{stdout: "lab1-R1\n"})
+	runner.on("ctr containers info lab1-R1", fakeResult{stdout: `{"ID": "lab1-R1", "Labels": {}}`})
+	errMsg := "refusing to remove containerd container lab1-R1, which golab did not create for this lab"
+	if err := provider.NodeRemove(context.Background(), testNode()); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestNodeStopStart(t *testing.T) {
+	t.Parallel()
+	provider, runner, dir := newProvider(t)
+	createNode(t, provider, runner)
+	links := `[{"ifname": "lo"}, {"ifname": "eth1"}]`
+	runner.on("ip -n golab-lab1-R1 -s -json link show", fakeResult{stdout: links})
+	runner.on("ctr tasks ls", fakeResult{stdout: running})
+	if err := provider.NodeStop(context.Background(), testNode()); err != nil {
+		t.Fatal(err)
+	}
+	runner.on("ctr tasks ls", fakeResult{stdout: noTasks}, fakeResult{stdout: noTasks}, fakeResult{stdout: running})
+	if err := provider.NodeStart(context.Background(), testNode()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ctr tasks ls",
+		"ctr tasks ls",
+		"ctr tasks kill --signal SIGTERM lab1-R1",
+		"ctr tasks delete --force lab1-R1",
+		"ip -n golab-lab1-R1 -s -json link show",
+		"ip -n golab-lab1-R1 link set dev eth1 down",
+		"ctr tasks ls",
+		"ip -n golab-lab1-R1 -s -json link show",
+		"ip -n golab-lab1-R1 link set dev eth1 up",
+		"ctr tasks ls",
+		"ctr tasks start --detach --log-uri file://" + filepath.Join(dir, "logs", "lab1-R1.log") + " lab1-R1",
+		"ctr tasks ls",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkCreateUnsupported(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		link   topology.Link
+		errMsg string
+	}{
+		{
+			name:   "DriverOpts",
+			link:   topology.Link{Name: "link-01", DriverOpts: map[string]string{"com.docker.network.bridge.enable_icc": "false"}},
+			errMsg: "link link-01: driver option com.docker.network.bridge.enable_icc is not supported by the containerd provider",
+		},
+		{
+			name:   "MacvlanWithoutHostInterface",
+			link:   topology.Link{Name: "link-01", Driver: topology.DriverMacvlan},
+			errMsg: "link link-01: macvlan links require a host interface with the containerd provider",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			provider, _, _ := newProvider(t)
+			if err := provider.LinkCreate(context.Background(), tc.link); err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestLinkConnectCNIError(t *testing.T) {
+	t.Parallel()
+	provider, runner, _ := newProvider(t)
+	createNode(t, provider, runner)
+	if err := provider.LinkDisconnect(context.Background(), testLink, []topology.Node{testNode()}); err != nil {
+		t.Fatal(err)
+	}
+	runner.on("bridge ADD lab1-R1 /var/run/netns/golab-lab1-R1 eth1", fakeResult{
+		stdout:   `{"code": 11, "msg": "failed to set bridge addr", "details": "could not add IP address"}`,
+		exitCode: 1,
+	})
+	errMsg := "cni plugin bridge failed to attach interface eth1 of containerd container lab1-R1: failed to set bridge addr: could not add IP address"
+	if err := provider.LinkConnect(context.Background(), testLink, []topology.Node{testNode()}); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestLinkConnectVeth(t *testing.T) {
+	t.Parallel()
+	provider, runner, _ := newProvider(t)
+	link := topology.Link{Name: "link-02", Endpoints: []string{"R1", "R2"}, MTU: 9000, Type: topology.LinkTypeVeth, Labels: labLabels}
+	nodes := []topology.Node{
+		{Name: "R1", Labels: labLabels, Interfaces: []*topology.Interface{{Name: "eth2", Link: "link-02", IPv4Addr: "10.0.1.1/31", Veth: true}}},
+		{Name: "R2", Labels: labLabels, Interfaces: []*topology.Interface{{Name: "eth3", Link: "link-02", IPv6Addr: "fd00::1/127", Veth: true}}},
+	}
+	runner.on("ip -n golab-lab1-R1 link show dev eth2", fakeResult{exitCode: 1}, fakeResult{})
+	for range 2 {
+		if err := provider.LinkConnect(context.Background(), link, nodes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"ip -n golab-lab1-R1 link show dev eth2",
+		"ip link add eth2 netns golab-lab1-R1 mtu 9000 type veth peer name eth3 netns golab-lab1-R2",
+		"ip -n golab-lab1-R1 addr replace 10.0.1.1/31 dev eth2",
+		"ip -n golab-lab1-R1 link set dev eth2 up",
+		"ip -n golab-lab1-R2 addr replace fd00::1/127 dev eth3",
+		"ip -n golab-lab1-R2 link set dev eth3 up",
+		// the pair exists already
+		"ip -n golab-lab1-R1 link show dev eth2",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		metrics []fakeResult
+	}{
+		{
+			name: "CgroupV2",
+			metrics: []fakeResult{
+				{stdout: `{"cpu": {"usage_usec": 1000000}, "memory": {"usage": 300, "usage_limit": 1000, "inactive_file": 100}}`},
+				{stdout: `{"cpu": {"usage_usec": 1250000}, "memory": {"usage": 300, "usage_limit": 1000, "inactive_file": 100}}`},
+			},
+		},
+		{
+			name: "CgroupV1",
+			metrics: []fakeResult{
+				{stdout: `{"cpu": {"usage": {"total": 1000000000}}, "memory": {"usage": {"usage": 300, "limit": 1000}, "total_inactive_file": 100}}`},
+				{stdout: `{"cpu": {"usage": {"total": 1250000000}}, "memory": {"usage": {"usage": 300, "limit": 1000}, "total_inactive_file": 100}}`},
+			},
+		},
+	}
+	links := `[
+		{"ifname": "lo", "stats64": {"rx": {"bytes": 1, "packets": 1}, "tx": {"bytes": 1, "packets": 1}}},
+		{"ifname": "eth1", "stats64": {"rx": {"bytes": 100, "packets": 2, "errors": 1}, "tx": {"bytes": 200, "packets": 3, "dropped": 2}}},
+		{"ifname": "eth0", "stats64": {"rx": {"bytes": 10, "packets": 1}, "tx": {"bytes": 20, "packets": 1}}}
+	]`
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			provider, runner, _ := newProvider(t)
+			runner.on("ctr tasks metrics --format json lab1-R1", tc.metrics...)
+			runner.on("ip -n golab-lab1-R1 -s -json link show", fakeResult{stdout: links})
+			got, err := provider.NodeStats(context.Background(), testNode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 250ms of CPU time were used over at least the interval between the samples
+			if got.CPUPercent <= 0 || got.CPUPercent > 50 {
+				t.Errorf("CPU percent: want (0, 50], got %v", got.CPUPercent)
+			}
+			got.CPUPercent = 0
+			want := topology.NodeStats{
+				MemUsage:  200,
+				MemLimit:  1000,
+				RxBytes:   110,
+				TxBytes:   220,
+				RxPackets: 3,
+				TxPackets: 4,
+				Interfaces: []topology.InterfaceStats{
+					{Name: "eth0", RxBytes: 10, TxBytes: 20, RxPackets: 1, TxPackets: 1},
+					{Name: "eth1", RxBytes: 100, TxBytes: 200, RxPackets: 2, TxPackets: 3, RxErrors: 1, TxDropped: 2},
+				},
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("stats mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNodeLogs(t *testing.T) {
+	t.Parallel()
+	provider, _, dir := newProvider(t)
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "logs", "lab1-R1.log"), []byte("one\ntwo\nthree\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := provider.NodeLogs(context.Background(), testNode(), false, 2, &out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "two\nthree\n"; got != want {
+		t.Errorf("logs: want %q, got %q", want, got)
+	}
+}
+
+func TestDeployedAndRemoveOrphans(t *testing.T) {
+	t.Parallel()
+	provider, runner, dir := newProvider(t)
+	createNode(t, provider, runner)
+	runner.on(`ctr containers ls --quiet labels."golab.lab"==lab1`, fakeResult{stdout: "lab1-R1\n"})
+	nodes, links, err := provider.Deployed(context.Background(), "lab1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNodes := []topology.Node{{
+		Name:       "R1",
+		Image:      "docker.io/frrouting/frr:v8",
+		Labels:     labLabels,
+		Interfaces: []*topology.Interface{{Link: "link-01", IPv4Addr: "10.0.0.1"}},
+	}}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("nodes mismatch (-want +got):\n%s", diff)
+	}
+	wantLinks := []topology.Link{{Name: "link-01", IPv4Subnet: "10.0.0.0/24", Labels: labLabels}}
+	if diff := cmp.Diff(wantLinks, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	runner.reset()
+	runner.on("ctr tasks ls", fakeResult{stdout: noTasks})
+	if err := provider.RemoveOrphans(context.Background(), "lab1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`ctr containers ls --quiet labels."golab.lab"==lab1`,
+		"ctr containers ls --quiet id==lab1-R1",
+		"ctr containers info lab1-R1",
+		"ctr tasks ls",
+		"ctr containers delete lab1-R1",
+		"bridge DEL lab1-R1 /var/run/netns/golab-lab1-R1 eth1",
+		"ip -n golab-lab1-R1 link show dev lo",
+		"ip netns delete golab-lab1-R1",
+		"ip link show dev gl-lab1-link-01",
+		"ip link delete dev gl-lab1-link-01",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	for _, path := range []string{"containers/lab1-R1.json", "networks/lab1-link-01.json"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: want removed, got %v", path, err)
+		}
+	}
+}
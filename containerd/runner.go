@@ -0,0 +1,82 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Command is a program run on the host, e.g. ctr, ip or a CNI plugin.
+type Command struct {
+	Name   string
+	Args   []string
+	Env    []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner runs commands on the host.
+type Runner interface {
+	// Run runs the command to completion and returns its exit code, with an error only if it could not be run.
+	Run(ctx context.Context, cmd Command) (int, error)
+}
+
+// HostRunner runs commands as processes of golab, which inherit its environment, e.g. CONTAINERD_ADDRESS.
+type HostRunner struct{}
+
+// Run runs the command as a child process, which is killed when the context is canceled.
+func (HostRunner) Run(ctx context.Context, cmd Command) (int, error) {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	if cmd.Env != nil {
+		c.Env = append(c.Environ(), cmd.Env...)
+	}
+	c.Stdin, c.Stdout, c.Stderr = cmd.Stdin, cmd.Stdout, cmd.Stderr
+	err := c.Run()
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// output runs the command and returns its output, failing with its error output unless it succeeds.
+func (cp *ContainerdProvider) output(ctx context.Context, cmd Command) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	exitCode, err := cp.runner.Run(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", cmd.Name, err)
+	}
+	if exitCode != 0 {
+		// ctr prefixes its errors with its name already
+		msg := strings.TrimPrefix(strings.TrimSpace(stderr.String()), cmd.Name+": ")
+		if msg == "" {
+			msg = fmt.Sprintf("exited with code %d", exitCode)
+		}
+		return nil, fmt.Errorf("%s: %s", cmd.Name, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// ctr runs the containerd client in the namespace of golab and returns its output.
+func (cp *ContainerdProvider) ctr(ctx context.Context, args ...string) ([]byte, error) {
+	return cp.output(ctx, Command{Name: "ctr", Args: args, Env: []string{"CONTAINERD_NAMESPACE=" + namespace}})
+}
+
+// ip runs iproute2 on the host and returns its output.
+func (cp *ContainerdProvider) ip(ctx context.Context, args ...string) ([]byte, error) {
+	return cp.output(ctx, Command{Name: "ip", Args: args})
+}
+
+// succeeds runs iproute2 on the host and tells whether it exits with zero, e.g. to check that an object exists.
+func (cp *ContainerdProvider) succeeds(ctx context.Context, args ...string) (bool, error) {
+	exitCode, err := cp.runner.Run(ctx, Command{Name: "ip", Args: args, Stdout: io.Discard, Stderr: io.Discard})
+	if err != nil {
+		return false, fmt.Errorf("failed to run ip: %w", err)
+	}
+	return exitCode == 0, nil
+}
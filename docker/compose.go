@@ -0,0 +1,211 @@
+package docker
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/elupevg/golab/topology"
+	"github.com/goccy/go-yaml"
+)
+
+// composeFile represents a Compose file deploying a lab, see https://docs.docker.com/reference/compose-file/.
+type composeFile struct {
+	Name     string                     `yaml:"name"`
+	Services map[string]*composeService `yaml:"services"`
+	Networks map[string]*composeNetwork `yaml:"networks,omitempty"`
+}
+
+// composeService represents the container of a node in a Compose file.
+type composeService struct {
+	ContainerName   string                        `yaml:"container_name"`
+	Hostname        string                        `yaml:"hostname,omitempty"`
+	Image           string                        `yaml:"image"`
+	Entrypoint      []string                      `yaml:"entrypoint,omitempty"`
+	Command         []string                      `yaml:"command,omitempty"`
+	Environment     map[string]string             `yaml:"environment,omitempty"`
+	Labels          map[string]string             `yaml:"labels"`
+	Restart         string                        `yaml:"restart,omitempty"`
+	Init            bool                          `yaml:"init"`
+	Privileged      bool                          `yaml:"privileged,omitempty"`
+	CapAdd          []string                      `yaml:"cap_add,omitempty"`
+	CapDrop         []string                      `yaml:"cap_drop,omitempty"`
+	Sysctls         map[string]string             `yaml:"sysctls,omitempty"`
+	Devices         []string                      `yaml:"devices,omitempty"`
+	CPUs            float64                       `yaml:"cpus,omitempty"`
+	MemLimit        string                        `yaml:"mem_limit,omitempty"`
+	Volumes         []string                      `yaml:"volumes,omitempty"`
+	Tmpfs           []string                      `yaml:"tmpfs,omitempty"`
+	Ports           []string                      `yaml:"ports,omitempty"`
+	DNSSearch       []string                      `yaml:"dns_search,omitempty"`
+	StopGracePeriod string                        `yaml:"stop_grace_period"`
+	NetworkMode     string                        `yaml:"network_mode,omitempty"`
+	PID             string                        `yaml:"pid,omitempty"`
+	DependsOn       []string                      `yaml:"depends_on,omitempty"`
+	Networks        map[string]*composeAttachment `yaml:"networks,omitempty"`
+}
+
+// composeAttachment represents an interface of a node on the network of a link in a Compose file.
+type composeAttachment struct {
+	IPv4Address string            `yaml:"ipv4_address,omitempty"`
+	IPv6Address string            `yaml:"ipv6_address,omitempty"`
+	Aliases     []string          `yaml:"aliases,omitempty"`
+	DriverOpts  map[string]string `yaml:"driver_opts,omitempty"`
+}
+
+// composeNetwork represents the network of a link in a Compose file.
+type composeNetwork struct {
+	Name       string            `yaml:"name"`
+	Driver     string            `yaml:"driver,omitempty"`
+	DriverOpts map[string]string `yaml:"driver_opts,omitempty"`
+	Internal   bool              `yaml:"internal,omitempty"`
+	EnableIPv4 *bool             `yaml:"enable_ipv4,omitempty"`
+	EnableIPv6 bool              `yaml:"enable_ipv6,omitempty"`
+	IPAM       *composeIPAM      `yaml:"ipam,omitempty"`
+	Labels     map[string]string `yaml:"labels"`
+}
+
+// composeIPAM represents the subnets of a network in a Compose file.
+type composeIPAM struct {
+	Config []composeSubnet `yaml:"config"`
+}
+
+type composeSubnet struct {
+	Subnet  string `yaml:"subnet"`
+	Gateway string `yaml:"gateway,omitempty"`
+}
+
+// composeEscape keeps Compose from interpolating variables in values passed to containers verbatim.
+func composeEscape(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	escaped := make([]string, 0, len(values))
+	for _, value := range values {
+		escaped = append(escaped, strings.ReplaceAll(value, "$", "$$"))
+	}
+	return escaped
+}
+
+// Compose writes a Compose file creating the containers and networks the Docker provider would create for the
+// topology, with the same names, labels and static addresses, so that labs deployed with docker compose up can
+// be inspected and wrecked by golab. Whatever golab sets up inside running nodes is beyond the file.
+func Compose(topo *topology.Topology, out io.Writer) error {
+	file := composeFile{
+		// project names are restricted to lowercase letters, digits, dashes and underscores
+		Name:     strings.ToLower(strings.ReplaceAll(topo.Name, ".", "-")),
+		Services: make(map[string]*composeService),
+		Networks: make(map[string]*composeNetwork),
+	}
+	links := slices.Clone(topo.Links)
+	if topo.Mgmt != nil {
+		links = append(links, topo.Mgmt)
+	}
+	for _, link := range links {
+		if link.Veth() || link.Tagged() {
+			continue
+		}
+		file.Networks[link.Name] = composeLink(*link)
+	}
+	nodes := slices.Clone(topo.Services)
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		nodes = append(nodes, topo.Nodes[name])
+		nodes = append(nodes, topo.Nodes[name].Sidecars...)
+	}
+	for _, node := range nodes {
+		file.Services[node.Name] = composeNode(*node)
+	}
+	enc := yaml.NewEncoder(out, yaml.IndentSequence(true))
+	if err := enc.Encode(file); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// composeLink converts the link into a network like LinkCreate does.
+func composeLink(link topology.Link) *composeNetwork {
+	network := &composeNetwork{
+		Name:       networkName(link),
+		Internal:   !link.External,
+		EnableIPv6: link.IPv6Subnet != "",
+		Labels:     managed(link.Labels),
+	}
+	network.Driver, network.DriverOpts = networkDriver(link)
+	if link.IPv4Subnet == "" {
+		enableIPv4 := false
+		network.EnableIPv4 = &enableIPv4
+	}
+	ipam := new(composeIPAM)
+	if link.IPv4Subnet != "" {
+		ipam.Config = append(ipam.Config, composeSubnet{Subnet: link.IPv4Subnet, Gateway: link.IPv4Gateway})
+	}
+	if link.IPv6Subnet != "" {
+		ipam.Config = append(ipam.Config, composeSubnet{Subnet: link.IPv6Subnet, Gateway: link.IPv6Gateway})
+	}
+	if len(ipam.Config) != 0 {
+		network.IPAM = ipam
+	}
+	return network
+}
+
+// composeNode converts the node into a service like NodeCreate does.
+func composeNode(node topology.Node) *composeService {
+	service := &composeService{
+		ContainerName:   containerName(node),
+		Hostname:        node.Name,
+		Image:           node.Image,
+		Entrypoint:      composeEscape(node.Entrypoint),
+		Command:         composeEscape(node.Cmd),
+		Labels:          managed(node.Labels),
+		Restart:         node.Restart,
+		Init:            true,
+		Privileged:      node.Privileged,
+		CapAdd:          node.Capabilities,
+		CapDrop:         node.CapDrop,
+		Sysctls:         node.Sysctls,
+		CPUs:            node.CPUs,
+		MemLimit:        node.Memory,
+		Volumes:         append(slices.Clone(node.Binds), node.Volumes...),
+		Tmpfs:           node.Tmpfs,
+		Ports:           node.Ports,
+		DependsOn:       node.DependsOn,
+		StopGracePeriod: strconv.Itoa(stopTimeout(node)) + "s",
+	}
+	if len(node.Env) != 0 {
+		service.Environment = make(map[string]string, len(node.Env))
+		for key, value := range node.Env {
+			service.Environment[key] = strings.ReplaceAll(value, "$", "$$")
+		}
+	}
+	for _, device := range node.Devices {
+		service.Devices = append(service.Devices, device+":"+device+":rwm")
+	}
+	if node.DNSDomain != "" {
+		service.DNSSearch = []string{node.DNSDomain}
+	}
+	// a container joining the namespaces of another one inherits its hostname and networks
+	if node.NetworkMode != "" {
+		service.Hostname = ""
+		service.NetworkMode = sharedMode(node.NetworkMode, node.Labels)
+		service.PID = sharedMode(node.PIDMode, node.Labels)
+		if target, ok := strings.CutPrefix(node.NetworkMode, "container:"); ok && !slices.Contains(service.DependsOn, target) {
+			service.DependsOn = append(slices.Clone(service.DependsOn), target)
+		}
+		return service
+	}
+	endpoints := generateNetworkConfig(node).EndpointsConfig
+	if len(endpoints) != 0 {
+		service.Networks = make(map[string]*composeAttachment, len(endpoints))
+	}
+	for name, settings := range endpoints {
+		service.Networks[topologyName(name, node.Labels)] = &composeAttachment{
+			IPv4Address: settings.IPAMConfig.IPv4Address,
+			IPv6Address: settings.IPAMConfig.IPv6Address,
+			Aliases:     settings.Aliases,
+			DriverOpts:  settings.DriverOpts,
+		}
+	}
+	return service
+}
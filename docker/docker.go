@@ -6,41 +6,108 @@
 package docker
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
 	"github.com/elupevg/golab/logger"
 	"github.com/elupevg/golab/topology"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+// mtuOption sets the MTU of a Docker bridge network.
+const mtuOption = "com.docker.network.driver.mtu"
+
+// ifnameOption sets the name of the interface a container is attached to a Docker network with.
+const ifnameOption = "com.docker.network.endpoint.ifname"
+
+// bridgeNameOption names the Linux bridge of a Docker bridge network, br-<network ID> by default.
+const bridgeNameOption = "com.docker.network.bridge.name"
+
+// bridgePrefix starts the names of Linux bridges of lab networks, which are limited to maxIfaceName characters.
+const (
+	bridgePrefix = "gl-"
+	maxIfaceName = 15
+)
+
+// inhibitIPv4Option keeps Docker from assigning an IPv4 address to the bridge of a network.
+const inhibitIPv4Option = "com.docker.network.bridge.inhibit_ipv4"
+
+// gatewayModeIPv6Option set to isolated keeps Docker from assigning an IPv6 address to the bridge of an
+// internal network, which has no IPv6 counterpart of inhibitIPv4Option.
+const gatewayModeIPv6Option = "com.docker.network.bridge.gateway_mode_ipv6"
+
+// defaultReadyTimeout bounds waiting for a started container to become ready unless its node sets a timeout.
+const defaultReadyTimeout = 2 * time.Minute
+
+// defaultStopTimeout bounds graceful shutdown of a stopped container unless its node sets a timeout.
+const defaultStopTimeout = 10 * time.Second
+
+// readyInterval separates readiness checks of a started container.
+const readyInterval = time.Second
+
+// crashLogLines is the number of last log lines reported for a container which exits while starting.
+const crashLogLines = 20
+
+// managedLabel marks Docker objects created by golab, which are the only ones it removes.
+const managedLabel = "golab.managed"
+
 // DockerProvider stores cached Docker client.
 type DockerProvider struct {
 	dockerClient client.APIClient
 	log          *logger.Logger
+	drift        DriftPolicy
 }
 
-// New returns an instance of a DockerProvider.
+// New returns an instance of a DockerProvider, which warns about existing objects not matching the topology.
 func New(dockerClient client.APIClient, log *logger.Logger) *DockerProvider {
-	return &DockerProvider{dockerClient, log}
+	return &DockerProvider{dockerClient: dockerClient, log: log, drift: DriftWarn}
 }
 
 // LinkCreate translates a topology.Link entity into a Docker bridge network and creates it.
 func (dp *DockerProvider) LinkCreate(ctx context.Context, link topology.Link) error {
-	// Check whether network with such name already exists.
-	exists, err := dp.LinkExists(ctx, link)
+	name := networkName(link)
+	// Check whether network with such name already exists and still matches the link.
+	netSum, err := dp.findNetwork(ctx, name)
 	if err != nil {
 		return err
 	}
-	if exists {
-		dp.log.Skipped("already created docker network " + link.Name)
-		return nil
+	if netSum != nil {
+		diffs := linkDrift(link, *netSum)
+		if len(diffs) == 0 {
+			dp.log.With(link.Name).Skipped("already created docker network " + name)
+			return nil
+		}
+		recreate, err := dp.drifted(link.Name, "docker network "+name, diffs)
+		if err != nil || !recreate {
+			return err
+		}
+		if err := dp.removeAttached(ctx, link); err != nil {
+			return err
+		}
+		if err := dp.LinkRemove(ctx, link); err != nil {
+			return err
+		}
 	}
 	// Otherwise, create a new Docker network.
 	ipamConfigs := make([]network.IPAMConfig, 0, 2)
@@ -60,69 +127,300 @@ func (dp *DockerProvider) LinkCreate(ctx context.Context, link topology.Link) er
 	enableIPv6 := link.IPv6Subnet != ""
 	opts := network.CreateOptions{
 		IPAM:       &network.IPAM{Config: ipamConfigs},
-		Internal:   true, // network is internal to the Docker host.
+		Internal:   !link.External, // data-plane networks are internal to the Docker host.
 		EnableIPv4: &enableIPv4,
 		EnableIPv6: &enableIPv6,
+		Labels:     managed(link.Labels),
 	}
-	resp, err := dp.dockerClient.NetworkCreate(ctx, link.Name, opts)
+	opts.Driver, opts.Options = networkDriver(link)
+	dp.logOptions(name, "network", opts)
+	resp, err := dp.dockerClient.NetworkCreate(ctx, name, opts)
 	if err != nil {
 		return err
 	}
-	dp.log.Success(fmt.Sprintf("created docker network %s with subnets=[%v, %v], id=%s", link.Name, link.IPv4Subnet, link.IPv6Subnet, string(resp.ID[:12])))
+	if !enableIPv4 && !enableIPv6 {
+		dp.log.With(link.Name).Success(fmt.Sprintf("created docker network %s without IP addressing, id=%s", name, string(resp.ID[:12])))
+		return nil
+	}
+	dp.log.With(link.Name).Success(fmt.Sprintf("created docker network %s with subnets=[%v, %v], id=%s", name, link.IPv4Subnet, link.IPv6Subnet, string(resp.ID[:12])))
 	return nil
 }
 
 // LinkExists checks whether a Docker network representing the provided topology.Link already exists.
 func (dp *DockerProvider) LinkExists(ctx context.Context, link topology.Link) (bool, error) {
+	netSum, err := dp.findNetwork(ctx, networkName(link))
+	return netSum != nil, err
+}
+
+// findNetwork returns the Docker network with the name, or nil if there is none.
+func (dp *DockerProvider) findNetwork(ctx context.Context, name string) (*network.Summary, error) {
 	netSums, err := dp.dockerClient.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	for _, netSum := range netSums {
-		if netSum.Name == link.Name {
-			return true, nil
+		if netSum.Name == name {
+			return &netSum, nil
 		}
 	}
-	return false, nil
+	return nil, nil
 }
 
 // LinkRemove translates a topology.Link entity into a Docker bridge network and removes it.
 func (dp *DockerProvider) LinkRemove(ctx context.Context, link topology.Link) error {
+	name := networkName(link)
 	// Check whether network with such name exists.
-	exists, err := dp.LinkExists(ctx, link)
+	netSum, err := dp.findNetwork(ctx, name)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		dp.log.Skipped("already removed docker network " + link.Name)
+	if netSum == nil {
+		dp.log.With(link.Name).Skipped("already removed docker network " + name)
 		return nil
 	}
+	if !owned(netSum.Labels, link.Labels) {
+		return fmt.Errorf("refusing to remove docker network %s, which golab did not create for this lab", name)
+	}
 	// Otherwise, remove a Docker network.
-	err = dp.dockerClient.NetworkRemove(ctx, link.Name)
+	err = dp.dockerClient.NetworkRemove(ctx, name)
 	if err != nil {
 		return err
 	}
-	dp.log.Success("removed docker network " + link.Name)
+	dp.log.With(link.Name).Success("removed docker network " + name)
+	return nil
+}
+
+// LinkConnect attaches the containers of the provided nodes to the link while they keep running. Nodes are
+// connected to the Docker network of the link with their addresses on it, while the containers of the two
+// nodes of a veth link are wired with a veth pair.
+func (dp *DockerProvider) LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	if link.Veth() {
+		return dp.connectVeth(ctx, link, nodes)
+	}
+	netName := networkName(link)
+	for _, node := range nodes {
+		name := containerName(node)
+		iface, connected, err := dp.attachment(ctx, link, node)
+		if err != nil {
+			return err
+		}
+		if connected {
+			dp.log.With(node.Name).Skipped(fmt.Sprintf("already connected docker container %s to network %s", name, netName))
+			continue
+		}
+		settings := endpointSettings(iface)
+		// Docker names the interface after the number of attached networks otherwise
+		settings.DriverOpts = maps.Clone(settings.DriverOpts)
+		if settings.DriverOpts == nil {
+			settings.DriverOpts = make(map[string]string, 1)
+		}
+		settings.DriverOpts[ifnameOption] = iface.Name
+		if err := dp.dockerClient.NetworkConnect(ctx, netName, name, settings); err != nil {
+			return err
+		}
+		dp.log.With(node.Name).Success(fmt.Sprintf("connected docker container %s to network %s", name, netName))
+	}
+	return nil
+}
+
+// LinkDisconnect detaches the containers of the provided nodes from the link while they keep running.
+func (dp *DockerProvider) LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	netName := networkName(link)
+	for _, node := range nodes {
+		if link.Veth() {
+			if err := dp.disconnectVeth(ctx, link, node); err != nil {
+				return err
+			}
+			continue
+		}
+		name := containerName(node)
+		_, connected, err := dp.attachment(ctx, link, node)
+		if err != nil {
+			return err
+		}
+		if !connected {
+			dp.log.With(node.Name).Skipped(fmt.Sprintf("already disconnected docker container %s from network %s", name, netName))
+			continue
+		}
+		if err := dp.dockerClient.NetworkDisconnect(ctx, netName, name, false); err != nil {
+			return err
+		}
+		dp.log.With(node.Name).Success(fmt.Sprintf("disconnected docker container %s from network %s", name, netName))
+	}
 	return nil
 }
 
+// attachment returns the interface of the node on the link and whether its container is connected to the network.
+func (dp *DockerProvider) attachment(ctx context.Context, link topology.Link, node topology.Node) (*topology.Interface, bool, error) {
+	j := slices.IndexFunc(node.Interfaces, func(iface *topology.Interface) bool { return iface.Link == link.Name })
+	if j < 0 {
+		return nil, false, fmt.Errorf("node %s is not attached to link %s", node.Name, link.Name)
+	}
+	info, err := dp.dockerClient.ContainerInspect(ctx, containerName(node))
+	if err != nil {
+		return nil, false, err
+	}
+	connected := info.NetworkSettings != nil && info.NetworkSettings.Networks[networkName(link)] != nil
+	return node.Interfaces[j], connected, nil
+}
+
+// managed adds the label marking Docker objects created by golab to the labels of a topology entity.
+func managed(labels map[string]string) map[string]string {
+	labels = maps.Clone(labels)
+	if labels == nil {
+		labels = make(map[string]string, 1)
+	}
+	labels[managedLabel] = "true"
+	return labels
+}
+
+// unmanaged reverts managed for Docker objects, so that their labels compare equal to the ones of topology entities.
+func unmanaged(labels map[string]string) map[string]string {
+	labels = maps.Clone(labels)
+	delete(labels, managedLabel)
+	return labels
+}
+
+// owned tells whether a Docker object was created by golab for the lab of the topology entity, rather than
+// merely sharing its name.
+func owned(labels, want map[string]string) bool {
+	return labels[managedLabel] == "true" && labels[topology.LabLabel] == want[topology.LabLabel]
+}
+
+// dockerName prefixes the name of a topology entity with the lab it is labeled with, so that labs
+// with the same node names can run side by side. Entities without a lab keep their names.
+func dockerName(name string, labels map[string]string) string {
+	if lab := labels[topology.LabLabel]; lab != "" {
+		return lab + "-" + name
+	}
+	return name
+}
+
+// topologyName reverts dockerName for Docker objects labeled with the lab owning them.
+func topologyName(name string, labels map[string]string) string {
+	if lab := labels[topology.LabLabel]; lab != "" {
+		return strings.TrimPrefix(name, lab+"-")
+	}
+	return name
+}
+
+// containerName resolves the name of the Docker container representing the node.
+func containerName(node topology.Node) string {
+	return dockerName(node.Name, node.Labels)
+}
+
+// networkDriver returns the driver of the Docker network implementing the link along with its options.
+func networkDriver(link topology.Link) (string, map[string]string) {
+	driver := link.Driver
+	options := make(map[string]string)
+	switch {
+	// links bridged to the host are macvlan or ipvlan networks on top of its physical interface, sharing its MTU
+	case link.HostInterface != "":
+		if driver == "" {
+			driver = topology.DriverMacvlan
+		}
+		options["parent"] = link.HostInterface
+		if driver == topology.DriverMacvlan {
+			options["macvlan_mode"] = "bridge"
+		} else {
+			options["ipvlan_mode"] = "l2"
+		}
+	// interfaces of containers attached to the network inherit its MTU
+	case link.MTU != 0:
+		options[mtuOption] = strconv.Itoa(link.MTU)
+	}
+	if driver == "" || driver == topology.DriverBridge {
+		options[bridgeNameOption] = bridgeName(link)
+		// the bridge of a link without a gateway is not part of its subnets
+		if link.NoGateway {
+			options[inhibitIPv4Option] = "true"
+			if link.IPv6Subnet != "" {
+				options[gatewayModeIPv6Option] = "isolated"
+			}
+		}
+	}
+	maps.Copy(options, link.DriverOpts)
+	if len(options) == 0 {
+		return driver, nil
+	}
+	return driver, options
+}
+
+// networkName resolves the name of the Docker network representing the link.
+func networkName(link topology.Link) string {
+	return dockerName(link.Name, link.Labels)
+}
+
+// bridgeName names the Linux bridge of the network after the link and its lab, so that host tools such as
+// tcpdump or tc can target it, unless driver_opts of the link name it. Names too long for an interface keep
+// a readable prefix and end in a hash.
+func bridgeName(link topology.Link) string {
+	if name := link.DriverOpts[bridgeNameOption]; name != "" {
+		return name
+	}
+	name := bridgePrefix + strings.TrimPrefix(link.Name, "golab-")
+	if lab := link.Labels[topology.LabLabel]; lab != "" {
+		name = bridgePrefix + lab + "-" + strings.TrimPrefix(link.Name, "golab-")
+	}
+	if len(name) <= maxIfaceName {
+		return name
+	}
+	sum := sha256.Sum256([]byte(networkName(link)))
+	return name[:maxIfaceName-7] + "-" + hex.EncodeToString(sum[:])[:6]
+}
+
 // NodeExists checks whether a Docker container representing the provided topology.Node already exists.
 func (dp *DockerProvider) NodeExists(ctx context.Context, node topology.Node) (bool, error) {
+	contSum, err := dp.findContainer(ctx, containerName(node))
+	return contSum != nil, err
+}
+
+// NodeRunning checks whether a Docker container representing the provided topology.Node exists and is running,
+// including paused containers.
+func (dp *DockerProvider) NodeRunning(ctx context.Context, node topology.Node) (bool, error) {
+	contSum, err := dp.findContainer(ctx, containerName(node))
+	if err != nil || contSum == nil {
+		return false, err
+	}
+	return contSum.State == container.StateRunning || contSum.State == container.StatePaused, nil
+}
+
+// findContainer returns the Docker container with the name, or nil if there is none.
+func (dp *DockerProvider) findContainer(ctx context.Context, name string) (*container.Summary, error) {
 	contSums, err := dp.dockerClient.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	for _, contSum := range contSums {
-		if slices.Contains(contSum.Names, "/"+node.Name) {
-			return true, nil
+		if slices.Contains(contSum.Names, "/"+name) {
+			return &contSum, nil
 		}
 	}
-	return false, nil
+	return nil, nil
 }
 
-// generateMounts converts list of binds from YAML topology file into a slice of Docker mounts.
+// generateResources converts CPU and memory limits of a node into Docker resource constraints along with
+// the host devices passed to it. Zero values leave the container unconstrained.
+func generateResources(node topology.Node) container.Resources {
+	resources := container.Resources{NanoCPUs: int64(node.CPUs * 1e9)}
+	// the memory limit is validated along with the topology
+	if node.Memory != "" {
+		resources.Memory, _ = units.RAMInBytes(node.Memory)
+	}
+	for _, device := range node.Devices {
+		resources.Devices = append(resources.Devices, container.DeviceMapping{
+			PathOnHost:        device,
+			PathInContainer:   device,
+			CgroupPermissions: "rwm",
+		})
+	}
+	return resources
+}
+
+// generateMounts converts lists of binds, named volumes and tmpfs targets from YAML topology file
+// into a slice of Docker mounts. Docker creates missing volumes along with the container.
 func generateMounts(node topology.Node) []mount.Mount {
-	mounts := make([]mount.Mount, 0, len(node.Binds))
+	mounts := make([]mount.Mount, 0, len(node.Binds)+len(node.Volumes)+len(node.Tmpfs))
 	for _, bind := range node.Binds {
 		parts := strings.Split(bind, ":")
 		mounts = append(mounts, mount.Mount{
@@ -131,81 +429,724 @@ func generateMounts(node topology.Node) []mount.Mount {
 			Target: parts[1],
 		})
 	}
+	for _, volume := range node.Volumes {
+		source, target, _ := strings.Cut(volume, ":")
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: source,
+			Target: target,
+		})
+	}
+	for _, target := range node.Tmpfs {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeTmpfs,
+			Target: target,
+		})
+	}
 	return mounts
 }
 
+// generateEnv converts node environment variables into a sorted KEY=value list.
+func generateEnv(node topology.Node) []string {
+	env := make([]string, 0, len(node.Env))
+	for key, value := range node.Env {
+		env = append(env, key+"="+value)
+	}
+	slices.Sort(env)
+	return env
+}
+
 // generateNetworkConfig converts node configuration into Docker container network configuration.
 func generateNetworkConfig(node topology.Node) *network.NetworkingConfig {
-	endpoints := make(map[string]*network.EndpointSettings, len(node.Interfaces))
-	for _, iface := range node.Interfaces {
-		ipv4Addr, _, _ := strings.Cut(iface.IPv4Addr, "/")
-		ipv6Addr, _, _ := strings.Cut(iface.IPv6Addr, "/")
-		endpoints[iface.Link] = &network.EndpointSettings{
-			IPAMConfig: &network.EndpointIPAMConfig{
-				IPv4Address: ipv4Addr,
-				IPv6Address: ipv6Addr,
-			},
-			DriverOpts: iface.DriverOpts,
+	ifaces := node.Interfaces
+	if node.Mgmt != nil {
+		ifaces = append(slices.Clip(ifaces), node.Mgmt)
+	}
+	endpoints := make(map[string]*network.EndpointSettings, len(ifaces))
+	for _, iface := range ifaces {
+		// subinterfaces are created inside the node on top of their parent interfaces, while
+		// veth interfaces are wired once the node is started
+		if iface.VLAN != 0 || iface.Veth {
+			continue
 		}
+		// networks belong to the same lab as the node
+		endpoints[dockerName(iface.Link, node.Labels)] = endpointSettings(iface)
 	}
 	return &network.NetworkingConfig{EndpointsConfig: endpoints}
 }
 
+// endpointSettings attaches the interface to its network with the addresses of the interface.
+func endpointSettings(iface *topology.Interface) *network.EndpointSettings {
+	ipv4Addr, _, _ := strings.Cut(iface.IPv4Addr, "/")
+	ipv6Addr, _, _ := strings.Cut(iface.IPv6Addr, "/")
+	return &network.EndpointSettings{
+		IPAMConfig: &network.EndpointIPAMConfig{
+			IPv4Address: ipv4Addr,
+			IPv6Address: ipv6Addr,
+		},
+		DriverOpts: iface.DriverOpts,
+		Aliases:    iface.Aliases,
+	}
+}
+
 // NodeCreate translates a topology.Node entity into a Docker container and creates/starts it.
 func (dp *DockerProvider) NodeCreate(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
 	// Check if container already exists
-	exists, err := dp.NodeExists(ctx, node)
+	contSum, err := dp.findContainer(ctx, name)
 	if err != nil {
 		return err
 	}
-	if exists {
-		dp.log.Skipped("already created docker container " + node.Name)
-		return nil
+	if contSum != nil {
+		info, err := dp.dockerClient.ContainerInspect(ctx, name)
+		if err != nil {
+			return err
+		}
+		recreate := false
+		if diffs := nodeDrift(node, info); len(diffs) != 0 {
+			if recreate, err = dp.drifted(node.Name, "docker container "+name, diffs); err != nil {
+				return err
+			}
+		}
+		switch {
+		case recreate:
+			if err := dp.NodeRemove(ctx, node); err != nil {
+				return err
+			}
+		// a container which has been stopped or has exited is started again
+		case contSum.State != container.StateRunning && contSum.State != container.StatePaused:
+			return dp.NodeStart(ctx, node)
+		default:
+			dp.log.With(node.Name).Skipped("already created docker container " + name)
+			return nil
+		}
 	}
-	// Generate new container configuration
+	// Generate new container configuration, ports are validated along with the topology
+	exposedPorts, portBindings, _ := nat.ParsePortSpecs(node.Ports)
+	timeout := stopTimeout(node)
 	contConfig := &container.Config{
-		Hostname: node.Name,
-		Image:    node.Image,
+		Hostname:     node.Name,
+		Image:        node.Image,
+		Env:          generateEnv(node),
+		Labels:       managed(node.Labels),
+		Cmd:          node.Cmd,
+		Entrypoint:   node.Entrypoint,
+		ExposedPorts: exposedPorts,
+		StopTimeout:  &timeout,
 	}
 	initialize := true
 	hostConfig := &container.HostConfig{
-		AutoRemove: true,
-		Privileged: true,
-		Init:       &initialize,
-		Mounts:     generateMounts(node),
-		Sysctls:    node.Sysctls,
+		// containers are kept when they exit, so that stopped nodes can be started again
+		RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyMode(node.Restart)},
+		Privileged:    node.Privileged,
+		CapAdd:        node.Capabilities,
+		CapDrop:       node.CapDrop,
+		Init:          &initialize,
+		Mounts:        generateMounts(node),
+		Sysctls:       node.Sysctls,
+		Resources:     generateResources(node),
+		PortBindings:  portBindings,
+	}
+	if node.DNSDomain != "" {
+		hostConfig.DNSSearch = []string{node.DNSDomain}
 	}
 	netConfig := generateNetworkConfig(node)
+	// Docker attaches containers without networks to its default bridge, which would take the name of a veth interface
+	if node.VethOnly() {
+		hostConfig.NetworkMode = network.NetworkNone
+	}
+	// A container joining the namespaces of another one inherits its hostname and networks.
+	if node.NetworkMode != "" {
+		contConfig.Hostname = ""
+		hostConfig.NetworkMode = container.NetworkMode(sharedMode(node.NetworkMode, node.Labels))
+		hostConfig.PidMode = container.PidMode(sharedMode(node.PIDMode, node.Labels))
+		netConfig = nil
+	}
+	if err := dp.pullImage(ctx, node); err != nil {
+		return err
+	}
 	platform := new(ocispec.Platform)
+	dp.logOptions(name, "container", containerOptions{
+		Config:           redactEnv(*contConfig),
+		HostConfig:       hostConfig,
+		NetworkingConfig: netConfig,
+	})
 	// Create new container
-	resp, err := dp.dockerClient.ContainerCreate(ctx, contConfig, hostConfig, netConfig, platform, node.Name)
+	resp, err := dp.dockerClient.ContainerCreate(ctx, contConfig, hostConfig, netConfig, platform, name)
 	if err != nil {
 		return err
 	}
 	// Start new container
-	err = dp.dockerClient.ContainerStart(ctx, node.Name, container.StartOptions{})
+	if err := dp.startContainer(ctx, node); err != nil {
+		return err
+	}
+	dp.log.With(node.Name).Success(fmt.Sprintf("started docker container %s with id=%s", name, string(resp.ID[:12])))
+	return dp.waitReady(ctx, node)
+}
+
+// startContainer starts the container of the node and checks that it keeps running for the minimum uptime
+// of the node, so that images crashing on boot are reported along with their last log lines.
+func (dp *DockerProvider) startContainer(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	if err := dp.dockerClient.ContainerStart(ctx, name, container.StartOptions{}); err != nil {
+		return err
+	}
+	var minUptime time.Duration
+	if node.MinUptime != "" {
+		// the uptime is validated along with the topology
+		minUptime, _ = time.ParseDuration(node.MinUptime)
+	}
+	if minUptime != 0 {
+		dp.log.With(node.Name).Progress(fmt.Sprintf("checking that docker container %s keeps running for %s", name, minUptime))
+	}
+	deadline := time.Now().Add(minUptime)
+	for {
+		info, err := dp.dockerClient.ContainerInspect(ctx, name)
+		if err != nil {
+			return err
+		}
+		if !isRunning(info) || info.State.Restarting {
+			return dp.crashed(ctx, node, info)
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(wait, readyInterval)):
+		}
+	}
+}
+
+// crashed logs the last lines the container of the node wrote before exiting and returns an error with its exit code.
+func (dp *DockerProvider) crashed(ctx context.Context, node topology.Node, info container.InspectResponse) error {
+	name := containerName(node)
+	var logs bytes.Buffer
+	if err := dp.NodeLogs(ctx, node, false, crashLogLines, &logs, &logs); err != nil {
+		return err
+	}
+	for line := range strings.Lines(logs.String()) {
+		dp.log.With(node.Name).Warn(strings.TrimRight(line, "\n"))
+	}
+	return fmt.Errorf("docker container %s exited with code %d while starting", name, info.State.ExitCode)
+}
+
+// waitReady waits until the container of the node reports healthy, if its image defines a health check,
+// or until the ready command of the node succeeds, so that configuration does not race the boot of the
+// network OS. Containers without either are ready once started.
+func (dp *DockerProvider) waitReady(ctx context.Context, node topology.Node) error {
+	timeout := defaultReadyTimeout
+	if node.ReadyTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.ReadyTimeout)
+	}
+	if timeout == 0 {
+		return nil
+	}
+	name := containerName(node)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for waited := false; ; waited = true {
+		ready, err := dp.isReady(waitCtx, node)
+		if err != nil {
+			return err
+		}
+		if ready {
+			if waited {
+				dp.log.With(node.Name).Success("docker container " + name + " is ready")
+			}
+			return nil
+		}
+		if !waited {
+			dp.log.With(node.Name).Progress("waiting for docker container " + name + " to become ready")
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("docker container %s is not ready after %s", name, timeout)
+		case <-time.After(readyInterval):
+		}
+	}
+}
+
+// isReady checks the health of the container of the node or runs its ready command. Failures to run
+// the command are not errors, as the container may still be booting.
+func (dp *DockerProvider) isReady(ctx context.Context, node topology.Node) (bool, error) {
+	info, err := dp.dockerClient.ContainerInspect(ctx, containerName(node))
 	if err != nil {
+		return false, err
+	}
+	if info.ContainerJSONBase != nil && info.State != nil && (!info.State.Running || info.State.Restarting) {
+		return false, dp.crashed(ctx, node, info)
+	}
+	if info.ContainerJSONBase != nil && info.State != nil && info.State.Health != nil {
+		return info.State.Health.Status == container.Healthy, nil
+	}
+	if len(node.ReadyCommand) == 0 {
+		return true, nil
+	}
+	exitCode, err := dp.NodeExec(ctx, node, node.ReadyCommand, io.Discard, io.Discard)
+	return err == nil && exitCode == 0, nil
+}
+
+// pullImage pulls the image of the node unless it is present locally, logging every change
+// in the status of its layers, e.g. "Downloading" or "Pull complete".
+func (dp *DockerProvider) pullImage(ctx context.Context, node topology.Node) error {
+	_, err := dp.dockerClient.ImageInspect(ctx, node.Image)
+	if err == nil || !cerrdefs.IsNotFound(err) {
 		return err
 	}
-	dp.log.Success(fmt.Sprintf("started docker container %s with id=%s", node.Name, string(resp.ID[:12])))
+	log := dp.log.With(node.Name)
+	log.Progress("pulling docker image " + node.Image)
+	stream, err := dp.dockerClient.ImagePull(ctx, node.Image, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull docker image %s: %w", node.Image, err)
+	}
+	defer stream.Close()
+	layers := make(map[string]string)
+	dec := json.NewDecoder(stream)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to pull docker image %s: %w", node.Image, err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("failed to pull docker image %s: %w", node.Image, msg.Error)
+		}
+		// progress of a layer is reported many times over with the same status
+		if msg.ID == "" || layers[msg.ID] == msg.Status {
+			continue
+		}
+		layers[msg.ID] = msg.Status
+		log.Progress(fmt.Sprintf("pulling docker image %s: layer %s: %s", node.Image, msg.ID, strings.ToLower(msg.Status)))
+	}
+	log.Success("pulled docker image " + node.Image)
 	return nil
 }
 
+// sharedMode resolves the container of a container:NAME namespace mode, which belongs to the same lab.
+func sharedMode(mode string, labels map[string]string) string {
+	if target, ok := strings.CutPrefix(mode, "container:"); ok {
+		return "container:" + dockerName(target, labels)
+	}
+	return mode
+}
+
+// containerOptions groups all options submitted to the Docker API to create a container.
+type containerOptions struct {
+	Config           container.Config
+	HostConfig       *container.HostConfig
+	NetworkingConfig *network.NetworkingConfig
+}
+
+// redactEnv hides values of environment variables, which may hold resolved secrets.
+func redactEnv(config container.Config) container.Config {
+	env := make([]string, 0, len(config.Env))
+	for _, variable := range config.Env {
+		key, _, _ := strings.Cut(variable, "=")
+		env = append(env, key+"=<redacted>")
+	}
+	config.Env = env
+	return config
+}
+
+// logOptions logs the options submitted to the Docker API at debug level.
+func (dp *DockerProvider) logOptions(resource, kind string, opts any) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(opts); err != nil {
+		dp.log.With(resource).Debug(fmt.Sprintf("failed to encode docker %s options: %v", kind, err))
+		return
+	}
+	dp.log.With(resource).Debug(fmt.Sprintf("submitting docker %s %s options: %s", kind, resource, bytes.TrimSpace(buf.Bytes())))
+}
+
 func (dp *DockerProvider) NodeRemove(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
 	// Check whether container exists
-	exists, err := dp.NodeExists(ctx, node)
+	contSum, err := dp.findContainer(ctx, name)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		dp.log.Skipped("already removed docker container " + node.Name)
-		return err
+	if contSum == nil {
+		dp.log.With(node.Name).Skipped("already removed docker container " + name)
+		return nil
+	}
+	if !owned(contSum.Labels, node.Labels) {
+		return fmt.Errorf("refusing to remove docker container %s, which golab did not create for this lab", name)
+	}
+	// running containers shut down gracefully first, so that network OSes can save their state and release locks
+	if contSum.State == container.StateRunning {
+		timeout := stopTimeout(node)
+		if err := dp.dockerClient.ContainerStop(ctx, name, container.StopOptions{Timeout: &timeout}); err != nil {
+			dp.log.With(node.Name).Warn(fmt.Sprintf("failed to stop docker container %s gracefully, removing it by force: %v", name, err))
+		}
 	}
 	// Remove container
-	err = dp.dockerClient.ContainerRemove(ctx, node.Name, container.RemoveOptions{Force: true})
+	err = dp.dockerClient.ContainerRemove(ctx, name, container.RemoveOptions{Force: true})
+	if err != nil {
+		return err
+	}
+	dp.log.With(node.Name).Success("removed docker container " + name)
+	return nil
+}
+
+// NodePause freezes all processes of the Docker container representing the provided topology.Node.
+func (dp *DockerProvider) NodePause(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	info, err := dp.dockerClient.ContainerInspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	if isPaused(info) {
+		dp.log.With(node.Name).Skipped("already paused docker container " + name)
+		return nil
+	}
+	if err := dp.dockerClient.ContainerPause(ctx, name); err != nil {
+		return err
+	}
+	dp.log.With(node.Name).Success("paused docker container " + name)
+	return nil
+}
+
+// NodeUnpause resumes all processes of the Docker container representing the provided topology.Node.
+func (dp *DockerProvider) NodeUnpause(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	info, err := dp.dockerClient.ContainerInspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !isPaused(info) {
+		dp.log.With(node.Name).Skipped("already resumed docker container " + name)
+		return nil
+	}
+	if err := dp.dockerClient.ContainerUnpause(ctx, name); err != nil {
+		return err
+	}
+	dp.log.With(node.Name).Success("resumed docker container " + name)
+	return nil
+}
+
+// NodeStop stops the Docker container representing the provided topology.Node without removing it,
+// which takes down the interfaces of the node as if it was powered off.
+func (dp *DockerProvider) NodeStop(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	info, err := dp.dockerClient.ContainerInspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !isRunning(info) {
+		dp.log.With(node.Name).Skipped("already stopped docker container " + name)
+		return nil
+	}
+	if err := dp.dockerClient.ContainerStop(ctx, name, container.StopOptions{}); err != nil {
+		return err
+	}
+	dp.log.With(node.Name).Success("stopped docker container " + name)
+	return nil
+}
+
+// NodeStart starts the stopped Docker container representing the provided topology.Node
+// and waits for it to become ready.
+func (dp *DockerProvider) NodeStart(ctx context.Context, node topology.Node) error {
+	name := containerName(node)
+	info, err := dp.dockerClient.ContainerInspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	if isRunning(info) {
+		dp.log.With(node.Name).Skipped("already started docker container " + name)
+		return nil
+	}
+	if err := dp.startContainer(ctx, node); err != nil {
+		return err
+	}
+	dp.log.With(node.Name).Success("started docker container " + name)
+	return dp.waitReady(ctx, node)
+}
+
+// NodeCommit commits the filesystem of the Docker container representing the provided topology.Node
+// to an image with the reference, pausing the container meanwhile. Bind-mounted files are not included.
+func (dp *DockerProvider) NodeCommit(ctx context.Context, node topology.Node, ref string) error {
+	name := containerName(node)
+	resp, err := dp.dockerClient.ContainerCommit(ctx, name, container.CommitOptions{
+		Reference: ref,
+		Comment:   "golab snapshot",
+		Pause:     true,
+	})
+	if err != nil {
+		return err
+	}
+	id := strings.TrimPrefix(resp.ID, "sha256:")
+	dp.log.With(node.Name).Success(fmt.Sprintf("committed docker container %s to image %s, id=%.12s", name, ref, id))
+	return nil
+}
+
+// stopTimeout returns the number of seconds the container of the node is given to shut down when stopped,
+// after which it is killed. Docker takes whole seconds, so fractions are rounded up.
+func stopTimeout(node topology.Node) int {
+	timeout := defaultStopTimeout
+	if node.StopTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.StopTimeout)
+	}
+	return int((timeout + time.Second - 1) / time.Second)
+}
+
+func isRunning(info container.InspectResponse) bool {
+	return info.ContainerJSONBase != nil && info.State != nil && info.State.Running
+}
+
+func isPaused(info container.InspectResponse) bool {
+	return info.ContainerJSONBase != nil && info.State != nil && info.State.Paused
+}
+
+// NodeExec runs a command inside the Docker container representing the provided topology.Node
+// and returns the exit code of the command.
+func (dp *DockerProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	name := containerName(node)
+	execResp, err := dp.dockerClient.ContainerExecCreate(ctx, name, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	hijacked, err := dp.dockerClient.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer hijacked.Close()
+	if _, err := stdcopy.StdCopy(stdout, stderr, hijacked.Reader); err != nil {
+		return 0, err
+	}
+	execInspect, err := dp.dockerClient.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return 0, err
+	}
+	return execInspect.ExitCode, nil
+}
+
+// NodeShell runs an interactive command inside the Docker container representing the provided topology.Node
+// with a pseudo-terminal attached to the provided TTY and returns the exit code of the command.
+func (dp *DockerProvider) NodeShell(ctx context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error) {
+	name := containerName(node)
+	execResp, err := dp.dockerClient.ContainerExecCreate(ctx, name, container.ExecOptions{
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		ConsoleSize:  &[2]uint{tty.Height, tty.Width},
+	})
+	if err != nil {
+		return 0, err
+	}
+	hijacked, err := dp.dockerClient.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{
+		Tty:         true,
+		ConsoleSize: &[2]uint{tty.Height, tty.Width},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer hijacked.Close()
+	go func() {
+		io.Copy(hijacked.Conn, tty.In)
+		hijacked.CloseWrite()
+	}()
+	// With a pseudo-terminal attached, the output is not multiplexed.
+	if _, err := io.Copy(tty.Out, hijacked.Reader); err != nil {
+		return 0, err
+	}
+	execInspect, err := dp.dockerClient.ContainerExecInspect(ctx, execResp.ID)
+	if err != nil {
+		return 0, err
+	}
+	return execInspect.ExitCode, nil
+}
+
+// NodeLogs writes logs of the Docker container representing the provided topology.Node.
+// Only the last tail lines are written unless tail is negative, and new output is streamed
+// until the context is canceled if follow is set.
+func (dp *DockerProvider) NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, stderr io.Writer) error {
+	name := containerName(node)
+	tailOpt := "all"
+	if tail >= 0 {
+		tailOpt = strconv.Itoa(tail)
+	}
+	logs, err := dp.dockerClient.ContainerLogs(ctx, name, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+		Tail:       tailOpt,
+	})
 	if err != nil {
 		return err
 	}
-	dp.log.Success("removed docker container " + node.Name)
+	defer logs.Close()
+	_, err = stdcopy.StdCopy(stdout, stderr, logs)
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// NodeStats collects resource usage of the Docker container representing the provided topology.Node.
+func (dp *DockerProvider) NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error) {
+	name := containerName(node)
+	// Non-streaming stats include the previous CPU sample required to calculate CPU usage.
+	resp, err := dp.dockerClient.ContainerStats(ctx, name, false)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	defer resp.Body.Close()
+	var stats container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return topology.NodeStats{}, err
+	}
+	nodeStats := topology.NodeStats{
+		CPUPercent: calcCPUPercent(stats),
+		MemUsage:   calcMemUsage(stats),
+		MemLimit:   stats.MemoryStats.Limit,
+	}
+	// networks are keyed by the names of the container interfaces
+	for _, name := range slices.Sorted(maps.Keys(stats.Networks)) {
+		netStats := stats.Networks[name]
+		nodeStats.RxBytes += netStats.RxBytes
+		nodeStats.TxBytes += netStats.TxBytes
+		nodeStats.RxPackets += netStats.RxPackets
+		nodeStats.TxPackets += netStats.TxPackets
+		nodeStats.Interfaces = append(nodeStats.Interfaces, topology.InterfaceStats{
+			Name:      name,
+			RxBytes:   netStats.RxBytes,
+			TxBytes:   netStats.TxBytes,
+			RxPackets: netStats.RxPackets,
+			TxPackets: netStats.TxPackets,
+			RxErrors:  netStats.RxErrors,
+			TxErrors:  netStats.TxErrors,
+			RxDropped: netStats.RxDropped,
+			TxDropped: netStats.TxDropped,
+		})
+	}
+	return nodeStats, nil
+}
+
+// calcCPUPercent calculates CPU usage the same way as the "docker stats" command does.
+func calcCPUPercent(stats container.StatsResponse) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * onlineCPUs * 100
+}
+
+// calcMemUsage calculates memory usage excluding the page cache like docker stats does. The cache is
+// sampled separately from the usage, so it may exceed the usage, which is reported as no usage at all.
+func calcMemUsage(stats container.StatsResponse) uint64 {
+	cache := stats.MemoryStats.Stats["inactive_file"]
+	if cache > stats.MemoryStats.Usage {
+		return 0
+	}
+	return stats.MemoryStats.Usage - cache
+}
+
+// labelFilter matches Docker objects owned by the provided lab or by any lab if it is empty.
+func labelFilter(lab string) filters.Args {
+	if lab == "" {
+		return filters.NewArgs(filters.Arg("label", topology.LabLabel))
+	}
+	return filters.NewArgs(filters.Arg("label", topology.LabLabel+"="+lab))
+}
+
+// RemoveOrphans removes all containers and networks labeled as owned by the provided lab, or by any lab
+// if it is empty. Unlike Wreck, it does not depend on the topology file, which may have changed since.
+func (dp *DockerProvider) RemoveOrphans(ctx context.Context, lab string) error {
+	contSums, err := dp.dockerClient.ContainerList(ctx, container.ListOptions{All: true, Filters: labelFilter(lab)})
+	if err != nil {
+		return err
+	}
+	for _, contSum := range contSums {
+		name := strings.TrimPrefix(contSum.Names[0], "/")
+		if err := dp.dockerClient.ContainerRemove(ctx, name, container.RemoveOptions{Force: true}); err != nil {
+			return err
+		}
+		dp.log.With(name).Success(fmt.Sprintf("removed docker container %s of lab %s", name, contSum.Labels[topology.LabLabel]))
+	}
+	netSums, err := dp.dockerClient.NetworkList(ctx, network.ListOptions{Filters: labelFilter(lab)})
+	if err != nil {
+		return err
+	}
+	for _, netSum := range netSums {
+		if err := dp.dockerClient.NetworkRemove(ctx, netSum.Name); err != nil {
+			return err
+		}
+		dp.log.With(netSum.Name).Success(fmt.Sprintf("removed docker network %s of lab %s", netSum.Name, netSum.Labels[topology.LabLabel]))
+	}
+	if len(contSums) == 0 && len(netSums) == 0 {
+		dp.log.Skipped("found no leftover docker objects")
+	}
 	return nil
 }
+
+// Deployed reports containers and networks labeled as owned by the provided lab, translated
+// back into topology entities with the attributes observed by Docker.
+func (dp *DockerProvider) Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	contSums, err := dp.dockerClient.ContainerList(ctx, container.ListOptions{All: true, Filters: labelFilter(lab)})
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes := make([]topology.Node, 0, len(contSums))
+	for _, contSum := range contSums {
+		node := topology.Node{
+			Name:   topologyName(strings.TrimPrefix(contSum.Names[0], "/"), contSum.Labels),
+			Image:  contSum.Image,
+			Labels: unmanaged(contSum.Labels),
+		}
+		if contSum.NetworkSettings != nil {
+			for _, netName := range slices.Sorted(maps.Keys(contSum.NetworkSettings.Networks)) {
+				// nodes wired with veth pairs only are attached to the none network
+				if netName == network.NetworkNone {
+					continue
+				}
+				endpoint := contSum.NetworkSettings.Networks[netName]
+				ipv4Addr := endpoint.IPAddress
+				if endpoint.IPAMConfig != nil && endpoint.IPAMConfig.IPv4Address != "" {
+					ipv4Addr = endpoint.IPAMConfig.IPv4Address
+				}
+				node.Interfaces = append(node.Interfaces, &topology.Interface{Link: topologyName(netName, contSum.Labels), IPv4Addr: ipv4Addr})
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	netSums, err := dp.dockerClient.NetworkList(ctx, network.ListOptions{Filters: labelFilter(lab)})
+	if err != nil {
+		return nil, nil, err
+	}
+	links := make([]topology.Link, 0, len(netSums))
+	for _, netSum := range netSums {
+		link := topology.Link{Name: topologyName(netSum.Name, netSum.Labels), Labels: unmanaged(netSum.Labels)}
+		link.MTU, _ = strconv.Atoi(netSum.Options[mtuOption])
+		for _, ipamConfig := range netSum.IPAM.Config {
+			if strings.Contains(ipamConfig.Subnet, ":") {
+				link.IPv6Subnet = ipamConfig.Subnet
+				continue
+			}
+			link.IPv4Subnet = ipamConfig.Subnet
+		}
+		links = append(links, link)
+	}
+	return nodes, links, nil
+}
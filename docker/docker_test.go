@@ -1,19 +1,39 @@
 package docker_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
 	"github.com/elupevg/golab/docker"
 	"github.com/elupevg/golab/logger"
 	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -23,21 +43,79 @@ type fakeDockerClient struct {
 	networkRemoveErr   error
 	networkListErr     error
 	networks           map[string]string
+	netLabels          map[string]map[string]string
+	netIPAM            map[string]*network.IPAM
+	netOptions         map[string]map[string]string
+	netInternal        map[string]bool
+	netDrivers         map[string]string
 	containerCreateErr error
 	containerStartErr  error
 	containerRemoveErr error
 	containerListErr   error
 	containers         map[string]string
+	paused             map[string]bool
+	stopped            map[string]bool
+	starts             map[string]int
+	configs            map[string]*container.Config
+	hostConfigs        map[string]*container.HostConfig
+	netConfigs         map[string]*network.NetworkingConfig
+	execCreateErr      error
+	execExitCode       int
+	execs              map[string][]string
+	inactiveFile       uint64
+	missingImages      map[string]bool
+	health             string
+	pullErr            string
+	pulls              []string
+	host               string
+	commits            map[string]string
+	exitCodes          map[string]int
+	containerStopErr   error
+	stopTimeouts       map[string]int
 }
 
 func newFakeDockerClient() *fakeDockerClient {
 	return &fakeDockerClient{
-		networks:   make(map[string]string, 0),
-		containers: make(map[string]string, 0),
+		networks:      make(map[string]string, 0),
+		netLabels:     make(map[string]map[string]string, 0),
+		netIPAM:       make(map[string]*network.IPAM, 0),
+		netOptions:    make(map[string]map[string]string, 0),
+		netInternal:   make(map[string]bool, 0),
+		netDrivers:    make(map[string]string, 0),
+		containers:    make(map[string]string, 0),
+		paused:        make(map[string]bool, 0),
+		stopped:       make(map[string]bool, 0),
+		starts:        make(map[string]int, 0),
+		configs:       make(map[string]*container.Config, 0),
+		hostConfigs:   make(map[string]*container.HostConfig, 0),
+		netConfigs:    make(map[string]*network.NetworkingConfig, 0),
+		execs:         make(map[string][]string, 0),
+		missingImages: make(map[string]bool, 0),
+		inactiveFile:  16 << 20,
+		host:          "unix:///var/run/docker.sock",
+		commits:       make(map[string]string, 0),
+		exitCodes:     make(map[string]int, 0),
+		stopTimeouts:  make(map[string]int, 0),
 	}
 }
 
-func (f *fakeDockerClient) NetworkCreate(_ context.Context, name string, _ network.CreateOptions) (network.CreateResponse, error) {
+func (f *fakeDockerClient) DaemonHost() string {
+	return f.host
+}
+
+// matchLabels reports whether the labels satisfy all label filters, e.g. "key" or "key=value".
+func matchLabels(labels map[string]string, args filters.Args) bool {
+	for _, filter := range args.Get("label") {
+		key, value, hasValue := strings.Cut(filter, "=")
+		got, ok := labels[key]
+		if !ok || hasValue && got != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeDockerClient) NetworkCreate(_ context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
 	if f.networkCreateErr != nil {
 		return network.CreateResponse{}, f.networkCreateErr
 	}
@@ -46,6 +124,11 @@ func (f *fakeDockerClient) NetworkCreate(_ context.Context, name string, _ netwo
 	}
 	dummyID := strconv.Itoa(len(f.networks)+1) + "000000000000"
 	f.networks[name] = dummyID
+	f.netLabels[name] = options.Labels
+	f.netIPAM[name] = options.IPAM
+	f.netOptions[name] = options.Options
+	f.netInternal[name] = options.Internal
+	f.netDrivers[name] = options.Driver
 	return network.CreateResponse{ID: dummyID}, nil
 }
 
@@ -60,18 +143,59 @@ func (f *fakeDockerClient) NetworkRemove(_ context.Context, networkID string) er
 	return nil
 }
 
-func (f *fakeDockerClient) NetworkList(_ context.Context, _ network.ListOptions) ([]network.Summary, error) {
+func (f *fakeDockerClient) NetworkList(_ context.Context, options network.ListOptions) ([]network.Summary, error) {
 	if f.networkListErr != nil {
 		return nil, f.networkListErr
 	}
 	netSumms := make([]network.Summary, 0, len(f.networks))
 	for name, id := range f.networks {
-		netSumms = append(netSumms, network.Summary{Name: name, ID: id})
+		if matchLabels(f.netLabels[name], options.Filters) {
+			netSumm := network.Summary{Name: name, ID: id, Labels: f.netLabels[name], Options: f.netOptions[name]}
+			if ipam := f.netIPAM[name]; ipam != nil {
+				netSumm.IPAM = *ipam
+			}
+			netSumms = append(netSumms, netSumm)
+		}
 	}
 	return netSumms, nil
 }
 
-func (f *fakeDockerClient) ContainerCreate(_ context.Context, _ *container.Config, _ *container.HostConfig, _ *network.NetworkingConfig, _ *ocispec.Platform, name string) (container.CreateResponse, error) {
+func (f *fakeDockerClient) NetworkInspect(_ context.Context, networkID string, _ network.InspectOptions) (network.Inspect, error) {
+	if _, ok := f.networks[networkID]; !ok {
+		return network.Inspect{}, fmt.Errorf("network %s does not exist", networkID)
+	}
+	resource := network.Inspect{Name: networkID, Labels: f.netLabels[networkID], Containers: make(map[string]network.EndpointResource)}
+	for name, netConfig := range f.netConfigs {
+		if netConfig == nil {
+			continue
+		}
+		if _, ok := netConfig.EndpointsConfig[networkID]; ok && f.containers[name] != "" {
+			resource.Containers[f.containers[name]] = network.EndpointResource{Name: name}
+		}
+	}
+	return resource, nil
+}
+
+func (f *fakeDockerClient) NetworkConnect(_ context.Context, networkID, containerID string, config *network.EndpointSettings) error {
+	if _, ok := f.networks[networkID]; !ok {
+		return fmt.Errorf("network %s does not exist", networkID)
+	}
+	if _, ok := f.containers[containerID]; !ok {
+		return fmt.Errorf("container %s does not exist", containerID)
+	}
+	f.netConfigs[containerID].EndpointsConfig[networkID] = config
+	return nil
+}
+
+func (f *fakeDockerClient) NetworkDisconnect(_ context.Context, networkID, containerID string, _ bool) error {
+	if _, ok := f.netConfigs[containerID].EndpointsConfig[networkID]; !ok {
+		return fmt.Errorf("container %s is not connected to network %s", containerID, networkID)
+	}
+	delete(f.netConfigs[containerID].EndpointsConfig, networkID)
+	return nil
+}
+
+func (f *fakeDockerClient) ContainerCreate(_ context.Context, config *container.Config, hostConfig *container.HostConfig, netConfig *network.NetworkingConfig, _ *ocispec.Platform, name string) (container.CreateResponse, error) {
 	if f.containerCreateErr != nil {
 		return container.CreateResponse{}, f.containerCreateErr
 	}
@@ -80,6 +204,9 @@ func (f *fakeDockerClient) ContainerCreate(_ context.Context, _ *container.Confi
 	}
 	dummyID := strconv.Itoa(len(f.containers)+1) + "000000000000"
 	f.containers[name] = dummyID
+	f.configs[name] = config
+	f.hostConfigs[name] = hostConfig
+	f.netConfigs[name] = netConfig
 	return container.CreateResponse{ID: dummyID}, nil
 }
 
@@ -90,9 +217,33 @@ func (f *fakeDockerClient) ContainerStart(_ context.Context, containerID string,
 	if _, ok := f.containers[containerID]; !ok {
 		return fmt.Errorf("container %s does not exists", containerID)
 	}
+	delete(f.stopped, containerID)
+	f.starts[containerID]++
+	return nil
+}
+
+func (f *fakeDockerClient) ContainerStop(_ context.Context, containerID string, options container.StopOptions) error {
+	if _, ok := f.containers[containerID]; !ok {
+		return fmt.Errorf("container %s does not exist", containerID)
+	}
+	if f.containerStopErr != nil {
+		return f.containerStopErr
+	}
+	if options.Timeout != nil {
+		f.stopTimeouts[containerID] = *options.Timeout
+	}
+	f.stopped[containerID] = true
 	return nil
 }
 
+func (f *fakeDockerClient) ContainerCommit(_ context.Context, containerID string, options container.CommitOptions) (container.CommitResponse, error) {
+	if _, ok := f.containers[containerID]; !ok {
+		return container.CommitResponse{}, fmt.Errorf("container %s does not exist", containerID)
+	}
+	f.commits[containerID] = options.Reference
+	return container.CommitResponse{ID: "sha256:0123456789abcdef"}, nil
+}
+
 func (f *fakeDockerClient) ContainerRemove(_ context.Context, containerID string, _ container.RemoveOptions) error {
 	if f.containerRemoveErr != nil {
 		return f.containerRemoveErr
@@ -104,17 +255,175 @@ func (f *fakeDockerClient) ContainerRemove(_ context.Context, containerID string
 	return nil
 }
 
-func (f *fakeDockerClient) ContainerList(_ context.Context, _ container.ListOptions) ([]container.Summary, error) {
+func (f *fakeDockerClient) ContainerList(_ context.Context, options container.ListOptions) ([]container.Summary, error) {
 	if f.containerListErr != nil {
 		return nil, f.containerListErr
 	}
 	contSumms := make([]container.Summary, 0, len(f.containers))
 	for name, id := range f.containers {
-		contSumms = append(contSumms, container.Summary{Names: []string{"/" + name}, ID: id})
+		if labels := f.configs[name].Labels; matchLabels(labels, options.Filters) {
+			contSumm := container.Summary{Names: []string{"/" + name}, ID: id, Image: f.configs[name].Image, Labels: labels, State: container.StateRunning}
+			if f.stopped[name] {
+				contSumm.State = container.StateExited
+			}
+			if netConfig := f.netConfigs[name]; netConfig != nil {
+				contSumm.NetworkSettings = &container.NetworkSettingsSummary{Networks: netConfig.EndpointsConfig}
+			}
+			contSumms = append(contSumms, contSumm)
+		}
 	}
 	return contSumms, nil
 }
 
+func (f *fakeDockerClient) ContainerInspect(_ context.Context, containerID string) (container.InspectResponse, error) {
+	if _, ok := f.containers[containerID]; !ok {
+		return container.InspectResponse{}, fmt.Errorf("container %s does not exist", containerID)
+	}
+	state := &container.State{Running: !f.stopped[containerID], Paused: f.paused[containerID]}
+	// containers of crashing images exit right after they are started
+	if exitCode, ok := f.exitCodes[containerID]; ok && f.starts[containerID] != 0 {
+		state.Running, state.ExitCode = false, exitCode
+	}
+	if f.health != "" {
+		state.Health = &container.Health{Status: f.health}
+	}
+	settings := &container.NetworkSettings{}
+	if netConfig := f.netConfigs[containerID]; netConfig != nil {
+		settings.Networks = netConfig.EndpointsConfig
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{State: state, HostConfig: f.hostConfigs[containerID]},
+		Config:            f.configs[containerID],
+		NetworkSettings:   settings,
+	}, nil
+}
+
+func (f *fakeDockerClient) ContainerPause(_ context.Context, containerID string) error {
+	if f.paused[containerID] {
+		return fmt.Errorf("container %s is already paused", containerID)
+	}
+	f.paused[containerID] = true
+	return nil
+}
+
+func (f *fakeDockerClient) ContainerUnpause(_ context.Context, containerID string) error {
+	if !f.paused[containerID] {
+		return fmt.Errorf("container %s is not paused", containerID)
+	}
+	delete(f.paused, containerID)
+	return nil
+}
+
+func (f *fakeDockerClient) ContainerExecCreate(_ context.Context, containerID string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	if f.execCreateErr != nil {
+		return container.ExecCreateResponse{}, f.execCreateErr
+	}
+	if _, ok := f.containers[containerID]; !ok {
+		return container.ExecCreateResponse{}, fmt.Errorf("container %s does not exist", containerID)
+	}
+	execID := "exec-" + containerID
+	f.execs[execID] = options.Cmd
+	return container.ExecCreateResponse{ID: execID}, nil
+}
+
+func (f *fakeDockerClient) ContainerExecAttach(_ context.Context, execID string, options container.ExecAttachOptions) (types.HijackedResponse, error) {
+	buf := new(bytes.Buffer)
+	conn, peer := net.Pipe()
+	if options.Tty {
+		// terminal output is not multiplexed, while the input is drained
+		fmt.Fprint(buf, strings.Join(f.execs[execID], " ")+"\n")
+		go func() {
+			defer peer.Close()
+			io.Copy(io.Discard, peer)
+		}()
+		return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(buf)}, nil
+	}
+	fmt.Fprint(stdcopy.NewStdWriter(buf, stdcopy.Stdout), strings.Join(f.execs[execID], " "))
+	fmt.Fprint(stdcopy.NewStdWriter(buf, stdcopy.Stderr), "warning")
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(buf)}, nil
+}
+
+func (f *fakeDockerClient) ContainerExecInspect(_ context.Context, _ string) (container.ExecInspect, error) {
+	return container.ExecInspect{ExitCode: f.execExitCode}, nil
+}
+
+func (f *fakeDockerClient) ImageInspect(_ context.Context, imageID string, _ ...client.ImageInspectOption) (image.InspectResponse, error) {
+	if f.missingImages[imageID] {
+		return image.InspectResponse{}, fmt.Errorf("no such image: %s: %w", imageID, cerrdefs.ErrNotFound)
+	}
+	return image.InspectResponse{ID: imageID}, nil
+}
+
+func (f *fakeDockerClient) ImagePull(_ context.Context, ref string, _ image.PullOptions) (io.ReadCloser, error) {
+	f.pulls = append(f.pulls, ref)
+	messages := []jsonmessage.JSONMessage{
+		{Status: "Pulling from frrouting/frr", ID: "master"},
+		{Status: "Pulling fs layer", ID: "a1b2c3"},
+		{Status: "Downloading", ID: "a1b2c3", Progress: &jsonmessage.JSONProgress{Current: 1, Total: 2}},
+		{Status: "Downloading", ID: "a1b2c3", Progress: &jsonmessage.JSONProgress{Current: 2, Total: 2}},
+		{Status: "Pull complete", ID: "a1b2c3"},
+		{Status: "Status: Downloaded newer image for " + ref},
+	}
+	if f.pullErr != "" {
+		messages = append(messages[:2], jsonmessage.JSONMessage{Error: &jsonmessage.JSONError{Message: f.pullErr}})
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, msg := range messages {
+		_ = enc.Encode(msg)
+	}
+	f.missingImages[ref] = f.pullErr != ""
+	return io.NopCloser(buf), nil
+}
+
+func (f *fakeDockerClient) ContainerLogs(_ context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
+	if _, ok := f.containers[containerID]; !ok {
+		return nil, fmt.Errorf("container %s does not exist", containerID)
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(stdcopy.NewStdWriter(buf, stdcopy.Stdout), "follow=%t tail=%s\n", options.Follow, options.Tail)
+	fmt.Fprint(stdcopy.NewStdWriter(buf, stdcopy.Stderr), "zebra: warning\n")
+	return io.NopCloser(buf), nil
+}
+
+func (f *fakeDockerClient) ContainerWait(_ context.Context, containerID string, _ container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	waitCh, errCh := make(chan container.WaitResponse, 1), make(chan error, 1)
+	if _, ok := f.containers[containerID]; !ok {
+		errCh <- fmt.Errorf("container %s does not exist", containerID)
+		return waitCh, errCh
+	}
+	waitCh <- container.WaitResponse{StatusCode: int64(f.exitCodes[containerID])}
+	return waitCh, errCh
+}
+
+func (f *fakeDockerClient) ContainerStats(_ context.Context, containerID string, _ bool) (container.StatsResponseReader, error) {
+	if _, ok := f.containers[containerID]; !ok {
+		return container.StatsResponseReader{}, fmt.Errorf("container %s does not exist", containerID)
+	}
+	stats := container.StatsResponse{
+		CPUStats: container.CPUStats{
+			CPUUsage:    container.CPUUsage{TotalUsage: 3_000_000},
+			SystemUsage: 20_000_000,
+			OnlineCPUs:  2,
+		},
+		PreCPUStats: container.CPUStats{
+			CPUUsage:    container.CPUUsage{TotalUsage: 1_000_000},
+			SystemUsage: 10_000_000,
+		},
+		MemoryStats: container.MemoryStats{
+			Usage: 64 << 20,
+			Limit: 1 << 30,
+			Stats: map[string]uint64{"inactive_file": f.inactiveFile},
+		},
+		Networks: map[string]container.NetworkStats{
+			"eth1": {RxBytes: 300, TxBytes: 400, RxPackets: 3, TxPackets: 4, RxDropped: 1},
+			"eth0": {RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2, TxErrors: 1},
+		},
+	}
+	data, _ := json.Marshal(stats)
+	return container.StatsResponseReader{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
 func TestLinkCreateRemove(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -169,6 +478,135 @@ func TestLinkCreateRemove(t *testing.T) {
 	}
 }
 
+func TestLinkCreateOptions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	links := []topology.Link{
+		{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24", MTU: 9000},
+		{Name: "golab-link-02", IPv4Subnet: "10.1.3.0/24"},
+		{Name: "golab-link-03", IPv4Subnet: "10.1.4.0/24", MTU: 9000, NoGateway: true},
+		{Name: "golab-link-04", IPv4Subnet: "10.1.6.0/24", IPv6Subnet: "2001:db8:1:6::/64", NoGateway: true},
+		{Name: "core", IPv4Subnet: "10.1.5.0/24", Labels: map[string]string{topology.LabLabel: "lab1"}},
+		{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24", Labels: map[string]string{topology.LabLabel: "datacenter"}},
+	}
+	for _, link := range links {
+		if err := dp.LinkCreate(ctx, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// bridges are named after their links, with a hash keeping names of long ones unique
+	want := map[string]map[string]string{
+		"golab-link-01":            {"com.docker.network.driver.mtu": "9000", "com.docker.network.bridge.name": "gl-link-01"},
+		"golab-link-02":            {"com.docker.network.bridge.name": "gl-link-02"},
+		"golab-link-03":            {"com.docker.network.driver.mtu": "9000", "com.docker.network.bridge.inhibit_ipv4": "true", "com.docker.network.bridge.name": "gl-link-03"},
+		"lab1-core":                {"com.docker.network.bridge.name": "gl-lab1-core"},
+		"datacenter-golab-link-01": {"com.docker.network.bridge.name": "gl-datac-dad98a"},
+		// dual-stack links leave both address families without a gateway
+		"golab-link-04": {
+			"com.docker.network.bridge.inhibit_ipv4":      "true",
+			"com.docker.network.bridge.gateway_mode_ipv6": "isolated",
+			"com.docker.network.bridge.name":              "gl-link-04",
+		},
+	}
+	if diff := cmp.Diff(want, fdc.netOptions); diff != "" {
+		t.Errorf("network options mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkCreateDriver(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	links := []topology.Link{
+		{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24", Driver: "macvlan", NoGateway: true},
+		{Name: "golab-link-02", IPv4Subnet: "192.168.1.0/24", HostInterface: "enp3s0", Driver: "ipvlan"},
+		{Name: "golab-link-03", IPv4Subnet: "192.168.2.0/24", HostInterface: "enp3s0.100", DriverOpts: map[string]string{"macvlan_mode": "private"}},
+		{Name: "golab-link-04", IPv4Subnet: "10.1.4.0/24", Driver: "bridge", DriverOpts: map[string]string{"com.docker.network.bridge.enable_icc": "true"}},
+	}
+	for _, link := range links {
+		if err := dp.LinkCreate(ctx, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantDrivers := map[string]string{"golab-link-01": "macvlan", "golab-link-02": "ipvlan", "golab-link-03": "macvlan", "golab-link-04": "bridge"}
+	if diff := cmp.Diff(wantDrivers, fdc.netDrivers); diff != "" {
+		t.Errorf("drivers mismatch (-want +got):\n%s", diff)
+	}
+	// driver options override the ones set by golab
+	wantOpts := map[string]map[string]string{
+		"golab-link-01": nil,
+		"golab-link-02": {"parent": "enp3s0", "ipvlan_mode": "l2"},
+		"golab-link-03": {"parent": "enp3s0.100", "macvlan_mode": "private"},
+		"golab-link-04": {"com.docker.network.bridge.enable_icc": "true", "com.docker.network.bridge.name": "gl-link-04"},
+	}
+	if diff := cmp.Diff(wantOpts, fdc.netOptions); diff != "" {
+		t.Errorf("network options mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkCreateExternal(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	links := []topology.Link{
+		{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24"},
+		{Name: "golab-mgmt", IPv4Subnet: "10.255.254.0/23", External: true},
+	}
+	for _, link := range links {
+		if err := dp.LinkCreate(ctx, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]bool{"golab-link-01": true, "golab-mgmt": false}
+	if diff := cmp.Diff(want, fdc.netInternal); diff != "" {
+		t.Errorf("internal networks mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkCreateHostInterface(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	link := topology.Link{Name: "golab-link-01", IPv4Subnet: "192.168.1.0/24", HostInterface: "enp3s0", External: true}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if got := fdc.netDrivers[link.Name]; got != "macvlan" {
+		t.Errorf("driver: want %q, got %q", "macvlan", got)
+	}
+	if fdc.netInternal[link.Name] {
+		t.Error("network bridged to the host is internal")
+	}
+	wantOpts := map[string]string{"parent": "enp3s0", "macvlan_mode": "bridge"}
+	if diff := cmp.Diff(wantOpts, fdc.netOptions[link.Name]); diff != "" {
+		t.Errorf("options mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkCreateNoIP(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	out := new(strings.Builder)
+	dp := docker.New(fdc, logger.New(out, io.Discard))
+	link := topology.Link{Name: "golab-link-01", IP: topology.NoIP}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if ipam := fdc.netIPAM[link.Name]; len(ipam.Config) != 0 {
+		t.Errorf("IPAM configs: want none, got %v", ipam.Config)
+	}
+	wantMsg := "created docker network golab-link-01 without IP addressing"
+	if !strings.Contains(out.String(), wantMsg) {
+		t.Errorf("log: want %q, got %q", wantMsg, out.String())
+	}
+}
+
 func TestLinkExistsError(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -241,6 +679,30 @@ func TestLinkRemoveErrors(t *testing.T) {
 	}
 }
 
+func TestNodeCreateMounts(t *testing.T) {
+	t.Parallel()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{
+		Name:    "R1",
+		Image:   "quay.io/frrouting/frr:master",
+		Binds:   []string{"/lab/R1:/etc/frr"},
+		Volumes: []string{"flash:/mnt/flash"},
+		Tmpfs:   []string{"/var/run"},
+	}
+	if err := dp.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	want := []mount.Mount{
+		{Type: mount.TypeBind, Source: "/lab/R1", Target: "/etc/frr"},
+		{Type: mount.TypeVolume, Source: "flash", Target: "/mnt/flash"},
+		{Type: mount.TypeTmpfs, Target: "/var/run"},
+	}
+	if diff := cmp.Diff(want, fdc.hostConfigs["R1"].Mounts); diff != "" {
+		t.Errorf("mounts mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestNodeCreateRemove(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -301,6 +763,164 @@ func TestNodeCreateRemove(t *testing.T) {
 	}
 }
 
+func TestNodeCreatePull(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	outBuf := new(bytes.Buffer)
+	dp := docker.New(fdc, logger.New(outBuf, io.Discard))
+	node := topology.Node{Name: "R1", Image: "quay.io/frrouting/frr:master"}
+	fdc.missingImages[node.Image] = true
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	// layer statuses are logged once, while images present locally are not pulled again
+	if err := dp.NodeRemove(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{node.Image}, fdc.pulls); diff != "" {
+		t.Errorf("pulls mismatch (-want +got):\n%s", diff)
+	}
+	var got []string
+	for _, line := range strings.Split(outBuf.String(), "\n") {
+		if strings.Contains(line, "PROGRESS") {
+			got = append(got, line[strings.Index(line, "] ")+2:])
+		}
+	}
+	want := []string{
+		"pulling docker image quay.io/frrouting/frr:master",
+		"pulling docker image quay.io/frrouting/frr:master: layer master: pulling from frrouting/frr",
+		"pulling docker image quay.io/frrouting/frr:master: layer a1b2c3: pulling fs layer",
+		"pulling docker image quay.io/frrouting/frr:master: layer a1b2c3: downloading",
+		"pulling docker image quay.io/frrouting/frr:master: layer a1b2c3: pull complete",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("progress mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeCreatePullError(t *testing.T) {
+	t.Parallel()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1", Image: "quay.io/frrouting/frr:missing"}
+	fdc.missingImages[node.Image] = true
+	fdc.pullErr = "manifest unknown"
+	wantErr := "failed to pull docker image quay.io/frrouting/frr:missing: manifest unknown"
+	if err := dp.NodeCreate(context.Background(), node); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	if len(fdc.containers) != 0 {
+		t.Errorf("container count: want 0, got %d", len(fdc.containers))
+	}
+}
+
+func TestNodeCreateReady(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name      string
+		health    string
+		exitCode  int
+		wantExecs int
+		wantErr   string
+	}{
+		{
+			name:      "ReadyCommand",
+			wantExecs: 1,
+		},
+		{
+			name:      "ReadyCommandFails",
+			exitCode:  1,
+			wantExecs: 1,
+			wantErr:   "docker container R1 is not ready after 10ms",
+		},
+		{
+			name:   "Healthy",
+			health: container.Healthy,
+		},
+		{
+			name:    "Starting",
+			health:  container.Starting,
+			wantErr: "docker container R1 is not ready after 10ms",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			fdc := newFakeDockerClient()
+			fdc.health = tc.health
+			fdc.execExitCode = tc.exitCode
+			dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+			node := topology.Node{Name: "R1", ReadyCommand: []string{"vtysh", "-c", "show version"}, ReadyTimeout: "10ms"}
+			err := dp.NodeCreate(context.Background(), node)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.wantErr {
+				t.Errorf("error: want %q, got %q", tc.wantErr, errMsg)
+			}
+			// the health check of the image takes precedence over the ready command
+			if len(fdc.execs) != tc.wantExecs {
+				t.Errorf("exec count: want %d, got %d", tc.wantExecs, len(fdc.execs))
+			}
+		})
+	}
+}
+
+func TestRemoveUnowned(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	labels := map[string]string{topology.LabLabel: "lab"}
+	node := topology.Node{Name: "R1", Labels: labels}
+	link := topology.Link{Name: "golab-link-01", Labels: labels}
+	// objects sharing names with the lab ones, but created by someone else or for another lab
+	if _, err := fdc.ContainerCreate(ctx, &container.Config{}, nil, nil, nil, "lab-R1"); err != nil {
+		t.Fatal(err)
+	}
+	other := map[string]string{topology.LabLabel: "other", "golab.managed": "true"}
+	if _, err := fdc.NetworkCreate(ctx, "lab-golab-link-01", network.CreateOptions{Labels: other}); err != nil {
+		t.Fatal(err)
+	}
+	wantErr := "refusing to remove docker container lab-R1, which golab did not create for this lab"
+	if err := dp.NodeRemove(ctx, node); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	wantErr = "refusing to remove docker network lab-golab-link-01, which golab did not create for this lab"
+	if err := dp.LinkRemove(ctx, link); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	if len(fdc.containers) != 1 || len(fdc.networks) != 1 {
+		t.Errorf("objects: want 1 container and 1 network, got %d and %d", len(fdc.containers), len(fdc.networks))
+	}
+	// objects created by golab carry both labels
+	node.Name, link.Name = "R2", "golab-link-02"
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{topology.LabLabel: "lab", "golab.managed": "true"}
+	if diff := cmp.Diff(want, fdc.configs["lab-R2"].Labels); diff != "" {
+		t.Errorf("container labels mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, fdc.netLabels["lab-golab-link-02"]); diff != "" {
+		t.Errorf("network labels mismatch (-want +got):\n%s", diff)
+	}
+	if err := dp.NodeRemove(ctx, node); err != nil {
+		t.Error(err)
+	}
+	if err := dp.LinkRemove(ctx, link); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestNodeExistsError(t *testing.T) {
 	t.Parallel()
 	fdc := newFakeDockerClient()
@@ -369,3 +989,1144 @@ func TestNodeRemoveError(t *testing.T) {
 		t.Errorf("error: want %q, got %q", wantErr, err)
 	}
 }
+
+func TestNodeCreatePrivileges(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	nodes := []topology.Node{
+		{Name: "R1", Capabilities: []string{"NET_ADMIN", "NET_RAW"}},
+		{Name: "R2", Privileged: true},
+		{Name: "R3", Capabilities: []string{"NET_ADMIN"}, CapDrop: []string{"NET_RAW"}},
+	}
+	for _, node := range nodes {
+		if err := dp.NodeCreate(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+		hostConfig := fdc.hostConfigs[node.Name]
+		if hostConfig.Privileged != node.Privileged {
+			t.Errorf("%s privileged: want %v, got %v", node.Name, node.Privileged, hostConfig.Privileged)
+		}
+		if !slices.Equal(hostConfig.CapAdd, node.Capabilities) {
+			t.Errorf("%s capabilities: want %v, got %v", node.Name, node.Capabilities, hostConfig.CapAdd)
+		}
+		if !slices.Equal(hostConfig.CapDrop, node.CapDrop) {
+			t.Errorf("%s dropped capabilities: want %v, got %v", node.Name, node.CapDrop, hostConfig.CapDrop)
+		}
+	}
+}
+
+func TestNodeCreateRestart(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	for _, node := range []topology.Node{
+		{Name: "R1"},
+		{Name: "R2", Restart: "no"},
+		{Name: "R3", Restart: "on-failure"},
+		{Name: "R4", Restart: "unless-stopped"},
+	} {
+		if err := dp.NodeCreate(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+		hostConfig := fdc.hostConfigs[node.Name]
+		// containers are kept on exit, so that they can be started again
+		if hostConfig.AutoRemove {
+			t.Errorf("%s auto remove: want false, got true", node.Name)
+		}
+		if got := string(hostConfig.RestartPolicy.Name); got != node.Restart {
+			t.Errorf("%s restart policy: want %q, got %q", node.Name, node.Restart, got)
+		}
+	}
+}
+
+func TestNodeCreateResources(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	testCases := []struct {
+		node topology.Node
+		want container.Resources
+	}{
+		{
+			node: topology.Node{Name: "R1", CPUs: 1.5, Memory: "512m"},
+			want: container.Resources{NanoCPUs: 1_500_000_000, Memory: 512 * 1024 * 1024},
+		},
+		{
+			node: topology.Node{Name: "R2"},
+			want: container.Resources{},
+		},
+		{
+			node: topology.Node{Name: "R3", Devices: []string{"/dev/kvm"}},
+			want: container.Resources{
+				Devices: []container.DeviceMapping{{PathOnHost: "/dev/kvm", PathInContainer: "/dev/kvm", CgroupPermissions: "rwm"}},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		if err := dp.NodeCreate(ctx, tc.node); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.want, fdc.hostConfigs[tc.node.Name].Resources); diff != "" {
+			t.Errorf("%s resources mismatch (-want +got):\n%s", tc.node.Name, diff)
+		}
+	}
+}
+
+func TestNodeCreateCommand(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{
+		Name:       "R1",
+		Image:      "alpine:latest",
+		Cmd:        []string{"-c", "sleep infinity"},
+		Entrypoint: []string{"/bin/sh"},
+	}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	config := fdc.configs[node.Name]
+	if !slices.Equal(config.Cmd, node.Cmd) {
+		t.Errorf("cmd: want %v, got %v", node.Cmd, config.Cmd)
+	}
+	if !slices.Equal(config.Entrypoint, node.Entrypoint) {
+		t.Errorf("entrypoint: want %v, got %v", node.Entrypoint, config.Entrypoint)
+	}
+}
+
+func TestNodeCreatePorts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1", Ports: []string{"2222:22", "127.0.0.1:8443:443/tcp"}}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	wantExposed := nat.PortSet{"22/tcp": {}, "443/tcp": {}}
+	if diff := cmp.Diff(wantExposed, fdc.configs[node.Name].ExposedPorts); diff != "" {
+		t.Errorf("exposed ports mismatch (-want +got):\n%s", diff)
+	}
+	wantBindings := nat.PortMap{
+		"22/tcp":  {{HostPort: "2222"}},
+		"443/tcp": {{HostIP: "127.0.0.1", HostPort: "8443"}},
+	}
+	if diff := cmp.Diff(wantBindings, fdc.hostConfigs[node.Name].PortBindings); diff != "" {
+		t.Errorf("port bindings mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDebugOptions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	out := new(strings.Builder)
+	log := logger.New(out, io.Discard)
+	log.SetLevel(logger.LevelDebug)
+	dp := docker.New(newFakeDockerClient(), log)
+	link := topology.Link{Name: "golab-link-01", IPv4Subnet: "100.64.0.0/29"}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	node := topology.Node{Name: "R1", Image: "alpine", Env: map[string]string{"PASSWORD": "s3cr3t"}}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`submitting docker network golab-link-01 options: {`,
+		`"Subnet":"100.64.0.0/29"`,
+		`submitting docker container R1 options: {`,
+		`"Image":"alpine"`,
+		`"Env":["PASSWORD=<redacted>"]`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("debug output: want %q in\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("debug output: want environment values redacted, got\n%s", out.String())
+	}
+}
+
+func TestNodeCreateMgmt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{
+		Name:       "R1",
+		Interfaces: []*topology.Interface{{Name: "eth0", Link: "golab-link-01", IPv4Addr: "10.1.2.1/24"}},
+		Mgmt: &topology.Interface{
+			Name:     "mgmt0",
+			Link:     "golab-mgmt",
+			IPv4Addr: "10.255.254.1/23",
+			Aliases:  []string{"R1.triangle"},
+		},
+		DNSDomain: "triangle",
+	}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	endpoints := fdc.netConfigs["R1"].EndpointsConfig
+	if len(endpoints) != 2 {
+		t.Fatalf("endpoints: want 2, got %d", len(endpoints))
+	}
+	if got := endpoints["golab-mgmt"].IPAMConfig.IPv4Address; got != "10.255.254.1" {
+		t.Errorf("mgmt address: want %q, got %q", "10.255.254.1", got)
+	}
+	if got := endpoints["golab-mgmt"].Aliases; !slices.Equal(got, node.Mgmt.Aliases) {
+		t.Errorf("mgmt aliases: want %v, got %v", node.Mgmt.Aliases, got)
+	}
+	if got := fdc.hostConfigs["R1"].DNSSearch; !slices.Equal(got, []string{"triangle"}) {
+		t.Errorf("dns search: want [triangle], got %v", got)
+	}
+}
+
+func TestNodeCreateSidecar(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	sidecar := topology.Node{
+		Name:        "R1-ssh",
+		Env:         map[string]string{"USER_NAME": "golab", "LISTEN_PORT": "2222"},
+		NetworkMode: "container:R1",
+		PIDMode:     "container:R1",
+	}
+	if err := dp.NodeCreate(ctx, sidecar); err != nil {
+		t.Fatal(err)
+	}
+	config, hostConfig := fdc.configs["R1-ssh"], fdc.hostConfigs["R1-ssh"]
+	if config.Hostname != "" {
+		t.Errorf("hostname: want \"\", got %q", config.Hostname)
+	}
+	wantEnv := []string{"LISTEN_PORT=2222", "USER_NAME=golab"}
+	if !slices.Equal(config.Env, wantEnv) {
+		t.Errorf("env: want %v, got %v", wantEnv, config.Env)
+	}
+	if hostConfig.NetworkMode != "container:R1" || hostConfig.PidMode != "container:R1" {
+		t.Errorf("namespaces: want container:R1, got %s and %s", hostConfig.NetworkMode, hostConfig.PidMode)
+	}
+	if fdc.netConfigs["R1-ssh"] != nil {
+		t.Errorf("network config: want nil, got %v", fdc.netConfigs["R1-ssh"])
+	}
+}
+
+func TestNodePauseUnpause(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	// both operations are idempotent
+	for range 2 {
+		if err := dp.NodePause(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !fdc.paused["R1"] {
+		t.Fatal("container is not paused")
+	}
+	for range 2 {
+		if err := dp.NodeUnpause(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fdc.paused["R1"] {
+		t.Fatal("container is still paused")
+	}
+	wantMsg := "container R2 does not exist"
+	if err := dp.NodePause(ctx, topology.Node{Name: "R2"}); err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestNodeExec(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	fdc.execExitCode = 2
+	stdout, stderr := new(strings.Builder), new(strings.Builder)
+	exitCode, err := dp.NodeExec(ctx, node, []string{"vtysh", "-c", "show version"}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 2 {
+		t.Errorf("exit code: want 2, got %d", exitCode)
+	}
+	if stdout.String() != "vtysh -c show version" {
+		t.Errorf("stdout: want %q, got %q", "vtysh -c show version", stdout.String())
+	}
+	if stderr.String() != "warning" {
+		t.Errorf("stderr: want %q, got %q", "warning", stderr.String())
+	}
+}
+
+func TestNodeExecError(t *testing.T) {
+	t.Parallel()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	wantErr := errors.New("failed to create exec")
+	fdc.execCreateErr = wantErr
+	_, err := dp.NodeExec(context.Background(), topology.Node{Name: "R1"}, []string{"true"}, io.Discard, io.Discard)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("error: want %q, got %q", wantErr, err)
+	}
+}
+
+func TestNodeShell(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	out := new(strings.Builder)
+	tty := topology.TTY{In: strings.NewReader("show version\n"), Out: out, Height: 24, Width: 80}
+	exitCode, err := dp.NodeShell(ctx, node, []string{"vtysh"}, tty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 0 {
+		t.Errorf("exit code: want 0, got %d", exitCode)
+	}
+	if out.String() != "vtysh\n" {
+		t.Errorf("output: want %q, got %q", "vtysh\n", out.String())
+	}
+}
+
+func TestNodeLogs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		follow     bool
+		tail       int
+		wantStdout string
+	}{
+		{name: "All", tail: -1, wantStdout: "follow=false tail=all\n"},
+		{name: "FollowTail", follow: true, tail: 10, wantStdout: "follow=true tail=10\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout, stderr := new(strings.Builder), new(strings.Builder)
+			if err := dp.NodeLogs(ctx, node, tc.follow, tc.tail, stdout, stderr); err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantStdout != stdout.String() {
+				t.Errorf("stdout: want %q, got %q", tc.wantStdout, stdout.String())
+			}
+			if stderr.String() != "zebra: warning\n" {
+				t.Errorf("stderr: want %q, got %q", "zebra: warning\n", stderr.String())
+			}
+		})
+	}
+	wantMsg := "container R2 does not exist"
+	err := dp.NodeLogs(ctx, topology.Node{Name: "R2"}, false, -1, io.Discard, io.Discard)
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dp.NodeStats(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := topology.NodeStats{
+		CPUPercent: 40,
+		MemUsage:   48 << 20,
+		MemLimit:   1 << 30,
+		RxBytes:    400,
+		TxBytes:    600,
+		RxPackets:  4,
+		TxPackets:  6,
+		Interfaces: []topology.InterfaceStats{
+			{Name: "eth0", RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2, TxErrors: 1},
+			{Name: "eth1", RxBytes: 300, TxBytes: 400, RxPackets: 3, TxPackets: 4, RxDropped: 1},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("node stats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeStatsCacheExceedsUsage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	fdc.inactiveFile = 128 << 20
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dp.NodeStats(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MemUsage != 0 {
+		t.Errorf("memory usage: want 0, got %d", got.MemUsage)
+	}
+}
+
+func TestNodeCreateLabPrefix(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	labels := map[string]string{topology.LabLabel: "triangle"}
+	link := topology.Link{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24", Labels: labels}
+	node := topology.Node{
+		Name:       "R1",
+		Image:      "quay.io/frrouting/frr:master",
+		Interfaces: []*topology.Interface{{Name: "eth0", Link: link.Name, IPv4Addr: "10.1.2.1/24"}},
+		Labels:     labels,
+	}
+	sidecar := topology.Node{Name: "R1-ssh", Image: "openssh", NetworkMode: "container:R1", PIDMode: "container:R1", Labels: labels}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []topology.Node{node, sidecar} {
+		if err := dp.NodeCreate(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := fdc.networks["triangle-golab-link-01"]; !ok {
+		t.Errorf("networks: want triangle-golab-link-01, got %v", slices.Sorted(maps.Keys(fdc.networks)))
+	}
+	if got := slices.Sorted(maps.Keys(fdc.containers)); !slices.Equal(got, []string{"triangle-R1", "triangle-R1-ssh"}) {
+		t.Errorf("containers: want [triangle-R1 triangle-R1-ssh], got %v", got)
+	}
+	if got := fdc.configs["triangle-R1"].Hostname; got != "R1" {
+		t.Errorf("hostname: want R1, got %q", got)
+	}
+	if _, ok := fdc.netConfigs["triangle-R1"].EndpointsConfig["triangle-golab-link-01"]; !ok {
+		t.Errorf("endpoints: want triangle-golab-link-01, got %v", slices.Sorted(maps.Keys(fdc.netConfigs["triangle-R1"].EndpointsConfig)))
+	}
+	if got := fdc.hostConfigs["triangle-R1-ssh"].NetworkMode; got != "container:triangle-R1" {
+		t.Errorf("network mode: want container:triangle-R1, got %q", got)
+	}
+	if err := dp.NodeRemove(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fdc.containers["triangle-R1"]; ok {
+		t.Error("container triangle-R1 was not removed")
+	}
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCases := []struct {
+		name    string
+		lab     string
+		wantNet []string
+		wantCon []string
+	}{
+		{
+			name:    "AllLabs",
+			wantNet: []string{"unmanaged"},
+			wantCon: []string{"unmanaged"},
+		},
+		{
+			name:    "SingleLab",
+			lab:     "old",
+			wantNet: []string{"new-link", "unmanaged"},
+			wantCon: []string{"new-R2", "unmanaged"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			fdc := newFakeDockerClient()
+			dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+			for _, link := range []topology.Link{
+				{Name: "link", Labels: map[string]string{topology.LabLabel: "old"}},
+				{Name: "link", Labels: map[string]string{topology.LabLabel: "new"}},
+				{Name: "unmanaged"},
+			} {
+				if err := dp.LinkCreate(ctx, link); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, node := range []topology.Node{
+				{Name: "R1", Labels: map[string]string{topology.LabLabel: "old"}},
+				{Name: "R2", Labels: map[string]string{topology.LabLabel: "new"}},
+				{Name: "unmanaged"},
+			} {
+				if err := dp.NodeCreate(ctx, node); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := dp.RemoveOrphans(ctx, tc.lab); err != nil {
+				t.Fatal(err)
+			}
+			gotNet := slices.Sorted(maps.Keys(fdc.networks))
+			if !slices.Equal(gotNet, tc.wantNet) {
+				t.Errorf("networks: want %v, got %v", tc.wantNet, gotNet)
+			}
+			gotCon := slices.Sorted(maps.Keys(fdc.containers))
+			if !slices.Equal(gotCon, tc.wantCon) {
+				t.Errorf("containers: want %v, got %v", tc.wantCon, gotCon)
+			}
+		})
+	}
+}
+
+func TestDeployed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	labels := map[string]string{topology.LabLabel: "lab"}
+	wantLinks := []topology.Link{
+		{Name: "golab-link-01", Labels: labels, IPv4Subnet: "10.1.2.0/24", IPv6Subnet: "2001:db8:1:2::/64", MTU: 9000},
+	}
+	wantNodes := []topology.Node{
+		{
+			Name:       "R1",
+			Image:      "quay.io/frrouting/frr:master",
+			Labels:     labels,
+			Interfaces: []*topology.Interface{{Link: "golab-link-01", IPv4Addr: "10.1.2.1"}},
+		},
+	}
+	if err := dp.LinkCreate(ctx, wantLinks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.LinkCreate(ctx, topology.Link{Name: "unmanaged"}); err != nil {
+		t.Fatal(err)
+	}
+	node := wantNodes[0]
+	node.Interfaces = []*topology.Interface{{Name: "eth0", Link: "golab-link-01", IPv4Addr: "10.1.2.1/24", IPv6Addr: "2001:db8:1:2::1/64"}}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.NodeCreate(ctx, topology.Node{Name: "unmanaged"}); err != nil {
+		t.Fatal(err)
+	}
+	gotNodes, gotLinks, err := dp.Deployed(ctx, "lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantNodes, gotNodes); diff != "" {
+		t.Errorf("nodes mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantLinks, gotLinks); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngineResolve(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_CONTEXT", "")
+	// contexts are stored under the SHA-256 digest of their names
+	digest := sha256.Sum256([]byte("lab-server"))
+	meta := filepath.Join(dir, "contexts", "meta", hex.EncodeToString(digest[:]))
+	if err := os.MkdirAll(meta, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"Name":"lab-server","Endpoints":{"docker":{"Host":"ssh://golab@lab-server","SkipTLSVerify":false}}}`
+	if err := os.WriteFile(filepath.Join(meta, "meta.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resolve := func(engine docker.Engine) string {
+		t.Helper()
+		host, err := engine.Resolve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return host
+	}
+	if got := resolve(docker.Engine{}); got != "" {
+		t.Errorf("local engine: want %q, got %q", "", got)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"currentContext":"lab-server"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolve(docker.Engine{}); got != "ssh://golab@lab-server" {
+		t.Errorf("current context: want %q, got %q", "ssh://golab@lab-server", got)
+	}
+	t.Setenv("DOCKER_CONTEXT", "default")
+	if got := resolve(docker.Engine{}); got != "" {
+		t.Errorf("DOCKER_CONTEXT: want %q, got %q", "", got)
+	}
+	t.Setenv("DOCKER_HOST", "tcp://10.0.0.1:2375")
+	if got := resolve(docker.Engine{}); got != "tcp://10.0.0.1:2375" {
+		t.Errorf("DOCKER_HOST: want %q, got %q", "tcp://10.0.0.1:2375", got)
+	}
+	// flags take precedence over the environment
+	if got := resolve(docker.Engine{Context: "lab-server"}); got != "ssh://golab@lab-server" {
+		t.Errorf("context flag: want %q, got %q", "ssh://golab@lab-server", got)
+	}
+	if got := resolve(docker.Engine{Host: "unix:///run/docker.sock", Context: "lab-server"}); got != "unix:///run/docker.sock" {
+		t.Errorf("host flag: want %q, got %q", "unix:///run/docker.sock", got)
+	}
+	wantErr := `docker context "missing" does not exist`
+	if _, err := (docker.Engine{Context: "missing"}).Resolve(); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	wantErr = `invalid docker host "ssh://golab@lab-server/var/run/docker.sock", e.g. ssh://user@server expected`
+	if _, err := (docker.Engine{Host: "ssh://golab@lab-server/var/run/docker.sock"}).ClientOpts(); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	if _, err := (docker.Engine{Host: "ssh://golab@lab-server:2222"}).ClientOpts(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNodeCreateVeth(t *testing.T) {
+	t.Parallel()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{
+		Name: "R1",
+		Interfaces: []*topology.Interface{
+			{Name: "eth1", Link: "golab-link-1", Veth: true},
+			{Name: "eth2", Link: "golab-link-2"},
+		},
+	}
+	if err := dp.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	got := slices.Collect(maps.Keys(fdc.netConfigs["R1"].EndpointsConfig))
+	if !slices.Equal(got, []string{"golab-link-2"}) {
+		t.Errorf("endpoints: want [golab-link-2], got %v", got)
+	}
+}
+
+func TestLinkConnectErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	link := topology.Link{Name: "golab-link-1", Endpoints: []string{"R1", "R2"}, Type: topology.LinkTypeVeth}
+	attached := []*topology.Interface{{Name: "eth1", Link: "golab-link-1", Veth: true}}
+	for _, name := range []string{"R1", "R2", "R3"} {
+		if err := dp.NodeCreate(ctx, topology.Node{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testCases := []struct {
+		name   string
+		nodes  []topology.Node
+		errMsg string
+	}{
+		{
+			name:   "OneNode",
+			nodes:  []topology.Node{{Name: "R1", Interfaces: attached}},
+			errMsg: "veth link golab-link-1 requires exactly two nodes, got 1",
+		},
+		{
+			name:   "MissingContainer",
+			nodes:  []topology.Node{{Name: "R1", Interfaces: attached}, {Name: "R9", Interfaces: attached}},
+			errMsg: "container R9 does not exist",
+		},
+		{
+			name:   "NotAttached",
+			nodes:  []topology.Node{{Name: "R1", Interfaces: attached}, {Name: "R3"}},
+			errMsg: "node R3 is not attached to link golab-link-1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := dp.LinkConnect(ctx, link, tc.nodes)
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestLinkConnectVethRemoteEngine(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	fdc.host = "tcp://lab-server:2376"
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	link := topology.Link{Name: "golab-link-1", Endpoints: []string{"R1", "R2"}, Type: topology.LinkTypeVeth}
+	attached := []*topology.Interface{{Name: "eth1", Link: "golab-link-1", Veth: true}}
+	nodes := []topology.Node{{Name: "R1", Interfaces: attached}, {Name: "R2", Interfaces: attached}}
+	wantMsg := "veth link golab-link-1 requires the docker engine to run on this host, got tcp://lab-server:2376"
+	if err := dp.LinkConnect(ctx, link, nodes); err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+	if err := dp.LinkDisconnect(ctx, link, nodes[:1]); err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestNodeCreateVethOnly(t *testing.T) {
+	t.Parallel()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	nodes := []topology.Node{
+		{Name: "R1", Interfaces: []*topology.Interface{{Name: "eth0", Link: "golab-link-01", Veth: true}}},
+		{Name: "R2", Interfaces: []*topology.Interface{{Name: "eth0", Link: "golab-link-01", Veth: true}, {Name: "eth1", Link: "golab-link-02"}}},
+	}
+	for _, node := range nodes {
+		if err := dp.NodeCreate(context.Background(), node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the default bridge would take eth0 of R1 otherwise
+	if got := fdc.hostConfigs["R1"].NetworkMode; got != "none" {
+		t.Errorf("R1 network mode: want none, got %q", got)
+	}
+	if got := fdc.hostConfigs["R2"].NetworkMode; got != "" {
+		t.Errorf("R2 network mode: want default, got %q", got)
+	}
+}
+
+func TestNodeStopStart(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	// stopping and starting twice is a no-op the second time
+	for range 2 {
+		if err := dp.NodeStop(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := fdc.containers["R1"]; !ok || !fdc.stopped["R1"] {
+		t.Fatalf("container: want stopped but kept, got stopped=%v", fdc.stopped["R1"])
+	}
+	running, err := dp.NodeRunning(ctx, node)
+	if err != nil || running {
+		t.Errorf("running: want false, got %v (error %v)", running, err)
+	}
+	for range 2 {
+		if err := dp.NodeStart(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fdc.stopped["R1"] || fdc.starts["R1"] != 2 {
+		t.Errorf("starts: want 2 and running, got %d and stopped=%v", fdc.starts["R1"], fdc.stopped["R1"])
+	}
+	// building a stopped node starts its container rather than creating a new one
+	if err := dp.NodeStop(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if fdc.stopped["R1"] || fdc.starts["R1"] != 3 {
+		t.Errorf("starts: want 3 and running, got %d and stopped=%v", fdc.starts["R1"], fdc.stopped["R1"])
+	}
+	errMsg := "container R9 does not exist"
+	if err := dp.NodeStop(ctx, topology.Node{Name: "R9"}); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestNodeCommit(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	var stdout bytes.Buffer
+	dp := docker.New(fdc, logger.New(&stdout, io.Discard))
+	node := topology.Node{Name: "R1", Image: "frrouting/frr:latest"}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	ref := topology.SnapshotImage("lab", "R1", "v1")
+	if err := dp.NodeCommit(ctx, node, ref); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"R1": ref}, fdc.commits); diff != "" {
+		t.Errorf("commits: (-want +got)\n%s", diff)
+	}
+	want := "committed docker container R1 to image golab-snapshot/lab/r1:v1, id=0123456789ab"
+	if !strings.Contains(stdout.String(), want) {
+		t.Errorf("log: want %q, got %q", want, stdout.String())
+	}
+	errMsg := "container R9 does not exist"
+	if err := dp.NodeCommit(ctx, topology.Node{Name: "R9"}, ref); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestLinkConnectDisconnect(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	link := topology.Link{Name: "golab-link-2", Endpoints: []string{"R1", "R2"}}
+	iface := &topology.Interface{Name: "eth1", Link: "golab-link-2", IPv4Addr: "10.1.2.1/24", IPv6Addr: "2001:db8:1:2::1/64"}
+	node := topology.Node{Name: "R1", Interfaces: []*topology.Interface{iface}}
+	if err := dp.NodeCreate(ctx, topology.Node{Name: "R1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	// connecting twice is a no-op the second time
+	for range 2 {
+		if err := dp.LinkConnect(ctx, link, []topology.Node{node}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := &network.EndpointSettings{
+		IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "10.1.2.1", IPv6Address: "2001:db8:1:2::1"},
+		DriverOpts: map[string]string{"com.docker.network.endpoint.ifname": "eth1"},
+	}
+	if diff := cmp.Diff(want, fdc.netConfigs["R1"].EndpointsConfig["golab-link-2"]); diff != "" {
+		t.Errorf("endpoint mismatch (-want +got):\n%s", diff)
+	}
+	for range 2 {
+		if err := dp.LinkDisconnect(ctx, link, []topology.Node{node}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := fdc.netConfigs["R1"].EndpointsConfig["golab-link-2"]; ok {
+		t.Error("endpoint: want disconnected, got connected")
+	}
+	errMsg := "node R2 is not attached to link golab-link-2"
+	if err := dp.LinkConnect(ctx, link, []topology.Node{{Name: "R2"}}); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	var out bytes.Buffer
+	dp := docker.New(fdc, logger.New(&out, &out))
+	link := topology.Link{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24"}
+	node := topology.Node{
+		Name:       "R1",
+		Image:      "quay.io/frrouting/frr:master",
+		Binds:      []string{"/lab/R1:/etc/frr"},
+		Interfaces: []*topology.Interface{{Name: "eth0", Link: "golab-link-01", IPv4Addr: "10.1.2.1/24"}},
+	}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	// drifted objects are kept by default
+	link.IPv4Subnet = "10.1.3.0/24"
+	node.Image = "quay.io/frrouting/frr:latest"
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"docker network golab-link-01 does not match the topology: ipv4_subnet 10.1.2.0/24 -> 10.1.3.0/24, kept as is",
+		"docker container R1 does not match the topology: image quay.io/frrouting/frr:master -> quay.io/frrouting/frr:latest, kept as is",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log: want %q, got %q", want, out.String())
+		}
+	}
+	dp.SetDriftPolicy(docker.DriftError)
+	node.Binds = nil
+	errMsg := "docker container R1 does not match the topology: image quay.io/frrouting/frr:master -> quay.io/frrouting/frr:latest, mounts [/lab/R1:/etc/frr] -> []"
+	if err := dp.NodeCreate(ctx, node); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	// recreating a network recreates the containers attached to it along with their nodes
+	dp.SetDriftPolicy(docker.DriftRecreate)
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fdc.containers["R1"]; ok {
+		t.Error("container: want removed along with the network, got kept")
+	}
+	if got := fdc.netIPAM["golab-link-01"].Config[0].Subnet; got != link.IPv4Subnet {
+		t.Errorf("subnet: want %s, got %s", link.IPv4Subnet, got)
+	}
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	node.Image = "quay.io/frrouting/frr:10.3.1"
+	if err := dp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if got := fdc.configs["R1"].Image; got != node.Image {
+		t.Errorf("image: want %s, got %s", node.Image, got)
+	}
+}
+
+func TestDriftRecreateForeignContainer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	dp.SetDriftPolicy(docker.DriftRecreate)
+	link := topology.Link{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24"}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	// a container created outside of golab is attached to the network of the lab
+	netConfig := &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{"golab-link-01": {}}}
+	if _, err := fdc.ContainerCreate(ctx, &container.Config{Image: "alpine"}, &container.HostConfig{}, netConfig, nil, "tcpdump"); err != nil {
+		t.Fatal(err)
+	}
+	link.IPv4Subnet = "10.1.3.0/24"
+	errMsg := "refusing to recreate docker network golab-link-01, as docker container tcpdump attached to it was not created by golab for this lab"
+	if err := dp.LinkCreate(ctx, link); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	if _, ok := fdc.containers["tcpdump"]; !ok {
+		t.Error("container: want kept, got removed")
+	}
+	if got := fdc.netIPAM["golab-link-01"].Config[0].Subnet; got != "10.1.2.0/24" {
+		t.Errorf("subnet: want 10.1.2.0/24 kept, got %s", got)
+	}
+}
+
+func TestParseDriftPolicy(t *testing.T) {
+	t.Parallel()
+	if policy, err := docker.ParseDriftPolicy("recreate"); err != nil || policy != docker.DriftRecreate {
+		t.Errorf("policy: want %q, got %q (error %v)", docker.DriftRecreate, policy, err)
+	}
+	errMsg := `unsupported drift policy "ignore", supported: warn/error/recreate`
+	if _, err := docker.ParseDriftPolicy("ignore"); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestNodeCreateCrash(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	var stderr bytes.Buffer
+	dp := docker.New(fdc, logger.New(io.Discard, &stderr))
+	fdc.exitCodes["R1"] = 139
+	node := topology.Node{Name: "R1", MinUptime: "10ms"}
+	errMsg := "docker container R1 exited with code 139 while starting"
+	if err := dp.NodeCreate(ctx, node); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	// the last log lines of the container are reported
+	for _, want := range []string{"follow=false tail=20", "zebra: warning"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("log: want %q, got %q", want, stderr.String())
+		}
+	}
+	// a container which keeps running for the minimum uptime is started
+	if err := dp.NodeCreate(ctx, topology.Node{Name: "R2", MinUptime: "10ms"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNodeRemoveGraceful(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	var stderr bytes.Buffer
+	dp := docker.New(fdc, logger.New(io.Discard, &stderr))
+	nodes := []topology.Node{{Name: "R1"}, {Name: "R2", StopTimeout: "59.5s"}, {Name: "R3"}}
+	for _, node := range nodes {
+		if err := dp.NodeCreate(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// fractions of a second are rounded up
+	if got := *fdc.configs["R2"].StopTimeout; got != 60 {
+		t.Errorf("container stop timeout: want 60, got %d", got)
+	}
+	// stopped containers are removed right away
+	if err := dp.NodeStop(ctx, nodes[2]); err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range nodes {
+		if err := dp.NodeRemove(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff(map[string]int{"R1": 10, "R2": 60}, fdc.stopTimeouts); diff != "" {
+		t.Errorf("stop timeouts mismatch (-want +got):\n%s", diff)
+	}
+	// containers failing to stop are removed by force
+	fdc.containerStopErr = errors.New("permission denied")
+	if err := dp.NodeCreate(ctx, nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.NodeRemove(ctx, nodes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(fdc.containers) != 0 {
+		t.Errorf("container count: want 0, got %d", len(fdc.containers))
+	}
+	want := "failed to stop docker container R1 gracefully, removing it by force: permission denied"
+	if !strings.Contains(stderr.String(), want) {
+		t.Errorf("log: want %q, got %q", want, stderr.String())
+	}
+}
+
+func TestStitch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fdc := newFakeDockerClient()
+	dp := docker.New(fdc, logger.New(io.Discard, io.Discard))
+	link := topology.Link{Name: "golab-link-01", Tunnel: &topology.Tunnel{VNI: 0xab12, Port: 4789, Image: "nicolaka/netshoot:latest"}}
+	if err := dp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.Stitch(ctx, link, "192.0.2.1", []string{"192.0.2.2", "192.0.2.3"}); err != nil {
+		t.Fatal(err)
+	}
+	helper := "golab-vx-00ab12"
+	wantCmd := []string{"sh", "-c", "ip link del vx-00ab12 2>/dev/null || true" +
+		" && ip link add vx-00ab12 type vxlan id 43794 local 192.0.2.1 dstport 4789" +
+		" && bridge fdb append 00:00:00:00:00:00 dev vx-00ab12 dst 192.0.2.2" +
+		" && bridge fdb append 00:00:00:00:00:00 dev vx-00ab12 dst 192.0.2.3" +
+		" && ip link set vx-00ab12 master gl-link-01 up"}
+	if diff := cmp.Diff(wantCmd, []string(fdc.configs[helper].Cmd)); diff != "" {
+		t.Errorf("helper command mismatch (-want +got):\n%s", diff)
+	}
+	if got := fdc.hostConfigs[helper].NetworkMode; got != "host" {
+		t.Errorf("helper network mode: want host, got %s", got)
+	}
+	// the helper container is removed once the script exits
+	if _, ok := fdc.containers[helper]; ok {
+		t.Errorf("want helper container %s removed", helper)
+	}
+	fdc.exitCodes[helper] = 2
+	errMsg := "failed to unstitch link golab-link-01: script exited with code 2: follow=false tail=20\nzebra: warning"
+	if err := dp.Unstitch(ctx, link); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	errMsg = "link golab-link-02 does not have a tunnel"
+	if err := dp.Stitch(ctx, topology.Link{Name: "golab-link-02"}, "192.0.2.1", nil); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	// bridges named in driver_opts are stitched under that name
+	link.DriverOpts = map[string]string{"com.docker.network.bridge.name": "br-core"}
+	delete(fdc.exitCodes, helper)
+	if err := dp.Stitch(ctx, link, "192.0.2.1", []string{"192.0.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+	wantTail := "ip link set vx-00ab12 master br-core up"
+	if got := fdc.configs[helper].Cmd[2]; !strings.HasSuffix(got, wantTail) {
+		t.Errorf("helper command: want suffix %q, got %q", wantTail, got)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	t.Parallel()
+	topo := &topology.Topology{
+		Name: "Lab.1",
+		Nodes: map[string]*topology.Node{
+			"R1": {
+				Name:   "R1",
+				Image:  "quay.io/frrouting/frr:master",
+				Labels: map[string]string{topology.LabLabel: "lab1"},
+				Env:    map[string]string{"PROMPT": "$HOSTNAME"},
+				Binds:  []string{"/lab/R1:/etc/frr"},
+				Interfaces: []*topology.Interface{
+					{Name: "eth1", Link: "golab-link-01", IPv4Addr: "10.1.2.1/24"},
+				},
+				Sidecars: []*topology.Node{{
+					Name:        "R1-ssh",
+					Image:       "linuxserver/openssh-server",
+					Labels:      map[string]string{topology.LabLabel: "lab1"},
+					NetworkMode: "container:R1",
+					PIDMode:     "container:R1",
+				}},
+			},
+		},
+		Links: []*topology.Link{{
+			Name:        "golab-link-01",
+			Endpoints:   []string{"R1"},
+			IPv4Subnet:  "10.1.2.0/24",
+			IPv4Gateway: "10.1.2.254",
+			MTU:         9000,
+			Labels:      map[string]string{topology.LabLabel: "lab1"},
+		}},
+	}
+	var out bytes.Buffer
+	if err := docker.Compose(topo, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := `name: lab-1
+services:
+  R1:
+    container_name: lab1-R1
+    hostname: R1
+    image: quay.io/frrouting/frr:master
+    environment:
+      PROMPT: $$HOSTNAME
+    labels:
+      golab.lab: lab1
+      golab.managed: "true"
+    init: true
+    volumes:
+      - /lab/R1:/etc/frr
+    stop_grace_period: 10s
+    networks:
+      golab-link-01:
+        ipv4_address: 10.1.2.1
+  R1-ssh:
+    container_name: lab1-R1-ssh
+    image: linuxserver/openssh-server
+    labels:
+      golab.lab: lab1
+      golab.managed: "true"
+    init: true
+    stop_grace_period: 10s
+    network_mode: container:lab1-R1
+    pid: container:lab1-R1
+    depends_on:
+      - R1
+networks:
+  golab-link-01:
+    name: lab1-golab-link-01
+    driver_opts:
+      com.docker.network.bridge.name: gl-lab1-link-01
+      com.docker.network.driver.mtu: "9000"
+    internal: true
+    ipam:
+      config:
+        - subnet: 10.1.2.0/24
+          gateway: 10.1.2.254
+    labels:
+      golab.lab: lab1
+      golab.managed: "true"
+`
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("compose file mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/elupevg/golab/topology"
+)
+
+// DriftPolicy decides what happens to a Docker object which already exists but no longer matches
+// the topology entity it represents, e.g. after the topology was edited while the lab was down.
+type DriftPolicy string
+
+const (
+	// DriftWarn keeps the object and warns about the differences, which is the default.
+	DriftWarn DriftPolicy = "warn"
+	// DriftError fails on the object.
+	DriftError DriftPolicy = "error"
+	// DriftRecreate removes the object and creates it anew.
+	DriftRecreate DriftPolicy = "recreate"
+)
+
+// ParseDriftPolicy converts the name of a drift policy into a DriftPolicy.
+func ParseDriftPolicy(name string) (DriftPolicy, error) {
+	switch policy := DriftPolicy(name); policy {
+	case DriftWarn, DriftError, DriftRecreate:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unsupported drift policy %q, supported: warn/error/recreate", name)
+}
+
+// SetDriftPolicy selects what LinkCreate and NodeCreate do with existing objects which do not match the topology.
+func (dp *DockerProvider) SetDriftPolicy(policy DriftPolicy) {
+	dp.drift = policy
+}
+
+// drifted applies the drift policy to a Docker object differing from its topology entity
+// and tells whether the object has to be recreated.
+func (dp *DockerProvider) drifted(resource, object string, diffs []string) (bool, error) {
+	msg := fmt.Sprintf("%s does not match the topology: %s", object, strings.Join(diffs, ", "))
+	switch dp.drift {
+	case DriftError:
+		return false, errors.New(msg)
+	case DriftRecreate:
+		dp.log.With(resource).Progress("recreating " + msg)
+		return true, nil
+	}
+	dp.log.With(resource).Warn(msg + ", kept as is")
+	return false, nil
+}
+
+// linkDrift lists the differences of the Docker network from the link, which are the subnets of the link.
+func linkDrift(link topology.Link, netSum network.Summary) []string {
+	var ipv4Subnet, ipv6Subnet string
+	for _, ipamConfig := range netSum.IPAM.Config {
+		if strings.Contains(ipamConfig.Subnet, ":") {
+			ipv6Subnet = ipamConfig.Subnet
+			continue
+		}
+		ipv4Subnet = ipamConfig.Subnet
+	}
+	// engines which cannot disable IPv4 allocate subnets to networks without one by themselves
+	var diffs []string
+	if link.IPv4Subnet != "" && ipv4Subnet != link.IPv4Subnet {
+		diffs = append(diffs, fmt.Sprintf("ipv4_subnet %s -> %s", orNone(ipv4Subnet), link.IPv4Subnet))
+	}
+	if link.IPv6Subnet != "" && ipv6Subnet != link.IPv6Subnet {
+		diffs = append(diffs, fmt.Sprintf("ipv6_subnet %s -> %s", orNone(ipv6Subnet), link.IPv6Subnet))
+	}
+	return diffs
+}
+
+// nodeDrift lists the differences of the Docker container from the node, which are its image and mounts.
+func nodeDrift(node topology.Node, info container.InspectResponse) []string {
+	var diffs []string
+	if info.Config != nil && info.Config.Image != node.Image {
+		diffs = append(diffs, fmt.Sprintf("image %s -> %s", info.Config.Image, node.Image))
+	}
+	if info.ContainerJSONBase == nil || info.HostConfig == nil {
+		return diffs
+	}
+	var mounts []string
+	for _, m := range info.HostConfig.Mounts {
+		mounts = append(mounts, mountSpec(m))
+	}
+	var wantMounts []string
+	for _, m := range generateMounts(node) {
+		wantMounts = append(wantMounts, mountSpec(m))
+	}
+	slices.Sort(mounts)
+	slices.Sort(wantMounts)
+	if !slices.Equal(mounts, wantMounts) {
+		diffs = append(diffs, fmt.Sprintf("mounts [%s] -> [%s]", strings.Join(mounts, " "), strings.Join(wantMounts, " ")))
+	}
+	return diffs
+}
+
+// removeAttached removes the containers attached to the Docker network, so that the network can be
+// recreated. They are created anew along with their nodes, which follow the links. Nothing is removed
+// unless golab created the network and all of the containers for the lab of the link.
+func (dp *DockerProvider) removeAttached(ctx context.Context, link topology.Link) error {
+	name := networkName(link)
+	resource, err := dp.dockerClient.NetworkInspect(ctx, name, network.InspectOptions{})
+	if err != nil {
+		return err
+	}
+	if !owned(resource.Labels, link.Labels) {
+		return fmt.Errorf("refusing to recreate docker network %s, which golab did not create for this lab", name)
+	}
+	var nodes []topology.Node
+	for _, endpoint := range slices.SortedFunc(maps.Values(resource.Containers), func(a, b network.EndpointResource) int {
+		return strings.Compare(a.Name, b.Name)
+	}) {
+		info, err := dp.dockerClient.ContainerInspect(ctx, endpoint.Name)
+		if err != nil {
+			return err
+		}
+		var labels map[string]string
+		if info.Config != nil {
+			labels = info.Config.Labels
+		}
+		if !owned(labels, link.Labels) {
+			return fmt.Errorf("refusing to recreate docker network %s, as docker container %s attached to it was not created by golab for this lab", name, endpoint.Name)
+		}
+		nodes = append(nodes, topology.Node{Name: topologyName(endpoint.Name, labels), Labels: unmanaged(labels)})
+	}
+	for _, node := range nodes {
+		if err := dp.NodeRemove(ctx, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountSpec describes a mount in differences: binds and volumes as SOURCE:TARGET, tmpfs as tmpfs:TARGET.
+func mountSpec(m mount.Mount) string {
+	if m.Type == mount.TypeTmpfs {
+		return "tmpfs:" + m.Target
+	}
+	return m.Source + ":" + m.Target
+}
+
+// orNone replaces an empty value with a placeholder in differences.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
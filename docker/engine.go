@@ -0,0 +1,191 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// Engine selects the Docker engine labs are deployed to. A zero Engine follows the Docker CLI: DOCKER_HOST,
+// DOCKER_CONTEXT and the current context of the CLI are honored, falling back to the local engine.
+type Engine struct {
+	// Host is the address of the engine, e.g. unix:///var/run/docker.sock, tcp://server:2375 or ssh://user@server.
+	// Engines behind SSH are reached by running docker system dial-stdio on the server with the local ssh client.
+	Host string
+	// Context names a context of the Docker CLI, e.g. one created with docker context create, providing the host.
+	Context string
+}
+
+// Resolve returns the address of the engine, which is empty for the local engine.
+func (e Engine) Resolve() (string, error) {
+	if e.Host != "" {
+		return e.Host, nil
+	}
+	name := e.Context
+	if name == "" {
+		if host := os.Getenv(client.EnvOverrideHost); host != "" {
+			return host, nil
+		}
+		name = os.Getenv("DOCKER_CONTEXT")
+	}
+	if name == "" {
+		var err error
+		if name, err = currentContext(); err != nil {
+			return "", err
+		}
+	}
+	if name == "" || name == "default" {
+		return "", nil
+	}
+	return contextHost(name)
+}
+
+// ClientOpts returns the options of a Docker client connecting to the engine.
+func (e Engine) ClientOpts() ([]client.Opt, error) {
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	host, err := e.Resolve()
+	if err != nil || host == "" {
+		return opts, err
+	}
+	if !strings.HasPrefix(host, "ssh://") {
+		return append(opts, client.WithHost(host)), nil
+	}
+	args, err := sshArgs(host)
+	if err != nil {
+		return nil, err
+	}
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialCommand(ctx, "ssh", args...)
+	}
+	// the host only names the engine in HTTP requests, which are sent over the SSH session
+	return append(opts, client.WithHost("http://docker.example.com"), client.WithDialContext(dial)), nil
+}
+
+// configDir returns the configuration directory of the Docker CLI.
+func configDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker")
+}
+
+// currentContext returns the context selected with docker context use, if any.
+func currentContext() (string, error) {
+	data, err := os.ReadFile(filepath.Join(configDir(), "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("invalid docker config: %w", err)
+	}
+	return config.CurrentContext, nil
+}
+
+// contextHost reads the host of a context from its metadata, which the Docker CLI stores
+// in a directory named after the SHA-256 digest of the context name.
+func contextHost(name string) (string, error) {
+	digest := sha256.Sum256([]byte(name))
+	data, err := os.ReadFile(filepath.Join(configDir(), "contexts", "meta", hex.EncodeToString(digest[:]), "meta.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("docker context %q does not exist", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	var meta struct {
+		Endpoints map[string]struct {
+			Host string `json:"Host"`
+		} `json:"Endpoints"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return "", fmt.Errorf("invalid docker context %q: %w", name, err)
+	}
+	host := meta.Endpoints["docker"].Host
+	if host == "" {
+		return "", fmt.Errorf("docker context %q does not have a docker endpoint", name)
+	}
+	return host, nil
+}
+
+// sshArgs returns the arguments of the ssh client running docker system dial-stdio on the host of an ssh:// address.
+func sshArgs(host string) ([]string, error) {
+	u, err := url.Parse(host)
+	if err != nil || u.Hostname() == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("invalid docker host %q, e.g. ssh://user@server expected", host)
+	}
+	var args []string
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	return append(args, "--", u.Hostname(), "docker", "system", "dial-stdio"), nil
+}
+
+// commandConn is a connection over the standard input and output of a command.
+type commandConn struct {
+	cmd *exec.Cmd
+	io.Reader
+	io.WriteCloser
+}
+
+// dialCommand starts the command and connects to its standard input and output.
+func dialCommand(ctx context.Context, name string, args ...string) (net.Conn, error) {
+	// the connection outlives the dial context
+	cmd := exec.CommandContext(context.WithoutCancel(ctx), name, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to connect to docker engine: %w", err)
+	}
+	return &commandConn{cmd: cmd, Reader: stdout, WriteCloser: stdin}, nil
+}
+
+func (c *commandConn) Close() error {
+	err := c.WriteCloser.Close()
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	c.cmd.Wait()
+	return err
+}
+
+func (c *commandConn) LocalAddr() net.Addr              { return commandAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr             { return commandAddr{} }
+func (c *commandConn) SetDeadline(time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+// commandAddr is the address of both ends of a commandConn.
+type commandAddr struct{}
+
+func (commandAddr) Network() string { return "command" }
+func (commandAddr) String() string  { return "command" }
@@ -0,0 +1,225 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/elupevg/golab/topology"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// sysctlsOption lists the sysctls Docker applies to an interface, with IFNAME standing for its name.
+const sysctlsOption = "com.docker.network.endpoint.sysctls"
+
+// vethEnd is an interface of a veth pair inside the network namespace of a running container.
+type vethEnd struct {
+	pid   int
+	iface *topology.Interface
+}
+
+// connectVeth wires the containers of the nodes of a veth link with a veth pair, which is created
+// right in their network namespaces once both are started. This requires golab to run on the host
+// of the Docker engine with the privileges to enter the namespaces. The pair disappears along with
+// either container, so it only has to be removed from nodes which are kept.
+func (dp *DockerProvider) connectVeth(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	if len(nodes) != 2 {
+		return fmt.Errorf("veth link %s requires exactly two nodes, got %d", link.Name, len(nodes))
+	}
+	if err := dp.checkLocal(link); err != nil {
+		return err
+	}
+	var ends [2]vethEnd
+	for i, node := range nodes {
+		name := containerName(node)
+		info, err := dp.dockerClient.ContainerInspect(ctx, name)
+		if err != nil {
+			return err
+		}
+		// the pair is created once both nodes are started
+		if !isRunning(info) {
+			dp.log.With(link.Name).Skipped(fmt.Sprintf("postponed veth pair of link %s until docker container %s is started", link.Name, name))
+			return nil
+		}
+		var ifaces []*topology.Interface
+		for _, iface := range node.Interfaces {
+			if iface.Link == link.Name {
+				ifaces = append(ifaces, iface)
+			}
+		}
+		// a node looped back to itself holds both ends of the pair
+		k := 0
+		if i == 1 && nodes[0].Name == node.Name {
+			k = 1
+		}
+		if k >= len(ifaces) {
+			return fmt.Errorf("node %s is not attached to link %s", node.Name, link.Name)
+		}
+		ends[i] = vethEnd{pid: info.State.Pid, iface: ifaces[k]}
+	}
+	pair := fmt.Sprintf("%s:%s-%s:%s", nodes[0].Name, ends[0].iface.Name, nodes[1].Name, ends[1].iface.Name)
+	// removing either end removes the pair, so one end tells whether it exists
+	exists, err := ends[0].exists()
+	if err != nil {
+		return fmt.Errorf("failed to create veth pair %s: %w", pair, err)
+	}
+	if exists {
+		dp.log.With(link.Name).Skipped("already created veth pair " + pair)
+		return nil
+	}
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:      ends[0].iface.Name,
+			MTU:       link.MTU,
+			Namespace: netlink.NsPid(ends[0].pid),
+		},
+		PeerName:      ends[1].iface.Name,
+		PeerNamespace: netlink.NsPid(ends[1].pid),
+	}
+	if err := netlink.LinkAdd(veth); err != nil {
+		return fmt.Errorf("failed to create veth pair %s: %w", pair, err)
+	}
+	for _, end := range ends {
+		if err := end.configure(); err != nil {
+			return fmt.Errorf("failed to configure veth pair %s: %w", pair, err)
+		}
+	}
+	dp.log.With(link.Name).Success("created veth pair " + pair)
+	return nil
+}
+
+// disconnectVeth removes the veth pair of the link by deleting its end in the container of a node,
+// which deletes the peer along with it.
+func (dp *DockerProvider) disconnectVeth(ctx context.Context, link topology.Link, node topology.Node) error {
+	if err := dp.checkLocal(link); err != nil {
+		return err
+	}
+	name := containerName(node)
+	info, err := dp.dockerClient.ContainerInspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	j := slices.IndexFunc(node.Interfaces, func(iface *topology.Interface) bool { return iface.Link == link.Name })
+	if j < 0 {
+		return fmt.Errorf("node %s is not attached to link %s", node.Name, link.Name)
+	}
+	end := vethEnd{pid: info.State.Pid, iface: node.Interfaces[j]}
+	pair := fmt.Sprintf("%s:%s", node.Name, end.iface.Name)
+	// the namespace of a stopped container is gone along with the pair
+	exists := false
+	if isRunning(info) {
+		if exists, err = end.exists(); err != nil {
+			return fmt.Errorf("failed to remove veth pair %s: %w", pair, err)
+		}
+	}
+	if !exists {
+		dp.log.With(link.Name).Skipped("already removed veth pair " + pair)
+		return nil
+	}
+	err = inNamespace(end.pid, func() error {
+		return netlink.LinkDel(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: end.iface.Name}})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove veth pair %s: %w", pair, err)
+	}
+	dp.log.With(link.Name).Success("removed veth pair " + pair)
+	return nil
+}
+
+// checkLocal makes sure that the Docker engine runs on this host, as the namespaces of containers are entered
+// by the PIDs the engine reports, which refer to processes of another host for remote engines.
+func (dp *DockerProvider) checkLocal(link topology.Link) error {
+	host := dp.dockerClient.DaemonHost()
+	if !strings.HasPrefix(host, "unix://") {
+		return fmt.Errorf("veth link %s requires the docker engine to run on this host, got %s", link.Name, host)
+	}
+	return nil
+}
+
+// exists checks whether the interface is present in the namespace.
+func (e vethEnd) exists() (bool, error) {
+	var found bool
+	err := inNamespace(e.pid, func() error {
+		_, err := netlink.LinkByName(e.iface.Name)
+		if errors.As(err, &netlink.LinkNotFoundError{}) {
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	return found, err
+}
+
+// configure applies the sysctls Docker would apply to an attached interface, addresses the interface
+// the way Docker IPAM would and brings it up.
+func (e vethEnd) configure() error {
+	return inNamespace(e.pid, func() error {
+		for _, sysctl := range e.sysctls() {
+			key, value, _ := strings.Cut(sysctl, "=")
+			path := filepath.Join("/proc/sys", strings.ReplaceAll(key, ".", "/"))
+			// the interface name may itself contain dots
+			path = strings.Replace(path, "IFNAME", e.iface.Name, 1)
+			if err := os.WriteFile(path, []byte(value), 0o644); err != nil {
+				return err
+			}
+		}
+		link, err := netlink.LinkByName(e.iface.Name)
+		if err != nil {
+			return err
+		}
+		for _, cidr := range []string{e.iface.IPv4Addr, e.iface.IPv6Addr} {
+			if cidr == "" {
+				continue
+			}
+			addr, err := netlink.ParseAddr(cidr)
+			if err != nil {
+				return err
+			}
+			if err := netlink.AddrReplace(link, addr); err != nil {
+				return err
+			}
+		}
+		return netlink.LinkSetUp(link)
+	})
+}
+
+// sysctls lists the sysctls of the interface, which has IPv6 enabled whenever it is addressed over IPv6,
+// since Docker disables IPv6 in containers without IPv6 networks.
+func (e vethEnd) sysctls() []string {
+	var sysctls []string
+	if opt := e.iface.DriverOpts[sysctlsOption]; opt != "" {
+		sysctls = strings.Split(opt, ",")
+	}
+	enableIPv6 := "net.ipv6.conf.IFNAME.disable_ipv6=0"
+	if e.iface.IPv6Addr != "" && !slices.Contains(sysctls, enableIPv6) {
+		sysctls = append(sysctls, enableIPv6)
+	}
+	return sysctls
+}
+
+// inNamespace runs fn in the network namespace of the process on a dedicated OS thread. The thread is
+// never unlocked, so that it exits along with its goroutine instead of returning to the host namespace.
+func inNamespace(pid int, fn func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		ns, err := netns.GetFromPid(pid)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer ns.Close()
+		if err := netns.Set(ns); err != nil {
+			errc <- err
+			return
+		}
+		errc <- fn()
+	}()
+	return <-errc
+}
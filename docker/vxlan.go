@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/elupevg/golab/topology"
+)
+
+// vxlanPrefix starts the names of VXLAN interfaces, which end in the VNI of their tunnel.
+const vxlanPrefix = "vx-"
+
+// vxlanName names the VXLAN interface of the tunnel of a link after its VNI, which fits an interface name.
+func vxlanName(tunnel *topology.Tunnel) string {
+	return fmt.Sprintf("%s%06x", vxlanPrefix, tunnel.VNI)
+}
+
+// Stitch attaches the VXLAN interface of the tunnel of the link to the bridge of its network on the
+// Docker host, flooding frames to the VTEPs of the remote hosts, so that the networks of the link on
+// every host form a single segment. The interface is created by a container of the tunnel image in
+// the network namespace of the host and replaced if it exists, which makes stitching safe to repeat.
+func (dp *DockerProvider) Stitch(ctx context.Context, link topology.Link, local string, remotes []string) error {
+	if link.Tunnel == nil {
+		return fmt.Errorf("link %s does not have a tunnel", link.Name)
+	}
+	name := vxlanName(link.Tunnel)
+	cmds := []string{
+		"ip link del " + name + " 2>/dev/null || true",
+		fmt.Sprintf("ip link add %s type vxlan id %d local %s dstport %d", name, link.Tunnel.VNI, local, link.Tunnel.Port),
+	}
+	// the all-zeros entries flood broadcast and unknown unicast frames to every remote VTEP
+	for _, remote := range remotes {
+		cmds = append(cmds, "bridge fdb append 00:00:00:00:00:00 dev "+name+" dst "+remote)
+	}
+	cmds = append(cmds, "ip link set "+name+" master "+bridgeName(link)+" up")
+	if err := dp.runOnHost(ctx, link, strings.Join(cmds, " && ")); err != nil {
+		return fmt.Errorf("failed to stitch link %s: %w", link.Name, err)
+	}
+	dp.log.With(link.Name).Success(fmt.Sprintf("stitched docker network %s to %v with vxlan vni=%d", networkName(link), remotes, link.Tunnel.VNI))
+	return nil
+}
+
+// Unstitch removes the VXLAN interface of the tunnel of the link from the Docker host, which Docker
+// does not remove along with the bridge it is attached to.
+func (dp *DockerProvider) Unstitch(ctx context.Context, link topology.Link) error {
+	if link.Tunnel == nil {
+		return nil
+	}
+	name := vxlanName(link.Tunnel)
+	if err := dp.runOnHost(ctx, link, "ip link del "+name+" 2>/dev/null || true"); err != nil {
+		return fmt.Errorf("failed to unstitch link %s: %w", link.Name, err)
+	}
+	dp.log.With(link.Name).Success(fmt.Sprintf("removed vxlan vni=%d of docker network %s", link.Tunnel.VNI, networkName(link)))
+	return nil
+}
+
+// runOnHost runs the shell script in a privileged container of the tunnel image of the link sharing
+// the network namespace of the Docker host, and removes the container once the script exits.
+func (dp *DockerProvider) runOnHost(ctx context.Context, link topology.Link, script string) error {
+	helper := topology.Node{Name: "golab-" + vxlanName(link.Tunnel), Image: link.Tunnel.Image, Labels: link.Labels}
+	if err := dp.pullImage(ctx, helper); err != nil {
+		return err
+	}
+	name := containerName(helper)
+	config := &container.Config{
+		Image:  link.Tunnel.Image,
+		Cmd:    []string{"sh", "-c", script},
+		Labels: managed(link.Labels),
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode("host"),
+		CapAdd:      []string{"NET_ADMIN"},
+	}
+	dp.logOptions(name, "container", containerOptions{Config: *config, HostConfig: hostConfig})
+	if _, err := dp.dockerClient.ContainerCreate(ctx, config, hostConfig, nil, nil, name); err != nil {
+		return err
+	}
+	defer dp.dockerClient.ContainerRemove(context.WithoutCancel(ctx), name, container.RemoveOptions{Force: true})
+	if err := dp.dockerClient.ContainerStart(ctx, name, container.StartOptions{}); err != nil {
+		return err
+	}
+	waitCh, errCh := dp.dockerClient.ContainerWait(ctx, name, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return err
+	case resp := <-waitCh:
+		if resp.StatusCode == 0 {
+			return nil
+		}
+		var logs bytes.Buffer
+		if err := dp.NodeLogs(ctx, helper, false, crashLogLines, &logs, &logs); err != nil {
+			return err
+		}
+		return fmt.Errorf("script exited with code %d: %s", resp.StatusCode, strings.TrimSpace(logs.String()))
+	}
+}
@@ -0,0 +1,220 @@
+// Package dryrun provides a provider which records the changes a command would make to a lab instead
+// of making them, so that topology changes can be reviewed or validated in CI without a container engine.
+// Every action is logged along with the topology entity it is applied to, as computed from the topology.
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+)
+
+// Action represents a change the provider was asked to make, e.g. creating a node.
+type Action struct {
+	Verb string `json:"verb"`
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Params holds the JSON encoding of the entity created, or the nodes or command the action applies to.
+	Params string `json:"params,omitempty"`
+}
+
+// String formats the action as logged, e.g. "would create node R1".
+func (a Action) String() string {
+	if a.Params == "" {
+		return fmt.Sprintf("would %s %s %s", a.Verb, a.Kind, a.Name)
+	}
+	return fmt.Sprintf("would %s %s %s: %s", a.Verb, a.Kind, a.Name, a.Params)
+}
+
+// DryRunProvider stores the actions recorded so far. Nothing is ever deployed, so commands see an empty lab.
+// The provider stands in for the configuration provider as well, so that no configuration files are touched.
+type DryRunProvider struct {
+	log     *logger.Logger
+	mu      sync.Mutex
+	actions []Action
+}
+
+// New returns an instance of a DryRunProvider logging the actions it records.
+func New(log *logger.Logger) *DryRunProvider {
+	return &DryRunProvider{log: log}
+}
+
+// Actions returns the actions recorded so far in the order they were requested.
+func (dp *DryRunProvider) Actions() []Action {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	return append([]Action(nil), dp.actions...)
+}
+
+// record logs the action and appends it to the recorded ones. Params are encoded as JSON unless they are nil.
+func (dp *DryRunProvider) record(verb, kind, name string, params any) error {
+	action := Action{Verb: verb, Kind: kind, Name: name}
+	if params != nil {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(params); err != nil {
+			return fmt.Errorf("failed to encode parameters of %s %s: %w", kind, name, err)
+		}
+		action.Params = string(bytes.TrimSpace(buf.Bytes()))
+	}
+	dp.mu.Lock()
+	dp.actions = append(dp.actions, action)
+	dp.mu.Unlock()
+	dp.log.With(name).Success(action.String())
+	return nil
+}
+
+// redactEnv hides values of environment variables of the node and its sidecars, which may hold resolved secrets.
+func redactEnv(node topology.Node) topology.Node {
+	if len(node.Env) != 0 {
+		node.Env = maps.Clone(node.Env)
+		for key := range node.Env {
+			node.Env[key] = "<redacted>"
+		}
+	}
+	if len(node.Sidecars) != 0 {
+		sidecars := make([]*topology.Node, 0, len(node.Sidecars))
+		for _, sidecar := range node.Sidecars {
+			redacted := redactEnv(*sidecar)
+			sidecars = append(sidecars, &redacted)
+		}
+		node.Sidecars = sidecars
+	}
+	return node
+}
+
+// nodeNames lists the names of the nodes an action applies to.
+func nodeNames(nodes []topology.Node) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return names
+}
+
+// LinkCreate records the creation of the link with all of its computed attributes.
+func (dp *DryRunProvider) LinkCreate(_ context.Context, link topology.Link) error {
+	return dp.record("create", "link", link.Name, link)
+}
+
+// LinkRemove records the removal of the link.
+func (dp *DryRunProvider) LinkRemove(_ context.Context, link topology.Link) error {
+	return dp.record("remove", "link", link.Name, nil)
+}
+
+// LinkConnect records the attachment of the nodes to the link.
+func (dp *DryRunProvider) LinkConnect(_ context.Context, link topology.Link, nodes []topology.Node) error {
+	return dp.record("connect", "link", link.Name, nodeNames(nodes))
+}
+
+// LinkDisconnect records the detachment of the nodes from the link.
+func (dp *DryRunProvider) LinkDisconnect(_ context.Context, link topology.Link, nodes []topology.Node) error {
+	return dp.record("disconnect", "link", link.Name, nodeNames(nodes))
+}
+
+// NodeCreate records the creation of the node with all of its computed attributes, hiding environment values.
+func (dp *DryRunProvider) NodeCreate(_ context.Context, node topology.Node) error {
+	return dp.record("create", "node", node.Name, redactEnv(node))
+}
+
+// NodeRemove records the removal of the node.
+func (dp *DryRunProvider) NodeRemove(_ context.Context, node topology.Node) error {
+	return dp.record("remove", "node", node.Name, nil)
+}
+
+// NodeExec records the command and reports it as succeeded without output, as if the node was ready.
+func (dp *DryRunProvider) NodeExec(_ context.Context, node topology.Node, cmd []string, _, _ io.Writer) (int, error) {
+	return 0, dp.record("exec", "node", node.Name, cmd)
+}
+
+// NodeStats reports no resource usage, as nothing runs.
+func (dp *DryRunProvider) NodeStats(_ context.Context, _ topology.Node) (topology.NodeStats, error) {
+	return topology.NodeStats{}, nil
+}
+
+// NodeLogs writes no logs, as nothing runs.
+func (dp *DryRunProvider) NodeLogs(_ context.Context, _ topology.Node, _ bool, _ int, _, _ io.Writer) error {
+	return nil
+}
+
+// NodeShell records the command and reports it as succeeded without attaching the terminal.
+func (dp *DryRunProvider) NodeShell(_ context.Context, node topology.Node, cmd []string, _ topology.TTY) (int, error) {
+	return 0, dp.record("shell", "node", node.Name, cmd)
+}
+
+// NodePause records pausing the node.
+func (dp *DryRunProvider) NodePause(_ context.Context, node topology.Node) error {
+	return dp.record("pause", "node", node.Name, nil)
+}
+
+// NodeUnpause records resuming the node.
+func (dp *DryRunProvider) NodeUnpause(_ context.Context, node topology.Node) error {
+	return dp.record("resume", "node", node.Name, nil)
+}
+
+// NodeStop records stopping the node.
+func (dp *DryRunProvider) NodeStop(_ context.Context, node topology.Node) error {
+	return dp.record("stop", "node", node.Name, nil)
+}
+
+// NodeStart records starting the node.
+func (dp *DryRunProvider) NodeStart(_ context.Context, node topology.Node) error {
+	return dp.record("start", "node", node.Name, nil)
+}
+
+// NodeRunning reports every node as not running, as nothing is deployed.
+func (dp *DryRunProvider) NodeRunning(_ context.Context, _ topology.Node) (bool, error) {
+	return false, nil
+}
+
+// NodeCommit records committing the node to an image with the reference.
+func (dp *DryRunProvider) NodeCommit(_ context.Context, node topology.Node, ref string) error {
+	return dp.record("commit", "node", node.Name, ref)
+}
+
+// Deployed reports no objects, so that plans list every object of the lab as created.
+func (dp *DryRunProvider) Deployed(_ context.Context, _ string) ([]topology.Node, []topology.Link, error) {
+	return nil, nil, nil
+}
+
+// RemoveOrphans records removing the objects of the lab, or of any lab if it is empty.
+func (dp *DryRunProvider) RemoveOrphans(_ context.Context, lab string) error {
+	if lab == "" {
+		return dp.record("remove", "objects of", "all labs", nil)
+	}
+	return dp.record("remove", "objects of lab", lab, nil)
+}
+
+// recordNodes records the action for every node of the topology in the order of their names.
+func (dp *DryRunProvider) recordNodes(verb string, topo *topology.Topology) error {
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		if err := dp.record(verb, "config of node", name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateAndDump records generating the configuration of every node without writing it.
+func (dp *DryRunProvider) GenerateAndDump(topo *topology.Topology, _ string) error {
+	return dp.recordNodes("generate", topo)
+}
+
+// Cleanup records removing the configuration of every node without removing it.
+func (dp *DryRunProvider) Cleanup(topo *topology.Topology, _ string) error {
+	return dp.recordNodes("remove", topo)
+}
+
+// Push records delivering the configuration of every node to it.
+func (dp *DryRunProvider) Push(_ context.Context, topo *topology.Topology) error {
+	return dp.recordNodes("push", topo)
+}
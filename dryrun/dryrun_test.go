@@ -0,0 +1,136 @@
+package dryrun_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/dryrun"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+// noopConfProvider generates no configuration.
+type noopConfProvider struct{}
+
+func (noopConfProvider) GenerateAndDump(*topology.Topology, string) error { return nil }
+func (noopConfProvider) Cleanup(*topology.Topology, string) error         { return nil }
+func (noopConfProvider) Push(context.Context, *topology.Topology) error   { return nil }
+
+const testYAML = `
+name: "lab1"
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "quay.io/frrouting/frr:master"
+links:
+  - endpoints: [R1, R2]
+`
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	dp := dryrun.New(logger.New(&out, io.Discard))
+	if err := orchestrator.Build(context.Background(), []byte(testYAML), dp, noopConfProvider{}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, action := range dp.Actions() {
+		if action.Verb == "create" {
+			got = append(got, action.Kind+" "+action.Name)
+		}
+	}
+	want := []string{"link golab-link-01", "node R1", "node R2"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("created objects mismatch (-want +got):\n%s", diff)
+	}
+	wantLog := `would create link golab-link-01: {"name":"golab-link-01","endpoints":["R1","R2"],"ipv4_subnet":"10.1.2.0/24"`
+	if !strings.Contains(out.String(), wantLog) {
+		t.Errorf("want log containing %q, got:\n%s", wantLog, out.String())
+	}
+}
+
+func TestConfigUntouched(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PWD", dir)
+	existing := filepath.Join(dir, "R1", "frr.conf")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("hostname R1\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	dp := dryrun.New(logger.New(io.Discard, io.Discard))
+	ctx := context.Background()
+	data := []byte("config_mode: auto\n" + testYAML)
+	if err := orchestrator.Build(ctx, data, dp, dp); err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.Wreck(ctx, data, dp, dp); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, action := range dp.Actions() {
+		if action.Kind == "config of node" {
+			got = append(got, action.String())
+		}
+	}
+	want := []string{
+		"would generate config of node R1",
+		"would generate config of node R2",
+		"would remove config of node R1",
+		"would remove config of node R2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("config actions mismatch (-want +got):\n%s", diff)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "R1" {
+		t.Errorf("want only the existing R1 directory, got %v", entries)
+	}
+	if data, err := os.ReadFile(existing); err != nil || string(data) != "hostname R1\n" {
+		t.Errorf("want existing config untouched, got %q, %v", data, err)
+	}
+}
+
+func TestNodeCreateRedactsEnv(t *testing.T) {
+	t.Parallel()
+	dp := dryrun.New(logger.New(io.Discard, io.Discard))
+	node := topology.Node{Name: "R1", Env: map[string]string{"PASSWORD": "secret"}}
+	if err := dp.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	want := []dryrun.Action{{Verb: "create", Kind: "node", Name: "R1", Params: `{"name":"R1","env":{"PASSWORD":"<redacted>"}}`}}
+	if diff := cmp.Diff(want, dp.Actions()); diff != "" {
+		t.Errorf("actions mismatch (-want +got):\n%s", diff)
+	}
+	if node.Env["PASSWORD"] != "secret" {
+		t.Errorf("want environment of the node untouched, got %v", node.Env)
+	}
+}
+
+func TestActionString(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		action dryrun.Action
+		want   string
+	}{
+		{action: dryrun.Action{Verb: "remove", Kind: "node", Name: "R1"}, want: "would remove node R1"},
+		{action: dryrun.Action{Verb: "connect", Kind: "link", Name: "golab-link-01", Params: `["R1","R2"]`}, want: `would connect link golab-link-01: ["R1","R2"]`},
+	}
+	for _, tc := range testCases {
+		if got := tc.action.String(); got != tc.want {
+			t.Errorf("want %q, got %q", tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package ipam allocates subnets of links and addresses of nodes in network topologies.
+package ipam
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Strategy represents an allocation policy selected by the topology.
+type Strategy string
+
+const (
+	// Index derives subnets and loopbacks from node indices, e.g. 10.1.2.0/24 links R1 and R2.
+	Index Strategy = "index"
+	// Sequential allocates subnets and loopbacks one after another in the order they are requested.
+	Sequential Strategy = "sequential"
+	// Hash derives subnets from node and link names and loopbacks from node names, so that they do not
+	// depend on node indices or on the order of links. Collisions are resolved by taking the next free value.
+	Hash Strategy = "hash"
+)
+
+// IsValid tells whether the strategy is supported. An empty strategy stands for Index.
+func (s Strategy) IsValid() bool {
+	switch s {
+	case "", Index, Sequential, Hash:
+		return true
+	default:
+		return false
+	}
+}
+
+// Node identifies a node to allocate addresses for.
+type Node struct {
+	Name  string
+	Index int
+}
+
+// Link identifies a link to allocate a subnet for by its nodes and the name given to it, if any,
+// which tells apart parallel links between the same nodes.
+type Link struct {
+	Name  string
+	Nodes []Node
+}
+
+// Key returns the identity of the link, which depends neither on the order of its nodes nor on their indices.
+func (l Link) Key() string {
+	names := make([]string, 0, len(l.Nodes)+1)
+	for _, node := range l.Nodes {
+		names = append(names, node.Name)
+	}
+	slices.Sort(names)
+	if l.Name != "" {
+		names = append(names, l.Name)
+	}
+	return strings.Join(names, "\x00")
+}
+
+// Allocator allocates subnets and addresses in CIDR notation for IPv4 or IPv6.
+type Allocator interface {
+	// Subnet allocates the subnet of the link.
+	Subnet(link Link, ipVersion int) (string, error)
+	// Host returns the address of the host with the index within the subnet.
+	Host(subnet string, index int) string
+	// Loopback allocates the loopback address of the node.
+	Loopback(node Node, ipVersion int) (string, error)
+}
+
+// New returns an allocator implementing the strategy, which has to be valid.
+func New(s Strategy) Allocator {
+	switch s {
+	case Sequential:
+		return &sequential{subnets: make(map[int]int), loopbacks: make(map[int]int)}
+	case Hash:
+		return &hashed{used: make(map[string]bool)}
+	default:
+		return index{}
+	}
+}
+
+// hosts allocates host addresses by their index, which all strategies share.
+type hosts struct{}
+
+func (hosts) Host(subnet string, index int) string {
+	if subnet == "" {
+		return ""
+	}
+	net, pl, _ := strings.Cut(subnet, "/")
+	if strings.Contains(subnet, ".") {
+		net, _ = strings.CutSuffix(net, "0")
+	}
+	return fmt.Sprintf("%s%d/%s", net, index, pl)
+}
+
+// index implements the Index strategy.
+type index struct{ hosts }
+
+// Subnet uses the indices of both nodes of a point-to-point link, or the last node index of a multi-access link.
+func (index) Subnet(link Link, ipVersion int) (string, error) {
+	nodes := link.Nodes
+	var a, b int
+	if len(nodes) > 2 {
+		b = nodes[len(nodes)-1].Index
+	} else {
+		a, b = nodes[0].Index, nodes[1].Index
+	}
+	return subnet(a, b, ipVersion), nil
+}
+
+func (index) Loopback(node Node, ipVersion int) (string, error) {
+	return loopback(0, node.Index, ipVersion), nil
+}
+
+// sequential implements the Sequential strategy, counting subnets and loopbacks per IP version.
+type sequential struct {
+	hosts
+	subnets   map[int]int
+	loopbacks map[int]int
+}
+
+func (s *sequential) Subnet(_ Link, ipVersion int) (string, error) {
+	s.subnets[ipVersion]++
+	n := s.subnets[ipVersion]
+	if n > maxValue {
+		return "", fmt.Errorf("no IPv%d subnets left", ipVersion)
+	}
+	return subnet(n>>8, n&0xff, ipVersion), nil
+}
+
+func (s *sequential) Loopback(_ Node, ipVersion int) (string, error) {
+	s.loopbacks[ipVersion]++
+	n := s.loopbacks[ipVersion]
+	if n > maxValue {
+		return "", fmt.Errorf("no IPv%d loopbacks left", ipVersion)
+	}
+	return loopback(n>>8, n&0xff, ipVersion), nil
+}
+
+// hashed implements the Hash strategy, tracking allocated subnets and loopbacks to resolve collisions.
+type hashed struct {
+	hosts
+	used map[string]bool
+}
+
+func (h *hashed) Subnet(link Link, ipVersion int) (string, error) {
+	subnet, ok := h.allocate(link.Key(), func(n int) string {
+		return subnet(n>>8, n&0xff, ipVersion)
+	})
+	if !ok {
+		return "", fmt.Errorf("no IPv%d subnets left", ipVersion)
+	}
+	return subnet, nil
+}
+
+func (h *hashed) Loopback(node Node, ipVersion int) (string, error) {
+	loopback, ok := h.allocate(node.Name, func(n int) string {
+		return loopback(n>>8, n&0xff, ipVersion)
+	})
+	if !ok {
+		return "", fmt.Errorf("no IPv%d loopbacks left", ipVersion)
+	}
+	return loopback, nil
+}
+
+// allocate returns the first unused value derived from the hash of the key, skipping zero.
+func (h *hashed) allocate(key string, format func(n int) string) (string, bool) {
+	n := int(hash(key) % maxValue)
+	for range maxValue {
+		n = n%maxValue + 1
+		value := format(n)
+		if !h.used[value] {
+			h.used[value] = true
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// hash returns the FNV-1a hash of the key.
+func hash(key string) uint32 {
+	sum := fnv.New32a()
+	sum.Write([]byte(key))
+	return sum.Sum32()
+}
+
+// excluding skips subnets and loopbacks of the underlying allocator which overlap the excluded ranges.
+type excluding struct {
+	Allocator
+	ranges []netip.Prefix
+}
+
+// Exclude returns an allocator which never hands out subnets or loopbacks overlapping the ranges,
+// given as subnets or single addresses. Allocators keep being asked until they come up with a value
+// outside of the ranges, which the Index strategy never does.
+func Exclude(alloc Allocator, ranges []string) (Allocator, error) {
+	prefixes, err := ParseRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefixes) == 0 {
+		return alloc, nil
+	}
+	return &excluding{Allocator: alloc, ranges: prefixes}, nil
+}
+
+func (e *excluding) Subnet(link Link, ipVersion int) (string, error) {
+	return e.retry(func() (string, error) { return e.Allocator.Subnet(link, ipVersion) })
+}
+
+func (e *excluding) Loopback(node Node, ipVersion int) (string, error) {
+	return e.retry(func() (string, error) { return e.Allocator.Loopback(node, ipVersion) })
+}
+
+// retry allocates until the value does not overlap any excluded range, or the allocator repeats itself.
+func (e *excluding) retry(allocate func() (string, error)) (string, error) {
+	var last string
+	for {
+		value, err := allocate()
+		if err != nil {
+			return "", err
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return value, nil
+		}
+		i := slices.IndexFunc(e.ranges, prefix.Overlaps)
+		if i < 0 {
+			return value, nil
+		}
+		if value == last {
+			return "", fmt.Errorf("%s overlaps excluded range %s", value, e.ranges[i])
+		}
+		last = value
+	}
+}
+
+// ParseRanges parses address ranges given as subnets or single addresses.
+func ParseRanges(ranges []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(ranges))
+	for _, r := range ranges {
+		prefix, err := parseRange(r)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// parseRange parses an address range given as a subnet or a single address.
+func parseRange(r string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(r); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(r)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address range %q", r)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// maxValue is the number of subnets or loopbacks of an IP version the strategies can tell apart by two bytes, except zero.
+const maxValue = 0xffff
+
+// subnet formats the subnet identified by two bytes, e.g. 10.A.B.0/24 or 2001:db8:A:B::/64.
+func subnet(a, b, ipVersion int) string {
+	switch ipVersion {
+	case 4:
+		return fmt.Sprintf("10.%d.%d.0/24", a, b)
+	case 6:
+		return fmt.Sprintf("2001:db8:%d:%d::/64", a, b)
+	}
+	return ""
+}
+
+// loopback formats the loopback identified by two bytes, e.g. 192.168.A.B/32 or 2001:db8::A:B/128.
+func loopback(a, b, ipVersion int) string {
+	switch ipVersion {
+	case 4:
+		return fmt.Sprintf("192.168.%d.%d/32", a, b)
+	case 6:
+		if a == 0 {
+			return fmt.Sprintf("2001:db8::%d/128", b)
+		}
+		return fmt.Sprintf("2001:db8::%d:%d/128", a, b)
+	}
+	return ""
+}
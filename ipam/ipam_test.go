@@ -0,0 +1,265 @@
+package ipam_test
+
+import (
+	"testing"
+
+	"github.com/elupevg/golab/ipam"
+	"github.com/google/go-cmp/cmp"
+)
+
+// must returns the allocated value, failing the test on errors.
+func must(t *testing.T) func(string, error) string {
+	return func(value string, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+}
+
+var (
+	r1 = ipam.Node{Name: "R1", Index: 1}
+	r2 = ipam.Node{Name: "R2", Index: 2}
+	r3 = ipam.Node{Name: "R3", Index: 3}
+	r4 = ipam.Node{Name: "R4", Index: 4}
+)
+
+func TestIndexSubnet(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name      string
+		nodes     []ipam.Node
+		ipVersion int
+		want      string
+	}{
+		{
+			name:      "IPv4R3toR4",
+			nodes:     []ipam.Node{r3, r4},
+			ipVersion: 4,
+			want:      "10.3.4.0/24",
+		},
+		{
+			name:      "IPv6R3toR4",
+			nodes:     []ipam.Node{r3, r4},
+			ipVersion: 6,
+			want:      "2001:db8:3:4::/64",
+		},
+		{
+			name:      "IPv4R4toR3",
+			nodes:     []ipam.Node{r4, r3},
+			ipVersion: 4,
+			want:      "10.4.3.0/24",
+		},
+		{
+			name:      "IPv6R4toR3",
+			nodes:     []ipam.Node{r4, r3},
+			ipVersion: 6,
+			want:      "2001:db8:4:3::/64",
+		},
+		{
+			name:      "IPv4Broadcast",
+			nodes:     []ipam.Node{r1, r2, r3},
+			ipVersion: 4,
+			want:      "10.0.3.0/24",
+		},
+		{
+			name:      "IPv6Broadcast",
+			nodes:     []ipam.Node{r1, r2, r3},
+			ipVersion: 6,
+			want:      "2001:db8:0:3::/64",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ipam.New(ipam.Index).Subnet(ipam.Link{Nodes: tc.nodes}, tc.ipVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want != got {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		subnet string
+		index  int
+		want   string
+	}{
+		{
+			name:   "IPv4Host4",
+			subnet: "10.3.4.0/24",
+			index:  4,
+			want:   "10.3.4.4/24",
+		},
+		{
+			name:   "IPv6Host4",
+			subnet: "2001:db8:3:4::/64",
+			index:  4,
+			want:   "2001:db8:3:4::4/64",
+		},
+		{
+			name:   "IPv4Host254",
+			subnet: "10.3.4.0/24",
+			index:  254,
+			want:   "10.3.4.254/24",
+		},
+		{
+			name:   "IPv6Host254",
+			subnet: "2001:db8:3:4::/64",
+			index:  254,
+			want:   "2001:db8:3:4::254/64",
+		},
+		{
+			name: "NoSubnet",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, strategy := range []ipam.Strategy{ipam.Index, ipam.Sequential, ipam.Hash} {
+				got := ipam.New(strategy).Host(tc.subnet, tc.index)
+				if tc.want != got {
+					t.Errorf("%s: want %q, got %q", strategy, tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexLoopback(t *testing.T) {
+	t.Parallel()
+	alloc := ipam.New(ipam.Index)
+	got := []string{must(t)(alloc.Loopback(r3, 4)), must(t)(alloc.Loopback(r3, 6))}
+	want := []string{"192.168.0.3/32", "2001:db8::3/128"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("loopbacks mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSequential(t *testing.T) {
+	t.Parallel()
+	alloc := ipam.New(ipam.Sequential)
+	got := []string{
+		must(t)(alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r3, r4}}, 4)),
+		must(t)(alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r3, r4}}, 6)),
+		must(t)(alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r1, r2}}, 4)),
+		must(t)(alloc.Loopback(r4, 4)),
+		must(t)(alloc.Loopback(r4, 6)),
+		must(t)(alloc.Loopback(r1, 4)),
+	}
+	want := []string{
+		"10.0.1.0/24",
+		"2001:db8:0:1::/64",
+		"10.0.2.0/24",
+		"192.168.0.1/32",
+		"2001:db8::1/128",
+		"192.168.0.2/32",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("allocations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+	alloc := ipam.New(ipam.Hash)
+	subnet := must(t)(alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r1, r2}}, 4))
+	loopback := must(t)(alloc.Loopback(r1, 4))
+	// allocations depend on node names only, not on indices or the order of requests
+	other := ipam.New(ipam.Hash)
+	if got := must(t)(other.Loopback(ipam.Node{Name: "R1", Index: 9}, 4)); got != loopback {
+		t.Errorf("loopback: want %q, got %q", loopback, got)
+	}
+	if got := must(t)(other.Subnet(ipam.Link{Nodes: []ipam.Node{r2, r1}}, 4)); got != subnet {
+		t.Errorf("subnet: want %q, got %q", subnet, got)
+	}
+	// a collision is resolved by taking the next free subnet
+	if got := must(t)(alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r2, r1}}, 4)); got == subnet {
+		t.Errorf("subnet: want other than %q, got %q", subnet, got)
+	}
+	// named parallel links keep their subnets whichever of them is allocated first
+	backup := ipam.Link{Name: "backup", Nodes: []ipam.Node{r1, r2}}
+	named := must(t)(alloc.Subnet(backup, 4))
+	if got := must(t)(ipam.New(ipam.Hash).Subnet(backup, 4)); got != named {
+		t.Errorf("subnet: want %q, got %q", named, got)
+	}
+}
+
+func TestLinkKey(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		link ipam.Link
+		want string
+	}{
+		{
+			name: "Unnamed",
+			link: ipam.Link{Nodes: []ipam.Node{r2, r1}},
+			want: "R1\x00R2",
+		},
+		{
+			name: "Named",
+			link: ipam.Link{Name: "backup", Nodes: []ipam.Node{r2, r1, r3}},
+			want: "R1\x00R2\x00R3\x00backup",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tc.link.Key(); got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestStrategyIsValid(t *testing.T) {
+	t.Parallel()
+	for _, strategy := range []ipam.Strategy{"", ipam.Index, ipam.Sequential, ipam.Hash} {
+		if !strategy.IsValid() {
+			t.Errorf("strategy %q: want valid", strategy)
+		}
+	}
+	if ipam.Strategy("random").IsValid() {
+		t.Error("strategy \"random\": want invalid")
+	}
+}
+
+func TestExclude(t *testing.T) {
+	t.Parallel()
+	alloc, err := ipam.Exclude(ipam.New(ipam.Sequential), []string{"10.0.1.0/24", "10.0.2.7", "192.168.0.0/31"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{
+		must(t)(alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r1, r2}}, 4)),
+		must(t)(alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r1, r2}}, 6)),
+		must(t)(alloc.Loopback(r1, 4)),
+	}
+	want := []string{"10.0.3.0/24", "2001:db8:0:1::/64", "192.168.0.2/32"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("allocations mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExcludeErrors(t *testing.T) {
+	t.Parallel()
+	wantErr := `invalid address range "10.0.0.0/33"`
+	if _, err := ipam.Exclude(ipam.New(ipam.Index), []string{"10.0.0.0/33"}); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	// the index strategy has no other subnet to offer
+	alloc, err := ipam.Exclude(ipam.New(ipam.Index), []string{"10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantErr = "10.1.2.0/24 overlaps excluded range 10.1.0.0/16"
+	if _, err := alloc.Subnet(ipam.Link{Nodes: []ipam.Node{r1, r2}}, 4); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
@@ -0,0 +1,146 @@
+package ipam
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"slices"
+)
+
+// Pool carves subnets of a fixed prefix length out of a supernet, either one after another or at
+// positions derived from link keys, skipping the ones overlapping subnets in use, e.g. the ones
+// declared explicitly.
+type Pool struct {
+	supernet  netip.Prefix
+	prefixLen int
+	next      netip.Addr
+	used      []netip.Prefix
+	carved    map[string]bool
+}
+
+// NewPool returns a pool of subnets of the prefix length within the supernet, which never hands out subnets
+// overlapping the used ones, given as subnets or single addresses. A zero prefix length stands for /24 in IPv4
+// and /64 in IPv6.
+func NewPool(supernet string, prefixLen int, used []string) (*Pool, error) {
+	prefix, err := netip.ParsePrefix(supernet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link pool %q", supernet)
+	}
+	prefix = prefix.Masked()
+	if prefixLen == 0 {
+		prefixLen = 24
+		if prefix.Addr().Is6() {
+			prefixLen = 64
+		}
+	}
+	// every subnet needs room for at least two hosts and the gateway
+	if prefixLen < prefix.Bits() || prefixLen > prefix.Addr().BitLen()-2 {
+		return nil, fmt.Errorf("link prefix length %d does not fit into link pool %s", prefixLen, prefix)
+	}
+	p := &Pool{supernet: prefix, prefixLen: prefixLen, next: prefix.Addr(), carved: make(map[string]bool)}
+	for _, r := range used {
+		if u, err := parseRange(r); err == nil {
+			p.used = append(p.used, u)
+		}
+	}
+	return p, nil
+}
+
+// IPVersion returns the IP version of the subnets in the pool.
+func (p *Pool) IPVersion() int {
+	if p.supernet.Addr().Is4() {
+		return 4
+	}
+	return 6
+}
+
+// Hosts returns the number of usable addresses in every subnet of the pool.
+func (p *Pool) Hosts() int {
+	bits := p.supernet.Addr().BitLen() - p.prefixLen
+	if bits >= 31 {
+		return 1<<31 - 2
+	}
+	return 1<<bits - 2
+}
+
+// Subnet returns a free subnet of the pool for the link identified by the key, see Link.Key. The search
+// starts from the position given by the hash of the key and wraps around the pool, so that the subnet
+// of a link does not depend on the links carved before, unless their hashes collide. An empty key
+// returns the next free subnet after the ones carved without a key.
+func (p *Pool) Subnet(key string) (string, error) {
+	if key == "" {
+		for p.next.IsValid() && p.supernet.Contains(p.next) {
+			candidate := netip.PrefixFrom(p.next, p.prefixLen)
+			p.next = lastAddr(candidate).Next()
+			if p.take(candidate) {
+				return candidate.String(), nil
+			}
+		}
+		return "", fmt.Errorf("link pool %s is exhausted", p.supernet)
+	}
+	// hashes address the first 2^32 subnets of larger pools
+	slots := uint64(1) << min(p.prefixLen-p.supernet.Bits(), 32)
+	start := uint64(hash(key)) % slots
+	for i := range slots {
+		candidate := p.nth((start + i) % slots)
+		if p.take(candidate) {
+			return candidate.String(), nil
+		}
+	}
+	return "", fmt.Errorf("link pool %s is exhausted", p.supernet)
+}
+
+// take carves the candidate subnet unless it overlaps a subnet in use.
+func (p *Pool) take(candidate netip.Prefix) bool {
+	if slices.ContainsFunc(p.used, candidate.Overlaps) {
+		return false
+	}
+	p.used = append(p.used, candidate)
+	p.carved[candidate.String()] = true
+	return true
+}
+
+// nth returns the n-th subnet of the pool.
+func (p *Pool) nth(n uint64) netip.Prefix {
+	bits := p.supernet.Addr().BitLen()
+	offset := new(big.Int).Lsh(new(big.Int).SetUint64(n), uint(bits-p.prefixLen))
+	sum := offset.Add(offset, new(big.Int).SetBytes(p.supernet.Addr().AsSlice()))
+	addr, _ := netip.AddrFromSlice(sum.FillBytes(make([]byte, bits/8)))
+	return netip.PrefixFrom(addr, p.prefixLen)
+}
+
+// Carved tells whether the subnet was handed out by the pool. It is false for a nil pool.
+func (p *Pool) Carved(subnet string) bool {
+	return p != nil && p.carved[subnet]
+}
+
+// Nth returns the n-th address of the subnet in CIDR notation. Negative n counts from the end
+// of the subnet, e.g. -1 is the broadcast address and -2 the last usable one.
+func Nth(subnet string, n int) string {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return ""
+	}
+	addr := prefix.Masked().Addr()
+	if n < 0 {
+		addr = lastAddr(prefix)
+		n++
+	}
+	for ; n > 0; n-- {
+		addr = addr.Next()
+	}
+	for ; n < 0; n++ {
+		addr = addr.Prev()
+	}
+	return netip.PrefixFrom(addr, prefix.Bits()).String()
+}
+
+// lastAddr returns the last address of the prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
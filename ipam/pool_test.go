@@ -0,0 +1,147 @@
+package ipam_test
+
+import (
+	"testing"
+
+	"github.com/elupevg/golab/ipam"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+	pool, err := ipam.NewPool("10.0.0.0/27", 29, []string{"10.0.0.8/30", "", "2001:db8::/64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for range 3 {
+		subnet, err := pool.Subnet("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, subnet)
+	}
+	// 10.0.0.8/29 overlaps a subnet in use
+	want := []string{"10.0.0.0/29", "10.0.0.16/29", "10.0.0.24/29"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("subnets mismatch (-want +got):\n%s", diff)
+	}
+	if !pool.Carved("10.0.0.16/29") || pool.Carved("10.0.0.8/30") {
+		t.Error("carved: want 10.0.0.16/29 only")
+	}
+	if pool.Hosts() != 6 || pool.IPVersion() != 4 {
+		t.Errorf("pool: want 6 IPv4 hosts, got %d IPv%d hosts", pool.Hosts(), pool.IPVersion())
+	}
+	wantErr := "link pool 10.0.0.0/27 is exhausted"
+	if _, err := pool.Subnet(""); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestPoolKeyed(t *testing.T) {
+	t.Parallel()
+	keys := []string{"R1\x00R2", "R1\x00R3", "R2\x00R3", "R3\x00R4"}
+	carve := func(keys []string) map[string]string {
+		t.Helper()
+		pool, err := ipam.NewPool("10.0.0.0/16", 24, []string{"10.0.0.0/24"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		subnets := make(map[string]string, len(keys))
+		for _, key := range keys {
+			subnet, err := pool.Subnet(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			subnets[key] = subnet
+		}
+		return subnets
+	}
+	// subnets do not depend on the order of links
+	want := carve(keys)
+	got := carve([]string{keys[3], keys[1], keys[0], keys[2]})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("subnets mismatch (-want +got):\n%s", diff)
+	}
+	// colliding keys get the next free subnet, wrapping around the pool
+	pool, err := ipam.NewPool("10.0.0.0/29", 30, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := pool.Subnet("R1\x00R2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pool.Subnet("R1\x00R2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || !pool.Carved(first) || !pool.Carved(second) {
+		t.Errorf("subnets: want two carved subnets, got %s and %s", first, second)
+	}
+	wantErr := "link pool 10.0.0.0/29 is exhausted"
+	if _, err := pool.Subnet("R1\x00R2"); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestNewPoolErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name      string
+		supernet  string
+		prefixLen int
+		wantErr   string
+	}{
+		{
+			name:     "InvalidSupernet",
+			supernet: "10.0.0.0",
+			wantErr:  `invalid link pool "10.0.0.0"`,
+		},
+		{
+			name:      "PrefixTooShort",
+			supernet:  "10.0.0.0/16",
+			prefixLen: 8,
+			wantErr:   "link prefix length 8 does not fit into link pool 10.0.0.0/16",
+		},
+		{
+			name:      "PrefixTooLong",
+			supernet:  "10.0.0.0/16",
+			prefixLen: 31,
+			wantErr:   "link prefix length 31 does not fit into link pool 10.0.0.0/16",
+		},
+		{
+			name:     "DefaultPrefixTooShort",
+			supernet: "2001:db8::/80",
+			wantErr:  "link prefix length 64 does not fit into link pool 2001:db8::/80",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ipam.NewPool(tc.supernet, tc.prefixLen, nil)
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("error: want %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNth(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		subnet string
+		n      int
+		want   string
+	}{
+		{subnet: "10.0.0.8/29", n: 1, want: "10.0.0.9/29"},
+		{subnet: "10.0.0.8/29", n: -2, want: "10.0.0.14/29"},
+		{subnet: "2001:db8:0:1::/64", n: 10, want: "2001:db8:0:1::a/64"},
+		{subnet: "invalid", n: 1, want: ""},
+	}
+	for _, tc := range testCases {
+		if got := ipam.Nth(tc.subnet, tc.n); got != tc.want {
+			t.Errorf("address %d of %s: want %q, got %q", tc.n, tc.subnet, tc.want, got)
+		}
+	}
+}
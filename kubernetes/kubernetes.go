@@ -0,0 +1,1193 @@
+// Package kubernetes translates GoLab network topology entities into Kubernetes objects, so that labs too large
+// for a single host are spread over the workers of a cluster. The cluster is driven with kubectl, while links are
+// Multus networks, which the CNI plugins of every worker implement. Examples:
+//
+//	topology.Link is equivalent to a Multus NetworkAttachmentDefinition
+//	topology.Node is equivalent to a Kubernetes Pod, whose sidecars are containers of the same pod
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+)
+
+// DefaultNamespace is the Kubernetes namespace holding the objects of all labs.
+const DefaultNamespace = "golab"
+
+// definitionResource is the resource of Multus NetworkAttachmentDefinitions as known to kubectl.
+const definitionResource = "network-attachment-definitions.k8s.cni.cncf.io"
+
+// managedLabel marks Kubernetes objects created by golab, which are the only ones it removes, while nodeLabel marks
+// the NetworkAttachmentDefinitions owned by a single pod.
+const (
+	managedLabel = "golab.managed"
+	nodeLabel    = "golab.node"
+)
+
+// recordAnnotation holds the topology entity a Kubernetes object was created for, whose names and labels
+// Kubernetes would not accept as they are.
+const recordAnnotation = "golab.record"
+
+// Annotations of pods selecting their Multus networks and the container kubectl defaults to.
+const (
+	networksAnnotation         = "k8s.v1.cni.cncf.io/networks"
+	defaultNetworkAnnotation   = "v1.multus-cni.io/default-network"
+	defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+)
+
+// podInterface is the interface pods are given on their default network, which a node interface with
+// the same name replaces.
+const podInterface = "eth0"
+
+// nodeContainer is the container of a pod running its node, along with the containers of its sidecars.
+const nodeContainer = "node"
+
+// maxNameLength is the length limit of names of Kubernetes objects and values of their labels.
+const maxNameLength = 63
+
+// defaultStartTimeout bounds scheduling a pod and pulling its image, which happen before its node boots.
+const defaultStartTimeout = 5 * time.Minute
+
+// defaultReadyTimeout bounds waiting for a started pod to become ready unless its node sets a timeout.
+const defaultReadyTimeout = 2 * time.Minute
+
+// defaultStopTimeout bounds graceful shutdown of a removed pod unless its node sets a timeout.
+const defaultStopTimeout = 10 * time.Second
+
+// readyInterval separates polls of the status of a starting pod.
+const readyInterval = time.Second
+
+// crashLogLines is the number of last log lines reported for a pod whose node exits while starting.
+const crashLogLines = 20
+
+// fatalReasons are the reasons of waiting containers which keep pods from starting until they are recreated.
+var fatalReasons = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError"}
+
+// KubernetesProvider stores the runner of kubectl along with the namespace of the lab objects.
+type KubernetesProvider struct {
+	runner    Runner
+	namespace string
+	log       *logger.Logger
+}
+
+// New returns an instance of a KubernetesProvider, which keeps the objects of all labs in the namespace.
+func New(runner Runner, namespace string, log *logger.Logger) *KubernetesProvider {
+	return &KubernetesProvider{runner: runner, namespace: namespace, log: log}
+}
+
+// metadata is the metadata of a Kubernetes object.
+type metadata struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// pod is the part of a Kubernetes Pod which golab sets or reads.
+type pod struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   metadata   `json:"metadata"`
+	Spec       podSpec    `json:"spec"`
+	Status     *podStatus `json:"status,omitempty"`
+}
+
+// podSpec is the specification of a pod.
+type podSpec struct {
+	Hostname                      string          `json:"hostname,omitempty"`
+	RestartPolicy                 string          `json:"restartPolicy"`
+	TerminationGracePeriodSeconds int             `json:"terminationGracePeriodSeconds"`
+	ShareProcessNamespace         bool            `json:"shareProcessNamespace,omitempty"`
+	SecurityContext               *podSecurity    `json:"securityContext,omitempty"`
+	Containers                    []containerSpec `json:"containers"`
+	Volumes                       []volume        `json:"volumes,omitempty"`
+}
+
+// podSecurity holds the sysctls of the network namespace of a pod.
+type podSecurity struct {
+	Sysctls []nameValue `json:"sysctls,omitempty"`
+}
+
+// nameValue is a sysctl or an environment variable.
+type nameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// containerSpec is the specification of a container of a pod.
+type containerSpec struct {
+	Name            string             `json:"name"`
+	Image           string             `json:"image"`
+	Command         []string           `json:"command,omitempty"`
+	Args            []string           `json:"args,omitempty"`
+	Env             []nameValue        `json:"env,omitempty"`
+	SecurityContext *containerSecurity `json:"securityContext,omitempty"`
+	Resources       *resources         `json:"resources,omitempty"`
+	VolumeMounts    []volumeMount      `json:"volumeMounts,omitempty"`
+	ReadinessProbe  *probe             `json:"readinessProbe,omitempty"`
+}
+
+// containerSecurity holds the privileges of a container.
+type containerSecurity struct {
+	Privileged   bool          `json:"privileged,omitempty"`
+	Capabilities *capabilities `json:"capabilities,omitempty"`
+}
+
+// capabilities are added to or dropped from the default capabilities of a container.
+type capabilities struct {
+	Add  []string `json:"add,omitempty"`
+	Drop []string `json:"drop,omitempty"`
+}
+
+// resources holds the CPU and memory limits of a container.
+type resources struct {
+	Limits map[string]string `json:"limits"`
+}
+
+// volume is a tmpfs mount of a container, which Kubernetes provides as an empty directory in memory.
+type volume struct {
+	Name     string `json:"name"`
+	EmptyDir struct {
+		Medium string `json:"medium"`
+	} `json:"emptyDir"`
+}
+
+// volumeMount mounts a volume of a pod into a container.
+type volumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+}
+
+// probe is the readiness probe of a container running the ready command of its node.
+type probe struct {
+	Exec struct {
+		Command []string `json:"command"`
+	} `json:"exec"`
+	PeriodSeconds int `json:"periodSeconds"`
+}
+
+// podStatus is the part of the status of a pod which golab uses.
+type podStatus struct {
+	Phase      string `json:"phase"`
+	Conditions []struct {
+		Type    string `json:"type"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"conditions"`
+	ContainerStatuses []containerStatus `json:"containerStatuses"`
+}
+
+// containerStatus is the status of a container of a pod, whose last state is the one before it was restarted.
+type containerStatus struct {
+	Name         string         `json:"name"`
+	RestartCount int            `json:"restartCount"`
+	State        containerState `json:"state"`
+	LastState    containerState `json:"lastState"`
+}
+
+// containerState is the state of a container, only one of whose fields is set.
+type containerState struct {
+	Waiting *struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	} `json:"waiting"`
+	Running    *struct{} `json:"running"`
+	Terminated *struct {
+		ExitCode int `json:"exitCode"`
+	} `json:"terminated"`
+}
+
+// nodeRecord is the record of a node kept in an annotation of its pod, listing its interfaces and sidecars.
+type nodeRecord struct {
+	Name       string                `json:"name"`
+	Labels     map[string]string     `json:"labels,omitempty"`
+	Interfaces []*topology.Interface `json:"interfaces,omitempty"`
+	Sidecars   []string              `json:"sidecars,omitempty"`
+}
+
+// networkSelection attaches a pod to a Multus network with an interface of the name and its addresses.
+type networkSelection struct {
+	Name      string   `json:"name"`
+	Interface string   `json:"interface"`
+	IPs       []string `json:"ips,omitempty"`
+}
+
+// LinkCreate translates a topology.Link entity into a NetworkAttachmentDefinition and applies it. Links on the
+// host bridge are given the lowest VLAN no other link holds.
+func (kp *KubernetesProvider) LinkCreate(ctx context.Context, link topology.Link) error {
+	net, err := newNetwork(link)
+	if err != nil {
+		return err
+	}
+	name := definitionName(link.Name, link.Labels)
+	existing, err := kp.getDefinition(ctx, name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if !owned(existing.Metadata.Labels, link.Labels) {
+			return fmt.Errorf("refusing to replace network attachment definition %s, which golab did not create for this lab", name)
+		}
+		rec, err := existing.record()
+		if err != nil {
+			return err
+		}
+		// pods attached to the network keep the configuration they were attached with
+		if !equalNetworks(rec, net) {
+			kp.log.With(link.Name).Warn(fmt.Sprintf("network attachment definition %s does not match the topology, wreck the lab to recreate it", name))
+			return nil
+		}
+		kp.log.With(link.Name).Skipped("already created network attachment definition " + name)
+		return nil
+	}
+	if net.Driver == "bridge" {
+		if net.VLAN, err = kp.freeVLAN(ctx); err != nil {
+			return err
+		}
+	}
+	def, err := net.definition(name, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := kp.apply(ctx, def); err != nil {
+		return err
+	}
+	kp.log.With(link.Name).Success(fmt.Sprintf("created network attachment definition %s with subnets=[%v, %v], type=%s, vlan=%d", name, link.IPv4Subnet, link.IPv6Subnet, net.Driver, net.VLAN))
+	return nil
+}
+
+// LinkRemove deletes the NetworkAttachmentDefinition of the link.
+func (kp *KubernetesProvider) LinkRemove(ctx context.Context, link topology.Link) error {
+	name := definitionName(link.Name, link.Labels)
+	def, err := kp.getDefinition(ctx, name)
+	if err != nil {
+		return err
+	}
+	if def == nil {
+		kp.log.With(link.Name).Skipped("already removed network attachment definition " + name)
+		return nil
+	}
+	if !owned(def.Metadata.Labels, link.Labels) {
+		return fmt.Errorf("refusing to remove network attachment definition %s, which golab did not create for this lab", name)
+	}
+	if _, err := kp.kubectl(ctx, nil, "delete", definitionResource, name, "--ignore-not-found"); err != nil {
+		return err
+	}
+	kp.log.With(link.Name).Success("removed network attachment definition " + name)
+	return nil
+}
+
+// LinkConnect is not supported, as Multus attaches pods to their networks only when they are created.
+func (kp *KubernetesProvider) LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	return fmt.Errorf("link %s: connecting running nodes is not supported by the kubernetes provider", link.Name)
+}
+
+// LinkDisconnect is not supported, as Multus detaches pods from their networks only when they are deleted.
+func (kp *KubernetesProvider) LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	return fmt.Errorf("link %s: disconnecting running nodes is not supported by the kubernetes provider", link.Name)
+}
+
+// objectName turns a name into a valid name of a Kubernetes object, which is lowercase alphanumeric with dashes
+// and at most maxNameLength long. Names which have to be changed get a suffix hashed from them, so that they
+// stay unique.
+func objectName(name string) string {
+	valid := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	valid = strings.Trim(valid, "-")
+	if valid == name && len(name) <= maxNameLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	valid = strings.TrimRight(valid[:min(len(valid), maxNameLength-7)], "-")
+	if valid == "" {
+		valid = "golab"
+	}
+	return valid + "-" + hex.EncodeToString(sum[:])[:6]
+}
+
+// labName prefixes the name of a topology entity with the lab it is labeled with, so that labs
+// with the same node names can run side by side. Entities without a lab keep their names.
+func labName(name string, labels map[string]string) string {
+	if lab := labels[topology.LabLabel]; lab != "" {
+		return lab + "-" + name
+	}
+	return name
+}
+
+// podName resolves the name of the pod running the node, which is the one of the node a sidecar belongs to.
+func podName(node topology.Node) string {
+	name := node.Name
+	if target, ok := strings.CutPrefix(node.NetworkMode, "container:"); ok {
+		name = target
+	}
+	return objectName(labName(name, node.Labels))
+}
+
+// containerName resolves the name of the container running the node in its pod.
+func containerName(node topology.Node) string {
+	if node.NetworkMode != "" {
+		return objectName(node.Name)
+	}
+	return nodeContainer
+}
+
+// definitionName resolves the name of the NetworkAttachmentDefinition representing the link with the name,
+// which belongs to the lab the labels refer to.
+func definitionName(link string, labels map[string]string) string {
+	return objectName(labName(link, labels))
+}
+
+// objectLabels returns the labels of a Kubernetes object representing a topology entity with the labels, which only
+// keep the lab as the others may not be valid label values, along with the extra labels.
+func objectLabels(labels, extra map[string]string) map[string]string {
+	objLabels := map[string]string{managedLabel: "true"}
+	if lab, ok := labels[topology.LabLabel]; ok {
+		objLabels[topology.LabLabel] = lab
+	}
+	maps.Copy(objLabels, extra)
+	return objLabels
+}
+
+// owned tells whether a Kubernetes object was created by golab for the lab of the topology entity, rather than
+// merely sharing its name.
+func owned(labels, want map[string]string) bool {
+	return labels[managedLabel] == "true" && labels[topology.LabLabel] == want[topology.LabLabel]
+}
+
+// labSelector selects Kubernetes objects owned by the provided lab or by any lab if it is empty.
+func labSelector(lab string) string {
+	if lab == "" {
+		return managedLabel + "=true," + topology.LabLabel
+	}
+	return managedLabel + "=true," + topology.LabLabel + "=" + lab
+}
+
+// apply creates the objects in the namespace of golab, which is created along with them.
+func (kp *KubernetesProvider) apply(ctx context.Context, objects ...any) error {
+	namespace := map[string]any{"apiVersion": "v1", "kind": "Namespace", "metadata": metadata{Name: kp.namespace}}
+	list := map[string]any{"apiVersion": "v1", "kind": "List", "items": append([]any{namespace}, objects...)}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = kp.kubectl(ctx, bytes.NewReader(data), "apply", "--filename", "-")
+	return err
+}
+
+// getPod returns the pod with the name, or nil if there is none.
+func (kp *KubernetesProvider) getPod(ctx context.Context, name string) (*pod, error) {
+	out, err := kp.kubectl(ctx, nil, "get", "pod", name, "--ignore-not-found", "--output", "json")
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+	var p pod
+	if err := json.Unmarshal(out, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode pod %s: %w", name, err)
+	}
+	return &p, nil
+}
+
+// record decodes the record of the node kept by the pod.
+func (p *pod) record() (*nodeRecord, error) {
+	var rec nodeRecord
+	if err := json.Unmarshal([]byte(p.Metadata.Annotations[recordAnnotation]), &rec); err != nil {
+		return nil, fmt.Errorf("pod %s has a malformed record: %w", p.Metadata.Name, err)
+	}
+	return &rec, nil
+}
+
+// containerStatus returns the status of the container with the name, which is nil until the pod is scheduled.
+func (p *pod) containerStatus(name string) *containerStatus {
+	if p.Status == nil {
+		return nil
+	}
+	j := slices.IndexFunc(p.Status.ContainerStatuses, func(st containerStatus) bool { return st.Name == name })
+	if j < 0 {
+		return nil
+	}
+	return &p.Status.ContainerStatuses[j]
+}
+
+// condition returns the status of the condition of the pod with the type along with its message.
+func (p *pod) condition(kind string) (bool, string) {
+	if p.Status == nil {
+		return false, ""
+	}
+	for _, c := range p.Status.Conditions {
+		if c.Type == kind {
+			return c.Status == "True", c.Message
+		}
+	}
+	return false, ""
+}
+
+// NodeExists checks whether a pod representing the provided topology.Node already exists.
+func (kp *KubernetesProvider) NodeExists(ctx context.Context, node topology.Node) (bool, error) {
+	p, err := kp.getPod(ctx, podName(node))
+	return p != nil, err
+}
+
+// NodeRunning checks whether the container of the provided topology.Node is running in its pod.
+func (kp *KubernetesProvider) NodeRunning(ctx context.Context, node topology.Node) (bool, error) {
+	p, err := kp.getPod(ctx, podName(node))
+	if err != nil || p == nil {
+		return false, err
+	}
+	st := p.containerStatus(containerName(node))
+	return st != nil && st.State.Running != nil, nil
+}
+
+// unsupported returns an error for the first setting of the node or its sidecars which has no Kubernetes counterpart.
+// Binds are left out along with named volumes, since their sources are on the host running golab.
+func unsupported(node topology.Node) error {
+	for _, n := range append([]*topology.Node{&node}, node.Sidecars...) {
+		var setting string
+		switch {
+		case n.VM():
+			setting = "qcow2 image " + n.Image
+		case len(n.Ports) != 0:
+			setting = "ports"
+		case len(n.Binds) != 0:
+			setting = "binds"
+		case len(n.Volumes) != 0:
+			setting = "volumes"
+		case n.DNSDomain != "":
+			setting = "dns"
+		}
+		for _, iface := range n.Interfaces {
+			if setting == "" && iface.Veth {
+				setting = "veth link " + iface.Link
+			}
+			for _, key := range slices.Sorted(maps.Keys(iface.DriverOpts)) {
+				if setting == "" && key != ifnameOption {
+					setting = "endpoint option " + key
+				}
+			}
+		}
+		if setting != "" {
+			return fmt.Errorf("node %s sets %s, which is not supported by the kubernetes provider", n.Name, setting)
+		}
+	}
+	return nil
+}
+
+// restartPolicy translates the restart policy of the node into the one of its pod.
+func restartPolicy(node topology.Node) string {
+	switch node.Restart {
+	case "on-failure":
+		return "OnFailure"
+	case "unless-stopped":
+		return "Always"
+	}
+	return "Never"
+}
+
+// hostname returns the hostname of the pod of the node, which Kubernetes requires to be lowercase, or nothing if
+// the name of the node cannot be turned into one, leaving the pod with its own name.
+func hostname(node topology.Node) string {
+	name := strings.ToLower(node.Name)
+	if len(name) > maxNameLength || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+		return ""
+	}
+	return strings.Trim(name, "-")
+}
+
+// generateContainer converts the node into the container running it. Like with Docker, the entrypoint and the
+// command of the node override the ones of the image separately.
+func generateContainer(node topology.Node, volumes *[]volume) containerSpec {
+	c := containerSpec{
+		Name:    containerName(node),
+		Image:   node.Image,
+		Command: node.Entrypoint,
+		Args:    node.Cmd,
+	}
+	for _, key := range slices.Sorted(maps.Keys(node.Env)) {
+		c.Env = append(c.Env, nameValue{Name: key, Value: node.Env[key]})
+	}
+	if node.Privileged || len(node.Capabilities) != 0 || len(node.CapDrop) != 0 {
+		c.SecurityContext = &containerSecurity{Privileged: node.Privileged}
+		if len(node.Capabilities) != 0 || len(node.CapDrop) != 0 {
+			c.SecurityContext.Capabilities = &capabilities{Add: node.Capabilities, Drop: node.CapDrop}
+		}
+	}
+	if node.CPUs != 0 || node.Memory != "" {
+		c.Resources = &resources{Limits: make(map[string]string, 2)}
+		if node.CPUs != 0 {
+			c.Resources.Limits["cpu"] = strconv.FormatFloat(node.CPUs, 'f', -1, 64)
+		}
+		if node.Memory != "" {
+			// the memory limit is validated along with the topology
+			memory, _ := units.RAMInBytes(node.Memory)
+			c.Resources.Limits["memory"] = strconv.FormatInt(memory, 10)
+		}
+	}
+	for _, target := range node.Tmpfs {
+		v := volume{Name: fmt.Sprintf("tmpfs-%d", len(*volumes))}
+		v.EmptyDir.Medium = "Memory"
+		*volumes = append(*volumes, v)
+		c.VolumeMounts = append(c.VolumeMounts, volumeMount{Name: v.Name, MountPath: target})
+	}
+	if len(node.ReadyCommand) != 0 && readyTimeout(node) != 0 {
+		c.ReadinessProbe = &probe{PeriodSeconds: int(readyInterval / time.Second)}
+		c.ReadinessProbe.Exec.Command = node.ReadyCommand
+	}
+	return c
+}
+
+// generatePod converts the node into its pod attached to the networks, with the default network replaced by the
+// NetworkAttachmentDefinition with the name, if any. Sidecars are containers of the pod, which share its network
+// namespace and, if any of them asks for it, its PID namespace.
+func (kp *KubernetesProvider) generatePod(node topology.Node, rec *nodeRecord, networks []networkSelection, defaultNetwork string) (*pod, error) {
+	record, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	p := &pod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: metadata{
+			Name:   podName(node),
+			Labels: objectLabels(node.Labels, nil),
+			Annotations: map[string]string{
+				recordAnnotation:           string(record),
+				defaultContainerAnnotation: nodeContainer,
+			},
+		},
+		Spec: podSpec{
+			Hostname:                      hostname(node),
+			RestartPolicy:                 restartPolicy(node),
+			TerminationGracePeriodSeconds: gracePeriod(node),
+		},
+	}
+	if len(networks) != 0 {
+		selections, err := json.Marshal(networks)
+		if err != nil {
+			return nil, err
+		}
+		p.Metadata.Annotations[networksAnnotation] = string(selections)
+	}
+	if defaultNetwork != "" {
+		p.Metadata.Annotations[defaultNetworkAnnotation] = kp.namespace + "/" + defaultNetwork
+	}
+	if len(node.Sysctls) != 0 {
+		p.Spec.SecurityContext = &podSecurity{}
+		for _, key := range slices.Sorted(maps.Keys(node.Sysctls)) {
+			p.Spec.SecurityContext.Sysctls = append(p.Spec.SecurityContext.Sysctls, nameValue{Name: key, Value: node.Sysctls[key]})
+		}
+	}
+	p.Spec.Containers = append(p.Spec.Containers, generateContainer(node, &p.Spec.Volumes))
+	for _, sidecar := range node.Sidecars {
+		p.Spec.Containers = append(p.Spec.Containers, generateContainer(*sidecar, &p.Spec.Volumes))
+		p.Spec.ShareProcessNamespace = p.Spec.ShareProcessNamespace || sidecar.PIDMode != ""
+	}
+	return p, nil
+}
+
+// attachments resolves the networks the interfaces of the node and its management interface are attached to.
+// The interface replacing the default network of the pod needs a NetworkAttachmentDefinition of its own, which is
+// returned along with the networks of the other interfaces. Subinterfaces are created inside the node on top of
+// their parent interfaces.
+func (kp *KubernetesProvider) attachments(ctx context.Context, node topology.Node) ([]networkSelection, *networkAttachmentDefinition, error) {
+	ifaces := node.Interfaces
+	if node.Mgmt != nil {
+		ifaces = append(slices.Clip(ifaces), node.Mgmt)
+	}
+	var networks []networkSelection
+	var defaultNetwork *networkAttachmentDefinition
+	for _, iface := range ifaces {
+		if iface.VLAN != 0 {
+			continue
+		}
+		name := definitionName(iface.Link, node.Labels)
+		def, err := kp.getDefinition(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if def == nil {
+			return nil, nil, fmt.Errorf("network attachment definition %s of link %s does not exist", name, iface.Link)
+		}
+		if iface.Name != podInterface {
+			selection := networkSelection{Name: name, Interface: iface.Name}
+			for _, addr := range ipamAddresses(iface) {
+				selection.IPs = append(selection.IPs, addr.Address)
+			}
+			networks = append(networks, selection)
+			continue
+		}
+		net, err := def.record()
+		if err != nil {
+			return nil, nil, err
+		}
+		pod := podName(node)
+		defaultNetwork, err = net.definition(objectName(pod+"-"+iface.Name), iface, map[string]string{nodeLabel: pod})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return networks, defaultNetwork, nil
+}
+
+// NodeCreate translates a topology.Node entity into a pod and creates it, waiting for it to start and become
+// ready. Interfaces of the node are attached to their Multus networks as the pod is created, so that they are
+// present when the network OS boots. Sidecars are created along with the pods of their nodes.
+func (kp *KubernetesProvider) NodeCreate(ctx context.Context, node topology.Node) error {
+	name := podName(node)
+	if node.NetworkMode != "" {
+		return kp.sidecar(ctx, node, "created")
+	}
+	if err := unsupported(node); err != nil {
+		return err
+	}
+	p, err := kp.getPod(ctx, name)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		if !owned(p.Metadata.Labels, node.Labels) {
+			return fmt.Errorf("refusing to replace pod %s, which golab did not create for this lab", name)
+		}
+		// pods whose containers have exited for good are recreated, as pods cannot be started again
+		if p.Status == nil || p.Status.Phase != "Succeeded" && p.Status.Phase != "Failed" {
+			kp.log.With(node.Name).Skipped("already created pod " + name)
+			return nil
+		}
+		if err := kp.deletePod(ctx, node); err != nil {
+			return err
+		}
+	}
+	networks, defaultNetwork, err := kp.attachments(ctx, node)
+	if err != nil {
+		return err
+	}
+	rec := &nodeRecord{Name: node.Name, Labels: node.Labels, Interfaces: node.Interfaces}
+	if node.Mgmt != nil {
+		rec.Interfaces = append(slices.Clip(rec.Interfaces), node.Mgmt)
+	}
+	for _, sidecar := range node.Sidecars {
+		rec.Sidecars = append(rec.Sidecars, sidecar.Name)
+	}
+	objects := []any{}
+	if defaultNetwork != nil {
+		objects = append(objects, defaultNetwork)
+	}
+	manifest, err := kp.generatePod(node, rec, networks, metadataName(defaultNetwork))
+	if err != nil {
+		return err
+	}
+	if err := kp.apply(ctx, append(objects, manifest)...); err != nil {
+		return err
+	}
+	if err := kp.waitStarted(ctx, node); err != nil {
+		return err
+	}
+	kp.log.With(node.Name).Success("started pod " + name)
+	return kp.waitReady(ctx, node)
+}
+
+// metadataName returns the name of the NetworkAttachmentDefinition, if any.
+func metadataName(def *networkAttachmentDefinition) string {
+	if def == nil {
+		return ""
+	}
+	return def.Metadata.Name
+}
+
+// sidecar checks that the container of the sidecar exists in the pod of its node, which the action is taken
+// on along with the pod.
+func (kp *KubernetesProvider) sidecar(ctx context.Context, node topology.Node, action string) error {
+	name, container := podName(node), containerName(node)
+	p, err := kp.getPod(ctx, name)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		if action == "created" {
+			return fmt.Errorf("pod %s of sidecar %s does not exist", name, node.Name)
+		}
+		kp.log.With(node.Name).Skipped(fmt.Sprintf("already %s container %s along with pod %s", action, container, name))
+		return nil
+	}
+	if !slices.ContainsFunc(p.Spec.Containers, func(c containerSpec) bool { return c.Name == container }) {
+		return fmt.Errorf("pod %s has no container %s of sidecar %s, wreck the lab to recreate it", name, container, node.Name)
+	}
+	kp.log.With(node.Name).Skipped(fmt.Sprintf("already %s container %s along with pod %s", action, container, name))
+	return nil
+}
+
+// watch polls the pod of the node until the condition holds or the timeout passes, which it reports by returning
+// the last pod it got without an error. Containers of the node which exit or cannot be created end the watch
+// with an error.
+func (kp *KubernetesProvider) watch(ctx context.Context, node topology.Node, timeout time.Duration, done func(*pod) bool) (*pod, bool, error) {
+	name := podName(node)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		p, err := kp.getPod(ctx, name)
+		if err != nil {
+			return nil, false, err
+		}
+		if p == nil {
+			return nil, false, fmt.Errorf("pod %s was deleted while starting", name)
+		}
+		if st := p.containerStatus(nodeContainer); st != nil {
+			if st.State.Terminated != nil || st.LastState.Terminated != nil {
+				return nil, false, kp.crashed(ctx, node, st)
+			}
+			if st.State.Waiting != nil && slices.Contains(fatalReasons, st.State.Waiting.Reason) {
+				return nil, false, fmt.Errorf("pod %s cannot start: %s: %s", name, st.State.Waiting.Reason, st.State.Waiting.Message)
+			}
+		}
+		if done(p) {
+			return p, true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-timer.C:
+			return p, false, nil
+		case <-time.After(readyInterval):
+		}
+	}
+}
+
+// waitStarted waits until the node runs in its pod, which is scheduled and gets its image pulled first, and checks
+// that it keeps running for the minimum uptime of the node, so that images crashing on boot are reported along
+// with their last log lines.
+func (kp *KubernetesProvider) waitStarted(ctx context.Context, node topology.Node) error {
+	name := podName(node)
+	kp.log.With(node.Name).Progress(fmt.Sprintf("waiting for pod %s to be scheduled and started", name))
+	p, ok, err := kp.watch(ctx, node, defaultStartTimeout, func(p *pod) bool {
+		st := p.containerStatus(nodeContainer)
+		return st != nil && st.State.Running != nil
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// unschedulable pods tell why in their conditions
+		if scheduled, msg := p.condition("PodScheduled"); !scheduled && msg != "" {
+			return fmt.Errorf("pod %s is not running after %s: %s", name, defaultStartTimeout, msg)
+		}
+		return fmt.Errorf("pod %s is not running after %s", name, defaultStartTimeout)
+	}
+	var minUptime time.Duration
+	if node.MinUptime != "" {
+		// the uptime is validated along with the topology
+		minUptime, _ = time.ParseDuration(node.MinUptime)
+	}
+	if minUptime == 0 {
+		return nil
+	}
+	kp.log.With(node.Name).Progress(fmt.Sprintf("checking that pod %s keeps running for %s", name, minUptime))
+	_, _, err = kp.watch(ctx, node, minUptime, func(*pod) bool { return false })
+	return err
+}
+
+// crashed logs the last lines the node wrote before exiting and returns an error with its exit code.
+func (kp *KubernetesProvider) crashed(ctx context.Context, node topology.Node, st *containerStatus) error {
+	name := podName(node)
+	args := []string{"logs", name, "--container", nodeContainer, "--tail", strconv.Itoa(crashLogLines)}
+	exit := st.State.Terminated
+	if exit == nil {
+		// the node has been restarted since it exited
+		args, exit = append(args, "--previous"), st.LastState.Terminated
+	}
+	logs, err := kp.kubectl(ctx, nil, args...)
+	if err != nil {
+		return err
+	}
+	for line := range strings.Lines(string(logs)) {
+		kp.log.With(node.Name).Warn(strings.TrimRight(line, "\n"))
+	}
+	return fmt.Errorf("pod %s exited with code %d while starting", name, exit.ExitCode)
+}
+
+// readyTimeout returns how long the pod of the node may take to become ready once started.
+func readyTimeout(node topology.Node) time.Duration {
+	timeout := defaultReadyTimeout
+	if node.ReadyTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.ReadyTimeout)
+	}
+	return timeout
+}
+
+// waitReady waits until the pod of the node is ready, which its readiness probe running the ready command of the
+// node tells, so that configuration does not race the boot of the network OS.
+func (kp *KubernetesProvider) waitReady(ctx context.Context, node topology.Node) error {
+	timeout := readyTimeout(node)
+	if timeout == 0 || len(node.ReadyCommand) == 0 {
+		return nil
+	}
+	name := podName(node)
+	kp.log.With(node.Name).Progress("waiting for pod " + name + " to become ready")
+	_, ok, err := kp.watch(ctx, node, timeout, func(p *pod) bool {
+		ready, _ := p.condition("Ready")
+		return ready
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("pod %s is not ready after %s", name, timeout)
+	}
+	kp.log.With(node.Name).Success("pod " + name + " is ready")
+	return nil
+}
+
+// gracePeriod returns how many seconds the pod of the node is given to shut down when deleted, after which it
+// is killed. Timeouts are rounded up to whole seconds, and Kubernetes takes a grace period of zero as one.
+func gracePeriod(node topology.Node) int {
+	timeout := defaultStopTimeout
+	if node.StopTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.StopTimeout)
+	}
+	return max(int(math.Ceil(timeout.Seconds())), 1)
+}
+
+// deletePod deletes the pod of the node and waits until it is gone, so that its name can be taken again.
+func (kp *KubernetesProvider) deletePod(ctx context.Context, node topology.Node) error {
+	_, err := kp.kubectl(ctx, nil, "delete", "pod", podName(node), "--ignore-not-found", "--wait", "--grace-period", strconv.Itoa(gracePeriod(node)))
+	return err
+}
+
+// NodeRemove deletes the pod representing the provided topology.Node along with the NetworkAttachmentDefinition
+// replacing its default network, if any. Pods shut down gracefully first, so that network OSes can save their
+// state and release locks.
+func (kp *KubernetesProvider) NodeRemove(ctx context.Context, node topology.Node) error {
+	if node.NetworkMode != "" {
+		return kp.sidecar(ctx, node, "removed")
+	}
+	name := podName(node)
+	p, err := kp.getPod(ctx, name)
+	if err != nil {
+		return err
+	}
+	if p != nil && !owned(p.Metadata.Labels, node.Labels) {
+		return fmt.Errorf("refusing to remove pod %s, which golab did not create for this lab", name)
+	}
+	if p != nil {
+		if err := kp.deletePod(ctx, node); err != nil {
+			return err
+		}
+	}
+	// the definition is applied along with the pod, which may have failed to be created
+	if _, err := kp.kubectl(ctx, nil, "delete", definitionResource, "--selector", nodeLabel+"="+name, "--ignore-not-found"); err != nil {
+		return err
+	}
+	if p == nil {
+		kp.log.With(node.Name).Skipped("already removed pod " + name)
+		return nil
+	}
+	kp.log.With(node.Name).Success("removed pod " + name)
+	return nil
+}
+
+// NodePause is not supported, as Kubernetes cannot freeze the processes of pods.
+func (kp *KubernetesProvider) NodePause(ctx context.Context, node topology.Node) error {
+	return fmt.Errorf("node %s: pausing is not supported by the kubernetes provider", node.Name)
+}
+
+// NodeUnpause is not supported, as Kubernetes cannot freeze the processes of pods.
+func (kp *KubernetesProvider) NodeUnpause(ctx context.Context, node topology.Node) error {
+	return fmt.Errorf("node %s: resuming is not supported by the kubernetes provider", node.Name)
+}
+
+// NodeStop deletes the pod representing the provided topology.Node, as pods cannot be stopped, while the
+// NetworkAttachmentDefinition replacing its default network is kept for the pod created when it is started.
+func (kp *KubernetesProvider) NodeStop(ctx context.Context, node topology.Node) error {
+	if node.NetworkMode != "" {
+		return kp.sidecar(ctx, node, "stopped")
+	}
+	name := podName(node)
+	p, err := kp.getPod(ctx, name)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		kp.log.With(node.Name).Skipped("already stopped pod " + name)
+		return nil
+	}
+	if err := kp.deletePod(ctx, node); err != nil {
+		return err
+	}
+	kp.log.With(node.Name).Success("stopped pod " + name + ", which is created again when started")
+	return nil
+}
+
+// NodeStart creates the pod representing the provided topology.Node again and waits for it to become ready.
+// Whatever the node kept is lost along with the stopped pod.
+func (kp *KubernetesProvider) NodeStart(ctx context.Context, node topology.Node) error {
+	if node.NetworkMode != "" {
+		return kp.sidecar(ctx, node, "started")
+	}
+	running, err := kp.NodeRunning(ctx, node)
+	if err != nil {
+		return err
+	}
+	if running {
+		kp.log.With(node.Name).Skipped("already started pod " + podName(node))
+		return nil
+	}
+	return kp.NodeCreate(ctx, node)
+}
+
+// NodeCommit is not supported, as Kubernetes has no counterpart of docker commit.
+func (kp *KubernetesProvider) NodeCommit(ctx context.Context, node topology.Node, ref string) error {
+	return fmt.Errorf("node %s: snapshots are not supported by the kubernetes provider", node.Name)
+}
+
+// NodeExec runs a command inside the container of the provided topology.Node and returns the exit code of the
+// command, which kubectl exits with.
+func (kp *KubernetesProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	args := append([]string{"exec", podName(node), "--container", containerName(node), "--"}, cmd...)
+	return kp.run(ctx, Command{Args: args, Stdout: stdout, Stderr: stderr})
+}
+
+// NodeShell runs an interactive command inside the container of the provided topology.Node with a pseudo-terminal
+// attached to the provided TTY and returns the exit code of the command. kubectl sizes the pseudo-terminal after
+// the terminal it is attached to.
+func (kp *KubernetesProvider) NodeShell(ctx context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error) {
+	args := append([]string{"exec", podName(node), "--container", containerName(node), "--stdin", "--tty", "--"}, cmd...)
+	return kp.run(ctx, Command{Args: args, Stdin: tty.In, Stdout: tty.Out, Stderr: tty.Out})
+}
+
+// NodeLogs writes logs of the container of the provided topology.Node, which Kubernetes keeps mixing its standard
+// output and error, so everything is written to stdout. Only the last tail lines are written unless tail is
+// negative, and new output is streamed until the context is canceled if follow is set.
+func (kp *KubernetesProvider) NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, stderr io.Writer) error {
+	args := []string{"logs", podName(node), "--container", containerName(node), "--tail", strconv.Itoa(tail)}
+	if follow {
+		args = append(args, "--follow")
+	}
+	var errOut bytes.Buffer
+	exitCode, err := kp.run(ctx, Command{Args: args, Stdout: stdout, Stderr: &errOut})
+	if err != nil {
+		if follow && ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("kubectl: %s", strings.TrimPrefix(strings.TrimSpace(errOut.String()), "error: "))
+	}
+	return nil
+}
+
+// podMetrics is the part of the metrics of a pod reported by the metrics API which golab uses.
+type podMetrics struct {
+	Containers []struct {
+		Name  string `json:"name"`
+		Usage struct {
+			CPU    string `json:"cpu"`
+			Memory string `json:"memory"`
+		} `json:"usage"`
+	} `json:"containers"`
+}
+
+// quantitySuffixes are the multipliers of the suffixes of Kubernetes quantities, two-letter ones first.
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"n", 1e-9}, {"u", 1e-6}, {"m", 1e-3}, {"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// parseQuantity parses a Kubernetes quantity, e.g. 250m cores or 512Mi bytes.
+func parseQuantity(s string) (float64, error) {
+	multiplier := 1.0
+	for _, q := range quantitySuffixes {
+		if number, ok := strings.CutSuffix(s, q.suffix); ok {
+			s, multiplier = number, q.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	return value * multiplier, nil
+}
+
+// NodeStats collects resource usage of the container of the provided topology.Node from the metrics API, which
+// requires the metrics server in the cluster, while traffic counters are read from /proc/net/dev of the node.
+func (kp *KubernetesProvider) NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error) {
+	name, container := podName(node), containerName(node)
+	out, err := kp.kubectl(ctx, nil, "get", "--raw", fmt.Sprintf("/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods/%s", kp.namespace, name))
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	var metrics podMetrics
+	if err := json.Unmarshal(out, &metrics); err != nil {
+		return topology.NodeStats{}, fmt.Errorf("failed to decode metrics of pod %s: %w", name, err)
+	}
+	var nodeStats topology.NodeStats
+	for _, c := range metrics.Containers {
+		if c.Name != container {
+			continue
+		}
+		cores, err := parseQuantity(c.Usage.CPU)
+		if err != nil {
+			return topology.NodeStats{}, err
+		}
+		memory, err := parseQuantity(c.Usage.Memory)
+		if err != nil {
+			return topology.NodeStats{}, err
+		}
+		nodeStats.CPUPercent, nodeStats.MemUsage = cores*100, uint64(memory)
+	}
+	if node.Memory != "" {
+		limit, _ := units.RAMInBytes(node.Memory)
+		nodeStats.MemLimit = uint64(limit)
+	}
+	var netDev bytes.Buffer
+	exitCode, err := kp.NodeExec(ctx, node, []string{"cat", "/proc/net/dev"}, &netDev, io.Discard)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	if exitCode != 0 {
+		return topology.NodeStats{}, fmt.Errorf("failed to read interface counters of pod %s", name)
+	}
+	for _, iface := range parseNetDev(netDev.String()) {
+		nodeStats.RxBytes += iface.RxBytes
+		nodeStats.TxBytes += iface.TxBytes
+		nodeStats.RxPackets += iface.RxPackets
+		nodeStats.TxPackets += iface.TxPackets
+		nodeStats.Interfaces = append(nodeStats.Interfaces, iface)
+	}
+	return nodeStats, nil
+}
+
+// parseNetDev parses the counters of the interfaces listed in /proc/net/dev except for the loopback, sorted by name.
+func parseNetDev(netDev string) []topology.InterfaceStats {
+	var ifaces []topology.InterfaceStats
+	for line := range strings.Lines(netDev) {
+		// the two header lines hold no colons
+		name, counters, ok := strings.Cut(line, ":")
+		fields := strings.Fields(counters)
+		if !ok || len(fields) < 12 || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		values := make([]uint64, len(fields))
+		for i, field := range fields {
+			values[i], _ = strconv.ParseUint(field, 10, 64)
+		}
+		ifaces = append(ifaces, topology.InterfaceStats{
+			Name:      strings.TrimSpace(name),
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			RxErrors:  values[2],
+			RxDropped: values[3],
+			TxBytes:   values[8],
+			TxPackets: values[9],
+			TxErrors:  values[10],
+			TxDropped: values[11],
+		})
+	}
+	slices.SortFunc(ifaces, func(a, b topology.InterfaceStats) int { return strings.Compare(a.Name, b.Name) })
+	return ifaces
+}
+
+// listPods returns the pods matching the label selector.
+func (kp *KubernetesProvider) listPods(ctx context.Context, selector string) ([]pod, error) {
+	out, err := kp.kubectl(ctx, nil, "get", "pods", "--selector", selector, "--output", "json")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []pod `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode pods: %w", err)
+	}
+	return list.Items, nil
+}
+
+// RemoveOrphans removes all pods and NetworkAttachmentDefinitions labeled as owned by the provided lab, or by any
+// lab if it is empty. Unlike Wreck, it does not depend on the topology file, which may have changed since.
+func (kp *KubernetesProvider) RemoveOrphans(ctx context.Context, lab string) error {
+	out, err := kp.kubectl(ctx, nil, "delete", "pods,"+definitionResource, "--selector", labSelector(lab), "--ignore-not-found", "--wait", "--output", "name")
+	if err != nil {
+		return err
+	}
+	names := strings.Fields(string(out))
+	for _, name := range names {
+		kp.log.With(name).Success("removed " + name)
+	}
+	if len(names) == 0 {
+		kp.log.Skipped("found no leftover kubernetes objects")
+	}
+	return nil
+}
+
+// Deployed reports pods and NetworkAttachmentDefinitions labeled as owned by the provided lab, translated back
+// into topology entities with the attributes recorded when they were created. Sidecars are reported as nodes of
+// their own, like with the other providers.
+func (kp *KubernetesProvider) Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	pods, err := kp.listPods(ctx, labSelector(lab))
+	if err != nil {
+		return nil, nil, err
+	}
+	var nodes []topology.Node
+	for _, p := range pods {
+		rec, err := p.record()
+		if err != nil {
+			return nil, nil, err
+		}
+		images := make(map[string]string, len(p.Spec.Containers))
+		for _, c := range p.Spec.Containers {
+			images[c.Name] = c.Image
+		}
+		n := topology.Node{Name: rec.Name, Image: images[nodeContainer], Labels: rec.Labels}
+		for _, iface := range rec.Interfaces {
+			n.Interfaces = append(n.Interfaces, &topology.Interface{Link: iface.Link, IPv4Addr: strings.Split(iface.IPv4Addr, "/")[0]})
+		}
+		nodes = append(nodes, n)
+		for _, sidecar := range rec.Sidecars {
+			nodes = append(nodes, topology.Node{Name: sidecar, Image: images[objectName(sidecar)], Labels: rec.Labels})
+		}
+	}
+	slices.SortFunc(nodes, func(a, b topology.Node) int { return strings.Compare(a.Name, b.Name) })
+	defs, err := kp.listDefinitions(ctx, labSelector(lab)+",!"+nodeLabel)
+	if err != nil {
+		return nil, nil, err
+	}
+	links := make([]topology.Link, 0, len(defs))
+	for _, def := range defs {
+		net, err := def.record()
+		if err != nil {
+			return nil, nil, err
+		}
+		links = append(links, topology.Link{
+			Name:       net.Name,
+			Labels:     net.Labels,
+			MTU:        net.MTU,
+			IPv4Subnet: net.IPv4Subnet,
+			IPv6Subnet: net.IPv6Subnet,
+		})
+	}
+	return nodes, links, nil
+}
@@ -0,0 +1,572 @@
+package kubernetes_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elupevg/golab/kubernetes"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeResult struct {
+	stdout   string
+	exitCode int
+}
+
+// fakeRunner records the kubectl command lines it is given, without the namespace, and answers them with the
+// queued results, the last of which keeps answering. Commands without results succeed without output.
+type fakeRunner struct {
+	mu       sync.Mutex
+	results  map[string][]fakeResult
+	commands []string
+	stdins   []string
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{results: make(map[string][]fakeResult)}
+}
+
+func (r *fakeRunner) on(command string, results ...fakeResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[command] = results
+}
+
+func (r *fakeRunner) Run(ctx context.Context, cmd kubernetes.Command) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(cmd.Args) < 2 || cmd.Args[0] != "--namespace" || cmd.Args[1] != "golab" {
+		return 0, errors.New("kubectl run outside of the golab namespace")
+	}
+	line := strings.Join(append([]string{"kubectl"}, cmd.Args[2:]...), " ")
+	r.commands = append(r.commands, line)
+	if cmd.Stdin != nil {
+		stdin, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return 0, err
+		}
+		r.stdins = append(r.stdins, string(stdin))
+	}
+	results := r.results[line]
+	if len(results) == 0 {
+		return 0, nil
+	}
+	result := results[0]
+	if len(results) > 1 {
+		r.results[line] = results[1:]
+	}
+	if result.exitCode != 0 {
+		io.WriteString(cmd.Stderr, "error: "+result.stdout)
+		return result.exitCode, nil
+	}
+	io.WriteString(cmd.Stdout, result.stdout)
+	return 0, nil
+}
+
+func newProvider() (*kubernetes.KubernetesProvider, *fakeRunner) {
+	runner := newFakeRunner()
+	return kubernetes.New(runner, kubernetes.DefaultNamespace, logger.New(io.Discard, io.Discard)), runner
+}
+
+var (
+	labLabels = map[string]string{topology.LabLabel: "lab1"}
+	testLink  = topology.Link{
+		Name:        "link-01",
+		Endpoints:   []string{"r1", "r2"},
+		IPv4Subnet:  "10.0.0.0/24",
+		IPv4Gateway: "10.0.0.254",
+		Labels:      labLabels,
+	}
+)
+
+func testNode() topology.Node {
+	return topology.Node{
+		Name:         "r1",
+		Image:        "frrouting/frr:v8",
+		Labels:       labLabels,
+		Env:          map[string]string{"A": "1"},
+		Capabilities: []string{"NET_ADMIN"},
+		CPUs:         1.5,
+		Memory:       "512m",
+		Tmpfs:        []string{"/run"},
+		Sysctls:      map[string]string{"net.ipv4.ip_forward": "1"},
+		StopTimeout:  "2500ms",
+		Interfaces: []*topology.Interface{{
+			Name:       "eth1",
+			Link:       "link-01",
+			IPv4Addr:   "10.0.0.1/24",
+			DriverOpts: map[string]string{"com.docker.network.endpoint.ifname": "eth1"},
+		}},
+	}
+}
+
+// definition returns a NetworkAttachmentDefinition of link-01 recorded with the VLAN.
+func definition(t *testing.T, name string, vlan int) string {
+	t.Helper()
+	record, err := json.Marshal(map[string]any{"name": name, "labels": labLabels, "ipv4_subnet": "10.0.0.0/24", "driver": "bridge", "vlan": vlan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"name":        "lab1-" + name,
+			"labels":      map[string]string{"golab.managed": "true", topology.LabLabel: "lab1"},
+			"annotations": map[string]string{"golab.record": string(record)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(def)
+}
+
+const (
+	pending = `{"metadata": {"name": "lab1-r1", "labels": {"golab.lab": "lab1", "golab.managed": "true"}}, "status": {"phase": "Pending"}}`
+	running = `{"metadata": {"name": "lab1-r1", "labels": {"golab.lab": "lab1", "golab.managed": "true"}},
+		"spec": {"containers": [{"name": "node", "image": "frrouting/frr:v8"}, {"name": "r1-ssh", "image": "ssh"}]},
+		"status": {"phase": "Running", "containerStatuses": [{"name": "node", "state": {"running": {}}}]}}`
+	crashed = `{"metadata": {"name": "lab1-r1", "labels": {"golab.lab": "lab1", "golab.managed": "true"}},
+		"status": {"phase": "Running", "containerStatuses": [{"name": "node", "restartCount": 1,
+			"state": {"waiting": {"reason": "CrashLoopBackOff"}}, "lastState": {"terminated": {"exitCode": 137}}}]}}`
+)
+
+// applied decodes the items of the manifest applied with kubectl.
+func applied(t *testing.T, stdin string) []map[string]any {
+	t.Helper()
+	var list struct {
+		Items []map[string]any `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(stdin), &list); err != nil {
+		t.Fatal(err)
+	}
+	return list.Items
+}
+
+func TestLinkCreate(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get network-attachment-definitions.k8s.cni.cncf.io --selector golab.managed=true,!golab.node --output json",
+		fakeResult{stdout: `{"items": [` + definition(t, "link-02", 2) + `]}`})
+	if err := provider.LinkCreate(context.Background(), testLink); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"kubectl get network-attachment-definitions.k8s.cni.cncf.io lab1-link-01 --ignore-not-found --output json",
+		"kubectl get network-attachment-definitions.k8s.cni.cncf.io --selector golab.managed=true,!golab.node --output json",
+		"kubectl apply --filename -",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	items := applied(t, runner.stdins[0])
+	if kind := items[0]["kind"]; kind != "Namespace" {
+		t.Errorf("first item: want Namespace, got %v", kind)
+	}
+	var got map[string]any
+	spec := items[1]["spec"].(map[string]any)
+	if err := json.Unmarshal([]byte(spec["config"].(string)), &got); err != nil {
+		t.Fatal(err)
+	}
+	wantConf := map[string]any{
+		"cniVersion": "1.0.0",
+		"name":       "lab1-link-01",
+		"plugins": []any{map[string]any{
+			"type":                "bridge",
+			"bridge":              "golab0",
+			"vlan":                float64(3),
+			"preserveDefaultVlan": false,
+			"ipam":                map[string]any{"type": "static"},
+			"capabilities":        map[string]any{"ips": true},
+		}},
+	}
+	if diff := cmp.Diff(wantConf, got); diff != "" {
+		t.Errorf("cni configuration mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkCreateExisting(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get network-attachment-definitions.k8s.cni.cncf.io lab1-link-01 --ignore-not-found --output json",
+		fakeResult{stdout: definition(t, "link-01", 7)})
+	if err := provider.LinkCreate(context.Background(), testLink); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.commands) != 1 {
+		t.Errorf("want the definition to be kept, got %q", runner.commands)
+	}
+	runner.on("kubectl get network-attachment-definitions.k8s.cni.cncf.io lab1-link-01 --ignore-not-found --output json",
+		fakeResult{stdout: `{"metadata": {"name": "lab1-link-01", "labels": {}}}`})
+	errMsg := "refusing to replace network attachment definition lab1-link-01, which golab did not create for this lab"
+	if err := provider.LinkCreate(context.Background(), testLink); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestLinkCreateUnsupported(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		link   topology.Link
+		errMsg string
+	}{
+		{
+			name:   "MacvlanWithoutHostInterface",
+			link:   topology.Link{Name: "link-01", Driver: topology.DriverMacvlan},
+			errMsg: "link link-01: macvlan links require a host interface with the kubernetes provider",
+		},
+		{
+			name:   "DriverOpts",
+			link:   topology.Link{Name: "link-01", DriverOpts: map[string]string{"com.docker.network.bridge.enable_icc": "false"}},
+			errMsg: "link link-01: driver option com.docker.network.bridge.enable_icc is not supported by the kubernetes provider",
+		},
+		{
+			name:   "EndpointOpts",
+			link:   topology.Link{Name: "link-01", EndpointOpts: map[string]map[string]string{"r1": {"com.docker.network.endpoint.sysctls": "net.ipv4.conf.IFNAME.rp_filter=0"}}},
+			errMsg: "link link-01: endpoint option com.docker.network.endpoint.sysctls of node r1 is not supported by the kubernetes provider",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			provider, runner := newProvider()
+			if err := provider.LinkCreate(context.Background(), tc.link); err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+			if len(runner.commands) != 0 {
+				t.Errorf("want no commands, got %q", runner.commands)
+			}
+		})
+	}
+}
+
+func TestNodeCreate(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get pod lab1-r1 --ignore-not-found --output json", fakeResult{}, fakeResult{stdout: pending}, fakeResult{stdout: running})
+	runner.on("kubectl get network-attachment-definitions.k8s.cni.cncf.io lab1-link-01 --ignore-not-found --output json",
+		fakeResult{stdout: definition(t, "link-01", 2)})
+	if err := provider.NodeCreate(context.Background(), testNode()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"kubectl get pod lab1-r1 --ignore-not-found --output json",
+		"kubectl get network-attachment-definitions.k8s.cni.cncf.io lab1-link-01 --ignore-not-found --output json",
+		"kubectl apply --filename -",
+		"kubectl get pod lab1-r1 --ignore-not-found --output json",
+		"kubectl get pod lab1-r1 --ignore-not-found --output json",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	items := applied(t, runner.stdins[0])
+	if len(items) != 2 {
+		t.Fatalf("want the namespace and the pod applied, got %d items", len(items))
+	}
+	got := items[1]
+	annotations := got["metadata"].(map[string]any)["annotations"].(map[string]any)
+	if networks, want := annotations["k8s.v1.cni.cncf.io/networks"], `[{"name":"lab1-link-01","interface":"eth1","ips":["10.0.0.1/24"]}]`; networks != want {
+		t.Errorf("networks: want %s, got %v", want, networks)
+	}
+	delete(got, "metadata")
+	wantPod := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"spec": map[string]any{
+			"hostname":                      "r1",
+			"restartPolicy":                 "Never",
+			"terminationGracePeriodSeconds": float64(3),
+			"securityContext":               map[string]any{"sysctls": []any{map[string]any{"name": "net.ipv4.ip_forward", "value": "1"}}},
+			"containers": []any{map[string]any{
+				"name":            "node",
+				"image":           "frrouting/frr:v8",
+				"env":             []any{map[string]any{"name": "A", "value": "1"}},
+				"securityContext": map[string]any{"capabilities": map[string]any{"add": []any{"NET_ADMIN"}}},
+				"resources":       map[string]any{"limits": map[string]any{"cpu": "1.5", "memory": "536870912"}},
+				"volumeMounts":    []any{map[string]any{"name": "tmpfs-0", "mountPath": "/run"}},
+			}},
+			"volumes": []any{map[string]any{"name": "tmpfs-0", "emptyDir": map[string]any{"medium": "Memory"}}},
+		},
+	}
+	if diff := cmp.Diff(wantPod, got); diff != "" {
+		t.Errorf("pod mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeCreateDefaultNetwork(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get pod lab1-r1 --ignore-not-found --output json", fakeResult{}, fakeResult{stdout: running})
+	runner.on("kubectl get network-attachment-definitions.k8s.cni.cncf.io lab1-link-01 --ignore-not-found --output json",
+		fakeResult{stdout: definition(t, "link-01", 2)})
+	node := testNode()
+	node.Interfaces[0].Name = "eth0"
+	if err := provider.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	items := applied(t, runner.stdins[0])
+	if len(items) != 3 {
+		t.Fatalf("want the namespace, the definition and the pod applied, got %d items", len(items))
+	}
+	def := items[1]["metadata"].(map[string]any)
+	if name := def["name"]; name != "lab1-r1-eth0" {
+		t.Errorf("definition name: want lab1-r1-eth0, got %v", name)
+	}
+	if diff := cmp.Diff(map[string]any{"golab.managed": "true", topology.LabLabel: "lab1", "golab.node": "lab1-r1"}, def["labels"]); diff != "" {
+		t.Errorf("definition labels mismatch (-want +got):\n%s", diff)
+	}
+	var conf map[string]any
+	if err := json.Unmarshal([]byte(items[1]["spec"].(map[string]any)["config"].(string)), &conf); err != nil {
+		t.Fatal(err)
+	}
+	ipam := conf["plugins"].([]any)[0].(map[string]any)["ipam"]
+	if diff := cmp.Diff(map[string]any{"type": "static", "addresses": []any{map[string]any{"address": "10.0.0.1/24"}}}, ipam); diff != "" {
+		t.Errorf("ipam mismatch (-want +got):\n%s", diff)
+	}
+	annotations := items[2]["metadata"].(map[string]any)["annotations"].(map[string]any)
+	if got, want := annotations["v1.multus-cni.io/default-network"], "golab/lab1-r1-eth0"; got != want {
+		t.Errorf("default network: want %s, got %v", want, got)
+	}
+	if networks, ok := annotations["k8s.v1.cni.cncf.io/networks"]; ok {
+		t.Errorf("networks: want none, got %v", networks)
+	}
+}
+
+func TestNodeCreateNames(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	sum := sha256.Sum256([]byte("lab1-R1"))
+	name := "lab1-r1-" + hex.EncodeToString(sum[:])[:6]
+	runner.on("kubectl get pod "+name+" --ignore-not-found --output json", fakeResult{}, fakeResult{stdout: running})
+	node := topology.Node{Name: "R1", Image: "alpine", Labels: labLabels}
+	if err := provider.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	items := applied(t, runner.stdins[0])
+	metadata := items[1]["metadata"].(map[string]any)
+	if metadata["name"] != name {
+		t.Errorf("pod name: want %s, got %v", name, metadata["name"])
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(metadata["annotations"].(map[string]any)["golab.record"].(string)), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["name"] != "R1" {
+		t.Errorf("recorded name: want R1, got %v", record["name"])
+	}
+}
+
+func TestNodeCreateSidecar(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get pod lab1-r1 --ignore-not-found --output json", fakeResult{stdout: running})
+	sidecar := topology.Node{Name: "r1-ssh", Image: "ssh", Labels: labLabels, NetworkMode: "container:r1", PIDMode: "container:r1"}
+	if err := provider.NodeCreate(context.Background(), sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"kubectl get pod lab1-r1 --ignore-not-found --output json"}, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	sidecar.Name = "r1-dns"
+	errMsg := "pod lab1-r1 has no container r1-dns of sidecar r1-dns, wreck the lab to recreate it"
+	if err := provider.NodeCreate(context.Background(), sidecar); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestNodeCreateUnsupported(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		node   topology.Node
+		errMsg string
+	}{
+		{
+			name:   "Binds",
+			node:   topology.Node{Name: "r1", Binds: []string{"/tmp/r1:/etc/frr"}},
+			errMsg: "node r1 sets binds, which is not supported by the kubernetes provider",
+		},
+		{
+			name:   "VM",
+			node:   topology.Node{Name: "r1", Image: "images/vmx.qcow2"},
+			errMsg: "node r1 sets qcow2 image images/vmx.qcow2, which is not supported by the kubernetes provider",
+		},
+		{
+			name:   "Veth",
+			node:   topology.Node{Name: "r1", Interfaces: []*topology.Interface{{Name: "eth1", Link: "link-01", Veth: true}}},
+			errMsg: "node r1 sets veth link link-01, which is not supported by the kubernetes provider",
+		},
+		{
+			name:   "SidecarPorts",
+			node:   topology.Node{Name: "r1", Sidecars: []*topology.Node{{Name: "r1-ssh", Ports: []string{"2222:22"}}}},
+			errMsg: "node r1-ssh sets ports, which is not supported by the kubernetes provider",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			provider, runner := newProvider()
+			if err := provider.NodeCreate(context.Background(), tc.node); err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+			if len(runner.commands) != 0 {
+				t.Errorf("want no commands, got %q", runner.commands)
+			}
+		})
+	}
+}
+
+func TestNodeCreateCrashed(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get pod lab1-r1 --ignore-not-found --output json", fakeResult{}, fakeResult{stdout: crashed})
+	runner.on("kubectl get network-attachment-definitions.k8s.cni.cncf.io lab1-link-01 --ignore-not-found --output json",
+		fakeResult{stdout: definition(t, "link-01", 2)})
+	runner.on("kubectl logs lab1-r1 --container node --tail 20 --previous", fakeResult{stdout: "booting\npanic\n"})
+	errMsg := "pod lab1-r1 exited with code 137 while starting"
+	if err := provider.NodeCreate(context.Background(), testNode()); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	if !slices.Contains(runner.commands, "kubectl logs lab1-r1 --container node --tail 20 --previous") {
+		t.Errorf("want the logs of the exited node, got %q", runner.commands)
+	}
+}
+
+func TestNodeRemove(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get pod lab1-r1 --ignore-not-found --output json", fakeResult{stdout: running})
+	if err := provider.NodeRemove(context.Background(), testNode()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"kubectl get pod lab1-r1 --ignore-not-found --output json",
+		"kubectl delete pod lab1-r1 --ignore-not-found --wait --grace-period 3",
+		"kubectl delete network-attachment-definitions.k8s.cni.cncf.io --selector golab.node=lab1-r1 --ignore-not-found",
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeRemoveNotOwned(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get pod lab1-r1 --ignore-not-found --output json", fakeResult{stdout: `{"metadata": {"name": "lab1-r1", "labels": {}}}`})
+	errMsg := "refusing to remove pod lab1-r1, which golab did not create for this lab"
+	if err := provider.NodeRemove(context.Background(), testNode()); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestNodeExec(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl exec lab1-r1 --container node -- false", fakeResult{exitCode: 1})
+	exitCode, err := provider.NodeExec(context.Background(), testNode(), []string{"false"}, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 1 {
+		t.Errorf("exit code: want 1, got %d", exitCode)
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	runner.on("kubectl get --raw /apis/metrics.k8s.io/v1beta1/namespaces/golab/pods/lab1-r1",
+		fakeResult{stdout: `{"containers": [{"name": "node", "usage": {"cpu": "250m", "memory": "64Mi"}}, {"name": "r1-ssh", "usage": {"cpu": "1m", "memory": "1Mi"}}]}`})
+	runner.on("kubectl exec lab1-r1 --container node -- cat /proc/net/dev", fakeResult{stdout: `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+  eth1:    2000      20    1    2    0     0          0         0     3000      30    3    4    0     0       0          0
+    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0
+  eth0:    1000      10    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+`})
+	got, err := provider.NodeStats(context.Background(), testNode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := topology.NodeStats{
+		CPUPercent: 25,
+		MemUsage:   64 << 20,
+		MemLimit:   512 << 20,
+		RxBytes:    3000,
+		TxBytes:    3500,
+		RxPackets:  30,
+		TxPackets:  35,
+		Interfaces: []topology.InterfaceStats{
+			{Name: "eth0", RxBytes: 1000, TxBytes: 500, RxPackets: 10, TxPackets: 5},
+			{Name: "eth1", RxBytes: 2000, TxBytes: 3000, RxPackets: 20, TxPackets: 30, RxErrors: 1, TxErrors: 3, RxDropped: 2, TxDropped: 4},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkConnectUnsupported(t *testing.T) {
+	t.Parallel()
+	provider, _ := newProvider()
+	errMsg := "link link-01: connecting running nodes is not supported by the kubernetes provider"
+	if err := provider.LinkConnect(context.Background(), testLink, []topology.Node{testNode()}); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestDeployedAndRemoveOrphans(t *testing.T) {
+	t.Parallel()
+	provider, runner := newProvider()
+	record, err := json.Marshal(map[string]any{
+		"name":       "r1",
+		"labels":     labLabels,
+		"interfaces": []map[string]string{{"name": "eth1", "link": "link-01", "ipv4_addr": "10.0.0.1/24"}},
+		"sidecars":   []string{"r1-ssh"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"name": "lab1-r1", "annotations": map[string]string{"golab.record": string(record)}},
+		"spec": map[string]any{"containers": []map[string]string{
+			{"name": "node", "image": "frrouting/frr:v8"},
+			{"name": "r1-ssh", "image": "ssh"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.on("kubectl get pods --selector golab.managed=true,golab.lab=lab1 --output json", fakeResult{stdout: `{"items": [` + string(pod) + `]}`})
+	runner.on("kubectl get network-attachment-definitions.k8s.cni.cncf.io --selector golab.managed=true,golab.lab=lab1,!golab.node --output json",
+		fakeResult{stdout: `{"items": [` + definition(t, "link-01", 2) + `]}`})
+	nodes, links, err := provider.Deployed(context.Background(), "lab1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNodes := []topology.Node{
+		{Name: "r1", Image: "frrouting/frr:v8", Labels: labLabels, Interfaces: []*topology.Interface{{Link: "link-01", IPv4Addr: "10.0.0.1"}}},
+		{Name: "r1-ssh", Image: "ssh", Labels: labLabels},
+	}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("nodes mismatch (-want +got):\n%s", diff)
+	}
+	wantLinks := []topology.Link{{Name: "link-01", Labels: labLabels, IPv4Subnet: "10.0.0.0/24"}}
+	if diff := cmp.Diff(wantLinks, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	runner.on("kubectl delete pods,network-attachment-definitions.k8s.cni.cncf.io --selector golab.managed=true,golab.lab=lab1 --ignore-not-found --wait --output name",
+		fakeResult{stdout: "pod/lab1-r1\nnetworkattachmentdefinition.k8s.cni.cncf.io/lab1-link-01\n"})
+	if err := provider.RemoveOrphans(context.Background(), "lab1"); err != nil {
+		t.Fatal(err)
+	}
+}
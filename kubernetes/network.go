@@ -0,0 +1,251 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// cniVersion is the version of the CNI specification the network configurations follow.
+const cniVersion = "1.0.0"
+
+// hostBridge is the Linux bridge every worker has to provide, whose uplink trunks the VLANs of links between workers.
+const hostBridge = "golab0"
+
+// VLANs of links on the host bridge, leaving out the default VLAN of Linux bridges.
+const (
+	minVLAN = 2
+	maxVLAN = 4094
+)
+
+// Options of Docker networks and endpoints which the kubernetes provider translates, while the others are rejected.
+const (
+	mtuOption    = "com.docker.network.driver.mtu"
+	ifnameOption = "com.docker.network.endpoint.ifname"
+)
+
+// networkAttachmentDefinition is the Multus object holding the CNI configuration of a link.
+type networkAttachmentDefinition struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Metadata   metadata `json:"metadata"`
+	Spec       struct {
+		Config string `json:"config"`
+	} `json:"spec"`
+}
+
+// netConfList is the CNI configuration of the network of a link, which Multus hands to its plugins.
+type netConfList struct {
+	CNIVersion string    `json:"cniVersion"`
+	Name       string    `json:"name"`
+	Plugins    []netConf `json:"plugins"`
+}
+
+// netConf configures the plugin of a network, whose capabilities let Multus pass the addresses of pods to it.
+type netConf struct {
+	Type                string          `json:"type"`
+	Bridge              string          `json:"bridge,omitempty"`
+	VLAN                int             `json:"vlan,omitempty"`
+	PreserveDefaultVLAN *bool           `json:"preserveDefaultVlan,omitempty"`
+	Master              string          `json:"master,omitempty"`
+	Mode                string          `json:"mode,omitempty"`
+	MTU                 int             `json:"mtu,omitempty"`
+	IPAM                *ipamConf       `json:"ipam,omitempty"`
+	Capabilities        map[string]bool `json:"capabilities,omitempty"`
+}
+
+// ipamConf configures the static IPAM plugin, which assigns the addresses computed by golab.
+type ipamConf struct {
+	Type      string        `json:"type"`
+	Addresses []ipamAddress `json:"addresses,omitempty"`
+}
+
+// ipamAddress is an address of an interface in CIDR notation.
+type ipamAddress struct {
+	Address string `json:"address"`
+}
+
+// network is the record of a link kept in an annotation of its NetworkAttachmentDefinition, along with the VLAN
+// the link was given on the host bridge.
+type network struct {
+	Name          string            `json:"name"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	IPv4Subnet    string            `json:"ipv4_subnet,omitempty"`
+	IPv6Subnet    string            `json:"ipv6_subnet,omitempty"`
+	MTU           int               `json:"mtu,omitempty"`
+	HostInterface string            `json:"host_interface,omitempty"`
+	Driver        string            `json:"driver,omitempty"`
+	VLAN          int               `json:"vlan,omitempty"`
+}
+
+// newNetwork translates the link into the record of its network. Links bridged to a host interface are macvlan or
+// ipvlan networks on top of the interface of every worker, while the others are VLANs of the host bridge.
+func newNetwork(link topology.Link) (*network, error) {
+	net := &network{
+		Name:          link.Name,
+		Labels:        link.Labels,
+		IPv4Subnet:    link.IPv4Subnet,
+		IPv6Subnet:    link.IPv6Subnet,
+		MTU:           link.MTU,
+		HostInterface: link.HostInterface,
+	}
+	switch {
+	case link.HostInterface != "" && link.Driver == topology.DriverIPvlan:
+		net.Driver = "ipvlan"
+	case link.HostInterface != "":
+		net.Driver = "macvlan"
+	case link.Driver == topology.DriverMacvlan || link.Driver == topology.DriverIPvlan:
+		return nil, fmt.Errorf("link %s: %s links require a host interface with the kubernetes provider", link.Name, link.Driver)
+	default:
+		net.Driver = "bridge"
+	}
+	for _, key := range slices.Sorted(maps.Keys(link.DriverOpts)) {
+		value := link.DriverOpts[key]
+		if key != mtuOption {
+			return nil, fmt.Errorf("link %s: driver option %s is not supported by the kubernetes provider", link.Name, key)
+		}
+		mtu, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("link %s: driver option %s has invalid value %q", link.Name, key, value)
+		}
+		net.MTU = mtu
+	}
+	for _, node := range slices.Sorted(maps.Keys(link.EndpointOpts)) {
+		for _, key := range slices.Sorted(maps.Keys(link.EndpointOpts[node])) {
+			if key != ifnameOption {
+				return nil, fmt.Errorf("link %s: endpoint option %s of node %s is not supported by the kubernetes provider", link.Name, key, node)
+			}
+		}
+	}
+	return net, nil
+}
+
+// config returns the CNI configuration of the network. Addresses of pods are handed to the static IPAM plugin by
+// Multus unless the interface is given, whose addresses are set in the configuration instead.
+func (net *network) config(name string, iface *topology.Interface) netConfList {
+	conf := netConf{Type: net.Driver, MTU: net.MTU, IPAM: &ipamConf{Type: "static"}}
+	switch net.Driver {
+	case "bridge":
+		// ports keep no membership of the default VLAN, which would leak frames between links
+		preserve := false
+		conf.Bridge, conf.VLAN, conf.PreserveDefaultVLAN = hostBridge, net.VLAN, &preserve
+	case "ipvlan":
+		conf.Master, conf.Mode = net.HostInterface, "l2"
+	default:
+		conf.Master, conf.Mode = net.HostInterface, "bridge"
+	}
+	if iface == nil {
+		conf.Capabilities = map[string]bool{"ips": true}
+	} else {
+		conf.IPAM.Addresses = ipamAddresses(iface)
+	}
+	return netConfList{CNIVersion: cniVersion, Name: name, Plugins: []netConf{conf}}
+}
+
+// ipamAddresses returns the addresses of the interface in CIDR notation.
+func ipamAddresses(iface *topology.Interface) []ipamAddress {
+	var addrs []ipamAddress
+	for _, addr := range []string{iface.IPv4Addr, iface.IPv6Addr} {
+		if addr != "" {
+			addrs = append(addrs, ipamAddress{Address: addr})
+		}
+	}
+	return addrs
+}
+
+// definition returns the NetworkAttachmentDefinition with the name holding the configuration of the network for
+// the interface, if any, labeled with the extra labels.
+func (net *network) definition(name string, iface *topology.Interface, labels map[string]string) (*networkAttachmentDefinition, error) {
+	record, err := json.Marshal(net)
+	if err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(net.config(name, iface))
+	if err != nil {
+		return nil, err
+	}
+	def := &networkAttachmentDefinition{
+		APIVersion: "k8s.cni.cncf.io/v1",
+		Kind:       "NetworkAttachmentDefinition",
+		Metadata: metadata{
+			Name:        name,
+			Labels:      objectLabels(net.Labels, labels),
+			Annotations: map[string]string{recordAnnotation: string(record)},
+		},
+	}
+	def.Spec.Config = string(config)
+	return def, nil
+}
+
+// record decodes the record of the network kept by the NetworkAttachmentDefinition.
+func (def *networkAttachmentDefinition) record() (*network, error) {
+	var net network
+	if err := json.Unmarshal([]byte(def.Metadata.Annotations[recordAnnotation]), &net); err != nil {
+		return nil, fmt.Errorf("network attachment definition %s has a malformed record: %w", def.Metadata.Name, err)
+	}
+	return &net, nil
+}
+
+// equalNetworks tells whether the records describe the same network, whatever VLANs they were given.
+func equalNetworks(a, b *network) bool {
+	x, y := *a, *b
+	x.VLAN, y.VLAN = 0, 0
+	p, _ := json.Marshal(x)
+	q, _ := json.Marshal(y)
+	return string(p) == string(q)
+}
+
+// getDefinition returns the NetworkAttachmentDefinition with the name, or nil if there is none.
+func (kp *KubernetesProvider) getDefinition(ctx context.Context, name string) (*networkAttachmentDefinition, error) {
+	out, err := kp.kubectl(ctx, nil, "get", definitionResource, name, "--ignore-not-found", "--output", "json")
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+	var def networkAttachmentDefinition
+	if err := json.Unmarshal(out, &def); err != nil {
+		return nil, fmt.Errorf("failed to decode network attachment definition %s: %w", name, err)
+	}
+	return &def, nil
+}
+
+// listDefinitions returns the NetworkAttachmentDefinitions matching the label selector.
+func (kp *KubernetesProvider) listDefinitions(ctx context.Context, selector string) ([]networkAttachmentDefinition, error) {
+	out, err := kp.kubectl(ctx, nil, "get", definitionResource, "--selector", selector, "--output", "json")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []networkAttachmentDefinition `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode network attachment definitions: %w", err)
+	}
+	return list.Items, nil
+}
+
+// freeVLAN returns the lowest VLAN of the host bridge which no link of any lab has been given.
+func (kp *KubernetesProvider) freeVLAN(ctx context.Context) (int, error) {
+	defs, err := kp.listDefinitions(ctx, managedLabel+"=true,!"+nodeLabel)
+	if err != nil {
+		return 0, err
+	}
+	used := make(map[int]bool, len(defs))
+	for _, def := range defs {
+		net, err := def.record()
+		if err != nil {
+			return 0, err
+		}
+		used[net.VLAN] = true
+	}
+	for vlan := minVLAN; vlan <= maxVLAN; vlan++ {
+		if !used[vlan] {
+			return vlan, nil
+		}
+	}
+	return 0, fmt.Errorf("all VLANs of bridge %s are taken by links", hostBridge)
+}
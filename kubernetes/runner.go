@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Command is a run of kubectl, which talks to the cluster of its current context.
+type Command struct {
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Runner runs kubectl.
+type Runner interface {
+	// Run runs kubectl to completion and returns its exit code, with an error only if it could not be run.
+	Run(ctx context.Context, cmd Command) (int, error)
+}
+
+// HostRunner runs kubectl as a process of golab, which inherits its environment, e.g. KUBECONFIG.
+type HostRunner struct{}
+
+// Run runs kubectl as a child process, which is killed when the context is canceled.
+func (HostRunner) Run(ctx context.Context, cmd Command) (int, error) {
+	c := exec.CommandContext(ctx, "kubectl", cmd.Args...)
+	c.Stdin, c.Stdout, c.Stderr = cmd.Stdin, cmd.Stdout, cmd.Stderr
+	err := c.Run()
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) && ctx.Err() == nil {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// kubectl runs kubectl in the namespace of golab with the input and returns its output, failing with its
+// error output unless it succeeds.
+func (kp *KubernetesProvider) kubectl(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	exitCode, err := kp.run(ctx, Command{Args: args, Stdin: stdin, Stdout: &stdout, Stderr: &stderr})
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		// kubectl prefixes its errors with the severity
+		msg := strings.TrimPrefix(strings.TrimSpace(stderr.String()), "error: ")
+		if msg == "" {
+			msg = fmt.Sprintf("exited with code %d", exitCode)
+		}
+		return nil, fmt.Errorf("kubectl: %s", msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// run runs kubectl in the namespace of golab and returns its exit code.
+func (kp *KubernetesProvider) run(ctx context.Context, cmd Command) (int, error) {
+	cmd.Args = append([]string{"--namespace", kp.namespace}, cmd.Args...)
+	exitCode, err := kp.runner.Run(ctx, cmd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to run kubectl: %w", err)
+	}
+	return exitCode, nil
+}
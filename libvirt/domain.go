@@ -0,0 +1,239 @@
+package libvirt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+)
+
+// Resources of VMs whose nodes set no limits, which router images need at the very least.
+const (
+	defaultMemory = 4 * units.GiB
+	defaultVCPUs  = 2
+)
+
+// tapPrefix starts the names of tap devices of VMs, which are limited to maxIfaceName characters.
+const tapPrefix = "gv"
+
+// domain is the part of the libvirt domain XML golab defines VMs with.
+type domain struct {
+	XMLName  xml.Name      `xml:"domain"`
+	Type     string        `xml:"type,attr"`
+	Name     string        `xml:"name"`
+	Memory   domainMemory  `xml:"memory"`
+	VCPU     int           `xml:"vcpu"`
+	OS       domainOS      `xml:"os"`
+	Features domainFeature `xml:"features"`
+	CPU      domainCPU     `xml:"cpu"`
+	OnCrash  string        `xml:"on_crash,omitempty"`
+	Devices  domainDevices `xml:"devices"`
+}
+
+// domainMemory is the amount of memory of a VM in the unit.
+type domainMemory struct {
+	Unit  string `xml:"unit,attr"`
+	Value int64  `xml:",chardata"`
+}
+
+// domainOS boots the VM from its first disk.
+type domainOS struct {
+	Type string `xml:"type"`
+	Boot struct {
+		Dev string `xml:"dev,attr"`
+	} `xml:"boot"`
+}
+
+// domainFeature enables ACPI, which VMs are shut down gracefully with.
+type domainFeature struct {
+	ACPI *struct{} `xml:"acpi"`
+	APIC *struct{} `xml:"apic"`
+}
+
+// domainCPU passes the CPU of the host through, which some router images check for features.
+type domainCPU struct {
+	Mode string `xml:"mode,attr"`
+}
+
+// domainDevices are the disk, NICs and serial console of a VM.
+type domainDevices struct {
+	Disks      []domainDisk      `xml:"disk"`
+	Interfaces []domainInterface `xml:"interface"`
+	Serial     domainSerial      `xml:"serial"`
+	Console    domainConsole     `xml:"console"`
+}
+
+// domainDisk is the qcow2 overlay of the image a VM boots from.
+type domainDisk struct {
+	Type   string `xml:"type,attr"`
+	Device string `xml:"device,attr"`
+	Driver struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"driver"`
+	Source struct {
+		File string `xml:"file,attr"`
+	} `xml:"source"`
+	Target struct {
+		Dev string `xml:"dev,attr"`
+		Bus string `xml:"bus,attr"`
+	} `xml:"target"`
+}
+
+// domainInterface is a NIC of a VM, which is either attached to the bridge of a link or left unconnected.
+type domainInterface struct {
+	Type string `xml:"type,attr"`
+	MAC  struct {
+		Address string `xml:"address,attr"`
+	} `xml:"mac"`
+	Source *interfaceSource `xml:"source"`
+	Target struct {
+		Dev string `xml:"dev,attr"`
+	} `xml:"target"`
+	Model struct {
+		Type string `xml:"type,attr"`
+	} `xml:"model"`
+	Link *interfaceLink `xml:"link"`
+}
+
+// interfaceSource is the bridge a NIC is attached to.
+type interfaceSource struct {
+	Bridge string `xml:"bridge,attr"`
+}
+
+// interfaceLink is the link state of a NIC as the VM sees it.
+type interfaceLink struct {
+	State string `xml:"state,attr"`
+}
+
+// domainSerial is the serial port of a VM, whose output is logged to a file.
+type domainSerial struct {
+	Type string `xml:"type,attr"`
+	Log  struct {
+		File   string `xml:"file,attr"`
+		Append string `xml:"append,attr"`
+	} `xml:"log"`
+	Target struct {
+		Port int `xml:"port,attr"`
+	} `xml:"target"`
+}
+
+// domainConsole is the console of a VM, which is its serial port.
+type domainConsole struct {
+	Type   string `xml:"type,attr"`
+	Target struct {
+		Type string `xml:"type,attr"`
+		Port int    `xml:"port,attr"`
+	} `xml:"target"`
+}
+
+// nic is a NIC of a VM in the order of its PCI slot, attached to the link unless it only fills a gap
+// between interfaces of the node.
+type nic struct {
+	Name string
+	Link string
+}
+
+// nics orders the management and data interfaces of the node by their numbers, e.g. eth0 before eth1, so that
+// the network OS enumerates them as the topology names them. Interfaces named otherwise, e.g. mgmt0 of labs
+// without the mgmt section, follow the numbered ones.
+func nics(node topology.Node) []nic {
+	ifaces := slices.Clone(node.Interfaces)
+	if node.Mgmt != nil {
+		ifaces = append(ifaces, node.Mgmt)
+	}
+	var (
+		numbered []nic
+		named    []nic
+	)
+	for _, iface := range ifaces {
+		num, ok := strings.CutPrefix(iface.Name, "eth")
+		n, err := strconv.Atoi(num)
+		if !ok || err != nil || n < 0 {
+			named = append(named, nic{Name: iface.Name, Link: iface.Link})
+			continue
+		}
+		for len(numbered) <= n {
+			numbered = append(numbered, nic{Name: "eth" + strconv.Itoa(len(numbered))})
+		}
+		numbered[n].Link = iface.Link
+	}
+	return append(numbered, named...)
+}
+
+// tapName names the tap device of the NIC with the index after the domain, hashing the domain name to keep
+// the name within maxIfaceName characters.
+func tapName(name string, index int) string {
+	sum := sha256.Sum256([]byte(name))
+	return tapPrefix + hex.EncodeToString(sum[:])[:6] + "-" + strconv.Itoa(index)
+}
+
+// macAddress derives the MAC address of the NIC with the index from the domain name, so that a recreated VM
+// keeps its addresses and its network OS does not see new NICs. The prefix is the one reserved for KVM.
+func macAddress(name string, index int) string {
+	sum := sha256.Sum256([]byte(name + "-" + strconv.Itoa(index)))
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", sum[0], sum[1], sum[2])
+}
+
+// nicModel returns the model of the emulated NICs of the node, which IOS XRv only has drivers for e1000 of.
+func nicModel(node topology.Node) string {
+	if node.Vendor == vendors.XRV {
+		return "e1000"
+	}
+	return "virtio"
+}
+
+// generateDomain converts the node into the domain XML of its VM, booting from the disk and logging its serial
+// console to the log file. NICs on links are attached to the bridges of the links, while the others are down.
+func generateDomain(node topology.Node, disk, logFile string) ([]byte, error) {
+	name := domainName(node)
+	d := domain{Type: "kvm", Name: name, VCPU: defaultVCPUs}
+	d.Memory = domainMemory{Unit: "KiB", Value: defaultMemory / units.KiB}
+	if node.Memory != "" {
+		// the memory limit is validated along with the topology
+		memory, _ := units.RAMInBytes(node.Memory)
+		d.Memory.Value = memory / units.KiB
+	}
+	if node.CPUs != 0 {
+		d.VCPU = int(math.Ceil(node.CPUs))
+	}
+	d.OS.Type = "hvm"
+	d.OS.Boot.Dev = "hd"
+	d.Features = domainFeature{ACPI: &struct{}{}, APIC: &struct{}{}}
+	d.CPU.Mode = "host-passthrough"
+	if node.Restart != "" && node.Restart != "no" {
+		d.OnCrash = "restart"
+	}
+	var dsk domainDisk
+	dsk.Type, dsk.Device = "file", "disk"
+	dsk.Driver.Name, dsk.Driver.Type = "qemu", "qcow2"
+	dsk.Source.File = disk
+	dsk.Target.Dev, dsk.Target.Bus = "vda", "virtio"
+	d.Devices.Disks = []domainDisk{dsk}
+	for i, n := range nics(node) {
+		iface := domainInterface{Type: "ethernet"}
+		iface.MAC.Address = macAddress(name, i)
+		iface.Target.Dev = tapName(name, i)
+		iface.Model.Type = nicModel(node)
+		if n.Link != "" {
+			iface.Type = "bridge"
+			iface.Source = &interfaceSource{Bridge: bridgeName(n.Link, node.Labels)}
+		} else {
+			iface.Link = &interfaceLink{State: "down"}
+		}
+		d.Devices.Interfaces = append(d.Devices.Interfaces, iface)
+	}
+	d.Devices.Serial.Type = "pty"
+	d.Devices.Serial.Log.File, d.Devices.Serial.Log.Append = logFile, "on"
+	d.Devices.Console.Type = "pty"
+	d.Devices.Console.Target.Type = "serial"
+	return xml.MarshalIndent(d, "", "  ")
+}
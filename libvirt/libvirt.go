@@ -0,0 +1,830 @@
+// Package libvirt boots router VMs from qcow2 images with libvirt next to the containers of a lab, which keep
+// running on the container provider the VMs are added to. Domains are driven with virsh and their NICs are
+// attached to the Linux bridges of the links, so that VMs and containers share links. Examples:
+//
+//	topology.Node with a qcow2 image is equivalent to a libvirt domain booting from an overlay of the image
+//	topology.Interface of such a node is equivalent to a NIC of the domain on the bridge of its link
+package libvirt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+)
+
+// DefaultStateDir holds the records, disks, domain definitions and console logs of VMs.
+const DefaultStateDir = "/var/lib/golab/libvirt"
+
+// bridgePrefix starts the names of Linux bridges of lab networks, which are limited to maxIfaceName characters.
+const (
+	bridgePrefix = "gl-"
+	maxIfaceName = 15
+)
+
+// domainPrefix starts the names of libvirt domains of all labs, which share the domains of the host with other VMs.
+const domainPrefix = "golab-"
+
+// defaultStopTimeout bounds graceful shutdown of a stopped VM unless its node sets a timeout.
+const defaultStopTimeout = 10 * time.Second
+
+// pollInterval separates checks of the state of a shutting down VM and polls of followed logs.
+const pollInterval = time.Second
+
+// statsInterval separates the two samples of CPU usage NodeStats calculates the usage from.
+const statsInterval = 500 * time.Millisecond
+
+// managedLabel marks records of VMs created by golab, which are the only ones it removes.
+const managedLabel = "golab.managed"
+
+// States of libvirt domains as reported by virsh domstate.
+const (
+	domainRunning = "running"
+	domainPaused  = "paused"
+	domainShutOff = "shut off"
+)
+
+// ContainerProvider is the provider running the containers of a lab, which the VMs are attached to the links of.
+type ContainerProvider interface {
+	orchestrator.PlanProvider
+	orchestrator.DashboardProvider
+	orchestrator.SnapshotProvider
+	RemoveOrphans(ctx context.Context, lab string) error
+}
+
+// LibvirtProvider runs nodes with qcow2 images as libvirt domains and passes everything else on to the
+// container provider it embeds.
+type LibvirtProvider struct {
+	ContainerProvider
+	runner   Runner
+	stateDir string
+	log      *logger.Logger
+	mu       sync.Mutex
+	// links are the links created by the container provider by their names prefixed with their labs
+	links map[string]topology.Link
+}
+
+// New returns an instance of a LibvirtProvider, which boots VMs next to the containers of the container provider
+// and keeps records of the VMs in the state directory.
+func New(containers ContainerProvider, runner Runner, stateDir string, log *logger.Logger) *LibvirtProvider {
+	return &LibvirtProvider{
+		ContainerProvider: containers,
+		runner:            runner,
+		stateDir:          stateDir,
+		log:               log,
+		links:             make(map[string]topology.Link),
+	}
+}
+
+// vm is the record of the VM of a node kept in the state directory.
+type vm struct {
+	Name       string                `json:"name"`
+	Labels     map[string]string     `json:"labels,omitempty"`
+	Image      string                `json:"image"`
+	Interfaces []*topology.Interface `json:"interfaces,omitempty"`
+}
+
+// LinkCreate creates the link with the container provider and remembers it, so that VMs are only attached to
+// links which have a Linux bridge.
+func (lp *LibvirtProvider) LinkCreate(ctx context.Context, link topology.Link) error {
+	lp.mu.Lock()
+	lp.links[labName(link.Name, link.Labels)] = link
+	lp.mu.Unlock()
+	return lp.ContainerProvider.LinkCreate(ctx, link)
+}
+
+// LinkConnect attaches running containers to the link. VMs are booted with a fixed set of NICs, hence nodes
+// whose links change are recreated rather than hot-plugged.
+func (lp *LibvirtProvider) LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	if err := hotplug(nodes); err != nil {
+		return err
+	}
+	return lp.ContainerProvider.LinkConnect(ctx, link, nodes)
+}
+
+// LinkDisconnect detaches running containers from the link, which VMs cannot be as they are not hot-plugged.
+func (lp *LibvirtProvider) LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	if err := hotplug(nodes); err != nil {
+		return err
+	}
+	return lp.ContainerProvider.LinkDisconnect(ctx, link, nodes)
+}
+
+// hotplug returns an error for the first VM among the nodes, whose NICs cannot be hot-plugged.
+func hotplug(nodes []topology.Node) error {
+	for _, node := range nodes {
+		if node.VM() {
+			return fmt.Errorf("node %s is a virtual machine, whose links cannot be changed while it runs", node.Name)
+		}
+	}
+	return nil
+}
+
+// managed adds the label marking records created by golab to the labels of a topology entity.
+func managed(labels map[string]string) map[string]string {
+	labels = maps.Clone(labels)
+	if labels == nil {
+		labels = make(map[string]string, 1)
+	}
+	labels[managedLabel] = "true"
+	return labels
+}
+
+// unmanaged reverts managed for records, so that their labels compare equal to the ones of topology entities.
+func unmanaged(labels map[string]string) map[string]string {
+	labels = maps.Clone(labels)
+	delete(labels, managedLabel)
+	return labels
+}
+
+// owned tells whether a record was created by golab for the lab of the topology entity, rather than merely
+// sharing its name.
+func owned(labels, want map[string]string) bool {
+	return labels[managedLabel] == "true" && labels[topology.LabLabel] == want[topology.LabLabel]
+}
+
+// inLab tells whether the labels mark an object owned by the provided lab or by any lab if it is empty.
+func inLab(labels map[string]string, lab string) bool {
+	owner, ok := labels[topology.LabLabel]
+	return ok && (lab == "" || owner == lab)
+}
+
+// labName prefixes the name of a topology entity with the lab it is labeled with, so that labs
+// with the same node names can run side by side. Entities without a lab keep their names.
+func labName(name string, labels map[string]string) string {
+	if lab := labels[topology.LabLabel]; lab != "" {
+		return lab + "-" + name
+	}
+	return name
+}
+
+// domainName resolves the name of the libvirt domain representing the node.
+func domainName(node topology.Node) string {
+	return domainPrefix + labName(node.Name, node.Labels)
+}
+
+// topologyName reverts domainName for domains labeled with the lab owning them.
+func topologyName(name string, labels map[string]string) string {
+	name = strings.TrimPrefix(name, domainPrefix)
+	if lab := labels[topology.LabLabel]; lab != "" {
+		return strings.TrimPrefix(name, lab+"-")
+	}
+	return name
+}
+
+// bridgeName names the Linux bridge of the link with the name, which belongs to the lab the labels refer to,
+// like the docker and containerd providers do, so that VMs join the bridges their containers are attached to.
+func bridgeName(link string, labels map[string]string) string {
+	name := bridgePrefix + strings.TrimPrefix(link, "golab-")
+	if lab := labels[topology.LabLabel]; lab != "" {
+		name = bridgePrefix + lab + "-" + strings.TrimPrefix(link, "golab-")
+	}
+	if len(name) <= maxIfaceName {
+		return name
+	}
+	sum := sha256.Sum256([]byte(labName(link, labels)))
+	return name[:maxIfaceName-7] + "-" + hex.EncodeToString(sum[:])[:6]
+}
+
+// vmPath returns the path of the record of the VM with the name in the state directory.
+func (lp *LibvirtProvider) vmPath(name string) string {
+	return filepath.Join(lp.stateDir, "vms", name+".json")
+}
+
+// diskPath returns the path of the overlay the VM with the name writes to instead of its image.
+func (lp *LibvirtProvider) diskPath(name string) string {
+	return filepath.Join(lp.stateDir, "disks", name+".qcow2")
+}
+
+// domainPath returns the path of the domain XML the VM with the name is defined with.
+func (lp *LibvirtProvider) domainPath(name string) string {
+	return filepath.Join(lp.stateDir, "domains", name+".xml")
+}
+
+// logPath returns the path of the file the serial console of the VM with the name is logged to.
+func (lp *LibvirtProvider) logPath(name string) string {
+	return filepath.Join(lp.stateDir, "logs", name+".log")
+}
+
+// readVM reads the record of the VM with the name, which is nil if there is none.
+func (lp *LibvirtProvider) readVM(name string) (*vm, error) {
+	data, err := os.ReadFile(lp.vmPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec vm
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("vm record %s is malformed: %w", lp.vmPath(name), err)
+	}
+	return &rec, nil
+}
+
+// writeVM keeps the record of the VM in the state directory.
+func (lp *LibvirtProvider) writeVM(rec *vm) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(lp.vmPath(rec.Name), data)
+}
+
+// writeFile writes the data to the path, creating its directory if missing.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o640)
+}
+
+// state returns the state of the domain with the name as reported by virsh domstate, which is empty if
+// there is no such domain.
+func (lp *LibvirtProvider) state(ctx context.Context, name string) (string, error) {
+	out, err := lp.virsh(ctx, "list", "--all", "--name")
+	if err != nil || !slices.Contains(strings.Fields(string(out)), name) {
+		return "", err
+	}
+	out, err = lp.virsh(ctx, "domstate", name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// NodeRunning checks whether the VM or container representing the provided topology.Node is running,
+// including paused ones.
+func (lp *LibvirtProvider) NodeRunning(ctx context.Context, node topology.Node) (bool, error) {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeRunning(ctx, node)
+	}
+	state, err := lp.state(ctx, domainName(node))
+	return state == domainRunning || state == domainPaused, err
+}
+
+// unsupported returns an error for the first setting of the VM node which only applies to containers.
+func unsupported(node topology.Node) error {
+	var setting string
+	switch {
+	case len(node.Sidecars) != 0:
+		setting = "sidecars"
+	case len(node.Ports) != 0:
+		setting = "ports"
+	case len(node.Binds) != 0 || len(node.Volumes) != 0 || len(node.Tmpfs) != 0:
+		setting = "mounts"
+	case len(node.Env) != 0:
+		setting = "env"
+	case len(node.Cmd) != 0 || len(node.Entrypoint) != 0:
+		setting = "cmd"
+	case len(node.Sysctls) != 0:
+		setting = "sysctls"
+	}
+	for _, iface := range node.Interfaces {
+		switch {
+		case setting != "":
+		case iface.Veth:
+			setting = "veth links"
+		case iface.VLAN != 0:
+			setting = "subinterfaces"
+		}
+	}
+	if setting == "" {
+		return nil
+	}
+	return fmt.Errorf("node %s is a virtual machine, which does not support %s", node.Name, setting)
+}
+
+// NodeCreate translates a topology.Node entity with a qcow2 image into a libvirt domain and boots it, while
+// other nodes are created by the container provider. The VM writes to an overlay of its image, which is
+// kept intact, and its NICs are attached to the bridges of its links.
+func (lp *LibvirtProvider) NodeCreate(ctx context.Context, node topology.Node) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeCreate(ctx, node)
+	}
+	if err := unsupported(node); err != nil {
+		return err
+	}
+	name := domainName(node)
+	state, err := lp.state(ctx, name)
+	if err != nil {
+		return err
+	}
+	if state != "" {
+		// a VM which has been stopped or has crashed is started again
+		if state != domainRunning && state != domainPaused {
+			return lp.NodeStart(ctx, node)
+		}
+		lp.log.With(node.Name).Skipped("already created libvirt domain " + name)
+		return nil
+	}
+	image, err := filepath.Abs(node.Image)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(image); err != nil {
+		return fmt.Errorf("node %s: %w", node.Name, err)
+	}
+	// the record is kept before anything is created, so that a failing build leaves nothing untracked behind
+	rec := &vm{Name: name, Labels: managed(node.Labels), Image: node.Image, Interfaces: node.Interfaces}
+	if err := lp.writeVM(rec); err != nil {
+		return err
+	}
+	if err := lp.createBridges(ctx, node); err != nil {
+		return err
+	}
+	if err := lp.createDisk(ctx, name, image); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(lp.logPath(name)), 0o750); err != nil {
+		return err
+	}
+	def, err := generateDomain(node, lp.diskPath(name), lp.logPath(name))
+	if err != nil {
+		return err
+	}
+	if err := writeFile(lp.domainPath(name), def); err != nil {
+		return err
+	}
+	if _, err := lp.virsh(ctx, "define", lp.domainPath(name)); err != nil {
+		return err
+	}
+	if _, err := lp.virsh(ctx, "start", name); err != nil {
+		return err
+	}
+	// the network OS of a VM cannot be asked whether it has booted, which configuration push waits for instead
+	lp.log.With(node.Name).Success("started libvirt domain " + name)
+	return nil
+}
+
+// createDisk creates the overlay of the image the VM with the name boots from, replacing the one left behind
+// by a failed build.
+func (lp *LibvirtProvider) createDisk(ctx context.Context, name, image string) error {
+	disk := lp.diskPath(name)
+	if err := os.MkdirAll(filepath.Dir(disk), 0o750); err != nil {
+		return err
+	}
+	if err := os.Remove(disk); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	_, err := lp.output(ctx, Command{Name: "qemu-img", Args: []string{"create", "-q", "-f", "qcow2", "-F", "qcow2", "-b", image, disk}})
+	return err
+}
+
+// createBridges makes sure that the bridges of the links of the node exist. The bridge plugin of the
+// containerd provider creates bridges once the first container is attached, hence bridges of links whose
+// containers have not been created yet are created here, which the plugin adopts. Links without bridges,
+// e.g. macvlan ones, cannot be joined by VMs.
+func (lp *LibvirtProvider) createBridges(ctx context.Context, node topology.Node) error {
+	for _, n := range nics(node) {
+		if n.Link == "" {
+			continue
+		}
+		lp.mu.Lock()
+		link, ok := lp.links[labName(n.Link, node.Labels)]
+		lp.mu.Unlock()
+		if ok && (link.HostInterface != "" || link.Driver != "" && link.Driver != topology.DriverBridge) {
+			return fmt.Errorf("node %s is a virtual machine, which cannot join link %s without a bridge", node.Name, n.Link)
+		}
+		bridge := bridgeName(n.Link, node.Labels)
+		exists, err := lp.succeeds(ctx, "link", "show", "dev", bridge)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := lp.ip(ctx, "link", "add", "name", bridge, "type", "bridge"); err != nil {
+			return fmt.Errorf("failed to create bridge %s of link %s: %w", bridge, n.Link, err)
+		}
+		if _, err := lp.ip(ctx, "link", "set", "dev", bridge, "up"); err != nil {
+			return fmt.Errorf("failed to set bridge %s of link %s up: %w", bridge, n.Link, err)
+		}
+	}
+	return nil
+}
+
+// NodeRemove translates a topology.Node entity with a qcow2 image into a libvirt domain and removes it along
+// with its overlay, while other nodes are removed by the container provider.
+func (lp *LibvirtProvider) NodeRemove(ctx context.Context, node topology.Node) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeRemove(ctx, node)
+	}
+	name := domainName(node)
+	state, err := lp.state(ctx, name)
+	if err != nil {
+		return err
+	}
+	rec, err := lp.readVM(name)
+	if err != nil {
+		return err
+	}
+	if state == "" && rec == nil {
+		lp.log.With(node.Name).Skipped("already removed libvirt domain " + name)
+		return nil
+	}
+	if rec == nil || !owned(rec.Labels, node.Labels) {
+		return fmt.Errorf("refusing to remove libvirt domain %s, which golab did not create for this lab", name)
+	}
+	// running VMs shut down gracefully first, so that network OSes can save their state
+	if err := lp.shutdown(ctx, name, stopTimeout(node)); err != nil {
+		lp.log.With(node.Name).Warn(fmt.Sprintf("failed to stop libvirt domain %s gracefully, removing it by force: %v", name, err))
+	}
+	if err := lp.remove(ctx, name, state != ""); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("removed libvirt domain " + name)
+	return nil
+}
+
+// remove destroys and undefines the domain with the name, if it exists, and deletes the files of the VM.
+func (lp *LibvirtProvider) remove(ctx context.Context, name string, exists bool) error {
+	if exists {
+		state, err := lp.state(ctx, name)
+		if err != nil {
+			return err
+		}
+		if state != domainShutOff {
+			if _, err := lp.virsh(ctx, "destroy", name); err != nil {
+				return err
+			}
+		}
+		if _, err := lp.virsh(ctx, "undefine", name); err != nil {
+			return err
+		}
+	}
+	for _, path := range []string{lp.diskPath(name), lp.domainPath(name), lp.logPath(name)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Remove(lp.vmPath(name))
+}
+
+// shutdown asks the guest of the domain with the name to power off over ACPI and destroys the domain once
+// the timeout passes, as router images often ignore the request. Paused domains are destroyed right away.
+func (lp *LibvirtProvider) shutdown(ctx context.Context, name string, timeout time.Duration) error {
+	state, err := lp.state(ctx, name)
+	if err != nil || state == "" || state == domainShutOff {
+		return err
+	}
+	if state == domainRunning {
+		if _, err := lp.virsh(ctx, "shutdown", name); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(timeout)
+		for state != domainShutOff && time.Now().Before(deadline) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(min(time.Until(deadline), pollInterval)):
+			}
+			if state, err = lp.state(ctx, name); err != nil {
+				return err
+			}
+		}
+		if state == domainShutOff {
+			return nil
+		}
+	}
+	_, err = lp.virsh(ctx, "destroy", name)
+	return err
+}
+
+// stopTimeout returns how long the VM of the node is given to shut down when stopped, after which it is destroyed.
+func stopTimeout(node topology.Node) time.Duration {
+	timeout := defaultStopTimeout
+	if node.StopTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.StopTimeout)
+	}
+	return timeout
+}
+
+// NodePause suspends the VM or freezes the container representing the provided topology.Node.
+func (lp *LibvirtProvider) NodePause(ctx context.Context, node topology.Node) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodePause(ctx, node)
+	}
+	name := domainName(node)
+	state, err := lp.state(ctx, name)
+	if err != nil {
+		return err
+	}
+	if state == domainPaused {
+		lp.log.With(node.Name).Skipped("already paused libvirt domain " + name)
+		return nil
+	}
+	if _, err := lp.virsh(ctx, "suspend", name); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("paused libvirt domain " + name)
+	return nil
+}
+
+// NodeUnpause resumes the VM or the container representing the provided topology.Node.
+func (lp *LibvirtProvider) NodeUnpause(ctx context.Context, node topology.Node) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeUnpause(ctx, node)
+	}
+	name := domainName(node)
+	state, err := lp.state(ctx, name)
+	if err != nil {
+		return err
+	}
+	if state != domainPaused {
+		lp.log.With(node.Name).Skipped("already resumed libvirt domain " + name)
+		return nil
+	}
+	if _, err := lp.virsh(ctx, "resume", name); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("resumed libvirt domain " + name)
+	return nil
+}
+
+// NodeStop powers off the VM or stops the container representing the provided topology.Node without removing it.
+func (lp *LibvirtProvider) NodeStop(ctx context.Context, node topology.Node) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeStop(ctx, node)
+	}
+	name := domainName(node)
+	state, err := lp.state(ctx, name)
+	if err != nil {
+		return err
+	}
+	if state != domainRunning && state != domainPaused {
+		lp.log.With(node.Name).Skipped("already stopped libvirt domain " + name)
+		return nil
+	}
+	if err := lp.shutdown(ctx, name, stopTimeout(node)); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("stopped libvirt domain " + name)
+	return nil
+}
+
+// NodeStart boots the powered off VM or starts the stopped container representing the provided topology.Node.
+func (lp *LibvirtProvider) NodeStart(ctx context.Context, node topology.Node) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeStart(ctx, node)
+	}
+	name := domainName(node)
+	state, err := lp.state(ctx, name)
+	if err != nil {
+		return err
+	}
+	if state == domainRunning || state == domainPaused {
+		lp.log.With(node.Name).Skipped("already started libvirt domain " + name)
+		return nil
+	}
+	// bridges of containerd links are gone once their last container is removed
+	if err := lp.createBridges(ctx, node); err != nil {
+		return err
+	}
+	if _, err := lp.virsh(ctx, "start", name); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("started libvirt domain " + name)
+	return nil
+}
+
+// NodeCommit commits the container representing the provided topology.Node to an image. Snapshots of VMs
+// are not supported, as their disks are not images of the container provider.
+func (lp *LibvirtProvider) NodeCommit(ctx context.Context, node topology.Node, ref string) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeCommit(ctx, node, ref)
+	}
+	return fmt.Errorf("node %s: snapshots of virtual machines are not supported", node.Name)
+}
+
+// NodeExec runs a command inside the container representing the provided topology.Node. VMs run no agent
+// golab could run commands with, hence commands are only run in containers.
+func (lp *LibvirtProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeExec(ctx, node, cmd, stdout, stderr)
+	}
+	return 0, fmt.Errorf("node %s is a virtual machine, which commands cannot be run in", node.Name)
+}
+
+// NodeShell attaches the provided TTY to the serial console of the VM representing the provided topology.Node,
+// ignoring the command, or runs the command inside the container representing it.
+func (lp *LibvirtProvider) NodeShell(ctx context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error) {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeShell(ctx, node, cmd, tty)
+	}
+	args := []string{"console", "--force", domainName(node)}
+	exitCode, err := lp.runner.Run(ctx, Command{Name: "virsh", Args: args, Stdin: tty.In, Stdout: tty.Out, Stderr: tty.Out})
+	if err != nil {
+		return 0, fmt.Errorf("failed to run virsh: %w", err)
+	}
+	return exitCode, nil
+}
+
+// NodeLogs writes the serial console output of the VM representing the provided topology.Node to stdout, or
+// the logs of the container representing it. Only the last tail lines are written unless tail is negative,
+// and new output is streamed until the context is canceled if follow is set.
+func (lp *LibvirtProvider) NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, stderr io.Writer) error {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeLogs(ctx, node, follow, tail, stdout, stderr)
+	}
+	f, err := os.Open(lp.logPath(domainName(node)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if tail >= 0 {
+		lines := slices.Collect(strings.Lines(string(data)))
+		data = []byte(strings.Join(lines[max(len(lines)-tail, 0):], ""))
+	}
+	if _, err := stdout.Write(data); err != nil {
+		return err
+	}
+	for follow {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(pollInterval):
+		}
+		if _, err := io.Copy(stdout, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// domainStats are the statistics of a domain reported by virsh domstats, e.g. cpu.time or net.0.rx.bytes.
+type domainStats map[string]string
+
+// uint returns the statistic with the key, which is zero if it is missing.
+func (s domainStats) uint(key string) uint64 {
+	value, _ := strconv.ParseUint(s[key], 10, 64)
+	return value
+}
+
+// domstats samples the statistics of the domain with the name.
+func (lp *LibvirtProvider) domstats(ctx context.Context, name string) (domainStats, error) {
+	out, err := lp.virsh(ctx, "domstats", "--cpu-total", "--balloon", "--interface", name)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(domainStats)
+	for line := range strings.Lines(string(out)) {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			stats[key] = value
+		}
+	}
+	return stats, nil
+}
+
+// NodeStats collects resource usage of the VM or container representing the provided topology.Node. CPU usage
+// of VMs is calculated from two samples like docker stats does, memory usage is the memory the VM takes on the
+// host, and traffic counters are the ones of its NICs as the guest sees them.
+func (lp *LibvirtProvider) NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error) {
+	if !node.VM() {
+		return lp.ContainerProvider.NodeStats(ctx, node)
+	}
+	name := domainName(node)
+	first, err := lp.domstats(ctx, name)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return topology.NodeStats{}, ctx.Err()
+	case <-time.After(statsInterval):
+	}
+	second, err := lp.domstats(ctx, name)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	var nodeStats topology.NodeStats
+	// cpu.time is the CPU time of the VM so far in nanoseconds
+	if before, after := first.uint("cpu.time"), second.uint("cpu.time"); after > before {
+		nodeStats.CPUPercent = float64(after-before) / float64(time.Since(start)) * 100
+	}
+	// balloon statistics are reported in KiB
+	nodeStats.MemUsage, nodeStats.MemLimit = second.uint("balloon.rss")*1024, second.uint("balloon.maximum")*1024
+	names := make(map[string]string)
+	for i, n := range nics(node) {
+		names[tapName(name, i)] = n.Name
+	}
+	var ifaces []topology.InterfaceStats
+	for i := range int(second.uint("net.count")) {
+		prefix := "net." + strconv.Itoa(i) + "."
+		stats := topology.InterfaceStats{
+			Name:      names[second[prefix+"name"]],
+			RxBytes:   second.uint(prefix + "rx.bytes"),
+			TxBytes:   second.uint(prefix + "tx.bytes"),
+			RxPackets: second.uint(prefix + "rx.pkts"),
+			TxPackets: second.uint(prefix + "tx.pkts"),
+			RxErrors:  second.uint(prefix + "rx.errs"),
+			TxErrors:  second.uint(prefix + "tx.errs"),
+			RxDropped: second.uint(prefix + "rx.drop"),
+			TxDropped: second.uint(prefix + "tx.drop"),
+		}
+		if stats.Name == "" {
+			stats.Name = second[prefix+"name"]
+		}
+		nodeStats.RxBytes += stats.RxBytes
+		nodeStats.TxBytes += stats.TxBytes
+		nodeStats.RxPackets += stats.RxPackets
+		nodeStats.TxPackets += stats.TxPackets
+		ifaces = append(ifaces, stats)
+	}
+	slices.SortFunc(ifaces, func(a, b topology.InterfaceStats) int { return strings.Compare(a.Name, b.Name) })
+	nodeStats.Interfaces = ifaces
+	return nodeStats, nil
+}
+
+// labVMs reads the records of the VMs owned by the provided lab, or by any lab if it is empty.
+func (lp *LibvirtProvider) labVMs(lab string) ([]*vm, error) {
+	paths, err := filepath.Glob(filepath.Join(lp.stateDir, "vms", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var recs []*vm
+	for _, path := range paths {
+		rec, err := lp.readVM(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		if inLab(rec.Labels, lab) {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+// RemoveOrphans removes all VMs labeled as owned by the provided lab, or by any lab if it is empty, before
+// the container provider removes the containers and networks of the lab.
+func (lp *LibvirtProvider) RemoveOrphans(ctx context.Context, lab string) error {
+	recs, err := lp.labVMs(lab)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		state, err := lp.state(ctx, rec.Name)
+		if err != nil {
+			return err
+		}
+		if err := lp.remove(ctx, rec.Name, state != ""); err != nil {
+			return err
+		}
+		lp.log.With(rec.Name).Success(fmt.Sprintf("removed libvirt domain %s of lab %s", rec.Name, rec.Labels[topology.LabLabel]))
+	}
+	return lp.ContainerProvider.RemoveOrphans(ctx, lab)
+}
+
+// Deployed reports the containers and networks deployed by the container provider along with the VMs
+// labeled as owned by the provided lab, translated back into topology entities.
+func (lp *LibvirtProvider) Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	nodes, links, err := lp.ContainerProvider.Deployed(ctx, lab)
+	if err != nil {
+		return nil, nil, err
+	}
+	recs, err := lp.labVMs(lab)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, rec := range recs {
+		state, err := lp.state(ctx, rec.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if state == "" {
+			continue
+		}
+		node := topology.Node{
+			Name:   topologyName(rec.Name, rec.Labels),
+			Image:  rec.Image,
+			Labels: unmanaged(rec.Labels),
+		}
+		for _, iface := range rec.Interfaces {
+			node.Interfaces = append(node.Interfaces, &topology.Interface{Link: iface.Link, IPv4Addr: strings.Split(iface.IPv4Addr, "/")[0]})
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, links, nil
+}
@@ -0,0 +1,525 @@
+package libvirt_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elupevg/golab/libvirt"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeResult struct {
+	stdout   string
+	exitCode int
+}
+
+// fakeRunner records the commands it is given and answers them with the queued results, the last of which
+// keeps answering. Commands without results succeed without output.
+type fakeRunner struct {
+	mu       sync.Mutex
+	results  map[string][]fakeResult
+	commands []string
+}
+
+func newFakeRunner() *fakeRunner {
+	return &fakeRunner{results: make(map[string][]fakeResult)}
+}
+
+func (r *fakeRunner) on(command string, results ...fakeResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results[command] = results
+}
+
+func (r *fakeRunner) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
+
+func (r *fakeRunner) Run(ctx context.Context, cmd libvirt.Command) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	line := strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")
+	r.commands = append(r.commands, line)
+	results := r.results[line]
+	if len(results) == 0 {
+		return 0, nil
+	}
+	result := results[0]
+	if len(results) > 1 {
+		r.results[line] = results[1:]
+	}
+	if cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, result.stdout)
+	}
+	if result.exitCode != 0 && cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, "error: "+result.stdout)
+	}
+	return result.exitCode, nil
+}
+
+// fakeContainers records the calls the container provider gets, reporting the nodes it is given as deployed.
+type fakeContainers struct {
+	libvirt.ContainerProvider
+	mu       sync.Mutex
+	calls    []string
+	deployed []topology.Node
+}
+
+func (c *fakeContainers) record(call string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+}
+
+func (c *fakeContainers) LinkCreate(_ context.Context, link topology.Link) error {
+	c.record("create " + link.Name)
+	return nil
+}
+
+func (c *fakeContainers) NodeCreate(_ context.Context, node topology.Node) error {
+	c.record("create " + node.Name)
+	return nil
+}
+
+func (c *fakeContainers) NodeRemove(_ context.Context, node topology.Node) error {
+	c.record("remove " + node.Name)
+	return nil
+}
+
+func (c *fakeContainers) NodeExec(_ context.Context, node topology.Node, cmd []string, _, _ io.Writer) (int, error) {
+	c.record("exec " + node.Name)
+	return 0, nil
+}
+
+func (c *fakeContainers) Deployed(_ context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	c.record("deployed " + lab)
+	return c.deployed, nil, nil
+}
+
+func (c *fakeContainers) RemoveOrphans(_ context.Context, lab string) error {
+	c.record("orphans " + lab)
+	return nil
+}
+
+func newProvider(t *testing.T) (*libvirt.LibvirtProvider, *fakeRunner, *fakeContainers, string) {
+	t.Helper()
+	runner, containers, dir := newFakeRunner(), new(fakeContainers), t.TempDir()
+	return libvirt.New(containers, runner, dir, logger.New(io.Discard, io.Discard)), runner, containers, dir
+}
+
+var (
+	labLabels = map[string]string{topology.LabLabel: "lab1"}
+	testLink  = topology.Link{
+		Name:       "link-01",
+		Endpoints:  []string{"R1", "R2"},
+		IPv4Subnet: "10.0.0.0/24",
+		Labels:     labLabels,
+	}
+)
+
+// testNode returns a vMX node whose first data interface is eth2, leaving eth1 unconnected.
+func testNode(t *testing.T) topology.Node {
+	t.Helper()
+	image := filepath.Join(t.TempDir(), "vmx.qcow2")
+	if err := os.WriteFile(image, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return topology.Node{
+		Name:        "R1",
+		Image:       image,
+		Vendor:      vendors.VMX,
+		Labels:      labLabels,
+		CPUs:        1.5,
+		Memory:      "8g",
+		StopTimeout: "0s",
+		Mgmt:        &topology.Interface{Name: "eth0", Link: "golab-mgmt", IPv4Addr: "172.20.20.1/24"},
+		Interfaces:  []*topology.Interface{{Name: "eth2", Link: "link-01", IPv4Addr: "10.0.0.1/24"}},
+	}
+}
+
+const domain = "golab-lab1-R1"
+
+// createNode creates the link and the node of the tests, leaving the runner with no recorded commands.
+func createNode(t *testing.T, provider *libvirt.LibvirtProvider, runner *fakeRunner, node topology.Node) {
+	t.Helper()
+	runner.on("virsh list --all --name", fakeResult{stdout: "\n"}, fakeResult{stdout: domain + "\n"})
+	runner.on("virsh domstate "+domain, fakeResult{stdout: "running\n"})
+	if err := provider.LinkCreate(context.Background(), testLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	runner.reset()
+}
+
+// testDomain is the part of the domain XML the tests check.
+type testDomain struct {
+	Memory     string          `xml:"memory"`
+	VCPU       int             `xml:"vcpu"`
+	Disk       testAttr        `xml:"devices>disk>source"`
+	Interfaces []testInterface `xml:"devices>interface"`
+}
+
+// testInterface is the part of a NIC of the domain XML the tests check.
+type testInterface struct {
+	Type   string   `xml:"type,attr"`
+	Source testAttr `xml:"source"`
+	Target testAttr `xml:"target"`
+	Model  testAttr `xml:"model"`
+	Link   testAttr `xml:"link"`
+}
+
+// testAttr collects the attributes of an element the tests check.
+type testAttr struct {
+	File   string `xml:"file,attr"`
+	Bridge string `xml:"bridge,attr"`
+	Dev    string `xml:"dev,attr"`
+	Type   string `xml:"type,attr"`
+	State  string `xml:"state,attr"`
+}
+
+// readDomain decodes the domain XML the node of the tests was defined with.
+func readDomain(t *testing.T, dir string) testDomain {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "domains", domain+".xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got testDomain
+	if err := xml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestNodeCreate(t *testing.T) {
+	t.Parallel()
+	provider, runner, containers, dir := newProvider(t)
+	node := testNode(t)
+	runner.on("virsh list --all --name", fakeResult{stdout: "other-vm\n"})
+	runner.on("ip link show dev gl-lab1-link-01", fakeResult{exitCode: 1})
+	if err := provider.LinkCreate(context.Background(), testLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	disk := filepath.Join(dir, "disks", domain+".qcow2")
+	want := []string{
+		"virsh list --all --name",
+		"ip link show dev gl-lab1-mgmt",
+		"ip link show dev gl-lab1-link-01",
+		"ip link add name gl-lab1-link-01 type bridge",
+		"ip link set dev gl-lab1-link-01 up",
+		"qemu-img create -q -f qcow2 -F qcow2 -b " + node.Image + " " + disk,
+		"virsh define " + filepath.Join(dir, "domains", domain+".xml"),
+		"virsh start " + domain,
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"create link-01"}, containers.calls); diff != "" {
+		t.Errorf("container provider calls mismatch (-want +got):\n%s", diff)
+	}
+	got := readDomain(t, dir)
+	taps := make(map[string]bool)
+	for i := range got.Interfaces {
+		taps[got.Interfaces[i].Target.Dev] = true
+		got.Interfaces[i].Target = testAttr{}
+	}
+	if len(taps) != len(got.Interfaces) {
+		t.Errorf("tap devices: want %d distinct, got %d", len(got.Interfaces), len(taps))
+	}
+	wantDomain := testDomain{
+		Memory: "8388608",
+		VCPU:   2,
+		Disk:   testAttr{File: disk},
+		Interfaces: []testInterface{
+			{Type: "bridge", Source: testAttr{Bridge: "gl-lab1-mgmt"}, Model: testAttr{Type: "virtio"}},
+			{Type: "ethernet", Model: testAttr{Type: "virtio"}, Link: testAttr{State: "down"}},
+			{Type: "bridge", Source: testAttr{Bridge: "gl-lab1-link-01"}, Model: testAttr{Type: "virtio"}},
+		},
+	}
+	if diff := cmp.Diff(wantDomain, got); diff != "" {
+		t.Errorf("domain mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeCreateContainer(t *testing.T) {
+	t.Parallel()
+	provider, runner, containers, _ := newProvider(t)
+	node := topology.Node{Name: "R2", Image: "quay.io/frrouting/frr:master", Labels: labLabels}
+	if err := provider.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.NodeExec(context.Background(), node, []string{"true"}, io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"create R2", "exec R2"}, containers.calls); diff != "" {
+		t.Errorf("container provider calls mismatch (-want +got):\n%s", diff)
+	}
+	if len(runner.commands) != 0 {
+		t.Errorf("commands: want none, got %q", runner.commands)
+	}
+}
+
+func TestNodeCreateUnsupported(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		change  func(node *topology.Node)
+		link    topology.Link
+		wantErr string
+	}{
+		{
+			name:    "Sidecars",
+			change:  func(node *topology.Node) { node.Sidecars = []*topology.Node{{Name: "R1-ssh"}} },
+			wantErr: "node R1 is a virtual machine, which does not support sidecars",
+		},
+		{
+			name:    "Ports",
+			change:  func(node *topology.Node) { node.Ports = []string{"8080:80"} },
+			wantErr: "node R1 is a virtual machine, which does not support ports",
+		},
+		{
+			name:    "Veth",
+			change:  func(node *topology.Node) { node.Interfaces[0].Veth = true },
+			wantErr: "node R1 is a virtual machine, which does not support veth links",
+		},
+		{
+			name: "Subinterface",
+			change: func(node *topology.Node) {
+				node.Interfaces = append(node.Interfaces, &topology.Interface{Name: "eth2.10", Link: "link-02", Parent: "eth2", VLAN: 10})
+			},
+			wantErr: "node R1 is a virtual machine, which does not support subinterfaces",
+		},
+		{
+			name:    "Macvlan",
+			link:    topology.Link{Name: "link-01", Labels: labLabels, Driver: topology.DriverMacvlan, HostInterface: "eth9"},
+			wantErr: "node R1 is a virtual machine, which cannot join link link-01 without a bridge",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			provider, runner, _, _ := newProvider(t)
+			node := testNode(t)
+			if tc.change != nil {
+				tc.change(&node)
+			}
+			if tc.link.Name != "" {
+				if err := provider.LinkCreate(context.Background(), tc.link); err != nil {
+					t.Fatal(err)
+				}
+			}
+			runner.on("virsh list --all --name", fakeResult{stdout: "\n"})
+			err := provider.NodeCreate(context.Background(), node)
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("error: want %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNodeCreateStopped(t *testing.T) {
+	t.Parallel()
+	provider, runner, _, _ := newProvider(t)
+	node := testNode(t)
+	createNode(t, provider, runner, node)
+	runner.on("virsh domstate "+domain, fakeResult{stdout: "shut off\n"})
+	if err := provider.NodeCreate(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"virsh list --all --name",
+		"virsh domstate " + domain,
+		"virsh list --all --name",
+		"virsh domstate " + domain,
+		"ip link show dev gl-lab1-mgmt",
+		"ip link show dev gl-lab1-link-01",
+		"virsh start " + domain,
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeRemove(t *testing.T) {
+	t.Parallel()
+	provider, runner, _, dir := newProvider(t)
+	node := testNode(t)
+	createNode(t, provider, runner, node)
+	runner.on("virsh domstate "+domain, fakeResult{stdout: "running\n"}, fakeResult{stdout: "running\n"}, fakeResult{stdout: "shut off\n"})
+	if err := provider.NodeRemove(context.Background(), node); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"virsh list --all --name",
+		"virsh domstate " + domain,
+		// the stop timeout of the node has passed right away, so the VM is destroyed
+		"virsh list --all --name",
+		"virsh domstate " + domain,
+		"virsh shutdown " + domain,
+		"virsh destroy " + domain,
+		"virsh list --all --name",
+		"virsh domstate " + domain,
+		"virsh undefine " + domain,
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	for _, sub := range []string{"vms", "domains"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("%s: want no files, got %d", sub, len(entries))
+		}
+	}
+}
+
+func TestNodeRemoveForeign(t *testing.T) {
+	t.Parallel()
+	provider, runner, _, _ := newProvider(t)
+	runner.on("virsh list --all --name", fakeResult{stdout: domain + "\n"})
+	runner.on("virsh domstate "+domain, fakeResult{stdout: "running\n"})
+	err := provider.NodeRemove(context.Background(), testNode(t))
+	wantErr := "refusing to remove libvirt domain golab-lab1-R1, which golab did not create for this lab"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	if diff := cmp.Diff([]string{"virsh list --all --name", "virsh domstate " + domain}, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeExec(t *testing.T) {
+	t.Parallel()
+	provider, _, containers, _ := newProvider(t)
+	_, err := provider.NodeExec(context.Background(), testNode(t), []string{"true"}, io.Discard, io.Discard)
+	wantErr := "node R1 is a virtual machine, which commands cannot be run in"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	if len(containers.calls) != 0 {
+		t.Errorf("container provider calls: want none, got %q", containers.calls)
+	}
+}
+
+func TestLinkConnect(t *testing.T) {
+	t.Parallel()
+	provider, _, containers, _ := newProvider(t)
+	err := provider.LinkConnect(context.Background(), testLink, []topology.Node{testNode(t)})
+	wantErr := "node R1 is a virtual machine, whose links cannot be changed while it runs"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	if len(containers.calls) != 0 {
+		t.Errorf("container provider calls: want none, got %q", containers.calls)
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	t.Parallel()
+	provider, runner, _, dir := newProvider(t)
+	node := testNode(t)
+	createNode(t, provider, runner, node)
+	tap := readDomain(t, dir).Interfaces[2].Target.Dev
+	sample := func(cpuTime string) fakeResult {
+		return fakeResult{stdout: "Domain: '" + domain + "'\n" +
+			"  cpu.time=" + cpuTime + "\n" +
+			"  balloon.maximum=8388608\n" +
+			"  balloon.rss=1048576\n" +
+			"  net.count=1\n" +
+			"  net.0.name=" + tap + "\n" +
+			"  net.0.rx.bytes=1000\n" +
+			"  net.0.rx.pkts=10\n" +
+			"  net.0.tx.bytes=2000\n" +
+			"  net.0.tx.pkts=20\n" +
+			"  net.0.rx.drop=1\n"}
+	}
+	runner.on("virsh domstats --cpu-total --balloon --interface "+domain, sample("1000000000"), sample("1250000000"))
+	stats, err := provider.NodeStats(context.Background(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.CPUPercent <= 0 || stats.CPUPercent > 50 {
+		t.Errorf("cpu: want up to 50%%, got %f", stats.CPUPercent)
+	}
+	stats.CPUPercent = 0
+	want := topology.NodeStats{
+		MemUsage:  1 << 30,
+		MemLimit:  8 << 30,
+		RxBytes:   1000,
+		TxBytes:   2000,
+		RxPackets: 10,
+		TxPackets: 20,
+		Interfaces: []topology.InterfaceStats{
+			{Name: "eth2", RxBytes: 1000, TxBytes: 2000, RxPackets: 10, TxPackets: 20, RxDropped: 1},
+		},
+	}
+	if diff := cmp.Diff(want, stats); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeployedAndRemoveOrphans(t *testing.T) {
+	t.Parallel()
+	provider, runner, containers, dir := newProvider(t)
+	node := testNode(t)
+	createNode(t, provider, runner, node)
+	containers.deployed = []topology.Node{{Name: "R2"}}
+	runner.on("virsh list --all --name", fakeResult{stdout: domain + "\n"})
+	runner.on("virsh domstate "+domain, fakeResult{stdout: "running\n"}, fakeResult{stdout: "shut off\n"})
+	nodes, _, err := provider.Deployed(context.Background(), "lab1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNodes := []topology.Node{
+		{Name: "R2"},
+		{
+			Name:       "R1",
+			Image:      node.Image,
+			Labels:     labLabels,
+			Interfaces: []*topology.Interface{{Link: "link-01", IPv4Addr: "10.0.0.1"}},
+		},
+	}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("deployed nodes mismatch (-want +got):\n%s", diff)
+	}
+	runner.reset()
+	if err := provider.RemoveOrphans(context.Background(), "lab1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"virsh list --all --name",
+		"virsh domstate " + domain,
+		"virsh list --all --name",
+		"virsh domstate " + domain,
+		"virsh undefine " + domain,
+	}
+	if diff := cmp.Diff(want, runner.commands); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"create link-01", "deployed lab1", "orphans lab1"}, containers.calls); diff != "" {
+		t.Errorf("container provider calls mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "vms", domain+".json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("error: want %q, got %v", fs.ErrNotExist, err)
+	}
+}
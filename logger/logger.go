@@ -2,42 +2,124 @@
 package logger
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
 const (
-	reset = "\x1b[0m"
-	red   = "\x1b[31m"
-	green = "\x1b[32m"
-	cyan  = "\x1b[36m"
+	reset  = "\x1b[0m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+	blue   = "\x1b[34m"
+	cyan   = "\x1b[36m"
+	gray   = "\x1b[90m"
+)
+
+// Level represents the severity of log messages.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
 )
 
 // Logger implements a simple logger with customizable out and error writers.
 type Logger struct {
-	out io.Writer
-	err io.Writer
+	out      io.Writer
+	err      io.Writer
+	json     bool
+	level    Level
+	resource string
+	now      func() time.Time
 }
 
 // New creates and returns a new Logger instance.
 func New(out, err io.Writer) *Logger {
 	return &Logger{
-		out: out,
-		err: err,
+		out:   out,
+		err:   err,
+		level: LevelInfo,
+		now:   time.Now,
+	}
+}
+
+// SetJSON switches the logger between colorized text and JSON lines output.
+func (l *Logger) SetJSON(enabled bool) {
+	l.json = enabled
+}
+
+// SetLevel suppresses messages less severe than the provided level.
+func (l *Logger) SetLevel(level Level) {
+	l.level = level
+}
+
+// With returns a copy of the logger annotating messages with the resource they refer to.
+// The resource is only shown in JSON output, as text messages mention it anyway.
+func (l *Logger) With(resource string) *Logger {
+	derived := *l
+	derived.resource = resource
+	return &derived
+}
+
+// event represents a single log message in JSON output.
+type event struct {
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Message  string    `json:"message"`
+	Resource string    `json:"resource,omitempty"`
+}
+
+// print writes the message either as a JSON line or with a colorized prefix,
+// unless its severity is below the logger level.
+func (l *Logger) print(w io.Writer, severity Level, level, color, msg string) {
+	if severity < l.level {
+		return
+	}
+	if !l.json {
+		fmt.Fprintf(w, "[%s%s%s] %s\n", color, level, reset, msg)
+		return
 	}
+	// encoding a struct of strings and a timestamp never fails
+	_ = json.NewEncoder(w).Encode(event{
+		Time:     l.now().UTC(),
+		Level:    strings.ToLower(level),
+		Message:  msg,
+		Resource: l.resource,
+	})
 }
 
-// Success annotates the provided message with colorized prefix and prints it.
+// Debug annotates the provided message with colorized prefix and prints it at debug level.
+func (l *Logger) Debug(msg string) {
+	l.print(l.out, LevelDebug, "DEBUG", gray, msg)
+}
+
+// Success annotates the provided message with colorized prefix and prints it at info level.
 func (l *Logger) Success(msg string) {
-	fmt.Fprintf(l.out, "[%sSUCCESS%s] %s\n", green, reset, msg)
+	l.print(l.out, LevelInfo, "SUCCESS", green, msg)
+}
+
+// Progress annotates the provided message with colorized prefix and prints it at info level.
+func (l *Logger) Progress(msg string) {
+	l.print(l.out, LevelInfo, "PROGRESS", blue, msg)
 }
 
-// Skipped annotates the provided message with colorized prefix and prints it.
+// Skipped annotates the provided message with colorized prefix and prints it at info level.
 func (l *Logger) Skipped(msg string) {
-	fmt.Fprintf(l.out, "[%sSKIPPED%s] %s\n", cyan, reset, msg)
+	l.print(l.out, LevelInfo, "SKIPPED", cyan, msg)
+}
+
+// Warn annotates the provided message with colorized prefix and prints it at warning level.
+func (l *Logger) Warn(msg string) {
+	l.print(l.err, LevelWarn, "WARNING", yellow, msg)
 }
 
-// Errored annotates the provided error message with colorized prefix and prints it.
+// Errored annotates the provided error message with colorized prefix and prints it at error level.
 func (l *Logger) Errored(err error) {
-	fmt.Fprintf(l.err, "[%sERROR%s] %s\n", red, reset, err.Error())
+	l.print(l.err, LevelError, "ERROR", red, err.Error())
 }
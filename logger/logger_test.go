@@ -2,10 +2,14 @@ package logger_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/elupevg/golab/logger"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestLoggerSuccess(t *testing.T) {
@@ -40,6 +44,22 @@ func TestLoggerSkipped(t *testing.T) {
 	}
 }
 
+func TestLoggerProgress(t *testing.T) {
+	t.Parallel()
+	outBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
+	log := logger.New(outBuf, errBuf)
+	log.Progress("test operation")
+	got := errBuf.String()
+	if got != "" {
+		t.Fatalf("errBuf: want \"\", got %q", got)
+	}
+	want := "[\x1b[34mPROGRESS\x1b[0m] test operation\n"
+	got = outBuf.String()
+	if want != got {
+		t.Errorf("outBuf: want %q, got %q", want, got)
+	}
+}
+
 func TestLoggerErrored(t *testing.T) {
 	t.Parallel()
 	outBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
@@ -55,3 +75,97 @@ func TestLoggerErrored(t *testing.T) {
 		t.Errorf("errBuf: want %q, got %q", want, got)
 	}
 }
+
+func TestLoggerJSON(t *testing.T) {
+	t.Parallel()
+	outBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
+	log := logger.New(outBuf, errBuf)
+	log.SetJSON(true)
+	log.With("R1").Success("started docker container R1")
+	log.Skipped("already removed docker network lab-1")
+	log.Errored(errors.New("test error"))
+	type event struct {
+		Time     time.Time `json:"time"`
+		Level    string    `json:"level"`
+		Message  string    `json:"message"`
+		Resource string    `json:"resource"`
+	}
+	decode := func(data string) []event {
+		var events []event
+		dec := json.NewDecoder(strings.NewReader(data))
+		for dec.More() {
+			var e event
+			if err := dec.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Time.IsZero() {
+				t.Errorf("event %q: want a timestamp", e.Message)
+			}
+			e.Time = time.Time{}
+			events = append(events, e)
+		}
+		return events
+	}
+	wantOut := []event{
+		{Level: "success", Message: "started docker container R1", Resource: "R1"},
+		{Level: "skipped", Message: "already removed docker network lab-1"},
+	}
+	if diff := cmp.Diff(wantOut, decode(outBuf.String())); diff != "" {
+		t.Errorf("outBuf mismatch (-want +got):\n%s", diff)
+	}
+	wantErr := []event{{Level: "error", Message: "test error"}}
+	if diff := cmp.Diff(wantErr, decode(errBuf.String())); diff != "" {
+		t.Errorf("errBuf mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		level   logger.Level
+		wantOut string
+		wantErr string
+	}{
+		{
+			name:    "Debug",
+			level:   logger.LevelDebug,
+			wantOut: "[\x1b[90mDEBUG\x1b[0m] options\n[\x1b[32mSUCCESS\x1b[0m] done\n",
+			wantErr: "[\x1b[33mWARNING\x1b[0m] slow\n[\x1b[31mERROR\x1b[0m] failed\n",
+		},
+		{
+			name:    "Info",
+			level:   logger.LevelInfo,
+			wantOut: "[\x1b[32mSUCCESS\x1b[0m] done\n",
+			wantErr: "[\x1b[33mWARNING\x1b[0m] slow\n[\x1b[31mERROR\x1b[0m] failed\n",
+		},
+		{
+			name:    "Warn",
+			level:   logger.LevelWarn,
+			wantErr: "[\x1b[33mWARNING\x1b[0m] slow\n[\x1b[31mERROR\x1b[0m] failed\n",
+		},
+		{
+			name:    "Error",
+			level:   logger.LevelError,
+			wantErr: "[\x1b[31mERROR\x1b[0m] failed\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			outBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
+			log := logger.New(outBuf, errBuf)
+			log.SetLevel(tc.level)
+			log.Debug("options")
+			log.Success("done")
+			log.Warn("slow")
+			log.Errored(errors.New("failed"))
+			if got := outBuf.String(); got != tc.wantOut {
+				t.Errorf("outBuf: want %q, got %q", tc.wantOut, got)
+			}
+			if got := errBuf.String(); got != tc.wantErr {
+				t.Errorf("errBuf: want %q, got %q", tc.wantErr, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package lxd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+)
+
+// sockets lists where the LXD daemon listens when installed as a snap or from distribution packages.
+var sockets = []string{
+	"/var/snap/lxd/common/lxd/unix.socket",
+	"/var/lib/lxd/unix.socket",
+}
+
+// Socket returns the path of the unix socket of the LXD daemon: LXD_SOCKET if set, otherwise the
+// socket of the snap or the one of distribution packages, whichever exists.
+func Socket() string {
+	if socket := os.Getenv("LXD_SOCKET"); socket != "" {
+		return socket
+	}
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err == nil {
+			return socket
+		}
+	}
+	return sockets[0]
+}
+
+// client talks to the REST API of the LXD daemon over its unix socket.
+type client struct {
+	http *http.Client
+}
+
+// newClient returns a client of the LXD daemon listening on the unix socket.
+func newClient(socket string) *client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &client{http: &http.Client{Transport: transport}}
+}
+
+// response is the envelope of all responses of the LXD API. Background operations are
+// returned as async responses along with the path of the operation.
+type response struct {
+	Type      string          `json:"type"`
+	Error     string          `json:"error"`
+	ErrorCode int             `json:"error_code"`
+	Operation string          `json:"operation"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// operation is the state of a background operation of the LXD daemon.
+type operation struct {
+	Status     string          `json:"status"`
+	StatusCode int             `json:"status_code"`
+	Metadata   json.RawMessage `json:"metadata"`
+	Err        string          `json:"err"`
+}
+
+// statusError is returned for requests the LXD daemon rejects, e.g. with 404 for missing objects.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return "lxd: " + e.msg
+}
+
+// isNotFound tells whether the LXD daemon rejected a request as the object does not exist.
+func isNotFound(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.code == http.StatusNotFound
+}
+
+// do sends a request to the LXD API and decodes the metadata of the response into out unless it is nil.
+// Background operations are waited for, in which case out receives the metadata of the operation.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	resp, err := c.send(ctx, method, path, reqBody)
+	if err != nil {
+		return err
+	}
+	metadata := resp.Metadata
+	if resp.Type == "async" {
+		if metadata, err = c.wait(ctx, resp.Operation); err != nil {
+			return err
+		}
+	}
+	if out == nil || len(metadata) == 0 {
+		return nil
+	}
+	return json.Unmarshal(metadata, out)
+}
+
+// send sends a request to the LXD API and returns its decoded envelope.
+func (c *client) send(ctx context.Context, method, path string, body io.Reader) (*response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://lxd"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	var resp response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response of lxd to %s %s: %w", method, path, err)
+	}
+	if resp.Type == "error" {
+		return nil, &statusError{code: resp.ErrorCode, msg: resp.Error}
+	}
+	return &resp, nil
+}
+
+// wait waits for the background operation at the path to finish and returns its metadata.
+func (c *client) wait(ctx context.Context, path string) (json.RawMessage, error) {
+	resp, err := c.send(ctx, http.MethodGet, path+"/wait", nil)
+	if err != nil {
+		return nil, err
+	}
+	var op operation
+	if err := json.Unmarshal(resp.Metadata, &op); err != nil {
+		return nil, err
+	}
+	if op.StatusCode != http.StatusOK {
+		return nil, &statusError{code: op.StatusCode, msg: op.Err}
+	}
+	return op.Metadata, nil
+}
+
+// raw returns the body of a response which is not wrapped in an envelope, e.g. a log file.
+func (c *client) raw(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://lxd"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		var resp response
+		if json.Unmarshal(data, &resp) == nil && resp.Error != "" {
+			return nil, &statusError{code: httpResp.StatusCode, msg: resp.Error}
+		}
+		return nil, &statusError{code: httpResp.StatusCode, msg: httpResp.Status}
+	}
+	return data, nil
+}
+
+// close releases idle connections to the LXD daemon.
+func (c *client) close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,1161 @@
+// Package lxd translates GoLab network topology entities into LXD objects, running nodes as system
+// containers which boot a full init system rather than a single process.
+// Examples:
+//
+//	topology.Link is equivalent to an LXD bridge network
+//	topology.Node is equivalent to an LXD container instance
+//
+// LXD assigns no addresses to instances on networks without DHCP, so the addresses of node interfaces
+// are configured inside the instances once they are started.
+package lxd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+)
+
+// Configuration keys of LXD objects storing what golab needs to recognize them. Labels of topology
+// entities are stored under labelPrefix, e.g. user.label.golab.lab for the lab owning the object.
+const (
+	labelPrefix   = "user.label."
+	labKey        = labelPrefix + topology.LabLabel
+	managedKey    = "user.golab.managed"
+	nameKey       = "user.golab.name"
+	imageKey      = "user.golab.image"
+	interfacesKey = "user.golab.interfaces"
+	ipv4SubnetKey = "user.golab.ipv4_subnet"
+	ipv6SubnetKey = "user.golab.ipv6_subnet"
+	mtuKey        = "bridge.mtu"
+)
+
+// Options of Docker networks and endpoints which the lxd provider translates, while the others are rejected.
+const (
+	mtuOption        = "com.docker.network.driver.mtu"
+	masqueradeOption = "com.docker.network.bridge.enable_ip_masquerade"
+	ifnameOption     = "com.docker.network.endpoint.ifname"
+	sysctlsOption    = "com.docker.network.endpoint.sysctls"
+)
+
+// networkPrefix starts the names of LXD networks, which are names of Linux interfaces limited to maxIfaceName characters.
+const (
+	networkPrefix = "gl-"
+	maxIfaceName  = 15
+)
+
+// defaultReadyTimeout bounds waiting for a started instance to become ready unless its node sets a timeout.
+const defaultReadyTimeout = 2 * time.Minute
+
+// defaultStopTimeout bounds graceful shutdown of a stopped instance unless its node sets a timeout.
+const defaultStopTimeout = 10 * time.Second
+
+// readyInterval separates readiness checks of a started instance, as well as polls of its console log.
+const readyInterval = time.Second
+
+// statsInterval separates the two samples of the state of an instance CPU usage is calculated from.
+const statsInterval = time.Second
+
+// commitSnapshot is the name of the temporary snapshot an instance is published as an image from.
+const commitSnapshot = "golab-commit"
+
+// Statuses of LXD instances.
+const (
+	statusRunning = "Running"
+	statusFrozen  = "Frozen"
+)
+
+// remotes maps the image servers of the default LXD remotes to their addresses, so that images
+// are referenced as REMOTE:ALIAS like with the lxc command, e.g. images:debian/12.
+var remotes = map[string]string{
+	"images":       "https://images.lxd.canonical.com",
+	"ubuntu":       "https://cloud-images.ubuntu.com/releases",
+	"ubuntu-daily": "https://cloud-images.ubuntu.com/daily",
+}
+
+// LXDProvider stores the client of the LXD daemon.
+type LXDProvider struct {
+	client *client
+	log    *logger.Logger
+}
+
+// New returns an instance of an LXDProvider talking to the LXD daemon listening on the unix socket.
+func New(socket string, log *logger.Logger) *LXDProvider {
+	return &LXDProvider{client: newClient(socket), log: log}
+}
+
+// Close releases the connections to the LXD daemon.
+func (lp *LXDProvider) Close() error {
+	return lp.client.close()
+}
+
+// instance represents an LXD instance along with its local configuration and devices.
+type instance struct {
+	Name         string                       `json:"name"`
+	Status       string                       `json:"status"`
+	Type         string                       `json:"type,omitempty"`
+	Architecture string                       `json:"architecture,omitempty"`
+	Description  string                       `json:"description"`
+	Ephemeral    bool                         `json:"ephemeral"`
+	Profiles     []string                     `json:"profiles"`
+	Config       map[string]string            `json:"config"`
+	Devices      map[string]map[string]string `json:"devices"`
+}
+
+// instancePut is the writable part of an LXD instance, which replaces it as a whole.
+type instancePut struct {
+	Architecture string                       `json:"architecture,omitempty"`
+	Description  string                       `json:"description"`
+	Ephemeral    bool                         `json:"ephemeral"`
+	Profiles     []string                     `json:"profiles"`
+	Config       map[string]string            `json:"config"`
+	Devices      map[string]map[string]string `json:"devices"`
+}
+
+// instancesPost creates an LXD instance from an image.
+type instancesPost struct {
+	instancePut
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Source imageSource `json:"source"`
+}
+
+// imageSource is the image an LXD instance is created from, which is pulled from an image server
+// unless it is a local alias.
+type imageSource struct {
+	Type     string `json:"type"`
+	Alias    string `json:"alias"`
+	Server   string `json:"server,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+}
+
+// instanceState is the runtime state of an LXD instance.
+type instanceState struct {
+	Status string `json:"status"`
+	CPU    struct {
+		Usage int64 `json:"usage"`
+	} `json:"cpu"`
+	Memory struct {
+		Usage uint64 `json:"usage"`
+		Total uint64 `json:"total"`
+	} `json:"memory"`
+	Network map[string]struct {
+		Counters struct {
+			BytesReceived          uint64 `json:"bytes_received"`
+			BytesSent              uint64 `json:"bytes_sent"`
+			PacketsReceived        uint64 `json:"packets_received"`
+			PacketsSent            uint64 `json:"packets_sent"`
+			ErrorsReceived         uint64 `json:"errors_received"`
+			ErrorsSent             uint64 `json:"errors_sent"`
+			PacketsDroppedInbound  uint64 `json:"packets_dropped_inbound"`
+			PacketsDroppedOutbound uint64 `json:"packets_dropped_outbound"`
+		} `json:"counters"`
+	} `json:"network"`
+}
+
+// statePut changes the state of an LXD instance, e.g. starts or freezes it.
+type statePut struct {
+	Action  string `json:"action"`
+	Timeout int    `json:"timeout,omitempty"`
+	Force   bool   `json:"force,omitempty"`
+}
+
+// lxdNetwork represents an LXD network.
+type lxdNetwork struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type,omitempty"`
+	Description string            `json:"description"`
+	Config      map[string]string `json:"config"`
+}
+
+// execPost runs a command inside an LXD instance, recording its output to log files of the instance.
+type execPost struct {
+	Command          []string `json:"command"`
+	WaitForWebsocket bool     `json:"wait-for-websocket"`
+	Interactive      bool     `json:"interactive"`
+	RecordOutput     bool     `json:"record-output"`
+}
+
+// execResult is the metadata of a finished exec operation with the paths of its stdout and stderr logs.
+type execResult struct {
+	Return int               `json:"return"`
+	Output map[string]string `json:"output"`
+}
+
+// LinkCreate translates a topology.Link entity into an LXD network and creates it. Links are bridges
+// holding their gateways, if any, while external ones NAT the traffic of the lab as well, and links
+// bridged to a host interface are macvlan networks on top of it. Addresses are never handed out by LXD.
+func (lp *LXDProvider) LinkCreate(ctx context.Context, link topology.Link) error {
+	if link.Veth() {
+		return fmt.Errorf("link %s: veth links are not supported by the lxd provider", link.Name)
+	}
+	if link.Driver == topology.DriverIPvlan {
+		return fmt.Errorf("link %s: ipvlan links are not supported by the lxd provider", link.Name)
+	}
+	name := networkName(link.Name, link.Labels)
+	exists, err := lp.exists(ctx, "/1.0/networks/"+url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+	if exists {
+		lp.log.With(link.Name).Skipped("already created lxd network " + name)
+		return nil
+	}
+	netConfig := managed(link.Name, link.Labels)
+	netConfig[ipv4SubnetKey] = link.IPv4Subnet
+	netConfig[ipv6SubnetKey] = link.IPv6Subnet
+	req := lxdNetwork{Name: name, Type: "bridge", Description: "golab link " + link.Name, Config: netConfig}
+	if link.HostInterface != "" {
+		req.Type = "macvlan"
+		netConfig["parent"] = link.HostInterface
+	} else {
+		netConfig["ipv4.address"] = gatewayAddress(link.IPv4Subnet, link.IPv4Gateway)
+		netConfig["ipv6.address"] = gatewayAddress(link.IPv6Subnet, link.IPv6Gateway)
+		netConfig["ipv4.dhcp"] = "false"
+		netConfig["ipv6.dhcp"] = "false"
+		netConfig["ipv4.nat"] = strconv.FormatBool(link.External)
+		netConfig["ipv6.nat"] = strconv.FormatBool(link.External)
+		if link.MTU != 0 {
+			netConfig[mtuKey] = strconv.Itoa(link.MTU)
+		}
+	}
+	if err := translateDriverOpts(link, netConfig); err != nil {
+		return err
+	}
+	lp.logOptions(name, "network", req)
+	if err := lp.client.do(ctx, http.MethodPost, "/1.0/networks", req, nil); err != nil {
+		return err
+	}
+	lp.log.With(link.Name).Success(fmt.Sprintf("created lxd network %s with subnets=[%v, %v]", name, link.IPv4Subnet, link.IPv6Subnet))
+	return nil
+}
+
+// translateDriverOpts converts the options of the Docker network of the link into the configuration
+// of its LXD network. The MTU applies to both bridges and macvlan networks, and masquerading to bridges.
+func translateDriverOpts(link topology.Link, netConfig map[string]string) error {
+	for _, key := range slices.Sorted(maps.Keys(link.DriverOpts)) {
+		value := link.DriverOpts[key]
+		switch {
+		case key == mtuOption && link.HostInterface != "":
+			netConfig["mtu"] = value
+		case key == mtuOption:
+			netConfig[mtuKey] = value
+		case key == masqueradeOption && link.HostInterface == "":
+			netConfig["ipv4.nat"] = value
+			netConfig["ipv6.nat"] = value
+		default:
+			return fmt.Errorf("link %s: driver option %s is not supported by the lxd provider", link.Name, key)
+		}
+	}
+	return nil
+}
+
+// gatewayAddress returns the address of the bridge of a network in CIDR notation, which is the gateway
+// of its link. Bridges of links without gateways stay out of their subnets, like the wires they stand for.
+func gatewayAddress(subnet, gateway string) string {
+	if subnet == "" || gateway == "" {
+		return "none"
+	}
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return "none"
+	}
+	return gateway + "/" + strconv.Itoa(prefix.Bits())
+}
+
+// LinkRemove translates a topology.Link entity into an LXD network and removes it.
+func (lp *LXDProvider) LinkRemove(ctx context.Context, link topology.Link) error {
+	name := networkName(link.Name, link.Labels)
+	path := "/1.0/networks/" + url.PathEscape(name)
+	var net lxdNetwork
+	if err := lp.client.do(ctx, http.MethodGet, path, nil, &net); isNotFound(err) {
+		lp.log.With(link.Name).Skipped("already removed lxd network " + name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !owned(net.Config, link.Labels) {
+		return fmt.Errorf("refusing to remove lxd network %s, which golab did not create for this lab", name)
+	}
+	if err := lp.client.do(ctx, http.MethodDelete, path, nil, nil); err != nil {
+		return err
+	}
+	lp.log.With(link.Name).Success("removed lxd network " + name)
+	return nil
+}
+
+// LinkConnect attaches the instances of the provided nodes to the link while they keep running
+// and configures the addresses of their interfaces on it.
+func (lp *LXDProvider) LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	if link.Veth() {
+		return fmt.Errorf("link %s: veth links are not supported by the lxd provider", link.Name)
+	}
+	netName := networkName(link.Name, link.Labels)
+	for _, node := range nodes {
+		name := instanceName(node)
+		iface, err := attachment(link, node)
+		if err != nil {
+			return err
+		}
+		inst, err := lp.instance(ctx, node)
+		if err != nil {
+			return err
+		}
+		if _, ok := inst.Devices[iface.Name]; ok {
+			lp.log.With(node.Name).Skipped(fmt.Sprintf("already connected lxd instance %s to network %s", name, netName))
+			continue
+		}
+		if _, err := interfaceSysctls(node, iface); err != nil {
+			return err
+		}
+		inst.Devices[iface.Name] = nicDevice(iface, node.Labels)
+		if err := lp.update(ctx, inst); err != nil {
+			return err
+		}
+		if err := lp.configureInterface(ctx, node, iface); err != nil {
+			return err
+		}
+		lp.log.With(node.Name).Success(fmt.Sprintf("connected lxd instance %s to network %s", name, netName))
+	}
+	return nil
+}
+
+// LinkDisconnect detaches the instances of the provided nodes from the link while they keep running.
+func (lp *LXDProvider) LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	netName := networkName(link.Name, link.Labels)
+	for _, node := range nodes {
+		name := instanceName(node)
+		iface, err := attachment(link, node)
+		if err != nil {
+			return err
+		}
+		inst, err := lp.instance(ctx, node)
+		if err != nil {
+			return err
+		}
+		if _, ok := inst.Devices[iface.Name]; !ok {
+			lp.log.With(node.Name).Skipped(fmt.Sprintf("already disconnected lxd instance %s from network %s", name, netName))
+			continue
+		}
+		delete(inst.Devices, iface.Name)
+		if err := lp.update(ctx, inst); err != nil {
+			return err
+		}
+		lp.log.With(node.Name).Success(fmt.Sprintf("disconnected lxd instance %s from network %s", name, netName))
+	}
+	return nil
+}
+
+// attachment returns the interface of the node on the link.
+func attachment(link topology.Link, node topology.Node) (*topology.Interface, error) {
+	j := slices.IndexFunc(node.Interfaces, func(iface *topology.Interface) bool { return iface.Link == link.Name })
+	if j < 0 {
+		return nil, fmt.Errorf("node %s is not attached to link %s", node.Name, link.Name)
+	}
+	return node.Interfaces[j], nil
+}
+
+// instance returns the LXD instance of the node with its local configuration and devices.
+func (lp *LXDProvider) instance(ctx context.Context, node topology.Node) (*instance, error) {
+	var inst instance
+	if err := lp.client.do(ctx, http.MethodGet, instancePath(node), nil, &inst); err != nil {
+		return nil, err
+	}
+	if inst.Devices == nil {
+		inst.Devices = make(map[string]map[string]string)
+	}
+	return &inst, nil
+}
+
+// update replaces the configuration and devices of the LXD instance, which LXD applies to running instances.
+func (lp *LXDProvider) update(ctx context.Context, inst *instance) error {
+	put := instancePut{
+		Architecture: inst.Architecture,
+		Description:  inst.Description,
+		Ephemeral:    inst.Ephemeral,
+		Profiles:     inst.Profiles,
+		Config:       inst.Config,
+		Devices:      inst.Devices,
+	}
+	return lp.client.do(ctx, http.MethodPut, "/1.0/instances/"+url.PathEscape(inst.Name), put, nil)
+}
+
+// exists tells whether the LXD object at the path exists.
+func (lp *LXDProvider) exists(ctx context.Context, path string) (bool, error) {
+	err := lp.client.do(ctx, http.MethodGet, path, nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// managed returns the configuration keys marking LXD objects created by golab for the topology entity.
+func managed(name string, labels map[string]string) map[string]string {
+	config := make(map[string]string, len(labels)+2)
+	for key, value := range labels {
+		config[labelPrefix+key] = value
+	}
+	config[managedKey] = "true"
+	config[nameKey] = name
+	return config
+}
+
+// unmanaged reverts managed for LXD objects, so that their labels compare equal to the ones of topology entities.
+func unmanaged(config map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for key, value := range config {
+		if label, ok := strings.CutPrefix(key, labelPrefix); ok {
+			labels[label] = value
+		}
+	}
+	return labels
+}
+
+// owned tells whether an LXD object was created by golab for the lab of the topology entity, rather than
+// merely sharing its name.
+func owned(config, want map[string]string) bool {
+	return config[managedKey] == "true" && config[labKey] == want[topology.LabLabel]
+}
+
+// lxdName prefixes the name of a topology entity with the lab it is labeled with, so that labs with the
+// same node names can run side by side. Characters LXD does not allow in names are replaced with dashes.
+func lxdName(name string, labels map[string]string) string {
+	if lab := labels[topology.LabLabel]; lab != "" {
+		name = lab + "-" + name
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// instanceName resolves the name of the LXD instance representing the node.
+func instanceName(node topology.Node) string {
+	return lxdName(node.Name, node.Labels)
+}
+
+// instancePath returns the path of the LXD instance representing the node in the LXD API.
+func instancePath(node topology.Node) string {
+	return "/1.0/instances/" + url.PathEscape(instanceName(node))
+}
+
+// networkName names the LXD network of a link after the link and its lab. Network names are names of
+// Linux bridges, so names too long for an interface keep a readable prefix and end in a hash.
+func networkName(link string, labels map[string]string) string {
+	name := networkPrefix + strings.TrimPrefix(link, "golab-")
+	if lab := labels[topology.LabLabel]; lab != "" {
+		name = networkPrefix + lab + "-" + strings.TrimPrefix(link, "golab-")
+	}
+	if len(name) <= maxIfaceName {
+		return name
+	}
+	sum := sha256.Sum256([]byte(lxdName(link, labels)))
+	return name[:maxIfaceName-7] + "-" + hex.EncodeToString(sum[:])[:6]
+}
+
+// nics returns the interfaces of the node which are NICs of its instance, i.e. all but subinterfaces.
+func nics(node topology.Node) []*topology.Interface {
+	ifaces := slices.Clone(node.Interfaces)
+	if node.Mgmt != nil {
+		ifaces = append(ifaces, node.Mgmt)
+	}
+	return slices.DeleteFunc(ifaces, func(iface *topology.Interface) bool { return iface.VLAN != 0 || iface.Veth })
+}
+
+// nicDevice attaches the interface to the network of its link, which belongs to the same lab as the node.
+func nicDevice(iface *topology.Interface, labels map[string]string) map[string]string {
+	return map[string]string{
+		"type":    "nic",
+		"network": networkName(iface.Link, labels),
+		"name":    iface.Name,
+	}
+}
+
+// imageSourceOf resolves the image of the node, which is either REMOTE:ALIAS of a default LXD remote,
+// e.g. images:debian/12, or the alias of a local image, e.g. one published by NodeCommit.
+func imageSourceOf(image string) imageSource {
+	if remote, alias, ok := strings.Cut(image, ":"); ok {
+		if server, ok := remotes[remote]; ok {
+			return imageSource{Type: "image", Alias: alias, Server: server, Protocol: "simplestreams", Mode: "pull"}
+		}
+	}
+	return imageSource{Type: "image", Alias: image}
+}
+
+// generateConfig converts node settings into the configuration of its LXD instance. Processes of
+// unprivileged system containers hold all capabilities within the user namespace of the instance,
+// so capabilities are only ever dropped.
+func generateConfig(node topology.Node) (map[string]string, error) {
+	config := managed(node.Name, node.Labels)
+	config[imageKey] = node.Image
+	ifaces, err := json.Marshal(nics(node))
+	if err != nil {
+		return nil, err
+	}
+	config[interfacesKey] = string(ifaces)
+	if node.Privileged {
+		config["security.privileged"] = "true"
+	}
+	if node.CPUs != 0 {
+		config["limits.cpu.allowance"] = fmt.Sprintf("%dms/100ms", int(node.CPUs*100))
+	}
+	// the memory limit is validated along with the topology
+	if node.Memory != "" {
+		memory, _ := units.RAMInBytes(node.Memory)
+		config["limits.memory"] = strconv.FormatInt(memory, 10)
+	}
+	for key, value := range node.Sysctls {
+		config["linux.sysctl."+key] = value
+	}
+	for key, value := range node.Env {
+		config["environment."+key] = value
+	}
+	if len(node.CapDrop) != 0 {
+		caps := make([]string, 0, len(node.CapDrop))
+		for _, capability := range node.CapDrop {
+			caps = append(caps, strings.ToLower(strings.TrimPrefix(capability, "CAP_")))
+		}
+		config["raw.lxc"] = "lxc.cap.drop = " + strings.Join(caps, " ")
+	}
+	return config, nil
+}
+
+// generateDevices converts interfaces, binds, ports and devices of the node into devices of its LXD
+// instance. The eth0 NIC of the default profile is masked unless the node has an eth0 of its own,
+// so that instances are attached to lab networks only.
+func generateDevices(node topology.Node) map[string]map[string]string {
+	devices := map[string]map[string]string{"eth0": {"type": "none"}}
+	for _, iface := range nics(node) {
+		devices[iface.Name] = nicDevice(iface, node.Labels)
+	}
+	for i, bind := range node.Binds {
+		parts := strings.Split(bind, ":")
+		device := map[string]string{"type": "disk", "source": parts[0], "path": parts[1]}
+		if len(parts) > 2 && parts[2] == "ro" {
+			device["readonly"] = "true"
+		}
+		devices["bind"+strconv.Itoa(i)] = device
+	}
+	for i, port := range node.Ports {
+		listen, connect := proxyAddresses(port)
+		devices["port"+strconv.Itoa(i)] = map[string]string{"type": "proxy", "listen": listen, "connect": connect}
+	}
+	for i, device := range node.Devices {
+		devices["dev"+strconv.Itoa(i)] = map[string]string{"type": "unix-char", "source": device, "path": device}
+	}
+	return devices
+}
+
+// proxyAddresses converts a port published as [HOST_IP:]HOST_PORT:PORT[/PROTOCOL] into the addresses
+// a proxy device listens on the host and connects to inside the instance.
+func proxyAddresses(port string) (string, string) {
+	spec, proto, ok := strings.Cut(port, "/")
+	if !ok {
+		proto = "tcp"
+	}
+	// ports are validated along with the topology
+	parts := strings.Split(spec, ":")
+	hostIP, hostPort, ctrPort := "0.0.0.0", parts[0], parts[len(parts)-1]
+	switch len(parts) {
+	case 1:
+		hostPort = ctrPort
+	case 3:
+		hostIP, hostPort = parts[0], parts[1]
+	}
+	if hostPort == "" {
+		hostPort = ctrPort
+	}
+	return proto + ":" + hostIP + ":" + hostPort, proto + ":127.0.0.1:" + ctrPort
+}
+
+// NodeCreate translates a topology.Node entity into an LXD instance and creates/starts it.
+func (lp *LXDProvider) NodeCreate(ctx context.Context, node topology.Node) error {
+	name := instanceName(node)
+	switch {
+	case node.NetworkMode != "":
+		return fmt.Errorf("node %s: sharing namespaces is not supported by the lxd provider", node.Name)
+	case len(node.Volumes) != 0 || len(node.Tmpfs) != 0:
+		return fmt.Errorf("node %s: volumes and tmpfs mounts are not supported by the lxd provider", node.Name)
+	}
+	for _, iface := range nics(node) {
+		if _, err := interfaceSysctls(node, iface); err != nil {
+			return err
+		}
+	}
+	var inst instance
+	err := lp.client.do(ctx, http.MethodGet, instancePath(node), nil, &inst)
+	switch {
+	case err == nil && inst.Status != statusRunning && inst.Status != statusFrozen:
+		// an instance which has been stopped is started again
+		return lp.NodeStart(ctx, node)
+	case err == nil:
+		lp.log.With(node.Name).Skipped("already created lxd instance " + name)
+		return nil
+	case !isNotFound(err):
+		return err
+	}
+	config, err := generateConfig(node)
+	if err != nil {
+		return err
+	}
+	req := instancesPost{
+		instancePut: instancePut{
+			Description: "golab node " + node.Name,
+			Profiles:    []string{"default"},
+			Config:      config,
+			Devices:     generateDevices(node),
+		},
+		Name:   name,
+		Type:   "container",
+		Source: imageSourceOf(node.Image),
+	}
+	lp.logOptions(name, "instance", redactEnv(req))
+	lp.log.With(node.Name).Progress(fmt.Sprintf("creating lxd instance %s from image %s", name, node.Image))
+	if err := lp.client.do(ctx, http.MethodPost, "/1.0/instances", req, nil); err != nil {
+		return fmt.Errorf("failed to create lxd instance %s: %w", name, err)
+	}
+	if err := lp.startInstance(ctx, node); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("started lxd instance " + name)
+	return lp.waitReady(ctx, node)
+}
+
+// redactEnv hides values of environment variables, which may hold resolved secrets.
+func redactEnv(req instancesPost) instancesPost {
+	config := maps.Clone(req.Config)
+	for key := range config {
+		if strings.HasPrefix(key, "environment.") {
+			config[key] = "<redacted>"
+		}
+	}
+	req.Config = config
+	return req
+}
+
+// logOptions logs the options submitted to the LXD API at debug level.
+func (lp *LXDProvider) logOptions(resource, kind string, opts any) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(opts); err != nil {
+		lp.log.With(resource).Debug(fmt.Sprintf("failed to encode lxd %s options: %v", kind, err))
+		return
+	}
+	lp.log.With(resource).Debug(fmt.Sprintf("submitting lxd %s %s options: %s", kind, resource, bytes.TrimSpace(buf.Bytes())))
+}
+
+// setState changes the state of the instance of the node, e.g. starts, stops or freezes it.
+func (lp *LXDProvider) setState(ctx context.Context, node topology.Node, state statePut) error {
+	return lp.client.do(ctx, http.MethodPut, instancePath(node)+"/state", state, nil)
+}
+
+// state returns the runtime state of the instance of the node.
+func (lp *LXDProvider) state(ctx context.Context, node topology.Node) (instanceState, error) {
+	var state instanceState
+	err := lp.client.do(ctx, http.MethodGet, instancePath(node)+"/state", nil, &state)
+	return state, err
+}
+
+// startInstance starts the instance of the node, configures the addresses of its interfaces and checks
+// that it keeps running for the minimum uptime of the node.
+func (lp *LXDProvider) startInstance(ctx context.Context, node topology.Node) error {
+	name := instanceName(node)
+	if err := lp.setState(ctx, node, statePut{Action: "start"}); err != nil {
+		return err
+	}
+	for _, iface := range nics(node) {
+		if err := lp.configureInterface(ctx, node, iface); err != nil {
+			return err
+		}
+	}
+	var minUptime time.Duration
+	if node.MinUptime != "" {
+		// the uptime is validated along with the topology
+		minUptime, _ = time.ParseDuration(node.MinUptime)
+	}
+	if minUptime != 0 {
+		lp.log.With(node.Name).Progress(fmt.Sprintf("checking that lxd instance %s keeps running for %s", name, minUptime))
+	}
+	deadline := time.Now().Add(minUptime)
+	for {
+		state, err := lp.state(ctx, node)
+		if err != nil {
+			return err
+		}
+		if state.Status != statusRunning {
+			return fmt.Errorf("lxd instance %s stopped while starting", name)
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(wait, readyInterval)):
+		}
+	}
+}
+
+// interfaceSysctls returns the sysctls among the options of the Docker endpoint of the interface, with
+// IFNAME replaced by the name of the interface. LXD names NICs itself, and other options are rejected.
+func interfaceSysctls(node topology.Node, iface *topology.Interface) ([]string, error) {
+	var sysctls []string
+	for _, key := range slices.Sorted(maps.Keys(iface.DriverOpts)) {
+		value := iface.DriverOpts[key]
+		switch key {
+		case ifnameOption:
+		case sysctlsOption:
+			for sysctl := range strings.SplitSeq(value, ",") {
+				sysctls = append(sysctls, strings.ReplaceAll(sysctl, "IFNAME", iface.Name))
+			}
+		default:
+			return nil, fmt.Errorf("node %s: endpoint option %s on link %s is not supported by the lxd provider", node.Name, key, iface.Link)
+		}
+	}
+	return sysctls, nil
+}
+
+// configureInterface sets the sysctls of the interface of the node and brings it up with its addresses.
+// Addresses are replaced, which makes this safe to repeat whenever the instance is started.
+func (lp *LXDProvider) configureInterface(ctx context.Context, node topology.Node, iface *topology.Interface) error {
+	sysctls, err := interfaceSysctls(node, iface)
+	if err != nil {
+		return err
+	}
+	var cmds [][]string
+	for _, sysctl := range sysctls {
+		cmds = append(cmds, []string{"sysctl", "-w", sysctl})
+	}
+	cmds = append(cmds, []string{"ip", "link", "set", iface.Name, "up"})
+	if iface.IPv4Addr != "" {
+		cmds = append(cmds, []string{"ip", "-4", "addr", "replace", iface.IPv4Addr, "dev", iface.Name})
+	}
+	if iface.IPv6Addr != "" {
+		cmds = append(cmds, []string{"ip", "-6", "addr", "replace", iface.IPv6Addr, "dev", iface.Name})
+	}
+	for _, cmd := range cmds {
+		var stderr bytes.Buffer
+		exitCode, err := lp.NodeExec(ctx, node, cmd, io.Discard, &stderr)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("failed to configure interface %s of lxd instance %s: %s", iface.Name, instanceName(node), strings.TrimSpace(stderr.String()))
+		}
+	}
+	return nil
+}
+
+// waitReady waits until the ready command of the node succeeds, so that configuration does not race
+// the boot of the network OS. Instances of nodes without a ready command are ready once started.
+func (lp *LXDProvider) waitReady(ctx context.Context, node topology.Node) error {
+	timeout := defaultReadyTimeout
+	if node.ReadyTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.ReadyTimeout)
+	}
+	if timeout == 0 || len(node.ReadyCommand) == 0 {
+		return nil
+	}
+	name := instanceName(node)
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for waited := false; ; waited = true {
+		// failures to run the command are not errors, as the instance may still be booting
+		exitCode, err := lp.NodeExec(waitCtx, node, node.ReadyCommand, io.Discard, io.Discard)
+		if err == nil && exitCode == 0 {
+			if waited {
+				lp.log.With(node.Name).Success("lxd instance " + name + " is ready")
+			}
+			return nil
+		}
+		if !waited {
+			lp.log.With(node.Name).Progress("waiting for lxd instance " + name + " to become ready")
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("lxd instance %s is not ready after %s", name, timeout)
+		case <-time.After(readyInterval):
+		}
+	}
+}
+
+// NodeRemove translates a topology.Node entity into an LXD instance and removes it.
+func (lp *LXDProvider) NodeRemove(ctx context.Context, node topology.Node) error {
+	name := instanceName(node)
+	var inst instance
+	if err := lp.client.do(ctx, http.MethodGet, instancePath(node), nil, &inst); isNotFound(err) {
+		lp.log.With(node.Name).Skipped("already removed lxd instance " + name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !owned(inst.Config, node.Labels) {
+		return fmt.Errorf("refusing to remove lxd instance %s, which golab did not create for this lab", name)
+	}
+	// running instances shut down gracefully first, so that network OSes can save their state and release locks
+	if inst.Status == statusRunning {
+		if err := lp.setState(ctx, node, statePut{Action: "stop", Timeout: stopTimeout(node)}); err != nil {
+			lp.log.With(node.Name).Warn(fmt.Sprintf("failed to stop lxd instance %s gracefully, removing it by force: %v", name, err))
+		}
+	}
+	if err := lp.forceRemove(ctx, name); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("removed lxd instance " + name)
+	return nil
+}
+
+// forceRemove stops the LXD instance with the name unless it is stopped and deletes it.
+func (lp *LXDProvider) forceRemove(ctx context.Context, name string) error {
+	path := "/1.0/instances/" + url.PathEscape(name)
+	var state instanceState
+	if err := lp.client.do(ctx, http.MethodGet, path+"/state", nil, &state); err != nil {
+		return err
+	}
+	if state.Status == statusRunning || state.Status == statusFrozen {
+		if err := lp.client.do(ctx, http.MethodPut, path+"/state", statePut{Action: "stop", Force: true}, nil); err != nil {
+			return err
+		}
+	}
+	return lp.client.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// NodePause freezes all processes of the LXD instance representing the provided topology.Node.
+func (lp *LXDProvider) NodePause(ctx context.Context, node topology.Node) error {
+	name := instanceName(node)
+	state, err := lp.state(ctx, node)
+	if err != nil {
+		return err
+	}
+	if state.Status == statusFrozen {
+		lp.log.With(node.Name).Skipped("already paused lxd instance " + name)
+		return nil
+	}
+	if err := lp.setState(ctx, node, statePut{Action: "freeze"}); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("paused lxd instance " + name)
+	return nil
+}
+
+// NodeUnpause resumes all processes of the LXD instance representing the provided topology.Node.
+func (lp *LXDProvider) NodeUnpause(ctx context.Context, node topology.Node) error {
+	name := instanceName(node)
+	state, err := lp.state(ctx, node)
+	if err != nil {
+		return err
+	}
+	if state.Status != statusFrozen {
+		lp.log.With(node.Name).Skipped("already resumed lxd instance " + name)
+		return nil
+	}
+	if err := lp.setState(ctx, node, statePut{Action: "unfreeze"}); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("resumed lxd instance " + name)
+	return nil
+}
+
+// NodeStop shuts down the LXD instance representing the provided topology.Node without removing it,
+// which takes down the interfaces of the node as if it was powered off.
+func (lp *LXDProvider) NodeStop(ctx context.Context, node topology.Node) error {
+	name := instanceName(node)
+	state, err := lp.state(ctx, node)
+	if err != nil {
+		return err
+	}
+	if state.Status != statusRunning && state.Status != statusFrozen {
+		lp.log.With(node.Name).Skipped("already stopped lxd instance " + name)
+		return nil
+	}
+	if err := lp.setState(ctx, node, statePut{Action: "stop", Timeout: stopTimeout(node)}); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("stopped lxd instance " + name)
+	return nil
+}
+
+// NodeStart starts the stopped LXD instance representing the provided topology.Node
+// and waits for it to become ready.
+func (lp *LXDProvider) NodeStart(ctx context.Context, node topology.Node) error {
+	name := instanceName(node)
+	state, err := lp.state(ctx, node)
+	if err != nil {
+		return err
+	}
+	if state.Status == statusRunning || state.Status == statusFrozen {
+		lp.log.With(node.Name).Skipped("already started lxd instance " + name)
+		return nil
+	}
+	if err := lp.startInstance(ctx, node); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success("started lxd instance " + name)
+	return lp.waitReady(ctx, node)
+}
+
+// NodeRunning checks whether an LXD instance representing the provided topology.Node exists and is running,
+// including frozen instances.
+func (lp *LXDProvider) NodeRunning(ctx context.Context, node topology.Node) (bool, error) {
+	state, err := lp.state(ctx, node)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return state.Status == statusRunning || state.Status == statusFrozen, err
+}
+
+// NodeCommit publishes the filesystem of the LXD instance representing the provided topology.Node
+// as a local image with the reference as its alias. The instance keeps running, as it is published
+// from a temporary snapshot. Bind-mounted files are not included.
+func (lp *LXDProvider) NodeCommit(ctx context.Context, node topology.Node, ref string) error {
+	name := instanceName(node)
+	snapshots := instancePath(node) + "/snapshots"
+	if err := lp.client.do(ctx, http.MethodPost, snapshots, map[string]any{"name": commitSnapshot}, nil); err != nil {
+		return err
+	}
+	defer lp.client.do(context.WithoutCancel(ctx), http.MethodDelete, snapshots+"/"+commitSnapshot, nil, nil)
+	// the alias moves to the new image, like a tag of a committed container
+	if err := lp.client.do(ctx, http.MethodDelete, "/1.0/images/aliases/"+url.PathEscape(ref), nil, nil); err != nil && !isNotFound(err) {
+		return err
+	}
+	req := map[string]any{
+		"source":  map[string]string{"type": "snapshot", "name": name + "/" + commitSnapshot},
+		"aliases": []map[string]string{{"name": ref, "description": "golab snapshot"}},
+	}
+	var published struct {
+		Fingerprint string `json:"fingerprint"`
+	}
+	if err := lp.client.do(ctx, http.MethodPost, "/1.0/images", req, &published); err != nil {
+		return err
+	}
+	lp.log.With(node.Name).Success(fmt.Sprintf("published lxd instance %s as image %s, fingerprint=%.12s", name, ref, published.Fingerprint))
+	return nil
+}
+
+// stopTimeout returns the number of seconds the instance of the node is given to shut down when stopped.
+// LXD takes whole seconds, so fractions are rounded up.
+func stopTimeout(node topology.Node) int {
+	timeout := defaultStopTimeout
+	if node.StopTimeout != "" {
+		// the timeout is validated along with the topology
+		timeout, _ = time.ParseDuration(node.StopTimeout)
+	}
+	return int((timeout + time.Second - 1) / time.Second)
+}
+
+// NodeExec runs a command inside the LXD instance representing the provided topology.Node
+// and returns the exit code of the command. The output is written once the command exits.
+func (lp *LXDProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	var result execResult
+	req := execPost{Command: cmd, RecordOutput: true}
+	if err := lp.client.do(ctx, http.MethodPost, instancePath(node)+"/exec", req, &result); err != nil {
+		return 0, err
+	}
+	// output logs are keyed by file descriptors
+	for fd, w := range []io.Writer{1: stdout, 2: stderr} {
+		path, ok := result.Output[strconv.Itoa(fd)]
+		if !ok {
+			continue
+		}
+		data, err := lp.client.raw(ctx, path)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return 0, err
+		}
+		lp.client.do(ctx, http.MethodDelete, path, nil, nil)
+	}
+	return result.Return, nil
+}
+
+// NodeShell is not supported, as LXD attaches terminals over websockets, which the provider does not speak.
+// Run "lxc exec INSTANCE -- COMMAND" instead.
+func (lp *LXDProvider) NodeShell(_ context.Context, node topology.Node, _ []string, _ topology.TTY) (int, error) {
+	return 0, fmt.Errorf("interactive shells are not supported by the lxd provider, run: lxc exec %s -- bash", instanceName(node))
+}
+
+// NodeLogs writes the console log of the LXD instance representing the provided topology.Node, where its
+// init system reports the boot. Only the last tail lines are written unless tail is negative, and new
+// output is polled until the context is canceled if follow is set.
+func (lp *LXDProvider) NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, _ io.Writer) error {
+	path := instancePath(node) + "/console"
+	data, err := lp.client.raw(ctx, path)
+	if err != nil {
+		return err
+	}
+	written := len(data)
+	if tail >= 0 {
+		lines := slices.Collect(strings.Lines(string(data)))
+		data = []byte(strings.Join(lines[len(lines)-min(tail, len(lines)):], ""))
+	}
+	if _, err := stdout.Write(data); err != nil {
+		return err
+	}
+	for follow {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(readyInterval):
+		}
+		data, err := lp.client.raw(ctx, path)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if len(data) > written {
+			if _, err := stdout.Write(data[written:]); err != nil {
+				return err
+			}
+			written = len(data)
+		}
+	}
+	return nil
+}
+
+// NodeStats collects resource usage of the LXD instance representing the provided topology.Node.
+// CPU usage is the share of a single CPU the instance used between two samples of its state.
+func (lp *LXDProvider) NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error) {
+	before, err := lp.state(ctx, node)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return topology.NodeStats{}, ctx.Err()
+	case <-time.After(statsInterval):
+	}
+	state, err := lp.state(ctx, node)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	nodeStats := topology.NodeStats{
+		MemUsage: state.Memory.Usage,
+		MemLimit: state.Memory.Total,
+	}
+	if cpuDelta := state.CPU.Usage - before.CPU.Usage; cpuDelta > 0 {
+		nodeStats.CPUPercent = float64(cpuDelta) / float64(time.Since(start).Nanoseconds()) * 100
+	}
+	for _, name := range slices.Sorted(maps.Keys(state.Network)) {
+		if name == "lo" {
+			continue
+		}
+		counters := state.Network[name].Counters
+		nodeStats.RxBytes += counters.BytesReceived
+		nodeStats.TxBytes += counters.BytesSent
+		nodeStats.RxPackets += counters.PacketsReceived
+		nodeStats.TxPackets += counters.PacketsSent
+		nodeStats.Interfaces = append(nodeStats.Interfaces, topology.InterfaceStats{
+			Name:      name,
+			RxBytes:   counters.BytesReceived,
+			TxBytes:   counters.BytesSent,
+			RxPackets: counters.PacketsReceived,
+			TxPackets: counters.PacketsSent,
+			RxErrors:  counters.ErrorsReceived,
+			TxErrors:  counters.ErrorsSent,
+			RxDropped: counters.PacketsDroppedInbound,
+			TxDropped: counters.PacketsDroppedOutbound,
+		})
+	}
+	return nodeStats, nil
+}
+
+// labObjects lists the LXD instances and networks golab created for the provided lab, or for any lab if it is empty.
+func (lp *LXDProvider) labObjects(ctx context.Context, lab string) ([]instance, []lxdNetwork, error) {
+	var insts []instance
+	if err := lp.client.do(ctx, http.MethodGet, "/1.0/instances?recursion=1", nil, &insts); err != nil {
+		return nil, nil, err
+	}
+	var nets []lxdNetwork
+	if err := lp.client.do(ctx, http.MethodGet, "/1.0/networks?recursion=1", nil, &nets); err != nil {
+		return nil, nil, err
+	}
+	foreign := func(config map[string]string) bool {
+		return config[managedKey] != "true" || lab != "" && config[labKey] != lab
+	}
+	insts = slices.DeleteFunc(insts, func(inst instance) bool { return foreign(inst.Config) })
+	nets = slices.DeleteFunc(nets, func(net lxdNetwork) bool { return foreign(net.Config) })
+	return insts, nets, nil
+}
+
+// RemoveOrphans removes all instances and networks golab created for the provided lab, or for any lab
+// if it is empty. Unlike Wreck, it does not depend on the topology file, which may have changed since.
+func (lp *LXDProvider) RemoveOrphans(ctx context.Context, lab string) error {
+	insts, nets, err := lp.labObjects(ctx, lab)
+	if err != nil {
+		return err
+	}
+	for _, inst := range insts {
+		if err := lp.forceRemove(ctx, inst.Name); err != nil {
+			return err
+		}
+		lp.log.With(inst.Name).Success(fmt.Sprintf("removed lxd instance %s of lab %s", inst.Name, inst.Config[labKey]))
+	}
+	for _, net := range nets {
+		if err := lp.client.do(ctx, http.MethodDelete, "/1.0/networks/"+url.PathEscape(net.Name), nil, nil); err != nil {
+			return err
+		}
+		lp.log.With(net.Name).Success(fmt.Sprintf("removed lxd network %s of lab %s", net.Name, net.Config[labKey]))
+	}
+	if len(insts) == 0 && len(nets) == 0 {
+		lp.log.Skipped("found no leftover lxd objects")
+	}
+	return nil
+}
+
+// Deployed reports instances and networks golab created for the provided lab, translated back into
+// topology entities with the attributes they were created with.
+func (lp *LXDProvider) Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	insts, nets, err := lp.labObjects(ctx, lab)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes := make([]topology.Node, 0, len(insts))
+	for _, inst := range insts {
+		node := topology.Node{Name: inst.Config[nameKey], Image: inst.Config[imageKey], Labels: unmanaged(inst.Config)}
+		if err := json.Unmarshal([]byte(cmp.Or(inst.Config[interfacesKey], "null")), &node.Interfaces); err != nil {
+			return nil, nil, fmt.Errorf("lxd instance %s has malformed %s: %w", inst.Name, interfacesKey, err)
+		}
+		nodes = append(nodes, node)
+	}
+	links := make([]topology.Link, 0, len(nets))
+	for _, net := range nets {
+		link := topology.Link{
+			Name:       net.Config[nameKey],
+			IPv4Subnet: net.Config[ipv4SubnetKey],
+			IPv6Subnet: net.Config[ipv6SubnetKey],
+			Labels:     unmanaged(net.Config),
+		}
+		link.MTU, _ = strconv.Atoi(net.Config[mtuKey])
+		links = append(links, link)
+	}
+	return nodes, links, nil
+}
@@ -0,0 +1,702 @@
+package lxd_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/lxd"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeLXD serves the subset of the LXD API used by the provider, running background operations synchronously.
+type fakeLXD struct {
+	mu        sync.Mutex
+	networks  map[string]map[string]any
+	instances map[string]map[string]any
+	// execs records commands run in instances, while output maps commands to their stdout
+	execs   []string
+	output  map[string]string
+	console string
+	ops     map[string]any
+	logs    map[string]string
+	// stopTimeouts records the timeouts of stop actions
+	stopTimeouts []float64
+}
+
+// newFakeLXD starts a fake LXD daemon and returns it along with a provider talking to it.
+func newFakeLXD(t *testing.T) (*fakeLXD, *lxd.LXDProvider) {
+	t.Helper()
+	f := &fakeLXD{
+		networks:  make(map[string]map[string]any),
+		instances: make(map[string]map[string]any),
+		output:    make(map[string]string),
+		ops:       make(map[string]any),
+		logs:      make(map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /1.0/networks", f.listNetworks)
+	mux.HandleFunc("POST /1.0/networks", f.createNetwork)
+	mux.HandleFunc("GET /1.0/networks/{name}", f.getNetwork)
+	mux.HandleFunc("DELETE /1.0/networks/{name}", f.deleteNetwork)
+	mux.HandleFunc("GET /1.0/instances", f.listInstances)
+	mux.HandleFunc("POST /1.0/instances", f.createInstance)
+	mux.HandleFunc("GET /1.0/instances/{name}", f.getInstance)
+	mux.HandleFunc("PUT /1.0/instances/{name}", f.updateInstance)
+	mux.HandleFunc("DELETE /1.0/instances/{name}", f.deleteInstance)
+	mux.HandleFunc("GET /1.0/instances/{name}/state", f.getState)
+	mux.HandleFunc("PUT /1.0/instances/{name}/state", f.setState)
+	mux.HandleFunc("POST /1.0/instances/{name}/exec", f.exec)
+	mux.HandleFunc("GET /1.0/instances/{name}/console", f.getConsole)
+	mux.HandleFunc("GET /1.0/instances/{name}/logs/{file}", f.getLog)
+	mux.HandleFunc("DELETE /1.0/instances/{name}/logs/{file}", f.deleteLog)
+	mux.HandleFunc("GET /1.0/operations/{id}/wait", f.wait)
+	socket := filepath.Join(t.TempDir(), "lxd.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	lp := lxd.New(socket, logger.New(io.Discard, io.Discard))
+	t.Cleanup(func() { lp.Close() })
+	return f, lp
+}
+
+func reply(w http.ResponseWriter, metadata any) {
+	json.NewEncoder(w).Encode(map[string]any{"type": "sync", "status_code": 200, "metadata": metadata})
+}
+
+func fail(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"type": "error", "error_code": code, "error": msg})
+}
+
+// async replies with a finished background operation with the metadata.
+func (f *fakeLXD) async(w http.ResponseWriter, metadata any) {
+	id := fmt.Sprint(len(f.ops))
+	f.ops[id] = metadata
+	json.NewEncoder(w).Encode(map[string]any{"type": "async", "status_code": 100, "operation": "/1.0/operations/" + id})
+}
+
+func (f *fakeLXD) wait(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply(w, map[string]any{"status": "Success", "status_code": 200, "metadata": f.ops[r.PathValue("id")]})
+}
+
+func decode(r *http.Request) map[string]any {
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	return body
+}
+
+func (f *fakeLXD) listNetworks(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply(w, slices.Collect(maps.Values(f.networks)))
+}
+
+func (f *fakeLXD) createNetwork(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body := decode(r)
+	f.networks[body["name"].(string)] = body
+	reply(w, nil)
+}
+
+func (f *fakeLXD) getNetwork(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	net, ok := f.networks[r.PathValue("name")]
+	if !ok {
+		fail(w, http.StatusNotFound, "Network not found")
+		return
+	}
+	reply(w, net)
+}
+
+func (f *fakeLXD) deleteNetwork(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.networks, r.PathValue("name"))
+	reply(w, nil)
+}
+
+func (f *fakeLXD) listInstances(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply(w, slices.Collect(maps.Values(f.instances)))
+}
+
+func (f *fakeLXD) createInstance(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body := decode(r)
+	body["status"] = "Stopped"
+	f.instances[body["name"].(string)] = body
+	f.async(w, nil)
+}
+
+// instance returns the instance named in the request path or replies with an error if there is none.
+func (f *fakeLXD) instance(w http.ResponseWriter, r *http.Request) map[string]any {
+	inst, ok := f.instances[r.PathValue("name")]
+	if !ok {
+		fail(w, http.StatusNotFound, "Instance not found")
+	}
+	return inst
+}
+
+func (f *fakeLXD) getInstance(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if inst := f.instance(w, r); inst != nil {
+		reply(w, inst)
+	}
+}
+
+func (f *fakeLXD) updateInstance(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if inst := f.instance(w, r); inst != nil {
+		body := decode(r)
+		inst["config"], inst["devices"] = body["config"], body["devices"]
+		f.async(w, nil)
+	}
+}
+
+func (f *fakeLXD) deleteInstance(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if inst := f.instance(w, r); inst != nil {
+		if inst["status"] != "Stopped" {
+			fail(w, http.StatusBadRequest, "Instance is running")
+			return
+		}
+		delete(f.instances, r.PathValue("name"))
+		f.async(w, nil)
+	}
+}
+
+func (f *fakeLXD) getState(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if inst := f.instance(w, r); inst != nil {
+		reply(w, map[string]any{
+			"status": inst["status"],
+			"cpu":    map[string]any{"usage": 0},
+			"memory": map[string]any{"usage": 1 << 20, "total": 1 << 30},
+			"network": map[string]any{
+				"lo":   map[string]any{"counters": map[string]any{"bytes_received": 1000}},
+				"eth1": map[string]any{"counters": map[string]any{"bytes_received": 100, "bytes_sent": 200, "packets_received": 1, "packets_sent": 2, "errors_received": 3}},
+			},
+		})
+	}
+}
+
+func (f *fakeLXD) setState(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if inst := f.instance(w, r); inst != nil {
+		body := decode(r)
+		if body["action"] == "stop" {
+			timeout, _ := body["timeout"].(float64)
+			f.stopTimeouts = append(f.stopTimeouts, timeout)
+		}
+		inst["status"] = map[string]string{
+			"start":    "Running",
+			"stop":     "Stopped",
+			"freeze":   "Frozen",
+			"unfreeze": "Running",
+		}[body["action"].(string)]
+		f.async(w, nil)
+	}
+}
+
+func (f *fakeLXD) exec(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if inst := f.instance(w, r); inst != nil {
+		var args []string
+		for _, arg := range decode(r)["command"].([]any) {
+			args = append(args, arg.(string))
+		}
+		cmd := strings.Join(args, " ")
+		f.execs = append(f.execs, r.PathValue("name")+": "+cmd)
+		path := "/1.0/instances/" + r.PathValue("name") + "/logs/exec_" + fmt.Sprint(len(f.execs))
+		f.logs[path+".stdout"] = f.output[cmd]
+		f.logs[path+".stderr"] = ""
+		f.async(w, map[string]any{"return": 0, "output": map[string]string{"1": path + ".stdout", "2": path + ".stderr"}})
+	}
+}
+
+func (f *fakeLXD) getConsole(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	io.WriteString(w, f.console)
+}
+
+func (f *fakeLXD) getLog(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	io.WriteString(w, f.logs[r.URL.Path])
+}
+
+func (f *fakeLXD) deleteLog(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.logs, r.URL.Path)
+	reply(w, nil)
+}
+
+var testLabels = map[string]string{topology.LabLabel: "lab1"}
+
+var testNode = topology.Node{
+	Name:   "R1",
+	Image:  "images:debian/12",
+	Labels: testLabels,
+	Interfaces: []*topology.Interface{
+		{Name: "eth1", Link: "golab-link-01", IPv4Addr: "100.64.1.1/29", IPv6Addr: "2001:db8:64:1::1/64"},
+		{Name: "eth1.100", Link: "golab-link-02", VLAN: 100, IPv4Addr: "100.64.2.1/29"},
+	},
+	Mgmt:    &topology.Interface{Name: "mgmt0", Link: "golab-mgmt", IPv4Addr: "192.168.255.1/24"},
+	Sysctls: map[string]string{"net.ipv4.ip_forward": "1"},
+	Env:     map[string]string{"FOO": "bar"},
+	Binds:   []string{"/tmp/r1:/etc/frr:ro"},
+	Ports:   []string{"2201:22"},
+	Memory:  "512m",
+	CPUs:    1.5,
+}
+
+func TestLinkCreate(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	link := topology.Link{
+		Name:        "golab-link-01",
+		IPv4Subnet:  "100.64.1.0/29",
+		IPv4Gateway: "100.64.1.6",
+		MTU:         9000,
+		Labels:      testLabels,
+	}
+	ctx := context.Background()
+	if err := lp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	// creating the link again is a no-op
+	if err := lp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"name":        "gl-lab1-link-01",
+		"type":        "bridge",
+		"description": "golab link golab-link-01",
+		"config": map[string]any{
+			"user.label.golab.lab":   "lab1",
+			"user.golab.managed":     "true",
+			"user.golab.name":        "golab-link-01",
+			"user.golab.ipv4_subnet": "100.64.1.0/29",
+			"user.golab.ipv6_subnet": "",
+			"ipv4.address":           "100.64.1.6/29",
+			"ipv6.address":           "none",
+			"ipv4.dhcp":              "false",
+			"ipv6.dhcp":              "false",
+			"ipv4.nat":               "false",
+			"ipv6.nat":               "false",
+			"bridge.mtu":             "9000",
+		},
+	}
+	if diff := cmp.Diff(map[string]map[string]any{"gl-lab1-link-01": want}, f.networks); diff != "" {
+		t.Errorf("networks mismatch (-want +got):\n%s", diff)
+	}
+	if err := lp.LinkRemove(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.networks) != 0 {
+		t.Errorf("want no networks, got %v", f.networks)
+	}
+}
+
+func TestLinkCreateVeth(t *testing.T) {
+	t.Parallel()
+	_, lp := newFakeLXD(t)
+	wantErr := "link golab-link-01: veth links are not supported by the lxd provider"
+	err := lp.LinkCreate(context.Background(), topology.Link{Name: "golab-link-01", Type: topology.LinkTypeVeth})
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestLinkCreateDriverOpts(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name       string
+		link       topology.Link
+		wantConfig map[string]any
+		wantErr    string
+	}{
+		{
+			name: "Bridge",
+			link: topology.Link{Name: "golab-link-01", DriverOpts: map[string]string{
+				"com.docker.network.driver.mtu":                  "9000",
+				"com.docker.network.bridge.enable_ip_masquerade": "true",
+			}},
+			wantConfig: map[string]any{"bridge.mtu": "9000", "ipv4.nat": "true", "ipv6.nat": "true"},
+		},
+		{
+			name: "Macvlan",
+			link: topology.Link{Name: "golab-link-01", HostInterface: "enp3s0", DriverOpts: map[string]string{
+				"com.docker.network.driver.mtu": "1400",
+			}},
+			wantConfig: map[string]any{"parent": "enp3s0", "mtu": "1400"},
+		},
+		{
+			name: "Unsupported",
+			link: topology.Link{Name: "golab-link-01", DriverOpts: map[string]string{
+				"com.docker.network.bridge.enable_icc": "false",
+			}},
+			wantErr: "link golab-link-01: driver option com.docker.network.bridge.enable_icc is not supported by the lxd provider",
+		},
+		{
+			name: "MacvlanMasquerade",
+			link: topology.Link{Name: "golab-link-01", HostInterface: "enp3s0", DriverOpts: map[string]string{
+				"com.docker.network.bridge.enable_ip_masquerade": "true",
+			}},
+			wantErr: "link golab-link-01: driver option com.docker.network.bridge.enable_ip_masquerade is not supported by the lxd provider",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f, lp := newFakeLXD(t)
+			tc.link.Labels = testLabels
+			err := lp.LinkCreate(context.Background(), tc.link)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("error: want %q, got %v", tc.wantErr, err)
+				}
+				if len(f.networks) != 0 {
+					t.Errorf("want no networks, got %v", f.networks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := f.networks["gl-lab1-link-01"]["config"].(map[string]any)
+			for key, want := range tc.wantConfig {
+				if config[key] != want {
+					t.Errorf("config %s: want %q, got %v", key, want, config[key])
+				}
+			}
+		})
+	}
+}
+
+func TestLinkRemoveForeign(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	f.networks["gl-lab1-link-01"] = map[string]any{"name": "gl-lab1-link-01", "config": map[string]any{}}
+	wantErr := "refusing to remove lxd network gl-lab1-link-01, which golab did not create for this lab"
+	err := lp.LinkRemove(context.Background(), topology.Link{Name: "golab-link-01", Labels: testLabels})
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestNodeCreate(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	ctx := context.Background()
+	if err := lp.NodeCreate(ctx, testNode); err != nil {
+		t.Fatal(err)
+	}
+	inst := f.instances["lab1-R1"]
+	if inst["status"] != "Running" {
+		t.Errorf("status: want Running, got %v", inst["status"])
+	}
+	wantSource := map[string]any{"type": "image", "alias": "debian/12", "server": "https://images.lxd.canonical.com", "protocol": "simplestreams", "mode": "pull"}
+	if diff := cmp.Diff(wantSource, inst["source"]); diff != "" {
+		t.Errorf("source mismatch (-want +got):\n%s", diff)
+	}
+	wantDevices := map[string]any{
+		"eth0":  map[string]any{"type": "none"},
+		"eth1":  map[string]any{"type": "nic", "network": "gl-lab1-link-01", "name": "eth1"},
+		"mgmt0": map[string]any{"type": "nic", "network": "gl-lab1-mgmt", "name": "mgmt0"},
+		"bind0": map[string]any{"type": "disk", "source": "/tmp/r1", "path": "/etc/frr", "readonly": "true"},
+		"port0": map[string]any{"type": "proxy", "listen": "tcp:0.0.0.0:2201", "connect": "tcp:127.0.0.1:22"},
+	}
+	if diff := cmp.Diff(wantDevices, inst["devices"]); diff != "" {
+		t.Errorf("devices mismatch (-want +got):\n%s", diff)
+	}
+	config := inst["config"].(map[string]any)
+	for key, want := range map[string]string{
+		"user.golab.image":                 "images:debian/12",
+		"limits.cpu.allowance":             "150ms/100ms",
+		"limits.memory":                    "536870912",
+		"linux.sysctl.net.ipv4.ip_forward": "1",
+		"environment.FOO":                  "bar",
+	} {
+		if config[key] != want {
+			t.Errorf("config %s: want %q, got %v", key, want, config[key])
+		}
+	}
+	wantExecs := []string{
+		"lab1-R1: ip link set eth1 up",
+		"lab1-R1: ip -4 addr replace 100.64.1.1/29 dev eth1",
+		"lab1-R1: ip -6 addr replace 2001:db8:64:1::1/64 dev eth1",
+		"lab1-R1: ip link set mgmt0 up",
+		"lab1-R1: ip -4 addr replace 192.168.255.1/24 dev mgmt0",
+	}
+	if diff := cmp.Diff(wantExecs, f.execs); diff != "" {
+		t.Errorf("execs mismatch (-want +got):\n%s", diff)
+	}
+	if len(f.logs) != 0 {
+		t.Errorf("want exec logs removed, got %v", f.logs)
+	}
+}
+
+func TestNodeCreateUnsupported(t *testing.T) {
+	t.Parallel()
+	_, lp := newFakeLXD(t)
+	node := topology.Node{Name: "R1", Tmpfs: []string{"/run"}}
+	wantErr := "node R1: volumes and tmpfs mounts are not supported by the lxd provider"
+	if err := lp.NodeCreate(context.Background(), node); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestNodeCreateEndpointOpts(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	ctx := context.Background()
+	node := topology.Node{
+		Name:   "R1",
+		Image:  "images:debian/12",
+		Labels: testLabels,
+		Interfaces: []*topology.Interface{{
+			Name:     "eth1",
+			Link:     "golab-link-01",
+			IPv4Addr: "100.64.1.1/29",
+			DriverOpts: map[string]string{
+				"com.docker.network.endpoint.ifname":  "eth1",
+				"com.docker.network.endpoint.sysctls": "net.mpls.conf.IFNAME.input=1,net.ipv4.conf.IFNAME.rp_filter=0",
+			},
+		}},
+	}
+	if err := lp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	wantExecs := []string{
+		"lab1-R1: sysctl -w net.mpls.conf.eth1.input=1",
+		"lab1-R1: sysctl -w net.ipv4.conf.eth1.rp_filter=0",
+		"lab1-R1: ip link set eth1 up",
+		"lab1-R1: ip -4 addr replace 100.64.1.1/29 dev eth1",
+	}
+	if diff := cmp.Diff(wantExecs, f.execs); diff != "" {
+		t.Errorf("execs mismatch (-want +got):\n%s", diff)
+	}
+	node.Name = "R2"
+	node.Interfaces[0].DriverOpts = map[string]string{"com.docker.network.endpoint.macaddress": "02:42:ac:11:00:02"}
+	wantErr := "node R2: endpoint option com.docker.network.endpoint.macaddress on link golab-link-01 is not supported by the lxd provider"
+	if err := lp.NodeCreate(ctx, node); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+	if _, ok := f.instances["lab1-R2"]; ok {
+		t.Error("want no instance created for node R2")
+	}
+}
+
+func TestNodeLifecycle(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	ctx := context.Background()
+	node := testNode
+	node.StopTimeout = "1.5s"
+	if err := lp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name       string
+		action     func(context.Context, topology.Node) error
+		wantStatus string
+	}{
+		{name: "Pause", action: lp.NodePause, wantStatus: "Frozen"},
+		{name: "Unpause", action: lp.NodeUnpause, wantStatus: "Running"},
+		{name: "Stop", action: lp.NodeStop, wantStatus: "Stopped"},
+		{name: "Start", action: lp.NodeStart, wantStatus: "Running"},
+	}
+	for _, step := range steps {
+		if err := step.action(ctx, node); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := f.instances["lab1-R1"]["status"]; got != step.wantStatus {
+			t.Errorf("%s: want status %s, got %v", step.name, step.wantStatus, got)
+		}
+	}
+	running, err := lp.NodeRunning(ctx, node)
+	if err != nil || !running {
+		t.Errorf("running: want true, got %v (%v)", running, err)
+	}
+	if err := lp.NodeRemove(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.instances) != 0 {
+		t.Errorf("want no instances, got %v", f.instances)
+	}
+	// fractions of a second are rounded up
+	if diff := cmp.Diff([]float64{2, 2}, f.stopTimeouts); diff != "" {
+		t.Errorf("stop timeouts mismatch (-want +got):\n%s", diff)
+	}
+	running, err = lp.NodeRunning(ctx, node)
+	if err != nil || running {
+		t.Errorf("running: want false, got %v (%v)", running, err)
+	}
+}
+
+func TestNodeExec(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	ctx := context.Background()
+	if err := lp.NodeCreate(ctx, testNode); err != nil {
+		t.Fatal(err)
+	}
+	f.output["vtysh -c show version"] = "FRRouting 10.1\n"
+	var stdout bytes.Buffer
+	exitCode, err := lp.NodeExec(ctx, testNode, []string{"vtysh", "-c", "show version"}, &stdout, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 0 || stdout.String() != "FRRouting 10.1\n" {
+		t.Errorf("want exit code 0 with output %q, got %d with %q", "FRRouting 10.1\n", exitCode, stdout.String())
+	}
+}
+
+func TestNodeLogs(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	f.console = "booting\nstarting frr\nready\n"
+	var stdout bytes.Buffer
+	if err := lp.NodeLogs(context.Background(), testNode, false, 2, &stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if want := "starting frr\nready\n"; stdout.String() != want {
+		t.Errorf("logs: want %q, got %q", want, stdout.String())
+	}
+}
+
+func TestNodeStats(t *testing.T) {
+	t.Parallel()
+	_, lp := newFakeLXD(t)
+	ctx := context.Background()
+	if err := lp.NodeCreate(ctx, testNode); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := lp.NodeStats(ctx, testNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := topology.NodeStats{
+		MemUsage:  1 << 20,
+		MemLimit:  1 << 30,
+		RxBytes:   100,
+		TxBytes:   200,
+		RxPackets: 1,
+		TxPackets: 2,
+		Interfaces: []topology.InterfaceStats{
+			{Name: "eth1", RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2, RxErrors: 3},
+		},
+	}
+	if diff := cmp.Diff(want, stats); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkConnect(t *testing.T) {
+	t.Parallel()
+	f, lp := newFakeLXD(t)
+	ctx := context.Background()
+	node := testNode
+	node.Interfaces = nil
+	if err := lp.NodeCreate(ctx, node); err != nil {
+		t.Fatal(err)
+	}
+	link := topology.Link{Name: "golab-link-01", Labels: testLabels}
+	devices := func() any { return f.instances["lab1-R1"]["devices"].(map[string]any)["eth1"] }
+	if err := lp.LinkConnect(ctx, link, []topology.Node{testNode}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"type": "nic", "network": "gl-lab1-link-01", "name": "eth1"}
+	if diff := cmp.Diff(want, devices()); diff != "" {
+		t.Errorf("device mismatch (-want +got):\n%s", diff)
+	}
+	if !slices.Contains(f.execs, "lab1-R1: ip -4 addr replace 100.64.1.1/29 dev eth1") {
+		t.Errorf("want address of eth1 configured, got execs %v", f.execs)
+	}
+	if err := lp.LinkDisconnect(ctx, link, []topology.Node{testNode}); err != nil {
+		t.Fatal(err)
+	}
+	if got := devices(); got != nil {
+		t.Errorf("want eth1 removed, got %v", got)
+	}
+}
+
+func TestDeployed(t *testing.T) {
+	t.Parallel()
+	_, lp := newFakeLXD(t)
+	ctx := context.Background()
+	link := topology.Link{Name: "golab-link-01", IPv4Subnet: "100.64.1.0/29", MTU: 1500, Labels: testLabels}
+	if err := lp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.NodeCreate(ctx, testNode); err != nil {
+		t.Fatal(err)
+	}
+	nodes, links, err := lp.Deployed(ctx, "lab1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNodes := []topology.Node{{
+		Name:       "R1",
+		Image:      "images:debian/12",
+		Labels:     testLabels,
+		Interfaces: []*topology.Interface{testNode.Interfaces[0], testNode.Mgmt},
+	}}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("nodes mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]topology.Link{link}, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	if err := lp.RemoveOrphans(ctx, "lab1"); err != nil {
+		t.Fatal(err)
+	}
+	nodes, links, err = lp.Deployed(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 0 || len(links) != 0 {
+		t.Errorf("want no leftovers, got nodes %v and links %v", nodes, links)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	t.Setenv("LXD_SOCKET", "/tmp/lxd.sock")
+	if got := lxd.Socket(); got != "/tmp/lxd.sock" {
+		t.Errorf("want /tmp/lxd.sock, got %s", got)
+	}
+}
@@ -0,0 +1,308 @@
+// Package multihost provides a provider which spreads a lab over several hosts, each driven by a provider of
+// its own. Nodes are deployed to the provider of the host they are placed on, while links are created on every
+// host they attach nodes on and stitched into a single segment by VXLAN tunnels between the hosts.
+package multihost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+)
+
+// HostProvider represents the provider of a single host and its methods, which the Docker provider implements.
+type HostProvider interface {
+	orchestrator.PlanProvider
+	orchestrator.DashboardProvider
+	orchestrator.SnapshotProvider
+	RemoveOrphans(ctx context.Context, lab string) error
+	Stitch(ctx context.Context, link topology.Link, local string, remotes []string) error
+	Unstitch(ctx context.Context, link topology.Link) error
+}
+
+// MultiHostProvider stores the hosts of a lab along with their providers.
+type MultiHostProvider struct {
+	hosts     map[string]*topology.Host
+	providers map[string]HostProvider
+}
+
+// New returns an instance of a MultiHostProvider deploying to the hosts with the providers of the same names.
+func New(hosts map[string]*topology.Host, providers map[string]HostProvider) *MultiHostProvider {
+	return &MultiHostProvider{hosts: hosts, providers: providers}
+}
+
+// provider returns the provider of the host, or an error if there is none.
+func (mp *MultiHostProvider) provider(host string) (HostProvider, error) {
+	if provider, ok := mp.providers[host]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("host %q does not have a provider", host)
+}
+
+// nodeProvider returns the provider of the host the node is placed on.
+func (mp *MultiHostProvider) nodeProvider(node topology.Node) (HostProvider, error) {
+	provider, err := mp.provider(node.Host)
+	if err != nil {
+		return nil, fmt.Errorf("node %s: %w", node.Name, err)
+	}
+	return provider, nil
+}
+
+// linkHosts returns the hosts the link attaches nodes on, or the first host for links without nodes.
+func (mp *MultiHostProvider) linkHosts(link topology.Link) []string {
+	if len(link.Hosts) != 0 {
+		return link.Hosts
+	}
+	return slices.Sorted(maps.Keys(mp.providers))[:1]
+}
+
+// LinkCreate creates the link on every host it attaches nodes on and, if it has a tunnel, stitches the
+// networks on those hosts together by flooding frames from the VTEP of each host to the VTEPs of the others.
+// The gateway of a stitched link is held by the bridge on the first host only, since the same address on
+// the bridges of several hosts would answer on a single segment.
+func (mp *MultiHostProvider) LinkCreate(ctx context.Context, link topology.Link) error {
+	hosts := mp.linkHosts(link)
+	for i, host := range hosts {
+		provider, err := mp.provider(host)
+		if err != nil {
+			return err
+		}
+		hostLink := link
+		if link.Tunnel != nil && i > 0 {
+			hostLink.NoGateway = true
+		}
+		if err := provider.LinkCreate(ctx, hostLink); err != nil {
+			return err
+		}
+	}
+	if link.Tunnel == nil {
+		return nil
+	}
+	for _, host := range hosts {
+		var remotes []string
+		for _, remote := range hosts {
+			if remote != host {
+				remotes = append(remotes, mp.hosts[remote].VTEP)
+			}
+		}
+		if err := mp.providers[host].Stitch(ctx, link, mp.hosts[host].VTEP, remotes); err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// LinkRemove removes the tunnel of the link, if any, and the link from every host it attaches nodes on.
+func (mp *MultiHostProvider) LinkRemove(ctx context.Context, link topology.Link) error {
+	var errs []error
+	for _, host := range mp.linkHosts(link) {
+		provider, err := mp.provider(host)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := provider.Unstitch(ctx, link); err != nil {
+			errs = append(errs, fmt.Errorf("host %s: %w", host, err))
+		}
+		if err := provider.LinkRemove(ctx, link); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// groupByHost splits the nodes by the hosts they are placed on, keeping their order.
+func groupByHost(nodes []topology.Node) ([]string, map[string][]topology.Node) {
+	var hosts []string
+	groups := make(map[string][]topology.Node)
+	for _, node := range nodes {
+		if _, ok := groups[node.Host]; !ok {
+			hosts = append(hosts, node.Host)
+		}
+		groups[node.Host] = append(groups[node.Host], node)
+	}
+	return hosts, groups
+}
+
+// LinkConnect attaches the nodes to the link by the providers of the hosts they are placed on.
+func (mp *MultiHostProvider) LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	hosts, groups := groupByHost(nodes)
+	for _, host := range hosts {
+		provider, err := mp.provider(host)
+		if err != nil {
+			return err
+		}
+		if err := provider.LinkConnect(ctx, link, groups[host]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LinkDisconnect detaches the nodes from the link by the providers of the hosts they are placed on.
+func (mp *MultiHostProvider) LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	hosts, groups := groupByHost(nodes)
+	for _, host := range hosts {
+		provider, err := mp.provider(host)
+		if err != nil {
+			return err
+		}
+		if err := provider.LinkDisconnect(ctx, link, groups[host]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NodeCreate creates the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeCreate(ctx context.Context, node topology.Node) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodeCreate(ctx, node)
+}
+
+// NodeRemove removes the node from the host it is placed on.
+func (mp *MultiHostProvider) NodeRemove(ctx context.Context, node topology.Node) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodeRemove(ctx, node)
+}
+
+// NodeExec executes the command on the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return 0, err
+	}
+	return provider.NodeExec(ctx, node, cmd, stdout, stderr)
+}
+
+// NodeStats reports resource usage of the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error) {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return topology.NodeStats{}, err
+	}
+	return provider.NodeStats(ctx, node)
+}
+
+// NodeLogs writes logs of the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, stderr io.Writer) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodeLogs(ctx, node, follow, tail, stdout, stderr)
+}
+
+// NodeShell attaches the terminal to the command on the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeShell(ctx context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error) {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return 0, err
+	}
+	return provider.NodeShell(ctx, node, cmd, tty)
+}
+
+// NodePause pauses the node on the host it is placed on.
+func (mp *MultiHostProvider) NodePause(ctx context.Context, node topology.Node) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodePause(ctx, node)
+}
+
+// NodeUnpause resumes the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeUnpause(ctx context.Context, node topology.Node) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodeUnpause(ctx, node)
+}
+
+// NodeStop stops the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeStop(ctx context.Context, node topology.Node) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodeStop(ctx, node)
+}
+
+// NodeStart starts the node on the host it is placed on.
+func (mp *MultiHostProvider) NodeStart(ctx context.Context, node topology.Node) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodeStart(ctx, node)
+}
+
+// NodeRunning checks whether the node is running on the host it is placed on.
+func (mp *MultiHostProvider) NodeRunning(ctx context.Context, node topology.Node) (bool, error) {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return false, err
+	}
+	return provider.NodeRunning(ctx, node)
+}
+
+// NodeCommit commits the node on the host it is placed on to an image with the reference, which
+// is stored on that host only, so restoring a snapshot requires the same placement.
+func (mp *MultiHostProvider) NodeCommit(ctx context.Context, node topology.Node, ref string) error {
+	provider, err := mp.nodeProvider(node)
+	if err != nil {
+		return err
+	}
+	return provider.NodeCommit(ctx, node, ref)
+}
+
+// Deployed reports the objects of the lab deployed to every host. Nodes are reported along with the host
+// they were found on, while links found on several hosts are reported once along with all of those hosts.
+func (mp *MultiHostProvider) Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	var nodes []topology.Node
+	var links []topology.Link
+	linkIndex := make(map[string]int)
+	for _, host := range slices.Sorted(maps.Keys(mp.providers)) {
+		hostNodes, hostLinks, err := mp.providers[host].Deployed(ctx, lab)
+		if err != nil {
+			return nil, nil, fmt.Errorf("host %s: %w", host, err)
+		}
+		for _, node := range hostNodes {
+			node.Host = host
+			nodes = append(nodes, node)
+		}
+		for _, link := range hostLinks {
+			if i, ok := linkIndex[link.Name]; ok {
+				links[i].Hosts = append(links[i].Hosts, host)
+				continue
+			}
+			link.Hosts = []string{host}
+			linkIndex[link.Name] = len(links)
+			links = append(links, link)
+		}
+	}
+	return nodes, links, nil
+}
+
+// RemoveOrphans removes the objects of the lab, or of any lab if it is empty, from every host.
+func (mp *MultiHostProvider) RemoveOrphans(ctx context.Context, lab string) error {
+	var errs []error
+	for _, host := range slices.Sorted(maps.Keys(mp.providers)) {
+		if err := mp.providers[host].RemoveOrphans(ctx, lab); err != nil {
+			errs = append(errs, fmt.Errorf("host %s: %w", host, err))
+		}
+	}
+	return errors.Join(errs...)
+}
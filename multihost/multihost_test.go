@@ -0,0 +1,199 @@
+package multihost_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/multihost"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeHostProvider records the calls made to the provider of a host into a log shared by all hosts.
+type fakeHostProvider struct {
+	multihost.HostProvider
+	host     string
+	calls    *[]string
+	nodes    []topology.Node
+	links    []topology.Link
+	stitchFn func() error
+}
+
+func (f *fakeHostProvider) record(format string, args ...any) {
+	*f.calls = append(*f.calls, f.host+": "+fmt.Sprintf(format, args...))
+}
+
+func (f *fakeHostProvider) LinkCreate(_ context.Context, link topology.Link) error {
+	if link.NoGateway {
+		f.record("create link %s without gateway", link.Name)
+		return nil
+	}
+	f.record("create link %s", link.Name)
+	return nil
+}
+
+func (f *fakeHostProvider) LinkRemove(_ context.Context, link topology.Link) error {
+	f.record("remove link %s", link.Name)
+	return nil
+}
+
+func (f *fakeHostProvider) LinkConnect(_ context.Context, link topology.Link, nodes []topology.Node) error {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	f.record("connect link %s to %s", link.Name, strings.Join(names, ","))
+	return nil
+}
+
+func (f *fakeHostProvider) NodeCreate(_ context.Context, node topology.Node) error {
+	f.record("create node %s", node.Name)
+	return nil
+}
+
+func (f *fakeHostProvider) Stitch(_ context.Context, link topology.Link, local string, remotes []string) error {
+	f.record("stitch link %s vni %d from %s to %v", link.Name, link.Tunnel.VNI, local, remotes)
+	if f.stitchFn != nil {
+		return f.stitchFn()
+	}
+	return nil
+}
+
+func (f *fakeHostProvider) Unstitch(_ context.Context, link topology.Link) error {
+	f.record("unstitch link %s", link.Name)
+	return nil
+}
+
+func (f *fakeHostProvider) Deployed(_ context.Context, _ string) ([]topology.Node, []topology.Link, error) {
+	return f.nodes, f.links, nil
+}
+
+func (f *fakeHostProvider) RemoveOrphans(_ context.Context, lab string) error {
+	f.record("remove orphans of %s", lab)
+	return nil
+}
+
+var testHosts = map[string]*topology.Host{
+	"h1": {VTEP: "192.0.2.1"},
+	"h2": {VTEP: "192.0.2.2"},
+	"h3": {VTEP: "192.0.2.3"},
+}
+
+func newTestProvider() (*multihost.MultiHostProvider, map[string]*fakeHostProvider, *[]string) {
+	calls := new([]string)
+	fakes := make(map[string]*fakeHostProvider)
+	providers := make(map[string]multihost.HostProvider)
+	for host := range testHosts {
+		fakes[host] = &fakeHostProvider{host: host, calls: calls}
+		providers[host] = fakes[host]
+	}
+	return multihost.New(testHosts, providers), fakes, calls
+}
+
+func TestLinkCreateRemove(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	mp, _, calls := newTestProvider()
+	link := topology.Link{Name: "golab-link-01", Hosts: []string{"h1", "h3"}, Tunnel: &topology.Tunnel{VNI: 42}}
+	if err := mp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.LinkRemove(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	// the gateway of a stitched link is held by the first host, while links without tunnels
+	// or nodes are not stitched, the latter being created on the first host
+	if err := mp.LinkCreate(ctx, topology.Link{Name: "golab-link-02", Hosts: []string{"h2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.LinkCreate(ctx, topology.Link{Name: "golab-link-03"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"h1: create link golab-link-01",
+		"h3: create link golab-link-01 without gateway",
+		"h1: stitch link golab-link-01 vni 42 from 192.0.2.1 to [192.0.2.3]",
+		"h3: stitch link golab-link-01 vni 42 from 192.0.2.3 to [192.0.2.1]",
+		"h1: unstitch link golab-link-01",
+		"h1: remove link golab-link-01",
+		"h3: unstitch link golab-link-01",
+		"h3: remove link golab-link-01",
+		"h2: create link golab-link-02",
+		"h1: create link golab-link-03",
+	}
+	if diff := cmp.Diff(want, *calls); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkCreateStitchError(t *testing.T) {
+	t.Parallel()
+	mp, fakes, _ := newTestProvider()
+	fakes["h2"].stitchFn = func() error { return errors.New("script exited with code 1") }
+	link := topology.Link{Name: "golab-link-01", Hosts: []string{"h1", "h2"}, Tunnel: &topology.Tunnel{VNI: 42}}
+	errMsg := "host h2: script exited with code 1"
+	if err := mp.LinkCreate(context.Background(), link); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestNodes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	mp, _, calls := newTestProvider()
+	nodes := []topology.Node{{Name: "R1", Host: "h1"}, {Name: "R2", Host: "h2"}, {Name: "R3", Host: "h1"}}
+	for _, node := range nodes {
+		if err := mp.NodeCreate(ctx, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mp.LinkConnect(ctx, topology.Link{Name: "golab-link-01"}, nodes); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"h1: create node R1",
+		"h2: create node R2",
+		"h1: create node R3",
+		"h1: connect link golab-link-01 to R1,R3",
+		"h2: connect link golab-link-01 to R2",
+	}
+	if diff := cmp.Diff(want, *calls); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+	errMsg := `node R4: host "h4" does not have a provider`
+	if err := mp.NodeCreate(ctx, topology.Node{Name: "R4", Host: "h4"}); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestDeployed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	mp, fakes, calls := newTestProvider()
+	fakes["h1"].nodes = []topology.Node{{Name: "R1"}}
+	fakes["h1"].links = []topology.Link{{Name: "golab-link-01"}, {Name: "golab-mgmt"}}
+	fakes["h2"].nodes = []topology.Node{{Name: "R2"}}
+	fakes["h2"].links = []topology.Link{{Name: "golab-link-01"}, {Name: "golab-mgmt"}}
+	nodes, links, err := mp.Deployed(ctx, "lab1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNodes := []topology.Node{{Name: "R1", Host: "h1"}, {Name: "R2", Host: "h2"}}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("nodes mismatch (-want +got):\n%s", diff)
+	}
+	wantLinks := []topology.Link{{Name: "golab-link-01", Hosts: []string{"h1", "h2"}}, {Name: "golab-mgmt", Hosts: []string{"h1", "h2"}}}
+	if diff := cmp.Diff(wantLinks, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+	if err := mp.RemoveOrphans(ctx, "lab1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"h1: remove orphans of lab1", "h2: remove orphans of lab1", "h3: remove orphans of lab1"}
+	if diff := cmp.Diff(want, *calls); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
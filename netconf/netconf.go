@@ -0,0 +1,195 @@
+// Package netconf implements a minimal NETCONF client over SSH (RFC 6241, RFC 6242).
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// delimiter marks the end of a message in NETCONF 1.0 framing.
+const delimiter = "]]>]]>"
+
+const (
+	baseCapability      = "urn:ietf:params:netconf:base:1.0"
+	candidateCapability = "urn:ietf:params:netconf:capability:candidate:1.0"
+)
+
+// Client represents a NETCONF session established with a network device.
+type Client struct {
+	sshClient    *ssh.Client
+	session      *ssh.Session
+	stdin        io.WriteCloser
+	stdout       *bufio.Reader
+	capabilities []string
+	messageID    int
+}
+
+type hello struct {
+	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+}
+
+type rpcReply struct {
+	XMLName xml.Name   `xml:"rpc-reply"`
+	Errors  []rpcError `xml:"rpc-error"`
+}
+
+type rpcError struct {
+	Severity string `xml:"error-severity"`
+	Message  string `xml:"error-message"`
+}
+
+// Dial establishes a NETCONF session with the device listening on the provided address.
+// Host keys are not verified since lab devices generate them on every boot.
+func Dial(ctx context.Context, addr, username, password string) (*Client, error) {
+	conn, err := new(net.Dialer).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &Client{sshClient: ssh.NewClient(sshConn, chans, reqs)}
+	if err := c.open(); err != nil {
+		c.sshClient.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// open starts the NETCONF subsystem and exchanges capabilities.
+func (c *Client) open() error {
+	session, err := c.sshClient.NewSession()
+	if err != nil {
+		return err
+	}
+	c.session = session
+	if c.stdin, err = session.StdinPipe(); err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	c.stdout = bufio.NewReader(stdout)
+	if err := session.RequestSubsystem("netconf"); err != nil {
+		return err
+	}
+	msg, err := c.receive()
+	if err != nil {
+		return err
+	}
+	var serverHello hello
+	if err := xml.Unmarshal(msg, &serverHello); err != nil {
+		return fmt.Errorf("invalid hello message: %w", err)
+	}
+	c.capabilities = serverHello.Capabilities
+	data, err := xml.Marshal(hello{Capabilities: []string{baseCapability}})
+	if err != nil {
+		return err
+	}
+	return c.send(data)
+}
+
+// send writes a message using the end-of-message framing.
+func (c *Client) send(msg []byte) error {
+	_, err := c.stdin.Write(append(msg, delimiter...))
+	return err
+}
+
+// receive reads a message using the end-of-message framing.
+func (c *Client) receive() ([]byte, error) {
+	return readMessage(c.stdout)
+}
+
+// readMessage reads bytes until the end-of-message delimiter and strips it.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		buf.WriteByte(b)
+		if bytes.HasSuffix(buf.Bytes(), []byte(delimiter)) {
+			return bytes.TrimSpace(buf.Bytes()[:buf.Len()-len(delimiter)]), nil
+		}
+	}
+}
+
+// call executes an RPC operation and checks the reply for errors.
+func (c *Client) call(operation string) error {
+	c.messageID++
+	rpc := `<rpc message-id="` + strconv.Itoa(c.messageID) + `" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` +
+		operation + `</rpc>`
+	if err := c.send([]byte(rpc)); err != nil {
+		return err
+	}
+	msg, err := c.receive()
+	if err != nil {
+		return err
+	}
+	var reply rpcReply
+	if err := xml.Unmarshal(msg, &reply); err != nil {
+		return fmt.Errorf("invalid rpc-reply message: %w", err)
+	}
+	for _, rpcErr := range reply.Errors {
+		if rpcErr.Severity != "warning" {
+			return fmt.Errorf("rpc-error: %s", strings.TrimSpace(rpcErr.Message))
+		}
+	}
+	return nil
+}
+
+// EditConfig merges the provided configuration into the device configuration.
+// The candidate datastore is used and committed if the device supports it.
+func (c *Client) EditConfig(config []byte) error {
+	target := "running"
+	if c.HasCapability(candidateCapability) {
+		target = "candidate"
+	}
+	err := c.call("<edit-config><target><" + target + "/></target><config>" + string(config) + "</config></edit-config>")
+	if err != nil {
+		return err
+	}
+	if target == "candidate" {
+		return c.call("<commit/>")
+	}
+	return nil
+}
+
+// HasCapability tells whether the device advertised the provided capability.
+func (c *Client) HasCapability(capability string) bool {
+	for _, advertised := range c.capabilities {
+		if strings.HasPrefix(advertised, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close gracefully terminates the NETCONF session.
+func (c *Client) Close() error {
+	err := c.call("<close-session/>")
+	c.session.Close()
+	return errors.Join(err, c.sshClient.Close())
+}
@@ -0,0 +1,190 @@
+package netconf
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeDevice is a NETCONF server recording the received RPCs.
+type fakeDevice struct {
+	addr         string
+	capabilities []string
+	mu           sync.Mutex
+	rpcs         []string
+}
+
+func newFakeDevice(t *testing.T, capabilities ...string) *fakeDevice {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "admin" && string(password) == "admin" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied for %s", conn.User())
+		},
+	}
+	config.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	dev := &fakeDevice{addr: ln.Addr().String(), capabilities: capabilities}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go dev.serve(conn, config)
+		}
+	}()
+	return dev
+}
+
+func (d *fakeDevice) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range chReqs {
+				req.Reply(req.Type == "subsystem", nil)
+				if req.Type == "subsystem" {
+					go d.session(ch)
+				}
+			}
+		}()
+	}
+}
+
+func (d *fakeDevice) session(ch ssh.Channel) {
+	defer ch.Close()
+	caps := "<capability>" + baseCapability + "</capability>"
+	for _, c := range d.capabilities {
+		caps += "<capability>" + c + "</capability>"
+	}
+	fmt.Fprintf(ch, `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>%s</capabilities></hello>%s`, caps, delimiter)
+	r := bufio.NewReader(ch)
+	if _, err := readMessage(r); err != nil {
+		return
+	}
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		d.mu.Lock()
+		d.rpcs = append(d.rpcs, string(msg))
+		d.mu.Unlock()
+		reply := "<ok/>"
+		if strings.Contains(string(msg), "<invalid/>") {
+			reply = "<rpc-error><error-severity>error</error-severity><error-message>syntax error</error-message></rpc-error>"
+		}
+		fmt.Fprintf(ch, `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">%s</rpc-reply>%s`, reply, delimiter)
+		if strings.Contains(string(msg), "<close-session/>") {
+			return
+		}
+	}
+}
+
+func (d *fakeDevice) operations() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ops := make([]string, 0, len(d.rpcs))
+	for _, rpc := range d.rpcs {
+		_, op, _ := strings.Cut(rpc, `base:1.0">`)
+		ops = append(ops, strings.TrimSuffix(op, "</rpc>"))
+	}
+	return ops
+}
+
+func TestEditConfig(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name         string
+		capabilities []string
+		want         []string
+	}{
+		{
+			name: "Running",
+			want: []string{
+				"<edit-config><target><running/></target><config><system/></config></edit-config>",
+				"<close-session/>",
+			},
+		},
+		{
+			name:         "Candidate",
+			capabilities: []string{candidateCapability},
+			want: []string{
+				"<edit-config><target><candidate/></target><config><system/></config></edit-config>",
+				"<commit/>",
+				"<close-session/>",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dev := newFakeDevice(t, tc.capabilities...)
+			client, err := Dial(context.Background(), dev.addr, "admin", "admin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.EditConfig([]byte("<system/>")); err != nil {
+				t.Fatal(err)
+			}
+			if err := client.Close(); err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			got := dev.operations()
+			if strings.Join(tc.want, "\n") != strings.Join(got, "\n") {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEditConfigErrors(t *testing.T) {
+	t.Parallel()
+	dev := newFakeDevice(t)
+	// authentication error
+	_, err := Dial(context.Background(), dev.addr, "admin", "wrong")
+	if err == nil {
+		t.Fatal("error: want authentication failure, got nil")
+	}
+	// rpc error
+	client, err := Dial(context.Background(), dev.addr, "admin", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	wantMsg := "rpc-error: syntax error"
+	err = client.EditConfig([]byte("<invalid/>"))
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
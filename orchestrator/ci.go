@@ -0,0 +1,140 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// Failure classes of orchestration commands, each mapped to a distinct exit code.
+var (
+	ErrUsage           = errors.New("usage error")
+	ErrInvalidTopology = errors.New("invalid topology")
+	ErrConfig          = errors.New("configuration failure")
+	ErrProvider        = errors.New("provider failure")
+	ErrNotReady        = errors.New("nodes not ready")
+	ErrCommand         = errors.New("command failure")
+	ErrTeardown        = errors.New("teardown failure")
+)
+
+// exitCodes lists failure classes in the order of precedence.
+var exitCodes = []struct {
+	class error
+	code  int
+}{
+	{ErrTeardown, 8},
+	{ErrCommand, 7},
+	{ErrNotReady, 6},
+	{ErrProvider, 5},
+	{ErrConfig, 4},
+	{ErrInvalidTopology, 3},
+	{ErrUsage, 2},
+}
+
+const readinessInterval = time.Second
+
+// classifiedError annotates an error with its failure class without altering the message.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.class, e.err}
+}
+
+// classify annotates a non-nil error with the provided failure class.
+func classify(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// Classify annotates a non-nil error with the provided failure class.
+// It is meant for failures detected outside of the orchestrator, e.g. in the CLI.
+func Classify(class, err error) error {
+	return classify(class, err)
+}
+
+// ExitCode returns a deterministic process exit code for the provided error.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	for _, ec := range exitCodes {
+		if errors.Is(err, ec.class) {
+			return ec.code
+		}
+	}
+	return 1
+}
+
+// Summary represents a machine-readable outcome of an orchestration command.
+type Summary struct {
+	Command         string  `json:"command"`
+	Topology        string  `json:"topology,omitempty"`
+	Result          string  `json:"result"`
+	ExitCode        int     `json:"exit_code"`
+	FailureClass    string  `json:"failure_class,omitempty"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// NewSummary summarizes the outcome of an orchestration command.
+func NewSummary(command string, data []byte, err error, duration time.Duration) Summary {
+	summary := Summary{
+		Command:         command,
+		Result:          "success",
+		DurationSeconds: duration.Seconds(),
+	}
+	if topo, parseErr := topology.FromYAML(data); parseErr == nil {
+		summary.Topology = topo.Name
+	}
+	if err == nil {
+		return summary
+	}
+	summary.Result = "failure"
+	summary.ExitCode = ExitCode(err)
+	summary.Error = err.Error()
+	summary.FailureClass = "unknown"
+	for _, ec := range exitCodes {
+		if errors.Is(err, ec.class) {
+			summary.FailureClass = ec.class.Error()
+			break
+		}
+	}
+	return summary
+}
+
+// Wait blocks until every node in the topology is able to execute commands or the context expires.
+func Wait(ctx context.Context, data []byte, vp VirtProvider) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		for {
+			exitCode, err := vp.NodeExec(ctx, *topo.Nodes[name], []string{"true"}, io.Discard, io.Discard)
+			if err == nil && exitCode == 0 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return classify(ErrNotReady, fmt.Errorf("node %s is not ready: %w", name, ctx.Err()))
+			case <-time.After(readinessInterval):
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExitCode(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "Success",
+			err:  nil,
+			want: 0,
+		},
+		{
+			name: "Unclassified",
+			err:  errors.New("unexpected failure"),
+			want: 1,
+		},
+		{
+			name: "InvalidTopology",
+			err:  orchestrator.Build(ctx, []byte(`name`), new(stubVirtProvider), new(stubConfProvider)),
+			want: 3,
+		},
+		{
+			name: "Config",
+			err:  orchestrator.Build(ctx, []byte(testYAML), new(stubVirtProvider), &stubConfProvider{err: errors.New("failed")}),
+			want: 4,
+		},
+		{
+			name: "Provider",
+			err:  orchestrator.Build(ctx, []byte(testYAML), &stubVirtProvider{nodeErr: errors.New("failed")}, new(stubConfProvider)),
+			want: 5,
+		},
+		{
+			name: "Teardown",
+			err: errors.Join(
+				orchestrator.Classify(orchestrator.ErrCommand, errors.New("tests failed")),
+				orchestrator.Classify(orchestrator.ErrTeardown, errors.New("failed to remove node")),
+			),
+			want: 8,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := orchestrator.ExitCode(tc.err); tc.want != got {
+				t.Errorf("exit code: want %d, got %d (error %v)", tc.want, got, tc.err)
+			}
+		})
+	}
+}
+
+func TestNewSummary(t *testing.T) {
+	t.Parallel()
+	err := orchestrator.Build(context.Background(), []byte(testYAML), &stubVirtProvider{linkErr: errors.New("failed to create link")}, new(stubConfProvider))
+	got := orchestrator.NewSummary("build", []byte(testYAML), err, 1500*time.Millisecond)
+	want := orchestrator.Summary{
+		Command:         "build",
+		Topology:        "example",
+		Result:          "failure",
+		ExitCode:        5,
+		FailureClass:    "provider failure",
+		Error:           "failed to create link",
+		DurationSeconds: 1.5,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+	data := []byte("name: ready\nnodes:\n  R1:\n    image: \"quay.io/frrouting/frr:master\"\n")
+	if err := orchestrator.Wait(context.Background(), data, new(stubVirtProvider)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	t.Parallel()
+	// the stub provider always fails to execute commands on R2
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := orchestrator.Wait(ctx, []byte(testYAML), new(stubVirtProvider))
+	wantMsg := "node R2 is not ready: context deadline exceeded"
+	if err == nil || err.Error() != wantMsg {
+		t.Fatalf("error: want %q, got %v", wantMsg, err)
+	}
+	if !errors.Is(err, orchestrator.ErrNotReady) {
+		t.Errorf("error: want %q class, got %v", orchestrator.ErrNotReady, err)
+	}
+}
@@ -0,0 +1,277 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// DashboardProvider represents a virtualization provider capable of reporting whether nodes are running.
+type DashboardProvider interface {
+	VirtProvider
+	NodeRunning(ctx context.Context, node topology.Node) (bool, error)
+}
+
+// Escape sequences controlling the terminal, which is expected to be in raw mode.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	keyUp       = "\x1b[A"
+	keyDown     = "\x1b[B"
+	keyCtrlC    = "\x03"
+)
+
+const dashboardHelp = "[up/down] select  [s] start  [x] stop  [enter] shell  [q] quit"
+
+// nodeState represents the last observed state of a node on the dashboard.
+type nodeState struct {
+	running bool
+	stats   topology.NodeStats
+	err     error
+}
+
+// dashboard holds the state of an interactive terminal dashboard.
+type dashboard struct {
+	topo     *topology.Topology
+	vp       DashboardProvider
+	tty      topology.TTY
+	names    []string
+	states   []nodeState
+	selected int
+	message  string
+	updated  time.Time
+}
+
+// Dashboard renders the topology along with status and resource usage of its nodes in the terminal,
+// refreshing it with the provided interval until the user quits or the context is canceled.
+// Key bindings allow to stop and start the selected node and to open an interactive session on it.
+func Dashboard(ctx context.Context, data []byte, vp DashboardProvider, tty topology.TTY, interval time.Duration) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	d := &dashboard{
+		topo:  topo,
+		vp:    vp,
+		tty:   tty,
+		names: slices.Sorted(maps.Keys(topo.Nodes)),
+	}
+	d.states = make([]nodeState, len(d.names))
+	done := make(chan struct{})
+	defer close(done)
+	keys := readKeys(tty.In, done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	refresh := true
+	for {
+		if refresh {
+			if err := d.refresh(ctx); err != nil {
+				return classify(ErrProvider, err)
+			}
+		}
+		d.render()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			refresh = true
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			var quit bool
+			quit, refresh = d.handle(ctx, string(key), keys)
+			if quit {
+				fmt.Fprint(tty.Out, clearScreen)
+				return nil
+			}
+		}
+	}
+}
+
+// readKeys forwards input chunks, which normally hold a single key press, until the input is exhausted.
+func readKeys(in io.Reader, done <-chan struct{}) <-chan []byte {
+	keys := make(chan []byte)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if n > 0 {
+				select {
+				case keys <- bytes.Clone(buf[:n]):
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return keys
+}
+
+// refresh queries the provider for the state of all nodes.
+func (d *dashboard) refresh(ctx context.Context) error {
+	for i, name := range d.names {
+		node := d.topo.Nodes[name]
+		running, err := d.vp.NodeRunning(ctx, *node)
+		if err != nil {
+			return err
+		}
+		state := nodeState{running: running}
+		if running {
+			state.stats, state.err = d.vp.NodeStats(ctx, *node)
+		}
+		d.states[i] = state
+	}
+	d.updated = time.Now()
+	return nil
+}
+
+// handle processes a key press, reporting whether the dashboard has to quit or refresh node states.
+func (d *dashboard) handle(ctx context.Context, key string, keys <-chan []byte) (quit, refresh bool) {
+	if len(d.names) == 0 {
+		return key == "q" || key == keyCtrlC, false
+	}
+	node := d.topo.Nodes[d.names[d.selected]]
+	switch key {
+	case "q", keyCtrlC:
+		return true, false
+	case "k", keyUp:
+		d.selected = (d.selected + len(d.names) - 1) % len(d.names)
+	case "j", keyDown:
+		d.selected = (d.selected + 1) % len(d.names)
+	case "s":
+		d.message = fmt.Sprintf("started node %s", node.Name)
+		if err := startNode(ctx, d.vp, node); err != nil {
+			d.message = fmt.Sprintf("failed to start node %s: %v", node.Name, err)
+		}
+		return false, true
+	case "x":
+		d.message = fmt.Sprintf("stopped node %s", node.Name)
+		if err := stopNode(ctx, d.vp, node); err != nil {
+			d.message = fmt.Sprintf("failed to stop node %s: %v", node.Name, err)
+		}
+		return false, true
+	case "\r", "\n":
+		d.message = fmt.Sprintf("closed session on node %s", node.Name)
+		if err := d.shell(ctx, node, keys); err != nil {
+			d.message = fmt.Sprintf("session on node %s failed: %v", node.Name, err)
+		}
+		return false, true
+	}
+	return false, false
+}
+
+// startNode creates the node along with its sidecars, or starts them if they are stopped.
+func startNode(ctx context.Context, vp VirtProvider, node *topology.Node) error {
+	if err := vp.NodeCreate(ctx, *node); err != nil {
+		return err
+	}
+	for _, sidecar := range node.Sidecars {
+		if err := vp.NodeCreate(ctx, *sidecar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopNode stops the node along with its sidecars, which share its network namespace.
+func stopNode(ctx context.Context, vp VirtProvider, node *topology.Node) error {
+	for _, sidecar := range node.Sidecars {
+		if err := vp.NodeStop(ctx, *sidecar); err != nil {
+			return err
+		}
+	}
+	return vp.NodeStop(ctx, *node)
+}
+
+// shell hands the terminal over to an interactive session on the node until it is closed.
+// Key presses are forwarded to the session, as the input is already consumed by the dashboard.
+func (d *dashboard) shell(ctx context.Context, node *topology.Node, keys <-chan []byte) error {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case key, ok := <-keys:
+				if !ok {
+					pw.Close()
+					return
+				}
+				if _, err := pw.Write(key); err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		pw.Close()
+	}()
+	fmt.Fprint(d.tty.Out, clearScreen)
+	tty := topology.TTY{In: pr, Out: d.tty.Out, Height: d.tty.Height, Width: d.tty.Width}
+	exitCode, err := d.vp.NodeShell(ctx, *node, vendorShell(node), tty)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("shell exited with code %d", exitCode)
+	}
+	return nil
+}
+
+// render draws the dashboard. Lines are terminated with CRLF, as output processing is disabled in raw mode.
+func (d *dashboard) render() {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "golab dashboard: %s (updated %s)\n\n", d.topo.Name, d.updated.Format(time.TimeOnly))
+	tw := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NODE\tSTATUS\tIMAGE\tCPU %\tMEM USAGE / LIMIT\tNET RX / TX")
+	for i, name := range d.names {
+		cursor := " "
+		if i == d.selected {
+			cursor = ">"
+		}
+		node, state := d.topo.Nodes[name], d.states[i]
+		switch {
+		case !state.running:
+			fmt.Fprintf(tw, "%s %s\tstopped\t%s\t-\t-\t-\n", cursor, name, node.Image)
+		case state.err != nil:
+			fmt.Fprintf(tw, "%s %s\trunning\t%s\t?\t?\t?\n", cursor, name, node.Image)
+		default:
+			s := state.stats
+			fmt.Fprintf(tw, "%s %s\trunning\t%s\t%.2f%%\t%s / %s\t%s / %s\n", cursor, name, node.Image, s.CPUPercent,
+				formatBytes(s.MemUsage), formatBytes(s.MemLimit), formatBytes(s.RxBytes), formatBytes(s.TxBytes))
+		}
+	}
+	tw.Flush()
+	if state := d.states[d.selected]; state.running && state.err == nil && len(state.stats.Interfaces) != 0 {
+		fmt.Fprintf(&buf, "\nINTERFACES OF %s\n", d.names[d.selected])
+		tw = tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  NAME\tNET RX / TX\tPACKETS RX / TX\tERRORS RX / TX\tDROPPED RX / TX")
+		writeInterfaceStats(tw, "  ", state.stats.Interfaces)
+		tw.Flush()
+	}
+	if len(d.topo.Links) != 0 {
+		fmt.Fprintln(&buf, "\nLINKS")
+		tw = tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+		for _, link := range d.topo.Links {
+			subnets := strings.TrimSpace(link.IPv4Subnet + " " + link.IPv6Subnet)
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", link.Name, strings.Join(link.Endpoints, " <-> "), subnets)
+		}
+		tw.Flush()
+	}
+	fmt.Fprintf(&buf, "\n%s\n%s\n", dashboardHelp, d.message)
+	fmt.Fprint(d.tty.Out, clearScreen+strings.ReplaceAll(buf.String(), "\n", "\r\n"))
+}
@@ -0,0 +1,97 @@
+package orchestrator_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+)
+
+// stubDashboardProvider tracks which nodes are running.
+type stubDashboardProvider struct {
+	stubVirtProvider
+	stopped map[string]bool
+}
+
+func (s *stubDashboardProvider) NodeRunning(_ context.Context, node topology.Node) (bool, error) {
+	return !s.stopped[node.Name], nil
+}
+
+func (s *stubDashboardProvider) NodeCreate(_ context.Context, node topology.Node) error {
+	delete(s.stopped, node.Name)
+	return nil
+}
+
+func (s *stubDashboardProvider) NodeStop(_ context.Context, node topology.Node) error {
+	s.stopped[node.Name] = true
+	return nil
+}
+
+// NodeShell echoes the first line of input, which is expected to close the session.
+func (s *stubDashboardProvider) NodeShell(ctx context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error) {
+	if _, err := s.stubVirtProvider.NodeShell(ctx, node, cmd, tty); err != nil {
+		return 0, err
+	}
+	line, err := bufio.NewReader(tty.In).ReadString('\r')
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintln(tty.Out, strings.TrimSpace(line))
+	return 0, nil
+}
+
+// keyReader delivers key presses one by one, like a terminal in raw mode.
+type keyReader struct {
+	keys []string
+}
+
+func (r *keyReader) Read(p []byte) (int, error) {
+	if len(r.keys) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.keys[0])
+	r.keys = r.keys[1:]
+	return n, nil
+}
+
+func TestDashboard(t *testing.T) {
+	t.Parallel()
+	vp := &stubDashboardProvider{stopped: map[string]bool{"R3": true}}
+	out := new(strings.Builder)
+	tty := topology.TTY{
+		// select R2, stop it, start R3, open a shell on R3 typing a command and quit
+		In:     &keyReader{keys: []string{"\x1b[B", "x", "j", "s", "\r", "exit\r"}},
+		Out:    out,
+		Height: 24,
+		Width:  80,
+	}
+	err := orchestrator.Dashboard(context.Background(), []byte(testYAML), vp, tty, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vp.stopped["R2"] || vp.stopped["R3"] {
+		t.Errorf("stopped nodes: want only R2, got %v", vp.stopped)
+	}
+	for _, want := range []string{
+		"golab dashboard: example",
+		"> R1    running  quay.io/frrouting/frr:master  1.50%",
+		"  R3    stopped  quay.io/frrouting/frr:master  -",
+		"> R2    stopped",
+		"stopped node R2\r\n",
+		"started node R3\r\n",
+		"R3# vtysh (80x24)\nexit\n",
+		"closed session on node R3\r\n",
+		"INTERFACES OF R1\r\n  NAME  NET RX / TX  PACKETS RX / TX  ERRORS RX / TX  DROPPED RX / TX\r\n  eth0  1000B / 1B   10 / 1",
+		"golab-link-01  R1 <-> R2  10.1.2.0/24 2001:db8:1:2::/64",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output: want %q in\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+)
+
+// Exporter represents a backend writing a topology in the format of another deployment tool, e.g. docker.Compose.
+type Exporter func(topo *topology.Topology, out io.Writer) error
+
+// Export writes the topology in the format of the exporter instead of deploying it. Node configuration, the
+// syslog directory and the SSH config are generated like Build does, so that the exported file refers to them.
+// Topologies relying on golab to set up running nodes, e.g. with veth links or subinterfaces, are rejected.
+func Export(data []byte, cp ConfProvider, export Exporter, out io.Writer) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	if err := exportable(topo); err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	if topo.ConfigMode == topology.Auto {
+		if err := cp.GenerateAndDump(topo, os.Getenv("PWD")); err != nil {
+			return classify(ErrConfig, err)
+		}
+	}
+	if topo.Syslog != nil {
+		if err := os.MkdirAll(filepath.Join(os.Getenv("PWD"), "syslog"), 0o750); err != nil {
+			return classify(ErrConfig, err)
+		}
+	}
+	if topo.SSH != nil {
+		if err := writeSSHConfig(topo, filepath.Join(os.Getenv("PWD"), sshConfigFile)); err != nil {
+			return classify(ErrConfig, err)
+		}
+	}
+	return classify(ErrConfig, export(topo, out))
+}
+
+// exportable checks that the topology does not need golab once its containers and networks are created.
+func exportable(topo *topology.Topology) error {
+	const reason = "cannot be exported, as golab sets it up in running nodes"
+	if len(topo.Hosts) != 0 {
+		return fmt.Errorf("lab spread over hosts %v cannot be exported, as golab stitches its links", slices.Sorted(maps.Keys(topo.Hosts)))
+	}
+	if topo.ConfigMode == topology.Push {
+		return fmt.Errorf("config_mode %q %s", topo.ConfigMode, reason)
+	}
+	for _, link := range topo.Links {
+		if link.Veth() {
+			return fmt.Errorf("veth link %v %s", link.Endpoints, reason)
+		}
+		if netemArgs(link) != nil || tbfArgs(link) != nil {
+			return fmt.Errorf("impairment of link %v %s", link.Endpoints, reason)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		node := topo.Nodes[name]
+		if node.VM() {
+			return fmt.Errorf("node %s with qcow2 image %s cannot be exported, as Compose runs no virtual machines", name, node.Image)
+		}
+		for _, iface := range node.Interfaces {
+			if iface.VLAN != 0 {
+				return fmt.Errorf("subinterface %s of node %s %s", iface.Name, name, reason)
+			}
+		}
+		if node.Vendor == vendors.HOST && (node.IPv4Gateway != "" || node.IPv6Gateway != "") {
+			return fmt.Errorf("default route of host node %s %s", name, reason)
+		}
+	}
+	return nil
+}
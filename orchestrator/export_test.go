@@ -0,0 +1,98 @@
+package orchestrator_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+)
+
+// exportNames writes the names of the links and nodes of the topology.
+func exportNames(topo *topology.Topology, out io.Writer) error {
+	for _, link := range topo.Links {
+		fmt.Fprintln(out, link.Name)
+	}
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		fmt.Fprintln(out, name)
+	}
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+	data := []byte(`
+name: lab1
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+`)
+	var out bytes.Buffer
+	if err := orchestrator.Export(data, new(stubConfProvider), exportNames, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "golab-link-01\nR1\nR2\n"; out.String() != want {
+		t.Errorf("want %q, got %q", want, out.String())
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		image  string
+		links  string
+		errMsg string
+	}{
+		{
+			name:   "Veth",
+			links:  `[{endpoints: [R1, R2], link_type: veth}]`,
+			errMsg: "veth link [R1 R2] cannot be exported, as golab sets it up in running nodes",
+		},
+		{
+			name:   "Impairment",
+			links:  `[{endpoints: [R1, R2], delay: 50ms}]`,
+			errMsg: "impairment of link [R1 R2] cannot be exported, as golab sets it up in running nodes",
+		},
+		{
+			name:   "Subinterface",
+			links:  `[{endpoints: [R1, R2], ip: none}, {endpoints: ["R1:eth0.100", "R2:eth0.100"]}]`,
+			errMsg: "subinterface eth0.100 of node R1 cannot be exported, as golab sets it up in running nodes",
+		},
+		{
+			name:   "VM",
+			image:  "images/vmx.qcow2",
+			links:  `[{endpoints: [R1, R2]}]`,
+			errMsg: "node R1 with qcow2 image images/vmx.qcow2 cannot be exported, as Compose runs no virtual machines",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			image := tc.image
+			if image == "" {
+				image = "quay.io/frrouting/frr:master"
+			}
+			data := []byte(`
+name: lab1
+nodes:
+  R1: {image: "` + image + `"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links: ` + tc.links)
+			err := orchestrator.Export(data, new(stubConfProvider), exportNames, io.Discard)
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+			if !errors.Is(err, orchestrator.ErrInvalidTopology) {
+				t.Errorf("want %v, got %v", orchestrator.ErrInvalidTopology, err)
+			}
+		})
+	}
+}
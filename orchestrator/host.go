@@ -0,0 +1,33 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+)
+
+// configureHosts points the default routes of host nodes to their gateways. Interfaces of hosts
+// are addressed by the provider, hence routes are all they need to act as traffic endpoints.
+// Replacing the routes makes this safe to repeat.
+func configureHosts(ctx context.Context, topo *topology.Topology, vp VirtProvider) error {
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		node := topo.Nodes[name]
+		if node.Vendor != vendors.HOST {
+			continue
+		}
+		for _, route := range []struct{ family, via string }{{"-4", node.IPv4Gateway}, {"-6", node.IPv6Gateway}} {
+			if route.via == "" {
+				continue
+			}
+			cmd := []string{"ip", route.family, "route", "replace", "default", "via", route.via}
+			if err := run(ctx, vp, node, cmd); err != nil {
+				return fmt.Errorf("node %s failed to set default route via %s: %w", name, route.via, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/google/go-cmp/cmp"
+)
+
+const hostYAML = `
+name: hosts
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "alpine:latest"
+    kind: host
+    gateway: R1
+  R3:
+    image: "alpine:latest"
+    kind: host
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R1, R3]
+`
+
+func TestBuildHosts(t *testing.T) {
+	t.Parallel()
+	vp := new(execRecordingVirtProvider)
+	if err := orchestrator.Build(context.Background(), []byte(hostYAML), vp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"R2: ip -4 route replace default via 10.1.2.1",
+		"R2: ip -6 route replace default via 2001:db8:1:2::1",
+	}
+	if diff := cmp.Diff(want, vp.cmds); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildHostsError(t *testing.T) {
+	t.Parallel()
+	err := orchestrator.Build(context.Background(), []byte(hostYAML), new(stubVirtProvider), new(stubConfProvider))
+	wantMsg := "node R2 failed to set default route via 10.1.2.1: exit code 1: failed to run ip -4 route replace default via 10.1.2.1"
+	if err == nil || err.Error() != wantMsg || !errors.Is(err, orchestrator.ErrProvider) {
+		t.Errorf("error: want %q classified as provider failure, got %v", wantMsg, err)
+	}
+}
@@ -0,0 +1,151 @@
+package orchestrator
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// defaultMTU is the MTU of Docker networks unless set on the link.
+const defaultMTU = 1500
+
+// impair applies delay, jitter, loss and rate limits of links to the interfaces attached to them
+// by running tc netem inside the nodes, and shapes their egress bandwidth with a token bucket filter.
+// Replacing the root qdisc makes this safe to repeat. Nodes are checked for tc before any link is
+// impaired, so that images without it fail with a clear error rather than halfway through.
+func impair(ctx context.Context, topo *topology.Topology, vp VirtProvider) error {
+	type qdisc struct {
+		node  *topology.Node
+		iface string
+		cmd   []string
+	}
+	var (
+		qdiscs []qdisc
+		nodes  []*topology.Node
+	)
+	for _, link := range topo.Links {
+		netem, tbf := netemArgs(link), tbfArgs(link)
+		if netem == nil && tbf == nil {
+			continue
+		}
+		for _, name := range link.Endpoints {
+			// nodes which are not started are impaired once they are
+			node, ok := topo.Nodes[name]
+			if !ok {
+				continue
+			}
+			for _, iface := range node.Interfaces {
+				if iface.Link != link.Name {
+					continue
+				}
+				if !slices.Contains(nodes, node) {
+					nodes = append(nodes, node)
+				}
+				for _, cmd := range qdiscCommands(iface.Name, netem, tbf) {
+					qdiscs = append(qdiscs, qdisc{node: node, iface: iface.Name, cmd: cmd})
+				}
+			}
+		}
+	}
+	for _, node := range nodes {
+		if err := run(ctx, vp, node, []string{"tc", "-V"}); err != nil {
+			return fmt.Errorf("node %s cannot impair links without tc, which images provide with iproute2: %w", node.Name, err)
+		}
+	}
+	for _, q := range qdiscs {
+		if err := run(ctx, vp, q.node, q.cmd); err != nil {
+			return fmt.Errorf("node %s failed to impair interface %s: %w", q.node.Name, q.iface, err)
+		}
+	}
+	return nil
+}
+
+// run executes the command on the node, treating a non-zero exit code as a failure.
+func run(ctx context.Context, vp VirtProvider, node *topology.Node, cmd []string) error {
+	var stderr bytes.Buffer
+	exitCode, err := vp.NodeExec(ctx, *node, cmd, io.Discard, &stderr)
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// netemArgs converts impairment parameters of the link into tc netem arguments,
+// returning nil for links without impairments.
+func netemArgs(link *topology.Link) []string {
+	var args []string
+	if link.Delay != "" {
+		args = append(args, "delay", tcTime(link.Delay))
+		if link.Jitter != "" {
+			args = append(args, tcTime(link.Jitter))
+		}
+	}
+	if link.Loss != 0 {
+		args = append(args, "loss", strconv.FormatFloat(link.Loss, 'f', -1, 64)+"%")
+	}
+	if link.Rate != "" {
+		args = append(args, "rate", link.Rate)
+	}
+	return args
+}
+
+// qdiscCommands returns the tc commands installing the qdiscs on the interface. When the link is
+// shaped as well as impaired, netem is attached below the token bucket filter.
+func qdiscCommands(dev string, netem, tbf []string) [][]string {
+	replace := []string{"tc", "qdisc", "replace", "dev", dev}
+	switch {
+	case tbf == nil:
+		return [][]string{slices.Concat(replace, []string{"root", "netem"}, netem)}
+	case netem == nil:
+		return [][]string{slices.Concat(replace, []string{"root", "tbf"}, tbf)}
+	}
+	return [][]string{
+		slices.Concat(replace, []string{"root", "handle", "1:", "tbf"}, tbf),
+		slices.Concat(replace, []string{"parent", "1:1", "handle", "10:", "netem"}, netem),
+	}
+}
+
+// tbfArgs converts the bandwidth of the link into tc tbf arguments, returning nil for links without one.
+// The bucket holds 10ms worth of traffic but at least two full-sized frames, and packets are dropped
+// once they would wait longer than 50ms, like on a shaped WAN circuit.
+func tbfArgs(link *topology.Link) []string {
+	if link.Bandwidth == "" {
+		return nil
+	}
+	burst := max(rateBits(link.Bandwidth)/8/100, 2*cmp.Or(link.MTU, defaultMTU))
+	return []string{"rate", link.Bandwidth, "burst", strconv.Itoa(burst), "latency", "50ms"}
+}
+
+// rateBits converts a validated tc rate, e.g. 10mbit or 1.5mbps, into bits per second.
+func rateBits(rate string) int {
+	unit := strings.TrimLeft(rate, "0123456789.")
+	bits, _ := strconv.ParseFloat(strings.TrimSuffix(rate, unit), 64)
+	if strings.HasSuffix(unit, "bps") {
+		bits *= 8
+	}
+	switch unit[0] {
+	case 'k':
+		bits *= 1e3
+	case 'm':
+		bits *= 1e6
+	case 'g':
+		bits *= 1e9
+	case 't':
+		bits *= 1e12
+	}
+	return int(bits)
+}
+
+// tcTime converts a validated Go duration into microseconds understood by tc.
+func tcTime(duration string) string {
+	d, _ := time.ParseDuration(duration)
+	return strconv.FormatInt(d.Microseconds(), 10) + "us"
+}
@@ -0,0 +1,108 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+const impairedYAML = `
+name: wan
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "quay.io/frrouting/frr:master"
+  R3:
+    image: "quay.io/frrouting/frr:master"
+links:
+  - endpoints: [R1, R3]
+    delay: 50ms
+    jitter: 5ms
+    loss: 0.5
+    rate: 10mbit
+  - endpoints: [R1, R2]
+`
+
+// execRecordingVirtProvider records commands run on nodes.
+type execRecordingVirtProvider struct {
+	stubVirtProvider
+	cmds []string
+}
+
+func (e *execRecordingVirtProvider) NodeExec(_ context.Context, node topology.Node, cmd []string, _, _ io.Writer) (int, error) {
+	e.cmds = append(e.cmds, node.Name+": "+strings.Join(cmd, " "))
+	return 0, nil
+}
+
+func TestBuildImpairment(t *testing.T) {
+	t.Parallel()
+	vp := new(execRecordingVirtProvider)
+	if err := orchestrator.Build(context.Background(), []byte(impairedYAML), vp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"R1: tc -V",
+		"R3: tc -V",
+		"R1: tc qdisc replace dev eth0 root netem delay 50000us 5000us loss 0.5% rate 10mbit",
+		"R3: tc qdisc replace dev eth0 root netem delay 50000us 5000us loss 0.5% rate 10mbit",
+	}
+	if diff := cmp.Diff(want, vp.cmds); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildImpairmentError(t *testing.T) {
+	t.Parallel()
+	data := strings.Replace(impairedYAML, "[R1, R3]", "[R2, R3]", 1)
+	err := orchestrator.Build(context.Background(), []byte(data), new(stubVirtProvider), new(stubConfProvider))
+	wantMsg := "node R2 cannot impair links without tc, which images provide with iproute2: exit code 1: failed to run tc -V"
+	if err == nil || err.Error() != wantMsg || !errors.Is(err, orchestrator.ErrProvider) {
+		t.Errorf("error: want %q classified as provider failure, got %v", wantMsg, err)
+	}
+}
+
+func TestBuildBandwidth(t *testing.T) {
+	t.Parallel()
+	data := `
+name: wan
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "quay.io/frrouting/frr:master"
+  R3:
+    image: "quay.io/frrouting/frr:master"
+links:
+  - endpoints: [R1, R2]
+    bandwidth: 10mbit
+    delay: 20ms
+  - endpoints: [R1, R3]
+    bandwidth: 1mbit
+    mtu: 9000
+`
+	vp := new(execRecordingVirtProvider)
+	if err := orchestrator.Build(context.Background(), []byte(data), vp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"R1: tc -V",
+		"R2: tc -V",
+		"R3: tc -V",
+		"R1: tc qdisc replace dev eth0 root handle 1: tbf rate 10mbit burst 12500 latency 50ms",
+		"R1: tc qdisc replace dev eth0 parent 1:1 handle 10: netem delay 20000us",
+		"R2: tc qdisc replace dev eth0 root handle 1: tbf rate 10mbit burst 12500 latency 50ms",
+		"R2: tc qdisc replace dev eth0 parent 1:1 handle 10: netem delay 20000us",
+		"R1: tc qdisc replace dev eth1 root tbf rate 1mbit burst 18000 latency 50ms",
+		"R3: tc qdisc replace dev eth0 root tbf rate 1mbit burst 18000 latency 50ms",
+	}
+	if diff := cmp.Diff(want, vp.cmds); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+}
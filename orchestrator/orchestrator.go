@@ -3,78 +3,664 @@ package orchestrator
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
+	"github.com/elupevg/golab/configsave"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/telemetry"
 	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
 )
 
+const sshConfigFile = "ssh_config"
+
 // VirtProvider represents a virtualization provider and its methods (e.g. Docker).
 type VirtProvider interface {
 	LinkCreate(ctx context.Context, link topology.Link) error
 	LinkRemove(ctx context.Context, link topology.Link) error
+	LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error
+	LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error
 	NodeCreate(ctx context.Context, node topology.Node) error
 	NodeRemove(ctx context.Context, node topology.Node) error
+	NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error)
+	NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error)
+	NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, stderr io.Writer) error
+	NodeShell(ctx context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error)
+	NodePause(ctx context.Context, node topology.Node) error
+	NodeUnpause(ctx context.Context, node topology.Node) error
+	NodeStop(ctx context.Context, node topology.Node) error
+	NodeStart(ctx context.Context, node topology.Node) error
 }
 
 // ConfProvider represents a node configuration provider and its methods.
 type ConfProvider interface {
 	GenerateAndDump(topo *topology.Topology, path string) error
 	Cleanup(topo *topology.Topology, path string) error
+	Push(ctx context.Context, topo *topology.Topology) error
 }
 
 // Command represents a network topology orchestration command.
 type Command func(ctx context.Context, data []byte, vp VirtProvider, cp ConfProvider) error
 
-// Build creates a virtual network topology described in the provided YAML intent file.
-func Build(ctx context.Context, data []byte, vp VirtProvider, cp ConfProvider) error {
+// Build creates a virtual network topology described in the provided YAML intent file. If the provider
+// reports deployed objects, nodes and links created by a failing build are rolled back, so that no
+// half-built lab is left behind, while the ones which existed before are kept.
+func Build(ctx context.Context, data []byte, vp VirtProvider, cp ConfProvider) (err error) {
 	topo, err := topology.FromYAML(data)
 	if err != nil {
-		return err
+		return classify(ErrInvalidTopology, err)
+	}
+	if pp, ok := vp.(PlanProvider); ok {
+		deployedNodes, deployedLinks, deployedErr := pp.Deployed(ctx, topo.Name)
+		if deployedErr != nil {
+			return classify(ErrProvider, deployedErr)
+		}
+		defer func() {
+			if err != nil {
+				// the build may have failed because the context was canceled, which must not stop the rollback
+				err = errors.Join(err, rollback(context.WithoutCancel(ctx), topo, deployedNodes, deployedLinks, vp, cp))
+			}
+		}()
 	}
 	if topo.ConfigMode == topology.Auto {
 		err := cp.GenerateAndDump(topo, os.Getenv("PWD"))
 		if err != nil {
-			return err
+			return classify(ErrConfig, err)
+		}
+	}
+	if topo.Syslog != nil {
+		err := os.MkdirAll(filepath.Join(os.Getenv("PWD"), "syslog"), 0o750)
+		if err != nil {
+			return classify(ErrConfig, err)
 		}
 	}
 	for _, link := range topo.Links {
+		if link.Veth() || link.Tagged() {
+			continue
+		}
 		err := vp.LinkCreate(ctx, *link)
 		if err != nil {
-			return err
+			return classify(ErrProvider, err)
 		}
 	}
-	for _, node := range topo.Nodes {
-		err := vp.NodeCreate(ctx, *node)
+	if topo.Mgmt != nil {
+		err := vp.LinkCreate(ctx, *topo.Mgmt)
+		if err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	for _, service := range topo.Services {
+		err := vp.NodeCreate(ctx, *service)
 		if err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	for _, node := range topo.BootOrder() {
+		if err := bootDelay(ctx, node); err != nil {
 			return err
 		}
+		err := vp.NodeCreate(ctx, *node)
+		if err != nil {
+			return classify(ErrProvider, err)
+		}
+		for _, sidecar := range node.Sidecars {
+			err := vp.NodeCreate(ctx, *sidecar)
+			if err != nil {
+				return classify(ErrProvider, err)
+			}
+		}
+	}
+	if err := wire(ctx, topo, topo.Nodes, vp); err != nil {
+		return classify(ErrProvider, err)
+	}
+	if topo.ConfigMode == topology.Push {
+		err := cp.Push(ctx, topo)
+		if err != nil {
+			return classify(ErrConfig, err)
+		}
+	}
+	if topo.SSH != nil {
+		err := writeSSHConfig(topo, filepath.Join(os.Getenv("PWD"), sshConfigFile))
+		if err != nil {
+			return classify(ErrConfig, err)
+		}
 	}
 	return nil
 }
 
-// Wreck deletes a virtual network topology described in the provided YAML intent file.
+// rollback removes containers and networks of the topology which were not deployed before a failed
+// build, along with the configuration generated for the removed nodes.
+func rollback(ctx context.Context, topo *topology.Topology, deployedNodes []topology.Node, deployedLinks []topology.Link, vp VirtProvider, cp ConfProvider) error {
+	existed := make(map[string]bool, len(deployedNodes)+len(deployedLinks))
+	for _, node := range deployedNodes {
+		existed["node "+node.Name] = true
+	}
+	for _, link := range deployedLinks {
+		existed["link "+link.Name] = true
+	}
+	removed := &topology.Topology{Nodes: make(map[string]*topology.Node)}
+	// sidecars and services depend on the nodes, so they are removed first
+	for _, node := range slices.Backward(containers(topo)) {
+		if existed["node "+node.Name] {
+			continue
+		}
+		if err := vp.NodeRemove(ctx, *node); err != nil {
+			return classify(ErrProvider, fmt.Errorf("failed to roll back the build: %w", err))
+		}
+		if _, ok := topo.Nodes[node.Name]; ok {
+			removed.Nodes[node.Name] = node
+		}
+	}
+	for _, link := range slices.Backward(links(topo)) {
+		if existed["link "+link.Name] {
+			continue
+		}
+		if err := vp.LinkRemove(ctx, *link); err != nil {
+			return classify(ErrProvider, fmt.Errorf("failed to roll back the build: %w", err))
+		}
+	}
+	if topo.ConfigMode == topology.Auto && len(removed.Nodes) != 0 {
+		if err := cp.Cleanup(removed, os.Getenv("PWD")); err != nil {
+			return classify(ErrConfig, fmt.Errorf("failed to roll back the build: %w", err))
+		}
+	}
+	return nil
+}
+
+// wire sets up what lives in the network namespaces of the started nodes once they are running: veth pairs
+// attached to them, subinterfaces, routes of hosts and link impairments.
+func wire(ctx context.Context, topo *topology.Topology, started map[string]*topology.Node, vp VirtProvider) error {
+	for _, link := range topo.Links {
+		if !link.Veth() || !slices.ContainsFunc(link.Endpoints, func(ep string) bool { return started[ep] != nil }) {
+			continue
+		}
+		nodes := []topology.Node{*topo.Nodes[link.Endpoints[0]], *topo.Nodes[link.Endpoints[1]]}
+		if err := vp.LinkConnect(ctx, *link, nodes); err != nil {
+			return err
+		}
+	}
+	sub := &topology.Topology{Nodes: started, Links: topo.Links}
+	if err := createSubinterfaces(ctx, sub, vp); err != nil {
+		return err
+	}
+	if err := configureHosts(ctx, sub, vp); err != nil {
+		return err
+	}
+	return impair(ctx, sub, vp)
+}
+
+// bootDelay waits for the boot delay of the node, e.g. to let the nodes it depends on boot first.
+func bootDelay(ctx context.Context, node *topology.Node) error {
+	if node.BootDelay == "" {
+		return nil
+	}
+	delay, _ := time.ParseDuration(node.BootDelay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wreck deletes a virtual network topology described in the provided YAML intent file. If the provider
+// reports deployed objects, the ones of the lab missing from the topology, e.g. nodes and links disabled
+// since they were built, are removed as well.
 func Wreck(ctx context.Context, data []byte, vp VirtProvider, cp ConfProvider) error {
 	topo, err := topology.FromYAML(data)
 	if err != nil {
-		return err
+		return classify(ErrInvalidTopology, err)
+	}
+	var leftoverNodes []topology.Node
+	var leftoverLinks []topology.Link
+	if pp, ok := vp.(PlanProvider); ok {
+		deployedNodes, deployedLinks, err := pp.Deployed(ctx, topo.Name)
+		if err != nil {
+			return classify(ErrProvider, err)
+		}
+		leftoverNodes = slices.DeleteFunc(deployedNodes, func(node topology.Node) bool {
+			return slices.ContainsFunc(containers(topo), func(n *topology.Node) bool { return n.Name == node.Name })
+		})
+		leftoverLinks = slices.DeleteFunc(deployedLinks, func(link topology.Link) bool {
+			return slices.ContainsFunc(links(topo), func(l *topology.Link) bool { return l.Name == link.Name })
+		})
 	}
 	for _, node := range topo.Nodes {
+		for _, sidecar := range node.Sidecars {
+			err := vp.NodeRemove(ctx, *sidecar)
+			if err != nil {
+				return classify(ErrProvider, err)
+			}
+		}
 		err := vp.NodeRemove(ctx, *node)
 		if err != nil {
-			return err
+			return classify(ErrProvider, err)
 		}
 	}
+	for _, service := range topo.Services {
+		err := vp.NodeRemove(ctx, *service)
+		if err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	for _, node := range leftoverNodes {
+		err := vp.NodeRemove(ctx, node)
+		if err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	// veth pairs are removed along with the nodes, while VLAN links do not have networks of their own
 	for _, link := range topo.Links {
+		if link.Veth() || link.Tagged() {
+			continue
+		}
 		err := vp.LinkRemove(ctx, *link)
 		if err != nil {
-			return err
+			return classify(ErrProvider, err)
+		}
+	}
+	for _, link := range leftoverLinks {
+		err := vp.LinkRemove(ctx, link)
+		if err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	if topo.Mgmt != nil {
+		err := vp.LinkRemove(ctx, *topo.Mgmt)
+		if err != nil {
+			return classify(ErrProvider, err)
 		}
 	}
 	if topo.ConfigMode == topology.Auto {
 		err := cp.Cleanup(topo, os.Getenv("PWD"))
 		if err != nil {
-			return err
+			return classify(ErrConfig, err)
+		}
+	}
+	if topo.SSH != nil {
+		err := os.Remove(filepath.Join(os.Getenv("PWD"), sshConfigFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return classify(ErrConfig, err)
+		}
+	}
+	return nil
+}
+
+// Pause freezes all containers of the topology to free CPU without losing their state.
+func Pause(ctx context.Context, data []byte, vp VirtProvider) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	for _, node := range containers(topo) {
+		if err := vp.NodePause(ctx, *node); err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	return nil
+}
+
+// Resume unfreezes all containers of the topology paused earlier.
+func Resume(ctx context.Context, data []byte, vp VirtProvider) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	for _, node := range containers(topo) {
+		if err := vp.NodeUnpause(ctx, *node); err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	return nil
+}
+
+// Stop powers off the named nodes, or all nodes if none are named, keeping their containers, e.g. to test
+// how the rest of the lab reconverges. Sidecars are stopped first, as they share the namespaces of their nodes.
+func Stop(ctx context.Context, data []byte, vp VirtProvider, names []string) error {
+	_, nodes, err := selectNodes(data, names)
+	if err != nil {
+		return err
+	}
+	for _, node := range slices.Backward(nodes) {
+		for _, sidecar := range node.Sidecars {
+			if err := vp.NodeStop(ctx, *sidecar); err != nil {
+				return classify(ErrProvider, err)
+			}
+		}
+		if err := vp.NodeStop(ctx, *node); err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	return nil
+}
+
+// Start powers the named nodes, or all nodes if none are named, back on in boot order. Nodes get new
+// network namespaces when started, so whatever golab set up inside them is restored as well.
+func Start(ctx context.Context, data []byte, vp VirtProvider, names []string) error {
+	topo, nodes, err := selectNodes(data, names)
+	if err != nil {
+		return err
+	}
+	started := make(map[string]*topology.Node, len(nodes))
+	for _, node := range nodes {
+		if err := vp.NodeStart(ctx, *node); err != nil {
+			return classify(ErrProvider, err)
+		}
+		for _, sidecar := range node.Sidecars {
+			if err := vp.NodeStart(ctx, *sidecar); err != nil {
+				return classify(ErrProvider, err)
+			}
+		}
+		started[node.Name] = node
+	}
+	return classify(ErrProvider, wire(ctx, topo, started, vp))
+}
+
+// selectNodes returns the named nodes of the topology, or all of them if none are named, in boot order.
+func selectNodes(data []byte, names []string) (*topology.Topology, []*topology.Node, error) {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return nil, nil, classify(ErrInvalidTopology, err)
+	}
+	for _, name := range names {
+		if _, ok := topo.Nodes[name]; !ok {
+			return nil, nil, classify(ErrUsage, fmt.Errorf("node %q not found in topology %q", name, topo.Name))
+		}
+	}
+	nodes := topo.BootOrder()
+	if len(names) != 0 {
+		nodes = slices.DeleteFunc(nodes, func(node *topology.Node) bool { return !slices.Contains(names, node.Name) })
+	}
+	return topo, nodes, nil
+}
+
+// containers lists nodes of the topology in a stable order, each followed by its sidecars, and lab services.
+func containers(topo *topology.Topology) []*topology.Node {
+	var nodes []*topology.Node
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		nodes = append(nodes, topo.Nodes[name])
+		nodes = append(nodes, topo.Nodes[name].Sidecars...)
+	}
+	return append(nodes, topo.Services...)
+}
+
+// Exec runs a command in parallel on all nodes of the provided kind carrying all of the provided labels,
+// or on all nodes if neither is set. The output is aggregated per node and an error is returned if the
+// command failed on any of them.
+func Exec(ctx context.Context, data []byte, vp VirtProvider, kind string, labels map[string]string, cmd []string, out io.Writer) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	var names []string
+	for name, node := range topo.Nodes {
+		if kind != "" && string(node.Vendor) != kind {
+			continue
+		}
+		if !hasLabels(node.Labels, labels) {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		var filters []string
+		if kind != "" {
+			filters = append(filters, fmt.Sprintf("of kind %q", kind))
+		}
+		if len(labels) != 0 {
+			var pairs []string
+			for _, key := range slices.Sorted(maps.Keys(labels)) {
+				pairs = append(pairs, key+"="+labels[key])
+			}
+			filters = append(filters, "labeled "+strings.Join(pairs, ", "))
+		}
+		return classify(ErrUsage, fmt.Errorf("no nodes %s in topology %q", strings.Join(filters, " "), topo.Name))
+	}
+	slices.Sort(names)
+	type result struct {
+		output   strings.Builder
+		exitCode int
+		err      error
+	}
+	results := make([]result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := &results[i]
+			res.exitCode, res.err = vp.NodeExec(ctx, *topo.Nodes[name], cmd, &res.output, &res.output)
+		}()
+	}
+	wg.Wait()
+	var failed []string
+	for i, name := range names {
+		res := &results[i]
+		if res.err != nil {
+			fmt.Fprintf(out, "=== %s (error) ===\n%s\n", name, res.err)
+			failed = append(failed, name)
+			continue
 		}
+		fmt.Fprintf(out, "=== %s (exit %d) ===\n%s", name, res.exitCode, res.output.String())
+		if res.exitCode != 0 {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) != 0 {
+		return classify(ErrCommand, fmt.Errorf("command failed on %d of %d nodes: %s", len(failed), len(names), strings.Join(failed, ", ")))
+	}
+	return nil
+}
+
+// ExecNode runs a command on a single node and streams its output.
+// An error is returned if the command exits with a non-zero code.
+func ExecNode(ctx context.Context, data []byte, vp VirtProvider, name string, cmd []string, stdout, stderr io.Writer) error {
+	node, err := findNode(data, name)
+	if err != nil {
+		return err
+	}
+	exitCode, err := vp.NodeExec(ctx, *node, cmd, stdout, stderr)
+	if err != nil {
+		return classify(ErrProvider, err)
+	}
+	if exitCode != 0 {
+		return classify(ErrCommand, fmt.Errorf("command exited with code %d on node %s", exitCode, name))
+	}
+	return nil
+}
+
+// Shell opens an interactive session on a single node using the vendor-specific shell.
+func Shell(ctx context.Context, data []byte, vp VirtProvider, name string, tty topology.TTY) error {
+	node, err := findNode(data, name)
+	if err != nil {
+		return err
+	}
+	exitCode, err := vp.NodeShell(ctx, *node, vendorShell(node), tty)
+	if err != nil {
+		return classify(ErrProvider, err)
+	}
+	if exitCode != 0 {
+		return classify(ErrCommand, fmt.Errorf("shell exited with code %d on node %s", exitCode, name))
 	}
 	return nil
 }
+
+// vendorShell returns the command starting an interactive session on the node.
+func vendorShell(node *topology.Node) []string {
+	if cmd := vendors.GetConfig(node.Vendor).Shell; len(cmd) != 0 {
+		return cmd
+	}
+	return []string{vendors.DefaultShell}
+}
+
+// Logs writes logs of a single node, streaming new output until the context is canceled if follow is set.
+func Logs(ctx context.Context, data []byte, vp VirtProvider, name string, follow bool, tail int, stdout, stderr io.Writer) error {
+	node, err := findNode(data, name)
+	if err != nil {
+		return err
+	}
+	return classify(ErrProvider, vp.NodeLogs(ctx, *node, follow, tail, stdout, stderr))
+}
+
+// Inspect writes the topology with all computed fields expanded in JSON format.
+// Resolved secret values are never included: secrets written as literal values are redacted,
+// while references to environment variables and files are kept.
+func Inspect(data []byte, out io.Writer) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	for name, ref := range topo.Secrets {
+		if !strings.HasPrefix(ref, "env:") && !strings.HasPrefix(ref, "file:") {
+			topo.Secrets[name] = "<redacted>"
+		}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(topo)
+}
+
+// hasLabels reports whether the labels contain all of the wanted key-value pairs.
+func hasLabels(labels, want map[string]string) bool {
+	for key, value := range want {
+		if got, ok := labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Top prints resource usage of all nodes in the topology.
+func Top(ctx context.Context, data []byte, vp VirtProvider, out io.Writer) error {
+	names, stats, err := collectStats(ctx, data, vp)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tCPU %\tMEM USAGE / LIMIT\tNET RX / TX\tPACKETS RX / TX")
+	for i, name := range names {
+		s := stats[i]
+		fmt.Fprintf(tw, "%s\t%.2f%%\t%s / %s\t%s / %s\t%d / %d\n", name, s.CPUPercent, formatBytes(s.MemUsage),
+			formatBytes(s.MemLimit), formatBytes(s.RxBytes), formatBytes(s.TxBytes), s.RxPackets, s.TxPackets)
+	}
+	return tw.Flush()
+}
+
+// TopInterfaces prints traffic counters of every interface of all nodes in the topology.
+func TopInterfaces(ctx context.Context, data []byte, vp VirtProvider, out io.Writer) error {
+	names, stats, err := collectStats(ctx, data, vp)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tINTERFACE\tNET RX / TX\tPACKETS RX / TX\tERRORS RX / TX\tDROPPED RX / TX")
+	for i, name := range names {
+		writeInterfaceStats(tw, name+"\t", stats[i].Interfaces)
+	}
+	return tw.Flush()
+}
+
+// writeInterfaceStats writes a row of counters for each interface, starting with the provided prefix.
+func writeInterfaceStats(w io.Writer, prefix string, ifaces []topology.InterfaceStats) {
+	for _, s := range ifaces {
+		fmt.Fprintf(w, "%s%s\t%s / %s\t%d / %d\t%d / %d\t%d / %d\n", prefix, s.Name, formatBytes(s.RxBytes),
+			formatBytes(s.TxBytes), s.RxPackets, s.TxPackets, s.RxErrors, s.TxErrors, s.RxDropped, s.TxDropped)
+	}
+}
+
+// collectStats queries resource usage of all nodes in the topology concurrently, returning it along
+// with the sorted node names.
+func collectStats(ctx context.Context, data []byte, vp VirtProvider) ([]string, []topology.NodeStats, error) {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return nil, nil, classify(ErrInvalidTopology, err)
+	}
+	names := slices.Sorted(maps.Keys(topo.Nodes))
+	stats := make([]topology.NodeStats, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i], errs[i] = vp.NodeStats(ctx, *topo.Nodes[name])
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return names, stats, nil
+}
+
+// findNode looks up a node by name in the topology described in the provided YAML intent file.
+func findNode(data []byte, name string) (*topology.Node, error) {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return nil, classify(ErrInvalidTopology, err)
+	}
+	node, ok := topo.Nodes[name]
+	if !ok {
+		return nil, classify(ErrUsage, fmt.Errorf("node %q not found in topology %q", name, topo.Name))
+	}
+	return node, nil
+}
+
+// formatBytes converts a number of bytes into a human-readable string.
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// Telemetry collects operational data from all nodes into the provided directory until the context is canceled.
+// Nodes failing to report are logged without interrupting the collection from the other nodes.
+func Telemetry(ctx context.Context, data []byte, vp VirtProvider, dir string, interval time.Duration, log *logger.Logger) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	return telemetry.Collect(ctx, topo, vp, dir, interval, log)
+}
+
+// Save preserves running configuration of all nodes in per-node directories under rootDir.
+// Names of the nodes saved before any failure are returned.
+func Save(ctx context.Context, data []byte, vp VirtProvider, rootDir string) ([]string, error) {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return nil, classify(ErrInvalidTopology, err)
+	}
+	saved, err := configsave.Save(ctx, topo, vp, rootDir)
+	return saved, classify(ErrConfig, err)
+}
+
+// writeSSHConfig records connection details of the SSH-enabled nodes in OpenSSH client format,
+// so that standard tooling can reach them with e.g. "ssh -F ssh_config R1".
+func writeSSHConfig(topo *topology.Topology, path string) error {
+	var sb strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		hostName, _, _ := strings.Cut(topo.Nodes[name].Mgmt.IPv4Addr, "/")
+		fmt.Fprintf(&sb, "Host %s\n  HostName %s\n  Port %d\n  User %s\n", name, hostName, topo.SSH.Port, topo.SSH.User)
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0o640)
+}
@@ -2,11 +2,20 @@ package orchestrator_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/elupevg/golab/orchestrator"
 	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
 )
 
 const testYAML = `
@@ -25,10 +34,15 @@ links:
 `
 
 type stubVirtProvider struct {
-	linkCount int
-	nodeCount int
-	linkErr   error
-	nodeErr   error
+	linkCount    int
+	nodeCount    int
+	created      []string
+	paused       []string
+	connected    []string
+	disconnected []string
+	power        []string
+	linkErr      error
+	nodeErr      error
 }
 
 func (s *stubVirtProvider) LinkCreate(_ context.Context, _ topology.Link) error {
@@ -47,11 +61,37 @@ func (s *stubVirtProvider) LinkRemove(_ context.Context, _ topology.Link) error
 	return nil
 }
 
-func (s *stubVirtProvider) NodeCreate(_ context.Context, _ topology.Node) error {
+func (s *stubVirtProvider) LinkConnect(_ context.Context, link topology.Link, nodes []topology.Node) error {
+	if s.linkErr != nil {
+		return s.linkErr
+	}
+	s.connected = append(s.connected, link.Name+":"+nodeNames(nodes))
+	return nil
+}
+
+func (s *stubVirtProvider) LinkDisconnect(_ context.Context, link topology.Link, nodes []topology.Node) error {
+	if s.linkErr != nil {
+		return s.linkErr
+	}
+	s.disconnected = append(s.disconnected, link.Name+":"+nodeNames(nodes))
+	return nil
+}
+
+// nodeNames joins names of the nodes a link is connected to.
+func nodeNames(nodes []topology.Node) string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return strings.Join(names, "-")
+}
+
+func (s *stubVirtProvider) NodeCreate(_ context.Context, node topology.Node) error {
 	if s.nodeErr != nil {
 		return s.nodeErr
 	}
 	s.nodeCount++
+	s.created = append(s.created, node.Name)
 	return nil
 }
 
@@ -63,16 +103,109 @@ func (s *stubVirtProvider) NodeRemove(_ context.Context, _ topology.Node) error
 	return nil
 }
 
+func (s *stubVirtProvider) NodeExec(_ context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	if s.nodeErr != nil {
+		return 0, s.nodeErr
+	}
+	if node.Name == "R2" {
+		fmt.Fprintln(stderr, "failed to run", strings.Join(cmd, " "))
+		return 1, nil
+	}
+	fmt.Fprintln(stdout, "ran", strings.Join(cmd, " "))
+	return 0, nil
+}
+
+func (s *stubVirtProvider) NodeStats(_ context.Context, node topology.Node) (topology.NodeStats, error) {
+	if s.nodeErr != nil {
+		return topology.NodeStats{}, s.nodeErr
+	}
+	index := uint64(node.Name[1] - '0')
+	return topology.NodeStats{
+		CPUPercent: float64(index) * 1.5,
+		MemUsage:   index << 20,
+		MemLimit:   1 << 30,
+		RxBytes:    index * 1000,
+		TxBytes:    index,
+		RxPackets:  index * 10,
+		TxPackets:  index,
+		Interfaces: []topology.InterfaceStats{
+			{Name: "eth0", RxBytes: index * 1000, TxBytes: index, RxPackets: index * 10, TxPackets: index, RxDropped: index},
+		},
+	}, nil
+}
+
+func (s *stubVirtProvider) NodeLogs(_ context.Context, node topology.Node, follow bool, tail int, stdout, _ io.Writer) error {
+	if s.nodeErr != nil {
+		return s.nodeErr
+	}
+	fmt.Fprintf(stdout, "%s logs (follow=%t, tail=%d)\n", node.Name, follow, tail)
+	return nil
+}
+
+func (s *stubVirtProvider) NodeShell(_ context.Context, node topology.Node, cmd []string, tty topology.TTY) (int, error) {
+	if s.nodeErr != nil {
+		return 0, s.nodeErr
+	}
+	fmt.Fprintf(tty.Out, "%s# %s (%dx%d)\n", node.Name, strings.Join(cmd, " "), tty.Width, tty.Height)
+	return 0, nil
+}
+
+func (s *stubVirtProvider) NodePause(_ context.Context, node topology.Node) error {
+	if s.nodeErr != nil {
+		return s.nodeErr
+	}
+	s.paused = append(s.paused, node.Name)
+	return nil
+}
+
+func (s *stubVirtProvider) NodeUnpause(_ context.Context, node topology.Node) error {
+	if s.nodeErr != nil {
+		return s.nodeErr
+	}
+	s.paused = slices.DeleteFunc(s.paused, func(name string) bool { return name == node.Name })
+	return nil
+}
+
+func (s *stubVirtProvider) NodeStop(_ context.Context, node topology.Node) error {
+	if s.nodeErr != nil {
+		return s.nodeErr
+	}
+	s.power = append(s.power, "stop "+node.Name)
+	return nil
+}
+
+func (s *stubVirtProvider) NodeStart(_ context.Context, node topology.Node) error {
+	if s.nodeErr != nil {
+		return s.nodeErr
+	}
+	s.power = append(s.power, "start "+node.Name)
+	return nil
+}
+
 type stubConfProvider struct {
-	err error
+	err     error
+	pushed  int
+	cleaned []string
 }
 
 func (s *stubConfProvider) GenerateAndDump(_ *topology.Topology, _ string) error {
 	return s.err
 }
 
-func (s *stubConfProvider) Cleanup(_ *topology.Topology, _ string) error {
-	return s.err
+func (s *stubConfProvider) Cleanup(topo *topology.Topology, _ string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.cleaned = append(s.cleaned, slices.Sorted(maps.Keys(topo.Nodes))...)
+	return nil
+}
+
+func (s *stubConfProvider) Push(_ context.Context, topo *topology.Topology) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.pushed += len(topo.Nodes)
+	return nil
 }
 
 func TestBuildWreck(t *testing.T) {
@@ -105,6 +238,80 @@ func TestBuildWreck(t *testing.T) {
 	}
 }
 
+func TestBuildWreckVeth(t *testing.T) {
+	t.Parallel()
+	data := `
+name: lacp
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    link_type: veth
+  - endpoints: [R1, R3]
+`
+	ctx := context.Background()
+	vp := new(stubVirtProvider)
+	if err := orchestrator.Build(ctx, []byte(data), vp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	if vp.linkCount != 1 {
+		t.Errorf("links: want 1, got %d", vp.linkCount)
+	}
+	if diff := cmp.Diff([]string{"golab-link-01:R1-R2"}, vp.connected); diff != "" {
+		t.Errorf("veth pairs mismatch (-want +got):\n%s", diff)
+	}
+	if err := orchestrator.Wreck(ctx, []byte(data), vp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	if vp.linkCount != 0 {
+		t.Errorf("links: want 0, got %d", vp.linkCount)
+	}
+}
+
+func TestBuildBootOrder(t *testing.T) {
+	t.Parallel()
+	data := `
+name: boot
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", depends_on: [R3]}
+  R2: {image: "quay.io/frrouting/frr:master", depends_on: [R1], boot_delay: 10ms}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2, R3]
+`
+	vp := new(stubVirtProvider)
+	if err := orchestrator.Build(context.Background(), []byte(data), vp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"R3", "R1", "R2"}, vp.created); diff != "" {
+		t.Errorf("created nodes mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildBootDelayCanceled(t *testing.T) {
+	t.Parallel()
+	data := `
+name: boot
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master", depends_on: [R1], boot_delay: 1h}
+links:
+  - endpoints: [R1, R2]
+`
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vp := new(stubVirtProvider)
+	err := orchestrator.Build(ctx, []byte(data), vp, new(stubConfProvider))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error: want %q, got %v", context.Canceled, err)
+	}
+	if diff := cmp.Diff([]string{"R1"}, vp.created); diff != "" {
+		t.Errorf("created nodes mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestBuildLinkError(t *testing.T) {
 	t.Parallel()
 	wantErr := errors.New("failed to create link")
@@ -212,3 +419,442 @@ func TestWreckConfigError(t *testing.T) {
 		t.Errorf("links: want %d, got %d", wantLinks, vp.linkCount)
 	}
 }
+
+func TestBuildWreckSyslog(t *testing.T) {
+	t.Setenv("PWD", t.TempDir())
+	ctx := context.Background()
+	vp := new(stubVirtProvider)
+	data := []byte(testYAML + "syslog: {}\n")
+	// build the topology together with the management network and collector
+	wantLinks, wantNodes := 3, 4
+	err := orchestrator.Build(ctx, data, vp, new(stubConfProvider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vp.nodeCount != wantNodes {
+		t.Fatalf("nodes: want %d, got %d", wantNodes, vp.nodeCount)
+	}
+	if vp.linkCount != wantLinks {
+		t.Fatalf("links: want %d, got %d", wantLinks, vp.linkCount)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("PWD"), "syslog")); err != nil {
+		t.Fatal(err)
+	}
+	// wreck the topology
+	err = orchestrator.Wreck(ctx, data, vp, new(stubConfProvider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vp.nodeCount != 0 || vp.linkCount != 0 {
+		t.Errorf("nodes and links: want 0 and 0, got %d and %d", vp.nodeCount, vp.linkCount)
+	}
+}
+
+func TestBuildWreckSSH(t *testing.T) {
+	labDir := t.TempDir()
+	t.Setenv("PWD", labDir)
+	keyPath := filepath.Join(labDir, "id_ed25519.pub")
+	if err := os.WriteFile(keyPath, []byte("ssh-ed25519 AAAA user@host\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	vp := new(stubVirtProvider)
+	data := []byte(testYAML + "ssh: {public_key: " + keyPath + "}\n")
+	// every node gets an SSH sidecar
+	wantNodes := 6
+	err := orchestrator.Build(ctx, data, vp, new(stubConfProvider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vp.nodeCount != wantNodes {
+		t.Fatalf("nodes: want %d, got %d", wantNodes, vp.nodeCount)
+	}
+	got, err := os.ReadFile(filepath.Join(labDir, "ssh_config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Host R1\n  HostName 10.255.254.1\n  Port 2222\n  User golab\n" +
+		"Host R2\n  HostName 10.255.254.2\n  Port 2222\n  User golab\n" +
+		"Host R3\n  HostName 10.255.254.3\n  Port 2222\n  User golab\n"
+	if want != string(got) {
+		t.Errorf("ssh_config: want %q, got %q", want, got)
+	}
+	// wreck removes sidecars and connection details
+	err = orchestrator.Wreck(ctx, data, vp, new(stubConfProvider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vp.nodeCount != 0 {
+		t.Errorf("nodes: want 0, got %d", vp.nodeCount)
+	}
+	if _, err := os.Stat(filepath.Join(labDir, "ssh_config")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ssh_config: want %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	t.Parallel()
+	yamlData := `
+name: example
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    labels: {role: spine, site: ams}
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    labels: {role: leaf, site: ams}
+  R3:
+    image: "quay.io/frrouting/frr:master"
+    labels: {role: spine, site: fra}
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R1, R3]
+`
+	testCases := []struct {
+		name    string
+		kind    string
+		labels  map[string]string
+		wantOut string
+		errMsg  string
+	}{
+		{
+			name: "AllNodes",
+			wantOut: "=== R1 (exit 0) ===\nran uptime\n" +
+				"=== R2 (exit 1) ===\nfailed to run uptime\n" +
+				"=== R3 (exit 0) ===\nran uptime\n",
+			errMsg: "command failed on 1 of 3 nodes: R2",
+		},
+		{
+			name:    "Label",
+			labels:  map[string]string{"role": "spine"},
+			wantOut: "=== R1 (exit 0) ===\nran uptime\n=== R3 (exit 0) ===\nran uptime\n",
+		},
+		{
+			name:    "KindAndLabels",
+			kind:    "frr",
+			labels:  map[string]string{"role": "spine", "site": "fra"},
+			wantOut: "=== R3 (exit 0) ===\nran uptime\n",
+		},
+		{
+			name:   "UnknownKind",
+			kind:   "ceos",
+			errMsg: `no nodes of kind "ceos" in topology "example"`,
+		},
+		{
+			name:   "UnmatchedLabels",
+			kind:   "frr",
+			labels: map[string]string{"role": "leaf", "site": "fra"},
+			errMsg: `no nodes of kind "frr" labeled role=leaf, site=fra in topology "example"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			out := new(strings.Builder)
+			err := orchestrator.Exec(context.Background(), []byte(yamlData), new(stubVirtProvider), tc.kind, tc.labels, []string{"uptime"}, out)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if tc.errMsg != errMsg {
+				t.Errorf("error: want %q, got %q", tc.errMsg, errMsg)
+			}
+			if strings.HasPrefix(tc.errMsg, "no nodes") && !errors.Is(err, orchestrator.ErrUsage) {
+				t.Errorf("error: want %v, got %v", orchestrator.ErrUsage, err)
+			}
+			if tc.wantOut != out.String() {
+				t.Errorf("output: want %q, got %q", tc.wantOut, out.String())
+			}
+		})
+	}
+}
+
+func TestExecNode(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name       string
+		node       string
+		wantStdout string
+		wantStderr string
+		errMsg     string
+	}{
+		{
+			name:       "Success",
+			node:       "R1",
+			wantStdout: "ran uptime\n",
+		},
+		{
+			name:       "NonZeroExitCode",
+			node:       "R2",
+			wantStderr: "failed to run uptime\n",
+			errMsg:     "command exited with code 1 on node R2",
+		},
+		{
+			name:   "UnknownNode",
+			node:   "R4",
+			errMsg: `node "R4" not found in topology "example"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout, stderr := new(strings.Builder), new(strings.Builder)
+			err := orchestrator.ExecNode(context.Background(), []byte(testYAML), new(stubVirtProvider), tc.node, []string{"uptime"}, stdout, stderr)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if tc.errMsg != errMsg {
+				t.Errorf("error: want %q, got %q", tc.errMsg, errMsg)
+			}
+			if tc.wantStdout != stdout.String() {
+				t.Errorf("stdout: want %q, got %q", tc.wantStdout, stdout.String())
+			}
+			if tc.wantStderr != stderr.String() {
+				t.Errorf("stderr: want %q, got %q", tc.wantStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestLogs(t *testing.T) {
+	t.Parallel()
+	out := new(strings.Builder)
+	err := orchestrator.Logs(context.Background(), []byte(testYAML), new(stubVirtProvider), "R3", true, 20, out, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "R3 logs (follow=true, tail=20)\n"
+	if want != out.String() {
+		t.Errorf("want %q, got %q", want, out.String())
+	}
+	wantMsg := `node "R4" not found in topology "example"`
+	err = orchestrator.Logs(context.Background(), []byte(testYAML), new(stubVirtProvider), "R4", false, -1, io.Discard, io.Discard)
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestShell(t *testing.T) {
+	t.Parallel()
+	data := strings.Replace(testYAML, "links:", "  R4:\n    image: \"alpine:latest\"\nlinks:", 1)
+	testCases := []struct {
+		node string
+		want string
+	}{
+		{node: "R1", want: "R1# vtysh (80x24)\n"},
+		{node: "R4", want: "R4# /bin/sh (80x24)\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.node, func(t *testing.T) {
+			out := new(strings.Builder)
+			tty := topology.TTY{In: strings.NewReader(""), Out: out, Height: 24, Width: 80}
+			err := orchestrator.Shell(context.Background(), []byte(data), new(stubVirtProvider), tc.node, tty)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want != out.String() {
+				t.Errorf("want %q, got %q", tc.want, out.String())
+			}
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+	secretFile := filepath.Join(t.TempDir(), "netconf.txt")
+	if err := os.WriteFile(secretFile, []byte("s3cr3t"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	data := `
+name: inspect
+secrets: {snmp: hunter2, netconf: "file:` + secretFile + `"}
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {bgp: true}
+    asn: 65001
+  R2:
+    image: "quay.io/frrouting/frr:master"
+  R3:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {bgp: true}
+    asn: 65003
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R1, R3]
+    bgp_password: s3cr3t
+`
+	out := new(strings.Builder)
+	if err := orchestrator.Inspect([]byte(data), out); err != nil {
+		t.Fatal(err)
+	}
+	var got topology.Topology
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Links[0].IPv4Gateway != "10.1.2.254" {
+		t.Errorf("link gateway: want %q, got %q", "10.1.2.254", got.Links[0].IPv4Gateway)
+	}
+	if n := len(got.Nodes["R1"].Interfaces); n != 2 {
+		t.Errorf("R1 interfaces: want 2, got %d", n)
+	}
+	// dual-stack peering with R3
+	if n := len(got.Nodes["R1"].BGPNeighbors); n != 2 {
+		t.Fatalf("R1 BGP neighbors: want 2, got %d", n)
+	}
+	if strings.Contains(out.String(), "s3cr3t") || strings.Contains(out.String(), "hunter2") {
+		t.Errorf("resolved secrets must not be exposed:\n%s", out.String())
+	}
+	wantSecrets := map[string]string{"snmp": "<redacted>", "netconf": "file:" + secretFile}
+	if diff := cmp.Diff(wantSecrets, got.Secrets); diff != "" {
+		t.Errorf("secrets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTop(t *testing.T) {
+	t.Parallel()
+	out := new(strings.Builder)
+	err := orchestrator.Top(context.Background(), []byte(testYAML), new(stubVirtProvider), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "NODE  CPU %  MEM USAGE / LIMIT  NET RX / TX  PACKETS RX / TX\n" +
+		"R1    1.50%  1.0MiB / 1.0GiB    1000B / 1B   10 / 1\n" +
+		"R2    3.00%  2.0MiB / 1.0GiB    2.0KiB / 2B  20 / 2\n" +
+		"R3    4.50%  3.0MiB / 1.0GiB    2.9KiB / 3B  30 / 3\n"
+	if want != out.String() {
+		t.Errorf("want %q, got %q", want, out.String())
+	}
+}
+
+func TestTopInterfaces(t *testing.T) {
+	t.Parallel()
+	out := new(strings.Builder)
+	err := orchestrator.TopInterfaces(context.Background(), []byte(testYAML), new(stubVirtProvider), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "NODE  INTERFACE  NET RX / TX  PACKETS RX / TX  ERRORS RX / TX  DROPPED RX / TX\n" +
+		"R1    eth0       1000B / 1B   10 / 1           0 / 0           1 / 0\n" +
+		"R2    eth0       2.0KiB / 2B  20 / 2           0 / 0           2 / 0\n" +
+		"R3    eth0       2.9KiB / 3B  30 / 3           0 / 0           3 / 0\n"
+	if want != out.String() {
+		t.Errorf("want %q, got %q", want, out.String())
+	}
+}
+
+func TestTopError(t *testing.T) {
+	t.Parallel()
+	wantErr := errors.New("failed to collect stats")
+	vp := &stubVirtProvider{nodeErr: wantErr}
+	err := orchestrator.Top(context.Background(), []byte(testYAML), vp, io.Discard)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("error: want %q, got %q", wantErr, err)
+	}
+}
+
+func TestBuildPush(t *testing.T) {
+	t.Parallel()
+	data := strings.Replace(testYAML, "config_mode: auto", "config_mode: push", 1) +
+		"push: {username: admin, password_secret: netconf}\nsecrets: {netconf: admin}\n"
+	vp, cp := new(stubVirtProvider), new(stubConfProvider)
+	err := orchestrator.Build(context.Background(), []byte(data), vp, cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.pushed != 3 {
+		t.Errorf("pushed configs: want 3, got %d", cp.pushed)
+	}
+	// the management network is required to reach the nodes
+	if vp.linkCount != 3 {
+		t.Errorf("links: want 3, got %d", vp.linkCount)
+	}
+}
+
+func TestSave(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	saved, err := orchestrator.Save(context.Background(), []byte(testYAML), new(stubVirtProvider), dir)
+	wantMsg := "node R2 failed to save configuration: exit code 1: failed to run vtysh -c write memory"
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+	if !errors.Is(err, orchestrator.ErrConfig) {
+		t.Errorf("error: want %v, got %v", orchestrator.ErrConfig, err)
+	}
+	if !slices.Equal(saved, []string{"R1"}) {
+		t.Errorf("saved nodes: want [R1], got %v", saved)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "R1", "frr.conf")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	t.Parallel()
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	if err := os.WriteFile(keyPath, []byte("ssh-ed25519 AAAA user@host\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(testYAML + "ssh: {public_key: " + keyPath + "}\nsyslog: {}\n")
+	vp := new(stubVirtProvider)
+	if err := orchestrator.Pause(context.Background(), data, vp); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"R1", "R1-ssh", "R2", "R2-ssh", "R3", "R3-ssh", "golab-syslog"}
+	if !slices.Equal(vp.paused, want) {
+		t.Errorf("paused nodes: want %v, got %v", want, vp.paused)
+	}
+	if err := orchestrator.Resume(context.Background(), data, vp); err != nil {
+		t.Fatal(err)
+	}
+	if len(vp.paused) != 0 {
+		t.Errorf("paused nodes: want none, got %v", vp.paused)
+	}
+	wantErr := errors.New("failed to pause container")
+	err := orchestrator.Pause(context.Background(), data, &stubVirtProvider{nodeErr: wantErr})
+	if !errors.Is(err, wantErr) || !errors.Is(err, orchestrator.ErrProvider) {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestStopStart(t *testing.T) {
+	t.Parallel()
+	data := []byte(`
+name: reconverge
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master", depends_on: [R2]}
+links:
+  - endpoints: [R1, R2]
+    link_type: veth
+  - endpoints: [R2, R3]
+`)
+	ctx := context.Background()
+	vp := new(stubVirtProvider)
+	if err := orchestrator.Stop(ctx, data, vp, nil); err != nil {
+		t.Fatal(err)
+	}
+	// nodes are stopped in reverse boot order and started in boot order
+	if err := orchestrator.Start(ctx, data, vp, []string{"R3", "R1"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"stop R3", "stop R2", "stop R1", "start R1", "start R3"}
+	if diff := cmp.Diff(want, vp.power); diff != "" {
+		t.Errorf("power events mismatch (-want +got):\n%s", diff)
+	}
+	// veth pairs of started nodes are wired anew
+	if diff := cmp.Diff([]string{"golab-link-01:R1-R2"}, vp.connected); diff != "" {
+		t.Errorf("veth pairs mismatch (-want +got):\n%s", diff)
+	}
+	err := orchestrator.Stop(ctx, data, vp, []string{"R9"})
+	if !errors.Is(err, orchestrator.ErrUsage) {
+		t.Errorf("error: want %q, got %v", orchestrator.ErrUsage, err)
+	}
+	wantErr := errors.New("failed to start container")
+	err = orchestrator.Start(ctx, data, &stubVirtProvider{nodeErr: wantErr}, nil)
+	if !errors.Is(err, wantErr) || !errors.Is(err, orchestrator.ErrProvider) {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
@@ -0,0 +1,245 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// PlanProvider is a VirtProvider able to report which objects of a lab are currently deployed.
+type PlanProvider interface {
+	VirtProvider
+	Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error)
+}
+
+// Action is the kind of change a plan makes to a single object.
+type Action string
+
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+// Change describes an action on a single link or node and the differences which cause it.
+type Change struct {
+	Action  Action
+	Kind    string
+	Name    string
+	Details []string
+}
+
+// Plan lists the changes required to bring the deployed lab in line with the topology.
+type Plan struct {
+	Lab     string
+	Changes []Change
+}
+
+// Empty reports whether the deployed lab already matches the topology.
+func (p Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Destructive reports whether the plan recreates or removes deployed objects, which interrupts the lab.
+func (p Plan) Destructive() bool {
+	return slices.ContainsFunc(p.Changes, func(change Change) bool { return change.Action != Create })
+}
+
+// Print writes the plan in a human-readable form similar to a diff.
+func (p Plan) Print(out io.Writer) {
+	if p.Empty() {
+		fmt.Fprintf(out, "No changes. Lab %s matches the topology.\n", p.Lab)
+		return
+	}
+	symbols := map[Action]string{Create: "+", Update: "~", Delete: "-"}
+	counts := make(map[Action]int)
+	for _, change := range p.Changes {
+		counts[change.Action]++
+		line := fmt.Sprintf("  %s %s %s %s", symbols[change.Action], change.Action, change.Kind, change.Name)
+		if len(change.Details) != 0 {
+			line += ": " + strings.Join(change.Details, ", ")
+		}
+		fmt.Fprintln(out, line)
+	}
+	fmt.Fprintf(out, "\nPlan: %d to create, %d to update, %d to delete.\n", counts[Create], counts[Update], counts[Delete])
+}
+
+// NewPlan compares the topology against objects deployed for its lab and lists the required changes.
+func NewPlan(ctx context.Context, data []byte, pp PlanProvider) (Plan, error) {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return Plan{}, classify(ErrInvalidTopology, err)
+	}
+	deployedNodes, deployedLinks, err := pp.Deployed(ctx, topo.Name)
+	if err != nil {
+		return Plan{}, classify(ErrProvider, err)
+	}
+	plan := Plan{Lab: topo.Name}
+	plan.Changes = append(plan.Changes, planLinks(links(topo), deployedLinks)...)
+	plan.Changes = append(plan.Changes, planNodes(containers(topo), deployedNodes)...)
+	return plan, nil
+}
+
+// planLinks compares desired links against deployed ones by their subnets and MTU.
+func planLinks(desired []*topology.Link, deployed []topology.Link) []Change {
+	current := make(map[string]topology.Link)
+	for _, link := range deployed {
+		current[link.Name] = link
+	}
+	var changes []Change
+	for _, link := range desired {
+		cur, ok := current[link.Name]
+		delete(current, link.Name)
+		if !ok {
+			changes = append(changes, Change{Action: Create, Kind: "link", Name: link.Name})
+			continue
+		}
+		var details []string
+		if cur.IPv4Subnet != link.IPv4Subnet {
+			details = append(details, fmt.Sprintf("ipv4_subnet %s -> %s", orNone(cur.IPv4Subnet), orNone(link.IPv4Subnet)))
+		}
+		if cur.IPv6Subnet != link.IPv6Subnet {
+			details = append(details, fmt.Sprintf("ipv6_subnet %s -> %s", orNone(cur.IPv6Subnet), orNone(link.IPv6Subnet)))
+		}
+		if cur.MTU != link.MTU {
+			details = append(details, fmt.Sprintf("mtu %s -> %s", orDefault(cur.MTU), orDefault(link.MTU)))
+		}
+		if len(details) != 0 {
+			changes = append(changes, Change{Action: Update, Kind: "link", Name: link.Name, Details: details})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		changes = append(changes, Change{Action: Delete, Kind: "link", Name: name})
+	}
+	slices.SortStableFunc(changes, func(a, b Change) int { return strings.Compare(a.Name, b.Name) })
+	return changes
+}
+
+// planNodes compares desired containers against deployed ones by their image and addresses.
+func planNodes(desired []*topology.Node, deployed []topology.Node) []Change {
+	current := make(map[string]topology.Node)
+	for _, node := range deployed {
+		current[node.Name] = node
+	}
+	var changes []Change
+	for _, node := range desired {
+		cur, ok := current[node.Name]
+		delete(current, node.Name)
+		if !ok {
+			changes = append(changes, Change{Action: Create, Kind: "node", Name: node.Name})
+			continue
+		}
+		var details []string
+		if cur.Image != node.Image {
+			details = append(details, fmt.Sprintf("image %s -> %s", cur.Image, node.Image))
+		}
+		curAddrs, addrs := attachments(&cur), attachments(node)
+		linkNames := append(slices.Collect(maps.Keys(curAddrs)), slices.Collect(maps.Keys(addrs))...)
+		slices.Sort(linkNames)
+		for _, link := range slices.Compact(linkNames) {
+			curAddr, curOK := curAddrs[link]
+			addr, ok := addrs[link]
+			switch {
+			case !curOK:
+				details = append(details, "attach "+link)
+			case !ok:
+				details = append(details, "detach "+link)
+			case curAddr != addr:
+				details = append(details, fmt.Sprintf("%s address %s -> %s", link, orNone(curAddr), orNone(addr)))
+			}
+		}
+		if len(details) != 0 {
+			changes = append(changes, Change{Action: Update, Kind: "node", Name: node.Name, Details: details})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		changes = append(changes, Change{Action: Delete, Kind: "node", Name: name})
+	}
+	slices.SortStableFunc(changes, func(a, b Change) int { return strings.Compare(a.Name, b.Name) })
+	return changes
+}
+
+// attachments maps links the node is connected to onto its IPv4 address without the prefix length.
+func attachments(node *topology.Node) map[string]string {
+	ifaces := node.Interfaces
+	if node.Mgmt != nil {
+		ifaces = append(slices.Clip(ifaces), node.Mgmt)
+	}
+	addrs := make(map[string]string, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.VLAN != 0 || iface.Veth {
+			continue
+		}
+		addrs[iface.Link], _, _ = strings.Cut(iface.IPv4Addr, "/")
+	}
+	return addrs
+}
+
+// orNone replaces an empty value with a placeholder in plan details.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// orDefault replaces an unset MTU with a placeholder in plan details.
+func orDefault(mtu int) string {
+	if mtu == 0 {
+		return "default"
+	}
+	return strconv.Itoa(mtu)
+}
+
+// Apply executes the plan: objects which are changed or no longer in the topology are removed,
+// after which Build creates whatever is missing.
+func Apply(ctx context.Context, data []byte, plan Plan, vp VirtProvider, cp ConfProvider) error {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	stale := &topology.Topology{Nodes: make(map[string]*topology.Node)}
+	var names []string
+	for _, change := range plan.Changes {
+		if change.Kind != "node" || change.Action == Create {
+			continue
+		}
+		names = append(names, change.Name)
+		// sidecars share the network namespace of their node, so they are recreated along with it
+		if node, ok := topo.Nodes[change.Name]; ok {
+			stale.Nodes[change.Name] = node
+			for _, sidecar := range node.Sidecars {
+				names = append(names, sidecar.Name)
+			}
+		}
+	}
+	// sidecars are named after their nodes and removed before them
+	slices.Sort(names)
+	for _, name := range slices.Backward(slices.Compact(names)) {
+		if err := vp.NodeRemove(ctx, topology.Node{Name: name}); err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	for _, change := range plan.Changes {
+		if change.Kind != "link" || change.Action == Create {
+			continue
+		}
+		if err := vp.LinkRemove(ctx, topology.Link{Name: change.Name}); err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	// configuration of recreated nodes has to be generated anew
+	if topo.ConfigMode == topology.Auto && len(stale.Nodes) != 0 {
+		if err := cp.Cleanup(stale, os.Getenv("PWD")); err != nil {
+			return classify(ErrConfig, err)
+		}
+	}
+	return Build(ctx, data, vp, cp)
+}
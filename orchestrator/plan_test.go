@@ -0,0 +1,198 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+// planProvider reports a fixed deployed state of the lab.
+type planProvider struct {
+	recordingVirtProvider
+	nodes []topology.Node
+	links []topology.Link
+	err   error
+}
+
+func (p *planProvider) Deployed(_ context.Context, _ string) ([]topology.Node, []topology.Link, error) {
+	return p.nodes, p.links, p.err
+}
+
+// deployed returns a provider reporting the topology as deployed, with its objects recorded as existing.
+func deployed(t *testing.T, data string) *planProvider {
+	t.Helper()
+	topo, err := topology.FromYAML([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := &planProvider{recordingVirtProvider: recordingVirtProvider{objects: make(map[string]bool)}}
+	for _, node := range topo.Nodes {
+		pp.nodes = append(pp.nodes, *node)
+		pp.objects[node.Name] = true
+	}
+	for _, link := range topo.Links {
+		pp.links = append(pp.links, *link)
+		pp.objects[link.Name] = true
+	}
+	return pp
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		deployed    string
+		want        string
+		destructive bool
+	}{
+		{
+			name: "NotDeployed",
+			want: `  + create link golab-link-01
+  + create link golab-link-02
+  + create node R1
+  + create node R2
+  + create node R3
+
+Plan: 5 to create, 0 to update, 0 to delete.
+`,
+		},
+		{
+			name:     "UpToDate",
+			deployed: testYAML,
+			want:     "No changes. Lab example matches the topology.\n",
+		},
+		{
+			name:     "MTU",
+			deployed: strings.Replace(testYAML, "  - endpoints: [R1, R2]\n", "  - endpoints: [R1, R2]\n    mtu: 9000\n", 1),
+			want: `  ~ update link golab-link-01: mtu 9000 -> default
+
+Plan: 0 to create, 1 to update, 0 to delete.
+`,
+			destructive: true,
+		},
+		{
+			name: "Drifted",
+			deployed: `
+name: example
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "quay.io/frrouting/frr:10.3.0"
+  R9:
+    image: "quay.io/frrouting/frr:master"
+links:
+  - endpoints: [R1, R2]
+    ipv4_subnet: 100.64.0.0/24
+  - endpoints: [R2, R9]
+`,
+			want: `  ~ update link golab-link-01: ipv4_subnet 100.64.0.0/24 -> 10.1.2.0/24
+  ~ update link golab-link-02: ipv4_subnet 10.2.9.0/24 -> 10.1.3.0/24, ipv6_subnet 2001:db8:2:9::/64 -> 2001:db8:1:3::/64
+  ~ update node R1: golab-link-01 address 100.64.0.1 -> 10.1.2.1, attach golab-link-02
+  ~ update node R2: image quay.io/frrouting/frr:10.3.0 -> quay.io/frrouting/frr:master, golab-link-01 address 100.64.0.2 -> 10.1.2.2, detach golab-link-02
+  + create node R3
+  - delete node R9
+
+Plan: 1 to create, 4 to update, 1 to delete.
+`,
+			destructive: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			pp := new(planProvider)
+			if tc.deployed != "" {
+				pp = deployed(t, tc.deployed)
+			}
+			plan, err := orchestrator.NewPlan(context.Background(), []byte(testYAML), pp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			plan.Print(&out)
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("plan mismatch (-want +got):\n%s", diff)
+			}
+			if plan.Destructive() != tc.destructive {
+				t.Errorf("destructive: want %t, got %t", tc.destructive, plan.Destructive())
+			}
+		})
+	}
+}
+
+func TestPlanProviderError(t *testing.T) {
+	t.Parallel()
+	wantErr := errors.New("docker daemon is unreachable")
+	_, err := orchestrator.NewPlan(context.Background(), []byte(testYAML), &planProvider{err: wantErr})
+	if !errors.Is(err, wantErr) || !errors.Is(err, orchestrator.ErrProvider) {
+		t.Errorf("want %q classified as provider failure, got %v", wantErr, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pp := deployed(t, strings.Replace(testYAML, "  R3:\n    image: \"quay.io/frrouting/frr:master\"", "  R3:\n    image: \"quay.io/frrouting/frr:latest\"\n  R4:\n    image: \"quay.io/frrouting/frr:master\"", 1))
+	cp := new(stubConfProvider)
+	plan, err := orchestrator.NewPlan(ctx, []byte(testYAML), pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orchestrator.Apply(ctx, []byte(testYAML), plan, pp, cp); err != nil {
+		t.Fatal(err)
+	}
+	wantEvents := []string{"remove R4", "remove R3", "create R3"}
+	if diff := cmp.Diff(wantEvents, pp.events); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	wantCleaned := []string{"R3"}
+	if diff := cmp.Diff(wantCleaned, cp.cleaned); diff != "" {
+		t.Errorf("cleaned configs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWreckDisabled(t *testing.T) {
+	t.Parallel()
+	// R3 and its link to R1 were disabled once the lab was built
+	pp := deployed(t, testYAML)
+	disabledYAML := strings.Replace(testYAML, "  R3:\n    image: \"quay.io/frrouting/frr:master\"", "  R3:\n    image: \"quay.io/frrouting/frr:master\"\n    disabled: true", 1)
+	disabledYAML = strings.Replace(disabledYAML, "  - endpoints: [R1, R3]", "  - endpoints: [R1, R3]\n    disabled: true", 1)
+	if err := orchestrator.Wreck(context.Background(), []byte(disabledYAML), pp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"R1", "R2", "R3", "golab-link-01", "golab-link-02"} {
+		if pp.objects[name] {
+			t.Errorf("object %s: want removed, got deployed", name)
+		}
+	}
+}
+
+func TestBuildRollback(t *testing.T) {
+	t.Parallel()
+	// R1 and its link to R2 are left over from a previous build, while R3 fails to be created
+	pp := deployed(t, "name: example\nnodes:\n  R1:\n    image: \"quay.io/frrouting/frr:master\"\n  R2:\n    image: \"quay.io/frrouting/frr:master\"\nlinks:\n  - endpoints: [R1, R2]\n")
+	delete(pp.objects, "R2")
+	pp.nodes = slices.DeleteFunc(pp.nodes, func(node topology.Node) bool { return node.Name == "R2" })
+	pp.failing = "R3"
+	cp := new(stubConfProvider)
+	err := orchestrator.Build(context.Background(), []byte(testYAML), pp, cp)
+	wantErr := "failed to create node R3"
+	if err == nil || err.Error() != wantErr {
+		t.Fatalf("error: want %q, got %v", wantErr, err)
+	}
+	wantEvents := []string{"create golab-link-02", "create R2", "remove R2", "remove golab-link-02"}
+	if diff := cmp.Diff(wantEvents, pp.events); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	wantCleaned := []string{"R2", "R3"}
+	if diff := cmp.Diff(wantCleaned, cp.cleaned); diff != "" {
+		t.Errorf("cleaned configs mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,187 @@
+package orchestrator
+
+import (
+	"context"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// Reconcile updates a topology built from oldData to match newData. Only nodes and links which are
+// removed or changed are deleted, after which Build creates whatever is missing, so that unaffected
+// parts of the lab keep running. Links added to or removed from running nodes are hot-plugged rather
+// than recreating the nodes. Without oldData, Reconcile is equivalent to Build.
+func Reconcile(ctx context.Context, oldData, newData []byte, vp VirtProvider, cp ConfProvider) error {
+	newTopo, err := topology.FromYAML(newData)
+	if err != nil {
+		return classify(ErrInvalidTopology, err)
+	}
+	var attached []hotplug
+	if oldData != nil {
+		oldTopo, err := topology.FromYAML(oldData)
+		if err != nil {
+			return classify(ErrInvalidTopology, err)
+		}
+		if attached, err = removeStale(ctx, oldTopo, newTopo, vp, cp); err != nil {
+			return err
+		}
+	}
+	if err := Build(ctx, newData, vp, cp); err != nil {
+		return err
+	}
+	// networks are attached to running nodes once created, while veth pairs are wired by Build
+	for _, hp := range attached {
+		if err := vp.LinkConnect(ctx, *hp.link, []topology.Node{*hp.node}); err != nil {
+			return classify(ErrProvider, err)
+		}
+	}
+	return nil
+}
+
+// hotplug is a link attached to a node which keeps running.
+type hotplug struct {
+	link *topology.Link
+	node *topology.Node
+}
+
+// removeStale deletes objects of the old topology which are absent or different in the new one. Nodes
+// which only gain or lose links keep running, with the links they lose disconnected right away and the
+// ones they gain returned to be connected once created.
+func removeStale(ctx context.Context, oldTopo, newTopo *topology.Topology, vp VirtProvider, cp ConfProvider) ([]hotplug, error) {
+	newNodes := make(map[string]*topology.Node)
+	for _, node := range containers(newTopo) {
+		newNodes[node.Name] = node
+	}
+	stale := &topology.Topology{Nodes: make(map[string]*topology.Node)}
+	var kept []string
+	oldNodes := containers(oldTopo)
+	// sidecars and services depend on the nodes, so they are removed first
+	slices.Reverse(oldNodes)
+	for _, node := range oldNodes {
+		_, isNode := oldTopo.Nodes[node.Name]
+		if sameNode(node, newNodes[node.Name]) || isNode && hotPluggable(node, newNodes[node.Name]) {
+			if isNode {
+				kept = append(kept, node.Name)
+			}
+			continue
+		}
+		if err := vp.NodeRemove(ctx, *node); err != nil {
+			return nil, classify(ErrProvider, err)
+		}
+		if isNode {
+			stale.Nodes[node.Name] = node
+		}
+	}
+	oldLinks, newLinks := linksByName(oldTopo), linksByName(newTopo)
+	changed := func(name string) bool { return !reflect.DeepEqual(oldLinks[name], newLinks[name]) }
+	// links are disconnected from the nodes which keep running before they are removed
+	var attached []hotplug
+	slices.Sort(kept)
+	for _, name := range kept {
+		oldIfaces, newIfaces := ifacesByLink(oldTopo.Nodes[name]), ifacesByLink(newTopo.Nodes[name])
+		for _, link := range slices.Sorted(maps.Keys(oldIfaces)) {
+			if _, ok := newIfaces[link]; ok && !changed(link) || oldIfaces[link].VLAN != 0 {
+				continue
+			}
+			if err := vp.LinkDisconnect(ctx, *oldLinks[link], []topology.Node{*oldTopo.Nodes[name]}); err != nil {
+				return nil, classify(ErrProvider, err)
+			}
+		}
+		for _, link := range slices.Sorted(maps.Keys(newIfaces)) {
+			if _, ok := oldIfaces[link]; ok && !changed(link) || newIfaces[link].VLAN != 0 || newLinks[link].Veth() {
+				continue
+			}
+			attached = append(attached, hotplug{link: newLinks[link], node: newTopo.Nodes[name]})
+		}
+	}
+	for _, link := range links(oldTopo) {
+		if !changed(link.Name) {
+			continue
+		}
+		if err := vp.LinkRemove(ctx, *link); err != nil {
+			return nil, classify(ErrProvider, err)
+		}
+	}
+	// configuration of recreated nodes has to be generated anew
+	if oldTopo.ConfigMode == topology.Auto && len(stale.Nodes) != 0 {
+		if err := cp.Cleanup(stale, os.Getenv("PWD")); err != nil {
+			return nil, classify(ErrConfig, err)
+		}
+	}
+	return attached, nil
+}
+
+// hotPluggable tells whether the nodes only differ in the links they are attached to, which are connected
+// and disconnected while the node keeps running. Interfaces on links of both nodes have to stay the same,
+// as renaming or readdressing them requires recreating the node, and so do subinterfaces.
+func hotPluggable(a, b *topology.Node) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	x, y := *a, *b
+	x.Interfaces, x.BGPNeighbors = nil, nil
+	y.Interfaces, y.BGPNeighbors = nil, nil
+	// nodes wired with veth pairs only are not attached to any network, which cannot be hot-plugged,
+	// and neither are VMs, which are booted with a fixed set of NICs
+	if !sameNode(&x, &y) || a.VethOnly() != b.VethOnly() || a.VM() {
+		return false
+	}
+	oldIfaces, newIfaces := ifacesByLink(a), ifacesByLink(b)
+	for link, iface := range oldIfaces {
+		newIface, ok := newIfaces[link]
+		if ok && !reflect.DeepEqual(iface, newIface) || !ok && iface.VLAN != 0 {
+			return false
+		}
+	}
+	for link, iface := range newIfaces {
+		if _, ok := oldIfaces[link]; !ok && iface.VLAN != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ifacesByLink maps links the node is attached to onto its interfaces.
+func ifacesByLink(node *topology.Node) map[string]*topology.Interface {
+	ifaces := make(map[string]*topology.Interface, len(node.Interfaces))
+	for _, iface := range node.Interfaces {
+		ifaces[iface.Link] = iface
+	}
+	return ifaces
+}
+
+// linksByName maps names of all links of the topology, including veth links and the management network, onto them.
+func linksByName(topo *topology.Topology) map[string]*topology.Link {
+	byName := make(map[string]*topology.Link, len(topo.Links)+1)
+	for _, link := range topo.Links {
+		byName[link.Name] = link
+	}
+	if topo.Mgmt != nil {
+		byName[topo.Mgmt.Name] = topo.Mgmt
+	}
+	return byName
+}
+
+// sameNode tells whether the nodes are deployed identically, i.e. equal apart from their diagram layout.
+func sameNode(a, b *topology.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	x, y := *a, *b
+	x.Position, x.Group = nil, ""
+	y.Position, y.Group = nil, ""
+	return reflect.DeepEqual(x, y)
+}
+
+// links lists all links of the topology implemented as networks, including the management network.
+// Veth pairs are wired along with their nodes instead, while VLAN links ride on their trunks.
+func links(topo *topology.Topology) []*topology.Link {
+	networks := slices.DeleteFunc(slices.Clone(topo.Links), func(link *topology.Link) bool { return link.Veth() || link.Tagged() })
+	if topo.Mgmt == nil {
+		return networks
+	}
+	return append(networks, topo.Mgmt)
+}
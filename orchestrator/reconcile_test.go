@@ -0,0 +1,137 @@
+package orchestrator_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+// recordingVirtProvider tracks existing objects and records changes made to them.
+type recordingVirtProvider struct {
+	stubVirtProvider
+	objects map[string]bool
+	events  []string
+	// failing is the name of a node which fails to be created
+	failing string
+}
+
+func (r *recordingVirtProvider) record(event, name string, exists bool) {
+	if r.objects[name] == exists {
+		return
+	}
+	r.objects[name] = exists
+	r.events = append(r.events, event+" "+name)
+}
+
+func (r *recordingVirtProvider) LinkCreate(_ context.Context, link topology.Link) error {
+	r.record("create", link.Name, true)
+	return nil
+}
+
+func (r *recordingVirtProvider) LinkRemove(_ context.Context, link topology.Link) error {
+	r.record("remove", link.Name, false)
+	return nil
+}
+
+func (r *recordingVirtProvider) NodeCreate(_ context.Context, node topology.Node) error {
+	if node.Name == r.failing {
+		return fmt.Errorf("failed to create node %s", node.Name)
+	}
+	r.record("create", node.Name, true)
+	return nil
+}
+
+func (r *recordingVirtProvider) NodeRemove(_ context.Context, node topology.Node) error {
+	r.record("remove", node.Name, false)
+	return nil
+}
+
+func (r *recordingVirtProvider) LinkConnect(_ context.Context, link topology.Link, nodes []topology.Node) error {
+	r.events = append(r.events, "connect "+link.Name+":"+nodeNames(nodes))
+	return nil
+}
+
+func (r *recordingVirtProvider) LinkDisconnect(_ context.Context, link topology.Link, nodes []topology.Node) error {
+	r.events = append(r.events, "disconnect "+link.Name+":"+nodeNames(nodes))
+	return nil
+}
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	vmYAML := strings.Replace(testYAML, "  R3:\n    image: \"quay.io/frrouting/frr:master\"", "  R3:\n    image: \"images/r3.qcow2\"", 1)
+	testCases := []struct {
+		name        string
+		oldYAML     string
+		newYAML     string
+		wantEvents  []string
+		wantCleaned []string
+	}{
+		{
+			name:    "Unchanged",
+			newYAML: testYAML,
+		},
+		{
+			name:        "ChangedNode",
+			newYAML:     strings.Replace(testYAML, "  R3:\n    image: \"quay.io/frrouting/frr:master\"", "  R3:\n    image: \"quay.io/frrouting/frr:latest\"", 1),
+			wantEvents:  []string{"remove R3", "create R3"},
+			wantCleaned: []string{"R3"},
+		},
+		{
+			name:    "MovedNode",
+			newYAML: strings.Replace(testYAML, "  R3:\n    image: \"quay.io/frrouting/frr:master\"", "  R3:\n    image: \"quay.io/frrouting/frr:master\"\n    position: {x: 10, y: 20}\n    group: edge", 1),
+		},
+		{
+			name:        "RemovedNode",
+			newYAML:     strings.Replace(strings.Replace(testYAML, "  R3:\n    image: \"quay.io/frrouting/frr:master\"\n", "", 1), "  - endpoints: [R1, R3]\n", "", 1),
+			wantEvents:  []string{"remove R3", "disconnect golab-link-02:R1", "remove golab-link-02"},
+			wantCleaned: []string{"R3"},
+		},
+		{
+			name:       "AddedLink",
+			newYAML:    testYAML + "  - endpoints: [R2, R3]\n",
+			wantEvents: []string{"create golab-link-03", "connect golab-link-03:R2", "connect golab-link-03:R3"},
+		},
+		{
+			name:       "ChangedLink",
+			newYAML:    strings.Replace(testYAML, "  - endpoints: [R1, R3]\n", "  - endpoints: [R1, R3]\n    mtu: 9000\n", 1),
+			wantEvents: []string{"disconnect golab-link-02:R1", "disconnect golab-link-02:R3", "remove golab-link-02", "create golab-link-02", "connect golab-link-02:R1", "connect golab-link-02:R3"},
+		},
+		{
+			name:        "AddedLinkToVM",
+			oldYAML:     vmYAML,
+			newYAML:     vmYAML + "  - endpoints: [R2, R3]\n",
+			wantEvents:  []string{"remove R3", "create golab-link-03", "create R3", "connect golab-link-03:R2"},
+			wantCleaned: []string{"R3"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			oldYAML := tc.oldYAML
+			if oldYAML == "" {
+				oldYAML = testYAML
+			}
+			vp := &recordingVirtProvider{objects: make(map[string]bool)}
+			cp := new(stubConfProvider)
+			if err := orchestrator.Reconcile(ctx, nil, []byte(oldYAML), vp, cp); err != nil {
+				t.Fatal(err)
+			}
+			vp.events = nil
+			if err := orchestrator.Reconcile(ctx, []byte(oldYAML), []byte(tc.newYAML), vp, cp); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantEvents, vp.events); diff != "" {
+				t.Errorf("events mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantCleaned, cp.cleaned); diff != "" {
+				t.Errorf("cleaned configs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package orchestrator
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// SnapshotProvider is a VirtProvider able to commit the filesystem of a node to an image.
+type SnapshotProvider interface {
+	VirtProvider
+	NodeCommit(ctx context.Context, node topology.Node, ref string) error
+}
+
+// Snapshot commits every node of the lab to an image with the tag and returns the image references.
+// The lab is restored from the images by building it with the snapshot set to the tag. Sidecars and
+// services are not committed, as they are rebuilt from their own images.
+func Snapshot(ctx context.Context, data []byte, sp SnapshotProvider, tag string) ([]string, error) {
+	topo, err := topology.FromYAML(data)
+	if err != nil {
+		return nil, classify(ErrInvalidTopology, err)
+	}
+	var refs []string
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		ref := topology.SnapshotImage(topo.Name, name, tag)
+		if err := sp.NodeCommit(ctx, *topo.Nodes[name], ref); err != nil {
+			return refs, classify(ErrProvider, err)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
@@ -0,0 +1,64 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+// snapshotProvider records the images the nodes are committed to.
+type snapshotProvider struct {
+	stubVirtProvider
+	commits map[string]string
+	err     error
+}
+
+func (s *snapshotProvider) NodeCommit(_ context.Context, node topology.Node, ref string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.commits[node.Name] = ref
+	return nil
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+	data := []byte(`
+name: Lab1
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+`)
+	ctx := context.Background()
+	sp := &snapshotProvider{commits: make(map[string]string)}
+	refs, err := orchestrator.Snapshot(ctx, data, sp, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"golab-snapshot/lab1/r1:v1", "golab-snapshot/lab1/r2:v1"}
+	if diff := cmp.Diff(want, refs); diff != "" {
+		t.Errorf("refs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"R1": want[0], "R2": want[1]}, sp.commits); diff != "" {
+		t.Errorf("commits mismatch (-want +got):\n%s", diff)
+	}
+	// a lab built from the snapshot runs the committed images
+	topo, err := topology.FromYAML(append(data, "---\nsnapshot: v1\n"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := topo.Nodes["R2"].Image; got != want[1] {
+		t.Errorf("image: want %q, got %q", want[1], got)
+	}
+	wantErr := errors.New("failed to commit container")
+	_, err = orchestrator.Snapshot(ctx, data, &snapshotProvider{err: wantErr}, "v1")
+	if !errors.Is(err, wantErr) || !errors.Is(err, orchestrator.ErrProvider) {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
@@ -0,0 +1,49 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/elupevg/golab/topology"
+)
+
+// createSubinterfaces adds VLAN subinterfaces on top of the parent interfaces inside the nodes
+// and brings them up. Unlike the interfaces attached by the provider, subinterfaces are addressed
+// here as well, so that nodes without generated configs work. Subinterfaces that already exist,
+// e.g. on a repeated build, are kept.
+func createSubinterfaces(ctx context.Context, topo *topology.Topology, vp VirtProvider) error {
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		node := topo.Nodes[name]
+		for _, iface := range node.Interfaces {
+			if iface.VLAN == 0 {
+				continue
+			}
+			exitCode, err := vp.NodeExec(ctx, *node, []string{"ip", "link", "show", "dev", iface.Name}, io.Discard, io.Discard)
+			if err != nil {
+				return fmt.Errorf("node %s failed to create subinterface %s: %w", name, iface.Name, err)
+			}
+			if exitCode != 0 {
+				cmd := []string{"ip", "link", "add", "link", iface.Parent, "name", iface.Name, "type", "vlan", "id", strconv.Itoa(iface.VLAN)}
+				if err := run(ctx, vp, node, cmd); err != nil {
+					return fmt.Errorf("node %s failed to create subinterface %s: %w", name, iface.Name, err)
+				}
+			}
+			for _, addr := range []string{iface.IPv4Addr, iface.IPv6Addr} {
+				if addr == "" {
+					continue
+				}
+				if err := run(ctx, vp, node, []string{"ip", "address", "replace", addr, "dev", iface.Name}); err != nil {
+					return fmt.Errorf("node %s failed to address subinterface %s: %w", name, iface.Name, err)
+				}
+			}
+			if err := run(ctx, vp, node, []string{"ip", "link", "set", "dev", iface.Name, "up"}); err != nil {
+				return fmt.Errorf("node %s failed to bring up subinterface %s: %w", name, iface.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package orchestrator_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+const vlanYAML = `
+name: vlans
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "quay.io/frrouting/frr:master"
+links:
+  - endpoints: [R1, R2]
+    ip: none
+  - endpoints: ["R1:eth0.100", "R2:eth0.100"]
+    delay: 10ms
+`
+
+// vlanVirtProvider records commands run on nodes, reporting subinterfaces of the existing list as present.
+type vlanVirtProvider struct {
+	execRecordingVirtProvider
+	existing []string
+}
+
+func (v *vlanVirtProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	if strings.HasPrefix(strings.Join(cmd, " "), "ip link show") {
+		for _, name := range v.existing {
+			if node.Name+":"+cmd[len(cmd)-1] == name {
+				return 0, nil
+			}
+		}
+		return 1, nil
+	}
+	return v.execRecordingVirtProvider.NodeExec(ctx, node, cmd, stdout, stderr)
+}
+
+func TestBuildSubinterfaces(t *testing.T) {
+	t.Parallel()
+	vp := &vlanVirtProvider{existing: []string{"R2:eth0.100"}}
+	if err := orchestrator.Build(context.Background(), []byte(vlanYAML), vp, new(stubConfProvider)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"R1: ip link add link eth0 name eth0.100 type vlan id 100",
+		"R1: ip address replace 10.1.2.1/24 dev eth0.100",
+		"R1: ip address replace 2001:db8:1:2::1/64 dev eth0.100",
+		"R1: ip link set dev eth0.100 up",
+		"R2: ip address replace 10.1.2.2/24 dev eth0.100",
+		"R2: ip address replace 2001:db8:1:2::2/64 dev eth0.100",
+		"R2: ip link set dev eth0.100 up",
+		"R1: tc -V",
+		"R2: tc -V",
+		"R1: tc qdisc replace dev eth0.100 root netem delay 10000us",
+		"R2: tc qdisc replace dev eth0.100 root netem delay 10000us",
+	}
+	if diff := cmp.Diff(want, vp.cmds); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	// the VLAN link rides on the trunk rather than on a network of its own
+	if vp.linkCount != 1 {
+		t.Errorf("link count: want 1, got %d", vp.linkCount)
+	}
+}
+
+func TestBuildSubinterfacesError(t *testing.T) {
+	t.Parallel()
+	err := orchestrator.Build(context.Background(), []byte(vlanYAML), new(stubVirtProvider), new(stubConfProvider))
+	wantMsg := "node R2 failed to create subinterface eth0.100: exit code 1: failed to run ip link add link eth0 name eth0.100 type vlan id 100"
+	if err == nil || err.Error() != wantMsg || !errors.Is(err, orchestrator.ErrProvider) {
+		t.Errorf("error: want %q classified as provider failure, got %v", wantMsg, err)
+	}
+}
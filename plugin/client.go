@@ -0,0 +1,303 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elupevg/golab/topology"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	// handshakeTimeout limits how long a plugin may take to announce its address.
+	handshakeTimeout = 30 * time.Second
+	// exitTimeout limits how long a plugin may take to exit once stdin is closed.
+	exitTimeout = 10 * time.Second
+)
+
+// PluginProvider stores the process of a plugin and the gRPC connection to it.
+type PluginProvider struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	conn  *grpc.ClientConn
+	// logged is closed once the logs the plugin writes to stdout after the handshake are copied.
+	logged chan struct{}
+}
+
+// Open starts the plugin binary at the path and connects to it once it completes the handshake. Logs of
+// the plugin, i.e. its stderr and whatever it writes to stdout after the handshake, are copied to stderr.
+func Open(ctx context.Context, path string, stderr io.Writer) (*PluginProvider, error) {
+	name := strings.TrimPrefix(filepath.Base(path), binaryPrefix)
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), MagicCookieKey+"="+MagicCookieValue)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", name, err)
+	}
+	pp := &PluginProvider{name: name, cmd: cmd, stdin: stdin}
+	reader := bufio.NewReader(stdout)
+	socket, err := handshake(ctx, name, reader)
+	if err != nil {
+		return nil, errors.Join(err, pp.Close())
+	}
+	pp.logged = make(chan struct{})
+	go func() {
+		io.Copy(stderr, reader)
+		close(pp.logged)
+	}()
+	pp.conn, err = grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Join(err, pp.Close())
+	}
+	return pp, nil
+}
+
+// handshake reads the first line the plugin writes to stdout, e.g. "1|unix|/tmp/plugin.sock", and returns the socket.
+func handshake(ctx context.Context, name string, stdout *bufio.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := stdout.ReadString('\n')
+		lines <- strings.TrimSpace(line)
+	}()
+	var line string
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("plugin %s did not complete the handshake: %w", name, ctx.Err())
+	case line = <-lines:
+	}
+	parts := strings.Split(line, "|")
+	if len(parts) != 3 || parts[1] != "unix" {
+		return "", fmt.Errorf("plugin %s completed the handshake with %q, VERSION|unix|SOCKET expected", name, line)
+	}
+	if version, err := strconv.Atoi(parts[0]); err != nil || version != ProtocolVersion {
+		return "", fmt.Errorf("plugin %s speaks protocol version %s, while golab speaks %d", name, parts[0], ProtocolVersion)
+	}
+	return parts[2], nil
+}
+
+// Close disconnects from the plugin and closes its stdin, which makes it exit, killing it if it does not.
+func (pp *PluginProvider) Close() error {
+	var errs []error
+	if pp.conn != nil {
+		errs = append(errs, pp.conn.Close())
+	}
+	errs = append(errs, pp.stdin.Close())
+	exited := make(chan error, 1)
+	go func() {
+		// stdout has to be read to the end before waiting, which closes it
+		if pp.logged != nil {
+			<-pp.logged
+		}
+		exited <- pp.cmd.Wait()
+	}()
+	select {
+	case err := <-exited:
+		if err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", pp.name, err))
+		}
+	case <-time.After(exitTimeout):
+		errs = append(errs, pp.cmd.Process.Kill(), fmt.Errorf("plugin %s did not exit in %s and was killed", pp.name, exitTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+// fullMethod returns the full name of the method of the service.
+func fullMethod(method string) string {
+	return "/" + serviceName + "/" + method
+}
+
+// fromStatus turns errors returned by the plugin back into plain errors, keeping errors of the connection as they are.
+func fromStatus(err error) error {
+	if s, ok := status.FromError(err); ok && s.Code() == codes.Unknown {
+		return errors.New(s.Message())
+	}
+	return err
+}
+
+// call invokes the unary method of the plugin with the request and returns the response.
+func (pp *PluginProvider) call(ctx context.Context, method string, req request) (response, error) {
+	var resp response
+	in, err := encode(req)
+	if err != nil {
+		return resp, err
+	}
+	out := new(wrapperspb.BytesValue)
+	if err := pp.conn.Invoke(ctx, fullMethod(method), in, out); err != nil {
+		return resp, fromStatus(err)
+	}
+	return resp, decode(out, &resp)
+}
+
+// stream invokes the streaming method of the plugin with the request, writing the chunks of output it
+// streams to stdout and stderr, and returns the final response.
+func (pp *PluginProvider) stream(ctx context.Context, method string, req request, stdout, stderr io.Writer) (response, error) {
+	var last response
+	in, err := encode(req)
+	if err != nil {
+		return last, err
+	}
+	desc := &grpc.StreamDesc{StreamName: method, ServerStreams: true}
+	stream, err := pp.conn.NewStream(ctx, desc, fullMethod(method))
+	if err != nil {
+		return last, fromStatus(err)
+	}
+	if err := stream.SendMsg(in); err != nil {
+		return last, fromStatus(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return last, fromStatus(err)
+	}
+	for {
+		out := new(wrapperspb.BytesValue)
+		if err := stream.RecvMsg(out); err == io.EOF {
+			return last, nil
+		} else if err != nil {
+			return last, fromStatus(err)
+		}
+		var resp response
+		if err := decode(out, &resp); err != nil {
+			return last, err
+		}
+		if _, err := stdout.Write(resp.Stdout); err != nil {
+			return last, err
+		}
+		if _, err := stderr.Write(resp.Stderr); err != nil {
+			return last, err
+		}
+		last = resp
+	}
+}
+
+// LinkCreate creates the link by the plugin.
+func (pp *PluginProvider) LinkCreate(ctx context.Context, link topology.Link) error {
+	_, err := pp.call(ctx, "LinkCreate", request{Link: link})
+	return err
+}
+
+// LinkRemove removes the link by the plugin.
+func (pp *PluginProvider) LinkRemove(ctx context.Context, link topology.Link) error {
+	_, err := pp.call(ctx, "LinkRemove", request{Link: link})
+	return err
+}
+
+// LinkConnect attaches the nodes to the link by the plugin.
+func (pp *PluginProvider) LinkConnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	_, err := pp.call(ctx, "LinkConnect", request{Link: link, Nodes: nodes})
+	return err
+}
+
+// LinkDisconnect detaches the nodes from the link by the plugin.
+func (pp *PluginProvider) LinkDisconnect(ctx context.Context, link topology.Link, nodes []topology.Node) error {
+	_, err := pp.call(ctx, "LinkDisconnect", request{Link: link, Nodes: nodes})
+	return err
+}
+
+// NodeCreate creates the node by the plugin.
+func (pp *PluginProvider) NodeCreate(ctx context.Context, node topology.Node) error {
+	_, err := pp.call(ctx, "NodeCreate", request{Node: node})
+	return err
+}
+
+// NodeRemove removes the node by the plugin.
+func (pp *PluginProvider) NodeRemove(ctx context.Context, node topology.Node) error {
+	_, err := pp.call(ctx, "NodeRemove", request{Node: node})
+	return err
+}
+
+// NodeExec executes the command on the node by the plugin, streaming its output.
+func (pp *PluginProvider) NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	resp, err := pp.stream(ctx, "NodeExec", request{Node: node, Cmd: cmd}, stdout, stderr)
+	return resp.ExitCode, err
+}
+
+// NodeStats reports resource usage of the node by the plugin.
+func (pp *PluginProvider) NodeStats(ctx context.Context, node topology.Node) (topology.NodeStats, error) {
+	resp, err := pp.call(ctx, "NodeStats", request{Node: node})
+	if err != nil || resp.Stats == nil {
+		return topology.NodeStats{}, err
+	}
+	return *resp.Stats, nil
+}
+
+// NodeLogs writes logs of the node streamed by the plugin.
+func (pp *PluginProvider) NodeLogs(ctx context.Context, node topology.Node, follow bool, tail int, stdout, stderr io.Writer) error {
+	_, err := pp.stream(ctx, "NodeLogs", request{Node: node, Follow: follow, Tail: tail}, stdout, stderr)
+	return err
+}
+
+// NodeShell is not supported, as the protocol does not carry interactive terminals.
+func (pp *PluginProvider) NodeShell(_ context.Context, _ topology.Node, _ []string, _ topology.TTY) (int, error) {
+	return 0, fmt.Errorf("interactive shells are not supported by plugin %s", pp.name)
+}
+
+// NodePause pauses the node by the plugin.
+func (pp *PluginProvider) NodePause(ctx context.Context, node topology.Node) error {
+	_, err := pp.call(ctx, "NodePause", request{Node: node})
+	return err
+}
+
+// NodeUnpause resumes the node by the plugin.
+func (pp *PluginProvider) NodeUnpause(ctx context.Context, node topology.Node) error {
+	_, err := pp.call(ctx, "NodeUnpause", request{Node: node})
+	return err
+}
+
+// NodeStop stops the node by the plugin.
+func (pp *PluginProvider) NodeStop(ctx context.Context, node topology.Node) error {
+	_, err := pp.call(ctx, "NodeStop", request{Node: node})
+	return err
+}
+
+// NodeStart starts the node by the plugin.
+func (pp *PluginProvider) NodeStart(ctx context.Context, node topology.Node) error {
+	_, err := pp.call(ctx, "NodeStart", request{Node: node})
+	return err
+}
+
+// NodeRunning checks whether the node is running by the plugin.
+func (pp *PluginProvider) NodeRunning(ctx context.Context, node topology.Node) (bool, error) {
+	resp, err := pp.call(ctx, "NodeRunning", request{Node: node})
+	return resp.Running, err
+}
+
+// NodeCommit commits the node to an image with the reference by the plugin.
+func (pp *PluginProvider) NodeCommit(ctx context.Context, node topology.Node, ref string) error {
+	_, err := pp.call(ctx, "NodeCommit", request{Node: node, Ref: ref})
+	return err
+}
+
+// Deployed reports the objects of the lab deployed by the plugin.
+func (pp *PluginProvider) Deployed(ctx context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	resp, err := pp.call(ctx, "Deployed", request{Lab: lab})
+	return resp.Nodes, resp.Links, err
+}
+
+// RemoveOrphans removes the objects of the lab, or of any lab if it is empty, by the plugin.
+func (pp *PluginProvider) RemoveOrphans(ctx context.Context, lab string) error {
+	_, err := pp.call(ctx, "RemoveOrphans", request{Lab: lab})
+	return err
+}
@@ -0,0 +1,67 @@
+// Package plugin provides out-of-tree providers, e.g. for proprietary hypervisors, shipped as separate
+// binaries named golab-provider-NAME and selected with --provider NAME. golab starts the binary and talks
+// to it over gRPC with the protocol defined in provider.proto. Plugins written in Go implement Provider
+// and call Serve from their main function.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/elupevg/golab/orchestrator"
+	"github.com/elupevg/golab/topology"
+)
+
+const (
+	// ProtocolVersion is the version of the protocol announced by plugins in their handshake.
+	ProtocolVersion = 1
+	// MagicCookieKey and MagicCookieValue are set in the environment of plugins started by golab,
+	// which keeps plugin binaries from being run by mistake.
+	MagicCookieKey   = "GOLAB_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "4c1f7e0a9d2b46e8b3a5c6d7e8f90123"
+	// binaryPrefix starts the names of plugin binaries, which end in the name of the provider.
+	binaryPrefix = "golab-provider-"
+	// serviceName is the full name of the gRPC service of plugins.
+	serviceName = "golab.plugin.v1.Provider"
+)
+
+// Provider represents a provider served by a plugin and its methods, which are the ones golab commands use.
+type Provider interface {
+	orchestrator.PlanProvider
+	orchestrator.DashboardProvider
+	orchestrator.SnapshotProvider
+	RemoveOrphans(ctx context.Context, lab string) error
+}
+
+// request holds the arguments of a call as encoded in request messages.
+type request struct {
+	Link   topology.Link   `json:"link"`
+	Node   topology.Node   `json:"node"`
+	Nodes  []topology.Node `json:"nodes,omitempty"`
+	Cmd    []string        `json:"cmd,omitempty"`
+	Follow bool            `json:"follow,omitempty"`
+	Tail   int             `json:"tail,omitempty"`
+	Ref    string          `json:"ref,omitempty"`
+	Lab    string          `json:"lab,omitempty"`
+}
+
+// response holds the results of a call, or a chunk of output of a streaming call, as encoded in response messages.
+type response struct {
+	Stats    *topology.NodeStats `json:"stats,omitempty"`
+	Running  bool                `json:"running,omitempty"`
+	Nodes    []topology.Node     `json:"nodes,omitempty"`
+	Links    []topology.Link     `json:"links,omitempty"`
+	Stdout   []byte              `json:"stdout,omitempty"`
+	Stderr   []byte              `json:"stderr,omitempty"`
+	ExitCode int                 `json:"exit_code,omitempty"`
+}
+
+// Lookup returns the path of the binary of the plugin providing the named provider, searched for in PATH.
+func Lookup(name string) (string, error) {
+	path, err := exec.LookPath(binaryPrefix + name)
+	if err != nil {
+		return "", fmt.Errorf("provider %q is neither built in nor provided by a %s%s plugin in PATH", name, binaryPrefix, name)
+	}
+	return path, nil
+}
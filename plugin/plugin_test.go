@@ -0,0 +1,170 @@
+package plugin_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elupevg/golab/dryrun"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/plugin"
+	"github.com/elupevg/golab/topology"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeProvider logs the changes it is asked to make like the dry-run provider, while running nodes and
+// reporting deployed objects of its own.
+type fakeProvider struct {
+	*dryrun.DryRunProvider
+}
+
+func (fakeProvider) NodeExec(_ context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	fmt.Fprintf(stdout, "%s: %s\n", node.Name, strings.Join(cmd, " "))
+	fmt.Fprintln(stderr, "zebra: warning")
+	return 3, nil
+}
+
+func (fakeProvider) NodeRunning(_ context.Context, node topology.Node) (bool, error) {
+	return node.Name == "R1", nil
+}
+
+func (fakeProvider) LinkRemove(_ context.Context, link topology.Link) error {
+	return fmt.Errorf("link %s is in use", link.Name)
+}
+
+func (fakeProvider) Deployed(_ context.Context, lab string) ([]topology.Node, []topology.Link, error) {
+	nodes := []topology.Node{{Name: "R1", Image: "quay.io/frrouting/frr:master", Labels: map[string]string{topology.LabLabel: lab}}}
+	links := []topology.Link{{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24"}}
+	return nodes, links, nil
+}
+
+// TestMain serves the fake provider when the test binary is started as a plugin.
+func TestMain(m *testing.M) {
+	if os.Getenv(plugin.MagicCookieKey) == plugin.MagicCookieValue {
+		if err := plugin.Serve(fakeProvider{dryrun.New(logger.New(os.Stderr, os.Stderr))}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// syncBuffer is a buffer safe for concurrent writes of the logs of a plugin.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestPlugin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var logs syncBuffer
+	pp, err := plugin.Open(ctx, os.Args[0], &logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := topology.Link{Name: "golab-link-01", Endpoints: []string{"R1", "R2"}, IPv4Subnet: "10.1.2.0/24"}
+	if err := pp.LinkCreate(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := pp.LinkConnect(ctx, link, []topology.Node{{Name: "R1"}, {Name: "R2"}}); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	exitCode, err := pp.NodeExec(ctx, topology.Node{Name: "R1"}, []string{"ip", "route"}, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exitCode != 3 || stdout.String() != "R1: ip route\n" || stderr.String() != "zebra: warning\n" {
+		t.Errorf("exec: want exit code 3 and output %q, %q, got %d and %q, %q", "R1: ip route\n", "zebra: warning\n", exitCode, stdout.String(), stderr.String())
+	}
+	if running, err := pp.NodeRunning(ctx, topology.Node{Name: "R1"}); err != nil || !running {
+		t.Errorf("R1: want running, got %t, %v", running, err)
+	}
+	nodes, links, err := pp.Deployed(ctx, "lab1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNodes := []topology.Node{{Name: "R1", Image: "quay.io/frrouting/frr:master", Labels: map[string]string{topology.LabLabel: "lab1"}}}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("deployed nodes mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]topology.Link{{Name: "golab-link-01", IPv4Subnet: "10.1.2.0/24"}}, links); diff != "" {
+		t.Errorf("deployed links mismatch (-want +got):\n%s", diff)
+	}
+	errMsg := "link golab-link-01 is in use"
+	if err := pp.LinkRemove(ctx, link); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	errMsg = "interactive shells are not supported by plugin plugin.test"
+	if _, err := pp.NodeShell(ctx, topology.Node{Name: "R1"}, nil, topology.TTY{}); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	if err := pp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the plugin logs the calls it serves
+	for _, want := range []string{
+		`would create link golab-link-01: {"name":"golab-link-01","endpoints":["R1","R2"],"ipv4_subnet":"10.1.2.0/24"}`,
+		`would connect link golab-link-01: ["R1","R2"]`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log: want %q, got %q", want, logs.String())
+		}
+	}
+}
+
+func TestOpenHandshakeError(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "golab-provider-acme")
+	script := "#!/bin/sh\necho '2|unix|/tmp/plugin.sock'\ncat >/dev/null\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	errMsg := "plugin acme speaks protocol version 2, while golab speaks 1"
+	if _, err := plugin.Open(context.Background(), path, io.Discard); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestServeWithoutCookie(t *testing.T) {
+	t.Parallel()
+	if err := plugin.Serve(fakeProvider{}); err == nil {
+		t.Error("want error serving outside of golab, got nil")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	path := filepath.Join(dir, "golab-provider-acme")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := plugin.Lookup("acme"); err != nil || got != path {
+		t.Errorf("want %q, got %q, %v", path, got, err)
+	}
+	errMsg := `provider "vbox" is neither built in nor provided by a golab-provider-vbox plugin in PATH`
+	if _, err := plugin.Lookup("vbox"); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
@@ -0,0 +1,198 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// unaryHandler serves a call returning a single response.
+type unaryHandler func(ctx context.Context, provider Provider, req request) (response, error)
+
+// unaryHandlers maps the unary methods of the service onto the provider methods serving them.
+var unaryHandlers = map[string]unaryHandler{
+	"LinkCreate": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.LinkCreate(ctx, req.Link)
+	},
+	"LinkRemove": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.LinkRemove(ctx, req.Link)
+	},
+	"LinkConnect": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.LinkConnect(ctx, req.Link, req.Nodes)
+	},
+	"LinkDisconnect": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.LinkDisconnect(ctx, req.Link, req.Nodes)
+	},
+	"NodeCreate": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.NodeCreate(ctx, req.Node)
+	},
+	"NodeRemove": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.NodeRemove(ctx, req.Node)
+	},
+	"NodeStats": func(ctx context.Context, provider Provider, req request) (response, error) {
+		stats, err := provider.NodeStats(ctx, req.Node)
+		return response{Stats: &stats}, err
+	},
+	"NodePause": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.NodePause(ctx, req.Node)
+	},
+	"NodeUnpause": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.NodeUnpause(ctx, req.Node)
+	},
+	"NodeStop": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.NodeStop(ctx, req.Node)
+	},
+	"NodeStart": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.NodeStart(ctx, req.Node)
+	},
+	"NodeRunning": func(ctx context.Context, provider Provider, req request) (response, error) {
+		running, err := provider.NodeRunning(ctx, req.Node)
+		return response{Running: running}, err
+	},
+	"NodeCommit": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.NodeCommit(ctx, req.Node, req.Ref)
+	},
+	"Deployed": func(ctx context.Context, provider Provider, req request) (response, error) {
+		nodes, links, err := provider.Deployed(ctx, req.Lab)
+		return response{Nodes: nodes, Links: links}, err
+	},
+	"RemoveOrphans": func(ctx context.Context, provider Provider, req request) (response, error) {
+		return response{}, provider.RemoveOrphans(ctx, req.Lab)
+	},
+}
+
+// streamHandler serves a call streaming chunks of output written to stdout and stderr.
+type streamHandler func(ctx context.Context, provider Provider, req request, stdout, stderr io.Writer) (response, error)
+
+// streamHandlers maps the streaming methods of the service onto the provider methods serving them.
+var streamHandlers = map[string]streamHandler{
+	"NodeExec": func(ctx context.Context, provider Provider, req request, stdout, stderr io.Writer) (response, error) {
+		exitCode, err := provider.NodeExec(ctx, req.Node, req.Cmd, stdout, stderr)
+		return response{ExitCode: exitCode}, err
+	},
+	"NodeLogs": func(ctx context.Context, provider Provider, req request, stdout, stderr io.Writer) (response, error) {
+		return response{}, provider.NodeLogs(ctx, req.Node, req.Follow, req.Tail, stdout, stderr)
+	},
+}
+
+// encode wraps the value into a message as JSON.
+func encode(v any) (*wrapperspb.BytesValue, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(data), nil
+}
+
+// decode unwraps the JSON value from the message.
+func decode(msg *wrapperspb.BytesValue, v any) error {
+	return json.Unmarshal(msg.GetValue(), v)
+}
+
+// serviceDesc describes the gRPC service of plugins to the server, which passes the provider to the handlers.
+func serviceDesc() *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{ServiceName: serviceName, HandlerType: (*Provider)(nil), Metadata: "provider.proto"}
+	for name, handle := range unaryHandlers {
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: name,
+			Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := new(wrapperspb.BytesValue)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				var req request
+				if err := decode(in, &req); err != nil {
+					return nil, err
+				}
+				resp, err := handle(ctx, srv.(Provider), req)
+				if err != nil {
+					return nil, err
+				}
+				return encode(resp)
+			},
+		})
+	}
+	for name, handle := range streamHandlers {
+		desc.Streams = append(desc.Streams, grpc.StreamDesc{
+			StreamName:    name,
+			ServerStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				in := new(wrapperspb.BytesValue)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				var req request
+				if err := decode(in, &req); err != nil {
+					return err
+				}
+				var mu sync.Mutex
+				send := func(resp response) error {
+					out, err := encode(resp)
+					if err != nil {
+						return err
+					}
+					mu.Lock()
+					defer mu.Unlock()
+					return stream.SendMsg(out)
+				}
+				stdout := writerFunc(func(p []byte) error { return send(response{Stdout: p}) })
+				stderr := writerFunc(func(p []byte) error { return send(response{Stderr: p}) })
+				resp, err := handle(stream.Context(), srv.(Provider), req, stdout, stderr)
+				if err != nil {
+					return err
+				}
+				return send(resp)
+			},
+		})
+	}
+	return desc
+}
+
+// writerFunc turns a function sending chunks of output into an io.Writer.
+type writerFunc func(p []byte) error
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	if err := f(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Serve serves the provider to golab over a unix socket announced in the handshake written to stdout, until
+// golab closes stdin. Interrupts are ignored, so that golab can roll back changes when the user presses Ctrl-C.
+func Serve(provider Provider) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return errors.New("this program is a golab provider plugin, which is started by golab, e.g. golab --provider NAME build")
+	}
+	signal.Ignore(os.Interrupt)
+	dir, err := os.MkdirTemp("", "golab-plugin-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "plugin.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	server.RegisterService(serviceDesc(), provider)
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		server.GracefulStop()
+	}()
+	if _, err := fmt.Printf("%d|unix|%s\n", ProtocolVersion, socket); err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
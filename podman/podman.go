@@ -0,0 +1,61 @@
+// Package podman deploys labs to Podman, which many hosts run instead of the Docker engine. Podman serves
+// a Docker-compatible API, so labs are deployed by the Docker provider connected to the Podman service.
+package podman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elupevg/golab/docker"
+	"github.com/elupevg/golab/topology"
+)
+
+// rootfulSocket is where the system-wide Podman service listens.
+const rootfulSocket = "/run/podman/podman.sock"
+
+// Host returns the address of the Podman service, e.g. to be set as the host of a docker.Engine: CONTAINER_HOST
+// if set, otherwise the socket of the rootless service of the current user if it is listening, falling back to
+// the system-wide service. The rootless service is started with systemctl --user start podman.socket.
+func Host() string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		socket := filepath.Join(dir, "podman", "podman.sock")
+		if _, err := os.Stat(socket); err == nil {
+			return "unix://" + socket
+		}
+	}
+	return "unix://" + rootfulSocket
+}
+
+// Provider is the Docker provider connected to the Podman service. The Docker-compatible API of Podman
+// implements a subset of the options of Docker networks, hence links relying on Docker-specific options
+// are rejected rather than deployed without them.
+type Provider struct {
+	*docker.DockerProvider
+}
+
+// New returns the provider deploying labs with the Docker provider connected to the Podman service.
+func New(dp *docker.DockerProvider) *Provider {
+	return &Provider{DockerProvider: dp}
+}
+
+// LinkCreate creates the network of the link unless it relies on Docker-specific options.
+func (p *Provider) LinkCreate(ctx context.Context, link topology.Link) error {
+	var unsupported string
+	switch {
+	case link.NoGateway:
+		unsupported = "no_gateway"
+	case len(link.DriverOpts) != 0:
+		unsupported = "driver_opts"
+	case len(link.EndpointOpts) != 0:
+		unsupported = "endpoint_opts"
+	}
+	if unsupported != "" {
+		return fmt.Errorf("link %s sets %s, which relies on options of Docker networks not supported by the podman provider", link.Name, unsupported)
+	}
+	return p.DockerProvider.LinkCreate(ctx, link)
+}
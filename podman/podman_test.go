@@ -0,0 +1,73 @@
+package podman_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elupevg/golab/docker"
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/podman"
+	"github.com/elupevg/golab/topology"
+)
+
+func TestHost(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONTAINER_HOST", "")
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	// the rootless service is not listening
+	if got, want := podman.Host(), "unix:///run/podman/podman.sock"; got != want {
+		t.Errorf("system-wide service: want %q, got %q", want, got)
+	}
+	socket := filepath.Join(dir, "podman", "podman.sock")
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := podman.Host(), "unix://"+socket; got != want {
+		t.Errorf("rootless service: want %q, got %q", want, got)
+	}
+	t.Setenv("CONTAINER_HOST", "unix:///tmp/podman.sock")
+	if got, want := podman.Host(), "unix:///tmp/podman.sock"; got != want {
+		t.Errorf("CONTAINER_HOST: want %q, got %q", want, got)
+	}
+}
+
+func TestLinkCreateUnsupported(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		link   topology.Link
+		errMsg string
+	}{
+		{
+			name:   "NoGateway",
+			link:   topology.Link{Name: "golab-link-01", NoGateway: true},
+			errMsg: "link golab-link-01 sets no_gateway, which relies on options of Docker networks not supported by the podman provider",
+		},
+		{
+			name:   "DriverOpts",
+			link:   topology.Link{Name: "golab-link-01", DriverOpts: map[string]string{"com.docker.network.bridge.enable_icc": "false"}},
+			errMsg: "link golab-link-01 sets driver_opts, which relies on options of Docker networks not supported by the podman provider",
+		},
+		{
+			name:   "EndpointOpts",
+			link:   topology.Link{Name: "golab-link-01", EndpointOpts: map[string]map[string]string{"R1": {"com.docker.network.endpoint.sysctls": "net.ipv4.conf.IFNAME.rp_filter=0"}}},
+			errMsg: "link golab-link-01 sets endpoint_opts, which relies on options of Docker networks not supported by the podman provider",
+		},
+	}
+	// links are rejected before the Podman service is reached
+	provider := podman.New(docker.New(nil, logger.New(io.Discard, io.Discard)))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if err := provider.LinkCreate(context.Background(), tc.link); err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Package scaffold provides example topologies to bootstrap new labs from.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var topologyTemplates embed.FS
+
+// The topology file of every example is rendered under the name of the lab.
+const (
+	topologyTemplate = "topology.yml.tmpl"
+	templateExt      = ".tmpl"
+)
+
+// File is a rendered file of an example lab.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Templates returns names of all available example topologies.
+func Templates() []string {
+	entries, _ := fs.ReadDir(topologyTemplates, "templates")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// Render returns the YAML intent file of the named example topology followed by the rest of its files, e.g. README.md.
+func Render(templateName, topoName string) ([]File, error) {
+	dir := path.Join("templates", templateName)
+	entries, err := fs.ReadDir(topologyTemplates, dir)
+	if err != nil || templateName == "" || strings.Contains(templateName, "/") {
+		return nil, fmt.Errorf("unknown template %q, available templates: %s", templateName, strings.Join(Templates(), ", "))
+	}
+	files := []File{{Name: topoName + ".yml"}}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		tmplData, err := topologyTemplates.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(name).Parse(string(tmplData))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, struct{ Name string }{topoName}); err != nil {
+			return nil, err
+		}
+		if entry.Name() == topologyTemplate {
+			files[0].Data = buf.Bytes()
+			continue
+		}
+		files = append(files, File{Name: name, Data: buf.Bytes()})
+	}
+	return files, nil
+}
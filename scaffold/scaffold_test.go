@@ -0,0 +1,50 @@
+package scaffold_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/elupevg/golab/scaffold"
+	"github.com/elupevg/golab/topology"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	templates := scaffold.Templates()
+	if len(templates) != 8 {
+		t.Fatalf("templates: want 8, got %v", templates)
+	}
+	for _, name := range templates {
+		t.Run(name, func(t *testing.T) {
+			files, err := scaffold.Render(name, "mylab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 2 || files[0].Name != "mylab.yml" || files[1].Name != "README.md" {
+				t.Fatalf("files: want [mylab.yml README.md], got %v", files)
+			}
+			topo, err := topology.FromYAML(files[0].Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if topo.Name != "mylab" {
+				t.Errorf("name: want %q, got %q", "mylab", topo.Name)
+			}
+			if topo.ConfigMode != topology.Auto {
+				t.Errorf("config mode: want %q, got %q", topology.Auto, topo.ConfigMode)
+			}
+			if !strings.HasPrefix(string(files[1].Data), "# mylab\n") {
+				t.Errorf("README: want a %q heading, got %q", "# mylab", files[1].Data)
+			}
+		})
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	t.Parallel()
+	wantMsg := `unknown template "ring", available templates: bgp-triangle, isis-ring, isp-multihome, ldp-core, ospf-square, spine-leaf, square, triangle`
+	_, err := scaffold.Render("ring", "mylab")
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
@@ -0,0 +1,126 @@
+// Package telemetry periodically collects operational data from network nodes.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+)
+
+// Executor represents a provider capable of running commands inside nodes.
+type Executor interface {
+	NodeExec(ctx context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error)
+}
+
+// Sample represents a single telemetry data point collected from a node.
+type Sample struct {
+	Time   time.Time       `json:"time"`
+	Node   string          `json:"node"`
+	Metric string          `json:"metric"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Poll runs vendor-specific telemetry commands on all nodes and returns collected samples.
+// Nodes of vendors without telemetry support are skipped, as are nodes failing to report,
+// whose errors are joined into the returned error along with the samples of the other nodes.
+func Poll(ctx context.Context, topo *topology.Topology, ex Executor, now time.Time) ([]Sample, error) {
+	var samples []Sample
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+		nodeSamples, err := pollNode(ctx, topo.Nodes[name], ex, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		samples = append(samples, nodeSamples...)
+	}
+	return samples, errors.Join(errs...)
+}
+
+// pollNode runs vendor-specific telemetry commands on a single node and returns collected samples.
+func pollNode(ctx context.Context, node *topology.Node, ex Executor, now time.Time) ([]Sample, error) {
+	var samples []Sample
+	commands := vendors.GetConfig(node.Vendor).Telemetry
+	for _, metric := range slices.Sorted(maps.Keys(commands)) {
+		var stdout, stderr bytes.Buffer
+		exitCode, err := ex.NodeExec(ctx, *node, commands[metric], &stdout, &stderr)
+		if err != nil {
+			return nil, fmt.Errorf("node %s failed to report %s: %w", node.Name, metric, err)
+		}
+		if exitCode != 0 {
+			return nil, fmt.Errorf("node %s failed to report %s: %s", node.Name, metric, bytes.TrimSpace(stderr.Bytes()))
+		}
+		if !json.Valid(stdout.Bytes()) {
+			return nil, fmt.Errorf("node %s reported invalid JSON for %s", node.Name, metric)
+		}
+		samples = append(samples, Sample{
+			Time:   now,
+			Node:   node.Name,
+			Metric: metric,
+			Data:   json.RawMessage(bytes.TrimSpace(stdout.Bytes())),
+		})
+	}
+	return samples, nil
+}
+
+// Collect polls all nodes with the provided interval until the context is canceled.
+// Samples are appended as JSON lines to a separate file per node in the provided directory.
+// Nodes failing to report are logged and polled again in the next round.
+func Collect(ctx context.Context, topo *topology.Topology, ex Executor, dir string, interval time.Duration, log *logger.Logger) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, name := range slices.Sorted(maps.Keys(topo.Nodes)) {
+			samples, err := pollNode(ctx, topo.Nodes[name], ex, time.Now())
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.With(name).Errored(err)
+				continue
+			}
+			if err := write(samples, dir); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// write appends samples to per-node files in the provided directory.
+func write(samples []Sample, dir string) error {
+	for _, sample := range samples {
+		path := filepath.Join(dir, sample.Node+".jsonl")
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			return err
+		}
+		err = json.NewEncoder(f).Encode(sample)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package telemetry_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elupevg/golab/logger"
+	"github.com/elupevg/golab/telemetry"
+	"github.com/elupevg/golab/topology"
+	"github.com/elupevg/golab/vendors"
+	"github.com/google/go-cmp/cmp"
+)
+
+type stubExecutor struct {
+	exitCode int
+	output   string
+	failNode string
+	// cancel is called by every successful command, which stops collection after a single round
+	cancel context.CancelFunc
+}
+
+func (s *stubExecutor) NodeExec(_ context.Context, node topology.Node, cmd []string, stdout, stderr io.Writer) (int, error) {
+	if node.Name == s.failNode {
+		return 0, errors.New("container is not running")
+	}
+	if s.exitCode != 0 {
+		fmt.Fprint(stderr, "% Unknown command")
+		return s.exitCode, nil
+	}
+	if s.output != "" {
+		fmt.Fprint(stdout, s.output)
+		return 0, nil
+	}
+	fmt.Fprintf(stdout, "{%q: %q}\n", node.Name, cmd[len(cmd)-1])
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return 0, nil
+}
+
+func testTopology() *topology.Topology {
+	return &topology.Topology{
+		Nodes: map[string]*topology.Node{
+			"R1": {Name: "R1", Vendor: vendors.FRR},
+			"R2": {Name: "R2", Vendor: vendors.UNKNOWN},
+			"R3": {Name: "R3", Vendor: vendors.FRR},
+		},
+	}
+}
+
+func TestPoll(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	got, err := telemetry.Poll(context.Background(), testTopology(), new(stubExecutor), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []telemetry.Sample{
+		{Time: now, Node: "R1", Metric: "bgp", Data: json.RawMessage(`{"R1": "show bgp summary json"}`)},
+		{Time: now, Node: "R1", Metric: "interfaces", Data: json.RawMessage(`{"R1": "show interface json"}`)},
+		{Time: now, Node: "R3", Metric: "bgp", Data: json.RawMessage(`{"R3": "show bgp summary json"}`)},
+		{Time: now, Node: "R3", Metric: "interfaces", Data: json.RawMessage(`{"R3": "show interface json"}`)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPollFailingNode(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	got, err := telemetry.Poll(context.Background(), testTopology(), &stubExecutor{failNode: "R1"}, now)
+	errMsg := "node R1 failed to report bgp: container is not running"
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	want := []telemetry.Sample{
+		{Time: now, Node: "R3", Metric: "bgp", Data: json.RawMessage(`{"R3": "show bgp summary json"}`)},
+		{Time: now, Node: "R3", Metric: "interfaces", Data: json.RawMessage(`{"R3": "show interface json"}`)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPollErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		ex     *stubExecutor
+		errMsg string
+	}{
+		{
+			name:   "NonZeroExitCode",
+			ex:     &stubExecutor{exitCode: 1},
+			errMsg: "node R1 failed to report bgp: % Unknown command\nnode R3 failed to report bgp: % Unknown command",
+		},
+		{
+			name:   "InvalidJSON",
+			ex:     &stubExecutor{output: "not a JSON"},
+			errMsg: "node R1 reported invalid JSON for bgp\nnode R3 reported invalid JSON for bgp",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := telemetry.Poll(context.Background(), testTopology(), tc.ex, time.Now())
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if tc.errMsg != errMsg {
+				t.Errorf("error: want %q, got %q", tc.errMsg, errMsg)
+			}
+		})
+	}
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "telemetry")
+	ctx, cancel := context.WithCancel(context.Background())
+	// cancel the context in advance to collect a single round of samples
+	cancel()
+	err := telemetry.Collect(ctx, testTopology(), new(stubExecutor), dir, time.Second, logger.New(io.Discard, io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "R1.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("samples: want 2, got %d", len(lines))
+	}
+	var sample telemetry.Sample
+	if err := json.Unmarshal([]byte(lines[1]), &sample); err != nil {
+		t.Fatal(err)
+	}
+	if sample.Node != "R1" || sample.Metric != "interfaces" {
+		t.Errorf("unexpected sample %+v", sample)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "R2.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("R2.jsonl: want %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestCollectFailingNode(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "telemetry")
+	ctx, cancel := context.WithCancel(context.Background())
+	var stderr strings.Builder
+	err := telemetry.Collect(ctx, testTopology(), &stubExecutor{failNode: "R1", cancel: cancel}, dir, time.Second, logger.New(io.Discard, &stderr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLog := "node R1 failed to report bgp: container is not running"
+	if !strings.Contains(stderr.String(), wantLog) {
+		t.Errorf("log: want %q in %q", wantLog, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "R3.jsonl")); err != nil {
+		t.Errorf("R3.jsonl: want samples of the other nodes, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+)
+
+// FromJSON parses, validates and populates the topology described in the provided JSON document,
+// which uses the same keys as YAML, so that topologies generated by other programs are accepted as is.
+func FromJSON(data []byte) (*Topology, error) {
+	data, err := jsonToYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return FromYAML(data)
+}
+
+// FromTOML parses, validates and populates the topology described in the provided TOML document,
+// which uses the same keys as YAML.
+func FromTOML(data []byte) (*Topology, error) {
+	data, err := tomlToYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return FromYAML(data)
+}
+
+// toYAML converts the contents of a JSON or TOML topology file to YAML based on the file extension.
+// Files with other extensions are treated as YAML.
+func toYAML(path string, data []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return jsonToYAML(data)
+	case ".toml":
+		return tomlToYAML(data)
+	}
+	return data, nil
+}
+
+// jsonToYAML validates the JSON document, which is valid YAML as well.
+func jsonToYAML(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return data, nil
+}
+
+// tomlToYAML re-encodes the TOML document as YAML.
+func tomlToYAML(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := toml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid TOML: %w", err)
+	}
+	return yaml.Marshal(doc)
+}
@@ -0,0 +1,134 @@
+package topology
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const formatYAML = `
+name: formats
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", protocols: {ospf: true}}
+  R2: {image: "quay.io/frrouting/frr:master", protocols: {ospf: true}, cpus: 0.5}
+links:
+  - endpoints: [R1, R2]
+    mtu: 9000
+`
+
+const formatJSON = `{
+  "name": "formats",
+  "nodes": {
+    "R1": {"image": "quay.io/frrouting/frr:master", "protocols": {"ospf": true}},
+    "R2": {"image": "quay.io/frrouting/frr:master", "protocols": {"ospf": true}, "cpus": 0.5}
+  },
+  "links": [{"endpoints": ["R1", "R2"], "mtu": 9000}]
+}`
+
+const formatTOML = `
+name = "formats"
+
+[nodes.R1]
+image = "quay.io/frrouting/frr:master"
+protocols = {ospf = true}
+
+[nodes.R2]
+image = "quay.io/frrouting/frr:master"
+protocols = {ospf = true}
+cpus = 0.5
+
+[[links]]
+endpoints = ["R1", "R2"]
+mtu = 9000
+`
+
+func TestFromJSONAndTOML(t *testing.T) {
+	t.Parallel()
+	want, err := FromYAML([]byte(formatYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name  string
+		parse func([]byte) (*Topology, error)
+		data  string
+	}{
+		{name: "JSON", parse: FromJSON, data: formatJSON},
+		{name: "TOML", parse: FromTOML, data: formatTOML},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tc.parse([]byte(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(Topology{})); diff != "" {
+				t.Errorf("topology mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFromJSONAndTOMLErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		parse  func([]byte) (*Topology, error)
+		data   string
+		errMsg string
+	}{
+		{
+			name:   "JSON",
+			parse:  FromJSON,
+			data:   `{"name": "formats",}`,
+			errMsg: "invalid JSON: invalid character '}' looking for beginning of object key string",
+		},
+		{
+			name:   "TOML",
+			parse:  FromTOML,
+			data:   `name = formats`,
+			errMsg: "invalid TOML: toml: line 1 (last key \"name\"): expected value but found \"formats\" instead",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := tc.parse([]byte(tc.data))
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestReadFileFormats(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.json": formatJSON,
+		"lab.toml":  "include = [\"base.json\"]\n\n[nodes.R2]\nimage = \"quay.io/frrouting/frr:10.3.0\"\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ReadFile(filepath.Join(dir, "lab.toml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topo, err := FromYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := topo.Nodes["R2"].Image, "quay.io/frrouting/frr:10.3.0"; got != want {
+		t.Errorf("R2 image: want %q, got %q", want, got)
+	}
+	if got, want := topo.Nodes["R2"].CPUs, 0.5; got != want {
+		t.Errorf("R2 cpus: want %v, got %v", want, got)
+	}
+}
@@ -1,19 +1,451 @@
 package topology
 
-import "github.com/goccy/go-yaml"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
 
-func parseYAML(data []byte) (*Topology, error) {
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+)
+
+// parseYAML decodes the topology from one or more YAML documents. Multiple documents,
+// either passed separately or as a single stream separated by "---", are deep-merged first,
+// and so are node templates into the nodes based on them.
+func parseYAML(data ...[]byte) (*Topology, error) {
+	data = slices.Clone(data)
+	for i, d := range data {
+		expanded, err := expandEnv(d)
+		if err != nil {
+			return nil, err
+		}
+		data[i] = expanded
+	}
+	var docs []map[string]any
+	for _, d := range data {
+		dec := yaml.NewDecoder(bytes.NewReader(d))
+		for {
+			var doc map[string]any
+			err := dec.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if doc != nil {
+				docs = append(docs, doc)
+			}
+		}
+	}
 	var topo Topology
-	err := yaml.Unmarshal(data, &topo)
+	if len(data) == 1 && len(docs) <= 1 && (len(docs) == 0 || docs[0]["templates"] == nil) {
+		if err := yaml.Unmarshal(data[0], &topo); err != nil {
+			return nil, err
+		}
+		return &topo, nil
+	}
+	merged := make(map[string]any)
+	for _, doc := range docs {
+		mergeDocuments(merged, doc, true)
+	}
+	if err := expandTemplates(merged); err != nil {
+		return nil, err
+	}
+	mergedData, err := yaml.Marshal(merged)
 	if err != nil {
 		return nil, err
 	}
+	if err := yaml.Unmarshal(mergedData, &topo); err != nil {
+		return nil, err
+	}
 	return &topo, nil
 }
 
-func FromYAML(data []byte) (*Topology, error) {
-	topo, err := parseYAML(data)
+// envVarRegexp matches a ${VAR} or ${VAR:-default} reference, optionally escaped with another "$",
+// at the start of the data.
+var envVarRegexp = regexp.MustCompile(`^\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnv substitutes references to environment variables outside of comments. A default value
+// applies if the variable is unset or empty, otherwise such a variable is an error. "$${VAR}" yields
+// "${VAR}" verbatim. Values are escaped for the quoted scalars they are referenced in, while values
+// which would change the structure of the document are only accepted in double-quoted scalars.
+func expandEnv(data []byte) ([]byte, error) {
+	var (
+		out  bytes.Buffer
+		errs []error
+		// quote is the quote character of the scalar being scanned, if any
+		quote byte
+		// prev is the last non-blank character scanned outside of quoted scalars
+		prev byte = '\n'
+	)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case quote == '"' && c == '\\' && i+1 < len(data):
+			out.Write(data[i : i+2])
+			i++
+			continue
+		case quote == '\'' && c == '\'' && i+1 < len(data) && data[i+1] == '\'':
+			out.Write(data[i : i+2])
+			i++
+			continue
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\'') && strings.IndexByte(":-[{,?\n", prev) != -1:
+			quote = c
+		case quote == 0 && c == '#' && (i == 0 || strings.IndexByte(" \t\n", data[i-1]) != -1):
+			// comments run to the end of the line and are kept as they are
+			end := bytes.IndexByte(data[i:], '\n')
+			if end == -1 {
+				end = len(data) - i
+			}
+			out.Write(data[i : i+end])
+			i += end - 1
+			continue
+		case c == '$':
+			if ref := envVarRegexp.Find(data[i:]); ref != nil {
+				value, err := expandRef(ref, quote)
+				if err != nil {
+					errs = append(errs, err)
+					value = ref
+				}
+				out.Write(value)
+				i += len(ref) - 1
+				prev = '$'
+				continue
+			}
+		}
+		out.WriteByte(c)
+		if quote == 0 && c != ' ' && c != '\t' {
+			prev = c
+		}
+	}
+	return out.Bytes(), errors.Join(errs...)
+}
+
+// plainUnsafe matches values changing the structure of a YAML document when inserted into a plain scalar,
+// e.g. by starting a comment or a nested mapping.
+var plainUnsafe = regexp.MustCompile(`[\n\r,\[\]{}]|: | #|:$|^[\s\-?:#&*!|>'"%@` + "`" + `]|\s$`)
+
+// expandRef resolves a single reference to an environment variable, escaping the value for a scalar
+// quoted with the provided quote character, if any.
+func expandRef(ref []byte, quote byte) ([]byte, error) {
+	if bytes.HasPrefix(ref, []byte("$$")) {
+		return ref[1:], nil
+	}
+	match := envVarRegexp.FindSubmatch(ref)
+	name := string(match[1])
+	value := os.Getenv(name)
+	if value == "" {
+		// default values are part of the document, hence they are already written for the scalar
+		if defaultValue, ok := bytes.CutPrefix(match[2], []byte(":-")); ok {
+			return defaultValue, nil
+		}
+		return nil, fmt.Errorf("environment variable %q is not set", name)
+	}
+	switch quote {
+	case '"':
+		quoted := strconv.Quote(value)
+		return []byte(quoted[1 : len(quoted)-1]), nil
+	case '\'':
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("environment variable %q contains a line break, which requires double quotes, e.g. \"${%s}\"", name, name)
+		}
+		return []byte(strings.ReplaceAll(value, "'", "''")), nil
+	}
+	if plainUnsafe.MatchString(value) {
+		return nil, fmt.Errorf("environment variable %q contains YAML syntax, which requires double quotes, e.g. \"${%s}\"", name, name)
+	}
+	return []byte(value), nil
+}
+
+// mergeDocuments deep-merges the src document into the dst one. Mappings are merged
+// recursively and scalars of src replace the ones of dst, while sequences of src are
+// either appended to the ones of dst, e.g. links spread over several files, or replace them.
+func mergeDocuments(dst, src map[string]any, appendLists bool) {
+	for key, srcValue := range src {
+		switch srcValue := srcValue.(type) {
+		case map[string]any:
+			if dstMap, ok := dst[key].(map[string]any); ok {
+				mergeDocuments(dstMap, srcValue, appendLists)
+				continue
+			}
+		case []any:
+			if dstList, ok := dst[key].([]any); ok && appendLists {
+				dst[key] = append(slices.Clip(dstList), srcValue...)
+				continue
+			}
+		}
+		dst[key] = srcValue
+	}
+}
+
+// expandTemplates deep-merges node templates into the definitions of nodes and groups based on them.
+// Node settings take precedence, and templates may be based on other templates in turn.
+func expandTemplates(doc map[string]any) error {
+	templates, _ := doc["templates"].(map[string]any)
+	nodes, _ := doc["nodes"].(map[string]any)
+	for _, name := range slices.Sorted(maps.Keys(nodes)) {
+		node, ok := nodes[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		resolved, err := resolveTemplate(fmt.Sprintf("node %q", name), node, templates, nil)
+		if err != nil {
+			return err
+		}
+		nodes[name] = resolved
+	}
+	groups, _ := doc["groups"].(map[string]any)
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		group, ok := groups[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		node, ok := group["node"].(map[string]any)
+		if !ok {
+			continue
+		}
+		resolved, err := resolveTemplate(fmt.Sprintf("group %q", name), node, templates, nil)
+		if err != nil {
+			return err
+		}
+		group["node"] = resolved
+	}
+	return nil
+}
+
+// resolveTemplate returns the node definition merged over the template it is based on, if any.
+// The chain holds templates resolved so far to detect inheritance loops.
+func resolveTemplate(owner string, node, templates map[string]any, chain []string) (map[string]any, error) {
+	base, ok := node["based_on"].(string)
+	if !ok {
+		return node, nil
+	}
+	if slices.Contains(chain, base) {
+		return nil, fmt.Errorf("template %q is based on itself", base)
+	}
+	tmpl, ok := templates[base].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is based on undefined template %q", owner, base)
+	}
+	parent, err := resolveTemplate(fmt.Sprintf("template %q", base), tmpl, templates, append(chain, base))
+	if err != nil {
+		return nil, err
+	}
+	resolved := cloneDocument(parent)
+	mergeDocuments(resolved, node, false)
+	return resolved, nil
+}
+
+// cloneDocument returns a deep copy of the document mappings, so that merging into it leaves the original intact.
+func cloneDocument(doc map[string]any) map[string]any {
+	clone := make(map[string]any, len(doc))
+	for key, value := range doc {
+		if m, ok := value.(map[string]any); ok {
+			value = cloneDocument(m)
+		}
+		clone[key] = value
+	}
+	return clone
+}
+
+// ErrRender is returned by ReadFile when a topology file fails to render as a template.
+var ErrRender = errors.New("failed to render")
+
+// ReadFile reads the topology file along with the files it includes. Every file is rendered with
+// the provided variable overrides before its includes are parsed, so that they may be templated,
+// and JSON and TOML files, detected by their extension, are converted to YAML. Paths of included
+// files are relative to the including file, and their documents precede the ones of the including
+// file, so that its settings take precedence once the documents are merged.
+func ReadFile(path string, vars map[string]string) ([]byte, error) {
+	docs, err := readIncludes(path, vars, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join(docs, []byte("\n---\n")), nil
+}
+
+// readIncludes returns documents of the file preceded by the ones it includes, recursively.
+// The chain holds the including files to detect include loops.
+func readIncludes(path string, vars map[string]string, chain []string) ([][]byte, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(chain, absPath) {
+		return nil, fmt.Errorf("topology file %s includes itself", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = Render(data, vars); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrRender, path, err)
+	}
+	if data, err = toYAML(path, data); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	includes, err := parseIncludes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var docs [][]byte
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := readIncludes(include, vars, append(chain, absPath))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, included...)
+	}
+	return append(docs, data), nil
+}
+
+// parseIncludes returns the paths listed by the include directives of all documents in the file.
+func parseIncludes(data []byte) ([]string, error) {
+	data, err := expandEnv(data)
+	if err != nil {
+		return nil, err
+	}
+	var includes []string
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc struct {
+			Include []string `yaml:"include"`
+		}
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return includes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		includes = append(includes, doc.Include...)
+	}
+}
+
+// Render executes the topology YAML documents as a text/template before they are parsed, so that
+// large topologies can be written with loops and conditionals. Template data are the variables of
+// the top-level vars sections, with later documents and then the overrides taking precedence.
+// Overrides holding booleans or integers are typed accordingly, like values of the vars sections.
+// Vars sections are read before rendering, hence they cannot contain template actions themselves.
+func Render(data []byte, overrides map[string]string) ([]byte, error) {
+	if !bytes.Contains(data, []byte("{{")) {
+		return data, nil
+	}
+	vars, err := parseVars(data)
 	if err != nil {
+		return nil, fmt.Errorf("failed to parse vars: %w", err)
+	}
+	for key, value := range overrides {
+		vars[key] = parseVar(value)
+	}
+	tmpl, err := template.New("topology").Option("missingkey=error").Funcs(template.FuncMap{"seq": seq}).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseVars merges the top-level vars sections of all documents, which are cut out of the
+// data line by line, since the rest of a template is not necessarily valid YAML yet.
+func parseVars(data []byte) (map[string]any, error) {
+	vars := make(map[string]any)
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "vars:") {
+			continue
+		}
+		section := []string{lines[i]}
+		for i+1 < len(lines) && (lines[i+1] == "" || strings.HasPrefix(lines[i+1], " ") || strings.HasPrefix(lines[i+1], "#")) {
+			i++
+			section = append(section, lines[i])
+		}
+		var doc struct {
+			Vars map[string]any `yaml:"vars"`
+		}
+		if err := yaml.Unmarshal([]byte(strings.Join(section, "\n")), &doc); err != nil {
+			return nil, err
+		}
+		maps.Copy(vars, doc.Vars)
+	}
+	return vars, nil
+}
+
+// parseVar types a variable override as a boolean or an integer if possible.
+func parseVar(value string) any {
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	if i, err := strconv.Atoi(value); err == nil {
+		return i
+	}
+	return value
+}
+
+// seq returns the sequence 1..n for ranging over counts in templates, e.g. {{ range seq .leaves }}.
+func seq(n any) ([]int, error) {
+	count, err := strconv.Atoi(fmt.Sprint(n))
+	if err != nil {
+		return nil, fmt.Errorf("seq expects a number, got %v", n)
+	}
+	s := make([]int, 0, max(count, 0))
+	for i := 1; i <= count; i++ {
+		s = append(s, i)
+	}
+	return s, nil
+}
+
+// UnmarshalYAML decodes the IS-IS settings of a node, requiring the area and the NET to be quoted. Unquoted
+// areas, e.g. 49.0010, are YAML floats, which would lose their trailing zeros before they could be validated.
+func (i *NodeISIS) UnmarshalYAML(node ast.Node) error {
+	examples := map[string]string{"area": "49.0001", "net": "49.0001.1921.6800.0001.00"}
+	if mapping, ok := node.(ast.MapNode); ok {
+		for iter := mapping.MapRange(); iter.Next(); {
+			key := iter.Key().String()
+			if example, ok := examples[key]; ok && iter.Value().Type() != ast.StringType {
+				return fmt.Errorf("isis %s %s has to be quoted, e.g. %s: %q", key, iter.Value(), key, example)
+			}
+		}
+	}
+	type plain NodeISIS
+	return yaml.NodeToValue(node, (*plain)(i))
+}
+
+// FromYAML parses, validates and populates the topology described in the provided YAML documents.
+func FromYAML(data ...[]byte) (*Topology, error) {
+	topo, err := parseYAML(data...)
+	if err != nil {
+		return nil, err
+	}
+	topo.populateEndpoints()
+	if err := topo.populateGroups(); err != nil {
+		return nil, err
+	}
+	if err := topo.nameLinks(); err != nil {
+		return nil, err
+	}
+	if err := topo.removeDisabled(); err != nil {
+		return nil, err
+	}
+	if err := topo.populateProfiles(); err != nil {
 		return nil, err
 	}
 	if err := topo.validate(); err != nil {
@@ -24,3 +456,35 @@ func FromYAML(data []byte) (*Topology, error) {
 	}
 	return topo, nil
 }
+
+// Hosts returns the hosts declared in the provided YAML documents, which there are none of unless the lab
+// is spread over several hosts. Like NodeNames, it neither validates nor populates the topology.
+func Hosts(data ...[]byte) (map[string]*Host, error) {
+	topo, err := parseYAML(data...)
+	if err != nil {
+		return nil, err
+	}
+	return topo.Hosts, nil
+}
+
+// NodeNames returns sorted names of enabled nodes declared in the provided YAML documents.
+// Unlike FromYAML, it neither validates nor populates the topology.
+func NodeNames(data ...[]byte) ([]string, error) {
+	topo, err := parseYAML(data...)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, node := range topo.Nodes {
+		if node == nil || !node.Disabled {
+			names = append(names, name)
+		}
+	}
+	for groupName, group := range topo.Groups {
+		if group != nil && (group.Node == nil || !group.Node.Disabled) {
+			names = append(names, replicaNames(groupName, group.Count)...)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
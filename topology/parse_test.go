@@ -1,11 +1,18 @@
 package topology
 
 import (
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/elupevg/golab/vendors"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 func TestFromYAML(t *testing.T) {
@@ -33,19 +40,25 @@ links:
     ipv6_subnet: 2001:db8:64::/64
 `
 	var testASN uint32 = 65000
+	labels := map[string]string{LabLabel: "triangle"}
 	want := &Topology{
 		Name:       "triangle",
 		IPMode:     Dual,
 		ConfigMode: "manual",
 		Nodes: map[string]*Node{
 			"R1": {
-				Name:  "R1",
-				Image: "quay.io/frrouting/frr:master",
+				Name:     "R1",
+				Index:    1,
+				RouterID: "192.168.0.1",
+				Labels:   labels,
+				Image:    "quay.io/frrouting/frr:master",
 				Binds: []string{
 					"/lib/modules:/lib/modules",
 					os.Getenv("PWD") + "/R1:/etc/frr",
 				},
-				Vendor: vendors.FRR,
+				Vendor:       vendors.FRR,
+				Capabilities: []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+				ReadyCommand: []string{"vtysh", "-c", "show version"},
 				Interfaces: []*Interface{
 					{
 						Name:     "eth0",
@@ -72,38 +85,51 @@ links:
 				Sysctls:       map[string]string{"net.mpls.conf.lo.input": "1", "net.mpls.platform_labels": "100000"},
 			},
 			"R2": {
-				Name:  "R2",
-				Image: "quay.io/frrouting/frr:master",
+				Name:     "R2",
+				Index:    2,
+				RouterID: "192.168.0.2",
+				Labels:   labels,
+				Image:    "quay.io/frrouting/frr:master",
 				Binds: []string{
 					"/lib/modules:/lib/modules",
 					os.Getenv("PWD") + "/R2:/etc/frr",
 				},
-				Vendor: vendors.FRR,
+				Vendor:       vendors.FRR,
+				Capabilities: []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+				ReadyCommand: []string{"vtysh", "-c", "show version"},
 				Interfaces: []*Interface{
 					{
 						Name:     "eth0",
 						Link:     "golab-link-01",
+						OSPF:     &OSPF{Area: "0"},
 						IPv4Addr: "10.1.2.2/24", IPv6Addr: "2001:db8:1:2::2/64",
 					},
 					{
 						Name:     "eth1",
 						Link:     "golab-link-03",
+						OSPF:     &OSPF{Area: "0"},
 						IPv4Addr: "100.64.0.2/24", IPv6Addr: "2001:db8:64::2/64",
 					},
 				},
 				IPv4Loopbacks: []string{"192.168.0.2/32"},
 				IPv6Loopbacks: []string{"2001:db8::2/128"},
 				Protocols:     map[string]bool{"ospf": true, "bgp": true},
+				OSPF:          &NodeOSPF{Area: "0"},
 				ASN:           &testASN,
 			},
 			"R3": {
-				Name:  "R3",
-				Image: "quay.io/frrouting/frr:master",
+				Name:     "R3",
+				Index:    3,
+				RouterID: "172.16.0.3",
+				Labels:   labels,
+				Image:    "quay.io/frrouting/frr:master",
 				Binds: []string{
 					"/lib/modules:/lib/modules",
 					os.Getenv("PWD") + "/R3:/etc/frr",
 				},
-				Vendor: vendors.FRR,
+				Vendor:       vendors.FRR,
+				Capabilities: []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+				ReadyCommand: []string{"vtysh", "-c", "show version"},
 				Interfaces: []*Interface{
 					{
 						Name:     "eth0",
@@ -129,6 +155,7 @@ links:
 		Links: []*Link{
 			{
 				Name:        "golab-link-01",
+				Labels:      labels,
 				Endpoints:   []string{"R1", "R2"},
 				IPv4Subnet:  "10.1.2.0/24",
 				IPv6Subnet:  "2001:db8:1:2::/64",
@@ -137,6 +164,7 @@ links:
 			},
 			{
 				Name:        "golab-link-02",
+				Labels:      labels,
 				Endpoints:   []string{"R1", "R3"},
 				IPv4Subnet:  "10.1.3.0/24",
 				IPv6Subnet:  "2001:db8:1:3::/64",
@@ -145,6 +173,7 @@ links:
 			},
 			{
 				Name:        "golab-link-03",
+				Labels:      labels,
 				Endpoints:   []string{"R2", "R3"},
 				IPv4Subnet:  "100.64.0.0/24",
 				IPv6Subnet:  "2001:db8:64::/64",
@@ -157,7 +186,1507 @@ links:
 	if err != nil {
 		t.Fatal(err)
 	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(Topology{})); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFromYAMLMultipleDocuments(t *testing.T) {
+	t.Parallel()
+	nodesYAML := `
+name: split
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true}
+  R2:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true}
+`
+	linksYAML := `
+links:
+  - endpoints: [R1, R2]
+`
+	overridesYAML := `
+ip_mode: ipv4
+links:
+  - endpoints: [R1, R2]
+    ipv4_subnet: 10.1.100.0/24
+nodes:
+  R2:
+    image: "quay.io/frrouting/frr:10.3.0"
+    protocols: {bgp: true}
+    asn: 65002
+`
+	want, err := FromYAML([]byte(`
+name: split
+ip_mode: ipv4
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true}
+  R2:
+    image: "quay.io/frrouting/frr:10.3.0"
+    protocols: {ospf: true, bgp: true}
+    asn: 65002
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R1, R2]
+    ipv4_subnet: 10.1.100.0/24
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name string
+		docs [][]byte
+	}{
+		{
+			name: "SeparateDocuments",
+			docs: [][]byte{[]byte(nodesYAML), []byte(linksYAML), []byte(overridesYAML)},
+		},
+		{
+			name: "DocumentStream",
+			docs: [][]byte{[]byte(nodesYAML + "---" + linksYAML + "---" + overridesYAML)},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FromYAML(tc.docs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(Topology{})); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestFromYAMLNodeEnv(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: env
+profiles:
+  ceos: {env: {CEOS: "1", INTFTYPE: eth}}
+nodes:
+  R1:
+    image: "ceos:4.32.0F"
+    profile: ceos
+    env: {INTFTYPE: et, ETBA: "1"}
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"CEOS": "1", "INTFTYPE": "et", "ETBA": "1"}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Env); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFromYAMLLayout(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: layout
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+    position: {x: 120, y: 40.5}
+    group: core
+  R2:
+    image: "quay.io/frrouting/frr:master"
+links:
+  - endpoints: [R1, R2]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1 := topo.Nodes["R1"]
+	if diff := cmp.Diff(&Position{X: 120, Y: 40.5}, r1.Position); diff != "" {
+		t.Errorf("position mismatch (-want +got):\n%s", diff)
+	}
+	if r1.Group != "core" {
+		t.Errorf("group: want %q, got %q", "core", r1.Group)
+	}
+	if r2 := topo.Nodes["R2"]; r2.Position != nil || r2.Group != "" {
+		t.Errorf("layout: want none, got %v and %q", r2.Position, r2.Group)
+	}
+}
+
+func TestFromYAMLDisabled(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: disabled
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master", disabled: true}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    disabled: true
+  - endpoints: [R1, R3]
+    disabled: true
+  - endpoints: [R3, R1]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"R1", "R3"}, slices.Sorted(maps.Keys(topo.Nodes))); diff != "" {
+		t.Errorf("nodes mismatch (-want +got):\n%s", diff)
+	}
+	// remaining links keep the names given by their position
+	if len(topo.Links) != 1 || topo.Links[0].Name != "golab-link-03" {
+		t.Errorf("links: want golab-link-03 only, got %v", topo.Links)
+	}
+}
+
+func TestFromYAMLDisabledErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "LinkToDisabledNode",
+			yaml: `
+name: disabled
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master", disabled: true}
+links:
+  - endpoints: [R1, R2]
+`,
+			wantErr: `link [R1 R2] is attached to disabled node "R2"`,
+		},
+		{
+			name: "DependencyOnDisabledNode",
+			yaml: `
+name: disabled
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", depends_on: [R2]}
+  R2: {image: "quay.io/frrouting/frr:master", disabled: true}
+`,
+			wantErr: `node "R1" depends on disabled node "R2"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := FromYAML([]byte(tc.yaml))
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("error: want %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFromYAMLSequentialIPAM(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: sequential
+ipam: sequential
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R2, R3]
+  - endpoints: [R1, R2]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subnets []string
+	for _, link := range topo.Links {
+		subnets = append(subnets, link.IPv4Subnet, link.IPv6Subnet)
+	}
+	wantSubnets := []string{"10.0.1.0/24", "2001:db8:0:1::/64", "10.0.2.0/24", "2001:db8:0:2::/64"}
+	if diff := cmp.Diff(wantSubnets, subnets); diff != "" {
+		t.Errorf("subnets mismatch (-want +got):\n%s", diff)
+	}
+	// hosts keep their node index within the subnet
+	if got := topo.Nodes["R3"].Interfaces[0].IPv4Addr; got != "10.0.1.3/24" {
+		t.Errorf("R3 address: want %q, got %q", "10.0.1.3/24", got)
+	}
+	if got := topo.Nodes["R3"].IPv4Loopbacks; !slices.Equal(got, []string{"192.168.0.3/32"}) {
+		t.Errorf("R3 loopbacks: want [192.168.0.3/32], got %v", got)
+	}
+}
+
+func TestFromYAMLLinkPool(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: pool
+link_pool: 10.0.0.0/16
+link_prefix_len: 29
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R12: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R12, R1]
+  - endpoints: [R1, R2]
+    ipv4_subnet: 10.0.59.8/29
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := topo.Links[0]
+	// the pool skips the subnet declared explicitly, which the link hashes to, while IPv6 subnets are allocated as usual
+	if link.IPv4Subnet != "10.0.59.16/29" || link.IPv6Subnet != "2001:db8:12:1::/64" {
+		t.Errorf("subnets: want 10.0.59.16/29 and 2001:db8:12:1::/64, got %s and %s", link.IPv4Subnet, link.IPv6Subnet)
+	}
+	if link.IPv4Gateway != "10.0.59.22" {
+		t.Errorf("gateway: want 10.0.59.22, got %s", link.IPv4Gateway)
+	}
+	got := []string{topo.Nodes["R12"].Interfaces[0].IPv4Addr, topo.Nodes["R1"].Interfaces[0].IPv4Addr}
+	if diff := cmp.Diff([]string{"10.0.59.17/29", "10.0.59.18/29"}, got); diff != "" {
+		t.Errorf("addresses mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLStableAllocation(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: stable
+ipam: hash
+link_pool: 10.0.0.0/16
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R2, R3]
+  - endpoints: [R1, R2]
+    name: backup
+`
+	subnets := func(yaml string) map[string][]string {
+		t.Helper()
+		topo, err := FromYAML([]byte(yaml))
+		if err != nil {
+			t.Fatal(err)
+		}
+		subnets := make(map[string][]string)
+		for _, link := range topo.Links {
+			key := fmt.Sprint(link.Endpoints)
+			if !strings.HasPrefix(link.Name, "golab-link-") {
+				key = link.Name
+			}
+			subnets[key] = []string{link.IPv4Subnet, link.IPv6Subnet}
+		}
+		return subnets
+	}
+	want := subnets(testYAML)
+	// a link added in the middle gets its own subnets without moving the others
+	got := subnets(strings.Replace(testYAML, "links:\n", "links:\n  - endpoints: [R1, R3]\n", 1))
+	delete(got, "[R1 R3]")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("subnets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLLinkNameErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		links   string
+		wantErr string
+	}{
+		{
+			name:    "InvalidName",
+			links:   "  - {endpoints: [R1, R2], name: \"core link\"}\n",
+			wantErr: `link [R1 R2] has invalid name "core link"`,
+		},
+		{
+			name:    "ReservedPrefix",
+			links:   "  - {endpoints: [R1, R2], name: golab-link-02}\n",
+			wantErr: `link [R1 R2] has invalid name "golab-link-02"`,
+		},
+		{
+			name:    "SharedName",
+			links:   "  - {endpoints: [R1, R2], name: core}\n  - {endpoints: [R2, R1], name: core}\n",
+			wantErr: `links [R1 R2] and [R2 R1] share name "core"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			yaml := `
+name: names
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+` + tc.links
+			_, err := FromYAML([]byte(yaml))
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("error: want %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFromYAMLIPExclude(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: exclude
+ip_mode: ipv4
+ipam: sequential
+link_pool: 10.0.0.0/16
+ip_exclude: [10.0.0.0/24, 192.168.0.1]
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := topo.Links[0].IPv4Subnet; got != "10.0.1.0/24" {
+		t.Errorf("subnet: want 10.0.1.0/24, got %s", got)
+	}
+	got := []string{topo.Nodes["R1"].IPv4Loopbacks[0], topo.Nodes["R2"].IPv4Loopbacks[0]}
+	if diff := cmp.Diff([]string{"192.168.0.2/32", "192.168.0.3/32"}, got); diff != "" {
+		t.Errorf("loopbacks mismatch (-want +got):\n%s", diff)
+	}
+	// the index strategy cannot move calculated addresses out of excluded ranges
+	testYAML = strings.NewReplacer("ipam: sequential\n", "", "link_pool: 10.0.0.0/16\n", "", "192.168.0.1", "10.1.2.0/24").Replace(testYAML)
+	wantErr := "failed to allocate subnet of link [R1 R2]: 10.1.2.0/24 overlaps excluded range 10.1.2.0/24"
+	if _, err := FromYAML([]byte(testYAML)); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestFromYAMLMgmtSubnetReserved(t *testing.T) {
+	t.Parallel()
+	// the link hashes to 10.255.255.0/24, which lies in the default management subnet
+	testYAML := `
+name: reserved
+ip_mode: ipv4
+ipam: hash
+mgmt: {}
+nodes:
+  R94: {image: "quay.io/frrouting/frr:master"}
+  R205: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R94, R205]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := topo.Links[0].IPv4Subnet; got != "10.0.1.0/24" {
+		t.Errorf("subnet: want 10.0.1.0/24, got %s", got)
+	}
+	// the index strategy cannot move calculated subnets out of the management subnet
+	testYAML = `
+name: reserved
+ip_mode: ipv4
+mgmt: {ipv4_subnet: 10.1.0.0/16}
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+`
+	wantErr := "failed to allocate subnet of link [R1 R2]: 10.1.2.0/24 overlaps excluded range 10.1.0.0/16"
+	if _, err := FromYAML([]byte(testYAML)); err == nil || err.Error() != wantErr {
+		t.Errorf("error: want %q, got %v", wantErr, err)
+	}
+}
+
+func TestFromYAMLReservedLoopbacks(t *testing.T) {
+	t.Parallel()
+	for _, strategy := range []string{"sequential", "hash"} {
+		t.Run(strategy, func(t *testing.T) {
+			t.Parallel()
+			testYAML := `
+name: reserved
+ip_mode: ipv4
+ipam: ` + strategy + `
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+`
+			topo, err := FromYAML([]byte(testYAML))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// R1 takes the loopback R2 would be allocated otherwise
+			taken := topo.Nodes["R2"].IPv4Loopbacks[0]
+			testYAML = strings.Replace(testYAML, "  R1: {", "  R1: {ipv4_loopbacks: ["+taken+"], ", 1)
+			topo, err = FromYAML([]byte(testYAML))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := topo.Nodes["R2"].IPv4Loopbacks[0]; got == taken {
+				t.Errorf("R2 loopback: want other than reserved %s, got %s", taken, got)
+			}
+		})
+	}
+}
+
+func TestFromYAMLLinkGateway(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: gateways
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    gateway: 10.1.2.100
+  - endpoints: [R1, R3]
+    no_gateway: true
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, link := range topo.Links {
+		got = append(got, link.IPv4Gateway, link.IPv6Gateway)
+	}
+	want := []string{"10.1.2.100", "2001:db8:1:2::254", "", ""}
 	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("gateways mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLLinkGatewayErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		gateway string
+		wantErr string
+	}{
+		{
+			name:    "OutsideSubnet",
+			gateway: "10.1.3.1",
+			wantErr: "gateway 10.1.3.1 of link [R1 R2] is outside of its subnet 10.1.2.0/24",
+		},
+		{
+			name:    "NodeAddress",
+			gateway: "2001:db8:1:2::2",
+			wantErr: `gateway 2001:db8:1:2::2 of link [R1 R2] collides with the address of node "R2"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			testYAML := fmt.Sprintf(`
+name: gateways
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    gateway: %q
+`, tc.gateway)
+			_, err := FromYAML([]byte(testYAML))
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("error: want %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFromYAMLHost(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: hosts
+nodes:
+  R1:
+    image: "quay.io/frrouting/frr:master"
+  R2:
+    image: "alpine:latest"
+    entrypoint: [/bin/sh, -c]
+    cmd: ["ip route add 192.168.0.0/16 via 10.1.2.1 && sleep infinity"]
+links:
+  - endpoints: [R1, R2]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := topo.Nodes["R2"]
+	if diff := cmp.Diff([]string{"/bin/sh", "-c"}, host.Entrypoint); diff != "" {
 		t.Error(diff)
 	}
+	if diff := cmp.Diff([]string{"ip route add 192.168.0.0/16 via 10.1.2.1 && sleep infinity"}, host.Cmd); diff != "" {
+		t.Error(diff)
+	}
+	// generic images do not get a configuration directory mounted
+	if len(host.Binds) != 0 {
+		t.Errorf("binds: want none, got %v", host.Binds)
+	}
+}
+
+func TestFromYAMLHostKind(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: hosts
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "alpine:latest", kind: host, gateway: R1}
+links:
+  - endpoints: [R1, R2]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := topo.Nodes["R2"]
+	if diff := cmp.Diff([]string{"sleep", "infinity"}, host.Cmd); diff != "" {
+		t.Errorf("cmd mismatch (-want +got):\n%s", diff)
+	}
+	if host.IPv4Gateway != "10.1.2.1" || host.IPv6Gateway != "2001:db8:1:2::1" {
+		t.Errorf("gateways: want 10.1.2.1 and 2001:db8:1:2::1, got %q and %q", host.IPv4Gateway, host.IPv6Gateway)
+	}
+}
+
+func TestFromYAMLHostKindErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		nodes  string
+		errMsg string
+	}{
+		{
+			name:   "Protocols",
+			nodes:  `{R1: {image: "quay.io/frrouting/frr:master"}, R2: {image: "alpine:latest", kind: host, protocols: {bgp: true}}}`,
+			errMsg: `node "R2" of kind "host" cannot run routing protocols`,
+		},
+		{
+			name:   "GatewayOfRouter",
+			nodes:  `{R1: {image: "quay.io/frrouting/frr:master", gateway: R2}, R2: {image: "alpine:latest", kind: host}}`,
+			errMsg: `node "R1" sets gateway but is not of kind "host" or "linux"`,
+		},
+		{
+			name:   "UnknownGateway",
+			nodes:  `{R1: {image: "quay.io/frrouting/frr:master"}, R2: {image: "alpine:latest", kind: host, gateway: R9}}`,
+			errMsg: `node "R2" has invalid gateway "R9"`,
+		},
+		{
+			name:   "DistantGateway",
+			nodes:  `{R1: {image: "quay.io/frrouting/frr:master"}, R2: {image: "alpine:latest", kind: host, gateway: R3}, R3: {image: "quay.io/frrouting/frr:master"}}`,
+			errMsg: `node "R2" does not share an addressed link with its gateway "R3"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			testYAML := "name: hosts\nnodes: " + tc.nodes + "\nlinks: [{endpoints: [R1, R2]}]\n"
+			_, err := FromYAML([]byte(testYAML))
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestFromYAMLNoIP(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: l2
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", protocols: {isis: true}}
+  R2: {image: "quay.io/frrouting/frr:master", protocols: {isis: true}}
+links:
+  - endpoints: [R1, R2]
+    ip: none
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := topo.Links[0]
+	if link.IPv4Subnet != "" || link.IPv6Subnet != "" || link.IPv4Gateway != "" || link.IPv6Gateway != "" {
+		t.Errorf("link: want no addressing, got %+v", link)
+	}
+	for name, node := range topo.Nodes {
+		if iface := node.Interfaces[0]; iface.IPv4Addr != "" || iface.IPv6Addr != "" {
+			t.Errorf("%s interface: want no addresses, got %+v", name, iface)
+		}
+	}
+}
+
+func TestFromYAMLLinkLocal(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: unnumbered
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", protocols: {ldp: true}}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    ip: link-local
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link := topo.Links[0]; link.IPv4Subnet != "" || link.IPv6Subnet != "" {
+		t.Errorf("subnets: want none, got %q and %q", link.IPv4Subnet, link.IPv6Subnet)
+	}
+	want := &Interface{
+		Name:      "eth0",
+		Link:      "golab-link-01",
+		LinkLocal: true,
+		DriverOpts: map[string]string{
+			"com.docker.network.endpoint.sysctls": "net.mpls.conf.IFNAME.input=1,net.ipv6.conf.IFNAME.disable_ipv6=0",
+		},
+	}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Interfaces[0]); diff != "" {
+		t.Errorf("interface mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLVeth(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: lacp
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    link_type: veth
+  - endpoints: [R1, R3]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link := topo.Links[0]; link.IPv4Gateway != "" || link.IPv6Gateway != "" {
+		t.Errorf("gateways: want none, got %q and %q", link.IPv4Gateway, link.IPv6Gateway)
+	}
+	// Docker attaches the network as the first interface unless told otherwise
+	want := []*Interface{
+		{Name: "eth0", Link: "golab-link-01", IPv4Addr: "10.1.2.1/24", IPv6Addr: "2001:db8:1:2::1/64", Veth: true},
+		{
+			Name:       "eth1",
+			Link:       "golab-link-02",
+			IPv4Addr:   "10.1.3.1/24",
+			IPv6Addr:   "2001:db8:1:3::1/64",
+			DriverOpts: map[string]string{"com.docker.network.endpoint.ifname": "eth1"},
+		},
+	}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Interfaces); diff != "" {
+		t.Errorf("interfaces mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLVethLoop(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: loop
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: ["R1:eth1", "R1:eth2"]
+    link_type: veth
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Interface{
+		{Name: "eth1", Link: "golab-link-01", IPv4Addr: "10.1.1.1/24", IPv6Addr: "2001:db8:1:1::1/64", Veth: true},
+		{Name: "eth2", Link: "golab-link-01", IPv4Addr: "10.1.1.254/24", IPv6Addr: "2001:db8:1:1::254/64", Veth: true},
+	}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Interfaces); diff != "" {
+		t.Errorf("interfaces mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLSnapshot(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: Lab1
+snapshot: v1
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+syslog: {}
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the vendor is detected from the image the snapshot was taken of
+	node := topo.Nodes["R1"]
+	if node.Image != "golab-snapshot/lab1/r1:v1" || node.Vendor != vendors.FRR {
+		t.Errorf("node: want snapshot image of FRR, got %q of %q", node.Image, node.Vendor)
+	}
+	if got := topo.Services[0].Image; got != defaultSyslogImage {
+		t.Errorf("service image: want its own, got %q", got)
+	}
+	errMsg := `snapshot "v1:latest" is not a valid image tag, e.g. 20250102-150405 expected`
+	_, err = FromYAML([]byte(strings.Replace(testYAML, "snapshot: v1", "snapshot: v1:latest", 1)))
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestFromYAMLEndpointOpts(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: opts
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", protocols: {ldp: true}}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: ["R1:eth1", R2]
+    endpoint_opts:
+      R1:
+        com.docker.network.endpoint.sysctls: net.ipv4.conf.IFNAME.rp_filter=0
+      R2:
+        com.docker.network.endpoint.sysctls: net.ipv4.conf.IFNAME.proxy_arp=1
+  - endpoints: [R1, R3]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// options override the ones set by golab, apart from pinned interface names
+	want := map[string]string{
+		"com.docker.network.endpoint.sysctls": "net.ipv4.conf.IFNAME.rp_filter=0",
+		"com.docker.network.endpoint.ifname":  "eth1",
+	}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Interfaces[0].DriverOpts); diff != "" {
+		t.Errorf("R1 driver options mismatch (-want +got):\n%s", diff)
+	}
+	want = map[string]string{"com.docker.network.endpoint.sysctls": "net.ipv4.conf.IFNAME.proxy_arp=1"}
+	if diff := cmp.Diff(want, topo.Nodes["R2"].Interfaces[0].DriverOpts); diff != "" {
+		t.Errorf("R2 driver options mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLSubinterfaces(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: vlans
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    ip: none
+  - endpoints: ["R1:eth0.100", "R2:eth0.100"]
+  - endpoints: ["R1:eth0.200", "R2:eth0.200"]
+    ip: none
+  - endpoints: [R1, R3]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Interface{
+		{Name: "eth0", Link: "golab-link-01"},
+		{Name: "eth0.100", Link: "golab-link-02", Parent: "eth0", VLAN: 100, IPv4Addr: "10.1.2.1/24", IPv6Addr: "2001:db8:1:2::1/64"},
+		{Name: "eth0.200", Link: "golab-link-03", Parent: "eth0", VLAN: 200},
+		{Name: "eth1", Link: "golab-link-04", IPv4Addr: "10.1.3.1/24", IPv6Addr: "2001:db8:1:3::1/64"},
+	}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Interfaces); diff != "" {
+		t.Errorf("interfaces mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"R1", "R2"}, topo.Links[1].Endpoints); diff != "" {
+		t.Errorf("endpoints mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLPinnedInterfaces(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: pinned
+nodes:
+  R1: {image: "crpd:23.2R1.13"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: ["R1:ge-0/0/2", R2]
+  - endpoints: [R1, R3]
+  - endpoints: ["R1:ge-0/0/2.100", "R2:eth0.100"]
+    ip: none
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Interface{
+		{
+			Name:       "eth2",
+			Link:       "golab-link-01",
+			IPv4Addr:   "10.1.2.1/24",
+			IPv6Addr:   "2001:db8:1:2::1/64",
+			DriverOpts: map[string]string{"com.docker.network.endpoint.ifname": "eth2"},
+		},
+		{
+			Name:       "eth0",
+			Link:       "golab-link-02",
+			IPv4Addr:   "10.1.3.1/24",
+			IPv6Addr:   "2001:db8:1:3::1/64",
+			DriverOpts: map[string]string{"com.docker.network.endpoint.ifname": "eth0"},
+		},
+	}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Interfaces[:2]); diff != "" {
+		t.Errorf("interfaces mismatch (-want +got):\n%s", diff)
+	}
+	if subif := topo.Nodes["R1"].Interfaces[2]; subif.Name != "eth2.100" || subif.Parent != "eth2" {
+		t.Errorf("subinterface: want eth2.100 on top of eth2, got %s on top of %s", subif.Name, subif.Parent)
+	}
+	if opts := topo.Nodes["R2"].Interfaces[0].DriverOpts; opts != nil {
+		t.Errorf("R2 driver options: want none, got %v", opts)
+	}
+}
+
+func TestFromYAMLVM(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: vms
+mgmt: {}
+nodes:
+  R1: {image: "vrnetlab/vr-vmx:18.2R1.9"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: ["R1:ge-0/0/1", R2]
+  - endpoints: [R1, R3]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1 := topo.Nodes["R1"]
+	if r1.Vendor != vendors.VMX || r1.ReadyTimeout != "15m" {
+		t.Errorf("R1 vendor and ready timeout: want vmx and 15m, got %s and %s", r1.Vendor, r1.ReadyTimeout)
+	}
+	if diff := cmp.Diff([]string{"/dev/kvm", "/dev/net/tun"}, r1.Devices); diff != "" {
+		t.Errorf("devices mismatch (-want +got):\n%s", diff)
+	}
+	// data interfaces of the VM start at eth1
+	var names []string
+	for _, iface := range r1.Interfaces {
+		names = append(names, iface.Name)
+	}
+	if diff := cmp.Diff([]string{"eth2", "eth1"}, names); diff != "" {
+		t.Errorf("interfaces mismatch (-want +got):\n%s", diff)
+	}
+	_, err = FromYAML([]byte(strings.Replace(testYAML, "mgmt: {}\n", "", 1)))
+	errMsg := `node "R1" of kind "vmx" is managed over eth0, which requires the mgmt section`
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestFromYAMLPinnedInterfaceErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		links  string
+		errMsg string
+	}{
+		{
+			name:   "ForeignName",
+			links:  `[{endpoints: ["R1:Ethernet1", R2]}]`,
+			errMsg: `node "R1" has unknown interface "Ethernet1" in link [R1 R2]`,
+		},
+		{
+			name:   "AttachedTwice",
+			links:  `[{endpoints: ["R1:eth1", R2]}, {endpoints: ["R1:eth1", R2]}]`,
+			errMsg: `node "R1" interface eth1 is attached to both links golab-link-01 and golab-link-02`,
+		},
+		{
+			name:   "PinnedTwice",
+			links:  `[{endpoints: ["R1:eth1", "R1:eth1"], link_type: veth}]`,
+			errMsg: `link [R1 R1] has duplicate endpoint "R1:eth1"`,
+		},
+		{
+			name:   "NetworkLoop",
+			links:  `[{endpoints: ["R1:eth1", "R1:eth2"]}]`,
+			errMsg: `link [R1 R1] attaches node "R1" twice, which requires link_type veth and pinned interfaces`,
+		},
+		{
+			name:   "UnpinnedLoop",
+			links:  `[{endpoints: ["R1:eth1", R1], link_type: veth}]`,
+			errMsg: `link [R1 R1] attaches node "R1" twice, which requires link_type veth and pinned interfaces`,
+		},
+		{
+			name:   "SubinterfaceTwice",
+			links:  `[{endpoints: [R1, R2]}, {endpoints: ["R1:eth0.10", "R2:eth0.10"]}, {endpoints: ["R1:eth0.10", "R2:eth0.20"]}]`,
+			errMsg: `node "R1" subinterface eth0.10 is attached to both links golab-link-02 and golab-link-03`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			testYAML := `
+name: pinned
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links: ` + tc.links
+			_, err := FromYAML([]byte(testYAML))
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestFromYAMLTemplates(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: fabric
+templates:
+  router:
+    image: "quay.io/frrouting/frr:master"
+    protocols: {ospf: true, bgp: true}
+  spine:
+    based_on: router
+    asn: 65000
+  leaf:
+    based_on: router
+    protocols: {ospf: false}
+nodes:
+  R1: {based_on: spine}
+  R2: {based_on: spine, image: "quay.io/frrouting/frr:10.3.0"}
+groups:
+  leaf:
+    count: 2
+    node: {based_on: leaf, asn: 65101, protocols: {isis: true}}
+links:
+  - endpoints: [R1, leaf]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name      string
+		image     string
+		asn       uint32
+		protocols map[string]bool
+	}{
+		{name: "R1", image: "quay.io/frrouting/frr:master", asn: 65000, protocols: map[string]bool{"ospf": true, "bgp": true}},
+		{name: "R2", image: "quay.io/frrouting/frr:10.3.0", asn: 65000, protocols: map[string]bool{"ospf": true, "bgp": true}},
+		{name: "leaf2", image: "quay.io/frrouting/frr:master", asn: 65101, protocols: map[string]bool{"ospf": false, "bgp": true, "isis": true}},
+	}
+	for _, tc := range testCases {
+		node := topo.Nodes[tc.name]
+		if node.Image != tc.image {
+			t.Errorf("%s image: want %q, got %q", tc.name, tc.image, node.Image)
+		}
+		if node.ASN == nil || *node.ASN != tc.asn {
+			t.Errorf("%s asn: want %d, got %v", tc.name, tc.asn, node.ASN)
+		}
+		if diff := cmp.Diff(tc.protocols, node.Protocols); diff != "" {
+			t.Errorf("%s protocols mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestFromYAMLTemplateErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name      string
+		templates string
+		errMsg    string
+	}{
+		{
+			name:      "Undefined",
+			templates: `{spine: {image: "quay.io/frrouting/frr:master"}}`,
+			errMsg:    `node "R1" is based on undefined template "leaf"`,
+		},
+		{
+			name:      "UndefinedBase",
+			templates: `{leaf: {based_on: router}}`,
+			errMsg:    `template "leaf" is based on undefined template "router"`,
+		},
+		{
+			name:      "Loop",
+			templates: `{leaf: {based_on: spine}, spine: {based_on: leaf}}`,
+			errMsg:    `template "leaf" is based on itself`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			testYAML := "name: fabric\ntemplates: " + tc.templates + "\nnodes: {R1: {based_on: leaf}}\n"
+			_, err := FromYAML([]byte(testYAML))
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		"shared/core.yml": `
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", protocols: {ospf: true}}
+  R2: {image: "quay.io/frrouting/frr:master", protocols: {ospf: true}}
+links:
+  - endpoints: [R1, R2]
+`,
+		"lab.yml": `
+name: lab
+include: [shared/core.yml]
+nodes:
+  R2: {image: "quay.io/frrouting/frr:10.3.0"}
+`,
+		"loop.yml": "include: [loop.yml]\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ReadFile(filepath.Join(dir, "lab.yml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topo, err := FromYAML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := topo.Nodes["R1"].Image; got != "quay.io/frrouting/frr:master" {
+		t.Errorf("R1 image: want included %q, got %q", "quay.io/frrouting/frr:master", got)
+	}
+	if got := topo.Nodes["R2"].Image; got != "quay.io/frrouting/frr:10.3.0" {
+		t.Errorf("R2 image: want overridden %q, got %q", "quay.io/frrouting/frr:10.3.0", got)
+	}
+	if len(topo.Links) != 1 {
+		t.Errorf("links: want 1 included, got %d", len(topo.Links))
+	}
+	loopPath := filepath.Join(dir, "loop.yml")
+	wantMsg := fmt.Sprintf("topology file %s includes itself", loopPath)
+	if _, err := ReadFile(loopPath, nil); err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestReadFileTemplated(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		"leaves.yml": `
+vars:
+  leaves: 2
+nodes:
+{{- range seq .leaves }}
+  R{{ . }}: {image: "quay.io/frrouting/frr:master"}
+{{- end }}
+`,
+		"lab.yml": `
+vars:
+  core: core.yml
+name: lab
+include: [{{ .core }}, leaves.yml]
+`,
+		"core.yml": `
+nodes:
+  C1: {image: "quay.io/frrouting/frr:master"}
+`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ReadFile(filepath.Join(dir, "lab.yml"), map[string]string{"leaves": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := NodeNames(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"C1", "R1", "R2", "R3"}; !slices.Equal(names, want) {
+		t.Errorf("node names: want %v, got %v", want, names)
+	}
+	path := filepath.Join(dir, "leaves.yml")
+	wantMsg := fmt.Sprintf(`failed to render %s: template: topology:5:10: executing "topology" at <seq .leaves>: error calling seq: seq expects a number, got many`, path)
+	_, err = ReadFile(path, map[string]string{"leaves": "many"})
+	if err == nil || err.Error() != wantMsg || !errors.Is(err, ErrRender) {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestFromYAMLSharedSubnet(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: vlans
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    ip: none
+  - endpoints: ["R1:eth0.100", "R2:eth0.100"]
+  - endpoints: ["R1:eth0.200", "R2:eth0.200"]
+`
+	_, err := FromYAML([]byte(testYAML))
+	wantMsg := "links golab-link-02 and golab-link-03 share subnet 10.1.2.0/24, set subnets explicitly"
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestFromYAMLHostInterface(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: desk
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R1, "host:enp3s0"]
+    ipv4_subnet: 192.168.1.0/24
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := topo.Links[1]
+	if link.HostInterface != "enp3s0" || !link.External || link.IPv6Subnet != "" {
+		t.Errorf("link: want external IPv4-only link bridged to enp3s0, got %+v", link)
+	}
+	if diff := cmp.Diff([]string{"R1"}, link.Endpoints); diff != "" {
+		t.Errorf("endpoints mismatch (-want +got):\n%s", diff)
+	}
+	want := &Interface{Name: "eth1", Link: "golab-link-02", IPv4Addr: "192.168.1.1/24"}
+	if diff := cmp.Diff(want, topo.Nodes["R1"].Interfaces[1]); diff != "" {
+		t.Errorf("interface mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromYAMLCalculatedSubnetOverlap(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: overlap
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R2, R3]
+    ipv4_subnet: 10.1.0.0/16
+`
+	_, err := FromYAML([]byte(testYAML))
+	wantMsg := "subnet 10.1.0.0/16 of link [R2 R3] overlaps subnet 10.1.2.0/24 of link [R1 R2], set addresses explicitly"
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestFromYAMLSubinterfaceWithoutParent(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: vlans
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    ip: none
+  - endpoints: ["R1:eth0.100", "R2:eth1.100"]
+`
+	_, err := FromYAML([]byte(testYAML))
+	wantMsg := `node "R2" subinterface eth1.100 does not have parent interface eth1`
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestFromYAMLSubinterfaceTrunkErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		links   string
+		wantMsg string
+	}{
+		{
+			name: "parents on different links",
+			links: `
+  - endpoints: [R1, R2]
+  - endpoints: [R1, R3]
+  - endpoints: ["R2:eth0.100", "R3:eth0.100"]`,
+			wantMsg: "link [R2 R3] has parent interfaces attached to links golab-link-01 and golab-link-02 rather than a single trunk",
+		},
+		{
+			name: "different VLAN IDs",
+			links: `
+  - endpoints: [R1, R2]
+  - endpoints: ["R1:eth0.100", "R2:eth0.200"]`,
+			wantMsg: "link [R1 R2] mixes VLAN IDs 100 and 200, which do not reach each other",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			testYAML := `
+name: vlans
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:` + tc.links
+			_, err := FromYAML([]byte(testYAML))
+			if err == nil || err.Error() != tc.wantMsg {
+				t.Errorf("error: want %q, got %v", tc.wantMsg, err)
+			}
+		})
+	}
+}
+
+func TestNodeNames(t *testing.T) {
+	t.Parallel()
+	// an incomplete topology still yields node names for shell completion
+	testYAML := `
+nodes:
+  R2: {}
+  R10: {}
+  R1: {}
+  R3: {disabled: true}
+groups:
+  leaf: {count: 2}
+  spine: {count: 2, node: {disabled: true}}
+`
+	got, err := NodeNames([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"R1", "R10", "R2", "leaf1", "leaf2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("node names: want %v, got %v", want, got)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GOLAB_TEST_IMAGE", "quay.io/frrouting/frr:10.3.0")
+	t.Setenv("GOLAB_TEST_EMPTY", "")
+	t.Setenv("GOLAB_TEST_SYNTAX", "it's: \"#1\"\nnext")
+	testCases := []struct {
+		name   string
+		data   string
+		want   string
+		errMsg string
+	}{
+		{
+			name: "Set",
+			data: `image: "${GOLAB_TEST_IMAGE}"`,
+			want: `image: "quay.io/frrouting/frr:10.3.0"`,
+		},
+		{
+			name: "SetWithDefault",
+			data: `image: "${GOLAB_TEST_IMAGE:-alpine}"`,
+			want: `image: "quay.io/frrouting/frr:10.3.0"`,
+		},
+		{
+			name: "UnsetWithDefault",
+			data: `binds: ["${GOLAB_TEST_UNSET:-/tmp}/R1:/data"]`,
+			want: `binds: ["/tmp/R1:/data"]`,
+		},
+		{
+			name: "EmptyWithDefault",
+			data: `image: "${GOLAB_TEST_EMPTY:-quay.io/frrouting/frr:master}"`,
+			want: `image: "quay.io/frrouting/frr:master"`,
+		},
+		{
+			name: "Escaped",
+			data: `cmd: "echo $${HOME} $HOME"`,
+			want: `cmd: "echo ${HOME} $HOME"`,
+		},
+		{
+			name:   "Unset",
+			data:   `image: "${GOLAB_TEST_UNSET}"`,
+			errMsg: `environment variable "GOLAB_TEST_UNSET" is not set`,
+		},
+		{
+			name: "Comment",
+			data: "# image: ${GOLAB_TEST_UNSET}\nimage: alpine # or ${GOLAB_TEST_UNSET}\n",
+			want: "# image: ${GOLAB_TEST_UNSET}\nimage: alpine # or ${GOLAB_TEST_UNSET}\n",
+		},
+		{
+			name: "HashInQuotes",
+			data: `cmd: "echo '#' ${GOLAB_TEST_IMAGE}"`,
+			want: `cmd: "echo '#' quay.io/frrouting/frr:10.3.0"`,
+		},
+		{
+			name: "DoubleQuoted",
+			data: `description: "${GOLAB_TEST_SYNTAX}"`,
+			want: `description: "it's: \"#1\"\nnext"`,
+		},
+		{
+			name:   "SingleQuotedLineBreak",
+			data:   `description: '${GOLAB_TEST_SYNTAX}'`,
+			errMsg: `environment variable "GOLAB_TEST_SYNTAX" contains a line break, which requires double quotes, e.g. "${GOLAB_TEST_SYNTAX}"`,
+		},
+		{
+			name:   "PlainSyntax",
+			data:   `description: ${GOLAB_TEST_SYNTAX}`,
+			errMsg: `environment variable "GOLAB_TEST_SYNTAX" contains YAML syntax, which requires double quotes, e.g. "${GOLAB_TEST_SYNTAX}"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := expandEnv([]byte(tc.data))
+			if tc.errMsg != "" {
+				if err == nil || err.Error() != tc.errMsg {
+					t.Errorf("error: want %q, got %v", tc.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestExpandEnvSingleQuoted(t *testing.T) {
+	t.Setenv("GOLAB_TEST_OWNER", "R1's uplink")
+	got, err := expandEnv([]byte("description: '${GOLAB_TEST_OWNER}'\nnote: R1's ${GOLAB_TEST_UNSET:-spare}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "description: 'R1''s uplink'\nnote: R1's spare\n"
+	if string(got) != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestFromYAMLEnv(t *testing.T) {
+	t.Setenv("GOLAB_TEST_TAG", "10.3.0")
+	testYAML := `
+name: env
+nodes:
+  R1: {image: "quay.io/frrouting/frr:${GOLAB_TEST_TAG}"}
+  R2: {image: "${GOLAB_TEST_IMAGE:-alpine:latest}"}
+links:
+  - endpoints: [R1, R2]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := topo.Nodes["R1"].Image; got != "quay.io/frrouting/frr:10.3.0" {
+		t.Errorf("R1 image: want %q, got %q", "quay.io/frrouting/frr:10.3.0", got)
+	}
+	if got := topo.Nodes["R2"].Image; got != "alpine:latest" {
+		t.Errorf("R2 image: want %q, got %q", "alpine:latest", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: fabric
+vars:
+  leaves: 2
+  # comments and blank lines do not end the section
+
+  ospf: true
+nodes:
+{{- range seq .leaves }}
+  R{{ . }}: {image: "quay.io/frrouting/frr:master"{{ if eq $.ospf true }}, protocols: {ospf: true}{{ end }}}
+{{- end }}
+links:
+  - endpoints: [R1, R2]
+---
+vars: {ospf: false}
+`
+	testCases := []struct {
+		name      string
+		overrides map[string]string
+		want      []string
+	}{
+		{
+			name: "Vars",
+			want: []string{"R1", "R2"},
+		},
+		{
+			name:      "Overrides",
+			overrides: map[string]string{"leaves": "3", "ospf": "false"},
+			want:      []string{"R1", "R2", "R3"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			data, err := Render([]byte(testYAML), tc.overrides)
+			if err != nil {
+				t.Fatal(err)
+			}
+			topo, err := FromYAML(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := slices.Sorted(maps.Keys(topo.Nodes))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("nodes mismatch (-want +got):\n%s", diff)
+			}
+			if topo.Nodes["R1"].Protocols["ospf"] {
+				t.Error("R1 runs OSPF although the last vars section disables it")
+			}
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		data   string
+		errMsg string
+	}{
+		{
+			name:   "MissingVar",
+			data:   "name: {{ .lab }}\n",
+			errMsg: `template: topology:1:9: executing "topology" at <.lab>: map has no entry for key "lab"`,
+		},
+		{
+			name:   "NotANumber",
+			data:   "vars: {count: many}\n{{ range seq .count }}{{ end }}\n",
+			errMsg: `template: topology:2:9: executing "topology" at <seq .count>: error calling seq: seq expects a number, got many`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Render([]byte(tc.data), nil)
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
 }
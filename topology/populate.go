@@ -1,37 +1,840 @@
 package topology
 
 import (
+	"cmp"
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
+	"maps"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/elupevg/golab/ipam"
 	"github.com/elupevg/golab/vendors"
 )
 
-const mplsLabels = 100_000
+const (
+	mplsLabels = 100_000
+	// Node indices are used as the host part of addresses, 254 being the gateway.
+	maxNodeIndex = 253
+	// LabLabel marks Docker objects with the name of the topology owning them.
+	LabLabel = "golab.lab"
+	// Links without an explicit name are named after their position, e.g. golab-link-01.
+	linkNamePrefix = "golab-link-"
+	// Management network lies outside of the 10.[1-253].[1-253].0/24 range of index-based links,
+	// while other allocators are kept out of it.
+	mgmtLinkName   = "golab-mgmt"
+	mgmtIPv4Subnet = "10.255.254.0/23"
+	ifnameOption   = "com.docker.network.endpoint.ifname"
+	// Services are addressed after the first /24 of the management subnet, e.g. 10.255.255.1/23.
+	syslogName         = "golab-syslog"
+	syslogOffset       = 257
+	defaultSyslogImage = "balabit/syslog-ng:latest"
+	// frrStartScript is the default command of FRR images, which starts the daemons enabled in /etc/frr/daemons.
+	frrStartScript = "/usr/lib/frr/docker-start"
+	// SSH sidecars share the network namespace of their nodes.
+	defaultSSHImage     = "lscr.io/linuxserver/openssh-server:latest"
+	defaultSSHUser      = "golab"
+	defaultSSHPublicKey = "~/.ssh/id_ed25519.pub"
+	defaultSSHPort      = 2222
+	// NETCONF over SSH is the only supported config push protocol.
+	defaultPushProtocol = "netconf"
+	defaultPushPort     = 830
+	// VXLAN tunnels are set up with iproute2 and use the IANA-assigned port.
+	defaultVXLANImage = "nicolaka/netshoot:latest"
+	defaultVXLANPort  = 4789
+	// RPKI-to-Router caches, e.g. Routinator or StayRTR, listen on the IANA-assigned port.
+	defaultRPKIPort = 3323
+	// Interfaces of OSPF speakers without an explicit area join the backbone.
+	defaultOSPFArea = "0"
+	// IS-IS speakers form a single level-2 domain in a private area unless told otherwise.
+	defaultISISArea  = "49.0001"
+	defaultISISLevel = ISISLevel2
+)
 
 func (t *Topology) populate() error {
 	if t.IPMode == Unknown {
 		t.IPMode = Dual
 	}
-	for name, node := range t.Nodes {
-		if err := node.populate(name, t.ConfigMode, t.IPMode); err != nil {
+	if err := t.populateSecrets(); err != nil {
+		return err
+	}
+	addrs, err := t.newAddressing()
+	if err != nil {
+		return err
+	}
+	// nodes are populated in a stable order, since allocators may depend on it
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		if err := t.Nodes[name].populate(name, t.ConfigMode, t.IPMode, addrs.alloc); err != nil {
+			return err
+		}
+		// the vendor of a node restored from a snapshot is the one of its own image
+		if t.Snapshot != "" {
+			t.Nodes[name].Image = SnapshotImage(t.Name, name, t.Snapshot)
+		}
+	}
+	if err := t.populateASNs(); err != nil {
+		return err
+	}
+	// eth0 is taken by the management interface when the mgmt section is present
+	firstIface := 0
+	if t.Management != nil {
+		firstIface = 1
+	}
+	for _, link := range t.Links {
+		if err := link.populate(t.Nodes, t.IPMode, addrs); err != nil {
+			return err
+		}
+	}
+	for _, node := range t.Nodes {
+		// containers of VMs forward eth0 to the management interface of the VM, hence it has to be attached
+		vendorFirst := vendors.GetConfig(node.Vendor).FirstInterface
+		if vendorFirst > firstIface && t.Management == nil {
+			return fmt.Errorf("node %q of kind %q is managed over eth0, which requires the mgmt section", node.Name, node.Vendor)
+		}
+		if err := node.populateInterfaces(max(firstIface, vendorFirst)); err != nil {
+			return err
+		}
+	}
+	if err := t.checkTrunks(); err != nil {
+		return err
+	}
+	if err := t.checkSubnets(); err != nil {
+		return err
+	}
+	if err := t.populateOSPF(); err != nil {
+		return err
+	}
+	if err := t.populateISIS(); err != nil {
+		return err
+	}
+	for _, link := range t.Links {
+		if err := link.populateBGPNeighbors(t.Nodes); err != nil {
+			return err
+		}
+	}
+	if err := t.populateIBGP(); err != nil {
+		return err
+	}
+	for _, node := range t.Nodes {
+		if err := node.populateGateway(t.Nodes); err != nil {
 			return err
 		}
 	}
+	if t.Management != nil {
+		t.populateMgmt()
+	}
+	if t.Syslog != nil {
+		t.populateMgmt()
+		t.populateSyslog()
+	}
+	if t.DNS != nil {
+		t.populateMgmt()
+		t.populateDNS()
+	}
+	if t.SSH != nil {
+		t.populateMgmt()
+		if err := t.populateSSH(); err != nil {
+			return err
+		}
+	}
+	if t.ConfigMode == Push {
+		t.populateMgmt()
+		if t.Push.Protocol == "" {
+			t.Push.Protocol = defaultPushProtocol
+		}
+		if t.Push.Port == 0 {
+			t.Push.Port = defaultPushPort
+		}
+	}
+	if err := t.populateHosts(); err != nil {
+		return err
+	}
+	t.populateLabels()
+	return nil
+}
+
+// populateASNs assigns sequential ASNs, starting from asn_start_from, to BGP speakers
+// without an explicit one in the order of their indices. ASNs in use are skipped.
+func (t *Topology) populateASNs() error {
+	if t.ASNStartFrom == 0 {
+		return nil
+	}
+	used := make(map[uint32]bool)
+	var pending []*Node
+	for _, node := range t.Nodes {
+		if node.ASN != nil {
+			used[*node.ASN] = true
+			continue
+		}
+		if node.Protocols["bgp"] {
+			pending = append(pending, node)
+		}
+	}
+	slices.SortFunc(pending, func(a, b *Node) int { return a.Index - b.Index })
+	last := privateASNRangeEnd(t.ASNStartFrom)
+	asn := t.ASNStartFrom
+	for _, node := range pending {
+		for used[asn] {
+			asn++
+		}
+		if asn > last {
+			return fmt.Errorf("asn_start_from %d runs out of private ASNs at node %q", t.ASNStartFrom, node.Name)
+		}
+		node.ASN = new(uint32)
+		*node.ASN = asn
+		used[asn] = true
+		asn++
+	}
+	return nil
+}
+
+// privateASNRangeEnd returns the last ASN of the private range containing the ASN, or zero if there is none.
+func privateASNRangeEnd(asn uint32) uint32 {
+	switch {
+	case asn >= 64512 && asn <= 65534:
+		return 65534
+	case asn >= 4200000000 && asn <= 4294967294:
+		return 4294967294
+	}
+	return 0
+}
+
+// populateLabels marks all objects of the topology as owned by it, so that
+// leftovers can be found even after the topology file has changed. User-defined
+// labels of the topology apply to all objects, while those of nodes and links
+// take precedence and apply to sidecars of the nodes as well.
+func (t *Topology) populateLabels() {
+	for _, node := range t.Nodes {
+		node.Labels = t.labels(node.Labels)
+		for _, sidecar := range node.Sidecars {
+			sidecar.Labels = maps.Clone(node.Labels)
+		}
+	}
+	for _, service := range t.Services {
+		service.Labels = t.labels(nil)
+	}
+	for _, link := range t.Links {
+		link.Labels = t.labels(link.Labels)
+	}
+	if t.Mgmt != nil {
+		t.Mgmt.Labels = t.labels(nil)
+	}
+}
+
+// labels merges the topology labels with the ones of an object and the ownership label.
+func (t *Topology) labels(own map[string]string) map[string]string {
+	return mergeMaps(mergeMaps(t.Labels, own), map[string]string{LabLabel: t.Name})
+}
+
+// populateMgmt attaches every node to a management network. Lab services get an internal
+// one, while the mgmt section makes it reachable from the host and attaches it to eth0.
+func (t *Topology) populateMgmt() {
+	if t.Mgmt != nil {
+		return
+	}
+	subnet := t.mgmtSubnet()
+	t.Mgmt = &Link{
+		Name:       mgmtLinkName,
+		IPv4Subnet: subnet,
+		External:   t.Management != nil,
+	}
+	t.Mgmt.IPv4Gateway, _, _ = strings.Cut(mgmtHost(subnet, 254), "/")
+	for name, node := range t.Nodes {
+		t.Mgmt.Endpoints = append(t.Mgmt.Endpoints, name)
+		node.Mgmt = t.newMgmtInterface(node.Index)
+	}
+	slices.Sort(t.Mgmt.Endpoints)
+}
+
+// mgmtSubnet returns the IPv4 subnet of the management network, which the mgmt section may override.
+func (t *Topology) mgmtSubnet() string {
+	if t.Management != nil && t.Management.IPv4Subnet != "" {
+		return t.Management.IPv4Subnet
+	}
+	return mgmtIPv4Subnet
+}
+
+// newMgmtInterface returns an interface on the management network with the address at the offset.
+func (t *Topology) newMgmtInterface(offset int) *Interface {
+	name := "mgmt0"
+	if t.Management != nil {
+		name = "eth0"
+	}
+	return &Interface{
+		Name:       name,
+		Link:       mgmtLinkName,
+		IPv4Addr:   mgmtHost(t.Mgmt.IPv4Subnet, offset),
+		DriverOpts: map[string]string{ifnameOption: name},
+	}
+}
+
+// mgmtHost returns the address at the offset from the start of the management subnet in CIDR notation.
+// Unlike ipam allocators, it handles subnets spanning multiple /24s.
+func mgmtHost(subnet string, offset int) string {
+	prefix := netip.MustParsePrefix(subnet).Masked()
+	addr := prefix.Addr().As4()
+	binary.BigEndian.PutUint32(addr[:], binary.BigEndian.Uint32(addr[:])+uint32(offset))
+	return netip.PrefixFrom(netip.AddrFrom4(addr), prefix.Bits()).String()
+}
+
+// populateDNS registers node names, both plain and fully qualified, on the management network.
+// Docker's embedded DNS server then resolves them from within every node, although containers
+// are named after the lab.
+func (t *Topology) populateDNS() {
+	if t.DNS.Domain == "" {
+		t.DNS.Domain = t.Name
+	}
+	for name, node := range t.Nodes {
+		node.DNSDomain = t.DNS.Domain
+		node.Mgmt.Aliases = []string{name, name + "." + t.DNS.Domain}
+	}
+}
+
+// populateSSH adds an SSH server sidecar to every node and injects the user's public key.
+func (t *Topology) populateSSH() error {
+	if t.SSH.Image == "" {
+		t.SSH.Image = defaultSSHImage
+	}
+	if t.SSH.User == "" {
+		t.SSH.User = defaultSSHUser
+	}
+	if t.SSH.PublicKey == "" {
+		t.SSH.PublicKey = defaultSSHPublicKey
+	}
+	if t.SSH.Port == 0 {
+		t.SSH.Port = defaultSSHPort
+	}
+	keyPath := t.SSH.PublicKey
+	if after, found := strings.CutPrefix(keyPath, "~/"); found {
+		keyPath = filepath.Join(os.Getenv("HOME"), after)
+	}
+	publicKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH public key: %w", err)
+	}
+	for name, node := range t.Nodes {
+		node.Sidecars = append(node.Sidecars, &Node{
+			Name:  name + "-ssh",
+			Image: t.SSH.Image,
+			Env: map[string]string{
+				"PUBLIC_KEY":  strings.TrimSpace(string(publicKey)),
+				"USER_NAME":   t.SSH.User,
+				"SUDO_ACCESS": "true",
+				"LISTEN_PORT": strconv.Itoa(t.SSH.Port),
+			},
+			NetworkMode: "container:" + name,
+			PIDMode:     "container:" + name,
+		})
+	}
+	return nil
+}
+
+// populateSyslog adds a syslog collector service and points every node at it.
+// Collected logs are kept in the syslog directory of the lab.
+func (t *Topology) populateSyslog() {
+	if t.Syslog.Image == "" {
+		t.Syslog.Image = defaultSyslogImage
+	}
+	t.Services = append(t.Services, &Node{
+		Name:  syslogName,
+		Image: t.Syslog.Image,
+		Binds: []string{fmt.Sprintf("%s/syslog:/var/log", os.Getenv("PWD"))},
+		Mgmt:  t.newMgmtInterface(syslogOffset),
+	})
+	syslogServer, _, _ := strings.Cut(mgmtHost(t.Mgmt.IPv4Subnet, syslogOffset), "/")
+	for _, node := range t.Nodes {
+		node.SyslogServer = syslogServer
+		// FRR logs to the local syslog, which is forwarded to the collector by a syslogd started ahead of FRR
+		if node.Vendor == vendors.FRR && node.Cmd == nil && node.Entrypoint == nil {
+			node.Cmd = []string{"/bin/sh", "-c", fmt.Sprintf("syslogd -R %s:514 && exec %s", syslogServer, frrStartScript)}
+		}
+	}
+}
+
+// populateHosts places nodes without a host on the host with the fewest nodes, in the order of their names,
+// along with their sidecars, and lab services on the first host. Links between nodes on different hosts get
+// tunnels identified by a VNI hashed from the names of the lab and the link, or the next free one if another
+// link of the lab hashes to the same VNI, while every host has a management network of its own.
+func (t *Topology) populateHosts() error {
+	if len(t.Hosts) == 0 {
+		return nil
+	}
+	if t.VXLAN == nil {
+		t.VXLAN = new(VXLAN)
+	}
+	if t.VXLAN.Image == "" {
+		t.VXLAN.Image = defaultVXLANImage
+	}
+	if t.VXLAN.Port == 0 {
+		t.VXLAN.Port = defaultVXLANPort
+	}
+	hostNames := slices.Sorted(maps.Keys(t.Hosts))
+	load := make(map[string]int, len(hostNames))
+	for _, node := range t.Nodes {
+		load[node.Host]++
+	}
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if node.Host == "" {
+			node.Host = slices.MinFunc(hostNames, func(a, b string) int { return load[a] - load[b] })
+			load[node.Host]++
+		}
+		for _, sidecar := range node.Sidecars {
+			sidecar.Host = node.Host
+		}
+	}
+	for _, service := range t.Services {
+		service.Host = hostNames[0]
+	}
+	links := t.Links
+	if t.Mgmt != nil {
+		links = append(slices.Clip(links), t.Mgmt)
+	}
+	vnis := make(map[int]bool)
+	for _, link := range links {
+		for _, endpoint := range link.Endpoints {
+			if node := t.Nodes[endpoint]; node != nil && !slices.Contains(link.Hosts, node.Host) {
+				link.Hosts = append(link.Hosts, node.Host)
+			}
+		}
+		slices.Sort(link.Hosts)
+		// VLAN links are stitched along with their trunks
+		if len(link.Hosts) < 2 || link == t.Mgmt || link.Tagged() {
+			continue
+		}
+		if link.Veth() {
+			return fmt.Errorf("veth link %v connects nodes on different hosts %v", link.Endpoints, link.Hosts)
+		}
+		if link.HostInterface != "" {
+			return fmt.Errorf("link %v bridged to host interface %s connects nodes on different hosts %v", link.Endpoints, link.HostInterface, link.Hosts)
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(t.Name + "/" + link.Name))
+		// VNIs are 24-bit, 0 being reserved
+		vni := max(int(hash.Sum32()&0xffffff), 1)
+		// tunnels sharing a VNI would share a VXLAN interface, bridging both links into one segment
+		for vnis[vni] {
+			vni = vni%0xffffff + 1
+		}
+		vnis[vni] = true
+		link.Tunnel = &Tunnel{
+			VNI:   vni,
+			Port:  t.VXLAN.Port,
+			Image: t.VXLAN.Image,
+		}
+	}
+	return nil
+}
+
+// populateEndpoints splits endpoints given as NODE:INTERFACE into the node name
+// and the interface, so that the rest of the topology deals with node names only.
+// The host:INTERFACE endpoint is not a node and is removed from the endpoints.
+func (t *Topology) populateEndpoints() {
+	for _, link := range t.Links {
+		if link == nil {
+			continue
+		}
+		endpoints := link.Endpoints[:0]
+		var ifaces []string
+		pinned := false
+		for _, ep := range link.Endpoints {
+			name, iface, found := strings.Cut(ep, ":")
+			if name == HostEndpoint && found {
+				link.HostInterface = iface
+				link.External = true
+				continue
+			}
+			endpoints = append(endpoints, name)
+			ifaces = append(ifaces, iface)
+			pinned = pinned || found
+		}
+		link.Endpoints = endpoints
+		if pinned {
+			link.Interfaces = ifaces
+		}
+	}
+}
+
+// nameLinks names links without an explicit name after their position, e.g. golab-link-01. Explicit names
+// are used for Docker networks, hence they follow the rules of lab names, and may not take the golab- prefix
+// of the objects golab creates on its own.
+func (t *Topology) nameLinks() error {
+	named := make(map[string][]string)
 	for i, link := range t.Links {
-		if err := link.populate(i, t.Nodes, t.IPMode); err != nil {
+		if link == nil {
+			continue
+		}
+		if link.Name == "" {
+			link.Name = fmt.Sprintf("%s%0.2d", linkNamePrefix, i+1)
+			continue
+		}
+		if !labNamePattern.MatchString(link.Name) || strings.HasPrefix(link.Name, "golab-") {
+			return fmt.Errorf("link %v has invalid name %q", link.Endpoints, link.Name)
+		}
+		if other, ok := named[link.Name]; ok {
+			return fmt.Errorf("links %v and %v share name %q", other, link.Endpoints, link.Name)
+		}
+		named[link.Name] = link.Endpoints
+	}
+	return nil
+}
+
+// removeDisabled drops disabled nodes and links from the topology, so that they are not built.
+// The remaining links and dependencies may not refer to disabled nodes. Links are named beforehand, hence
+// disabling a link does not rename the ones following it.
+func (t *Topology) removeDisabled() error {
+	disabled := func(name string) bool {
+		node := t.Nodes[name]
+		return node != nil && node.Disabled
+	}
+	var links []*Link
+	for _, link := range t.Links {
+		if link == nil {
+			links = append(links, link)
+			continue
+		}
+		if link.Disabled {
+			continue
+		}
+		for _, ep := range link.Endpoints {
+			if disabled(ep) {
+				return fmt.Errorf("link %v is attached to disabled node %q", link.Endpoints, ep)
+			}
+		}
+		links = append(links, link)
+	}
+	t.Links = links
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if node == nil || node.Disabled {
+			continue
+		}
+		for _, dep := range node.DependsOn {
+			if disabled(dep) {
+				return fmt.Errorf("node %q depends on disabled node %q", name, dep)
+			}
+		}
+	}
+	maps.DeleteFunc(t.Nodes, func(name string, _ *Node) bool { return disabled(name) })
+	return nil
+}
+
+// groupNamePattern restricts group names, so that replica names cannot clash with R<index> nodes.
+var groupNamePattern = regexp.MustCompile(`^[a-z][a-z-]*$`)
+
+// populateGroups stamps out replicas of every group into the topology nodes, allocating each of them
+// a unique index used for addressing. Groups without an explicit index are placed after the highest
+// index in use, in the order of their names. Link endpoints referencing a group are expanded as well.
+func (t *Topology) populateGroups() error {
+	if len(t.Groups) == 0 {
+		return nil
+	}
+	used := make(map[int]string)
+	for name := range t.Nodes {
+		if isValidNodeName(name) {
+			used[getIndex(name)] = name
+		}
+	}
+	nextIndex := 1
+	for index := range used {
+		nextIndex = max(nextIndex, index+1)
+	}
+	groupNames := slices.Sorted(maps.Keys(t.Groups))
+	for _, groupName := range groupNames {
+		group := t.Groups[groupName]
+		if group != nil && group.Index != 0 {
+			nextIndex = max(nextIndex, group.Index+group.Count)
+		}
+	}
+	if t.Nodes == nil {
+		t.Nodes = make(map[string]*Node)
+	}
+	replicas := make(map[string][]string, len(t.Groups))
+	for _, groupName := range groupNames {
+		group := t.Groups[groupName]
+		if err := group.validate(groupName); err != nil {
 			return err
 		}
+		first := group.Index
+		if first == 0 {
+			first = nextIndex
+			nextIndex += group.Count
+		}
+		if last := first + group.Count - 1; last > maxNodeIndex {
+			return fmt.Errorf("group %q index range %d-%d exceeds %d", groupName, first, last, maxNodeIndex)
+		}
+		for i, name := range replicaNames(groupName, group.Count) {
+			index := first + i
+			if other, ok := used[index]; ok {
+				return fmt.Errorf("replica %q of group %q has the same index %d as node %q", name, groupName, index, other)
+			}
+			if _, ok := t.Nodes[name]; ok {
+				return fmt.Errorf("replica %q of group %q clashes with a node of the same name", name, groupName)
+			}
+			used[index] = name
+			replica := group.Node.clone()
+			replica.Index = index
+			if replica.ASN != nil {
+				asn := *replica.ASN + uint32(i)*group.ASNStep
+				replica.ASN = &asn
+			}
+			t.Nodes[name] = replica
+		}
+		replicas[groupName] = replicaNames(groupName, group.Count)
+	}
+	return t.expandGroupLinks(replicas)
+}
+
+// validate checks that the group can be stamped out.
+func (g *Group) validate(name string) error {
+	if !groupNamePattern.MatchString(name) {
+		return fmt.Errorf("group name %q has to consist of lowercase letters and dashes", name)
+	}
+	if g == nil || g.Node == nil {
+		return fmt.Errorf("group %q does not have a node definition", name)
+	}
+	if g.Count < 1 {
+		return fmt.Errorf("group %q has invalid count %d", name, g.Count)
+	}
+	if g.Index < 0 {
+		return fmt.Errorf("group %q has invalid index %d", name, g.Index)
+	}
+	// settings unique to a node cannot be shared by replicas
+	if len(g.Node.IPv4Loopbacks) != 0 || len(g.Node.IPv6Loopbacks) != 0 || len(g.Node.Ports) != 0 {
+		return fmt.Errorf("group %q cannot set loopbacks or ports shared by all replicas", name)
+	}
+	return nil
+}
+
+// replicaNames returns names of replicas of the group, e.g. leaf1..leaf4.
+func replicaNames(groupName string, count int) []string {
+	names := make([]string, 0, max(count, 0))
+	for i := 1; i <= count; i++ {
+		names = append(names, groupName+strconv.Itoa(i))
+	}
+	return names
+}
+
+// expandGroupLinks replaces links with groups among their endpoints. A point-to-point link becomes
+// a link between every pair of replicas, e.g. [spine, leaf] is a full mesh, while a multi-access
+// link attaches all replicas of the group.
+func (t *Topology) expandGroupLinks(replicas map[string][]string) error {
+	var expanded []*Link
+	for _, link := range t.Links {
+		if link == nil || !slices.ContainsFunc(link.Endpoints, func(ep string) bool { return replicas[ep] != nil }) {
+			expanded = append(expanded, link)
+			continue
+		}
+		for i, ep := range link.Endpoints {
+			if link.pinned(i) != "" && replicas[ep] != nil {
+				return fmt.Errorf("link %v cannot pin interfaces of group %q", link.Endpoints, ep)
+			}
+		}
+		if len(link.Endpoints) != 2 {
+			var endpoints, ifaces []string
+			for i, ep := range link.Endpoints {
+				if names, ok := replicas[ep]; ok {
+					endpoints = append(endpoints, names...)
+					ifaces = append(ifaces, make([]string, len(names))...)
+					continue
+				}
+				endpoints = append(endpoints, ep)
+				ifaces = append(ifaces, link.pinned(i))
+			}
+			link.Endpoints = endpoints
+			if link.Interfaces != nil {
+				link.Interfaces = ifaces
+			}
+			expanded = append(expanded, link)
+			continue
+		}
+		sides := make([][]string, 2)
+		for i, ep := range link.Endpoints {
+			sides[i] = []string{ep}
+			if names, ok := replicas[ep]; ok {
+				sides[i] = names
+			}
+		}
+		if len(sides[0])*len(sides[1]) > 1 && (link.IPv4Subnet != "" || link.IPv6Subnet != "") {
+			return fmt.Errorf("link %v expanded into multiple links cannot set subnets", link.Endpoints)
+		}
+		for _, a := range sides[0] {
+			for _, b := range sides[1] {
+				pair := *link
+				pair.Endpoints = []string{a, b}
+				expanded = append(expanded, &pair)
+			}
+		}
+	}
+	t.Links = expanded
+	return nil
+}
+
+// clone returns a deep copy of the node definition, so that replicas can be populated independently.
+func (n *Node) clone() *Node {
+	c := *n
+	c.Binds = slices.Clone(n.Binds)
+	c.Volumes = slices.Clone(n.Volumes)
+	c.Tmpfs = slices.Clone(n.Tmpfs)
+	c.Protocols = maps.Clone(n.Protocols)
+	c.Sysctls = maps.Clone(n.Sysctls)
+	c.Env = maps.Clone(n.Env)
+	c.Cmd = slices.Clone(n.Cmd)
+	c.Entrypoint = slices.Clone(n.Entrypoint)
+	c.DependsOn = slices.Clone(n.DependsOn)
+	c.ReadyCommand = slices.Clone(n.ReadyCommand)
+	c.CapAdd = slices.Clone(n.CapAdd)
+	c.CapDrop = slices.Clone(n.CapDrop)
+	c.Capabilities = slices.Clone(n.Capabilities)
+	c.Devices = slices.Clone(n.Devices)
+	c.Labels = maps.Clone(n.Labels)
+	if n.Position != nil {
+		position := *n.Position
+		c.Position = &position
+	}
+	if n.RPKI != nil {
+		rpki := *n.RPKI
+		c.RPKI = &rpki
+	}
+	if n.ISIS != nil {
+		isis := NodeISIS{Area: n.ISIS.Area, NET: n.ISIS.NET, Level: n.ISIS.Level, Interfaces: make(map[string]*ISIS, len(n.ISIS.Interfaces))}
+		for name, settings := range n.ISIS.Interfaces {
+			if settings != nil {
+				iface := *settings
+				settings = &iface
+			}
+			isis.Interfaces[name] = settings
+		}
+		c.ISIS = &isis
+	}
+	if n.OSPF != nil {
+		ospf := NodeOSPF{Area: n.OSPF.Area, Interfaces: make(map[string]*OSPF, len(n.OSPF.Interfaces))}
+		for name, settings := range n.OSPF.Interfaces {
+			if settings != nil {
+				iface := *settings
+				settings = &iface
+			}
+			ospf.Interfaces[name] = settings
+		}
+		c.OSPF = &ospf
+	}
+	return &c
+}
+
+// populateProfiles merges the referenced profiles and then the topology defaults into nodes before they are validated.
+// Node settings take precedence: the image, kind, resource limits, cmd and entrypoint override the profile ones, binds are appended
+// to the profile ones, while protocols, sysctls and env are merged key by key. Profiles take precedence over defaults alike.
+func (t *Topology) populateProfiles() error {
+	for name, node := range t.Nodes {
+		// nodes declared without settings rely on the defaults entirely
+		if node == nil && t.Defaults != nil {
+			node = new(Node)
+			t.Nodes[name] = node
+		}
+		if node == nil {
+			continue
+		}
+		if node.Profile != "" {
+			profile, ok := t.Profiles[node.Profile]
+			if !ok || profile == nil {
+				return fmt.Errorf("node %q references undefined profile %q", name, node.Profile)
+			}
+			node.applyProfile(profile)
+		}
+		if t.Defaults != nil {
+			node.applyProfile(t.Defaults)
+		}
+	}
+	return nil
+}
+
+func (n *Node) applyProfile(p *Profile) {
+	if n.Image == "" {
+		n.Image = p.Image
+	}
+	if n.Kind == "" {
+		n.Kind = p.Kind
+	}
+	if n.CPUs == 0 {
+		n.CPUs = p.CPUs
+	}
+	if n.Memory == "" {
+		n.Memory = p.Memory
+	}
+	if n.Cmd == nil {
+		n.Cmd = slices.Clone(p.Cmd)
+	}
+	if n.Entrypoint == nil {
+		n.Entrypoint = slices.Clone(p.Entrypoint)
+	}
+	binds := slices.Clone(p.Binds)
+	for _, bind := range n.Binds {
+		if !slices.Contains(binds, bind) {
+			binds = append(binds, bind)
+		}
+	}
+	n.Binds = binds
+	n.Protocols = mergeMaps(p.Protocols, n.Protocols)
+	n.Sysctls = mergeMaps(p.Sysctls, n.Sysctls)
+	n.Env = mergeMaps(p.Env, n.Env)
+}
+
+// mergeMaps returns a union of both maps with values of the override map taking precedence.
+func mergeMaps[V any](base, override map[string]V) map[string]V {
+	if base == nil && override == nil {
+		return nil
+	}
+	merged := maps.Clone(base)
+	if merged == nil {
+		merged = make(map[string]V, len(override))
+	}
+	maps.Copy(merged, override)
+	return merged
+}
+
+// populateSecrets resolves secret references into their actual values.
+// A reference is either "env:VARIABLE", "file:path" or a plain literal value.
+func (t *Topology) populateSecrets() error {
+	t.secrets = make(map[string]string, len(t.Secrets))
+	for name, ref := range t.Secrets {
+		value, err := resolveSecret(ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve secret %q: %w", name, err)
+		}
+		t.secrets[name] = value
 	}
 	return nil
 }
 
+func resolveSecret(ref string) (string, error) {
+	if varName, found := strings.CutPrefix(ref, "env:"); found {
+		value, ok := os.LookupEnv(varName)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", varName)
+		}
+		return value, nil
+	}
+	if path, found := strings.CutPrefix(ref, "file:"); found {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return ref, nil
+}
+
 // populateBinds adds vendor-specific bind mounts.
 func (n *Node) populateBinds(configMode ConfigMode, vendorConfig vendors.Config) {
 	n.Binds = append(n.Binds, vendorConfig.ExtraBinds...)
-	if configMode == None {
+	// generic images, e.g. hosts, have no configuration to mount
+	if configMode == None || configMode == Push || vendorConfig.ConfigPath == "" {
 		return
 	}
 	configBind := fmt.Sprintf("%s/%s:%s", os.Getenv("PWD"), n.Name, vendorConfig.ConfigPath)
@@ -39,96 +842,687 @@ func (n *Node) populateBinds(configMode ConfigMode, vendorConfig vendors.Config)
 }
 
 // populate autofills missing fields in a Node struct.
-func (n *Node) populate(name string, configMode ConfigMode, ipMode IPMode) error {
+func (n *Node) populate(name string, configMode ConfigMode, ipMode IPMode, alloc ipam.Allocator) error {
 	n.Name = name
-	n.Vendor = vendors.DetectByImage(n.Image)
-	if len(n.IPv4Loopbacks) == 0 && ipMode != IPv6 {
-		n.IPv4Loopbacks = []string{calcLoopback(name, 4)}
+	// replicas of groups are assigned their index when the group is expanded
+	if n.Index == 0 {
+		n.Index = getIndex(name)
+	}
+	// an explicit kind saves images renamed in private registries from being misclassified
+	n.Vendor = n.Kind
+	if n.Vendor == vendors.UNKNOWN {
+		n.Vendor = vendors.DetectByImage(n.Image)
+	}
+	if len(n.IPv4Loopbacks) == 0 {
+		loopback, err := alloc.Loopback(ipam.Node{Name: name, Index: n.Index}, 4)
+		if err != nil {
+			return fmt.Errorf("failed to allocate loopback of node %q: %w", name, err)
+		}
+		// routing protocols identify routers by a 32-bit ID even without IPv4 addressing
+		n.RouterID, _, _ = strings.Cut(loopback, "/")
+		if ipMode != IPv6 {
+			n.IPv4Loopbacks = []string{loopback}
+		}
 	}
 	if len(n.IPv6Loopbacks) == 0 && ipMode != IPv4 {
-		n.IPv6Loopbacks = []string{calcLoopback(name, 6)}
+		loopback, err := alloc.Loopback(ipam.Node{Name: name, Index: n.Index}, 6)
+		if err != nil {
+			return fmt.Errorf("failed to allocate loopback of node %q: %w", name, err)
+		}
+		n.IPv6Loopbacks = []string{loopback}
+	}
+	if len(n.IPv4Loopbacks) != 0 {
+		n.RouterID, _, _ = strings.Cut(n.IPv4Loopbacks[0], "/")
 	}
 	if n.Vendor == vendors.FRR && n.Protocols["ldp"] {
-		n.Sysctls = map[string]string{
+		n.Sysctls = mergeMaps(n.Sysctls, map[string]string{
 			"net.mpls.platform_labels": strconv.Itoa(mplsLabels),
 			"net.mpls.conf.lo.input":   "1",
+		})
+	}
+	if (n.RouteServer || n.RPKI != nil) && n.Vendor != vendors.BIRD && n.Vendor != vendors.GOBGP {
+		return fmt.Errorf("node %q sets route_server or rpki, which are supported by vendors %q and %q only", name, vendors.BIRD, vendors.GOBGP)
+	}
+	if n.RouteReflector && n.Vendor != vendors.FRR {
+		return fmt.Errorf("node %q sets route_reflector, which is supported by vendor %q only", name, vendors.FRR)
+	}
+	if n.RPKI != nil && n.RPKI.Port == 0 {
+		n.RPKI.Port = defaultRPKIPort
+	}
+	// plain Linux nodes route between their links, e.g. with routes set in cmd, unless the node says otherwise
+	if n.Vendor == vendors.LINUX {
+		forwarding := make(map[string]string)
+		if ipMode != IPv6 {
+			forwarding["net.ipv4.ip_forward"] = "1"
+		}
+		if ipMode != IPv4 {
+			forwarding["net.ipv6.conf.all.forwarding"] = "1"
 		}
+		n.Sysctls = mergeMaps(forwarding, n.Sysctls)
 	}
 	vendorConfig := vendors.GetConfig(n.Vendor)
+	if n.Cmd == nil && n.Entrypoint == nil {
+		n.Cmd = slices.Clone(vendorConfig.Cmd)
+	}
+	if n.ReadyCommand == nil {
+		n.ReadyCommand = slices.Clone(vendorConfig.ReadyCommand)
+	}
+	if n.ReadyTimeout == "" {
+		n.ReadyTimeout = vendorConfig.ReadyTimeout
+	}
+	n.Devices = slices.Clone(vendorConfig.Devices)
 	n.populateBinds(configMode, vendorConfig)
+	if !n.Privileged {
+		n.Capabilities = capabilities(vendorConfig.Capabilities, n.CapAdd, n.CapDrop)
+	}
 	return nil
 }
 
-func calcLoopback(name string, ipVersion int) string {
-	index, _ := strconv.Atoi(strings.TrimLeft(name, "R"))
-	var loopback string
-	switch ipVersion {
-	case 4:
-		loopback = fmt.Sprintf("192.168.0.%d/32", index)
-	case 6:
-		loopback = fmt.Sprintf("2001:db8::%d/128", index)
+// capabilities drops and then adds capabilities to the ones required by the vendor, so that added
+// capabilities survive dropping ALL, as they do in Docker.
+func capabilities(vendor, add, drop []string) []string {
+	caps := slices.DeleteFunc(slices.Clone(vendor), func(c string) bool {
+		return slices.Contains(drop, c) || slices.Contains(drop, "ALL")
+	})
+	for _, c := range add {
+		if !slices.Contains(caps, c) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// addressing allocates link subnets from the link pool, if any, and with the allocator of the ipam strategy otherwise.
+// Unless the strategy is sequential, subnets are carved from the link pool by link keys, so that adding or removing
+// a link does not move the subnets of the others.
+type addressing struct {
+	alloc ipam.Allocator
+	pool  *ipam.Pool
+	keyed bool
+}
+
+// newAddressing sets up the allocation of addresses outside of the excluded ranges and the management subnet,
+// which is only populated once links are, keeping the link pool clear of the subnets declared explicitly as well.
+// Strategies which skip to the next free value steer clear of explicit loopbacks and subnets too, while the index
+// one leaves such overlaps to checkSubnets.
+func (t *Topology) newAddressing() (*addressing, error) {
+	reserved := append(slices.Clone(t.IPExclude), t.mgmtSubnet())
+	if t.IPAM == ipam.Sequential || t.IPAM == ipam.Hash {
+		for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+			reserved = append(reserved, t.Nodes[name].IPv4Loopbacks...)
+			reserved = append(reserved, t.Nodes[name].IPv6Loopbacks...)
+		}
+		for _, link := range t.Links {
+			for _, subnet := range []string{link.IPv4Subnet, link.IPv6Subnet} {
+				if subnet != "" {
+					reserved = append(reserved, subnet)
+				}
+			}
+		}
 	}
-	return loopback
+	alloc, err := ipam.Exclude(ipam.New(t.IPAM), reserved)
+	if err != nil {
+		return nil, err
+	}
+	addrs := &addressing{alloc: alloc, keyed: t.IPAM != ipam.Sequential}
+	if t.LinkPool == "" {
+		return addrs, nil
+	}
+	used := append(slices.Clone(t.IPExclude), t.mgmtSubnet())
+	for _, link := range t.Links {
+		used = append(used, link.IPv4Subnet, link.IPv6Subnet)
+	}
+	pool, err := ipam.NewPool(t.LinkPool, t.LinkPrefixLen, used)
+	if err != nil {
+		return nil, err
+	}
+	addrs.pool = pool
+	return addrs, nil
 }
 
-func (l *Link) populate(i int, nodes map[string]*Node, ipMode IPMode) error {
-	l.Name = fmt.Sprintf("golab-link-%0.2d", i+1)
-	if l.IPv4Subnet == "" && ipMode != IPv6 {
-		l.IPv4Subnet = calcSubnet(l.Endpoints, 4)
+// subnet allocates the subnet of the IP version for the link.
+func (a *addressing) subnet(link ipam.Link, ipVersion int) (string, error) {
+	if a.pool != nil && a.pool.IPVersion() == ipVersion {
+		var key string
+		if a.keyed {
+			key = link.Key()
+		}
+		return a.pool.Subnet(key)
 	}
-	if l.IPv6Subnet == "" && ipMode != IPv4 {
-		l.IPv6Subnet = calcSubnet(l.Endpoints, 6)
+	return a.alloc.Subnet(link, ipVersion)
+}
+
+// host returns the address of the i-th link endpoint. Subnets of the link pool may be too small
+// for node indices, hence their endpoints are numbered in order.
+func (a *addressing) host(subnet string, i, index int) string {
+	if a.pool.Carved(subnet) {
+		return ipam.Nth(subnet, i+1)
+	}
+	return a.alloc.Host(subnet, index)
+}
+
+// gateway returns the gateway address of the subnet, which is the last usable one in subnets of the link pool.
+func (a *addressing) gateway(subnet string) string {
+	gateway := a.alloc.Host(subnet, 254)
+	if a.pool.Carved(subnet) {
+		gateway = ipam.Nth(subnet, -2)
+	}
+	addr, _, _ := strings.Cut(gateway, "/")
+	return addr
+}
+
+// subnet returns the subnet of the IP version declared for the link.
+func (l *Link) subnet(ipVersion int) string {
+	if ipVersion == 4 {
+		return l.IPv4Subnet
+	}
+	return l.IPv6Subnet
+}
+
+func (l *Link) populate(nodes map[string]*Node, ipMode IPMode, addrs *addressing) error {
+	// links named after their position are identified by their nodes only, since the position is not stable
+	key := ipam.Link{Nodes: make([]ipam.Node, 0, len(l.Endpoints))}
+	if !strings.HasPrefix(l.Name, linkNamePrefix) {
+		key.Name = l.Name
 	}
 	for _, ep := range l.Endpoints {
+		key.Nodes = append(key.Nodes, ipam.Node{Name: ep, Index: nodes[ep].Index})
+	}
+	// subnets of links bridged to the host are given by the physical network
+	calculate := l.IP == "" && l.HostInterface == ""
+	var err error
+	if l.IPv4Subnet == "" && ipMode != IPv6 && calculate {
+		if l.IPv4Subnet, err = addrs.subnet(key, 4); err != nil {
+			return fmt.Errorf("failed to allocate subnet of link %v: %w", l.Endpoints, err)
+		}
+	}
+	if l.IPv6Subnet == "" && ipMode != IPv4 && calculate {
+		if l.IPv6Subnet, err = addrs.subnet(key, 6); err != nil {
+			return fmt.Errorf("failed to allocate subnet of link %v: %w", l.Endpoints, err)
+		}
+	}
+	for i, ep := range l.Endpoints {
 		node := nodes[ep]
-		var driverOpts map[string]string
+		index := node.Index
+		// the second end of a node looped back to itself takes the host part of the gateway, which veth pairs lack
+		if slices.Index(l.Endpoints, ep) < i {
+			index = 254
+		}
+		iface := &Interface{
+			Link:      l.Name,
+			IPv4Addr:  addrs.host(l.IPv4Subnet, i, index),
+			IPv6Addr:  addrs.host(l.IPv6Subnet, i, index),
+			LinkLocal: l.IP == LinkLocal,
+			Veth:      l.Veth(),
+		}
+		// pinned interfaces may use vendor-native names, which are translated to container NICs
+		if name := l.pinned(i); name != "" {
+			parent, vlan, tagged := splitVLAN(name)
+			nic, ok := vendors.GetConfig(node.Vendor).NICName(parent)
+			if !ok {
+				return fmt.Errorf("node %q has unknown interface %q in link %v", ep, parent, l.Endpoints)
+			}
+			iface.Name = nic
+			if tagged {
+				iface.Name = nic + "." + strconv.Itoa(vlan)
+				iface.Parent = nic
+				iface.VLAN = vlan
+				node.Interfaces = append(node.Interfaces, iface)
+				continue
+			}
+		}
+		var sysctls []string
 		if node.Vendor == vendors.FRR && node.Protocols["ldp"] {
-			driverOpts = map[string]string{
-				"com.docker.network.endpoint.sysctls": "net.mpls.conf.IFNAME.input=1",
+			sysctls = append(sysctls, "net.mpls.conf.IFNAME.input=1")
+		}
+		// Docker disables IPv6 on interfaces attached to networks without IPv6 subnets
+		if iface.LinkLocal {
+			sysctls = append(sysctls, "net.ipv6.conf.IFNAME.disable_ipv6=0")
+		}
+		if len(sysctls) != 0 {
+			iface.DriverOpts = map[string]string{
+				"com.docker.network.endpoint.sysctls": strings.Join(sysctls, ","),
 			}
 		}
-		node.Interfaces = append(node.Interfaces, &Interface{
-			Name:       "eth" + strconv.Itoa(len(node.Interfaces)),
-			Link:       l.Name,
-			IPv4Addr:   calcHost(l.IPv4Subnet, getIndex(ep)),
-			IPv6Addr:   calcHost(l.IPv6Subnet, getIndex(ep)),
-			DriverOpts: driverOpts,
-		})
+		iface.DriverOpts = mergeMaps(iface.DriverOpts, l.EndpointOpts[ep])
+		node.Interfaces = append(node.Interfaces, iface)
+	}
+	// veth pairs and VLAN links do not have a bridge to hold the gateway
+	if l.NoGateway || l.Veth() || l.Tagged() {
+		return nil
 	}
-	ipv4Gateway, _, _ := strings.Cut(calcHost(l.IPv4Subnet, 254), "/")
-	ipv6Gateway, _, _ := strings.Cut(calcHost(l.IPv6Subnet, 254), "/")
-	l.IPv4Gateway = ipv4Gateway
-	l.IPv6Gateway = ipv6Gateway
+	l.IPv4Gateway = addrs.gateway(l.IPv4Subnet)
+	l.IPv6Gateway = addrs.gateway(l.IPv6Subnet)
+	return l.populateGateway(nodes)
+}
+
+// populateGateway replaces the automatic gateway with the explicit one, which has to be a free address of the link subnet.
+func (l *Link) populateGateway(nodes map[string]*Node) error {
+	if l.Gateway == "" {
+		return nil
+	}
+	addr := netip.MustParseAddr(l.Gateway)
+	subnet, gateway := l.IPv4Subnet, &l.IPv4Gateway
+	if addr.Is6() {
+		subnet, gateway = l.IPv6Subnet, &l.IPv6Gateway
+	}
+	if prefix, err := netip.ParsePrefix(subnet); err != nil || !prefix.Contains(addr) {
+		return fmt.Errorf("gateway %s of link %v is outside of its subnet %s", l.Gateway, l.Endpoints, subnet)
+	}
+	for _, ep := range l.Endpoints {
+		iface := nodes[ep].interfaceOn(l.Name)
+		for _, ifaceAddr := range []string{iface.IPv4Addr, iface.IPv6Addr} {
+			if prefix, err := netip.ParsePrefix(ifaceAddr); err == nil && prefix.Addr() == addr {
+				return fmt.Errorf("gateway %s of link %v collides with the address of node %q", l.Gateway, l.Endpoints, ep)
+			}
+		}
+	}
+	*gateway = addr.String()
 	return nil
 }
 
-// calcSubnet generates a unique IP subnet based on the endpoints.
-func calcSubnet(endpoints []string, ipVersion int) string {
-	var a, b int
-	if len(endpoints) > 2 {
-		b = getIndex(endpoints[len(endpoints)-1])
-	} else {
-		a, b = getIndex(endpoints[0]), getIndex(endpoints[1])
+// populateBGPNeighbors peers every pair of BGP speakers sharing the link, except for speakers of the same AS
+// which peer over their loopbacks. FRR supports TCP MD5 signatures only, hence authentication is a plain password.
+func (l *Link) populateBGPNeighbors(nodes map[string]*Node) error {
+	password, err := resolveSecret(l.BGPPassword)
+	if err != nil {
+		return fmt.Errorf("failed to resolve BGP password for link %s: %w", l.Name, err)
 	}
-	var subnet string
-	switch ipVersion {
-	case 4:
-		subnet = fmt.Sprintf("10.%d.%d.0/24", a, b)
-	case 6:
-		subnet = fmt.Sprintf("2001:db8:%d:%d::/64", a, b)
+	if strings.ContainsAny(password, " \t\n") {
+		return fmt.Errorf("BGP password for link %s contains whitespace", l.Name)
 	}
-	return subnet
+	for _, local := range l.Endpoints {
+		localNode := nodes[local]
+		if !localNode.Protocols["bgp"] || localNode.ASN == nil {
+			continue
+		}
+		for _, remote := range l.Endpoints {
+			remoteNode := nodes[remote]
+			if remote == local || !remoteNode.Protocols["bgp"] || remoteNode.ASN == nil {
+				continue
+			}
+			if *remoteNode.ASN == *localNode.ASN && localNode.peersOverLoopbacks() && remoteNode.peersOverLoopbacks() {
+				continue
+			}
+			iface := remoteNode.interfaceOn(l.Name)
+			// FRR peers over link-local addresses of point-to-point links by the local interface
+			if iface.LinkLocal && localNode.Vendor == vendors.FRR && len(l.Endpoints) == 2 {
+				localNode.BGPNeighbors = append(localNode.BGPNeighbors, &BGPNeighbor{
+					Interface: localNode.interfaceOn(l.Name).Name,
+					ASN:       *remoteNode.ASN,
+					Password:  password,
+				})
+				continue
+			}
+			for _, addr := range []string{iface.IPv4Addr, iface.IPv6Addr} {
+				if addr == "" {
+					continue
+				}
+				addr, _, _ = strings.Cut(addr, "/")
+				localNode.BGPNeighbors = append(localNode.BGPNeighbors, &BGPNeighbor{
+					Addr:     addr,
+					ASN:      *remoteNode.ASN,
+					Password: password,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// checkTrunks makes sure that the subinterfaces of every VLAN link share the VLAN ID and that their
+// parent interfaces are attached to a single trunk link, which carries the tagged frames between them.
+func (t *Topology) checkTrunks() error {
+	for _, link := range t.Links {
+		if !link.Tagged() {
+			continue
+		}
+		var trunk string
+		var vlan int
+		for _, ep := range link.Endpoints {
+			node := t.Nodes[ep]
+			sub := node.Interfaces[slices.IndexFunc(node.Interfaces, func(iface *Interface) bool { return iface.Link == link.Name })]
+			parent := node.Interfaces[slices.IndexFunc(node.Interfaces, func(iface *Interface) bool { return iface.Name == sub.Parent })]
+			if vlan != 0 && sub.VLAN != vlan {
+				return fmt.Errorf("link %v mixes VLAN IDs %d and %d, which do not reach each other", link.Endpoints, vlan, sub.VLAN)
+			}
+			if trunk != "" && parent.Link != trunk {
+				return fmt.Errorf("link %v has parent interfaces attached to links %s and %s rather than a single trunk", link.Endpoints, trunk, parent.Link)
+			}
+			vlan, trunk = sub.VLAN, parent.Link
+		}
+	}
+	return nil
+}
+
+// populateOSPF resolves the OSPF settings of the interfaces of OSPF speakers: the settings of an interface
+// override the ones of its link, which override the area of the node, the backbone being the default.
+func (t *Topology) populateOSPF() error {
+	links := make(map[string]*Link, len(t.Links))
+	for _, link := range t.Links {
+		links[link.Name] = link
+	}
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if !node.Protocols["ospf"] && !node.Protocols["ospf6"] {
+			continue
+		}
+		// other vendors run OSPF with their defaults in the backbone area
+		if node.Vendor != vendors.FRR {
+			if node.OSPF != nil {
+				return fmt.Errorf("node %q sets ospf, which is supported by vendor %q only", name, vendors.FRR)
+			}
+			for _, iface := range node.Interfaces {
+				if link := links[iface.Link]; link != nil && link.OSPF != nil {
+					return fmt.Errorf("link %v sets ospf, which is supported by vendor %q only, but attaches node %q of vendor %q", link.Endpoints, vendors.FRR, name, node.Vendor)
+				}
+			}
+			continue
+		}
+		if node.OSPF == nil {
+			node.OSPF = &NodeOSPF{}
+		}
+		if node.OSPF.Area == "" {
+			node.OSPF.Area = defaultOSPFArea
+		}
+		overrides := make(map[string]*OSPF, len(node.OSPF.Interfaces))
+		for ifname, settings := range node.OSPF.Interfaces {
+			nic, ok := node.nicOf(ifname)
+			if !ok {
+				return fmt.Errorf("node %q sets ospf of interface %s, which is not attached to any link", name, ifname)
+			}
+			overrides[nic] = settings
+		}
+		for _, iface := range node.Interfaces {
+			resolved := &OSPF{Area: node.OSPF.Area}
+			var link *OSPF
+			if links[iface.Link] != nil {
+				link = links[iface.Link].OSPF
+			}
+			for _, settings := range []*OSPF{link, overrides[iface.Name]} {
+				if settings == nil {
+					continue
+				}
+				resolved.Area = cmp.Or(settings.Area, resolved.Area)
+				if settings.Cost != nil {
+					resolved.Cost = settings.Cost
+				}
+				resolved.Passive = resolved.Passive || settings.Passive
+			}
+			iface.OSPF = resolved
+		}
+	}
+	return nil
 }
 
-func calcHost(subnet string, index int) string {
-	if subnet == "" {
-		return ""
+// populateISIS resolves the IS-IS settings of IS-IS speakers, deriving their NETs from their router IDs unless
+// set explicitly. The settings of an interface override the ones of its link.
+func (t *Topology) populateISIS() error {
+	links := make(map[string]*Link, len(t.Links))
+	for _, link := range t.Links {
+		links[link.Name] = link
 	}
-	net, pl, _ := strings.Cut(subnet, "/")
-	if strings.Contains(subnet, ".") {
-		net, _ = strings.CutSuffix(net, "0")
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if !node.Protocols["isis"] {
+			continue
+		}
+		if node.ISIS == nil {
+			node.ISIS = &NodeISIS{}
+		}
+		if node.ISIS.Level == "" {
+			node.ISIS.Level = defaultISISLevel
+		}
+		if node.ISIS.NET == "" {
+			net, err := isoNET(cmp.Or(node.ISIS.Area, defaultISISArea), node.RouterID)
+			if err != nil {
+				return fmt.Errorf("node %q %w", name, err)
+			}
+			node.ISIS.NET = net
+		}
+		overrides := make(map[string]*ISIS, len(node.ISIS.Interfaces))
+		for ifname, settings := range node.ISIS.Interfaces {
+			nic, ok := node.nicOf(ifname)
+			if !ok {
+				return fmt.Errorf("node %q sets isis of interface %s, which is not attached to any link", name, ifname)
+			}
+			overrides[nic] = settings
+		}
+		for _, iface := range node.Interfaces {
+			resolved := &ISIS{}
+			var link *ISIS
+			if links[iface.Link] != nil {
+				link = links[iface.Link].ISIS
+			}
+			for _, settings := range []*ISIS{link, overrides[iface.Name]} {
+				if settings != nil {
+					if settings.Metric != nil {
+						resolved.Metric = settings.Metric
+					}
+				}
+			}
+			iface.ISIS = resolved
+		}
+	}
+	return nil
+}
+
+// isoNET derives the IS-IS network entity title in the area from the router ID, which makes up the system ID,
+// e.g. 192.168.0.1 becomes 49.0001.1921.6800.0001.00.
+func isoNET(area, routerID string) (string, error) {
+	addr, err := netip.ParseAddr(routerID)
+	if err != nil || !addr.Is4() {
+		return "", fmt.Errorf("requires an IPv4 router ID to derive the IS-IS NET")
+	}
+	var digits strings.Builder
+	for _, octet := range addr.As4() {
+		fmt.Fprintf(&digits, "%03d", octet)
+	}
+	d := digits.String()
+	return fmt.Sprintf("%s.%s.%s.%s.00", area, d[0:4], d[4:8], d[8:12]), nil
+}
+
+// nicOf translates the name of an interface of the node, e.g. ge-0/0/1, into the name of its NIC. Subinterfaces
+// go by their own names, e.g. eth1.100.
+func (n *Node) nicOf(ifname string) (string, bool) {
+	nic, ok := vendors.GetConfig(n.Vendor).NICName(ifname)
+	if !ok {
+		nic = ifname
+	}
+	return nic, slices.ContainsFunc(n.Interfaces, func(iface *Interface) bool { return iface.Name == nic })
+}
+
+// loopbackIGPs maps the vendors whose BGP speakers of the same AS may peer over their loopbacks to the IGPs
+// their configs render, one of which has to make the loopbacks reachable. BIRD and GoBGP run BGP only.
+var loopbackIGPs = map[vendors.Vendor][]string{
+	vendors.FRR:  {"ospf", "ospf6", "isis"},
+	vendors.CRPD: {"ospf"},
+}
+
+// runsIGP reports whether the node runs an IGP its config renders.
+func (n *Node) runsIGP() bool {
+	return slices.ContainsFunc(loopbackIGPs[n.Vendor], func(igp string) bool { return n.Protocols[igp] })
+}
+
+// peersOverLoopbacks reports whether the node peers with BGP speakers of its AS over loopbacks rather than
+// over the links it shares with them.
+func (n *Node) peersOverLoopbacks() bool {
+	return n.Protocols["bgp"] && n.ASN != nil && n.runsIGP()
+}
+
+// populateIBGP peers BGP speakers of the same AS running an IGP over their loopbacks of either address family,
+// which the IGP makes reachable. Speakers are fully meshed unless some of them are route reflectors, in which
+// case every other speaker peers with the reflectors only. Speakers of an AS without an IGP, e.g. the spines
+// of an eBGP fabric, peer over the links they share instead, hence the speakers of an AS which could peer
+// over loopbacks either all run an IGP or none does.
+func (t *Topology) populateIBGP() error {
+	speakers := make(map[uint32][]*Node)
+	reflectors := make(map[uint32]bool)
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if !node.Protocols["bgp"] || node.ASN == nil || loopbackIGPs[node.Vendor] == nil {
+			continue
+		}
+		speakers[*node.ASN] = append(speakers[*node.ASN], node)
+		reflectors[*node.ASN] = reflectors[*node.ASN] || node.RouteReflector
+	}
+	for _, asn := range slices.Sorted(maps.Keys(speakers)) {
+		nodes := speakers[asn]
+		i := slices.IndexFunc(nodes, func(node *Node) bool { return !node.runsIGP() })
+		switch {
+		case i < 0:
+		case slices.ContainsFunc(nodes, (*Node).runsIGP):
+			return fmt.Errorf("node %q runs none of protocols %s, while other BGP speakers of AS %d run an IGP to peer over loopbacks", nodes[i].Name, quoteList(loopbackIGPs[nodes[i].Vendor]), asn)
+		case reflectors[asn]:
+			j := slices.IndexFunc(nodes, func(node *Node) bool { return node.RouteReflector })
+			return fmt.Errorf("node %q sets route_reflector, which requires the BGP speakers of AS %d to run one of protocols %s", nodes[j].Name, asn, quoteList(loopbackIGPs[nodes[j].Vendor]))
+		default:
+			continue
+		}
+		for _, local := range nodes {
+			for _, remote := range nodes {
+				if remote == local || (reflectors[asn] && !local.RouteReflector && !remote.RouteReflector) {
+					continue
+				}
+				for _, family := range []struct{ local, remote []string }{
+					{local.IPv4Loopbacks, remote.IPv4Loopbacks},
+					{local.IPv6Loopbacks, remote.IPv6Loopbacks},
+				} {
+					if len(family.local) == 0 || len(family.remote) == 0 {
+						continue
+					}
+					localAddr, _, _ := strings.Cut(family.local[0], "/")
+					addr, _, _ := strings.Cut(family.remote[0], "/")
+					local.BGPNeighbors = append(local.BGPNeighbors, &BGPNeighbor{
+						Addr:      addr,
+						LocalAddr: localAddr,
+						ASN:       asn,
+						RRClient:  local.RouteReflector && !remote.RouteReflector,
+					})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// quoteList formats the strings as a comma-separated list of quoted strings, e.g. "ospf", "isis".
+func quoteList(items []string) string {
+	quoted := make([]string, 0, len(items))
+	for _, item := range items {
+		quoted = append(quoted, strconv.Quote(item))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// checkSubnets makes sure that no two links share a subnet, which happens when subnets
+// of parallel links, e.g. VLAN links over the same trunk, are calculated from their endpoints.
+// Explicit subnets and loopbacks are validated upfront, hence any other overlap involves
+// a calculated subnet or loopback.
+func (t *Topology) checkSubnets() error {
+	owners := make(map[string]string)
+	for _, link := range t.Links {
+		for _, subnet := range []string{link.IPv4Subnet, link.IPv6Subnet} {
+			if subnet == "" {
+				continue
+			}
+			if owner, ok := owners[subnet]; ok {
+				return fmt.Errorf("links %s and %s share subnet %s, set subnets explicitly", owner, link.Name, subnet)
+			}
+			owners[subnet] = link.Name
+		}
+	}
+	if err := t.validateSubnets(); err != nil {
+		return fmt.Errorf("%w, set addresses explicitly", err)
+	}
+	return nil
+}
+
+// populateInterfaces names the interfaces of the node once all links are populated. Interfaces
+// that are not pinned get the lowest free ethN in link order, starting from eth<firstIface>.
+// Every subinterface has to sit on top of a physical interface of the node.
+func (n *Node) populateInterfaces(firstIface int) error {
+	// seen maps interface names to the links they are attached to
+	seen := make(map[string]string, len(n.Interfaces))
+	for _, iface := range n.Interfaces {
+		if iface.VLAN != 0 || iface.Name == "" {
+			continue
+		}
+		if link, ok := seen[iface.Name]; ok {
+			return fmt.Errorf("node %q interface %s is attached to both links %s and %s", n.Name, iface.Name, link, iface.Link)
+		}
+		if firstIface != 0 && iface.Name == "eth0" {
+			return fmt.Errorf("node %q interface eth0 is reserved for management", n.Name)
+		}
+		seen[iface.Name] = iface.Link
+	}
+	// veth interfaces are not attached by Docker, hence names given by Docker would not skip them
+	pinned := len(seen) != 0 || slices.ContainsFunc(n.Interfaces, func(iface *Interface) bool { return iface.Veth })
+	next := firstIface
+	for _, iface := range n.Interfaces {
+		if iface.VLAN != 0 {
+			continue
+		}
+		if iface.Name == "" {
+			for seen["eth"+strconv.Itoa(next)] != "" {
+				next++
+			}
+			iface.Name = "eth" + strconv.Itoa(next)
+			seen[iface.Name] = iface.Link
+		}
+		if iface.Veth {
+			continue
+		}
+		// Docker names interfaces in the order of attachment unless told otherwise
+		if pinned || firstIface != 0 {
+			iface.DriverOpts = mergeMaps(iface.DriverOpts, map[string]string{ifnameOption: iface.Name})
+		}
+	}
+	for _, iface := range n.Interfaces {
+		if iface.VLAN == 0 {
+			continue
+		}
+		if _, ok := seen[iface.Parent]; !ok {
+			return fmt.Errorf("node %q subinterface %s does not have parent interface %s", n.Name, iface.Name, iface.Parent)
+		}
+		if link, ok := seen[iface.Name]; ok {
+			return fmt.Errorf("node %q subinterface %s is attached to both links %s and %s", n.Name, iface.Name, link, iface.Link)
+		}
+		seen[iface.Name] = iface.Link
+	}
+	return nil
+}
+
+// populateGateway resolves the gateway node of a host into its addresses on the first link they share,
+// which the host uses as the next hops of its default routes.
+func (n *Node) populateGateway(nodes map[string]*Node) error {
+	if n.Gateway == "" {
+		return nil
+	}
+	gateway, ok := nodes[n.Gateway]
+	if !ok || n.Gateway == n.Name {
+		return fmt.Errorf("node %q has invalid gateway %q", n.Name, n.Gateway)
+	}
+	for _, iface := range n.Interfaces {
+		remote := gateway.interfaceOn(iface.Link)
+		if remote.IPv4Addr == "" && remote.IPv6Addr == "" {
+			continue
+		}
+		n.IPv4Gateway, _, _ = strings.Cut(remote.IPv4Addr, "/")
+		n.IPv6Gateway, _, _ = strings.Cut(remote.IPv6Addr, "/")
+		return nil
+	}
+	return fmt.Errorf("node %q does not share an addressed link with its gateway %q", n.Name, n.Gateway)
+}
+
+// interfaceOn returns the node interface attached to the named link.
+func (n *Node) interfaceOn(linkName string) *Interface {
+	for _, iface := range n.Interfaces {
+		if iface.Link == linkName {
+			return iface
+		}
 	}
-	return fmt.Sprintf("%s%d/%s", net, index, pl)
+	return &Interface{}
 }
 
 // getIndex extracts a node index from the node name.
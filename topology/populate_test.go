@@ -1,101 +1,967 @@
 package topology
 
-import "testing"
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"testing"
 
-func TestCalcSubnet(t *testing.T) {
+	"github.com/elupevg/golab/ipam"
+	"github.com/elupevg/golab/vendors"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPopulateSecrets(t *testing.T) {
+	t.Parallel()
+	secretFile := filepath.Join(t.TempDir(), "bgp.txt")
+	if err := os.WriteFile(secretFile, []byte("s3cr3t\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	topo := &Topology{
+		Secrets: map[string]string{
+			"bgp":  "file:" + secretFile,
+			"snmp": "public",
+		},
+	}
+	if err := topo.populateSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"bgp": "s3cr3t", "snmp": "public"}
+	for name, wantValue := range want {
+		got, err := topo.Secret(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantValue != got {
+			t.Errorf("secret %q: want %q, got %q", name, wantValue, got)
+		}
+	}
+	wantMsg := `secret "token" is not defined`
+	_, err := topo.Secret("token")
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestPopulateSecretsErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		secrets map[string]string
+		errMsg  string
+	}{
+		{
+			name:    "MissingEnv",
+			secrets: map[string]string{"bgp": "env:GOLAB_TEST_UNSET_SECRET"},
+			errMsg:  `failed to resolve secret "bgp": environment variable "GOLAB_TEST_UNSET_SECRET" is not set`,
+		},
+		{
+			name:    "MissingFile",
+			secrets: map[string]string{"bgp": "file:/nonexistent/bgp.txt"},
+			errMsg:  `failed to resolve secret "bgp": open /nonexistent/bgp.txt: no such file or directory`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			topo := &Topology{Secrets: tc.secrets}
+			err := topo.populateSecrets()
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if tc.errMsg != errMsg {
+				t.Errorf("error: want %q, got %q", tc.errMsg, errMsg)
+			}
+		})
+	}
+}
+
+func TestPopulateBGPNeighbors(t *testing.T) {
+	t.Parallel()
+	asn1, asn2 := uint32(65001), uint32(65002)
+	nodes := map[string]*Node{
+		"R1": {
+			Protocols:  map[string]bool{"bgp": true},
+			ASN:        &asn1,
+			Interfaces: []*Interface{{Link: "golab-link-01", IPv4Addr: "10.1.2.1/24"}},
+		},
+		"R2": {
+			Protocols:  map[string]bool{"bgp": true},
+			ASN:        &asn2,
+			Interfaces: []*Interface{{Link: "golab-link-01", IPv4Addr: "10.1.2.2/24"}},
+		},
+		"R3": {
+			Interfaces: []*Interface{{Link: "golab-link-01", IPv4Addr: "10.1.2.3/24"}},
+		},
+		// speakers of the same AS peer over the link unless they run an IGP to peer over their loopbacks
+		"R4": {
+			Protocols:  map[string]bool{"bgp": true},
+			ASN:        &asn1,
+			Interfaces: []*Interface{{Link: "golab-link-01", IPv4Addr: "10.1.2.4/24"}},
+		},
+	}
+	link := &Link{
+		Name:        "golab-link-01",
+		Endpoints:   []string{"R1", "R2", "R3", "R4"},
+		BGPPassword: "s3cr3t",
+	}
+	if err := link.populateBGPNeighbors(nodes); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]*BGPNeighbor{
+		"R1": {{Addr: "10.1.2.2", ASN: asn2, Password: "s3cr3t"}, {Addr: "10.1.2.4", ASN: asn1, Password: "s3cr3t"}},
+		"R2": {{Addr: "10.1.2.1", ASN: asn1, Password: "s3cr3t"}, {Addr: "10.1.2.4", ASN: asn1, Password: "s3cr3t"}},
+		"R3": nil,
+		"R4": {{Addr: "10.1.2.1", ASN: asn1, Password: "s3cr3t"}, {Addr: "10.1.2.2", ASN: asn2, Password: "s3cr3t"}},
+	}
+	for name, node := range nodes {
+		if diff := cmp.Diff(want[name], node.BGPNeighbors); diff != "" {
+			t.Errorf("%s: %s", name, diff)
+		}
+	}
+	link.BGPPassword = "s3cr3t password"
+	wantMsg := "BGP password for link golab-link-01 contains whitespace"
+	err := link.populateBGPNeighbors(nodes)
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestPopulateIBGP(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
 		name      string
-		endpoints []string
-		ipVersion int
-		want      string
+		protocols string
+		nodes     string
+		want      map[string][]*BGPNeighbor
+	}{
+		{
+			// speakers running an IGP peer over their loopbacks rather than the links they share
+			name:      "FullMesh",
+			protocols: "{bgp: true, isis: true}",
+			nodes:     "{R1: {asn: 65000}, R2: {asn: 65000}, R3: {asn: 65000}, R4: {asn: 65001}}\nlinks: [{endpoints: [R1, R2]}]",
+			want: map[string][]*BGPNeighbor{
+				"R1": {{Addr: "192.168.0.2", LocalAddr: "192.168.0.1", ASN: 65000}, {Addr: "192.168.0.3", LocalAddr: "192.168.0.1", ASN: 65000}},
+				"R2": {{Addr: "192.168.0.1", LocalAddr: "192.168.0.2", ASN: 65000}, {Addr: "192.168.0.3", LocalAddr: "192.168.0.2", ASN: 65000}},
+				"R3": {{Addr: "192.168.0.1", LocalAddr: "192.168.0.3", ASN: 65000}, {Addr: "192.168.0.2", LocalAddr: "192.168.0.3", ASN: 65000}},
+				"R4": nil,
+			},
+		},
+		{
+			name:      "RouteReflectors",
+			protocols: "{bgp: true, ospf: true}",
+			nodes:     `{R1: {asn: 65000, route_reflector: true}, R2: {asn: 65000, route_reflector: true}, R3: {asn: 65000}, R4: {asn: 65000}}`,
+			want: map[string][]*BGPNeighbor{
+				"R1": {
+					{Addr: "192.168.0.2", LocalAddr: "192.168.0.1", ASN: 65000},
+					{Addr: "192.168.0.3", LocalAddr: "192.168.0.1", ASN: 65000, RRClient: true},
+					{Addr: "192.168.0.4", LocalAddr: "192.168.0.1", ASN: 65000, RRClient: true},
+				},
+				"R2": {
+					{Addr: "192.168.0.1", LocalAddr: "192.168.0.2", ASN: 65000},
+					{Addr: "192.168.0.3", LocalAddr: "192.168.0.2", ASN: 65000, RRClient: true},
+					{Addr: "192.168.0.4", LocalAddr: "192.168.0.2", ASN: 65000, RRClient: true},
+				},
+				"R3": {{Addr: "192.168.0.1", LocalAddr: "192.168.0.3", ASN: 65000}, {Addr: "192.168.0.2", LocalAddr: "192.168.0.3", ASN: 65000}},
+				"R4": {{Addr: "192.168.0.1", LocalAddr: "192.168.0.4", ASN: 65000}, {Addr: "192.168.0.2", LocalAddr: "192.168.0.4", ASN: 65000}},
+			},
+		},
+		{
+			// speakers without an IGP, e.g. spines of an eBGP fabric, peer over shared links only
+			name:      "WithoutIGP",
+			protocols: "{bgp: true}",
+			nodes:     "{R1: {asn: 65000}, R2: {asn: 65000}, R3: {asn: 65000}}\nlinks: [{endpoints: [R1, R2]}]",
+			want: map[string][]*BGPNeighbor{
+				"R1": {{Addr: "10.1.2.2", ASN: 65000}},
+				"R2": {{Addr: "10.1.2.1", ASN: 65000}},
+				"R3": nil,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			data := "name: ibgp\nip_mode: ipv4\ndefaults: {image: \"quay.io/frrouting/frr:master\", protocols: " + tc.protocols + "}\nnodes: " + tc.nodes + "\n"
+			topo, err := FromYAML([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tc.want {
+				if diff := cmp.Diff(want, topo.Nodes[name].BGPNeighbors); diff != "" {
+					t.Errorf("%s: BGP neighbors mismatch (-want +got):\n%s", name, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestPopulateIBGPErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		nodes  string
+		errMsg string
+	}{
+		{
+			name:   "MissingIGP",
+			nodes:  "{R1: {asn: 65000, protocols: {isis: true}}, R2: {asn: 65000}}",
+			errMsg: `node "R2" runs none of protocols "ospf", "ospf6", "isis", while other BGP speakers of AS 65000 run an IGP to peer over loopbacks`,
+		},
+		{
+			name:   "ReflectorWithoutIGP",
+			nodes:  "{R1: {asn: 65000, route_reflector: true}, R2: {asn: 65000}}",
+			errMsg: `node "R1" sets route_reflector, which requires the BGP speakers of AS 65000 to run one of protocols "ospf", "ospf6", "isis"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			data := "name: ibgp\nip_mode: ipv4\ndefaults: {image: \"quay.io/frrouting/frr:master\", protocols: {bgp: true}}\nnodes: " + tc.nodes + "\n"
+			if _, err := FromYAML([]byte(data)); err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestPopulateOSPF(t *testing.T) {
+	t.Parallel()
+	topo, err := FromYAML([]byte(`
+name: areas
+ip_mode: ipv4
+defaults: {image: "quay.io/frrouting/frr:master", protocols: {ospf: true}}
+nodes:
+  R1: {ospf: {area: 0.0.0.1, interfaces: {eth1: {cost: 100, passive: true}}}}
+  R2:
+  R3:
+links:
+  - endpoints: [R1, R2]
+    ospf: {area: 0, cost: 10}
+  - endpoints: [R1, R3]
+    ospf: {cost: 20}
+  - endpoints: [R2, R3]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cost10, cost20, cost100 := 10, 20, 100
+	want := map[string][]*OSPF{
+		"R1": {{Area: "0", Cost: &cost10}, {Area: "0.0.0.1", Cost: &cost100, Passive: true}},
+		"R2": {{Area: "0", Cost: &cost10}, {Area: "0"}},
+		"R3": {{Area: "0", Cost: &cost20}, {Area: "0"}},
+	}
+	for name, node := range topo.Nodes {
+		var got []*OSPF
+		for _, iface := range node.Interfaces {
+			got = append(got, iface.OSPF)
+		}
+		if diff := cmp.Diff(want[name], got); diff != "" {
+			t.Errorf("%s: OSPF mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+	if area := topo.Nodes["R1"].OSPF.Area; area != "0.0.0.1" {
+		t.Errorf("R1 loopback area: want %q, got %q", "0.0.0.1", area)
+	}
+	_, err = FromYAML([]byte("name: areas\nnodes:\n  R1: {image: \"quay.io/frrouting/frr:master\", protocols: {ospf: true}, ospf: {interfaces: {eth3: {cost: 5}}}}\n"))
+	errMsg := `node "R1" sets ospf of interface eth3, which is not attached to any link`
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	// settings rendered by FRR only are not silently dropped from the configs of other vendors
+	_, err = FromYAML([]byte("name: areas\nip_mode: ipv4\nnodes:\n  R1: {image: \"crpd:23.2R1.13\", protocols: {ospf: true}, ospf: {area: 1}}\n"))
+	errMsg = `node "R1" sets ospf, which is supported by vendor "frr" only`
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	_, err = FromYAML([]byte(`
+name: areas
+ip_mode: ipv4
+defaults: {protocols: {ospf: true}}
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "crpd:23.2R1.13"}
+links:
+  - endpoints: [R1, R2]
+    ospf: {cost: 10}
+`))
+	errMsg = `link [R1 R2] sets ospf, which is supported by vendor "frr" only, but attaches node "R2" of vendor "crpd"`
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestPopulateISIS(t *testing.T) {
+	t.Parallel()
+	topo, err := FromYAML([]byte(`
+name: levels
+ip_mode: ipv4
+defaults: {image: "quay.io/frrouting/frr:master", protocols: {isis: true}}
+nodes:
+  R1: {isis: {area: "49.0020", level: level-1-2, interfaces: {eth1: {metric: 100}}}}
+  R2: {isis: {net: "49.0003.0000.0000.0002.00"}}
+  R3:
+links:
+  - endpoints: [R1, R2]
+    isis: {metric: 10}
+  - endpoints: [R1, R3]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metric10, metric100 := 10, 100
+	wantNodes := map[string]*NodeISIS{
+		"R1": {Area: "49.0020", NET: "49.0020.1921.6800.0001.00", Level: ISISLevel12, Interfaces: map[string]*ISIS{"eth1": {Metric: &metric100}}},
+		"R2": {NET: "49.0003.0000.0000.0002.00", Level: ISISLevel2},
+		"R3": {NET: "49.0001.1921.6800.0003.00", Level: ISISLevel2},
+	}
+	wantInterfaces := map[string][]*ISIS{
+		"R1": {{Metric: &metric10}, {Metric: &metric100}},
+		"R2": {{Metric: &metric10}},
+		"R3": {{}},
+	}
+	for name, node := range topo.Nodes {
+		if diff := cmp.Diff(wantNodes[name], node.ISIS); diff != "" {
+			t.Errorf("%s: IS-IS mismatch (-want +got):\n%s", name, diff)
+		}
+		var got []*ISIS
+		for _, iface := range node.Interfaces {
+			got = append(got, iface.ISIS)
+		}
+		if diff := cmp.Diff(wantInterfaces[name], got); diff != "" {
+			t.Errorf("%s: interface IS-IS mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+	_, err = FromYAML([]byte("name: levels\nnodes:\n  R1: {image: \"quay.io/frrouting/frr:master\", protocols: {isis: true}, isis: {interfaces: {eth3: {metric: 5}}}}\n"))
+	errMsg := `node "R1" sets isis of interface eth3, which is not attached to any link`
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+	// unquoted areas are YAML floats, which lose their trailing zeros
+	_, err = FromYAML([]byte("name: levels\nnodes:\n  R1: {image: \"quay.io/frrouting/frr:master\", protocols: {isis: true}, isis: {area: 49.0020}}\n"))
+	errMsg = `isis area 49.0020 has to be quoted, e.g. area: "49.0001"`
+	if err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestPopulateSyslog(t *testing.T) {
+	t.Parallel()
+	topo := &Topology{
+		Nodes:  map[string]*Node{"R1": {Index: 1, Vendor: vendors.FRR}, "R2": {Index: 2}},
+		Syslog: &Syslog{},
+	}
+	topo.populateMgmt()
+	topo.populateSyslog()
+	wantCmd := []string{"/bin/sh", "-c", "syslogd -R 10.255.255.1:514 && exec /usr/lib/frr/docker-start"}
+	if diff := cmp.Diff(wantCmd, topo.Nodes["R1"].Cmd); diff != "" {
+		t.Errorf("R1 cmd mismatch (-want +got):\n%s", diff)
+	}
+	if topo.Nodes["R2"].Cmd != nil {
+		t.Errorf("R2 cmd: want none, got %q", topo.Nodes["R2"].Cmd)
+	}
+	wantMgmt := &Link{
+		Name:        "golab-mgmt",
+		Endpoints:   []string{"R1", "R2"},
+		IPv4Subnet:  "10.255.254.0/23",
+		IPv4Gateway: "10.255.254.254",
+	}
+	if diff := cmp.Diff(wantMgmt, topo.Mgmt); diff != "" {
+		t.Error(diff)
+	}
+	if len(topo.Services) != 1 {
+		t.Fatalf("services: want 1, got %d", len(topo.Services))
+	}
+	syslog := topo.Services[0]
+	if syslog.Name != "golab-syslog" || syslog.Image != "balabit/syslog-ng:latest" {
+		t.Errorf("unexpected syslog service %s with image %s", syslog.Name, syslog.Image)
+	}
+	for name, node := range topo.Nodes {
+		if node.SyslogServer != "10.255.255.1" {
+			t.Errorf("%s syslog server: want %q, got %q", name, "10.255.255.1", node.SyslogServer)
+		}
+		wantAddr := mgmtHost("10.255.254.0/23", node.Index)
+		if node.Mgmt.IPv4Addr != wantAddr {
+			t.Errorf("%s mgmt address: want %q, got %q", name, wantAddr, node.Mgmt.IPv4Addr)
+		}
+	}
+}
+
+func TestPopulateManagement(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: oob
+mgmt:
+  ipv4_subnet: 172.20.0.0/16
+syslog: {}
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMgmt := &Link{
+		Name:        "golab-mgmt",
+		Endpoints:   []string{"R1", "R2"},
+		IPv4Subnet:  "172.20.0.0/16",
+		IPv4Gateway: "172.20.0.254",
+		External:    true,
+		Labels:      map[string]string{LabLabel: "oob"},
+	}
+	if diff := cmp.Diff(wantMgmt, topo.Mgmt); diff != "" {
+		t.Errorf("mgmt link mismatch (-want +got):\n%s", diff)
+	}
+	r1 := topo.Nodes["R1"]
+	wantIfaces := []*Interface{
+		{
+			Name:       "eth0",
+			Link:       "golab-mgmt",
+			IPv4Addr:   "172.20.0.1/16",
+			DriverOpts: map[string]string{"com.docker.network.endpoint.ifname": "eth0"},
+		},
+		{
+			Name:       "eth1",
+			Link:       "golab-link-01",
+			IPv4Addr:   "10.1.2.1/24",
+			IPv6Addr:   "2001:db8:1:2::1/64",
+			DriverOpts: map[string]string{"com.docker.network.endpoint.ifname": "eth1"},
+		},
+	}
+	if diff := cmp.Diff(wantIfaces, append([]*Interface{r1.Mgmt}, r1.Interfaces...)); diff != "" {
+		t.Errorf("interfaces mismatch (-want +got):\n%s", diff)
+	}
+	if r1.SyslogServer != "172.20.1.1" {
+		t.Errorf("syslog server: want %q, got %q", "172.20.1.1", r1.SyslogServer)
+	}
+}
+
+func TestPopulateASNs(t *testing.T) {
+	t.Parallel()
+	explicit := uint32(64513)
+	bgp := map[string]bool{"bgp": true}
+	topo := &Topology{
+		ASNStartFrom: 64512,
+		Nodes: map[string]*Node{
+			"R1":  {Index: 1, Protocols: bgp},
+			"R2":  {Index: 2, Protocols: bgp, ASN: &explicit},
+			"R3":  {Index: 3},
+			"R4":  {Index: 4, Protocols: bgp},
+			"R10": {Index: 10, Protocols: bgp},
+		},
+	}
+	if err := topo.populateASNs(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint32{"R1": 64512, "R2": 64513, "R4": 64514, "R10": 64515}
+	got := make(map[string]uint32)
+	for name, node := range topo.Nodes {
+		if node.ASN != nil {
+			got[name] = *node.ASN
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ASNs mismatch (-want +got):\n%s", diff)
+	}
+	topo = &Topology{
+		ASNStartFrom: 65534,
+		Nodes: map[string]*Node{
+			"R1": {Name: "R1", Index: 1, Protocols: bgp},
+			"R2": {Name: "R2", Index: 2, Protocols: bgp},
+		},
+	}
+	wantMsg := `asn_start_from 65534 runs out of private ASNs at node "R2"`
+	if err := topo.populateASNs(); err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestPopulateLabels(t *testing.T) {
+	t.Parallel()
+	topo := &Topology{
+		Name:   "lab",
+		Labels: map[string]string{"team": "netops", "env": "ci"},
+		Nodes: map[string]*Node{
+			"R1": {
+				Labels:   map[string]string{"env": "staging", "role": "spine"},
+				Sidecars: []*Node{{Name: "R1-ssh"}},
+			},
+		},
+		Links:    []*Link{{Name: "golab-link-01", Labels: map[string]string{"circuit": "c1"}}},
+		Services: []*Node{{Name: "golab-syslog"}},
+	}
+	topo.populateLabels()
+	wantNode := map[string]string{"team": "netops", "env": "staging", "role": "spine", LabLabel: "lab"}
+	if diff := cmp.Diff(wantNode, topo.Nodes["R1"].Labels); diff != "" {
+		t.Errorf("node labels mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantNode, topo.Nodes["R1"].Sidecars[0].Labels); diff != "" {
+		t.Errorf("sidecar labels mismatch (-want +got):\n%s", diff)
+	}
+	wantLink := map[string]string{"team": "netops", "env": "ci", "circuit": "c1", LabLabel: "lab"}
+	if diff := cmp.Diff(wantLink, topo.Links[0].Labels); diff != "" {
+		t.Errorf("link labels mismatch (-want +got):\n%s", diff)
+	}
+	wantService := map[string]string{"team": "netops", "env": "ci", LabLabel: "lab"}
+	if diff := cmp.Diff(wantService, topo.Services[0].Labels); diff != "" {
+		t.Errorf("service labels mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPopulateDNS(t *testing.T) {
+	t.Parallel()
+	topo := &Topology{
+		Name:  "triangle",
+		Nodes: map[string]*Node{"R1": {}, "R2": {}},
+		DNS:   &DNS{},
+	}
+	topo.populateMgmt()
+	topo.populateDNS()
+	for name, node := range topo.Nodes {
+		if node.DNSDomain != "triangle" {
+			t.Errorf("%s domain: want %q, got %q", name, "triangle", node.DNSDomain)
+		}
+		wantAliases := []string{name, name + ".triangle"}
+		if diff := cmp.Diff(wantAliases, node.Mgmt.Aliases); diff != "" {
+			t.Errorf("%s aliases: %s", name, diff)
+		}
+	}
+}
+
+func TestPopulateProfiles(t *testing.T) {
+	t.Parallel()
+	topo := &Topology{
+		Profiles: map[string]*Profile{
+			"core-router": {
+				Image:     "quay.io/frrouting/frr:master",
+				Binds:     []string{"/lib/modules:/lib/modules"},
+				Protocols: map[string]bool{"ospf": true, "bgp": true},
+				Sysctls:   map[string]string{"net.ipv4.ip_forward": "1"},
+				Env:       map[string]string{"TZ": "UTC"},
+				CPUs:      1,
+				Memory:    "512m",
+			},
+		},
+		Nodes: map[string]*Node{
+			"R1": {Profile: "core-router"},
+			"R2": {
+				Profile:   "core-router",
+				Image:     "quay.io/frrouting/frr:10.3.0",
+				Binds:     []string{"/tmp/frr:/tmp/frr"},
+				Protocols: map[string]bool{"bgp": false},
+				Env:       map[string]string{"TZ": "CET"},
+				Memory:    "1g",
+			},
+		},
+	}
+	if err := topo.populateProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*Node{
+		"R1": {
+			Profile:   "core-router",
+			Image:     "quay.io/frrouting/frr:master",
+			Binds:     []string{"/lib/modules:/lib/modules"},
+			Protocols: map[string]bool{"ospf": true, "bgp": true},
+			Sysctls:   map[string]string{"net.ipv4.ip_forward": "1"},
+			Env:       map[string]string{"TZ": "UTC"},
+			CPUs:      1,
+			Memory:    "512m",
+		},
+		"R2": {
+			Profile:   "core-router",
+			Image:     "quay.io/frrouting/frr:10.3.0",
+			Binds:     []string{"/lib/modules:/lib/modules", "/tmp/frr:/tmp/frr"},
+			Protocols: map[string]bool{"ospf": true, "bgp": false},
+			Sysctls:   map[string]string{"net.ipv4.ip_forward": "1"},
+			Env:       map[string]string{"TZ": "CET"},
+			CPUs:      1,
+			Memory:    "1g",
+		},
+	}
+	if diff := cmp.Diff(want, topo.Nodes); diff != "" {
+		t.Error(diff)
+	}
+	// the profile itself must remain intact
+	if topo.Profiles["core-router"].Protocols["bgp"] != true {
+		t.Error("profile protocols were modified by a node override")
+	}
+	for _, bind := range topo.Nodes["R2"].Binds {
+		if err := validateBind(bind); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestPopulateDefaults(t *testing.T) {
+	t.Parallel()
+	topo := &Topology{
+		Defaults: &Profile{
+			Image:     "quay.io/frrouting/frr:master",
+			Binds:     []string{"/lib/modules:/lib/modules:ro"},
+			Protocols: map[string]bool{"ospf": true},
+			Sysctls:   map[string]string{"net.ipv4.ip_forward": "1"},
+		},
+		Profiles: map[string]*Profile{
+			"edge-router": {
+				Image:     "quay.io/frrouting/frr:10.3.0",
+				Protocols: map[string]bool{"bgp": true},
+			},
+		},
+		Nodes: map[string]*Node{
+			"R1": nil,
+			"R2": {Profile: "edge-router"},
+			"R3": {Image: "crpd:23.2R1.13", Protocols: map[string]bool{"ospf": false}},
+		},
+	}
+	if err := topo.populateProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*Node{
+		"R1": {
+			Image:     "quay.io/frrouting/frr:master",
+			Binds:     []string{"/lib/modules:/lib/modules:ro"},
+			Protocols: map[string]bool{"ospf": true},
+			Sysctls:   map[string]string{"net.ipv4.ip_forward": "1"},
+		},
+		"R2": {
+			Profile:   "edge-router",
+			Image:     "quay.io/frrouting/frr:10.3.0",
+			Binds:     []string{"/lib/modules:/lib/modules:ro"},
+			Protocols: map[string]bool{"ospf": true, "bgp": true},
+			Sysctls:   map[string]string{"net.ipv4.ip_forward": "1"},
+		},
+		"R3": {
+			Image:     "crpd:23.2R1.13",
+			Binds:     []string{"/lib/modules:/lib/modules:ro"},
+			Protocols: map[string]bool{"ospf": false},
+			Sysctls:   map[string]string{"net.ipv4.ip_forward": "1"},
+		},
+	}
+	if diff := cmp.Diff(want, topo.Nodes); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPopulateProfilesError(t *testing.T) {
+	t.Parallel()
+	topo := &Topology{Nodes: map[string]*Node{"R1": {Profile: "edge-router"}}}
+	wantMsg := `node "R1" references undefined profile "edge-router"`
+	err := topo.populateProfiles()
+	if err == nil || err.Error() != wantMsg {
+		t.Errorf("error: want %q, got %v", wantMsg, err)
+	}
+}
+
+func TestPopulateKind(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		node *Node
+		want vendors.Vendor
 	}{
 		{
-			name:      "IPv4R3toR4",
-			endpoints: []string{"R3", "R4"},
-			ipVersion: 4,
-			want:      "10.3.4.0/24",
+			name: "DetectedByImage",
+			node: &Node{Image: "quay.io/frrouting/frr:master"},
+			want: vendors.FRR,
 		},
 		{
-			name:      "IPv6R3toR4",
-			endpoints: []string{"R3", "R4"},
-			ipVersion: 6,
-			want:      "2001:db8:3:4::/64",
+			name: "RenamedImage",
+			node: &Node{Image: "internal/routing:latest", Kind: vendors.FRR},
+			want: vendors.FRR,
 		},
 		{
-			name:      "IPv4R4toR3",
-			endpoints: []string{"R4", "R3"},
-			ipVersion: 4,
-			want:      "10.4.3.0/24",
+			name: "KindOverridesImage",
+			node: &Node{Image: "registry.local/frr-crpd-mirror:23.2", Kind: vendors.CRPD},
+			want: vendors.CRPD,
 		},
 		{
-			name:      "IPv6R4toR3",
-			endpoints: []string{"R4", "R3"},
-			ipVersion: 6,
-			want:      "2001:db8:4:3::/64",
+			name: "GoBGP",
+			node: &Node{Image: "jauderho/gobgp:latest"},
+			want: vendors.GOBGP,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.node.populate("R1", Manual, Dual, ipam.New(ipam.Index)); err != nil {
+				t.Fatal(err)
+			}
+			if tc.node.Vendor != tc.want {
+				t.Errorf("vendor: want %q, got %q", tc.want, tc.node.Vendor)
+			}
+			if diff := cmp.Diff(vendors.GetConfig(tc.want).Capabilities, tc.node.Capabilities); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestPopulateRouteServerOfRouter(t *testing.T) {
+	t.Parallel()
+	node := &Node{Image: "quay.io/frrouting/frr:master", Protocols: map[string]bool{"bgp": true}, RouteServer: true}
+	errMsg := `node "R1" sets route_server or rpki, which are supported by vendors "bird" and "gobgp" only`
+	if err := node.populate("R1", Manual, Dual, ipam.New(ipam.Index)); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestPopulateRouteReflectorOfDaemon(t *testing.T) {
+	t.Parallel()
+	node := &Node{Image: "jauderho/gobgp:latest", Protocols: map[string]bool{"bgp": true}, RouteReflector: true}
+	errMsg := `node "R1" sets route_reflector, which is supported by vendor "frr" only`
+	if err := node.populate("R1", Manual, Dual, ipam.New(ipam.Index)); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
+
+func TestPopulateCapabilities(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		node *Node
+		want []string
+	}{
+		{
+			name: "VendorDefaults",
+			node: &Node{Image: "quay.io/frrouting/frr:master"},
+			want: []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
 		},
 		{
-			name:      "IPv4Broadcast",
-			endpoints: []string{"R1", "R2", "R3"},
-			ipVersion: 4,
-			want:      "10.0.3.0/24",
+			name: "AddAndDrop",
+			node: &Node{Image: "quay.io/frrouting/frr:master", CapAdd: []string{"SYS_TIME", "NET_ADMIN"}, CapDrop: []string{"SYS_ADMIN"}},
+			want: []string{"NET_ADMIN", "NET_RAW", "SYS_TIME"},
 		},
 		{
-			name:      "IPv6Broadcast",
-			endpoints: []string{"R1", "R2", "R3"},
-			ipVersion: 6,
-			want:      "2001:db8:0:3::/64",
+			name: "DropAll",
+			node: &Node{Image: "quay.io/frrouting/frr:master", CapAdd: []string{"NET_ADMIN"}, CapDrop: []string{"ALL"}},
+			want: []string{"NET_ADMIN"},
+		},
+		{
+			name: "Privileged",
+			node: &Node{Image: "quay.io/frrouting/frr:master", Privileged: true},
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got := calcSubnet(tc.endpoints, tc.ipVersion)
-			if tc.want != got {
-				t.Errorf("want %q, got %q", tc.want, got)
+			t.Parallel()
+			if err := tc.node.populate("R1", Manual, Dual, ipam.New(ipam.Index)); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, tc.node.Capabilities); diff != "" {
+				t.Errorf("capabilities mismatch (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
-func TestCalcHost(t *testing.T) {
+func TestPopulateGroups(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: fabric
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+groups:
+  spine:
+    count: 2
+    index: 11
+    node: {image: "quay.io/frrouting/frr:master", protocols: {bgp: true}, asn: 65000}
+  leaf:
+    count: 3
+    asn_step: 1
+    node: {image: "quay.io/frrouting/frr:master", protocols: {bgp: true}, asn: 65001}
+links:
+  - endpoints: [spine, leaf]
+  - endpoints: [R1, spine1]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNodes := map[string]struct {
+		index int
+		asn   uint32
+	}{
+		"spine1": {11, 65000},
+		"spine2": {12, 65000},
+		"leaf1":  {13, 65001},
+		"leaf2":  {14, 65002},
+		"leaf3":  {15, 65003},
+	}
+	for name, want := range wantNodes {
+		node, ok := topo.Nodes[name]
+		if !ok {
+			t.Errorf("replica %s is missing", name)
+			continue
+		}
+		if node.Index != want.index || *node.ASN != want.asn {
+			t.Errorf("%s: want index %d and ASN %d, got %d and %d", name, want.index, want.asn, node.Index, *node.ASN)
+		}
+	}
+	if got := topo.Nodes["leaf2"].IPv4Loopbacks; !cmp.Equal(got, []string{"192.168.0.14/32"}) {
+		t.Errorf("leaf2 loopbacks: want [192.168.0.14/32], got %v", got)
+	}
+	var gotLinks []string
+	for _, link := range topo.Links {
+		gotLinks = append(gotLinks, fmt.Sprintf("%v %s", link.Endpoints, link.IPv4Subnet))
+	}
+	wantLinks := []string{
+		"[spine1 leaf1] 10.11.13.0/24",
+		"[spine1 leaf2] 10.11.14.0/24",
+		"[spine1 leaf3] 10.11.15.0/24",
+		"[spine2 leaf1] 10.12.13.0/24",
+		"[spine2 leaf2] 10.12.14.0/24",
+		"[spine2 leaf3] 10.12.15.0/24",
+		"[R1 spine1] 10.1.11.0/24",
+	}
+	if diff := cmp.Diff(wantLinks, gotLinks); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPopulateGroupsErrors(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
 		name   string
-		subnet string
-		index  int
-		want   string
+		yaml   string
+		errMsg string
 	}{
 		{
-			name:   "IPv4Host4",
-			subnet: "10.3.4.0/24",
-			index:  4,
-			want:   "10.3.4.4/24",
+			name:   "InvalidName",
+			yaml:   `groups: {leaf1: {count: 2, node: {image: alpine}}}`,
+			errMsg: `group name "leaf1" has to consist of lowercase letters and dashes`,
+		},
+		{
+			name:   "MissingNode",
+			yaml:   `groups: {leaf: {count: 2}}`,
+			errMsg: `group "leaf" does not have a node definition`,
+		},
+		{
+			name:   "InvalidCount",
+			yaml:   `groups: {leaf: {count: 0, node: {image: alpine}}}`,
+			errMsg: `group "leaf" has invalid count 0`,
 		},
 		{
-			name:   "IPv6Host4",
-			subnet: "2001:db8:3:4::/64",
-			index:  4,
-			want:   "2001:db8:3:4::4/64",
+			name:   "SharedLoopbacks",
+			yaml:   `groups: {leaf: {count: 2, node: {image: alpine, ipv4_loopbacks: [192.168.0.1/32]}}}`,
+			errMsg: `group "leaf" cannot set loopbacks or ports shared by all replicas`,
 		},
 		{
-			name:   "IPv4Host254",
-			subnet: "10.3.4.0/24",
-			index:  254,
-			want:   "10.3.4.254/24",
+			name:   "IndexOverlap",
+			yaml:   `{nodes: {R12: {image: alpine}}, groups: {leaf: {count: 4, index: 11, node: {image: alpine}}}}`,
+			errMsg: `replica "leaf2" of group "leaf" has the same index 12 as node "R12"`,
 		},
 		{
-			name:   "IPv6Host254",
-			subnet: "2001:db8:3:4::/64",
-			index:  254,
-			want:   "2001:db8:3:4::254/64",
+			name:   "IndexRange",
+			yaml:   `groups: {leaf: {count: 4, index: 252, node: {image: alpine}}}`,
+			errMsg: `group "leaf" index range 252-255 exceeds 253`,
+		},
+		{
+			name:   "ExpandedSubnet",
+			yaml:   `{groups: {leaf: {count: 2, node: {image: alpine}}}, nodes: {R1: {image: alpine}}, links: [{endpoints: [R1, leaf], ipv4_subnet: 10.0.0.0/24}]}`,
+			errMsg: `link [R1 leaf] expanded into multiple links cannot set subnets`,
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got := calcHost(tc.subnet, tc.index)
-			if tc.want != got {
-				t.Errorf("want %q, got %q", tc.want, got)
+			topo, err := parseYAML([]byte(tc.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = topo.populateGroups()
+			if err == nil || err.Error() != tc.errMsg {
+				t.Errorf("error: want %q, got %v", tc.errMsg, err)
 			}
 		})
 	}
 }
+
+func TestPopulateHosts(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: lab1
+mgmt: {}
+hosts:
+  h1: {vtep: 192.0.2.1}
+  h2: {vtep: 192.0.2.2, engine: "ssh://user@h2"}
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master", host: h2}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+  - endpoints: [R2, R3]
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotHosts := map[string]string{}
+	for name, node := range topo.Nodes {
+		gotHosts[name] = node.Host
+	}
+	// R2 goes to the host without nodes, after which R3 goes to the first of the equally loaded hosts
+	if diff := cmp.Diff(map[string]string{"R1": "h2", "R2": "h1", "R3": "h1"}, gotHosts); diff != "" {
+		t.Errorf("node hosts mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"h1", "h2"}, topo.Links[0].Hosts); diff != "" {
+		t.Errorf("link hosts mismatch (-want +got):\n%s", diff)
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte("lab1/golab-link-01"))
+	wantTunnel := &Tunnel{VNI: int(hash.Sum32() & 0xffffff), Port: 4789, Image: "nicolaka/netshoot:latest"}
+	if diff := cmp.Diff(wantTunnel, topo.Links[0].Tunnel); diff != "" {
+		t.Errorf("tunnel mismatch (-want +got):\n%s", diff)
+	}
+	// links within a host and management networks are not stitched
+	if topo.Links[1].Tunnel != nil || topo.Mgmt.Tunnel != nil {
+		t.Errorf("want no tunnels, got %v and %v", topo.Links[1].Tunnel, topo.Mgmt.Tunnel)
+	}
+	if diff := cmp.Diff([]string{"h1", "h2"}, topo.Mgmt.Hosts); diff != "" {
+		t.Errorf("mgmt hosts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPopulateHostsVNICollision(t *testing.T) {
+	t.Parallel()
+	// both link names hash to VNI 3160770 in lab1
+	testYAML := `
+name: lab1
+hosts: {h1: {vtep: 192.0.2.1}, h2: {vtep: 192.0.2.2}}
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+  R3: {image: "quay.io/frrouting/frr:master"}
+links:
+  - {name: wan37969, endpoints: [R1, R2]}
+  - {name: wan41814, endpoints: [R2, R3]}
+`
+	topo, err := FromYAML([]byte(testYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []int{topo.Links[0].Tunnel.VNI, topo.Links[1].Tunnel.VNI}
+	if diff := cmp.Diff([]int{3160770, 3160771}, got); diff != "" {
+		t.Errorf("VNIs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPopulateHostsVeth(t *testing.T) {
+	t.Parallel()
+	testYAML := `
+name: lab1
+hosts: {h1: {vtep: 192.0.2.1}, h2: {vtep: 192.0.2.2}}
+nodes:
+  R1: {image: "quay.io/frrouting/frr:master"}
+  R2: {image: "quay.io/frrouting/frr:master"}
+links:
+  - endpoints: [R1, R2]
+    link_type: veth
+`
+	errMsg := "veth link [R1 R2] connects nodes on different hosts [h1 h2]"
+	if _, err := FromYAML([]byte(testYAML)); err == nil || err.Error() != errMsg {
+		t.Errorf("error: want %q, got %v", errMsg, err)
+	}
+}
@@ -1,6 +1,13 @@
 package topology
 
 import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/elupevg/golab/ipam"
 	"github.com/elupevg/golab/vendors"
 )
 
@@ -19,42 +26,452 @@ const (
 	None   ConfigMode = ""
 	Manual ConfigMode = "manual"
 	Auto   ConfigMode = "auto"
+	Push   ConfigMode = "push"
 )
 
 type Topology struct {
-	Name       string           `yaml:"name"`
-	Nodes      map[string]*Node `yaml:"nodes"`
-	Links      []*Link          `yaml:"links"`
-	ConfigMode ConfigMode       `yaml:"config_mode"`
-	IPMode     IPMode           `yaml:"ip_mode"`
+	Name            string              `yaml:"name" json:"name"`
+	Include         []string            `yaml:"include" json:"include,omitempty"`
+	Vars            map[string]any      `yaml:"vars" json:"vars,omitempty"`
+	Nodes           map[string]*Node    `yaml:"nodes" json:"nodes"`
+	Links           []*Link             `yaml:"links" json:"links"`
+	ConfigMode      ConfigMode          `yaml:"config_mode" json:"config_mode,omitempty"`
+	TemplateDir     string              `yaml:"template_dir" json:"template_dir,omitempty"`
+	IPMode          IPMode              `yaml:"ip_mode" json:"ip_mode,omitempty"`
+	IPAM            ipam.Strategy       `yaml:"ipam" json:"ipam,omitempty"`
+	LinkPool        string              `yaml:"link_pool" json:"link_pool,omitempty"`
+	LinkPrefixLen   int                 `yaml:"link_prefix_len" json:"link_prefix_len,omitempty"`
+	IPExclude       []string            `yaml:"ip_exclude" json:"ip_exclude,omitempty"`
+	AllowPrivileged bool                `yaml:"allow_privileged" json:"allow_privileged,omitempty"`
+	ASNStartFrom    uint32              `yaml:"asn_start_from" json:"asn_start_from,omitempty"`
+	Labels          map[string]string   `yaml:"labels" json:"labels,omitempty"`
+	Secrets         map[string]string   `yaml:"secrets" json:"secrets,omitempty"`
+	Syslog          *Syslog             `yaml:"syslog" json:"syslog,omitempty"`
+	DNS             *DNS                `yaml:"dns" json:"dns,omitempty"`
+	SSH             *SSH                `yaml:"ssh" json:"ssh,omitempty"`
+	Push            *ConfigPush         `yaml:"push" json:"push,omitempty"`
+	Profiles        map[string]*Profile `yaml:"profiles" json:"profiles,omitempty"`
+	Defaults        *Profile            `yaml:"defaults" json:"defaults,omitempty"`
+	Templates       map[string]*Node    `yaml:"templates" json:"templates,omitempty"`
+	Groups          map[string]*Group   `yaml:"groups" json:"groups,omitempty"`
+	Management      *Management         `yaml:"mgmt" json:"management,omitempty"`
+	Hosts           map[string]*Host    `yaml:"hosts" json:"hosts,omitempty"`
+	VXLAN           *VXLAN              `yaml:"vxlan" json:"vxlan,omitempty"`
+	Mgmt            *Link               `yaml:"-" json:"mgmt,omitempty"`
+	Services        []*Node             `json:"services,omitempty"`
+	Snapshot        string              `yaml:"snapshot" json:"snapshot,omitempty"`
+	secrets         map[string]string
+}
+
+// SnapshotImage returns the reference of the image a snapshot of the lab with the tag saves the node as.
+// Image repositories are lowercase.
+func SnapshotImage(lab, node, tag string) string {
+	return strings.ToLower("golab-snapshot/"+lab+"/"+node) + ":" + tag
+}
+
+// Profile represents a named bundle of node settings that nodes inherit from.
+type Profile struct {
+	Image      string            `yaml:"image" json:"image,omitempty"`
+	Kind       vendors.Vendor    `yaml:"kind" json:"kind,omitempty"`
+	Binds      []string          `yaml:"binds" json:"binds,omitempty"`
+	Protocols  map[string]bool   `yaml:"protocols" json:"protocols,omitempty"`
+	Sysctls    map[string]string `yaml:"sysctls" json:"sysctls,omitempty"`
+	Env        map[string]string `yaml:"env" json:"env,omitempty"`
+	CPUs       float64           `yaml:"cpus" json:"cpus,omitempty"`
+	Memory     string            `yaml:"memory" json:"memory,omitempty"`
+	Cmd        []string          `yaml:"cmd" json:"cmd,omitempty"`
+	Entrypoint []string          `yaml:"entrypoint" json:"entrypoint,omitempty"`
+}
+
+// Group represents a node definition stamped out into Count replicas named after the group,
+// e.g. leaf1..leaf4. Replicas are addressed like nodes R<Index>..R<Index+Count-1>.
+type Group struct {
+	Count   int    `yaml:"count" json:"count"`
+	Index   int    `yaml:"index" json:"index,omitempty"`
+	ASNStep uint32 `yaml:"asn_step" json:"asn_step,omitempty"`
+	Node    *Node  `yaml:"node" json:"node,omitempty"`
+}
+
+// Management represents a management network reachable from the host, attached to eth0 of every node.
+type Management struct {
+	IPv4Subnet string `yaml:"ipv4_subnet" json:"ipv4_subnet,omitempty"`
+}
+
+// Host represents a Docker host a lab spread over several hosts places nodes on.
+type Host struct {
+	// Engine is the address of the Docker engine of the host, e.g. ssh://user@server, the selected engine if empty.
+	Engine string `yaml:"engine" json:"engine,omitempty"`
+	// VTEP is the address other hosts reach the VXLAN tunnels of the host at.
+	VTEP string `yaml:"vtep" json:"vtep"`
+}
+
+// VXLAN represents the tunnels stitching links between nodes on different hosts, which are set up
+// by short-lived containers of the image running in the network namespace of each host.
+type VXLAN struct {
+	Image string `yaml:"image" json:"image,omitempty"`
+	Port  int    `yaml:"port" json:"port,omitempty"`
+}
+
+// Tunnel represents the VXLAN tunnel joining the networks of a link on several hosts into a single segment.
+type Tunnel struct {
+	VNI   int    `json:"vni"`
+	Port  int    `json:"port"`
+	Image string `json:"image"`
+}
+
+// DNS represents name resolution of lab nodes via the management network.
+type DNS struct {
+	Domain string `yaml:"domain" json:"domain,omitempty"`
+}
+
+// SSH represents SSH access to lab nodes via sidecar containers.
+type SSH struct {
+	Image     string `yaml:"image" json:"image,omitempty"`
+	User      string `yaml:"user" json:"user,omitempty"`
+	PublicKey string `yaml:"public_key" json:"public_key,omitempty"`
+	Port      int    `yaml:"port" json:"port,omitempty"`
+}
+
+// ConfigPush represents delivery of generated configs to booted nodes over the management network.
+type ConfigPush struct {
+	Protocol       string `yaml:"protocol" json:"protocol,omitempty"`
+	Port           int    `yaml:"port" json:"port,omitempty"`
+	Username       string `yaml:"username" json:"username,omitempty"`
+	PasswordSecret string `yaml:"password_secret" json:"password_secret,omitempty"`
+}
+
+// Syslog represents a syslog collector provisioned on the management network.
+type Syslog struct {
+	Image string `yaml:"image" json:"image,omitempty"`
 }
 
 type Node struct {
-	Name          string
-	Image         string   `yaml:"image"`
-	Binds         []string `yaml:"binds"`
-	Vendor        vendors.Vendor
-	Interfaces    []*Interface
-	IPv4Loopbacks []string `yaml:"ipv4_loopbacks"`
-	IPv6Loopbacks []string `yaml:"ipv6_loopbacks"`
-	Protocols     map[string]bool
-	Sysctls       map[string]string
-	ASN           *uint32
+	Name          string            `json:"name"`
+	Index         int               `yaml:"-" json:"index,omitempty"`
+	Image         string            `yaml:"image" json:"image,omitempty"`
+	Profile       string            `yaml:"profile" json:"profile,omitempty"`
+	BasedOn       string            `yaml:"based_on" json:"based_on,omitempty"`
+	Kind          vendors.Vendor    `yaml:"kind" json:"kind,omitempty"`
+	Binds         []string          `yaml:"binds" json:"binds,omitempty"`
+	Volumes       []string          `yaml:"volumes" json:"volumes,omitempty"`
+	Tmpfs         []string          `yaml:"tmpfs" json:"tmpfs,omitempty"`
+	Vendor        vendors.Vendor    `json:"vendor,omitempty"`
+	Interfaces    []*Interface      `json:"interfaces,omitempty"`
+	IPv4Loopbacks []string          `yaml:"ipv4_loopbacks" json:"ipv4_loopbacks,omitempty"`
+	IPv6Loopbacks []string          `yaml:"ipv6_loopbacks" json:"ipv6_loopbacks,omitempty"`
+	Protocols     map[string]bool   `json:"protocols,omitempty"`
+	Sysctls       map[string]string `json:"sysctls,omitempty"`
+	ASN           *uint32           `json:"asn,omitempty"`
+	RouterID      string            `yaml:"-" json:"router_id,omitempty"`
+	Privileged    bool              `yaml:"privileged" json:"privileged,omitempty"`
+	CPUs          float64           `yaml:"cpus" json:"cpus,omitempty"`
+	Memory        string            `yaml:"memory" json:"memory,omitempty"`
+	Cmd           []string          `yaml:"cmd" json:"cmd,omitempty"`
+	Entrypoint    []string          `yaml:"entrypoint" json:"entrypoint,omitempty"`
+	Gateway       string            `yaml:"gateway" json:"gateway,omitempty"`
+	DependsOn     []string          `yaml:"depends_on" json:"depends_on,omitempty"`
+	BootDelay     string            `yaml:"boot_delay" json:"boot_delay,omitempty"`
+	// ReadyCommand defaults to the one of the vendor, while a zero ReadyTimeout disables waiting for readiness.
+	ReadyCommand []string `yaml:"ready_command" json:"ready_command,omitempty"`
+	ReadyTimeout string   `yaml:"ready_timeout" json:"ready_timeout,omitempty"`
+	// MinUptime is how long a started container has to keep running before it counts as started, while
+	// StopTimeout is how long a stopped one may shut down gracefully before it is killed.
+	MinUptime   string   `yaml:"min_uptime" json:"min_uptime,omitempty"`
+	StopTimeout string   `yaml:"stop_timeout" json:"stop_timeout,omitempty"`
+	Restart     string   `yaml:"restart" json:"restart,omitempty"`
+	IPv4Gateway string   `yaml:"-" json:"ipv4_gateway,omitempty"`
+	IPv6Gateway string   `yaml:"-" json:"ipv6_gateway,omitempty"`
+	Ports       []string `yaml:"ports" json:"ports,omitempty"`
+	// CapAdd and CapDrop adjust the capabilities the vendor of an unprivileged node requires.
+	CapAdd       []string          `yaml:"cap_add" json:"cap_add,omitempty"`
+	CapDrop      []string          `yaml:"cap_drop" json:"cap_drop,omitempty"`
+	Capabilities []string          `json:"capabilities,omitempty"`
+	Devices      []string          `yaml:"-" json:"devices,omitempty"`
+	BGPNeighbors []*BGPNeighbor    `json:"bgp_neighbors,omitempty"`
+	Mgmt         *Interface        `json:"mgmt,omitempty"`
+	SyslogServer string            `json:"syslog_server,omitempty"`
+	DNSDomain    string            `json:"dns_domain,omitempty"`
+	Env          map[string]string `yaml:"env" json:"env,omitempty"`
+	NetworkMode  string            `yaml:"-" json:"network_mode,omitempty"`
+	PIDMode      string            `yaml:"-" json:"pid_mode,omitempty"`
+	Sidecars     []*Node           `yaml:"-" json:"sidecars,omitempty"`
+	Labels       map[string]string `yaml:"labels" json:"labels,omitempty"`
+	Position     *Position         `yaml:"position" json:"position,omitempty"`
+	// RouteServer makes BGP neighbors route server clients, while RPKI rejects invalid routes learned from them.
+	RouteServer bool      `yaml:"route_server" json:"route_server,omitempty"`
+	RPKI        *RPKI     `yaml:"rpki" json:"rpki,omitempty"`
+	OSPF        *NodeOSPF `yaml:"ospf" json:"ospf,omitempty"`
+	ISIS        *NodeISIS `yaml:"isis" json:"isis,omitempty"`
+	// RouteReflector replaces the iBGP full mesh of the AS of the node with sessions to route reflectors.
+	RouteReflector bool   `yaml:"route_reflector" json:"route_reflector,omitempty"`
+	Group          string `yaml:"group" json:"group,omitempty"`
+	// Host places the node on one of the hosts of the lab, while nodes without it are spread evenly.
+	Host     string `yaml:"host" json:"host,omitempty"`
+	Disabled bool   `yaml:"disabled" json:"-"`
+}
+
+// OSPF represents the OSPF settings of interfaces, which apply to both OSPFv2 and OSPFv3.
+// Cost is nil unless set, leaving the cost to the reference bandwidth.
+type OSPF struct {
+	Area    string `yaml:"area" json:"area,omitempty"`
+	Cost    *int   `yaml:"cost" json:"cost,omitempty"`
+	Passive bool   `yaml:"passive" json:"passive,omitempty"`
+}
+
+// NodeOSPF represents the OSPF settings of a node. Area is the one of its loopbacks and of interfaces on links
+// without one, while Interfaces override the settings of links for single interfaces, e.g. eth1 or ge-0/0/1.
+type NodeOSPF struct {
+	Area       string           `yaml:"area" json:"area,omitempty"`
+	Interfaces map[string]*OSPF `yaml:"interfaces" json:"interfaces,omitempty"`
+}
+
+// ISIS represents the IS-IS settings of interfaces. Metric is nil unless set, leaving the default metric.
+type ISIS struct {
+	Metric *int `yaml:"metric" json:"metric,omitempty"`
+}
+
+// NodeISIS represents the IS-IS settings of a node. The NET is derived from the area and the router ID unless
+// set explicitly, while Interfaces override the settings of links for single interfaces.
+type NodeISIS struct {
+	Area       string           `yaml:"area" json:"area,omitempty"`
+	NET        string           `yaml:"net" json:"net,omitempty"`
+	Level      string           `yaml:"level" json:"level,omitempty"`
+	Interfaces map[string]*ISIS `yaml:"interfaces" json:"interfaces,omitempty"`
 }
 
+// IS-IS levels a node routes at.
+const (
+	ISISLevel1  = "level-1"
+	ISISLevel2  = "level-2"
+	ISISLevel12 = "level-1-2"
+)
+
+// RPKI represents the RPKI-to-Router cache a node validates the origins of BGP routes with.
+type RPKI struct {
+	Server string `yaml:"server" json:"server"`
+	Port   int    `yaml:"port" json:"port"`
+}
+
+// Position represents the coordinates of a node on a topology diagram. Like the diagram group
+// of a node, it is not used by golab itself but is kept for tools drawing the topology.
+type Position struct {
+	X float64 `yaml:"x" json:"x"`
+	Y float64 `yaml:"y" json:"y"`
+}
+
+// TTY represents an interactive terminal attached to a node.
+type TTY struct {
+	In     io.Reader
+	Out    io.Writer
+	Height uint
+	Width  uint
+}
+
+// NodeStats represents resource usage of a running node.
+type NodeStats struct {
+	CPUPercent float64 `json:"cpu_percent"`
+	MemUsage   uint64  `json:"mem_usage"`
+	MemLimit   uint64  `json:"mem_limit"`
+	RxBytes    uint64  `json:"rx_bytes"`
+	TxBytes    uint64  `json:"tx_bytes"`
+	RxPackets  uint64  `json:"rx_packets"`
+	TxPackets  uint64  `json:"tx_packets"`
+	// Interfaces holds the counters of the node interfaces sorted by name, which add up to the totals above.
+	Interfaces []InterfaceStats `json:"interfaces,omitempty"`
+}
+
+// InterfaceStats represents traffic counters of a node interface.
+type InterfaceStats struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// BGPNeighbor represents a BGP peer derived from a shared link.
+type BGPNeighbor struct {
+	Addr string `json:"addr,omitempty"`
+	// Interface is the local interface of an unnumbered peer reached over its link-local address.
+	Interface string `json:"interface,omitempty"`
+	// LocalAddr is the local loopback address iBGP sessions are sourced from.
+	LocalAddr string `json:"local_addr,omitempty"`
+	ASN       uint32 `json:"asn"`
+	Password  string `json:"-"`
+	// RRClient marks iBGP peers the local route reflector reflects routes to.
+	RRClient bool `json:"rr_client,omitempty"`
+}
+
+// IPv6 tells whether the peer is reached over IPv6, i.e. belongs to the IPv6 unicast address family.
+// Unnumbered peers are reached over their IPv6 link-local addresses.
+func (b *BGPNeighbor) IPv6() bool {
+	return b.Interface != "" || strings.Contains(b.Addr, ":")
+}
+
+// Interface represents a node interface attached to a link. Subinterfaces carry
+// the traffic of their link tagged with the VLAN ID over the parent interface.
 type Interface struct {
-	Name       string
-	Link       string
-	IPv4Addr   string
-	IPv6Addr   string
-	DriverOpts map[string]string
+	Name       string            `json:"name"`
+	Link       string            `json:"link,omitempty"`
+	Parent     string            `json:"parent,omitempty"`
+	VLAN       int               `json:"vlan,omitempty"`
+	IPv4Addr   string            `json:"ipv4_addr,omitempty"`
+	IPv6Addr   string            `json:"ipv6_addr,omitempty"`
+	DriverOpts map[string]string `json:"driver_opts,omitempty"`
+	Aliases    []string          `json:"aliases,omitempty"`
+	LinkLocal  bool              `json:"link_local,omitempty"`
+	// Veth interfaces are ends of veth pairs created in the node rather than attachments to networks.
+	Veth bool `json:"veth,omitempty"`
+	// OSPF and ISIS hold the settings of the interface resolved from the ones of its node and link.
+	OSPF *OSPF `json:"ospf,omitempty"`
+	ISIS *ISIS `json:"isis,omitempty"`
 }
 
+// NoIP disables address allocation on a link, leaving addressing to the nodes.
+const NoIP = "none"
+
+// LinkLocal enables IPv6 on a link without allocating subnets, so that nodes talk over link-local addresses only.
+const LinkLocal = "link-local"
+
+// Drivers of Docker networks implementing links, bridge being the default.
+const (
+	DriverBridge  = "bridge"
+	DriverMacvlan = "macvlan"
+	DriverIPvlan  = "ipvlan"
+)
+
+// Types of links, which are Docker networks unless they are veth pairs wiring two nodes directly.
+const (
+	LinkTypeNetwork = "network"
+	LinkTypeVeth    = "veth"
+)
+
+// HostEndpoint is the pseudo node of endpoints bridging a link to a physical interface of the host, e.g. host:eth1.
+const HostEndpoint = "host"
+
 type Link struct {
-	Name        string   `yaml:"name"`
-	Endpoints   []string `yaml:"endpoints"`
-	IPv4Subnet  string   `yaml:"ipv4_subnet"`
-	IPv6Subnet  string   `yaml:"ipv6_subnet"`
-	IPv4Gateway string
-	IPv6Gateway string
+	Name        string   `yaml:"name" json:"name"`
+	Endpoints   []string `yaml:"endpoints" json:"endpoints"`
+	IPv4Subnet  string   `yaml:"ipv4_subnet" json:"ipv4_subnet,omitempty"`
+	IPv6Subnet  string   `yaml:"ipv6_subnet" json:"ipv6_subnet,omitempty"`
+	IP          string   `yaml:"ip" json:"ip,omitempty"`
+	MTU         int      `yaml:"mtu" json:"mtu,omitempty"`
+	Delay       string   `yaml:"delay" json:"delay,omitempty"`
+	Jitter      string   `yaml:"jitter" json:"jitter,omitempty"`
+	Loss        float64  `yaml:"loss" json:"loss,omitempty"`
+	Rate        string   `yaml:"rate" json:"rate,omitempty"`
+	Bandwidth   string   `yaml:"bandwidth" json:"bandwidth,omitempty"`
+	IPv4Gateway string   `json:"ipv4_gateway,omitempty"`
+	IPv6Gateway string   `json:"ipv6_gateway,omitempty"`
+	// Gateway overrides the automatic gateway of the address family it belongs to, while
+	// NoGateway leaves the link without gateways, e.g. when lab routers provide them instead.
+	Gateway     string `yaml:"gateway" json:"gateway,omitempty"`
+	NoGateway   bool   `yaml:"no_gateway" json:"no_gateway,omitempty"`
+	BGPPassword string `yaml:"bgp_password" json:"-"`
+	OSPF        *OSPF  `yaml:"ospf" json:"ospf,omitempty"`
+	ISIS        *ISIS  `yaml:"isis" json:"isis,omitempty"`
+	External    bool   `yaml:"-" json:"external,omitempty"`
+	// HostInterface is the physical interface of the host the link is bridged to with a host:INTERFACE endpoint.
+	HostInterface string `yaml:"-" json:"host_interface,omitempty"`
+	// Interfaces lists the interfaces of endpoints given as NODE:INTERFACE, e.g. R1:ge-0/0/1 or R1:eth1.100,
+	// in the order of the endpoints, with empty strings for the others. It is nil if no endpoint pins one.
+	Interfaces []string          `yaml:"-" json:"interfaces,omitempty"`
+	Labels     map[string]string `yaml:"labels" json:"labels,omitempty"`
+	// Driver selects the Docker network driver, which defaults to macvlan for links bridged to the host,
+	// while DriverOpts are passed to it verbatim, overriding the options set by golab.
+	Driver     string            `yaml:"driver" json:"driver,omitempty"`
+	DriverOpts map[string]string `yaml:"driver_opts" json:"driver_opts,omitempty"`
+	// EndpointOpts maps nodes to the options of their Docker endpoints on the link, e.g. sysctls,
+	// which override the options set by golab as well.
+	EndpointOpts map[string]map[string]string `yaml:"endpoint_opts" json:"endpoint_opts,omitempty"`
+	// Type selects veth pairs instead of networks, which keep Docker bridges from swallowing
+	// link-local control frames, e.g. of LACP, LLDP or MACsec.
+	Type string `yaml:"link_type" json:"link_type,omitempty"`
+	// Hosts lists the hosts of the nodes attached to the link, which are joined by the tunnel if there are several.
+	Hosts    []string `yaml:"-" json:"hosts,omitempty"`
+	Tunnel   *Tunnel  `yaml:"-" json:"tunnel,omitempty"`
+	Disabled bool     `yaml:"disabled" json:"-"`
+}
+
+// Veth tells whether the link is a veth pair rather than a network.
+func (l *Link) Veth() bool {
+	return l.Type == LinkTypeVeth
+}
+
+// Tagged tells whether the endpoints of the link are subinterfaces, whose tagged frames travel over
+// the trunk link of their parent interfaces rather than over a network of their own.
+func (l *Link) Tagged() bool {
+	return slices.ContainsFunc(l.Interfaces, func(name string) bool {
+		_, _, tagged := splitVLAN(name)
+		return tagged
+	})
+}
+
+// pinned returns the interface the i-th endpoint of the link is pinned to, or an empty string.
+func (l *Link) pinned(i int) string {
+	if i < len(l.Interfaces) {
+		return l.Interfaces[i]
+	}
+	return ""
+}
+
+// VethOnly tells whether the node is wired with veth pairs and subinterfaces only, i.e. it is attached
+// to links none of which is a network, hence it does not get a network interface from the provider.
+func (n *Node) VethOnly() bool {
+	return n.Mgmt == nil && len(n.Interfaces) != 0 && !slices.ContainsFunc(n.Interfaces, func(iface *Interface) bool {
+		return !iface.Veth && iface.VLAN == 0
+	})
+}
+
+// VM tells whether the node is a virtual machine booted from its qcow2 image rather than a container.
+func (n *Node) VM() bool {
+	return strings.HasSuffix(n.Image, ".qcow2")
+}
+
+// Secret returns the resolved value of a secret declared in the secrets section.
+func (t *Topology) Secret(name string) (string, error) {
+	value, ok := t.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q is not defined", name)
+	}
+	return value, nil
+}
+
+// BootOrder returns the nodes in the order they have to be started, i.e. every node follows the nodes
+// it depends on, while independent nodes are ordered by name.
+func (t *Topology) BootOrder() []*Node {
+	// dependency cycles are rejected by validation
+	names, _ := t.bootOrder()
+	nodes := make([]*Node, 0, len(names))
+	for _, name := range names {
+		nodes = append(nodes, t.Nodes[name])
+	}
+	return nodes
+}
+
+// bootOrder sorts node names by their dependencies, failing on dependency cycles.
+func (t *Topology) bootOrder() ([]string, error) {
+	names := slices.Sorted(maps.Keys(t.Nodes))
+	booted := make(map[string]bool, len(names))
+	order := make([]string, 0, len(names))
+	for len(order) < len(names) {
+		progress := false
+		for _, name := range names {
+			if booted[name] || slices.ContainsFunc(t.Nodes[name].DependsOn, func(dep string) bool { return !booted[dep] }) {
+				continue
+			}
+			booted[name] = true
+			order = append(order, name)
+			progress = true
+		}
+		if !progress {
+			cycle := slices.DeleteFunc(slices.Clone(names), func(name string) bool { return booted[name] })
+			return nil, fmt.Errorf("nodes %v cannot be started due to circular dependencies", cycle)
+		}
+	}
+	return order, nil
 }
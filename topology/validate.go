@@ -1,13 +1,23 @@
 package topology
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"net/netip"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"github.com/elupevg/golab/ipam"
+	"github.com/elupevg/golab/vendors"
 )
 
 var supportedProtocols = map[string]bool{
@@ -18,16 +28,64 @@ var supportedProtocols = map[string]bool{
 	"ldp":   true,
 }
 
+// capabilityPattern matches Linux capabilities as named by Docker, i.e. without the CAP_ prefix, or ALL.
+var capabilityPattern = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+// privilegedCapabilities amount to privileged mode, hence adding them is subject to allow_privileged as well.
+// SYS_ADMIN is not among them: FRR and cRPD get it by default to manage VRFs and network namespaces, and it
+// leaves the devices, seccomp and AppArmor profiles of the container in place, unlike privileged mode.
+var privilegedCapabilities = []string{"ALL", "SYS_MODULE"}
+
+// isisAreaPattern matches IS-IS area addresses, i.e. an AFI followed by groups of four hex digits, e.g. 49.0001,
+// while isisNETPattern matches network entity titles, i.e. an area address followed by a system ID and a zero
+// selector, e.g. 49.0001.1921.6800.0001.00.
+var (
+	isisAreaPattern = regexp.MustCompile(`^[0-9a-fA-F]{2}(\.[0-9a-fA-F]{4}){1,6}$`)
+	isisNETPattern  = regexp.MustCompile(`^[0-9a-fA-F]{2}(\.[0-9a-fA-F]{4}){4,9}\.00$`)
+)
+
+// labNamePattern restricts topology names to the characters allowed in names of Docker objects, which they prefix.
+var labNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// snapshotPattern matches tags of Docker images, which snapshots are named after.
+var snapshotPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+
 func (t *Topology) validate() error {
 	if t.Name == "" {
 		return errors.New("topology does not have a name")
 	}
+	if !labNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("topology name %q has to consist of letters, digits, dots, dashes and underscores", t.Name)
+	}
+	if t.Snapshot != "" && !snapshotPattern.MatchString(t.Snapshot) {
+		return fmt.Errorf("snapshot %q is not a valid image tag, e.g. 20250102-150405 expected", t.Snapshot)
+	}
 	if !t.IPMode.isValid() {
 		return fmt.Errorf("invalid ip_mode %q, supported: ipv4/ipv6/dual", t.IPMode)
 	}
+	if !t.IPAM.IsValid() {
+		return fmt.Errorf("invalid ipam %q, supported: index/sequential/hash", t.IPAM)
+	}
+	for _, r := range t.IPExclude {
+		if _, err := ipam.ParseRanges([]string{r}); err != nil {
+			return fmt.Errorf("invalid ip_exclude range %q, e.g. 10.0.0.0/16 or 10.0.0.1 expected", r)
+		}
+	}
 	if !t.ConfigMode.isValid() {
 		return fmt.Errorf("topology %q has invalid config mode %q", t.Name, t.ConfigMode)
 	}
+	if err := t.validatePush(); err != nil {
+		return err
+	}
+	if err := t.validateManagement(); err != nil {
+		return err
+	}
+	if err := validateLabels(fmt.Sprintf("topology %q", t.Name), t.Labels); err != nil {
+		return err
+	}
+	if t.ASNStartFrom != 0 && privateASNRangeEnd(t.ASNStartFrom) == 0 {
+		return fmt.Errorf("asn_start_from %d is not a private ASN, supported: 64512-65534, 4200000000-4294967294", t.ASNStartFrom)
+	}
 	if len(t.Nodes) == 0 {
 		return fmt.Errorf("topology %q has no nodes", t.Name)
 	}
@@ -38,6 +96,14 @@ func (t *Topology) validate() error {
 		if err := node.validate(name, t.IPMode); err != nil {
 			return err
 		}
+		if node.Privileged && !t.AllowPrivileged {
+			return fmt.Errorf("node %q requests privileged mode but topology %q does not set allow_privileged", name, t.Name)
+		}
+		for _, c := range node.CapAdd {
+			if slices.Contains(privilegedCapabilities, c) && !t.AllowPrivileged {
+				return fmt.Errorf("node %q adds capability %s but topology %q does not set allow_privileged", name, c, t.Name)
+			}
+		}
 		nodeNames = append(nodeNames, name)
 	}
 	for _, link := range t.Links {
@@ -45,6 +111,196 @@ func (t *Topology) validate() error {
 			return err
 		}
 	}
+	if err := t.validateHosts(); err != nil {
+		return err
+	}
+	if err := t.validatePorts(); err != nil {
+		return err
+	}
+	if err := t.validateDependencies(); err != nil {
+		return err
+	}
+	if err := t.validateLinkPool(); err != nil {
+		return err
+	}
+	return t.validateSubnets()
+}
+
+// validateHosts checks the hosts of a lab spread over several hosts and the placement of its nodes on them.
+func (t *Topology) validateHosts() error {
+	for _, name := range slices.Sorted(maps.Keys(t.Hosts)) {
+		if !labNamePattern.MatchString(name) {
+			return fmt.Errorf("host name %q has to consist of letters, digits, dots, dashes and underscores", name)
+		}
+		host := t.Hosts[name]
+		if host == nil || host.VTEP == "" {
+			return fmt.Errorf("host %q does not have a vtep address", name)
+		}
+		if _, err := netip.ParseAddr(host.VTEP); err != nil {
+			return fmt.Errorf("host %q has invalid vtep address %q, e.g. 192.0.2.1 expected", name, host.VTEP)
+		}
+	}
+	if t.VXLAN != nil && (t.VXLAN.Port < 0 || t.VXLAN.Port > 65535) {
+		return fmt.Errorf("vxlan port %d is out of range 1-65535", t.VXLAN.Port)
+	}
+	if len(t.Hosts) > 1 && (t.Syslog != nil || t.DNS != nil) {
+		return errors.New("lab services syslog and dns require a single host")
+	}
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if node.Host != "" && t.Hosts[node.Host] == nil {
+			return fmt.Errorf("node %q is placed on undefined host %q", name, node.Host)
+		}
+		if len(t.Hosts) != 0 && node.VM() {
+			return fmt.Errorf("node %q is a virtual machine, which labs spread over several hosts do not support", name)
+		}
+	}
+	return nil
+}
+
+// validateDependencies checks that nodes depend on other existing nodes without cycles.
+func (t *Topology) validateDependencies() error {
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		for _, dep := range t.Nodes[name].DependsOn {
+			if _, ok := t.Nodes[dep]; !ok || dep == name {
+				return fmt.Errorf("node %q has invalid dependency %q", name, dep)
+			}
+		}
+	}
+	_, err := t.bootOrder()
+	return err
+}
+
+// validateSubnets makes sure that link subnets neither overlap each other nor contain node loopbacks,
+// mistakes Docker would otherwise only report as IPAM errors at build time. Empty subnets and
+// loopbacks are skipped, so that the check can run both before and after they are calculated.
+func (t *Topology) validateSubnets() error {
+	type linkSubnet struct {
+		prefix netip.Prefix
+		link   *Link
+	}
+	var subnets []linkSubnet
+	for _, link := range t.Links {
+		for _, subnet := range []string{link.IPv4Subnet, link.IPv6Subnet} {
+			if subnet == "" {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(subnet)
+			if err != nil {
+				return err
+			}
+			for _, other := range subnets {
+				if other.prefix.Overlaps(prefix) {
+					return fmt.Errorf("subnet %s of link %v overlaps subnet %s of link %v", prefix, link.Endpoints, other.prefix, other.link.Endpoints)
+				}
+			}
+			subnets = append(subnets, linkSubnet{prefix: prefix.Masked(), link: link})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if node == nil {
+			continue
+		}
+		for _, loopback := range slices.Concat(node.IPv4Loopbacks, node.IPv6Loopbacks) {
+			prefix, err := netip.ParsePrefix(loopback)
+			if err != nil {
+				return err
+			}
+			for _, subnet := range subnets {
+				if subnet.prefix.Contains(prefix.Addr()) {
+					return fmt.Errorf("loopback %s of node %q collides with subnet %s of link %v", loopback, name, subnet.prefix, subnet.link.Endpoints)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validatePorts rejects published ports of nodes attached to internal networks only, which Docker does
+// not publish ports from. Nodes without links stay on the default bridge unless lab services attach them
+// to the management network, which is internal unless the mgmt section is set.
+func (t *Topology) validatePorts() error {
+	if t.Management != nil {
+		return nil
+	}
+	services := t.Syslog != nil || t.DNS != nil || t.SSH != nil
+	for _, name := range slices.Sorted(maps.Keys(t.Nodes)) {
+		node := t.Nodes[name]
+		if node == nil || len(node.Ports) == 0 {
+			continue
+		}
+		attached, external := services, false
+		for _, link := range t.Links {
+			if link != nil && slices.Contains(link.Endpoints, name) {
+				attached = true
+				external = external || link.External
+			}
+		}
+		if attached && !external {
+			return fmt.Errorf("node %q publishes ports but is attached to internal networks only, which requires mgmt", name)
+		}
+	}
+	return nil
+}
+
+// validatePush checks that config push mode comes with complete push settings.
+func (t *Topology) validatePush() error {
+	if t.ConfigMode != Push {
+		return nil
+	}
+	if t.Push == nil {
+		return fmt.Errorf("config mode %q requires the push section", t.ConfigMode)
+	}
+	if t.Push.Protocol != "" && t.Push.Protocol != "netconf" {
+		return fmt.Errorf("push protocol %q is not supported, supported: netconf", t.Push.Protocol)
+	}
+	if t.Push.Username == "" {
+		return errors.New("push section does not have a username")
+	}
+	if _, ok := t.Secrets[t.Push.PasswordSecret]; !ok {
+		return fmt.Errorf("push password secret %q is not defined", t.Push.PasswordSecret)
+	}
+	return nil
+}
+
+// validateManagement checks that the management subnet fits all nodes and lab services,
+// which are addressed from its upper half.
+func (t *Topology) validateManagement() error {
+	if t.Management == nil || t.Management.IPv4Subnet == "" {
+		return nil
+	}
+	prefix, err := netip.ParsePrefix(t.Management.IPv4Subnet)
+	if err != nil || !prefix.Addr().Is4() || prefix.Bits() > 23 {
+		return fmt.Errorf("mgmt ipv4_subnet %q is not an IPv4 subnet of /23 or larger", t.Management.IPv4Subnet)
+	}
+	return nil
+}
+
+// validateLinkPool checks that the link pool matches the IP mode and that its subnets can address every link they are carved for.
+func (t *Topology) validateLinkPool() error {
+	if t.LinkPool == "" {
+		if t.LinkPrefixLen != 0 {
+			return errors.New("link_prefix_len requires link_pool")
+		}
+		return nil
+	}
+	pool, err := ipam.NewPool(t.LinkPool, t.LinkPrefixLen, nil)
+	if err != nil {
+		return err
+	}
+	if (pool.IPVersion() == 4 && t.IPMode == IPv6) || (pool.IPVersion() == 6 && t.IPMode == IPv4) {
+		return fmt.Errorf("ip_mode %q is incompatible with link_pool %q", t.IPMode, t.LinkPool)
+	}
+	for _, link := range t.Links {
+		if link.IP != "" || link.HostInterface != "" || link.subnet(pool.IPVersion()) != "" {
+			continue
+		}
+		// the last usable address of every subnet is taken by the gateway
+		if len(link.Endpoints) >= pool.Hosts() {
+			return fmt.Errorf("link %v has more endpoints than subnets of link_pool %s can address", link.Endpoints, t.LinkPool)
+		}
+	}
 	return nil
 }
 
@@ -53,17 +309,30 @@ func (n *Node) validate(name string, ipMode IPMode) error {
 	if n == nil {
 		return fmt.Errorf("node %q does not have an image specified", name)
 	}
-	if !isValidNodeName(name) {
+	if n.Index == 0 && !isValidNodeName(name) {
 		return fmt.Errorf("node name %q is not in the [R1-R253] range", name)
 	}
 	if n.Image == "" {
 		return fmt.Errorf("node %q does not have an image specified", name)
 	}
+	if n.Kind != vendors.UNKNOWN && !slices.Contains(vendors.Supported(), n.Kind) {
+		return fmt.Errorf("node %q has unsupported kind %q, supported: %s", name, n.Kind, joinVendors(vendors.Supported()))
+	}
 	for _, bind := range n.Binds {
 		if err := validateBind(bind); err != nil {
 			return err
 		}
 	}
+	for _, volume := range n.Volumes {
+		if err := validateVolume(volume); err != nil {
+			return err
+		}
+	}
+	for _, target := range n.Tmpfs {
+		if !filepath.IsAbs(target) {
+			return fmt.Errorf("tmpfs mount %q has non-absolute destination path", target)
+		}
+	}
 	if ipMode == IPv4 && len(n.IPv6Loopbacks) != 0 {
 		return fmt.Errorf("ip_mode %q is incompatible with loopbacks %v", ipMode, n.IPv6Loopbacks)
 	}
@@ -80,17 +349,183 @@ func (n *Node) validate(name string, ipMode IPMode) error {
 			return fmt.Errorf("%q is not a valid IPv6 address", loop)
 		}
 	}
-	for proto := range n.Protocols {
+	if _, _, err := nat.ParsePortSpecs(n.Ports); err != nil {
+		return fmt.Errorf("node %q has invalid ports: %w", name, err)
+	}
+	for key := range n.Env {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			return fmt.Errorf("node %q has invalid environment variable name %q", name, key)
+		}
+	}
+	for proto, enabled := range n.Protocols {
 		if !supportedProtocols[proto] {
 			return fmt.Errorf("node %q has unsupported protocol %q", name, proto)
 		}
+		if !enabled {
+			continue
+		}
+		if (ipMode == IPv6 && (proto == "ospf" || proto == "ldp")) || (ipMode == IPv4 && proto == "ospf6") {
+			return fmt.Errorf("node %q protocol %q is incompatible with ip_mode %q", name, proto, ipMode)
+		}
+	}
+	if n.CPUs < 0 {
+		return fmt.Errorf("node %q has invalid cpus %v", name, n.CPUs)
+	}
+	if n.Memory != "" {
+		if memory, err := units.RAMInBytes(n.Memory); err != nil || memory <= 0 {
+			return fmt.Errorf("node %q has invalid memory %q, e.g. 512m or 2g expected", name, n.Memory)
+		}
+	}
+	if (n.Kind == vendors.HOST || n.Kind == vendors.LINUX) && slices.Contains(slices.Collect(maps.Values(n.Protocols)), true) {
+		return fmt.Errorf("node %q of kind %q cannot run routing protocols", name, n.Kind)
+	}
+	if n.Gateway != "" && n.Kind != vendors.HOST && n.Kind != vendors.LINUX {
+		return fmt.Errorf("node %q sets gateway but is not of kind %q or %q", name, vendors.HOST, vendors.LINUX)
+	}
+	if (n.RouteServer || n.RPKI != nil) && !n.Protocols["bgp"] {
+		return fmt.Errorf("node %q sets route_server or rpki but does not run protocol %q", name, "bgp")
+	}
+	if n.OSPF != nil {
+		if !n.Protocols["ospf"] && !n.Protocols["ospf6"] {
+			return fmt.Errorf("node %q sets ospf but does not run protocol %q or %q", name, "ospf", "ospf6")
+		}
+		if err := validateOSPF(fmt.Sprintf("node %q", name), &OSPF{Area: n.OSPF.Area}); err != nil {
+			return err
+		}
+		for iface, settings := range n.OSPF.Interfaces {
+			if err := validateOSPF(fmt.Sprintf("node %q interface %s", name, iface), settings); err != nil {
+				return err
+			}
+		}
+	}
+	if err := n.validateISIS(name); err != nil {
+		return err
+	}
+	if n.RouteReflector && !n.Protocols["bgp"] {
+		return fmt.Errorf("node %q sets route_reflector but does not run protocol %q", name, "bgp")
+	}
+	if n.RPKI != nil {
+		if _, err := netip.ParseAddr(n.RPKI.Server); err != nil {
+			return fmt.Errorf("node %q has invalid rpki server address %q, e.g. 192.0.2.1 expected", name, n.RPKI.Server)
+		}
+		if n.RPKI.Port < 0 || n.RPKI.Port > 65535 {
+			return fmt.Errorf("node %q rpki port %d is out of range 1-65535", name, n.RPKI.Port)
+		}
+	}
+	if n.BootDelay != "" {
+		if delay, err := time.ParseDuration(n.BootDelay); err != nil || delay < 0 {
+			return fmt.Errorf("node %q has invalid boot_delay %q, e.g. 30s expected", name, n.BootDelay)
+		}
+	}
+	if n.ReadyTimeout != "" {
+		if timeout, err := time.ParseDuration(n.ReadyTimeout); err != nil || timeout < 0 {
+			return fmt.Errorf("node %q has invalid ready_timeout %q, e.g. 2m expected", name, n.ReadyTimeout)
+		}
+	}
+	if n.MinUptime != "" {
+		if uptime, err := time.ParseDuration(n.MinUptime); err != nil || uptime < 0 {
+			return fmt.Errorf("node %q has invalid min_uptime %q, e.g. 5s expected", name, n.MinUptime)
+		}
+	}
+	if n.StopTimeout != "" {
+		if timeout, err := time.ParseDuration(n.StopTimeout); err != nil || timeout < 0 {
+			return fmt.Errorf("node %q has invalid stop_timeout %q, e.g. 30s expected", name, n.StopTimeout)
+		}
+	}
+	switch n.Restart {
+	case "", "no", "on-failure", "unless-stopped":
+	default:
+		return fmt.Errorf("node %q has invalid restart %q, supported: no/on-failure/unless-stopped", name, n.Restart)
+	}
+	if n.Privileged && len(n.CapAdd)+len(n.CapDrop) != 0 {
+		return fmt.Errorf("node %q sets cap_add or cap_drop along with privileged", name)
+	}
+	for _, c := range slices.Concat(n.CapAdd, n.CapDrop) {
+		if !capabilityPattern.MatchString(c) {
+			return fmt.Errorf("node %q has invalid capability %q, e.g. NET_ADMIN expected", name, c)
+		}
 	}
 	if n.ASN != nil && *(n.ASN) == 0 {
 		return fmt.Errorf("node %q has unvalid ASN %d", name, *(n.ASN))
 	}
+	return validateLabels(fmt.Sprintf("node %q", name), n.Labels)
+}
+
+// validateLabels checks that user-defined labels do not interfere with the ones set by golab.
+func validateLabels(owner string, labels map[string]string) error {
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if strings.HasPrefix(key, "golab.") {
+			return fmt.Errorf("%s has invalid label %q, the golab. prefix is reserved", owner, key)
+		}
+	}
+	return nil
+}
+
+// validateOSPF checks the OSPF settings of the owner, e.g. a link.
+func validateOSPF(owner string, ospf *OSPF) error {
+	if ospf == nil {
+		return nil
+	}
+	// area IDs are 32-bit numbers written either in the dotted or the decimal notation, e.g. 0.0.0.1 or 1
+	if ospf.Area != "" {
+		_, err := strconv.ParseUint(ospf.Area, 10, 32)
+		if addr, addrErr := netip.ParseAddr(ospf.Area); err != nil && (addrErr != nil || !addr.Is4()) {
+			return fmt.Errorf("%s has invalid ospf area %q, e.g. 0.0.0.1 or 1 expected", owner, ospf.Area)
+		}
+	}
+	if ospf.Cost != nil && (*ospf.Cost < 1 || *ospf.Cost > 65535) {
+		return fmt.Errorf("%s has invalid ospf cost %d, supported: 1-65535", owner, *ospf.Cost)
+	}
+	return nil
+}
+
+// validateISIS checks the IS-IS settings of the node.
+func (n *Node) validateISIS(name string) error {
+	if n.ISIS == nil {
+		return nil
+	}
+	if !n.Protocols["isis"] {
+		return fmt.Errorf("node %q sets isis but does not run protocol %q", name, "isis")
+	}
+	if n.ISIS.Area != "" && n.ISIS.NET != "" {
+		return fmt.Errorf("node %q sets both isis area and net, which contains the area", name)
+	}
+	if n.ISIS.Area != "" && !isisAreaPattern.MatchString(n.ISIS.Area) {
+		return fmt.Errorf("node %q has invalid isis area %q, e.g. 49.0001 expected", name, n.ISIS.Area)
+	}
+	if n.ISIS.NET != "" && !isisNETPattern.MatchString(n.ISIS.NET) {
+		return fmt.Errorf("node %q has invalid isis net %q, e.g. 49.0001.1921.6800.0001.00 expected", name, n.ISIS.NET)
+	}
+	switch n.ISIS.Level {
+	case "", ISISLevel1, ISISLevel2, ISISLevel12:
+	default:
+		return fmt.Errorf("node %q has invalid isis level %q, supported: %s, %s, %s", name, n.ISIS.Level, ISISLevel1, ISISLevel2, ISISLevel12)
+	}
+	for iface, settings := range n.ISIS.Interfaces {
+		if err := validateISIS(fmt.Sprintf("node %q interface %s", name, iface), settings); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// validateISIS checks the IS-IS settings of the owner, e.g. a link. Metrics are wide, i.e. 24-bit.
+func validateISIS(owner string, isis *ISIS) error {
+	if isis != nil && isis.Metric != nil && (*isis.Metric < 1 || *isis.Metric > 1<<24-1) {
+		return fmt.Errorf("%s has invalid isis metric %d, supported: 1-16777215", owner, *isis.Metric)
+	}
+	return nil
+}
+
+// joinVendors formats vendors as a comma-separated list.
+func joinVendors(vs []vendors.Vendor) string {
+	names := make([]string, 0, len(vs))
+	for _, v := range vs {
+		names = append(names, string(v))
+	}
+	return strings.Join(names, ", ")
+}
+
 // isValidNodeName checks if the provided node name is compliant with the schema.
 // Legal node names lie in the range R1..R253. This naming convention is enforced
 // because node number is used in automated IP allocation. Number 254 is reserved
@@ -104,7 +539,7 @@ func isValidNodeName(name string) bool {
 	if err != nil {
 		return false
 	}
-	return num > 0 && num < 254
+	return num > 0 && num <= maxNodeIndex
 }
 
 // isValidCIDR tells if the provided string is a valid IP address in CIDR notation.
@@ -133,15 +568,50 @@ func validateBind(bind string) error {
 	return nil
 }
 
+// volumePattern matches names of Docker volumes.
+var volumePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+func validateVolume(volume string) error {
+	parts := strings.Split(volume, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("volume mount %q has invalid format", volume)
+	}
+	if !volumePattern.MatchString(parts[0]) {
+		return fmt.Errorf("volume mount %q has invalid volume name", volume)
+	}
+	if !filepath.IsAbs(parts[1]) {
+		return fmt.Errorf("volume mount %q has non-absolute destination path", volume)
+	}
+	return nil
+}
+
 // validate runs sanity checks on the Link fields.
 func (l *Link) validate(nodes []string, ipMode IPMode) error {
-	if len(l.Endpoints) < 2 {
+	if l.HostInterface != "" {
+		if err := l.validateHostInterface(); err != nil {
+			return err
+		}
+	} else if len(l.Endpoints) < 2 {
 		return fmt.Errorf("link has fewer than two endpoints %v", l.Endpoints)
 	}
-	for _, ep := range l.Endpoints {
+	// a node may be attached twice by different interfaces, e.g. R1:eth1 and R1:eth2 looped back by a veth pair
+	endpoints := make([]string, 0, len(l.Endpoints))
+	for i, ep := range l.Endpoints {
 		if !slices.Contains(nodes, ep) {
 			return fmt.Errorf("unknown node %q in endpoints %v", ep, l.Endpoints)
 		}
+		endpoint := ep
+		if name := l.pinned(i); name != "" {
+			endpoint += ":" + name
+		}
+		if slices.Contains(endpoints, endpoint) {
+			return fmt.Errorf("link %v has duplicate endpoint %q", l.Endpoints, endpoint)
+		}
+		// Docker attaches a container to a network once, and a node cannot tell which of its ends is unpinned
+		if first := slices.Index(l.Endpoints, ep); first < i && (!l.Veth() || l.pinned(first) == "" || l.pinned(i) == "") {
+			return fmt.Errorf("link %v attaches node %q twice, which requires link_type veth and pinned interfaces", l.Endpoints, ep)
+		}
+		endpoints = append(endpoints, endpoint)
 	}
 	if l.IPv4Subnet != "" && ipMode == IPv6 {
 		return fmt.Errorf("ip_mode %q is incompatible with subnet %q", ipMode, l.IPv4Subnet)
@@ -149,6 +619,50 @@ func (l *Link) validate(nodes []string, ipMode IPMode) error {
 	if l.IPv6Subnet != "" && ipMode == IPv4 {
 		return fmt.Errorf("ip_mode %q is incompatible with subnet %q", ipMode, l.IPv6Subnet)
 	}
+	if err := l.validateType(); err != nil {
+		return err
+	}
+	if err := l.validateDriver(); err != nil {
+		return err
+	}
+	if err := l.validateEndpointOpts(); err != nil {
+		return err
+	}
+	if err := l.validateGateway(ipMode); err != nil {
+		return err
+	}
+	// IPv6 requires links to carry packets of at least 1280 bytes
+	minMTU := 1280
+	if ipMode == IPv4 {
+		minMTU = 68
+	}
+	if l.MTU != 0 && (l.MTU < minMTU || l.MTU > 65535) {
+		return fmt.Errorf("link %v has invalid mtu %d, supported: %d-65535", l.Endpoints, l.MTU, minMTU)
+	}
+	if l.IP != "" && l.IP != NoIP && l.IP != LinkLocal {
+		return fmt.Errorf("link %v has invalid ip %q, supported: %s/%s", l.Endpoints, l.IP, NoIP, LinkLocal)
+	}
+	if l.IP != "" && (l.IPv4Subnet != "" || l.IPv6Subnet != "") {
+		return fmt.Errorf("link %v without IP addressing cannot set subnets", l.Endpoints)
+	}
+	if l.IP == LinkLocal && ipMode == IPv4 {
+		return fmt.Errorf("ip_mode %q is incompatible with link-local link %v", ipMode, l.Endpoints)
+	}
+	if err := l.validateInterfaces(); err != nil {
+		return err
+	}
+	if err := validateLabels(fmt.Sprintf("link %v", l.Endpoints), l.Labels); err != nil {
+		return err
+	}
+	if err := l.validateImpairment(); err != nil {
+		return err
+	}
+	if err := validateOSPF(fmt.Sprintf("link %v", l.Endpoints), l.OSPF); err != nil {
+		return err
+	}
+	if err := validateISIS(fmt.Sprintf("link %v", l.Endpoints), l.ISIS); err != nil {
+		return err
+	}
 	if l.IPv4Subnet != "" && !isValidCIDR(l.IPv4Subnet, 4) {
 		return fmt.Errorf("%q is not a valid IPv4 subnet", l.IPv4Subnet)
 	}
@@ -158,9 +672,162 @@ func (l *Link) validate(nodes []string, ipMode IPMode) error {
 	return nil
 }
 
+// validateHostInterface checks a link bridged to a physical interface of the host. Subnets cannot be
+// calculated for it, since they have to match the network the interface is connected to.
+func (l *Link) validateHostInterface() error {
+	if len(l.Endpoints) == 0 {
+		return fmt.Errorf("link bridged to host interface %s does not have node endpoints", l.HostInterface)
+	}
+	if l.IP == "" && l.IPv4Subnet == "" && l.IPv6Subnet == "" {
+		return fmt.Errorf("link %v bridged to host interface %s requires explicit subnets or ip: %s", l.Endpoints, l.HostInterface, NoIP)
+	}
+	return nil
+}
+
+// validateType checks the type of the link. A veth pair wires exactly two nodes, so it has neither
+// a network driver nor a gateway, and cannot carry subinterfaces of other links.
+func (l *Link) validateType() error {
+	switch l.Type {
+	case "", LinkTypeNetwork:
+		return nil
+	case LinkTypeVeth:
+	default:
+		return fmt.Errorf("link %v has unsupported link_type %q, supported: network/veth", l.Endpoints, l.Type)
+	}
+	if l.HostInterface != "" || len(l.Endpoints) != 2 {
+		return fmt.Errorf("veth link %v requires exactly two node endpoints", l.Endpoints)
+	}
+	if l.Driver != "" || len(l.DriverOpts) != 0 || l.Gateway != "" {
+		return fmt.Errorf("veth link %v cannot set driver, driver_opts or gateway", l.Endpoints)
+	}
+	for _, name := range l.Interfaces {
+		if _, _, tagged := splitVLAN(name); tagged {
+			return fmt.Errorf("veth link %v cannot attach subinterface %q", l.Endpoints, name)
+		}
+	}
+	return nil
+}
+
+// validateDriver checks that the network driver is supported and able to attach to a host interface if needed.
+func (l *Link) validateDriver() error {
+	switch l.Driver {
+	case "", DriverBridge, DriverMacvlan, DriverIPvlan:
+	default:
+		return fmt.Errorf("link %v has unsupported driver %q, supported: bridge/macvlan/ipvlan", l.Endpoints, l.Driver)
+	}
+	if l.HostInterface != "" && l.Driver == DriverBridge {
+		return fmt.Errorf("link %v bridged to host interface %s requires driver macvlan or ipvlan", l.Endpoints, l.HostInterface)
+	}
+	return nil
+}
+
+// validateEndpointOpts checks that endpoint options are set for nodes of the link attached to it by Docker,
+// which excludes subinterfaces.
+func (l *Link) validateEndpointOpts() error {
+	for _, node := range slices.Sorted(maps.Keys(l.EndpointOpts)) {
+		if !slices.Contains(l.Endpoints, node) {
+			return fmt.Errorf("link %v has endpoint_opts of node %q, which is not its endpoint", l.Endpoints, node)
+		}
+		for i, ep := range l.Endpoints {
+			if _, _, tagged := splitVLAN(l.pinned(i)); ep == node && tagged {
+				return fmt.Errorf("link %v cannot set endpoint_opts of subinterface %q", l.Endpoints, l.pinned(i))
+			}
+		}
+	}
+	return nil
+}
+
+// validateGateway checks that an explicit gateway is an address of an addressed family of the link.
+func (l *Link) validateGateway(ipMode IPMode) error {
+	if l.Gateway == "" {
+		return nil
+	}
+	if l.NoGateway {
+		return fmt.Errorf("link %v sets both gateway and no_gateway", l.Endpoints)
+	}
+	if l.IP != "" {
+		return fmt.Errorf("link %v sets gateway without addressing", l.Endpoints)
+	}
+	addr, err := netip.ParseAddr(l.Gateway)
+	if err != nil {
+		return fmt.Errorf("link %v has invalid gateway %q", l.Endpoints, l.Gateway)
+	}
+	if (addr.Is4() && ipMode == IPv6) || (addr.Is6() && ipMode == IPv4) {
+		return fmt.Errorf("ip_mode %q is incompatible with gateway %q", ipMode, l.Gateway)
+	}
+	return nil
+}
+
+// vlanPattern matches subinterfaces of physical interfaces, e.g. eth1.100 or ge-0/0/1.100.
+var vlanPattern = regexp.MustCompile(`^(.+)\.([0-9]+)$`)
+
+// splitVLAN returns the parent interface and the VLAN ID of a subinterface,
+// or the interface itself if it is not a subinterface.
+func splitVLAN(name string) (string, int, bool) {
+	match := vlanPattern.FindStringSubmatch(name)
+	if match == nil {
+		return name, 0, false
+	}
+	vlan, err := strconv.Atoi(match[2])
+	if err != nil {
+		return name, 0, false
+	}
+	return match[1], vlan, true
+}
+
+// validateInterfaces checks the interfaces pinned by the link endpoints. Tagged frames travel over
+// the links of the parent interfaces, hence a link cannot mix subinterfaces with untagged endpoints.
+func (l *Link) validateInterfaces() error {
+	var tagged int
+	var untagged string
+	for i, ep := range l.Endpoints {
+		_, vlan, ok := splitVLAN(l.pinned(i))
+		if !ok {
+			untagged = cmp.Or(untagged, ep)
+			continue
+		}
+		if vlan < 1 || vlan > 4094 {
+			return fmt.Errorf("link %v has invalid subinterface %q, supported VLAN IDs: 1-4094", l.Endpoints, l.pinned(i))
+		}
+		tagged++
+	}
+	if tagged != 0 && untagged != "" {
+		return fmt.Errorf("link %v mixes subinterfaces with untagged endpoint %q", l.Endpoints, untagged)
+	}
+	return nil
+}
+
+// ratePattern matches rates in the tc notation, e.g. 100kbit or 10mbit.
+var ratePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([kmgt]?bit|[kmgt]?bps)$`)
+
+// validateImpairment checks the network emulation parameters of the link.
+func (l *Link) validateImpairment() error {
+	for _, d := range []struct{ name, value string }{{"delay", l.Delay}, {"jitter", l.Jitter}} {
+		if d.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d.value); err != nil || duration < 0 {
+			return fmt.Errorf("link %v has invalid %s %q, e.g. 20ms expected", l.Endpoints, d.name, d.value)
+		}
+	}
+	if l.Jitter != "" && l.Delay == "" {
+		return fmt.Errorf("link %v sets jitter without delay", l.Endpoints)
+	}
+	if l.Loss < 0 || l.Loss > 100 {
+		return fmt.Errorf("link %v has invalid loss %v, supported: 0-100 percent", l.Endpoints, l.Loss)
+	}
+	if l.Rate != "" && !ratePattern.MatchString(l.Rate) {
+		return fmt.Errorf("link %v has invalid rate %q, e.g. 10mbit expected", l.Endpoints, l.Rate)
+	}
+	if l.Bandwidth != "" && !ratePattern.MatchString(l.Bandwidth) {
+		return fmt.Errorf("link %v has invalid bandwidth %q, e.g. 10mbit expected", l.Endpoints, l.Bandwidth)
+	}
+	return nil
+}
+
 func (cm ConfigMode) isValid() bool {
 	switch cm {
-	case None, Manual, Auto:
+	case None, Manual, Auto, Push:
 		return true
 	default:
 		return false
@@ -112,6 +112,7 @@ func TestIsValidNodeName(t *testing.T) {
 
 func TestLinkValidateErrors(t *testing.T) {
 	t.Parallel()
+	costZero, costTooLarge, metricZero, metricTooLarge := 0, 70000, 0, 1<<24
 	testCases := []struct {
 		name   string
 		link   *Link
@@ -128,11 +129,156 @@ func TestLinkValidateErrors(t *testing.T) {
 			link:   &Link{Endpoints: []string{"R1"}},
 			errMsg: "link has fewer than two endpoints [R1]",
 		},
+		{
+			name:   "HostWithoutNodes",
+			link:   &Link{HostInterface: "enp3s0"},
+			errMsg: "link bridged to host interface enp3s0 does not have node endpoints",
+		},
+		{
+			name:   "HostWithoutSubnets",
+			link:   &Link{Endpoints: []string{"R1"}, HostInterface: "enp3s0"},
+			errMsg: "link [R1] bridged to host interface enp3s0 requires explicit subnets or ip: none",
+		},
+		{
+			name:   "HostWithBridgeDriver",
+			link:   &Link{Endpoints: []string{"R1"}, HostInterface: "enp3s0", IP: NoIP, Driver: DriverBridge},
+			errMsg: "link [R1] bridged to host interface enp3s0 requires driver macvlan or ipvlan",
+		},
+		{
+			name:   "UnsupportedDriver",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Driver: "vxlan"},
+			errMsg: `link [R1 R2] has unsupported driver "vxlan", supported: bridge/macvlan/ipvlan`,
+		},
+		{
+			name:   "EndpointOptsOfOtherNode",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, EndpointOpts: map[string]map[string]string{"R3": {"com.docker.network.endpoint.sysctls": "net.ipv4.conf.IFNAME.rp_filter=0"}}},
+			errMsg: `link [R1 R2] has endpoint_opts of node "R3", which is not its endpoint`,
+		},
+		{
+			name: "EndpointOptsOfSubinterface",
+			link: &Link{
+				Endpoints:    []string{"R1", "R2"},
+				Interfaces:   []string{"eth0.100", "eth0.100"},
+				EndpointOpts: map[string]map[string]string{"R1": {"com.docker.network.endpoint.sysctls": "net.ipv4.conf.IFNAME.rp_filter=0"}},
+			},
+			errMsg: `link [R1 R2] cannot set endpoint_opts of subinterface "eth0.100"`,
+		},
+		{
+			name:   "UnsupportedType",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Type: "vxlan"},
+			errMsg: `link [R1 R2] has unsupported link_type "vxlan", supported: network/veth`,
+		},
+		{
+			name:   "VethMultipoint",
+			link:   &Link{Endpoints: []string{"R1", "R2", "R3"}, Type: LinkTypeVeth},
+			errMsg: "veth link [R1 R2 R3] requires exactly two node endpoints",
+		},
+		{
+			name:   "VethHostInterface",
+			link:   &Link{Endpoints: []string{"R1"}, HostInterface: "enp3s0", IP: NoIP, Type: LinkTypeVeth},
+			errMsg: "veth link [R1] requires exactly two node endpoints",
+		},
+		{
+			name:   "VethDriver",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Type: LinkTypeVeth, Driver: DriverMacvlan},
+			errMsg: "veth link [R1 R2] cannot set driver, driver_opts or gateway",
+		},
+		{
+			name:   "VethSubinterface",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Type: LinkTypeVeth, Interfaces: []string{"eth1.100", "eth1.100"}},
+			errMsg: `veth link [R1 R2] cannot attach subinterface "eth1.100"`,
+		},
 		{
 			name:   "UnknownNode",
 			link:   &Link{Endpoints: []string{"R1", "R9"}},
 			errMsg: `unknown node "R9" in endpoints [R1 R9]`,
 		},
+		{
+			name:   "MTUTooSmallForIPv6",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, MTU: 1000},
+			errMsg: `link [R1 R2] has invalid mtu 1000, supported: 1280-65535`,
+		},
+		{
+			name:   "MTUTooLarge",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, MTU: 70000},
+			ipMode: IPv4,
+			errMsg: `link [R1 R2] has invalid mtu 70000, supported: 68-65535`,
+		},
+		{
+			name:   "OSPFAreaOutOfRange",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, OSPF: &OSPF{Area: "4294967296"}},
+			errMsg: `link [R1 R2] has invalid ospf area "4294967296", e.g. 0.0.0.1 or 1 expected`,
+		},
+		{
+			name:   "OSPFCostTooLarge",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, OSPF: &OSPF{Area: "0.0.0.1", Cost: &costTooLarge}},
+			errMsg: `link [R1 R2] has invalid ospf cost 70000, supported: 1-65535`,
+		},
+		{
+			name:   "OSPFCostZero",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, OSPF: &OSPF{Cost: &costZero}},
+			errMsg: `link [R1 R2] has invalid ospf cost 0, supported: 1-65535`,
+		},
+		{
+			name:   "ISISMetricTooLarge",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, ISIS: &ISIS{Metric: &metricTooLarge}},
+			errMsg: `link [R1 R2] has invalid isis metric 16777216, supported: 1-16777215`,
+		},
+		{
+			name:   "ISISMetricZero",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, ISIS: &ISIS{Metric: &metricZero}},
+			errMsg: `link [R1 R2] has invalid isis metric 0, supported: 1-16777215`,
+		},
+		{
+			name:   "BadIP",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, IP: "dhcp"},
+			errMsg: `link [R1 R2] has invalid ip "dhcp", supported: none/link-local`,
+		},
+		{
+			name:   "NoIPWithSubnet",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, IP: NoIP, IPv4Subnet: "10.1.2.0/24"},
+			errMsg: `link [R1 R2] without IP addressing cannot set subnets`,
+		},
+		{
+			name:   "BadSubinterface",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Interfaces: []string{"eth1.5000", "eth1.100"}},
+			errMsg: `link [R1 R2] has invalid subinterface "eth1.5000", supported VLAN IDs: 1-4094`,
+		},
+		{
+			name:   "UntaggedEndpoint",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Interfaces: []string{"eth1.100", "eth1"}},
+			errMsg: `link [R1 R2] mixes subinterfaces with untagged endpoint "R2"`,
+		},
+		{
+			name:   "ReservedLabel",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Labels: map[string]string{"golab.lab": "other"}},
+			errMsg: `link [R1 R2] has invalid label "golab.lab", the golab. prefix is reserved`,
+		},
+		{
+			name:   "BadDelay",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Delay: "50"},
+			errMsg: `link [R1 R2] has invalid delay "50", e.g. 20ms expected`,
+		},
+		{
+			name:   "JitterWithoutDelay",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Jitter: "5ms"},
+			errMsg: `link [R1 R2] sets jitter without delay`,
+		},
+		{
+			name:   "BadLoss",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Loss: 101},
+			errMsg: `link [R1 R2] has invalid loss 101, supported: 0-100 percent`,
+		},
+		{
+			name:   "BadRate",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Rate: "10 megabits"},
+			errMsg: `link [R1 R2] has invalid rate "10 megabits", e.g. 10mbit expected`,
+		},
+		{
+			name:   "BadBandwidth",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Bandwidth: "10M"},
+			errMsg: `link [R1 R2] has invalid bandwidth "10M", e.g. 10mbit expected`,
+		},
 		{
 			name: "BadIPv4Subnet",
 			link: &Link{
@@ -169,6 +315,33 @@ func TestLinkValidateErrors(t *testing.T) {
 			ipMode: IPv4,
 			errMsg: `ip_mode "ipv4" is incompatible with subnet "2001:db8:1:2::/129"`,
 		},
+		{
+			name:   "LinkLocalIPv4",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, IP: LinkLocal},
+			ipMode: IPv4,
+			errMsg: `ip_mode "ipv4" is incompatible with link-local link [R1 R2]`,
+		},
+		{
+			name:   "GatewayAndNoGateway",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Gateway: "10.1.2.1", NoGateway: true},
+			errMsg: "link [R1 R2] sets both gateway and no_gateway",
+		},
+		{
+			name:   "GatewayWithoutIP",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Gateway: "10.1.2.1", IP: NoIP},
+			errMsg: "link [R1 R2] sets gateway without addressing",
+		},
+		{
+			name:   "InvalidGateway",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Gateway: "10.1.2.0/24"},
+			errMsg: `link [R1 R2] has invalid gateway "10.1.2.0/24"`,
+		},
+		{
+			name:   "GatewayIPMode",
+			link:   &Link{Endpoints: []string{"R1", "R2"}, Gateway: "2001:db8:1:2::1"},
+			ipMode: IPv4,
+			errMsg: `ip_mode "ipv4" is incompatible with gateway "2001:db8:1:2::1"`,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -187,6 +360,7 @@ func TestLinkValidateErrors(t *testing.T) {
 func TestNodeValidateErrors(t *testing.T) {
 	t.Parallel()
 	var badASN uint32 = 0
+	badMetric := -1
 	testCases := []struct {
 		name     string
 		node     *Node
@@ -230,6 +404,24 @@ func TestNodeValidateErrors(t *testing.T) {
 			nodeName: "R1",
 			errMsg:   `bind mount "/var/lib/modules:var/lib/modules" has non-absolute destination path`,
 		},
+		{
+			name: "InvalidVolumeName",
+			node: &Node{
+				Image:   "ceos-4.1.1",
+				Volumes: []string{"/data:/data"},
+			},
+			nodeName: "R1",
+			errMsg:   `volume mount "/data:/data" has invalid volume name`,
+		},
+		{
+			name: "TmpfsPathNotAbsolute",
+			node: &Node{
+				Image: "ceos-4.1.1",
+				Tmpfs: []string{"var/run"},
+			},
+			nodeName: "R1",
+			errMsg:   `tmpfs mount "var/run" has non-absolute destination path`,
+		},
 		{
 			name: "BadIPv4Loopback",
 			node: &Node{
@@ -258,6 +450,96 @@ func TestNodeValidateErrors(t *testing.T) {
 			nodeName: "R1",
 			errMsg:   `node "R1" has unsupported protocol "rsvp"`,
 		},
+		{
+			name: "UnsupportedKind",
+			node: &Node{
+				Image: "internal/routing:latest",
+				Kind:  "ceos",
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has unsupported kind "ceos", supported: bird, crpd, frr, gobgp, host, linux, vmx, xrv`,
+		},
+		{
+			name: "NegativeCPUs",
+			node: &Node{
+				Image: "ceos-4.1.1",
+				CPUs:  -1,
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid cpus -1`,
+		},
+		{
+			name: "InvalidMemory",
+			node: &Node{
+				Image:  "ceos-4.1.1",
+				Memory: "lots",
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid memory "lots", e.g. 512m or 2g expected`,
+		},
+		{
+			name: "InvalidBootDelay",
+			node: &Node{
+				Image:     "quay.io/frrouting/frr:master",
+				BootDelay: "30",
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid boot_delay "30", e.g. 30s expected`,
+		},
+		{
+			name: "InvalidRestart",
+			node: &Node{
+				Image:   "quay.io/frrouting/frr:master",
+				Restart: "always",
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid restart "always", supported: no/on-failure/unless-stopped`,
+		},
+		{
+			name: "NegativeReadyTimeout",
+			node: &Node{
+				Image:        "quay.io/frrouting/frr:master",
+				ReadyTimeout: "-1m",
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid ready_timeout "-1m", e.g. 2m expected`,
+		},
+		{
+			name: "InvalidMinUptime",
+			node: &Node{
+				Image:     "quay.io/frrouting/frr:master",
+				MinUptime: "5",
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid min_uptime "5", e.g. 5s expected`,
+		},
+		{
+			name: "NegativeStopTimeout",
+			node: &Node{
+				Image:       "quay.io/frrouting/frr:master",
+				StopTimeout: "-30s",
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid stop_timeout "-30s", e.g. 30s expected`,
+		},
+		{
+			name: "InvalidPort",
+			node: &Node{
+				Image: "ceos-4.1.1",
+				Ports: []string{"2222:ssh"},
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid ports: invalid containerPort: ssh`,
+		},
+		{
+			name: "InvalidEnvName",
+			node: &Node{
+				Image: "ceos-4.1.1",
+				Env:   map[string]string{"INTFTYPE=eth": "eth"},
+			},
+			nodeName: "R1",
+			errMsg:   `node "R1" has invalid environment variable name "INTFTYPE=eth"`,
+		},
 		{
 			name: "InvalidASN",
 			node: &Node{
@@ -287,6 +569,110 @@ func TestNodeValidateErrors(t *testing.T) {
 			ipMode:   IPv6,
 			errMsg:   `ip_mode "ipv6" is incompatible with loopbacks [192.168.0.1/32]`,
 		},
+		{
+			name:     "OSPFv2InIPv6Mode",
+			node:     &Node{Image: "ceos-4.1.1", Protocols: map[string]bool{"ospf": true}},
+			nodeName: "R1",
+			ipMode:   IPv6,
+			errMsg:   `node "R1" protocol "ospf" is incompatible with ip_mode "ipv6"`,
+		},
+		{
+			name:     "OSPFv3InIPv4Mode",
+			node:     &Node{Image: "ceos-4.1.1", Protocols: map[string]bool{"ospf6": true}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" protocol "ospf6" is incompatible with ip_mode "ipv4"`,
+		},
+		{
+			name:     "RouteServerWithoutBGP",
+			node:     &Node{Image: "pierky/bird:2.15", RouteServer: true},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" sets route_server or rpki but does not run protocol "bgp"`,
+		},
+		{
+			name:     "OSPFWithoutProtocol",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", OSPF: &NodeOSPF{Area: "1"}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" sets ospf but does not run protocol "ospf" or "ospf6"`,
+		},
+		{
+			name:     "OSPFInterfaceArea",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", Protocols: map[string]bool{"ospf": true}, OSPF: &NodeOSPF{Interfaces: map[string]*OSPF{"eth1": {Area: "backbone"}}}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" interface eth1 has invalid ospf area "backbone", e.g. 0.0.0.1 or 1 expected`,
+		},
+		{
+			name:     "ISISWithoutProtocol",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", ISIS: &NodeISIS{Level: ISISLevel1}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" sets isis but does not run protocol "isis"`,
+		},
+		{
+			name:     "ISISAreaAndNET",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", Protocols: map[string]bool{"isis": true}, ISIS: &NodeISIS{Area: "49.0002", NET: "49.0002.0000.0000.0001.00"}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" sets both isis area and net, which contains the area`,
+		},
+		{
+			name:     "ISISBadArea",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", Protocols: map[string]bool{"isis": true}, ISIS: &NodeISIS{Area: "49"}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" has invalid isis area "49", e.g. 49.0001 expected`,
+		},
+		{
+			name:     "ISISBadNET",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", Protocols: map[string]bool{"isis": true}, ISIS: &NodeISIS{NET: "49.0001.0000.0000.0001"}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" has invalid isis net "49.0001.0000.0000.0001", e.g. 49.0001.1921.6800.0001.00 expected`,
+		},
+		{
+			name:     "ISISBadLevel",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", Protocols: map[string]bool{"isis": true}, ISIS: &NodeISIS{Level: "level-3"}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" has invalid isis level "level-3", supported: level-1, level-2, level-1-2`,
+		},
+		{
+			name:     "ISISInterfaceMetric",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", Protocols: map[string]bool{"isis": true}, ISIS: &NodeISIS{Interfaces: map[string]*ISIS{"eth1": {Metric: &badMetric}}}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" interface eth1 has invalid isis metric -1, supported: 1-16777215`,
+		},
+		{
+			name:     "RouteReflectorWithoutBGP",
+			node:     &Node{Image: "quay.io/frrouting/frr:master", RouteReflector: true},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" sets route_reflector but does not run protocol "bgp"`,
+		},
+		{
+			name:     "RPKIServerName",
+			node:     &Node{Image: "pierky/bird:2.15", Protocols: map[string]bool{"bgp": true}, RPKI: &RPKI{Server: "routinator"}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" has invalid rpki server address "routinator", e.g. 192.0.2.1 expected`,
+		},
+		{
+			name:     "RPKIPortOutOfRange",
+			node:     &Node{Image: "pierky/bird:2.15", Protocols: map[string]bool{"bgp": true}, RPKI: &RPKI{Server: "192.0.2.10", Port: 65536}},
+			nodeName: "R1",
+			ipMode:   IPv4,
+			errMsg:   `node "R1" rpki port 65536 is out of range 1-65535`,
+		},
+		{
+			name:     "DisabledProtocol",
+			node:     &Node{Image: "ceos-4.1.1", Protocols: map[string]bool{"ldp": false}},
+			nodeName: "R1",
+			ipMode:   IPv6,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -301,3 +687,339 @@ func TestNodeValidateErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestTopologyValidateErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		topo   *Topology
+		errMsg string
+	}{
+		{
+			name: "InvalidName",
+			topo: &Topology{
+				Name:  "my lab",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+			},
+			errMsg: `topology name "my lab" has to consist of letters, digits, dots, dashes and underscores`,
+		},
+		{
+			name: "InvalidIPAM",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				IPAM:  "random",
+			},
+			errMsg: `invalid ipam "random", supported: index/sequential/hash`,
+		},
+		{
+			name: "InvalidIPExclude",
+			topo: &Topology{
+				Name:      "triangle",
+				Nodes:     map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				IPExclude: []string{"172.17.0.0/16", "docker"},
+			},
+			errMsg: `invalid ip_exclude range "docker", e.g. 10.0.0.0/16 or 10.0.0.1 expected`,
+		},
+		{
+			name: "LinkPoolIPMode",
+			topo: &Topology{
+				Name:     "triangle",
+				Nodes:    map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				IPMode:   IPv6,
+				LinkPool: "10.0.0.0/16",
+			},
+			errMsg: `ip_mode "ipv6" is incompatible with link_pool "10.0.0.0/16"`,
+		},
+		{
+			name: "LinkPoolTooSmall",
+			topo: &Topology{
+				Name:          "triangle",
+				Nodes:         map[string]*Node{"R1": {Image: "ceos-4.1.1"}, "R2": {Image: "ceos-4.1.1"}, "R3": {Image: "ceos-4.1.1"}},
+				Links:         []*Link{{Endpoints: []string{"R1", "R2", "R3"}}},
+				LinkPool:      "10.0.0.0/16",
+				LinkPrefixLen: 30,
+			},
+			errMsg: `link [R1 R2 R3] has more endpoints than subnets of link_pool 10.0.0.0/16 can address`,
+		},
+		{
+			name: "LinkPrefixLenWithoutPool",
+			topo: &Topology{
+				Name:          "triangle",
+				Nodes:         map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				LinkPrefixLen: 29,
+			},
+			errMsg: `link_prefix_len requires link_pool`,
+		},
+		{
+			name: "PrivilegedNotAllowed",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", Privileged: true}},
+			},
+			errMsg: `node "R1" requests privileged mode but topology "triangle" does not set allow_privileged`,
+		},
+		{
+			name: "PortsOnInternalNetworks",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", Ports: []string{"2222:22"}}, "R2": {Image: "ceos-4.1.1"}},
+				Links: []*Link{{Endpoints: []string{"R1", "R2"}}},
+			},
+			errMsg: `node "R1" publishes ports but is attached to internal networks only, which requires mgmt`,
+		},
+		{
+			name: "PortsOnInternalManagement",
+			topo: &Topology{
+				Name:   "triangle",
+				Nodes:  map[string]*Node{"R1": {Image: "ceos-4.1.1", Ports: []string{"2222:22"}}},
+				Syslog: &Syslog{},
+			},
+			errMsg: `node "R1" publishes ports but is attached to internal networks only, which requires mgmt`,
+		},
+		{
+			name: "PortsOnExternalManagement",
+			topo: &Topology{
+				Name:       "triangle",
+				Nodes:      map[string]*Node{"R1": {Image: "ceos-4.1.1", Ports: []string{"2222:22"}}, "R2": {Image: "ceos-4.1.1"}},
+				Links:      []*Link{{Endpoints: []string{"R1", "R2"}}},
+				Management: &Management{},
+			},
+		},
+		{
+			name: "PortsOnDefaultBridge",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", Ports: []string{"2222:22"}}},
+			},
+		},
+		{
+			name: "PrivilegedCapabilityNotAllowed",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", CapAdd: []string{"NET_ADMIN", "SYS_MODULE"}}},
+			},
+			errMsg: `node "R1" adds capability SYS_MODULE but topology "triangle" does not set allow_privileged`,
+		},
+		{
+			name: "AllCapabilitiesNotAllowed",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", CapAdd: []string{"ALL"}}},
+			},
+			errMsg: `node "R1" adds capability ALL but topology "triangle" does not set allow_privileged`,
+		},
+		{
+			name: "PrivilegedCapabilities",
+			topo: &Topology{
+				Name:            "triangle",
+				Nodes:           map[string]*Node{"R1": {Image: "ceos-4.1.1", Privileged: true, CapAdd: []string{"SYS_TIME"}}},
+				AllowPrivileged: true,
+			},
+			errMsg: `node "R1" sets cap_add or cap_drop along with privileged`,
+		},
+		{
+			name: "InvalidCapability",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", CapDrop: []string{"cap_net_raw"}}},
+			},
+			errMsg: `node "R1" has invalid capability "cap_net_raw", e.g. NET_ADMIN expected`,
+		},
+		{
+			name: "PublicASNStart",
+			topo: &Topology{
+				Name:         "triangle",
+				Nodes:        map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				ASNStartFrom: 64000,
+			},
+			errMsg: `asn_start_from 64000 is not a private ASN, supported: 64512-65534, 4200000000-4294967294`,
+		},
+		{
+			name: "SmallMgmtSubnet",
+			topo: &Topology{
+				Name:       "triangle",
+				Nodes:      map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				Management: &Management{IPv4Subnet: "172.20.20.0/24"},
+			},
+			errMsg: `mgmt ipv4_subnet "172.20.20.0/24" is not an IPv4 subnet of /23 or larger`,
+		},
+		{
+			name: "OverlappingSubnets",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1"}, "R2": {Image: "ceos-4.1.1"}, "R3": {Image: "ceos-4.1.1"}},
+				Links: []*Link{
+					{Endpoints: []string{"R1", "R2"}, IPv4Subnet: "10.0.0.0/16"},
+					{Endpoints: []string{"R2", "R3"}, IPv4Subnet: "10.0.12.0/24"},
+				},
+			},
+			errMsg: `subnet 10.0.12.0/24 of link [R2 R3] overlaps subnet 10.0.0.0/16 of link [R1 R2]`,
+		},
+		{
+			name: "DuplicateSubnets",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1"}, "R2": {Image: "ceos-4.1.1"}},
+				Links: []*Link{
+					{Endpoints: []string{"R1", "R2"}, IPv6Subnet: "2001:db8:12::/64"},
+					{Endpoints: []string{"R1", "R2"}, IPv6Subnet: "2001:db8:12::/64"},
+				},
+			},
+			errMsg: `subnet 2001:db8:12::/64 of link [R1 R2] overlaps subnet 2001:db8:12::/64 of link [R1 R2]`,
+		},
+		{
+			name: "LoopbackInSubnet",
+			topo: &Topology{
+				Name: "triangle",
+				Nodes: map[string]*Node{
+					"R1": {Image: "ceos-4.1.1", IPv4Loopbacks: []string{"10.0.0.1/32"}},
+					"R2": {Image: "ceos-4.1.1"},
+				},
+				Links: []*Link{{Endpoints: []string{"R1", "R2"}, IPv4Subnet: "10.0.0.0/24"}},
+			},
+			errMsg: `loopback 10.0.0.1/32 of node "R1" collides with subnet 10.0.0.0/24 of link [R1 R2]`,
+		},
+		{
+			name: "UnknownDependency",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", DependsOn: []string{"R9"}}},
+			},
+			errMsg: `node "R1" has invalid dependency "R9"`,
+		},
+		{
+			name: "DependencyCycle",
+			topo: &Topology{
+				Name: "triangle",
+				Nodes: map[string]*Node{
+					"R1": {Image: "ceos-4.1.1", DependsOn: []string{"R2"}},
+					"R2": {Image: "ceos-4.1.1", DependsOn: []string{"R3"}},
+					"R3": {Image: "ceos-4.1.1", DependsOn: []string{"R1"}},
+					"R4": {Image: "ceos-4.1.1"},
+				},
+			},
+			errMsg: `nodes [R1 R2 R3] cannot be started due to circular dependencies`,
+		},
+		{
+			name: "HostWithoutVTEP",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				Hosts: map[string]*Host{"h1": {Engine: "ssh://user@h1"}},
+			},
+			errMsg: `host "h1" does not have a vtep address`,
+		},
+		{
+			name: "InvalidVTEP",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				Hosts: map[string]*Host{"h1": {VTEP: "h1.example.com"}},
+			},
+			errMsg: `host "h1" has invalid vtep address "h1.example.com", e.g. 192.0.2.1 expected`,
+		},
+		{
+			name: "UndefinedHost",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "ceos-4.1.1", Host: "h2"}},
+				Hosts: map[string]*Host{"h1": {VTEP: "192.0.2.1"}},
+			},
+			errMsg: `node "R1" is placed on undefined host "h2"`,
+		},
+		{
+			name: "VMOnSeveralHosts",
+			topo: &Topology{
+				Name:  "triangle",
+				Nodes: map[string]*Node{"R1": {Image: "images/vmx.qcow2", Host: "h1"}},
+				Hosts: map[string]*Host{"h1": {VTEP: "192.0.2.1"}},
+			},
+			errMsg: `node "R1" is a virtual machine, which labs spread over several hosts do not support`,
+		},
+		{
+			name: "ServicesOnSeveralHosts",
+			topo: &Topology{
+				Name:   "triangle",
+				Nodes:  map[string]*Node{"R1": {Image: "ceos-4.1.1"}},
+				Hosts:  map[string]*Host{"h1": {VTEP: "192.0.2.1"}, "h2": {VTEP: "192.0.2.2"}},
+				Syslog: &Syslog{},
+			},
+			errMsg: `lab services syslog and dns require a single host`,
+		},
+		{
+			name: "PrivilegedAllowed",
+			topo: &Topology{
+				Name:            "triangle",
+				Nodes:           map[string]*Node{"R1": {Image: "ceos-4.1.1", Privileged: true}},
+				AllowPrivileged: true,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.topo.validate()
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if tc.errMsg != errMsg {
+				t.Errorf("error: want %q, got %q", tc.errMsg, errMsg)
+			}
+		})
+	}
+}
+
+func TestValidatePushErrors(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		topo   *Topology
+		errMsg string
+	}{
+		{
+			name:   "MissingSection",
+			topo:   &Topology{ConfigMode: Push},
+			errMsg: `config mode "push" requires the push section`,
+		},
+		{
+			name:   "UnsupportedProtocol",
+			topo:   &Topology{ConfigMode: Push, Push: &ConfigPush{Protocol: "gnmi"}},
+			errMsg: `push protocol "gnmi" is not supported, supported: netconf`,
+		},
+		{
+			name:   "MissingUsername",
+			topo:   &Topology{ConfigMode: Push, Push: &ConfigPush{}},
+			errMsg: "push section does not have a username",
+		},
+		{
+			name:   "UndefinedSecret",
+			topo:   &Topology{ConfigMode: Push, Push: &ConfigPush{Username: "admin", PasswordSecret: "netconf"}},
+			errMsg: `push password secret "netconf" is not defined`,
+		},
+		{
+			name: "Valid",
+			topo: &Topology{
+				ConfigMode: Push,
+				Push:       &ConfigPush{Username: "admin", PasswordSecret: "netconf"},
+				Secrets:    map[string]string{"netconf": "env:NETCONF_PASSWORD"},
+			},
+		},
+		{
+			name: "NotPushMode",
+			topo: &Topology{ConfigMode: Auto},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.topo.validatePush()
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if tc.errMsg != errMsg {
+				t.Errorf("error: want %q, got %q", tc.errMsg, errMsg)
+			}
+		})
+	}
+}
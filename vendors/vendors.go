@@ -1,7 +1,15 @@
 // Package vendors provides vendor-specific configuration for network nodes.
 package vendors
 
-import "strings"
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultShell is started by interactive sessions on nodes of vendors without a dedicated shell.
+const DefaultShell = "/bin/sh"
 
 // Vendor represents a virtual network node vendor.
 type Vendor string
@@ -9,14 +17,43 @@ type Vendor string
 const (
 	UNKNOWN Vendor = ""
 	FRR     Vendor = "frr"
+	CRPD    Vendor = "crpd"
+	// BIRD and GOBGP are BGP daemons, e.g. for route servers and RPKI labs.
+	BIRD  Vendor = "bird"
+	GOBGP Vendor = "gobgp"
+	// XRV and VMX are router VMs booted by QEMU inside vrnetlab-style containers.
+	XRV Vendor = "xrv"
+	VMX Vendor = "vmx"
+	// HOST is a plain Linux container acting as a traffic endpoint, which is never detected by image.
+	HOST Vendor = "host"
+	// LINUX is a plain Linux container configured by a generated shell script, which is never detected by image.
+	LINUX Vendor = "linux"
 )
 
 // Config represents vendor-specific configuration for a node.
 type Config struct {
-	ImageSubstr string
-	ConfigPath  string
-	ConfigFiles []string
-	ExtraBinds  []string
+	ImageSubstr  string
+	ConfigPath   string
+	ConfigFiles  []string
+	ExtraBinds   []string
+	Capabilities []string
+	Telemetry    map[string][]string
+	PushTemplate string
+	Shell        []string
+	SaveCommand  []string
+	// ReadyCommand succeeds once the network OS of a started container is able to take configuration.
+	ReadyCommand []string
+	// InterfacePrefix precedes the number of vendor-native interface names, e.g. ge-0/0/ of ge-0/0/1.
+	InterfacePrefix string
+	// FirstInterface is the container NIC of the first vendor-native interface, e.g. 1 for VMs whose
+	// containers forward eth0 to the management interface of the VM.
+	FirstInterface int
+	// Devices are host devices passed to containers, e.g. /dev/kvm for VMs.
+	Devices []string
+	// ReadyTimeout overrides the default time a started container has to become ready, e.g. for slow VMs.
+	ReadyTimeout string
+	// Cmd keeps containers of images without a long-running process alive unless overridden by the node.
+	Cmd []string
 }
 
 var configByVendor = map[Vendor]Config{
@@ -31,19 +68,108 @@ var configByVendor = map[Vendor]Config{
 		ExtraBinds: []string{
 			"/lib/modules:/lib/modules",
 		},
+		Capabilities: []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+		Telemetry: map[string][]string{
+			"interfaces": {"vtysh", "-c", "show interface json"},
+			"bgp":        {"vtysh", "-c", "show bgp summary json"},
+		},
+		Shell:        []string{"vtysh"},
+		SaveCommand:  []string{"vtysh", "-c", "write memory"},
+		ReadyCommand: []string{"vtysh", "-c", "show version"},
+	},
+	CRPD: {
+		ImageSubstr:     "crpd",
+		Capabilities:    []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+		PushTemplate:    "netconf.xml",
+		Shell:           []string{"cli"},
+		InterfacePrefix: "ge-0/0/",
+		ReadyCommand:    []string{"cli", "show", "version"},
+	},
+	BIRD: {
+		ImageSubstr:  "bird",
+		ConfigPath:   "/etc/bird",
+		ConfigFiles:  []string{"/etc/bird/bird.conf"},
+		Capabilities: []string{"NET_ADMIN", "NET_RAW"},
+		Shell:        []string{"birdc"},
+		ReadyCommand: []string{"birdc", "show", "status"},
+	},
+	// gobgp images ship both binaries without agreeing on a startup command
+	GOBGP: {
+		ImageSubstr:  "gobgp",
+		ConfigPath:   "/etc/gobgp",
+		ConfigFiles:  []string{"/etc/gobgp/gobgpd.toml"},
+		Capabilities: []string{"NET_ADMIN", "NET_RAW"},
+		ReadyCommand: []string{"gobgp", "global"},
+		Cmd:          []string{"gobgpd", "-f", "/etc/gobgp/gobgpd.toml"},
+	},
+	// vrnetlab images report the VM as healthy once it has booted and expose its console on port 5000
+	XRV: {
+		ImageSubstr:     "vr-xrv",
+		Capabilities:    []string{"NET_ADMIN", "NET_RAW"},
+		Devices:         []string{"/dev/kvm", "/dev/net/tun"},
+		Shell:           []string{"telnet", "127.0.0.1", "5000"},
+		InterfacePrefix: "GigabitEthernet0/0/0/",
+		FirstInterface:  1,
+		ReadyTimeout:    "15m",
+	},
+	VMX: {
+		ImageSubstr:     "vr-vmx",
+		Capabilities:    []string{"NET_ADMIN", "NET_RAW"},
+		Devices:         []string{"/dev/kvm", "/dev/net/tun"},
+		Shell:           []string{"telnet", "127.0.0.1", "5000"},
+		InterfacePrefix: "ge-0/0/",
+		FirstInterface:  1,
+		ReadyTimeout:    "15m",
+	},
+	HOST: {
+		Capabilities: []string{"NET_ADMIN", "NET_RAW"},
+		Cmd:          []string{"sleep", "infinity"},
+	},
+	// the setup script is only mounted when configuration is generated, hence it is run if present
+	LINUX: {
+		ConfigPath:   "/etc/golab",
+		ConfigFiles:  []string{"/etc/golab/setup.sh"},
+		Capabilities: []string{"NET_ADMIN", "NET_RAW"},
+		Cmd:          []string{"/bin/sh", "-c", "test ! -f /etc/golab/setup.sh || /bin/sh -e /etc/golab/setup.sh && exec sleep infinity"},
 	},
 }
 
 // DetectByImage attempts to detect a node vendor based on the container image name.
 func DetectByImage(image string) Vendor {
 	for vendor, config := range configByVendor {
-		if strings.Contains(image, config.ImageSubstr) {
+		if config.ImageSubstr != "" && strings.Contains(image, config.ImageSubstr) {
 			return vendor
 		}
 	}
 	return UNKNOWN
 }
 
+// Supported returns all vendors with a known configuration in a stable order.
+func Supported() []Vendor {
+	return slices.Sorted(maps.Keys(configByVendor))
+}
+
+// NICName translates an interface name into the name of the container NIC, e.g. ge-0/0/1 into eth1, or into
+// eth2 if the first interface is eth1. Container NIC names are accepted as they are, while unknown names are
+// reported as such.
+func (c Config) NICName(name string) (string, bool) {
+	if num, found := strings.CutPrefix(name, "eth"); found && isNumber(num) {
+		return name, true
+	}
+	if num, found := strings.CutPrefix(name, c.InterfacePrefix); c.InterfacePrefix != "" && found && isNumber(num) {
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return "", false
+		}
+		return "eth" + strconv.Itoa(n+c.FirstInterface), true
+	}
+	return "", false
+}
+
+func isNumber(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
 // GetConfig provides vendor-specific configuration.
 func GetConfig(v Vendor) Config {
 	return configByVendor[v]
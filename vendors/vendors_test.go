@@ -27,7 +27,17 @@ func TestDetectByImage(t *testing.T) {
 		{
 			name:  "Juniper",
 			image: "crpd:20.2R1.10",
-			want:  vendors.UNKNOWN,
+			want:  vendors.CRPD,
+		},
+		{
+			name:  "BIRD",
+			image: "pierky/bird:2.15",
+			want:  vendors.BIRD,
+		},
+		{
+			name:  "JuniperVM",
+			image: "vrnetlab/vr-vmx:18.2R1.9",
+			want:  vendors.VMX,
 		},
 	}
 	for _, tc := range testCases {
@@ -40,6 +50,14 @@ func TestDetectByImage(t *testing.T) {
 	}
 }
 
+func TestSupported(t *testing.T) {
+	t.Parallel()
+	want := []vendors.Vendor{vendors.BIRD, vendors.CRPD, vendors.FRR, vendors.GOBGP, vendors.HOST, vendors.LINUX, vendors.VMX, vendors.XRV}
+	if diff := cmp.Diff(want, vendors.Supported()); diff != "" {
+		t.Error(diff)
+	}
+}
+
 func TestGetConfig(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -61,6 +79,36 @@ func TestGetConfig(t *testing.T) {
 				ExtraBinds: []string{
 					"/lib/modules:/lib/modules",
 				},
+				Capabilities: []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+				Telemetry: map[string][]string{
+					"interfaces": {"vtysh", "-c", "show interface json"},
+					"bgp":        {"vtysh", "-c", "show bgp summary json"},
+				},
+				Shell:        []string{"vtysh"},
+				SaveCommand:  []string{"vtysh", "-c", "write memory"},
+				ReadyCommand: []string{"vtysh", "-c", "show version"},
+			},
+		},
+		{
+			name:   "Juniper",
+			vendor: vendors.CRPD,
+			want: vendors.Config{
+				ImageSubstr:     "crpd",
+				Capabilities:    []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+				PushTemplate:    "netconf.xml",
+				Shell:           []string{"cli"},
+				ReadyCommand:    []string{"cli", "show", "version"},
+				InterfacePrefix: "ge-0/0/",
+			},
+		},
+		{
+			name:   "Linux",
+			vendor: vendors.LINUX,
+			want: vendors.Config{
+				ConfigPath:   "/etc/golab",
+				ConfigFiles:  []string{"/etc/golab/setup.sh"},
+				Capabilities: []string{"NET_ADMIN", "NET_RAW"},
+				Cmd:          []string{"/bin/sh", "-c", "test ! -f /etc/golab/setup.sh || /bin/sh -e /etc/golab/setup.sh && exec sleep infinity"},
 			},
 		},
 		{
@@ -78,3 +126,31 @@ func TestGetConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestNICName(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		vendor vendors.Vendor
+		iface  string
+		want   string
+		wantOK bool
+	}{
+		{name: "LinuxName", vendor: vendors.FRR, iface: "eth2", want: "eth2", wantOK: true},
+		{name: "NativeName", vendor: vendors.CRPD, iface: "ge-0/0/3", want: "eth3", wantOK: true},
+		{name: "LinuxNameOnJuniper", vendor: vendors.CRPD, iface: "eth3", want: "eth3", wantOK: true},
+		{name: "ForeignName", vendor: vendors.FRR, iface: "ge-0/0/3"},
+		{name: "NoNumber", vendor: vendors.CRPD, iface: "ge-0/0/"},
+		{name: "NativeNameOnVM", vendor: vendors.XRV, iface: "GigabitEthernet0/0/0/0", want: "eth1", wantOK: true},
+		{name: "LinuxNameOnVM", vendor: vendors.VMX, iface: "eth1", want: "eth1", wantOK: true},
+		{name: "Unknown", vendor: vendors.UNKNOWN, iface: "Ethernet1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := vendors.GetConfig(tc.vendor).NICName(tc.iface)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("want %q, %v, got %q, %v", tc.want, tc.wantOK, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Package version reports build metadata of the golab binary.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata injected at link time, e.g.
+// go build -ldflags "-X github.com/elupevg/golab/version.Version=v1.0.0 -X github.com/elupevg/golab/version.Commit=abc1234".
+// Empty values are filled from the build information embedded by the Go toolchain.
+var (
+	Version string
+	Commit  string
+)
+
+// Info represents build metadata of the binary.
+type Info struct {
+	Version   string
+	Commit    string
+	Modified  bool
+	GoVersion string
+}
+
+// Get returns build metadata, preferring the values injected at link time.
+func Get() Info {
+	buildInfo, _ := debug.ReadBuildInfo()
+	return get(buildInfo)
+}
+
+func get(buildInfo *debug.BuildInfo) Info {
+	info := Info{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+	if buildInfo == nil {
+		return info.withDefaults()
+	}
+	if info.Version == "" {
+		info.Version = buildInfo.Main.Version
+	}
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info.withDefaults()
+}
+
+func (i Info) withDefaults() Info {
+	if i.Version == "" || i.Version == "(devel)" {
+		i.Version = "devel"
+	}
+	if i.Commit == "" {
+		i.Commit = "unknown"
+	}
+	return i
+}
+
+// String formats build metadata for bug reports.
+func (i Info) String() string {
+	commit := i.Commit
+	if i.Modified {
+		commit += " (modified)"
+	}
+	return fmt.Sprintf("golab %s\ncommit: %s\ngo: %s\n", i.Version, commit, i.GoVersion)
+}
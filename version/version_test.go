@@ -0,0 +1,62 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	testCases := []struct {
+		name      string
+		version   string
+		commit    string
+		buildInfo *debug.BuildInfo
+		want      Info
+	}{
+		{
+			name: "NoBuildInfo",
+			want: Info{Version: "devel", Commit: "unknown"},
+		},
+		{
+			name: "BuildInfo",
+			buildInfo: &debug.BuildInfo{
+				Main: debug.Module{Version: "v0.3.0"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs.revision", Value: "0df37e1"},
+					{Key: "vcs.modified", Value: "true"},
+				},
+			},
+			want: Info{Version: "v0.3.0", Commit: "0df37e1", Modified: true},
+		},
+		{
+			name:    "LinkerFlags",
+			version: "v1.0.0",
+			commit:  "abc1234",
+			buildInfo: &debug.BuildInfo{
+				Main:     debug.Module{Version: "(devel)"},
+				Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "0df37e1"}},
+			},
+			want: Info{Version: "v1.0.0", Commit: "abc1234"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			Version, Commit = tc.version, tc.commit
+			t.Cleanup(func() { Version, Commit = "", "" })
+			tc.want.GoVersion = runtime.Version()
+			if got := get(tc.buildInfo); got != tc.want {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	info := Info{Version: "v1.0.0", Commit: "abc1234", Modified: true, GoVersion: "go1.24.3"}
+	want := "golab v1.0.0\ncommit: abc1234 (modified)\ngo: go1.24.3\n"
+	if got := info.String(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}